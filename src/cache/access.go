@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// accessFile records, in the cache directory, how often each rendition was
+// used, so access frequency survives restarts
+const accessFile = ".access"
+
+// Access counts are halved once the uses since the last halving reach
+// accessDecayFactor per counted rendition, at least minAccessDecayHits, so
+// they reflect recent use and renditions no longer used are forgotten
+const (
+	accessDecayFactor  = 16
+	minAccessDecayHits = 1024
+)
+
+// accessCounts is an approximate use counter per rendition, keyed by its
+// path relative to the cache directory without the compressed suffix
+type accessCounts struct {
+	mu     sync.Mutex
+	counts map[string]uint32
+	hits   int  // Uses since the last halving
+	dirty  bool // Changed since the last save
+}
+
+// newAccessCounts returns the counts saved in cacheDir, empty when there
+// are none or they cannot be read
+func newAccessCounts(cacheDir string) *accessCounts {
+	a := &accessCounts{counts: map[string]uint32{}}
+	data, err := os.ReadFile(filepath.Join(cacheDir, accessFile))
+	if err == nil && json.Unmarshal(data, &a.counts) != nil {
+		a.counts = map[string]uint32{}
+	}
+	return a
+}
+
+// hit counts one use of a rendition
+func (a *accessCounts) hit(key string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.counts[key] < ^uint32(0) {
+		a.counts[key]++
+	}
+	a.hits++
+	a.dirty = true
+	if a.hits >= max(accessDecayFactor*len(a.counts), minAccessDecayHits) {
+		a.decay()
+	}
+}
+
+// decay halves every count, dropping those that reach zero. The caller
+// must hold the lock.
+func (a *accessCounts) decay() {
+	for key, count := range a.counts {
+		if count /= 2; count == 0 {
+			delete(a.counts, key)
+		} else {
+			a.counts[key] = count
+		}
+	}
+	a.hits = 0
+}
+
+// count returns the uses counted for a rendition
+func (a *accessCounts) count(key string) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return int(a.counts[key])
+}
+
+// forget drops the counts of removed renditions
+func (a *accessCounts) forget(keys ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, key := range keys {
+		delete(a.counts, key)
+	}
+	a.dirty = true
+}
+
+// reset drops every count
+func (a *accessCounts) reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.counts = map[string]uint32{}
+	a.hits = 0
+	a.dirty = true
+}
+
+// accessKey returns the access count key of a rendition file
+func (m *manager) accessKey(path string) string {
+	rel, err := filepath.Rel(m.cacheDir, strings.TrimSuffix(path, compressedSuffix))
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// SaveAccessCounts writes the access counts to the cache directory, so
+// eviction and warm-up order keep them across restarts. Unchanged counts
+// are not written again.
+func (m *manager) SaveAccessCounts() error {
+	m.access.mu.Lock()
+	defer m.access.mu.Unlock()
+	if !m.access.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(m.access.counts)
+	if err != nil {
+		return fmt.Errorf("failed to encode access counts: %w", err)
+	}
+	path := filepath.Join(m.cacheDir, accessFile)
+	tempFile := path + ".tmp"
+	if err := m.writeFile(tempFile, data); err != nil {
+		return fmt.Errorf("failed to write access counts: %w", err)
+	}
+	if err := os.Rename(tempFile, path); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to rename access counts: %w", err)
+	}
+	m.access.dirty = false
+	return nil
+}
+
+// sortForEviction orders renditions from the first to evict to the last.
+// Each doubling of a rendition's access count extends its last use by
+// frequencyWeight, so frequently used renditions outlast ones used once
+// about as recently; with no weight the order is least recently used.
+func (m *manager) sortForEviction(variants []cachedVariant) {
+	keepUntil := make([]time.Time, len(variants))
+	for i, variant := range variants {
+		count := m.access.count(m.accessKey(variant.path))
+		keepUntil[i] = variant.usedAt.Add(m.frequencyWeight * time.Duration(bits.Len(uint(count))))
+	}
+	sort.Sort(evictionOrder{variants, keepUntil})
+}
+
+// evictionOrder sorts renditions by when they may be evicted
+type evictionOrder struct {
+	variants  []cachedVariant
+	keepUntil []time.Time
+}
+
+func (o evictionOrder) Len() int           { return len(o.variants) }
+func (o evictionOrder) Less(i, j int) bool { return o.keepUntil[i].Before(o.keepUntil[j]) }
+func (o evictionOrder) Swap(i, j int) {
+	o.variants[i], o.variants[j] = o.variants[j], o.variants[i]
+	o.keepUntil[i], o.keepUntil[j] = o.keepUntil[j], o.keepUntil[i]
+}
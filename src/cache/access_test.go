@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCacheManager_FrequencyWeight_Eviction tests that frequently retrieved
+// renditions survive eviction over more recently used ones, per file and
+// across the cache, while without a weight eviction stays least recently
+// used
+func TestCacheManager_FrequencyWeight_Eviction(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		perFile bool
+		evicted string
+	}{
+		{"Global", Options{MaxTotalVariants: 3, FrequencyWeight: time.Hour}, false, "b"},
+		{"Global without weight", Options{MaxTotalVariants: 3}, false, "a"},
+		{"Per file", Options{MaxVariantsPerFile: 3, FrequencyWeight: time.Hour}, true, "b"},
+		{"Per file without weight", Options{MaxVariantsPerFile: 3}, true, "a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange: a is the hot rendition, but the least recently used
+			manager, err := NewManagerWithOptions(t.TempDir(), tt.opts)
+			require.NoError(t, err)
+			source := func(name string) string {
+				if tt.perFile {
+					return "photo.jpg"
+				}
+				return name + ".jpg"
+			}
+			params := func(i int) ProcessingParams {
+				return ProcessingParams{Width: 100 + i, Height: 100, Format: "webp", Quality: 90}
+			}
+			base := time.Now().Add(-time.Hour)
+			for i, name := range []string{"a", "b", "c"} {
+				require.NoError(t, manager.Store(source(name), params(i), []byte(name)))
+				if name == "a" {
+					for range 8 {
+						_, found, err := manager.Retrieve(source(name), params(i))
+						require.NoError(t, err)
+						require.True(t, found)
+					}
+				}
+				usedAt := base.Add(time.Duration(i) * time.Minute)
+				require.NoError(t, os.Chtimes(manager.GetPath(source(name), params(i)), usedAt, usedAt))
+			}
+
+			// Act
+			err = manager.Store(source("d"), params(3), []byte("d"))
+
+			// Assert
+			require.NoError(t, err)
+			for i, name := range []string{"a", "b", "c", "d"} {
+				assert.Equal(t, name != tt.evicted, manager.Exists(source(name), params(i)), name)
+			}
+		})
+	}
+}
+
+// TestCacheManager_AccessCounts tests that retrievals and touches are
+// counted per entry, saved and loaded again, and dropped by ClearAll
+func TestCacheManager_AccessCounts(t *testing.T) {
+	// Arrange
+	cacheDir := t.TempDir()
+	manager, err := NewManager(cacheDir)
+	require.NoError(t, err)
+	hot := ProcessingParams{Width: 100, Height: 100, Format: "webp", Quality: 90}
+	cold := ProcessingParams{Width: 50, Height: 50, Format: "webp", Quality: 90}
+	require.NoError(t, manager.Store("photo.jpg", hot, []byte("hot")))
+	require.NoError(t, manager.Store("photo.jpg", cold, []byte("cold")))
+
+	// Act
+	for range 3 {
+		_, found, err := manager.Retrieve("photo.jpg", hot)
+		require.NoError(t, err)
+		require.True(t, found)
+	}
+	assert.True(t, manager.Touch("photo.jpg", hot))
+	require.NoError(t, manager.SaveAccessCounts())
+	reopened, err := NewManager(cacheDir)
+	require.NoError(t, err)
+
+	// Assert
+	hits := map[string]int{}
+	require.NoError(t, reopened.Iterate(func(entry CacheEntry) bool {
+		hits[filepath.Base(entry.Path)] = entry.Hits
+		return true
+	}))
+	assert.Len(t, hits, 2, "the saved counts must not be listed as an entry")
+	assert.Equal(t, 4, hits[filepath.Base(reopened.GetPath("photo.jpg", hot))])
+	assert.Equal(t, 0, hits[filepath.Base(reopened.GetPath("photo.jpg", cold))])
+
+	require.NoError(t, reopened.ClearAll())
+	require.NoError(t, reopened.Store("photo.jpg", hot, []byte("hot")))
+	require.NoError(t, reopened.Iterate(func(entry CacheEntry) bool {
+		assert.Zero(t, entry.Hits)
+		return true
+	}))
+}
+
+// Test that counts are halved as uses accumulate, forgetting unused keys
+func TestAccessCounts_Decay(t *testing.T) {
+	counts := &accessCounts{counts: map[string]uint32{"old": 1}}
+	for range minAccessDecayHits - 1 {
+		counts.hit("hot")
+	}
+	assert.Equal(t, minAccessDecayHits-1, counts.count("hot"))
+	assert.Equal(t, 1, counts.count("old"))
+
+	counts.hit("hot")
+	assert.Equal(t, minAccessDecayHits/2, counts.count("hot"))
+	assert.Zero(t, counts.count("old"))
+	assert.NotContains(t, counts.counts, "old")
+}
@@ -0,0 +1,15 @@
+package cache
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// accessTime returns the last access time of a cache file
+func accessTime(info os.FileInfo) time.Time {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return time.Unix(st.Atim.Unix())
+	}
+	return info.ModTime()
+}
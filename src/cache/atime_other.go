@@ -0,0 +1,14 @@
+//go:build !linux
+
+package cache
+
+import (
+	"os"
+	"time"
+)
+
+// accessTime returns the modification time, which stores and cache hits
+// keep current, where the access time is not available
+func accessTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
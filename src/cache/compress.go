@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// compressedSuffix marks a rendition stored gzip-compressed, e.g.
+// {hash}.png.gz next to where {hash}.png would be
+const compressedSuffix = ".gz"
+
+// minCompressionSavings is the fraction of its size a rendition must shrink
+// by to be kept compressed. Already compressed formats rarely qualify.
+const minCompressionSavings = 0.1
+
+// storedEntry returns the file holding the rendition for cachePath, which
+// is cachePath itself or its compressed form
+func storedEntry(cachePath string) (string, bool) {
+	for _, path := range []string{cachePath, cachePath + compressedSuffix} {
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// decompress returns the original bytes of a compressed rendition
+func decompress(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// CompressCold gzips renditions in the configured formats whose last use is
+// older than CompressAfter. The cache is only locked while each entry is
+// replaced, so requests are served during the pass.
+func (m *manager) CompressCold() (*CompressionResult, error) {
+	result := &CompressionResult{}
+	if m.compressAfter <= 0 {
+		return result, nil
+	}
+	cutoff := time.Now().Add(-m.compressAfter)
+
+	var candidates []string
+	err := m.Iterate(func(entry CacheEntry) bool {
+		if !entry.Compressed && m.compressFormats[entry.Format] && entry.ModTime.Before(cutoff) {
+			candidates = append(candidates, entry.Path)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range candidates {
+		saved, err := m.compressEntry(path, cutoff)
+		if err != nil {
+			return result, err
+		}
+		if saved > 0 {
+			result.Compressed++
+			result.SavedBytes += saved
+		}
+	}
+	return result, nil
+}
+
+// compressEntry replaces a rendition with its compressed form if it is
+// still cold and compresses well, returning the bytes saved
+func (m *manager) compressEntry(path string, cutoff time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// The entry may have been used or removed since the scan
+	info, err := os.Stat(path)
+	if err != nil || !info.ModTime().Before(cutoff) {
+		return 0, nil
+	}
+	data, err := m.readFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read cache file: %w", err)
+	}
+
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		return 0, fmt.Errorf("failed to compress cache file: %w", err)
+	}
+	if float64(buf.Len()) > float64(len(data))*(1-minCompressionSavings) {
+		return 0, nil
+	}
+
+	// Write atomically, keeping the last use time for eviction
+	compressedPath := path + compressedSuffix
+	tempFile := compressedPath + ".tmp"
+	if err := m.writeFile(tempFile, buf.Bytes()); err != nil {
+		return 0, fmt.Errorf("failed to write compressed cache file: %w", err)
+	}
+	if err := os.Rename(tempFile, compressedPath); err != nil {
+		os.Remove(tempFile)
+		return 0, fmt.Errorf("failed to rename compressed cache file: %w", err)
+	}
+	os.Chtimes(compressedPath, info.ModTime(), info.ModTime())
+	if err := os.Remove(path); err != nil {
+		return 0, fmt.Errorf("failed to remove compressed cache file: %w", err)
+	}
+
+	return int64(len(data) - buf.Len()), nil
+}
+
+// RunJanitor compresses cold cache entries, prunes old source versions and
+// saves the access counts every interval until ctx is done
+func RunJanitor(ctx context.Context, cm CacheManager, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sweep(cm)
+		}
+	}
+}
+
+// sweep runs one janitor pass
+func sweep(cm CacheManager) {
+	if pruned, err := cm.PruneVersions(); err != nil {
+		log.Printf("Warning: cache janitor failed to prune source versions: %v", err)
+	} else if pruned > 0 {
+		log.Printf("Cache janitor removed the renditions of %d old source versions", pruned)
+	}
+
+	if err := cm.SaveAccessCounts(); err != nil {
+		log.Printf("Warning: cache janitor failed to save access counts: %v", err)
+	}
+
+	result, err := cm.CompressCold()
+	if err != nil {
+		log.Printf("Warning: cache janitor failed: %v", err)
+		return
+	}
+	if result.Compressed > 0 {
+		log.Printf("Cache janitor compressed %d cold entries, saving %d bytes", result.Compressed, result.SavedBytes)
+	}
+}
@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeCold backdates a cached file's last use
+func makeCold(t *testing.T, path string, age time.Duration) {
+	old := time.Now().Add(-age)
+	require.NoError(t, os.Chtimes(path, old, old))
+}
+
+// TestCacheManager_CompressCold_RetrievesOriginalBytes tests that a
+// compressed entry is returned unchanged by Retrieve
+func TestCacheManager_CompressCold_RetrievesOriginalBytes(t *testing.T) {
+	// Arrange
+	tempDir := t.TempDir()
+	manager, err := NewManagerWithOptions(tempDir, Options{CompressAfter: time.Hour, CompressFormats: []string{"png"}})
+	require.NoError(t, err)
+
+	params := ProcessingParams{Width: 800, Height: 600, Format: "png", Quality: 90}
+	data := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte("compressible"), 1000)...)
+	require.NoError(t, manager.Store("photo.jpg", params, data))
+	cachePath := manager.GetPath("photo.jpg", params)
+	makeCold(t, cachePath, 2*time.Hour)
+
+	// Act
+	result, err := manager.CompressCold()
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Compressed)
+	assert.Greater(t, result.SavedBytes, int64(len(data)/2))
+	assert.NoFileExists(t, cachePath)
+	assert.FileExists(t, cachePath+compressedSuffix)
+
+	assert.True(t, manager.Exists("photo.jpg", params))
+	retrieved, found, err := manager.Retrieve("photo.jpg", params)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, data, retrieved)
+
+	formats, err := manager.Variants("photo.jpg", params)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"png"}, formats)
+}
+
+// TestCacheManager_CompressCold_Policy tests which entries a pass leaves alone
+func TestCacheManager_CompressCold_Policy(t *testing.T) {
+	// Arrange
+	tempDir := t.TempDir()
+	manager, err := NewManagerWithOptions(tempDir, Options{CompressAfter: time.Hour})
+	require.NoError(t, err)
+
+	compressible := bytes.Repeat([]byte("a"), 4096)
+	recent := ProcessingParams{Width: 100, Height: 100, Format: "png", Quality: 90}
+	otherFormat := ProcessingParams{Width: 200, Height: 200, Format: "webp", Quality: 90}
+	incompressible := ProcessingParams{Width: 300, Height: 300, Format: "png", Quality: 90}
+
+	require.NoError(t, manager.Store("photo.jpg", recent, compressible))
+	require.NoError(t, manager.Store("photo.jpg", otherFormat, compressible))
+	require.NoError(t, manager.Store("photo.jpg", incompressible, []byte("short")))
+	makeCold(t, manager.GetPath("photo.jpg", otherFormat), 2*time.Hour)
+	makeCold(t, manager.GetPath("photo.jpg", incompressible), 2*time.Hour)
+
+	// Act
+	result, err := manager.CompressCold()
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Compressed)
+	for _, params := range []ProcessingParams{recent, otherFormat, incompressible} {
+		assert.FileExists(t, manager.GetPath("photo.jpg", params))
+	}
+}
+
+// TestCacheManager_CompressCold_StoreReplacesCompressed tests that storing a
+// rendition again drops its compressed copy
+func TestCacheManager_CompressCold_StoreReplacesCompressed(t *testing.T) {
+	// Arrange
+	tempDir := t.TempDir()
+	manager, err := NewManagerWithOptions(tempDir, Options{CompressAfter: time.Minute, MaxVariantsPerFile: 1})
+	require.NoError(t, err)
+
+	params := ProcessingParams{Width: 800, Height: 600, Format: "png", Quality: 90}
+	require.NoError(t, manager.Store("photo.jpg", params, bytes.Repeat([]byte("old"), 1000)))
+	makeCold(t, manager.GetPath("photo.jpg", params), time.Hour)
+	result, err := manager.CompressCold()
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Compressed)
+
+	// Act
+	require.NoError(t, manager.Store("photo.jpg", params, []byte("new")))
+
+	// Assert
+	assert.NoFileExists(t, manager.GetPath("photo.jpg", params)+compressedSuffix)
+	retrieved, found, err := manager.Retrieve("photo.jpg", params)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []byte("new"), retrieved)
+}
+
+// TestCacheManager_CompressCold_Disabled tests that a zero idle period never compresses
+func TestCacheManager_CompressCold_Disabled(t *testing.T) {
+	// Arrange
+	tempDir := t.TempDir()
+	manager, err := NewManager(tempDir)
+	require.NoError(t, err)
+
+	params := ProcessingParams{Width: 800, Height: 600, Format: "png", Quality: 90}
+	require.NoError(t, manager.Store("photo.jpg", params, bytes.Repeat([]byte("a"), 4096)))
+	makeCold(t, manager.GetPath("photo.jpg", params), 24*time.Hour)
+
+	// Act
+	result, err := manager.CompressCold()
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Compressed)
+	assert.FileExists(t, manager.GetPath("photo.jpg", params))
+}
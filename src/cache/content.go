@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"goimgserver/storage"
+	"io"
+	"sync"
+	"time"
+)
+
+// contentPrefix is the top-level directory of renditions cached by source
+// content, e.g. {cache_dir}/_content/{sha256}/...
+const contentPrefix = "_content"
+
+// ContentPath returns the path to cache the renditions of a source with
+// the given content hash under. Identical sources at different paths share
+// one set of renditions.
+func ContentPath(sum string) string {
+	return contentPrefix + "/" + sum
+}
+
+// SourceHashes hashes source files, remembering each file's hash until its
+// size or modification time changes so a source is read for hashing once
+type SourceHashes struct {
+	files   storage.FS
+	mu      sync.Mutex
+	entries map[string]sourceHash
+}
+
+// sourceHash is the hash of one version of a source file
+type sourceHash struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// NewSourceHashes creates an empty cache of hashes of OS files
+func NewSourceHashes() *SourceHashes {
+	return NewSourceHashesFrom(storage.OS)
+}
+
+// NewSourceHashesFrom creates an empty cache of hashes of files read from
+// files
+func NewSourceHashesFrom(files storage.FS) *SourceHashes {
+	return &SourceHashes{
+		files:   files,
+		entries: make(map[string]sourceHash),
+	}
+}
+
+// Sum returns the hex SHA-256 of the file at path
+func (s *SourceHashes) Sum(path string) (string, error) {
+	info, err := s.files.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	entry, found := s.entries[path]
+	s.mu.Unlock()
+	if found && entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+		return entry.sum, nil
+	}
+
+	file, err := s.files.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	entry = sourceHash{
+		size:    info.Size(),
+		modTime: info.ModTime(),
+		sum:     hex.EncodeToString(h.Sum(nil)),
+	}
+
+	s.mu.Lock()
+	s.entries[path] = entry
+	s.mu.Unlock()
+	return entry.sum, nil
+}
@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSourceHashes_SharedContent tests that identical sources at different
+// paths hash alike, share cache entries and are rehashed once rewritten
+func TestSourceHashes_SharedContent(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	first := filepath.Join(dir, "photo.jpg")
+	second := filepath.Join(dir, "copies", "photo.jpg")
+	require.NoError(t, os.MkdirAll(filepath.Dir(second), 0755))
+	require.NoError(t, os.WriteFile(first, []byte("same bytes"), 0644))
+	require.NoError(t, os.WriteFile(second, []byte("same bytes"), 0644))
+	hashes := NewSourceHashes()
+
+	// Act
+	firstSum, err := hashes.Sum(first)
+	require.NoError(t, err)
+	secondSum, err := hashes.Sum(second)
+	require.NoError(t, err)
+
+	// Assert
+	assert.Equal(t, firstSum, secondSum)
+	manager, err := NewManager(t.TempDir())
+	require.NoError(t, err)
+	params := ProcessingParams{Width: 300, Height: 200, Format: "webp", Quality: 75}
+	require.NoError(t, manager.Store(ContentPath(firstSum), params, []byte("rendition")))
+	data, found, err := manager.Retrieve(ContentPath(secondSum), params)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []byte("rendition"), data)
+
+	// A rewritten source gets a new hash
+	require.NoError(t, os.WriteFile(second, []byte("other bytes"), 0644))
+	require.NoError(t, os.Chtimes(second, time.Now(), time.Now().Add(time.Second)))
+	changed, err := hashes.Sum(second)
+	require.NoError(t, err)
+	assert.NotEqual(t, firstSum, changed)
+}
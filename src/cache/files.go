@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"os"
+)
+
+// fileOps reads and writes whole cache files, closing each before it returns
+type fileOps struct {
+	readFile  func(name string) ([]byte, error)
+	writeFile func(name string, data []byte, perm os.FileMode) error
+}
+
+// osFileOps accesses cache files on disk
+var osFileOps = fileOps{readFile: os.ReadFile, writeFile: os.WriteFile}
+
+// fileLimiter bounds how many cache files are open at once, so a burst of
+// concurrent retrievals cannot exhaust the process's file descriptors. A
+// nil limiter does not limit.
+type fileLimiter chan struct{}
+
+// newFileLimiter returns a limiter for max open files (0 = unlimited)
+func newFileLimiter(max int) fileLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return make(fileLimiter, max)
+}
+
+// acquire waits for a free slot
+func (l fileLimiter) acquire() {
+	if l != nil {
+		l <- struct{}{}
+	}
+}
+
+// release frees the slot taken by acquire
+func (l fileLimiter) release() {
+	if l != nil {
+		<-l
+	}
+}
+
+// readFile reads a cache file within the open file limit
+func (m *manager) readFile(name string) ([]byte, error) {
+	m.openFiles.acquire()
+	defer m.openFiles.release()
+	return m.files.readFile(name)
+}
+
+// writeFile writes a cache file within the open file limit
+func (m *manager) writeFile(name string, data []byte) error {
+	m.openFiles.acquire()
+	defer m.openFiles.release()
+	return m.files.writeFile(name, data, 0644)
+}
@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingFileOps wraps the disk file operations, recording how many files
+// are open at once
+type countingFileOps struct {
+	open atomic.Int64
+	peak atomic.Int64
+}
+
+func (c *countingFileOps) track() func() {
+	open := c.open.Add(1)
+	for peak := c.peak.Load(); open > peak && !c.peak.CompareAndSwap(peak, open); peak = c.peak.Load() {
+	}
+	// Hold the file briefly so concurrent operations overlap
+	time.Sleep(time.Millisecond)
+	return func() { c.open.Add(-1) }
+}
+
+func (c *countingFileOps) fileOps() fileOps {
+	return fileOps{
+		readFile: func(name string) ([]byte, error) {
+			defer c.track()()
+			return os.ReadFile(name)
+		},
+		writeFile: func(name string, data []byte, perm os.FileMode) error {
+			defer c.track()()
+			return os.WriteFile(name, data, perm)
+		},
+	}
+}
+
+// TestCacheManager_MaxOpenFiles_BoundsConcurrentFiles tests concurrent operations stay within the open file limit
+func TestCacheManager_MaxOpenFiles_BoundsConcurrentFiles(t *testing.T) {
+	for _, limit := range []int{1, 4} {
+		t.Run(fmt.Sprint(limit), func(t *testing.T) {
+			// Arrange
+			tempDir := t.TempDir()
+			cm, err := NewManagerWithOptions(tempDir, Options{MaxOpenFiles: limit})
+			require.NoError(t, err)
+			counter := &countingFileOps{}
+			cm.(*manager).files = counter.fileOps()
+
+			params := ProcessingParams{Width: 800, Height: 600, Format: "webp", Quality: 90}
+			for i := 0; i < 20; i++ {
+				require.NoError(t, cm.Store(fmt.Sprintf("photo%d.jpg", i), params, []byte("data")))
+			}
+
+			// Act
+			var wg sync.WaitGroup
+			for i := 0; i < 200; i++ {
+				wg.Add(1)
+				go func(id int) {
+					defer wg.Done()
+					source := fmt.Sprintf("photo%d.jpg", id%20)
+					if id%10 == 0 {
+						assert.NoError(t, cm.Store(source, params, []byte("new data")))
+						return
+					}
+					_, found, err := cm.Retrieve(source, params)
+					assert.NoError(t, err)
+					assert.True(t, found)
+				}(i)
+			}
+			wg.Wait()
+
+			// Assert
+			assert.LessOrEqual(t, counter.peak.Load(), int64(limit))
+			assert.Zero(t, counter.open.Load(), "every file must be closed")
+		})
+	}
+}
+
+// TestCacheManager_MaxOpenFiles_Unlimited tests operations overlap without a limit
+func TestCacheManager_MaxOpenFiles_Unlimited(t *testing.T) {
+	// Arrange
+	tempDir := t.TempDir()
+	cm, err := NewManager(tempDir)
+	require.NoError(t, err)
+	counter := &countingFileOps{}
+	cm.(*manager).files = counter.fileOps()
+
+	params := ProcessingParams{Width: 800, Height: 600, Format: "webp", Quality: 90}
+	require.NoError(t, cm.Store("photo.jpg", params, []byte("data")))
+
+	// Act
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := cm.Retrieve("photo.jpg", params)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	// Assert
+	assert.Greater(t, counter.peak.Load(), int64(1))
+	assert.Zero(t, counter.open.Load())
+}
+
+// TestCacheManager_MaxOpenFiles_Negative tests a negative limit is rejected
+func TestCacheManager_MaxOpenFiles_Negative(t *testing.T) {
+	_, err := NewManagerWithOptions(t.TempDir(), Options{MaxOpenFiles: -1})
+	assert.Error(t, err)
+}
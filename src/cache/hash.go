@@ -4,8 +4,39 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"path/filepath"
+	"regexp"
 )
 
+// variantGroupPattern matches the directory names produced by variantGroup
+var variantGroupPattern = regexp.MustCompile(`^\d+x\d+_q(\d+|auto)$`)
+
+// variantGroup names the directory shared by all format variants of a
+// rendition, e.g. "800x600_q90" or "800x0_qauto"
+func variantGroup(params ProcessingParams) string {
+	quality := fmt.Sprintf("q%d", params.Quality)
+	if params.AutoQuality {
+		quality = "qauto"
+	}
+	return fmt.Sprintf("%dx%d_%s", params.Width, params.Height, quality)
+}
+
+// shardPrefix returns the hash prefix directories for a source path,
+// two hex characters per level, e.g. "ab/cd" for two levels
+func shardPrefix(cleanPath string, levels int) string {
+	if levels <= 0 {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(cleanPath))
+	digest := hex.EncodeToString(sum[:])
+
+	parts := make([]string, levels)
+	for i := range parts {
+		parts[i] = digest[i*2 : i*2+2]
+	}
+	return filepath.Join(parts...)
+}
+
 // generateHash creates a SHA256 hash from resolved file path and processing parameters
 func generateHash(resolvedPath string, params ProcessingParams) string {
 	h := sha256.New()
@@ -16,7 +47,62 @@ func generateHash(resolvedPath string, params ProcessingParams) string {
 	// Write normalized parameters
 	h.Write([]byte(fmt.Sprintf("%dx%d", params.Width, params.Height)))
 	h.Write([]byte(params.Format))
-	h.Write([]byte(fmt.Sprintf("q%d", params.Quality)))
+	if params.AutoQuality {
+		h.Write([]byte("qauto"))
+	} else {
+		h.Write([]byte(fmt.Sprintf("q%d", params.Quality)))
+	}
+	// 4:2:0 is the default and keeps the existing keys
+	if params.ChromaSubsampling != "" && params.ChromaSubsampling != "420" {
+		h.Write([]byte("c" + params.ChromaSubsampling))
+	}
+	if params.Poster {
+		h.Write([]byte(fmt.Sprintf("f%d", params.Frame)))
+	}
+	if params.DPI > 0 {
+		h.Write([]byte(fmt.Sprintf("d%d", params.DPI)))
+	}
+	// The background only shows when padding
+	if params.Pad {
+		h.Write([]byte("pad" + params.Background))
+	}
+	if params.Cover {
+		h.Write([]byte("cover"))
+	}
+	if params.Crop != [4]int{} {
+		h.Write([]byte(fmt.Sprintf("crop%d_%d_%d_%d", params.Crop[0], params.Crop[1], params.Crop[2], params.Crop[3])))
+	}
+	if params.Trim {
+		h.Write([]byte(fmt.Sprintf("trim%d", params.TrimThreshold)))
+	}
+	// sRGB without a profile is the default and keeps the existing keys
+	if params.ColorSpace != "" {
+		h.Write([]byte("cs" + params.ColorSpace))
+	}
+	if params.EmbedICC {
+		h.Write([]byte("icc"))
+	}
+	if params.SaveData {
+		h.Write([]byte("savedata"))
+	}
+	if params.Progressive {
+		h.Write([]byte("progressive"))
+	}
+	if params.Filter != "" {
+		h.Write([]byte("filter" + params.Filter))
+	}
+	if params.Caption != "" {
+		h.Write([]byte(fmt.Sprintf("caption%s_%d_%s_%q", params.CaptionPosition, params.CaptionSize, params.CaptionColor, params.Caption)))
+	}
+	if params.NoUpscale {
+		h.Write([]byte("noupscale"))
+	}
+	if params.MaxUpscale > 0 {
+		h.Write([]byte(fmt.Sprintf("maxupscale%g", params.MaxUpscale)))
+	}
+	if params.Original {
+		h.Write([]byte("original"))
+	}
 
 	return hex.EncodeToString(h.Sum(nil))
 }
@@ -124,6 +124,222 @@ func Test_GenerateHash_EmptyPath(t *testing.T) {
 	assert.Len(t, hash, 64)
 }
 
+// Test_GenerateHash_AutoQuality tests that qauto does not collide with a fixed quality
+func Test_GenerateHash_AutoQuality(t *testing.T) {
+	// Arrange
+	fixed := ProcessingParams{Width: 800, Height: 600, Format: "webp", Quality: 75}
+	auto := ProcessingParams{Width: 800, Height: 600, Format: "webp", Quality: 75, AutoQuality: true}
+
+	// Act
+	hash1 := generateHash("photo.jpg", fixed)
+	hash2 := generateHash("photo.jpg", auto)
+
+	// Assert
+	assert.NotEqual(t, hash1, hash2, "Auto quality should not share a key with fixed quality")
+}
+
+// Test_GenerateHash_ChromaSubsampling tests that non-default subsampling changes the key
+func Test_GenerateHash_ChromaSubsampling(t *testing.T) {
+	// Arrange
+	base := ProcessingParams{Width: 800, Height: 600, Format: "jpeg", Quality: 90}
+	explicit420 := base
+	explicit420.ChromaSubsampling = "420"
+	full := base
+	full.ChromaSubsampling = "444"
+
+	// Act & Assert
+	assert.Equal(t, generateHash("photo.jpg", base), generateHash("photo.jpg", explicit420), "4:2:0 is the default")
+	assert.NotEqual(t, generateHash("photo.jpg", base), generateHash("photo.jpg", full))
+}
+
+// Test_GenerateHash_Poster tests that poster frames get their own keys
+func Test_GenerateHash_Poster(t *testing.T) {
+	// Arrange
+	base := ProcessingParams{Width: 800, Height: 600, Format: "webp", Quality: 90}
+	first := base
+	first.Poster = true
+	third := first
+	third.Frame = 2
+
+	// Act & Assert
+	assert.NotEqual(t, generateHash("anim.gif", base), generateHash("anim.gif", first), "Poster should not share a key with the animation")
+	assert.NotEqual(t, generateHash("anim.gif", first), generateHash("anim.gif", third))
+}
+
+// Test_GenerateHash_DPI tests that renditions with a recorded DPI get their own keys
+func Test_GenerateHash_DPI(t *testing.T) {
+	// Arrange
+	base := ProcessingParams{Width: 800, Height: 600, Format: "jpeg", Quality: 90}
+	printed := base
+	printed.DPI = 300
+
+	// Act & Assert
+	assert.NotEqual(t, generateHash("photo.jpg", base), generateHash("photo.jpg", printed))
+}
+
+// Test_GenerateHash_Pad tests that padded renditions are keyed by their background
+func Test_GenerateHash_Pad(t *testing.T) {
+	// Arrange
+	base := ProcessingParams{Width: 300, Height: 250, Format: "png", Quality: 90}
+	padded := base
+	padded.Pad = true
+	red := padded
+	red.Background = "ff0000"
+	unpaddedRed := base
+	unpaddedRed.Background = "ff0000"
+
+	// Act & Assert
+	assert.NotEqual(t, generateHash("ad.jpg", base), generateHash("ad.jpg", padded))
+	assert.NotEqual(t, generateHash("ad.jpg", padded), generateHash("ad.jpg", red))
+	assert.Equal(t, generateHash("ad.jpg", base), generateHash("ad.jpg", unpaddedRed), "Background without padding should not change the key")
+}
+
+// Test_GenerateHash_Crop tests that each crop rectangle gets its own key
+func Test_GenerateHash_Crop(t *testing.T) {
+	// Arrange
+	base := ProcessingParams{Width: 200, Height: 150, Format: "png", Quality: 90}
+	cropped := base
+	cropped.Crop = [4]int{100, 50, 400, 300}
+	shifted := base
+	shifted.Crop = [4]int{100, 50, 300, 400}
+
+	// Act & Assert
+	assert.NotEqual(t, generateHash("photo.jpg", base), generateHash("photo.jpg", cropped))
+	assert.NotEqual(t, generateHash("photo.jpg", cropped), generateHash("photo.jpg", shifted))
+}
+
+// Test_GenerateHash_Trim tests trimmed renditions get a key per threshold
+func Test_GenerateHash_Trim(t *testing.T) {
+	// Arrange
+	base := ProcessingParams{Width: 200, Height: 150, Format: "png", Quality: 90}
+	trimmed := base
+	trimmed.Trim = true
+	trimmed.TrimThreshold = 10
+	exact := trimmed
+	exact.TrimThreshold = 0
+
+	// Act & Assert
+	assert.NotEqual(t, generateHash("photo.jpg", base), generateHash("photo.jpg", trimmed))
+	assert.NotEqual(t, generateHash("photo.jpg", trimmed), generateHash("photo.jpg", exact))
+}
+
+// Test_GenerateHash_ColorSpace tests preserved color spaces and embedded profiles get their own keys
+func Test_GenerateHash_ColorSpace(t *testing.T) {
+	// Arrange
+	base := ProcessingParams{Width: 200, Height: 150, Format: "png", Quality: 90}
+	preserved := base
+	preserved.ColorSpace = "preserve"
+	embedded := base
+	embedded.EmbedICC = true
+
+	// Act & Assert
+	assert.NotEqual(t, generateHash("photo.jpg", base), generateHash("photo.jpg", preserved))
+	assert.NotEqual(t, generateHash("photo.jpg", base), generateHash("photo.jpg", embedded))
+	assert.NotEqual(t, generateHash("photo.jpg", preserved), generateHash("photo.jpg", embedded))
+}
+
+// Test_GenerateHash_Progressive tests progressive renditions get their own key
+func Test_GenerateHash_Progressive(t *testing.T) {
+	// Arrange
+	base := ProcessingParams{Width: 200, Height: 150, Format: "jpeg", Quality: 90}
+	progressive := base
+	progressive.Progressive = true
+
+	// Act & Assert
+	assert.NotEqual(t, generateHash("photo.jpg", base), generateHash("photo.jpg", progressive))
+}
+
+// Test_GenerateHash_Filter tests each filter gets its own key
+func Test_GenerateHash_Filter(t *testing.T) {
+	// Arrange
+	base := ProcessingParams{Width: 200, Height: 150, Format: "png", Quality: 90}
+	grayscale := base
+	grayscale.Filter = "grayscale"
+	sepia := base
+	sepia.Filter = "sepia"
+
+	// Act & Assert
+	assert.NotEqual(t, generateHash("photo.jpg", base), generateHash("photo.jpg", grayscale))
+	assert.NotEqual(t, generateHash("photo.jpg", grayscale), generateHash("photo.jpg", sepia))
+}
+
+// Test_GenerateHash_Caption tests that the caption text and each layout
+// setting get their own key
+func Test_GenerateHash_Caption(t *testing.T) {
+	// Arrange
+	base := ProcessingParams{Width: 1200, Height: 630, Format: "jpeg", Quality: 90}
+	hello := base
+	hello.Caption, hello.CaptionPosition, hello.CaptionSize, hello.CaptionColor = "Hello", "bottom", 48, "ffffff"
+	other := hello
+	other.Caption = "Hello!"
+	top := hello
+	top.CaptionPosition = "top"
+	larger := hello
+	larger.CaptionSize = 64
+	black := hello
+	black.CaptionColor = "000000"
+
+	// Act & Assert
+	hashes := map[string]bool{}
+	for _, params := range []ProcessingParams{base, hello, other, top, larger, black} {
+		hashes[generateHash("photo.jpg", params)] = true
+	}
+	assert.Len(t, hashes, 6)
+}
+
+// Test_GenerateHash_Cover tests that covered renditions get their own key
+func Test_GenerateHash_Cover(t *testing.T) {
+	// Arrange
+	base := ProcessingParams{Width: 150, Height: 150, Format: "webp", Quality: 90}
+	cover := base
+	cover.Cover = true
+
+	// Act & Assert
+	assert.NotEqual(t, generateHash("photo.jpg", base), generateHash("photo.jpg", cover))
+}
+
+// Test_GenerateHash_Sidecar tests renditions shaped by an image's sidecar
+// get their own key
+func Test_GenerateHash_Sidecar(t *testing.T) {
+	// Arrange
+	base := ProcessingParams{Width: 200, Height: 150, Format: "jpeg", Quality: 90}
+	noUpscale := base
+	noUpscale.NoUpscale = true
+	original := base
+	original.Original = true
+
+	// Act & Assert
+	assert.NotEqual(t, generateHash("photo.jpg", base), generateHash("photo.jpg", noUpscale))
+	assert.NotEqual(t, generateHash("photo.jpg", base), generateHash("photo.jpg", original))
+	assert.NotEqual(t, generateHash("photo.jpg", noUpscale), generateHash("photo.jpg", original))
+}
+
+// Test_GenerateHash_MaxUpscale tests renditions clamped to different
+// upscale limits get their own key
+func Test_GenerateHash_MaxUpscale(t *testing.T) {
+	// Arrange
+	base := ProcessingParams{Width: 4000, Height: 3000, Format: "webp", Quality: 90}
+	double := base
+	double.MaxUpscale = 2
+	triple := base
+	triple.MaxUpscale = 3
+
+	// Act & Assert
+	assert.NotEqual(t, generateHash("photo.jpg", base), generateHash("photo.jpg", double))
+	assert.NotEqual(t, generateHash("photo.jpg", double), generateHash("photo.jpg", triple))
+}
+
+// Test_GenerateHash_SaveData tests Save-Data renditions get their own key
+func Test_GenerateHash_SaveData(t *testing.T) {
+	// Arrange
+	base := ProcessingParams{Width: 200, Height: 150, Format: "webp", Quality: 40}
+	saveData := base
+	saveData.SaveData = true
+
+	// Act & Assert
+	assert.NotEqual(t, generateHash("photo.jpg", base), generateHash("photo.jpg", saveData))
+}
+
 // Test_GenerateHash_SpecialCharacters tests hash generation with special characters in path
 func Test_GenerateHash_SpecialCharacters(t *testing.T) {
 	// Arrange
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CacheEntry describes one cached rendition
+type CacheEntry struct {
+	Path       string    // File path of the entry, including any compressed suffix
+	Source     string    // Source file the rendition was made from, relative to the image directory
+	Hash       string    // Cache key, the file name without its format extension
+	Format     string    // Output format, empty for renditions stored without one
+	Size       int64     // Bytes on disk
+	ModTime    time.Time // Last use: stores and cache hits refresh it
+	AccessTime time.Time // Last read as reported by the file system (ModTime where unavailable)
+	Compressed bool      // Stored gzip-compressed by CompressCold
+	Hits       int       // Recent uses, halved as uses accumulate
+}
+
+// Iterate calls fn for each cached rendition until fn returns false. The
+// entries are listed under the cache lock and visited after it is released,
+// so fn sees a snapshot: each rendition present when Iterate started is
+// visited exactly once, while renditions stored meanwhile may be missed and
+// fn may itself store, retrieve or clear entries.
+func (m *manager) Iterate(fn func(entry CacheEntry) bool) error {
+	return m.IterateContext(context.Background(), fn)
+}
+
+// IterateContext is Iterate that stops listing or visiting entries once
+// ctx ends, returning the context's error
+func (m *manager) IterateContext(ctx context.Context, fn func(entry CacheEntry) bool) error {
+	m.mu.RLock()
+	entries, err := m.entries(ctx)
+	m.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !fn(entry) {
+			break
+		}
+	}
+	return nil
+}
+
+// entries lists every cached rendition, stopping once ctx ends. Callers
+// must hold the cache lock.
+func (m *manager) entries(ctx context.Context) ([]CacheEntry, error) {
+	var entries []CacheEntry
+	err := filepath.WalkDir(m.cacheDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// Renditions live in {source}/{variant group}/{hash}.{format}
+		groupDir := filepath.Dir(path)
+		if d.IsDir() || strings.HasSuffix(path, ".tmp") || !variantGroupPattern.MatchString(filepath.Base(groupDir)) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // Removed since it was listed
+		}
+		source, err := filepath.Rel(m.cacheDir, filepath.Dir(groupDir))
+		if err != nil {
+			return nil
+		}
+
+		name, compressed := strings.CutSuffix(d.Name(), compressedSuffix)
+		hash, format, _ := strings.Cut(name, ".")
+		entries = append(entries, CacheEntry{
+			Path:       path,
+			Source:     m.unshard(filepath.ToSlash(source)),
+			Hash:       hash,
+			Format:     format,
+			Size:       info.Size(),
+			ModTime:    info.ModTime(),
+			AccessTime: accessTime(info),
+			Compressed: compressed,
+			Hits:       m.access.count(m.accessKey(path)),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan cache: %w", err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,210 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCacheManager_Iterate_VisitsEachEntryOnce tests every rendition is visited exactly once
+func TestCacheManager_Iterate_VisitsEachEntryOnce(t *testing.T) {
+	// Arrange
+	tempDir := t.TempDir()
+	manager, err := NewManagerWithOptions(tempDir, Options{ShardLevels: 1, CompressAfter: time.Hour})
+	require.NoError(t, err)
+
+	expected := map[string]ProcessingParams{}
+	for i, source := range []string{"photo.jpg", "dir/banner.png", "logo.png"} {
+		for _, format := range []string{"webp", "png"} {
+			params := ProcessingParams{Width: 100 * (i + 1), Height: 100, Format: format, Quality: 90}
+			require.NoError(t, manager.Store(source, params, bytes.Repeat([]byte("a"), 4096)))
+			expected[manager.GetPath(source, params)] = params
+		}
+	}
+	cold := ProcessingParams{Width: 100, Height: 100, Format: "png", Quality: 90}
+	makeCold(t, manager.GetPath("photo.jpg", cold), 2*time.Hour)
+	_, err = manager.CompressCold()
+	require.NoError(t, err)
+
+	// Temporary files of an interrupted store are not entries
+	tmp := manager.GetPath("logo.png", ProcessingParams{Width: 300, Height: 100, Format: "webp", Quality: 90}) + ".tmp"
+	require.NoError(t, os.WriteFile(tmp, []byte("partial"), 0644))
+
+	// Act
+	visits := map[string]int{}
+	err = manager.Iterate(func(entry CacheEntry) bool {
+		visits[entry.Path]++
+		return true
+	})
+
+	// Assert
+	require.NoError(t, err)
+	assert.Len(t, visits, len(expected))
+	for path, count := range visits {
+		assert.Equal(t, 1, count, path)
+	}
+
+	var compressed CacheEntry
+	manager.Iterate(func(entry CacheEntry) bool {
+		if entry.Compressed {
+			compressed = entry
+		}
+		return true
+	})
+	coldPath := manager.GetPath("photo.jpg", cold)
+	assert.Equal(t, coldPath+compressedSuffix, compressed.Path)
+	assert.Equal(t, "photo.jpg", compressed.Source)
+	assert.Equal(t, manager.GenerateKey("photo.jpg", cold), compressed.Hash)
+	assert.Equal(t, "png", compressed.Format)
+	assert.Less(t, compressed.Size, int64(4096))
+	assert.WithinDuration(t, time.Now().Add(-2*time.Hour), compressed.ModTime, time.Minute)
+	assert.False(t, compressed.AccessTime.IsZero())
+}
+
+// TestCacheManager_Iterate_StopsEarly tests returning false ends the iteration
+func TestCacheManager_Iterate_StopsEarly(t *testing.T) {
+	// Arrange
+	tempDir := t.TempDir()
+	manager, err := NewManager(tempDir)
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		params := ProcessingParams{Width: 100 + i, Height: 100, Format: "webp", Quality: 90}
+		require.NoError(t, manager.Store("photo.jpg", params, []byte("data")))
+	}
+
+	// Act
+	visited := 0
+	err = manager.Iterate(func(entry CacheEntry) bool {
+		visited++
+		return visited < 2
+	})
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, 2, visited)
+}
+
+// TestCacheManager_Iterate_Concurrent tests iteration alongside stores and retrievals
+func TestCacheManager_Iterate_Concurrent(t *testing.T) {
+	// Arrange
+	tempDir := t.TempDir()
+	manager, err := NewManager(tempDir)
+	require.NoError(t, err)
+
+	params := ProcessingParams{Width: 800, Height: 600, Format: "webp", Quality: 90}
+	existing := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		source := fmt.Sprintf("photo%d.jpg", i)
+		require.NoError(t, manager.Store(source, params, []byte("data")))
+		existing[filepath.Clean(manager.GetPath(source, params))] = true
+	}
+
+	// Act
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			assert.NoError(t, manager.Store(fmt.Sprintf("new%d.jpg", id), params, []byte("data")))
+			_, _, err := manager.Retrieve(fmt.Sprintf("photo%d.jpg", id), params)
+			assert.NoError(t, err)
+		}(i)
+	}
+
+	// Stores from inside the callback must not deadlock
+	visits := map[string]int{}
+	err = manager.Iterate(func(entry CacheEntry) bool {
+		visits[entry.Path]++
+		assert.NoError(t, manager.Store(entry.Source, ProcessingParams{Width: 10, Height: 10, Format: "png", Quality: 90}, []byte("thumb")))
+		return true
+	})
+	wg.Wait()
+
+	// Assert
+	require.NoError(t, err)
+	for path := range existing {
+		assert.Equal(t, 1, visits[path], path)
+	}
+	for path, count := range visits {
+		assert.Equal(t, 1, count, path)
+	}
+}
+
+// countdownContext is cancelled once its Err has been checked n times, so
+// a traversal is stopped partway through deterministically
+type countdownContext struct {
+	context.Context
+	n atomic.Int64
+}
+
+func newCountdownContext(n int64) *countdownContext {
+	ctx := &countdownContext{Context: context.Background()}
+	ctx.n.Store(n)
+	return ctx
+}
+
+func (c *countdownContext) Err() error {
+	if c.n.Add(-1) < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+// TestCacheManager_Traversal_Cancelled tests that stats, iteration and
+// clearing stop partway through once their context is cancelled
+func TestCacheManager_Traversal_Cancelled(t *testing.T) {
+	// Arrange
+	tempDir := t.TempDir()
+	manager, err := NewManagerWithOptions(tempDir, Options{ShardLevels: 1})
+	require.NoError(t, err)
+	const renditions = 200
+	for i := 0; i < renditions; i++ {
+		params := ProcessingParams{Width: 100, Height: 100, Format: "webp", Quality: 90}
+		require.NoError(t, manager.Store(fmt.Sprintf("photo%d.jpg", i), params, []byte("data")))
+	}
+
+	t.Run("GetStats", func(t *testing.T) {
+		start := time.Now()
+		stats, err := manager.GetStatsContext(newCountdownContext(20))
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Nil(t, stats)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("IterateContext", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		visited := 0
+		err := manager.IterateContext(ctx, func(entry CacheEntry) bool {
+			visited++
+			if visited == 10 {
+				cancel()
+			}
+			return true
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 10, visited)
+	})
+
+	t.Run("ClearAllContext", func(t *testing.T) {
+		start := time.Now()
+		err := manager.ClearAllContext(newCountdownContext(20))
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Less(t, time.Since(start), time.Second)
+
+		// Renditions not reached yet are still cached and counted
+		stats, err := manager.GetStats()
+		require.NoError(t, err)
+		assert.Greater(t, stats.TotalFiles, int64(0))
+		assert.Less(t, stats.TotalFiles, int64(renditions))
+	})
+}
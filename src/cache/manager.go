@@ -1,29 +1,152 @@
 package cache
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 )
 
+// topVariantFiles is how many source files GetStats reports variant counts for
+const topVariantFiles = 10
+
+// maxShardLevels is the deepest supported shard directory nesting
+const maxShardLevels = 2
+
+// Options configures optional cache manager behavior
+type Options struct {
+	// MaxVariantsPerFile caps the renditions kept per source file,
+	// evicting the least recently used ones first (0 = unlimited)
+	MaxVariantsPerFile int
+
+	// MaxTotalVariants caps the renditions kept across the whole cache,
+	// evicting the least recently used ones first (0 = unlimited)
+	MaxTotalVariants int
+
+	// ShardLevels nests each source file under that many two-character
+	// hash prefix directories, e.g. {cache_dir}/ab/{filename}/... (0 = off)
+	ShardLevels int
+
+	// CompressAfter is how long a rendition must go unused before
+	// CompressCold gzips it (0 = never)
+	CompressAfter time.Duration
+
+	// CompressFormats lists the rendition formats CompressCold may
+	// compress (empty = png)
+	CompressFormats []string
+
+	// MaxOpenFiles bounds the cache files read or written at once; further
+	// operations wait for one to finish (0 = unlimited)
+	MaxOpenFiles int
+
+	// WriteRetryInterval is how often a cache made read-only by failed
+	// writes tries a store again (0 = DefaultWriteRetryInterval)
+	WriteRetryInterval time.Duration
+
+	// MaxSourceVersions is how many versions of each source file
+	// PruneVersions keeps the content-addressed renditions of, newest
+	// first (0 = all)
+	MaxSourceVersions int
+
+	// FrequencyWeight is how much longer eviction treats a rendition as
+	// recently used per doubling of its access count (0 = least recently
+	// used only)
+	FrequencyWeight time.Duration
+}
+
 // manager implements the CacheManager interface
 type manager struct {
-	cacheDir string
-	mu       sync.RWMutex
+	cacheDir    string
+	maxVariants int // Renditions kept per source file (0 = unlimited)
+	maxTotal    int // Renditions kept across the cache (0 = unlimited)
+	shardLevels int // Hash prefix directories above each source file (0 = flat)
+	maxVersions int // Versions of each source file kept by PruneVersions (0 = all)
+
+	totalVariants   int   // Renditions in the cache when maxTotal is set (-1 = not counted yet)
+	globalEvictions int64 // Stores that evicted to stay within maxTotal
+
+	compressAfter   time.Duration   // Idle time before a rendition is compressed (0 = never)
+	compressFormats map[string]bool // Formats eligible for compression
+
+	access          *accessCounts // Uses per rendition
+	frequencyWeight time.Duration // Eviction bonus per doubling of uses (0 = LRU)
+
+	files     fileOps      // Reads and writes cache files
+	openFiles fileLimiter  // Bounds the cache files open at once
+	writes    *writeHealth // Stops writing after repeated failures
+	pending   *writeCoordinator
+	mu        sync.RWMutex
+}
+
+// cachedVariant is one rendition file and when it was last used
+type cachedVariant struct {
+	path   string
+	usedAt time.Time
 }
 
 // NewManager creates a new cache manager instance
 func NewManager(cacheDir string) (CacheManager, error) {
+	return NewManagerWithLimit(cacheDir, 0)
+}
+
+// NewManagerWithLimit creates a cache manager that keeps at most maxVariants
+// renditions per source file, evicting that file's least recently used
+// renditions first. A maxVariants of 0 disables the limit.
+func NewManagerWithLimit(cacheDir string, maxVariants int) (CacheManager, error) {
+	return NewManagerWithOptions(cacheDir, Options{MaxVariantsPerFile: maxVariants})
+}
+
+// NewManagerWithOptions creates a cache manager with the given options
+func NewManagerWithOptions(cacheDir string, opts Options) (CacheManager, error) {
+	if opts.MaxTotalVariants < 0 {
+		return nil, fmt.Errorf("max total variants must not be negative, got %d", opts.MaxTotalVariants)
+	}
+	if opts.MaxSourceVersions < 0 {
+		return nil, fmt.Errorf("max source versions must not be negative, got %d", opts.MaxSourceVersions)
+	}
+	if opts.FrequencyWeight < 0 {
+		return nil, fmt.Errorf("frequency weight must not be negative, got %v", opts.FrequencyWeight)
+	}
+	if opts.MaxOpenFiles < 0 {
+		return nil, fmt.Errorf("max open files must not be negative, got %d", opts.MaxOpenFiles)
+	}
+	if opts.ShardLevels < 0 || opts.ShardLevels > maxShardLevels {
+		return nil, fmt.Errorf("shard levels must be between 0 and %d, got %d", maxShardLevels, opts.ShardLevels)
+	}
+
 	// Ensure cache directory exists
 	if err := os.MkdirAll(cacheDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create cache directory: %w", err)
 	}
 
+	compressFormats := opts.CompressFormats
+	if len(compressFormats) == 0 {
+		compressFormats = []string{"png"}
+	}
+	formats := make(map[string]bool, len(compressFormats))
+	for _, format := range compressFormats {
+		formats[format] = true
+	}
+
 	return &manager{
-		cacheDir: cacheDir,
+		cacheDir:        cacheDir,
+		maxVariants:     opts.MaxVariantsPerFile,
+		maxTotal:        opts.MaxTotalVariants,
+		shardLevels:     opts.ShardLevels,
+		maxVersions:     opts.MaxSourceVersions,
+		totalVariants:   -1,
+		compressAfter:   opts.CompressAfter,
+		compressFormats: formats,
+		access:          newAccessCounts(cacheDir),
+		frequencyWeight: opts.FrequencyWeight,
+		files:           osFileOps,
+		openFiles:       newFileLimiter(opts.MaxOpenFiles),
+		writes:          newWriteHealth(opts.WriteRetryInterval),
+		pending:         newWriteCoordinator(),
 	}, nil
 }
 
@@ -34,11 +157,51 @@ func (m *manager) GenerateKey(resolvedPath string, params ProcessingParams) stri
 
 // Store saves processed image data to cache with atomic operations
 func (m *manager) Store(resolvedPath string, params ProcessingParams, data []byte) error {
+	if !m.writes.allow() {
+		return ErrReadOnly
+	}
+
+	// Concurrent stores of the same rendition write it once. If the write
+	// they waited for failed, they try their own.
+	cachePath := m.GetPath(resolvedPath, params)
+	write, owner := m.pending.begin(cachePath, data)
+	if !owner && m.pending.reuse(cachePath, write, data) {
+		return nil
+	}
+	err := m.store(resolvedPath, params, data)
+	if owner {
+		m.pending.finish(cachePath, write, err)
+	}
+	m.writes.record(m.cacheDir, err)
+	return err
+}
+
+// store writes one rendition, evicting others to stay within the limits
+func (m *manager) store(resolvedPath string, params ProcessingParams, data []byte) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	cachePath := m.GetPath(resolvedPath, params)
 
+	// Make room for the new rendition within the per-file limit
+	if m.maxVariants > 0 {
+		if err := m.evictVariants(resolvedPath, cachePath); err != nil {
+			return err
+		}
+	}
+
+	// Admit a new rendition only once the whole cache has room for it
+	newVariant := false
+	if m.maxTotal > 0 {
+		_, stored := storedEntry(cachePath)
+		newVariant = !stored
+		if newVariant {
+			if err := m.evictGlobal(); err != nil {
+				return err
+			}
+		}
+	}
+
 	// Create directory structure
 	dir := filepath.Dir(cachePath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -47,7 +210,7 @@ func (m *manager) Store(resolvedPath string, params ProcessingParams, data []byt
 
 	// Write atomically using temporary file
 	tempFile := cachePath + ".tmp"
-	if err := os.WriteFile(tempFile, data, 0644); err != nil {
+	if err := m.writeFile(tempFile, data); err != nil {
 		return fmt.Errorf("failed to write cache file: %w", err)
 	}
 
@@ -57,6 +220,13 @@ func (m *manager) Store(resolvedPath string, params ProcessingParams, data []byt
 		return fmt.Errorf("failed to rename cache file: %w", err)
 	}
 
+	// A compressed copy of the previous rendition is now stale
+	os.Remove(cachePath + compressedSuffix)
+
+	if newVariant && m.totalVariants >= 0 {
+		m.totalVariants++
+	}
+
 	return nil
 }
 
@@ -65,30 +235,78 @@ func (m *manager) Retrieve(resolvedPath string, params ProcessingParams) ([]byte
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	cachePath := m.GetPath(resolvedPath, params)
-
-	// Check if file exists
-	if _, err := os.Stat(cachePath); os.IsNotExist(err) {
+	storedPath, ok := m.locate(resolvedPath, params)
+	if !ok {
 		return nil, false, nil
 	}
 
-	// Read the file
-	data, err := os.ReadFile(cachePath)
+	// Read the file, decompressing entries compressed while cold
+	data, err := m.readFile(storedPath)
 	if err != nil {
 		return nil, false, fmt.Errorf("failed to read cache file: %w", err)
 	}
+	if strings.HasSuffix(storedPath, compressedSuffix) {
+		if data, err = decompress(data); err != nil {
+			return nil, false, fmt.Errorf("failed to decompress cache file: %w", err)
+		}
+	}
+
+	// The modification time doubles as the last use for LRU eviction
+	// and cold entry compression
+	if m.maxVariants > 0 || m.maxTotal > 0 || m.compressAfter > 0 {
+		now := time.Now()
+		os.Chtimes(storedPath, now, now)
+	}
+	m.access.hit(m.accessKey(storedPath))
 
 	return data, true, nil
 }
 
+// Touch marks a cached rendition as just used without reading it, so LRU
+// eviction and cold compression pass it over, and counts the use. It
+// reports whether the rendition exists.
+func (m *manager) Touch(resolvedPath string, params ProcessingParams) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	storedPath, ok := m.locate(resolvedPath, params)
+	if !ok {
+		return false
+	}
+	m.access.hit(m.accessKey(storedPath))
+	now := time.Now()
+	return os.Chtimes(storedPath, now, now) == nil
+}
+
+// locate returns the file holding a rendition, moving entries from the flat
+// layout on first use. The caller must hold the lock.
+func (m *manager) locate(resolvedPath string, params ProcessingParams) (string, bool) {
+	cachePath := m.GetPath(resolvedPath, params)
+	if storedPath, ok := storedEntry(cachePath); ok {
+		return storedPath, true
+	}
+	if !m.migrateFlat(resolvedPath, params, cachePath) {
+		return "", false
+	}
+	return storedEntry(cachePath)
+}
+
 // Exists checks if a cached file exists
 func (m *manager) Exists(resolvedPath string, params ProcessingParams) bool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	cachePath := m.GetPath(resolvedPath, params)
-	_, err := os.Stat(cachePath)
-	return err == nil
+	if _, ok := storedEntry(cachePath); ok {
+		return true
+	}
+
+	// Entries from before sharding was enabled still count until migrated
+	if flatPath, ok := m.flatPath(resolvedPath, params); ok {
+		_, ok := storedEntry(flatPath)
+		return ok
+	}
+	return false
 }
 
 // Clear removes cached files for a specific resolved path
@@ -96,43 +314,133 @@ func (m *manager) Clear(resolvedPath string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Get the directory for this resolved path
-	// Cache structure: {cache_dir}/{filename}/{hash}
-	// So we need to remove the entire {cache_dir}/{filename} directory
-	pathDir := filepath.Join(m.cacheDir, resolvedPath)
+	// Get the directories for this resolved path
+	// Cache structure: {cache_dir}/{shard}/{filename}/{WxH_quality}/{hash}
+	// So we need to remove the entire {cache_dir}/{shard}/{filename} directory,
+	// and the flat {cache_dir}/{filename} left from before sharding
+	for _, pathDir := range m.sourceDirs(resolvedPath) {
+		// Check if directory exists
+		if _, err := os.Stat(pathDir); os.IsNotExist(err) {
+			// Not an error if directory doesn't exist
+			continue
+		}
 
-	// Check if directory exists
-	if _, err := os.Stat(pathDir); os.IsNotExist(err) {
-		// Not an error if directory doesn't exist
-		return nil
+		// Remove the directory and all its contents
+		if err := os.RemoveAll(pathDir); err != nil {
+			return fmt.Errorf("failed to clear cache for %s: %w", resolvedPath, err)
+		}
+		m.totalVariants = -1 // Recounted on the next admission
 	}
 
-	// Remove the directory and all its contents
-	if err := os.RemoveAll(pathDir); err != nil {
-		return fmt.Errorf("failed to clear cache for %s: %w", resolvedPath, err)
+	return nil
+}
+
+// ClearVariants removes every format variant cached for the size and quality in params
+func (m *manager) ClearVariants(resolvedPath string, params ProcessingParams) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := 0
+	for _, sourceDir := range m.sourceDirs(resolvedPath) {
+		groupDir := filepath.Join(sourceDir, variantGroup(params))
+		entries, err := os.ReadDir(groupDir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read cache variants: %w", err)
+		}
+
+		for _, entry := range entries {
+			if !strings.HasSuffix(entry.Name(), ".tmp") {
+				removed++
+			}
+		}
+
+		if err := os.RemoveAll(groupDir); err != nil {
+			return 0, fmt.Errorf("failed to clear cache variants for %s: %w", resolvedPath, err)
+		}
 	}
+	m.forgetVariants(removed)
 
-	return nil
+	return removed, nil
+}
+
+// Variants returns the formats cached for the size and quality in params
+func (m *manager) Variants(resolvedPath string, params ProcessingParams) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var formats []string
+	for _, sourceDir := range m.sourceDirs(resolvedPath) {
+		entries, err := os.ReadDir(filepath.Join(sourceDir, variantGroup(params)))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cache variants: %w", err)
+		}
+
+		for _, entry := range entries {
+			name := strings.TrimSuffix(entry.Name(), compressedSuffix)
+			format := strings.TrimPrefix(filepath.Ext(name), ".")
+			if format == "" || format == "tmp" || seen[format] {
+				continue
+			}
+			seen[format] = true
+			formats = append(formats, format)
+		}
+	}
+	sort.Strings(formats)
+
+	return formats, nil
 }
 
 // ClearAll removes all cached files
 func (m *manager) ClearAll() error {
+	return m.ClearAllContext(context.Background())
+}
+
+// ClearAllContext is ClearAll that stops removing files once ctx ends,
+// returning the context's error. Files not reached yet stay cached.
+func (m *manager) ClearAllContext(ctx context.Context) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	// Remove all contents of cache directory
-	entries, err := os.ReadDir(m.cacheDir)
+	if err := removeContents(ctx, m.cacheDir); err != nil {
+		m.totalVariants = -1 // Recounted on the next admission
+		return err
+	}
+	m.totalVariants = 0
+	m.access.reset()
+
+	return nil
+}
+
+// removeContents removes everything below dir, depth first so that a
+// cancelled removal stops within one directory rather than after a whole
+// shard
+func removeContents(ctx context.Context, dir string) error {
+	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return fmt.Errorf("failed to read cache directory: %w", err)
 	}
-
 	for _, entry := range entries {
-		path := filepath.Join(m.cacheDir, entry.Name())
-		if err := os.RemoveAll(path); err != nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() {
+			if err := removeContents(ctx, path); err != nil {
+				return err
+			}
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
 			return fmt.Errorf("failed to remove %s: %w", path, err)
 		}
 	}
-
 	return nil
 }
 
@@ -140,56 +448,289 @@ func (m *manager) ClearAll() error {
 func (m *manager) GetPath(resolvedPath string, params ProcessingParams) string {
 	hash := m.GenerateKey(resolvedPath, params)
 
-	// Cache structure: {cache_dir}/{filename}/{hash}
-	// Clean the resolved path to remove any leading slashes
-	cleanPath := strings.TrimPrefix(resolvedPath, "/")
+	// Cache structure: {cache_dir}/{shard}/{filename}/{WxH_quality}/{hash}.{format}
+	if params.Format != "" {
+		hash += "." + params.Format
+	}
+	return filepath.Join(m.groupDir(resolvedPath, params), hash)
+}
 
-	return filepath.Join(m.cacheDir, cleanPath, hash)
+// groupDir returns the directory holding all format variants of a rendition
+func (m *manager) groupDir(resolvedPath string, params ProcessingParams) string {
+	return filepath.Join(m.sourceDir(resolvedPath), variantGroup(params))
 }
 
-// GetStats returns cache statistics
-func (m *manager) GetStats() (*Stats, error) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+// sourceDir returns the directory holding every rendition of a source file
+func (m *manager) sourceDir(resolvedPath string) string {
+	// Clean the resolved path to remove any leading slashes. Namespaced
+	// paths are sharded within their namespace directory.
+	namespace, cleanPath := splitNamespace(strings.TrimPrefix(resolvedPath, "/"))
 
-	stats := &Stats{
-		LastClearTime: time.Time{},
+	return filepath.Join(m.cacheDir, namespace, shardPrefix(cleanPath, m.shardLevels), cleanPath)
+}
+
+// sourceDirs returns the source directory and, when sharding is enabled,
+// the flat directory used before it was
+func (m *manager) sourceDirs(resolvedPath string) []string {
+	dirs := []string{m.sourceDir(resolvedPath)}
+	if m.shardLevels > 0 {
+		dirs = append(dirs, filepath.Join(m.cacheDir, strings.TrimPrefix(resolvedPath, "/")))
 	}
+	return dirs
+}
+
+// flatPath returns the unsharded cache path for params when sharding is enabled
+func (m *manager) flatPath(resolvedPath string, params ProcessingParams) (string, bool) {
+	if m.shardLevels == 0 {
+		return "", false
+	}
+	flat := &manager{cacheDir: m.cacheDir}
+	return flat.GetPath(resolvedPath, params), true
+}
 
-	// Walk the cache directory to gather statistics
-	err := filepath.WalkDir(m.cacheDir, func(path string, d os.DirEntry, err error) error {
+// migrateFlat moves an entry cached before sharding was enabled to its
+// sharded path, reporting whether one was moved. Each entry is migrated on
+// its first retrieval, so enabling sharding does not require a rebuild.
+func (m *manager) migrateFlat(resolvedPath string, params ProcessingParams, cachePath string) bool {
+	flatPath, ok := m.flatPath(resolvedPath, params)
+	if !ok {
+		return false
+	}
+	source, ok := storedEntry(flatPath)
+	if !ok {
+		return false
+	}
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return false
+	}
+	// Compressed entries keep their suffix
+	target := cachePath + strings.TrimPrefix(source, flatPath)
+	if err := os.Rename(source, target); err != nil {
+		// A concurrent retrieval may have migrated it first
+		_, ok := storedEntry(cachePath)
+		return ok
+	}
+	os.Remove(filepath.Dir(flatPath)) // Drop the variant group once empty
+	return true
+}
+
+// sourceVariants returns every rendition cached for a source file. Only
+// variant group directories are read, so renditions of files nested below
+// the source path are not counted.
+func (m *manager) sourceVariants(resolvedPath string) ([]cachedVariant, error) {
+	var variants []cachedVariant
+	for _, sourceDir := range m.sourceDirs(resolvedPath) {
+		found, err := readVariants(sourceDir)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		variants = append(variants, found...)
+	}
+	return variants, nil
+}
 
-		// Skip directories
-		if d.IsDir() {
+// readVariants returns the renditions in the variant groups of sourceDir
+func readVariants(sourceDir string) ([]cachedVariant, error) {
+	groups, err := os.ReadDir(sourceDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	var variants []cachedVariant
+	for _, group := range groups {
+		if !group.IsDir() || !variantGroupPattern.MatchString(group.Name()) {
+			continue
+		}
+		groupDir := filepath.Join(sourceDir, group.Name())
+		entries, err := os.ReadDir(groupDir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasSuffix(entry.Name(), ".tmp") {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			variants = append(variants, cachedVariant{
+				path:   filepath.Join(groupDir, entry.Name()),
+				usedAt: info.ModTime(),
+			})
+		}
+	}
+
+	return variants, nil
+}
+
+// evictVariants removes the renditions of a source file first in eviction
+// order, see sortForEviction, so that storing cachePath keeps it within maxVariants. The caller must
+// hold the write lock.
+func (m *manager) evictVariants(resolvedPath, cachePath string) error {
+	variants, err := m.sourceVariants(resolvedPath)
+	if err != nil {
+		return err
+	}
+
+	// Overwriting an existing rendition does not add a variant
+	for _, variant := range variants {
+		if strings.TrimSuffix(variant.path, compressedSuffix) == cachePath {
 			return nil
 		}
+	}
+	if len(variants) < m.maxVariants {
+		return nil
+	}
 
-		// Get file info
-		info, err := d.Info()
-		if err != nil {
-			return nil // Skip files we can't stat
+	m.sortForEviction(variants)
+	evicted := variants[:len(variants)-m.maxVariants+1]
+	if err := m.evict(evicted); err != nil {
+		m.totalVariants = -1
+		return err
+	}
+	m.forgetVariants(len(evicted))
+
+	return nil
+}
+
+// evictGlobal removes the renditions across the cache first in eviction
+// order so that one more fits within maxTotal. Like the janitor it takes the
+// modification time, which Retrieve keeps, as the last use. The caller
+// must hold the write lock.
+func (m *manager) evictGlobal() error {
+	if m.totalVariants >= 0 && m.totalVariants < m.maxTotal {
+		return nil
+	}
+
+	variants, err := m.allVariants()
+	if err != nil {
+		return err
+	}
+	m.totalVariants = len(variants)
+	if len(variants) < m.maxTotal {
+		return nil
+	}
+
+	m.sortForEviction(variants)
+	evicted := variants[:len(variants)-m.maxTotal+1]
+	if err := m.evict(evicted); err != nil {
+		m.totalVariants = -1
+		return err
+	}
+	m.totalVariants -= len(evicted)
+	m.globalEvictions++
+
+	return nil
+}
+
+// allVariants returns every rendition in the cache
+func (m *manager) allVariants() ([]cachedVariant, error) {
+	entries, err := m.entries(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	variants := make([]cachedVariant, len(entries))
+	for i, entry := range entries {
+		variants[i] = cachedVariant{path: entry.Path, usedAt: entry.ModTime}
+	}
+	return variants, nil
+}
+
+// evict removes renditions and their access counts, dropping each variant
+// group once its last rendition is gone
+func (m *manager) evict(variants []cachedVariant) error {
+	for _, variant := range variants {
+		if err := os.Remove(variant.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to evict cache file: %w", err)
 		}
+		os.Remove(filepath.Dir(variant.path))
+		m.access.forget(m.accessKey(variant.path))
+	}
+	return nil
+}
+
+// forgetVariants lowers the rendition count after n were removed
+func (m *manager) forgetVariants(n int) {
+	if m.totalVariants >= n {
+		m.totalVariants -= n
+	} else {
+		m.totalVariants = -1
+	}
+}
+
+// unshard strips the shard prefix from a source path relative to the cache
+// directory, keeping its namespace directory. Paths from the flat layout are
+// returned unchanged.
+func (m *manager) unshard(source string) string {
+	if m.shardLevels == 0 {
+		return source
+	}
+	if namespace, rest := splitNamespace(source); namespace != "" {
+		return namespace + "/" + m.unshard(rest)
+	}
+	parts := strings.SplitN(source, "/", m.shardLevels+1)
+	if len(parts) <= m.shardLevels {
+		return source
+	}
+	rest := parts[m.shardLevels]
+	if filepath.ToSlash(shardPrefix(rest, m.shardLevels)) != strings.Join(parts[:m.shardLevels], "/") {
+		return source
+	}
+	return rest
+}
 
+// GetStats returns cache statistics
+func (m *manager) GetStats() (*Stats, error) {
+	return m.GetStatsContext(context.Background())
+}
+
+// GetStatsContext is GetStats that stops scanning the cache once ctx ends,
+// returning the context's error
+func (m *manager) GetStatsContext(ctx context.Context) (*Stats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stats := &Stats{
+		LastClearTime:   time.Time{},
+		GlobalEvictions: m.globalEvictions,
+	}
+	stats.CoalescedWrites, stats.WriteConflicts = m.pending.counts()
+	variantCounts := make(map[string]int)
+
+	entries, err := m.entries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to gather cache stats: %w", err)
+	}
+	for _, entry := range entries {
 		stats.TotalFiles++
-		stats.TotalSize += info.Size()
+		stats.TotalSize += entry.Size
+		variantCounts[entry.Source]++
 
 		// Track oldest and newest files
-		modTime := info.ModTime()
-		if stats.OldestFileTime.IsZero() || modTime.Before(stats.OldestFileTime) {
-			stats.OldestFileTime = modTime
+		if stats.OldestFileTime.IsZero() || entry.ModTime.Before(stats.OldestFileTime) {
+			stats.OldestFileTime = entry.ModTime
 		}
-		if stats.NewestFileTime.IsZero() || modTime.After(stats.NewestFileTime) {
-			stats.NewestFileTime = modTime
+		if stats.NewestFileTime.IsZero() || entry.ModTime.After(stats.NewestFileTime) {
+			stats.NewestFileTime = entry.ModTime
 		}
+	}
 
-		return nil
+	for source, count := range variantCounts {
+		stats.TopVariantFiles = append(stats.TopVariantFiles, VariantCount{Path: source, Variants: count})
+	}
+	sort.Slice(stats.TopVariantFiles, func(i, j int) bool {
+		a, b := stats.TopVariantFiles[i], stats.TopVariantFiles[j]
+		if a.Variants != b.Variants {
+			return a.Variants > b.Variants
+		}
+		return a.Path < b.Path
 	})
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to gather cache stats: %w", err)
+	if len(stats.TopVariantFiles) > topVariantFiles {
+		stats.TopVariantFiles = stats.TopVariantFiles[:topVariantFiles]
 	}
 
 	return stats, nil
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -444,6 +446,474 @@ func TestCacheManager_Clear_NonExistentFile(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+// TestCacheManager_ClearVariants_AllFormats tests clearing every format of one size
+func TestCacheManager_ClearVariants_AllFormats(t *testing.T) {
+	// Arrange
+	tempDir := t.TempDir()
+	manager, err := NewManager(tempDir)
+	require.NoError(t, err)
+
+	testData := []byte("test data")
+	for _, format := range []string{"webp", "jpeg", "png"} {
+		params := ProcessingParams{Width: 800, Height: 600, Format: format, Quality: 90}
+		require.NoError(t, manager.Store("photo.jpg", params, testData))
+	}
+	other := ProcessingParams{Width: 400, Height: 300, Format: "webp", Quality: 90}
+	require.NoError(t, manager.Store("photo.jpg", other, testData))
+
+	// Act
+	removed, err := manager.ClearVariants("photo.jpg", ProcessingParams{Width: 800, Height: 600, Quality: 90})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 3, removed)
+	for _, format := range []string{"webp", "jpeg", "png"} {
+		params := ProcessingParams{Width: 800, Height: 600, Format: format, Quality: 90}
+		assert.False(t, manager.Exists("photo.jpg", params), format)
+	}
+	assert.True(t, manager.Exists("photo.jpg", other))
+}
+
+// TestCacheManager_ClearVariants_NonExistent tests clearing a size that was never cached
+func TestCacheManager_ClearVariants_NonExistent(t *testing.T) {
+	// Arrange
+	tempDir := t.TempDir()
+	manager, err := NewManager(tempDir)
+	require.NoError(t, err)
+
+	// Act
+	removed, err := manager.ClearVariants("photo.jpg", ProcessingParams{Width: 800, Height: 600, Quality: 90})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 0, removed)
+}
+
+// TestCacheManager_Variants_ListsFormats tests listing the formats cached for one size
+func TestCacheManager_Variants_ListsFormats(t *testing.T) {
+	// Arrange
+	tempDir := t.TempDir()
+	manager, err := NewManager(tempDir)
+	require.NoError(t, err)
+
+	testData := []byte("test data")
+	for _, format := range []string{"webp", "png"} {
+		params := ProcessingParams{Width: 800, Height: 600, Format: format, Quality: 90}
+		require.NoError(t, manager.Store("photo.jpg", params, testData))
+	}
+	require.NoError(t, manager.Store("photo.jpg", ProcessingParams{Width: 800, Height: 600, Format: "jpeg", Quality: 75}, testData))
+
+	// Act
+	formats, err := manager.Variants("photo.jpg", ProcessingParams{Width: 800, Height: 600, Quality: 90})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"png", "webp"}, formats)
+}
+
+// TestCacheManager_MaxVariants_EvictsLeastRecentlyUsed tests the per-file variant cap
+func TestCacheManager_MaxVariants_EvictsLeastRecentlyUsed(t *testing.T) {
+	// Arrange
+	tempDir := t.TempDir()
+	manager, err := NewManagerWithLimit(tempDir, 3)
+	require.NoError(t, err)
+
+	testData := []byte("test data")
+	other := ProcessingParams{Width: 100, Height: 100, Format: "webp", Quality: 90}
+	require.NoError(t, manager.Store("other.jpg", other, testData))
+
+	// Store three variants with increasing last-use times
+	base := time.Now().Add(-time.Hour)
+	sizes := []int{100, 200, 300}
+	for i, width := range sizes {
+		params := ProcessingParams{Width: width, Height: width, Format: "webp", Quality: 90}
+		require.NoError(t, manager.Store("photo.jpg", params, testData))
+		usedAt := base.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, os.Chtimes(manager.GetPath("photo.jpg", params), usedAt, usedAt))
+	}
+
+	// Reading the oldest variant makes it the most recently used
+	_, found, err := manager.Retrieve("photo.jpg", ProcessingParams{Width: 100, Height: 100, Format: "webp", Quality: 90})
+	require.NoError(t, err)
+	require.True(t, found)
+
+	// Act
+	err = manager.Store("photo.jpg", ProcessingParams{Width: 400, Height: 400, Format: "webp", Quality: 90}, testData)
+
+	// Assert
+	assert.NoError(t, err)
+	for width, expected := range map[int]bool{100: true, 200: false, 300: true, 400: true} {
+		params := ProcessingParams{Width: width, Height: width, Format: "webp", Quality: 90}
+		assert.Equal(t, expected, manager.Exists("photo.jpg", params), "width %d", width)
+	}
+	assert.NoDirExists(t, filepath.Join(tempDir, "photo.jpg", "200x200_q90"))
+	assert.True(t, manager.Exists("other.jpg", other), "other files keep their variants")
+}
+
+// TestCacheManager_MaxVariants_ManyVariants tests the cap holds while storing many variants
+func TestCacheManager_MaxVariants_ManyVariants(t *testing.T) {
+	// Arrange
+	tempDir := t.TempDir()
+	manager, err := NewManagerWithLimit(tempDir, 5)
+	require.NoError(t, err)
+
+	testData := []byte("test data")
+
+	// Act
+	for width := 1; width <= 50; width++ {
+		for _, format := range []string{"webp", "png"} {
+			params := ProcessingParams{Width: width, Height: width, Format: format, Quality: 90}
+			require.NoError(t, manager.Store("photo.jpg", params, testData))
+		}
+	}
+	// Overwriting a cached variant does not evict another one
+	last := ProcessingParams{Width: 50, Height: 50, Format: "png", Quality: 90}
+	require.NoError(t, manager.Store("photo.jpg", last, testData))
+
+	// Assert
+	stats, err := manager.GetStats()
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), stats.TotalFiles)
+	require.Len(t, stats.TopVariantFiles, 1)
+	assert.Equal(t, VariantCount{Path: "photo.jpg", Variants: 5}, stats.TopVariantFiles[0])
+	assert.True(t, manager.Exists("photo.jpg", last))
+	assert.True(t, manager.Exists("photo.jpg", ProcessingParams{Width: 50, Height: 50, Format: "webp", Quality: 90}))
+}
+
+// TestCacheManager_MaxTotalVariants_StabilizesAtCap tests the global cap holds
+// while storing renditions of many source files
+func TestCacheManager_MaxTotalVariants_StabilizesAtCap(t *testing.T) {
+	// Arrange
+	tempDir := t.TempDir()
+	manager, err := NewManagerWithOptions(tempDir, Options{MaxTotalVariants: 10})
+	require.NoError(t, err)
+
+	testData := []byte("test data")
+
+	// Act
+	for i := 0; i < 40; i++ {
+		source := fmt.Sprintf("photo%d.jpg", i)
+		for _, format := range []string{"webp", "png"} {
+			params := ProcessingParams{Width: 100, Height: 100, Format: format, Quality: 90}
+			require.NoError(t, manager.Store(source, params, testData))
+		}
+	}
+	// Overwriting a cached rendition does not evict another one
+	last := ProcessingParams{Width: 100, Height: 100, Format: "png", Quality: 90}
+	require.NoError(t, manager.Store("photo39.jpg", last, testData))
+
+	// Assert
+	stats, err := manager.GetStats()
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), stats.TotalFiles)
+	assert.Equal(t, int64(70), stats.GlobalEvictions)
+	assert.True(t, manager.Exists("photo39.jpg", last))
+	assert.False(t, manager.Exists("photo0.jpg", last))
+}
+
+// TestCacheManager_MaxTotalVariants_EvictsLeastRecentlyUsed tests global
+// eviction across source files by last use
+func TestCacheManager_MaxTotalVariants_EvictsLeastRecentlyUsed(t *testing.T) {
+	// Arrange
+	tempDir := t.TempDir()
+	manager, err := NewManagerWithOptions(tempDir, Options{MaxTotalVariants: 3})
+	require.NoError(t, err)
+
+	testData := []byte("test data")
+	params := ProcessingParams{Width: 100, Height: 100, Format: "webp", Quality: 90}
+	base := time.Now().Add(-time.Hour)
+	for i, source := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		require.NoError(t, manager.Store(source, params, testData))
+		usedAt := base.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, os.Chtimes(manager.GetPath(source, params), usedAt, usedAt))
+	}
+
+	// Reading the oldest rendition makes it the most recently used
+	_, found, err := manager.Retrieve("a.jpg", params)
+	require.NoError(t, err)
+	require.True(t, found)
+
+	// Act
+	err = manager.Store("d.jpg", params, testData)
+
+	// Assert
+	assert.NoError(t, err)
+	for source, expected := range map[string]bool{"a.jpg": true, "b.jpg": false, "c.jpg": true, "d.jpg": true} {
+		assert.Equal(t, expected, manager.Exists(source, params), source)
+	}
+}
+
+// TestCacheManager_Touch_UpdatesLRUOrder tests touching a rendition protects it from eviction
+func TestCacheManager_Touch_UpdatesLRUOrder(t *testing.T) {
+	// Arrange
+	tempDir := t.TempDir()
+	manager, err := NewManagerWithOptions(tempDir, Options{MaxTotalVariants: 3})
+	require.NoError(t, err)
+
+	testData := []byte("test data")
+	params := ProcessingParams{Width: 100, Height: 100, Format: "webp", Quality: 90}
+	base := time.Now().Add(-time.Hour)
+	for i, source := range []string{"a.jpg", "b.jpg", "c.jpg"} {
+		require.NoError(t, manager.Store(source, params, testData))
+		usedAt := base.Add(time.Duration(i) * time.Minute)
+		require.NoError(t, os.Chtimes(manager.GetPath(source, params), usedAt, usedAt))
+	}
+
+	// Act
+	touched := manager.Touch("a.jpg", params)
+	missing := manager.Touch("missing.jpg", params)
+	require.NoError(t, manager.Store("d.jpg", params, testData))
+
+	// Assert - the touched oldest rendition survives, the next oldest is evicted
+	assert.True(t, touched)
+	assert.False(t, missing)
+	assert.False(t, manager.Exists("missing.jpg", params), "touch must not create entries")
+	for source, expected := range map[string]bool{"a.jpg": true, "b.jpg": false, "c.jpg": true, "d.jpg": true} {
+		assert.Equal(t, expected, manager.Exists(source, params), source)
+	}
+}
+
+// TestCacheManager_Touch_Concurrent tests touching while storing and clearing
+func TestCacheManager_Touch_Concurrent(t *testing.T) {
+	// Arrange
+	manager, err := NewManagerWithLimit(t.TempDir(), 2)
+	require.NoError(t, err)
+	testData := []byte("test data")
+
+	// Act
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		params := ProcessingParams{Width: 100 + i%4, Height: 100, Format: "webp", Quality: 90}
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, manager.Store("photo.jpg", params, testData))
+		}()
+		go func() {
+			defer wg.Done()
+			manager.Touch("photo.jpg", params)
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, manager.Clear("photo.jpg"))
+		}()
+	}
+	wg.Wait()
+
+	// Assert - touching reports what is cached afterwards
+	params := ProcessingParams{Width: 100, Height: 100, Format: "webp", Quality: 90}
+	require.NoError(t, manager.Store("photo.jpg", params, testData))
+	assert.True(t, manager.Touch("photo.jpg", params))
+}
+
+// TestCacheManager_MaxTotalVariants_RecountsAfterClear tests the cap after
+// entries are cleared and after a restart
+func TestCacheManager_MaxTotalVariants_RecountsAfterClear(t *testing.T) {
+	// Arrange
+	tempDir := t.TempDir()
+	manager, err := NewManagerWithOptions(tempDir, Options{MaxTotalVariants: 4})
+	require.NoError(t, err)
+
+	testData := []byte("test data")
+	params := ProcessingParams{Width: 100, Height: 100, Format: "webp", Quality: 90}
+	for i := 0; i < 4; i++ {
+		require.NoError(t, manager.Store(fmt.Sprintf("photo%d.jpg", i), params, testData))
+	}
+	require.NoError(t, manager.Clear("photo0.jpg"))
+	require.NoError(t, manager.Store("photo4.jpg", params, testData))
+
+	// Act
+	restarted, err := NewManagerWithOptions(tempDir, Options{MaxTotalVariants: 4})
+	require.NoError(t, err)
+	require.NoError(t, restarted.Store("photo5.jpg", params, testData))
+
+	// Assert
+	stats, err := restarted.GetStats()
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), stats.TotalFiles)
+	assert.Equal(t, int64(1), stats.GlobalEvictions)
+	first, err := manager.GetStats()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), first.GlobalEvictions, "clearing made room without eviction")
+}
+
+// TestCacheManager_MaxTotalVariants_Negative tests the cap is validated
+func TestCacheManager_MaxTotalVariants_Negative(t *testing.T) {
+	// Act
+	_, err := NewManagerWithOptions(t.TempDir(), Options{MaxTotalVariants: -1})
+
+	// Assert
+	assert.Error(t, err)
+}
+
+// TestCacheManager_GetStats_TopVariantFiles tests per-file variant counts
+func TestCacheManager_GetStats_TopVariantFiles(t *testing.T) {
+	// Arrange
+	tempDir := t.TempDir()
+	manager, err := NewManager(tempDir)
+	require.NoError(t, err)
+
+	testData := []byte("test data")
+	counts := map[string]int{"photo.jpg": 3, "cats/cat.jpg": 2, "dog.png": 1}
+	for source, count := range counts {
+		for width := 1; width <= count; width++ {
+			params := ProcessingParams{Width: width * 100, Height: 0, Format: "webp", Quality: 90}
+			require.NoError(t, manager.Store(source, params, testData))
+		}
+	}
+
+	// Act
+	stats, err := manager.GetStats()
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, []VariantCount{
+		{Path: "photo.jpg", Variants: 3},
+		{Path: "cats/cat.jpg", Variants: 2},
+		{Path: "dog.png", Variants: 1},
+	}, stats.TopVariantFiles)
+}
+
+// TestCacheManager_Sharded_StoreRetrieve tests the round trip under the sharded layout
+func TestCacheManager_Sharded_StoreRetrieve(t *testing.T) {
+	// Arrange
+	tempDir := t.TempDir()
+	manager, err := NewManagerWithOptions(tempDir, Options{ShardLevels: 2})
+	require.NoError(t, err)
+
+	params := ProcessingParams{Width: 800, Height: 600, Format: "webp", Quality: 90}
+	testData := []byte("test data")
+
+	for _, source := range []string{"photo.jpg", "cats/cat_white.jpg"} {
+		// Act
+		err := manager.Store(source, params, testData)
+		require.NoError(t, err)
+		data, found, err := manager.Retrieve(source, params)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, testData, data)
+		assert.True(t, manager.Exists(source, params))
+
+		rel, err := filepath.Rel(tempDir, manager.GetPath(source, params))
+		require.NoError(t, err)
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		assert.Regexp(t, `^[0-9a-f]{2}$`, parts[0])
+		assert.Regexp(t, `^[0-9a-f]{2}$`, parts[1])
+		assert.Equal(t, source+"/800x600_q90", strings.Join(parts[2:len(parts)-1], "/"))
+	}
+
+	formats, err := manager.Variants("photo.jpg", params)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"webp"}, formats)
+}
+
+// TestCacheManager_Sharded_Clear tests clearing under the sharded layout
+func TestCacheManager_Sharded_Clear(t *testing.T) {
+	// Arrange
+	tempDir := t.TempDir()
+	manager, err := NewManagerWithOptions(tempDir, Options{ShardLevels: 1})
+	require.NoError(t, err)
+
+	testData := []byte("test data")
+	sized := ProcessingParams{Width: 400, Height: 300, Format: "png", Quality: 90}
+	for _, format := range []string{"webp", "jpeg"} {
+		params := ProcessingParams{Width: 800, Height: 600, Format: format, Quality: 90}
+		require.NoError(t, manager.Store("photo.jpg", params, testData))
+		require.NoError(t, manager.Store("other.jpg", params, testData))
+	}
+	require.NoError(t, manager.Store("photo.jpg", sized, testData))
+
+	// Act
+	removed, err := manager.ClearVariants("photo.jpg", ProcessingParams{Width: 800, Height: 600, Quality: 90})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	assert.True(t, manager.Exists("photo.jpg", sized))
+
+	// Act
+	err = manager.Clear("photo.jpg")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.False(t, manager.Exists("photo.jpg", sized))
+	assert.NoDirExists(t, filepath.Dir(filepath.Dir(manager.GetPath("photo.jpg", sized))))
+	assert.True(t, manager.Exists("other.jpg", ProcessingParams{Width: 800, Height: 600, Format: "webp", Quality: 90}))
+}
+
+// TestCacheManager_Sharded_GetStats tests statistics report unsharded source paths
+func TestCacheManager_Sharded_GetStats(t *testing.T) {
+	// Arrange
+	tempDir := t.TempDir()
+	manager, err := NewManagerWithOptions(tempDir, Options{ShardLevels: 2})
+	require.NoError(t, err)
+
+	testData := []byte("test data")
+	for _, width := range []int{100, 200} {
+		params := ProcessingParams{Width: width, Height: width, Format: "webp", Quality: 90}
+		require.NoError(t, manager.Store("cats/cat_white.jpg", params, testData))
+	}
+	require.NoError(t, manager.Store("photo.jpg", ProcessingParams{Width: 100, Height: 100, Format: "webp", Quality: 90}, testData))
+
+	// Act
+	stats, err := manager.GetStats()
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), stats.TotalFiles)
+	assert.Equal(t, []VariantCount{
+		{Path: "cats/cat_white.jpg", Variants: 2},
+		{Path: "photo.jpg", Variants: 1},
+	}, stats.TopVariantFiles)
+}
+
+// TestCacheManager_Sharded_MigratesFlatEntries tests lazy migration of a flat cache
+func TestCacheManager_Sharded_MigratesFlatEntries(t *testing.T) {
+	// Arrange
+	tempDir := t.TempDir()
+	flat, err := NewManager(tempDir)
+	require.NoError(t, err)
+
+	params := ProcessingParams{Width: 800, Height: 600, Format: "webp", Quality: 90}
+	other := ProcessingParams{Width: 400, Height: 300, Format: "webp", Quality: 90}
+	testData := []byte("test data")
+	require.NoError(t, flat.Store("photo.jpg", params, testData))
+	require.NoError(t, flat.Store("photo.jpg", other, testData))
+	flatPath := flat.GetPath("photo.jpg", params)
+
+	sharded, err := NewManagerWithOptions(tempDir, Options{ShardLevels: 1})
+	require.NoError(t, err)
+
+	// Act
+	exists := sharded.Exists("photo.jpg", params)
+	data, found, err := sharded.Retrieve("photo.jpg", params)
+
+	// Assert - the entry moved to its sharded path on first retrieval
+	assert.True(t, exists)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, testData, data)
+	assert.NoFileExists(t, flatPath)
+	assert.FileExists(t, sharded.GetPath("photo.jpg", params))
+
+	// Clear also removes entries that were never migrated
+	require.NoError(t, sharded.Clear("photo.jpg"))
+	assert.False(t, sharded.Exists("photo.jpg", other))
+	assert.NoDirExists(t, filepath.Join(tempDir, "photo.jpg"))
+}
+
+// TestCacheManager_NewManagerWithOptions_InvalidShardLevels tests shard level validation
+func TestCacheManager_NewManagerWithOptions_InvalidShardLevels(t *testing.T) {
+	// Act
+	manager, err := NewManagerWithOptions(t.TempDir(), Options{ShardLevels: 3})
+
+	// Assert
+	assert.Error(t, err)
+	assert.Nil(t, manager)
+}
+
 // TestCacheManager_GetPath_ValidStructure tests cache path generation
 func TestCacheManager_GetPath_ValidStructure(t *testing.T) {
 	// Arrange
@@ -459,8 +929,10 @@ func TestCacheManager_GetPath_ValidStructure(t *testing.T) {
 	// Assert
 	assert.Contains(t, path, tempDir)
 	assert.Contains(t, path, "photo.jpg")
-	// Path should follow structure: {cache_dir}/{filename}/{hash}
+	// Path should follow structure: {cache_dir}/{filename}/{WxH_quality}/{hash}.{format}
 	assert.True(t, filepath.IsAbs(path))
+	assert.Equal(t, "800x600_q90", filepath.Base(filepath.Dir(path)))
+	assert.Equal(t, ".webp", filepath.Ext(path))
 }
 
 // TestCacheManager_GetStats_FileCount tests cache statistics
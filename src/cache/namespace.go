@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// namespacePrefix marks the top-level directory holding one namespace's
+// renditions, e.g. {cache_dir}/@acme/{shard}/{filename}/...
+const namespacePrefix = "@"
+
+// namespacePattern matches valid namespace names
+var namespacePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ValidNamespace reports whether name may be used as a cache namespace:
+// 1 to 64 letters, digits, dashes or underscores
+func ValidNamespace(name string) bool {
+	return namespacePattern.MatchString(name)
+}
+
+// NamespacedPath returns the path to cache a resolved path under in a
+// namespace. Keys and directories of namespaced renditions never collide
+// with those of another namespace or of the shared cache, and ClearNamespace
+// removes them together. An empty namespace returns resolvedPath unchanged.
+func NamespacedPath(namespace, resolvedPath string) string {
+	if namespace == "" {
+		return resolvedPath
+	}
+	return namespacePrefix + namespace + "/" + strings.TrimPrefix(resolvedPath, "/")
+}
+
+// splitNamespace splits a clean cache path into its namespace directory,
+// empty for the shared cache, and the path within it
+func splitNamespace(cleanPath string) (string, string) {
+	if !strings.HasPrefix(cleanPath, namespacePrefix) {
+		return "", cleanPath
+	}
+	namespace, rest, ok := strings.Cut(cleanPath, "/")
+	if !ok || !ValidNamespace(strings.TrimPrefix(namespace, namespacePrefix)) {
+		return "", cleanPath
+	}
+	return namespace, rest
+}
+
+// NamespaceOf returns the namespace of a CacheEntry Source, empty for
+// renditions in the shared cache
+func NamespaceOf(source string) string {
+	namespace, _ := splitNamespace(filepath.ToSlash(source))
+	return strings.TrimPrefix(namespace, namespacePrefix)
+}
+
+// ClearNamespace removes every rendition cached in a namespace, leaving
+// other namespaces and the shared cache untouched
+func (m *manager) ClearNamespace(namespace string) error {
+	if !ValidNamespace(namespace) {
+		return fmt.Errorf("invalid cache namespace %q", namespace)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := os.RemoveAll(filepath.Join(m.cacheDir, namespacePrefix+namespace)); err != nil {
+		return fmt.Errorf("failed to clear cache namespace %s: %w", namespace, err)
+	}
+	m.totalVariants = -1 // Recounted on the next admission
+
+	return nil
+}
+
+// ClearAllNamespaces removes the renditions of resolvedPath from the shared
+// cache and from every namespace, e.g. when its source is replaced
+func (m *manager) ClearAllNamespaces(resolvedPath string) error {
+	if err := m.Clear(resolvedPath); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(m.cacheDir)
+	if err != nil {
+		return fmt.Errorf("failed to read cache namespaces: %w", err)
+	}
+	for _, entry := range entries {
+		namespace, ok := strings.CutPrefix(entry.Name(), namespacePrefix)
+		if !ok || !entry.IsDir() || !ValidNamespace(namespace) {
+			continue
+		}
+		if err := m.Clear(NamespacedPath(namespace, resolvedPath)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCacheManager_Namespace_NoCollision tests that the same rendition
+// cached in two namespaces and the shared cache is kept apart
+func TestCacheManager_Namespace_NoCollision(t *testing.T) {
+	for _, shardLevels := range []int{0, 2} {
+		manager, err := NewManagerWithOptions(t.TempDir(), Options{ShardLevels: shardLevels})
+		require.NoError(t, err)
+		params := ProcessingParams{Width: 800, Height: 600, Format: "webp", Quality: 90}
+
+		shared := "/images/photo.jpg"
+		acme := NamespacedPath("acme", shared)
+		globex := NamespacedPath("globex", shared)
+		assert.NotEqual(t, manager.GenerateKey(acme, params), manager.GenerateKey(globex, params))
+		assert.NotEqual(t, manager.GenerateKey(acme, params), manager.GenerateKey(shared, params))
+
+		require.NoError(t, manager.Store(shared, params, []byte("shared")))
+		require.NoError(t, manager.Store(acme, params, []byte("acme")))
+		require.NoError(t, manager.Store(globex, params, []byte("globex")))
+
+		for path, want := range map[string]string{shared: "shared", acme: "acme", globex: "globex"} {
+			data, found, err := manager.Retrieve(path, params)
+			require.NoError(t, err)
+			require.True(t, found, path)
+			assert.Equal(t, want, string(data), "shard levels %d", shardLevels)
+		}
+
+		sources := map[string]bool{}
+		require.NoError(t, manager.Iterate(func(entry CacheEntry) bool {
+			sources[entry.Source] = true
+			return true
+		}))
+		assert.Equal(t, map[string]bool{"images/photo.jpg": true, "@acme/images/photo.jpg": true, "@globex/images/photo.jpg": true}, sources)
+	}
+}
+
+// TestCacheManager_ClearNamespace_OnlyThatNamespace tests that clearing a
+// namespace leaves other namespaces and the shared cache in place
+func TestCacheManager_ClearNamespace_OnlyThatNamespace(t *testing.T) {
+	manager, err := NewManagerWithOptions(t.TempDir(), Options{ShardLevels: 1})
+	require.NoError(t, err)
+	params := ProcessingParams{Width: 100, Height: 100, Format: "png", Quality: 80}
+
+	shared := "/images/photo.jpg"
+	require.NoError(t, manager.Store(shared, params, []byte("shared")))
+	require.NoError(t, manager.Store(NamespacedPath("acme", shared), params, []byte("acme")))
+	require.NoError(t, manager.Store(NamespacedPath("globex", shared), params, []byte("globex")))
+
+	require.NoError(t, manager.ClearNamespace("acme"))
+
+	assert.False(t, manager.Exists(NamespacedPath("acme", shared), params))
+	assert.True(t, manager.Exists(NamespacedPath("globex", shared), params))
+	assert.True(t, manager.Exists(shared, params))
+
+	stats, err := manager.GetStats()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.TotalFiles)
+}
+
+// TestCacheManager_ClearAllNamespaces tests that clearing a path removes
+// its renditions from every namespace and leaves other paths in place
+func TestCacheManager_ClearAllNamespaces(t *testing.T) {
+	manager, err := NewManagerWithOptions(t.TempDir(), Options{ShardLevels: 1})
+	require.NoError(t, err)
+	params := ProcessingParams{Width: 100, Height: 100, Format: "png", Quality: 80}
+
+	photo := "/images/photo.jpg"
+	other := "/images/other.jpg"
+	for _, path := range []string{photo, NamespacedPath("acme", photo), NamespacedPath("globex", photo), NamespacedPath("acme", other)} {
+		require.NoError(t, manager.Store(path, params, []byte(path)))
+	}
+
+	require.NoError(t, manager.ClearAllNamespaces(photo))
+
+	assert.False(t, manager.Exists(photo, params))
+	assert.False(t, manager.Exists(NamespacedPath("acme", photo), params))
+	assert.False(t, manager.Exists(NamespacedPath("globex", photo), params))
+	assert.True(t, manager.Exists(NamespacedPath("acme", other), params))
+}
+
+// TestCacheManager_ClearNamespace_Invalid tests that names which could
+// escape the namespace directory are rejected
+func TestCacheManager_ClearNamespace_Invalid(t *testing.T) {
+	manager, err := NewManager(t.TempDir())
+	require.NoError(t, err)
+
+	for _, name := range []string{"", "..", "a/b", "acme corp"} {
+		assert.Error(t, manager.ClearNamespace(name), name)
+		assert.False(t, ValidNamespace(name), name)
+	}
+	assert.Equal(t, "acme", NamespaceOf("@acme/images/photo.jpg"))
+	assert.Equal(t, "", NamespaceOf("images/photo.jpg"))
+}
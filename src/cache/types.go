@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"context"
 	"time"
 )
 
@@ -15,28 +16,146 @@ type CacheManager interface {
 	// Retrieve fetches cached image data if it exists
 	Retrieve(resolvedPath string, params ProcessingParams) ([]byte, bool, error)
 
+	// Touch marks a cached rendition as just used without reading it,
+	// reporting whether it exists
+	Touch(resolvedPath string, params ProcessingParams) bool
+
 	// Exists checks if a cached file exists
 	Exists(resolvedPath string, params ProcessingParams) bool
 
 	// Clear removes cached files for a specific resolved path
 	Clear(resolvedPath string) error
 
+	// ClearVariants removes every format variant cached for the size and
+	// quality in params, returning how many entries were removed
+	ClearVariants(resolvedPath string, params ProcessingParams) (int, error)
+
+	// Variants returns the formats cached for the size and quality in params
+	Variants(resolvedPath string, params ProcessingParams) ([]string, error)
+
 	// ClearAll removes all cached files
 	ClearAll() error
 
+	// ClearAllContext is ClearAll that stops once ctx ends, returning the
+	// context's error and leaving the files not reached yet
+	ClearAllContext(ctx context.Context) error
+
+	// ClearNamespace removes the files cached under NamespacedPath paths
+	// of one namespace
+	ClearNamespace(namespace string) error
+
+	// ClearAllNamespaces removes the files cached for a resolved path in
+	// the shared cache and in every namespace
+	ClearAllNamespaces(resolvedPath string) error
+
+	// ReadOnly reports whether repeated failed writes have stopped Store
+	// from writing until a periodic retry succeeds
+	ReadOnly() bool
+
 	// GetPath returns the cache path for given parameters
 	GetPath(resolvedPath string, params ProcessingParams) string
 
 	// GetStats returns cache statistics
 	GetStats() (*Stats, error)
+
+	// GetStatsContext is GetStats that stops scanning the cache once ctx
+	// ends, returning the context's error
+	GetStatsContext(ctx context.Context) (*Stats, error)
+
+	// Iterate calls fn for each cached rendition until fn returns false,
+	// visiting a snapshot taken when it starts
+	Iterate(fn func(entry CacheEntry) bool) error
+
+	// IterateContext is Iterate that stops once ctx ends, returning the
+	// context's error
+	IterateContext(ctx context.Context, fn func(entry CacheEntry) bool) error
+
+	// CompressCold compresses renditions that have gone unused for the
+	// configured idle period. Retrieve decompresses them transparently.
+	CompressCold() (*CompressionResult, error)
+
+	// TrackVersion records the modification time of the source version
+	// whose renditions are cached under a ContentPath
+	TrackVersion(cacheKey, sourcePath string, modTime time.Time) error
+
+	// PruneVersions removes the renditions of tracked source versions
+	// older than the configured number to keep, returning how many
+	// versions were removed
+	PruneVersions() (int, error)
+
+	// SaveAccessCounts persists how often each rendition was used, so
+	// eviction and warm-up order keep them across restarts
+	SaveAccessCounts() error
 }
 
 // ProcessingParams represents normalized image processing parameters
 type ProcessingParams struct {
-	Width   int
-	Height  int
-	Format  string
-	Quality int
+	Width       int
+	Height      int
+	Format      string
+	Quality     int
+	AutoQuality bool // Quality is chosen perceptually ("qauto") instead of fixed
+
+	// ChromaSubsampling is the JPEG chroma subsampling (444, 422, 420)
+	ChromaSubsampling string
+
+	// Poster selects a static Frame of an animated source
+	Poster bool
+	Frame  int
+
+	// DPI is the resolution recorded in the output (0 = as encoded)
+	DPI int
+
+	// Pad fills the box around the fitted image with Background (RRGGBB,
+	// empty = white) so the output is exactly Width x Height
+	Pad        bool
+	Background string
+
+	// Cover scales the image to cover Width x Height and crops the
+	// overflow around the center, as /thumb thumbnails are
+	Cover bool
+
+	// Crop is the source rectangle x, y, width, height extracted before
+	// resizing (zero = whole image)
+	Crop [4]int
+
+	// Trim removes a uniform border, treating colors within TrimThreshold
+	// of the border color as border
+	Trim          bool
+	TrimThreshold int
+
+	// ColorSpace is "preserve" when the source's color space is kept
+	// (empty = converted to sRGB); EmbedICC adds the sRGB ICC profile
+	ColorSpace string
+	EmbedICC   bool
+
+	// SaveData marks a rendition reduced for a client sent Save-Data: on
+	SaveData bool
+
+	// Progressive selects progressive JPEG or interlaced PNG output
+	Progressive bool
+
+	// Filter is a color filter: "grayscale", "sepia" or "monochrome"
+	// (empty = none)
+	Filter string
+
+	// Caption is text drawn onto the image at CaptionPosition ("top",
+	// "center" or "bottom") in CaptionSize pixels and CaptionColor (RRGGBB)
+	// (empty = none)
+	Caption         string
+	CaptionPosition string
+	CaptionSize     int
+	CaptionColor    string
+
+	// NoUpscale keeps the output within the source's dimensions
+	NoUpscale bool
+
+	// MaxUpscale keeps the output within this multiple of the source's
+	// dimensions (0 = unlimited)
+	MaxUpscale float64
+
+	// Original serves the source as stored, in Format, without processing
+	Original bool
 }
 
 // Stats contains cache statistics
@@ -48,6 +167,32 @@ type Stats struct {
 	LastClearTime  time.Time
 	OldestFileTime time.Time
 	NewestFileTime time.Time
+
+	// TopVariantFiles lists the source files with the most cached
+	// renditions, largest first
+	TopVariantFiles []VariantCount
+
+	// GlobalEvictions counts the stores that evicted renditions to stay
+	// within MaxTotalVariants
+	GlobalEvictions int64
+
+	// CoalescedWrites counts the stores that reused a concurrent store of
+	// the same rendition instead of writing it again; WriteConflicts those
+	// among them whose data differed from the data kept
+	CoalescedWrites int64
+	WriteConflicts  int64
+}
+
+// VariantCount is the number of renditions cached for one source file
+type VariantCount struct {
+	Path     string
+	Variants int
+}
+
+// CompressionResult summarizes a cold entry compression pass
+type CompressionResult struct {
+	Compressed int   // Renditions compressed in this pass
+	SavedBytes int64 // Disk space saved by them
 }
 
 // Metadata contains cache file metadata
@@ -0,0 +1,190 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// versionsFile records, in the directory of a content path, which source
+// files had that content and when they were modified
+const versionsFile = ".versions"
+
+// sourceVersions maps a source file, qualified by its cache namespace, to
+// the modification time in Unix nanoseconds of its version with the content
+type sourceVersions map[string]int64
+
+// IsContentPath reports whether cacheKey is a ContentPath, in any namespace
+func IsContentPath(cacheKey string) bool {
+	_, rest := splitNamespace(strings.TrimPrefix(cacheKey, "/"))
+	return strings.HasPrefix(rest, contentPrefix+"/")
+}
+
+// TrackVersion records that the renditions cached under cacheKey, a
+// ContentPath, were made from the version of sourcePath modified at modTime.
+// It does nothing unless MaxSourceVersions is set, for other keys, or before
+// a rendition has been stored under cacheKey.
+func (m *manager) TrackVersion(cacheKey, sourcePath string, modTime time.Time) error {
+	if m.maxVersions <= 0 || !IsContentPath(cacheKey) {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dir := m.sourceDir(cacheKey)
+	if _, err := os.Stat(dir); err != nil {
+		return nil
+	}
+	versions := readSourceVersions(dir)
+	key := versionKey(cacheKey, sourcePath)
+	if versions[key] == modTime.UnixNano() {
+		return nil
+	}
+	versions[key] = modTime.UnixNano()
+
+	data, err := json.Marshal(versions)
+	if err != nil {
+		return fmt.Errorf("failed to encode source versions: %w", err)
+	}
+	path := filepath.Join(dir, versionsFile)
+	tempFile := path + ".tmp"
+	if err := m.writeFile(tempFile, data); err != nil {
+		return fmt.Errorf("failed to write source versions: %w", err)
+	}
+	if err := os.Rename(tempFile, path); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to rename source versions: %w", err)
+	}
+	return nil
+}
+
+// versionKey qualifies sourcePath with the namespace of cacheKey, so the
+// versions of one source are counted per namespace
+func versionKey(cacheKey, sourcePath string) string {
+	namespace, _ := splitNamespace(strings.TrimPrefix(cacheKey, "/"))
+	return filepath.Join(namespace, sourcePath)
+}
+
+// readSourceVersions reads the versions recorded in a content directory.
+// A missing or unreadable record is empty.
+func readSourceVersions(dir string) sourceVersions {
+	versions := sourceVersions{}
+	data, err := os.ReadFile(filepath.Join(dir, versionsFile))
+	if err != nil {
+		return versions
+	}
+	if err := json.Unmarshal(data, &versions); err != nil {
+		return sourceVersions{}
+	}
+	return versions
+}
+
+// trackedVersion is one content directory recorded for a source file
+type trackedVersion struct {
+	dir     string
+	modTime int64
+}
+
+// PruneVersions removes the renditions of all but the MaxSourceVersions most
+// recently modified versions of each tracked source file, returning how many
+// content directories were removed. Content shared by several files is kept
+// while it is among the latest versions of any file it was rendered for;
+// files that only hit renditions of other files are not tracked. The cache
+// is only locked while each directory is removed.
+func (m *manager) PruneVersions() (int, error) {
+	if m.maxVersions <= 0 {
+		return 0, nil
+	}
+
+	m.mu.RLock()
+	recorded, err := m.trackedVersions()
+	m.mu.RUnlock()
+	if err != nil {
+		return 0, err
+	}
+
+	bySource := make(map[string][]trackedVersion)
+	for dir, versions := range recorded {
+		for source, modTime := range versions {
+			bySource[source] = append(bySource[source], trackedVersion{dir: dir, modTime: modTime})
+		}
+	}
+	keep := make(map[string]bool)
+	for _, versions := range bySource {
+		sort.Slice(versions, func(i, j int) bool {
+			if versions[i].modTime != versions[j].modTime {
+				return versions[i].modTime > versions[j].modTime
+			}
+			return versions[i].dir < versions[j].dir
+		})
+		for i := 0; i < len(versions) && i < m.maxVersions; i++ {
+			keep[versions[i].dir] = true
+		}
+	}
+
+	removed := 0
+	for dir, versions := range recorded {
+		if keep[dir] {
+			continue
+		}
+		ok, err := m.pruneVersion(dir, versions)
+		if err != nil {
+			return removed, err
+		}
+		if ok {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// trackedVersions returns the versions recorded in each content directory.
+// Callers must hold the cache lock.
+func (m *manager) trackedVersions() (map[string]sourceVersions, error) {
+	recorded := make(map[string]sourceVersions)
+	err := filepath.WalkDir(m.cacheDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && variantGroupPattern.MatchString(d.Name()) {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && d.Name() == versionsFile {
+			dir := filepath.Dir(path)
+			if versions := readSourceVersions(dir); len(versions) > 0 {
+				recorded[dir] = versions
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan cache: %w", err)
+	}
+	return recorded, nil
+}
+
+// pruneVersion removes a content directory unless it was tracked again
+// since the scan, e.g. because a source was reverted to that content
+func (m *manager) pruneVersion(dir string, scanned sourceVersions) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current := readSourceVersions(dir)
+	if len(current) != len(scanned) {
+		return false, nil
+	}
+	for source, modTime := range current {
+		if scanned[source] != modTime {
+			return false, nil
+		}
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return false, fmt.Errorf("failed to prune cache version %s: %w", dir, err)
+	}
+	m.totalVariants = -1 // Recounted on the next admission
+	return true, nil
+}
@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCacheManager_PruneVersions_KeepsNewest tests that a source updated
+// several times keeps only the renditions of its newest versions
+func TestCacheManager_PruneVersions_KeepsNewest(t *testing.T) {
+	// Arrange
+	manager, err := NewManagerWithOptions(t.TempDir(), Options{MaxSourceVersions: 2, ShardLevels: 1})
+	require.NoError(t, err)
+	params := ProcessingParams{Width: 100, Height: 100, Format: "webp", Quality: 75}
+	modTime := time.Now().Add(-time.Hour)
+
+	// store caches a rendition of one version of source in namespace
+	store := func(namespace, source, sum string, modTime time.Time) string {
+		key := NamespacedPath(namespace, ContentPath(sum))
+		require.NoError(t, manager.Store(key, params, []byte(sum)))
+		require.NoError(t, manager.TrackVersion(key, source, modTime))
+		return key
+	}
+
+	// Act: photo.jpg is updated five times, banner.png twice. Tenant acme
+	// has its own single version of photo.jpg.
+	var photo []string
+	for i := 1; i <= 5; i++ {
+		photo = append(photo, store("", "/images/photo.jpg", fmt.Sprintf("photo-v%d", i), modTime.Add(time.Duration(i)*time.Minute)))
+	}
+	banner1 := store("", "/images/banner.png", "banner-v1", modTime)
+	banner2 := store("", "/images/banner.png", "banner-v2", modTime.Add(time.Minute))
+	tenant := store("acme", "/images/photo.jpg", "photo-v1", modTime)
+
+	// A file whose content is photo.jpg's first version keeps it
+	require.NoError(t, manager.TrackVersion(photo[0], "/images/copy.jpg", modTime))
+
+	pruned, err := manager.PruneVersions()
+	require.NoError(t, err)
+
+	// Assert
+	assert.Equal(t, 2, pruned)
+	for i, key := range photo {
+		kept := i == 0 || i >= 3
+		assert.Equal(t, kept, manager.Exists(key, params), "photo version %d", i+1)
+	}
+	assert.True(t, manager.Exists(banner1, params))
+	assert.True(t, manager.Exists(banner2, params))
+	assert.True(t, manager.Exists(tenant, params))
+
+	// A second pass finds nothing more to remove
+	pruned, err = manager.PruneVersions()
+	require.NoError(t, err)
+	assert.Equal(t, 0, pruned)
+	stats, err := manager.GetStats()
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), stats.TotalFiles)
+}
+
+// TestCacheManager_PruneVersions_Disabled tests that without a limit no
+// versions are tracked or pruned
+func TestCacheManager_PruneVersions_Disabled(t *testing.T) {
+	// Arrange
+	manager, err := NewManager(t.TempDir())
+	require.NoError(t, err)
+	params := ProcessingParams{Width: 100, Height: 100, Format: "webp", Quality: 75}
+	var keys []string
+	for i := 1; i <= 3; i++ {
+		key := ContentPath(fmt.Sprintf("v%d", i))
+		require.NoError(t, manager.Store(key, params, []byte("data")))
+		require.NoError(t, manager.TrackVersion(key, "/images/photo.jpg", time.Now().Add(time.Duration(i)*time.Minute)))
+		keys = append(keys, key)
+	}
+
+	// Act
+	pruned, err := manager.PruneVersions()
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, 0, pruned)
+	for _, key := range keys {
+		assert.True(t, manager.Exists(key, params), key)
+	}
+}
+
+// TestIsContentPath tests recognition of content-addressed cache keys
+func TestIsContentPath(t *testing.T) {
+	assert.True(t, IsContentPath(ContentPath("abc")))
+	assert.True(t, IsContentPath(NamespacedPath("acme", ContentPath("abc"))))
+	assert.False(t, IsContentPath("/images/photo.jpg"))
+	assert.False(t, IsContentPath("/images/_content/photo.jpg"))
+}
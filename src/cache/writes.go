@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrReadOnly is returned by Store while persistent write failures keep the
+// cache read-only
+var ErrReadOnly = errors.New("cache is read-only")
+
+// readOnlyAfter is how many stores in a row must fail before the cache
+// stops writing
+const readOnlyAfter = 3
+
+// DefaultWriteRetryInterval is how often a read-only cache tries a store
+const DefaultWriteRetryInterval = 30 * time.Second
+
+// writeHealth counts failed stores. Once readOnlyAfter stores in a row have
+// failed, e.g. because the cache directory was remounted read-only or the
+// disk is full, stores are skipped except for one every retry interval; the
+// first that succeeds makes the cache writable again.
+type writeHealth struct {
+	mu       sync.Mutex
+	failures int
+	readOnly bool
+	retry    time.Duration
+	lastTry  time.Time
+}
+
+// newWriteHealth tracks stores, retrying every interval (0 = default) while
+// the cache is read-only
+func newWriteHealth(retry time.Duration) *writeHealth {
+	if retry <= 0 {
+		retry = DefaultWriteRetryInterval
+	}
+	return &writeHealth{retry: retry}
+}
+
+// allow reports whether a store should be attempted
+func (w *writeHealth) allow() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.readOnly || time.Since(w.lastTry) >= w.retry {
+		w.lastTry = time.Now()
+		return true
+	}
+	return false
+}
+
+// record notes the outcome of an attempted store
+func (w *writeHealth) record(cacheDir string, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err == nil {
+		if w.readOnly {
+			log.Printf("Cache directory %s is writable again, caching resumed", cacheDir)
+		}
+		w.failures = 0
+		w.readOnly = false
+		return
+	}
+
+	w.failures++
+	if !w.readOnly && w.failures >= readOnlyAfter {
+		w.readOnly = true
+		log.Printf("ALERT: cache directory %s failed %d writes in a row, serving without caching until writes succeed: %v", cacheDir, w.failures, err)
+	}
+}
+
+// isReadOnly reports whether stores are being skipped
+func (w *writeHealth) isReadOnly() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.readOnly
+}
+
+// ReadOnly reports whether persistent write failures have made the cache
+// read-only
+func (m *manager) ReadOnly() bool {
+	return m.writes.isReadOnly()
+}
+
+// pendingWrite is a store in progress for one rendition file
+type pendingWrite struct {
+	done    chan struct{}
+	data    []byte
+	err     error
+	waiters int // Stores waiting for this one, guarded by the coordinator mutex
+}
+
+// writeCoordinator lets one store at a time write each rendition file.
+// Stores of the same file arriving while one is writing wait for it and
+// reuse what it committed instead of writing the file again.
+type writeCoordinator struct {
+	mu      sync.Mutex
+	pending map[string]*pendingWrite
+
+	coalesced int64 // Stores that reused a concurrent store's write
+	conflicts int64 // Stores whose data differed from the concurrent write
+}
+
+// newWriteCoordinator creates a coordinator without pending writes
+func newWriteCoordinator() *writeCoordinator {
+	return &writeCoordinator{pending: make(map[string]*pendingWrite)}
+}
+
+// begin registers a store of data to path. The first store gets owner true
+// and must call finish; later ones get the pending write to wait for.
+func (w *writeCoordinator) begin(path string, data []byte) (write *pendingWrite, owner bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if write, ok := w.pending[path]; ok {
+		write.waiters++
+		return write, false
+	}
+	write = &pendingWrite{done: make(chan struct{}), data: data}
+	w.pending[path] = write
+	return write, true
+}
+
+// finish records the outcome of the owner's write and releases its waiters
+func (w *writeCoordinator) finish(path string, write *pendingWrite, err error) {
+	w.mu.Lock()
+	write.err = err
+	delete(w.pending, path)
+	w.mu.Unlock()
+	close(write.done)
+}
+
+// reuse waits for a concurrent write of path and reports whether it
+// committed, counting the store of data as coalesced. Committed data that
+// differ from data are kept and the conflict is counted and logged, as
+// renditions are expected to be deterministic.
+func (w *writeCoordinator) reuse(path string, write *pendingWrite, data []byte) bool {
+	<-write.done
+	if write.err != nil {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.coalesced++
+	if !bytes.Equal(write.data, data) {
+		w.conflicts++
+		log.Printf("Warning: concurrent stores of %s differ, keeping the first", path)
+	}
+	return true
+}
+
+// counts returns how many stores were coalesced and how many conflicted
+func (w *writeCoordinator) counts() (coalesced, conflicts int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.coalesced, w.conflicts
+}
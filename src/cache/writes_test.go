@@ -0,0 +1,202 @@
+package cache
+
+import (
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCacheManager_ReadOnly_AfterRepeatedFailures tests that failing writes
+// make the cache read-only and that a successful retry recovers it
+func TestCacheManager_ReadOnly_AfterRepeatedFailures(t *testing.T) {
+	// Arrange
+	retry := 50 * time.Millisecond
+	cm, err := NewManagerWithOptions(t.TempDir(), Options{WriteRetryInterval: retry})
+	require.NoError(t, err)
+	var failing atomic.Bool
+	var attempts atomic.Int64
+	cm.(*manager).files.writeFile = func(name string, data []byte, perm os.FileMode) error {
+		attempts.Add(1)
+		if failing.Load() {
+			return &os.PathError{Op: "open", Path: name, Err: syscall.EROFS}
+		}
+		return os.WriteFile(name, data, perm)
+	}
+	params := ProcessingParams{Width: 100, Height: 100, Format: "webp", Quality: 75}
+	require.NoError(t, cm.Store("photo.jpg", params, []byte("data")))
+	assert.False(t, cm.ReadOnly())
+
+	// Act: the disk is remounted read-only
+	failing.Store(true)
+	for i := 0; i < readOnlyAfter; i++ {
+		assert.False(t, cm.ReadOnly(), "store %d", i)
+		err := cm.Store("photo.jpg", params, []byte("data"))
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, ErrReadOnly)
+	}
+
+	// Assert: further stores are skipped until the retry interval passes
+	assert.True(t, cm.ReadOnly())
+	tried := attempts.Load()
+	assert.ErrorIs(t, cm.Store("photo.jpg", params, []byte("data")), ErrReadOnly)
+	assert.Equal(t, tried, attempts.Load(), "a read-only cache should not write")
+
+	// Cached renditions are still served
+	data, found, err := cm.Retrieve("photo.jpg", params)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []byte("data"), data)
+
+	// A failed retry keeps the cache read-only
+	time.Sleep(retry)
+	assert.Error(t, cm.Store("photo.jpg", params, []byte("data")))
+	assert.True(t, cm.ReadOnly())
+
+	// The first retry that succeeds recovers
+	failing.Store(false)
+	time.Sleep(retry)
+	require.NoError(t, cm.Store("photo.jpg", params, []byte("new data")))
+	assert.False(t, cm.ReadOnly())
+	require.NoError(t, cm.Store("other.jpg", params, []byte("data")))
+}
+
+// waitingStores returns how many stores wait for the pending write to path
+func waitingStores(m *manager, path string) int {
+	m.pending.mu.Lock()
+	defer m.pending.mu.Unlock()
+	if write, ok := m.pending.pending[path]; ok {
+		return write.waiters
+	}
+	return 0
+}
+
+// TestCacheManager_Store_ConcurrentSameKey tests that concurrent stores of
+// one rendition write the file once and the others reuse that write
+func TestCacheManager_Store_ConcurrentSameKey(t *testing.T) {
+	// Arrange
+	cm, err := NewManager(t.TempDir())
+	require.NoError(t, err)
+	m := cm.(*manager)
+	params := ProcessingParams{Width: 100, Height: 100, Format: "webp", Quality: 75}
+	path := m.GetPath("photo.jpg", params)
+
+	// The first write blocks until every other store is waiting for it
+	release := make(chan struct{})
+	var writes atomic.Int64
+	m.files.writeFile = func(name string, data []byte, perm os.FileMode) error {
+		if writes.Add(1) == 1 {
+			<-release
+		}
+		return os.WriteFile(name, data, perm)
+	}
+
+	// Act
+	const stores = 8
+	errs := make(chan error, stores)
+	for i := 0; i < stores; i++ {
+		go func() { errs <- cm.Store("photo.jpg", params, []byte("rendition")) }()
+	}
+	require.Eventually(t, func() bool { return waitingStores(m, path) == stores-1 }, 5*time.Second, time.Millisecond)
+	close(release)
+
+	// Assert
+	for i := 0; i < stores; i++ {
+		assert.NoError(t, <-errs)
+	}
+	assert.Equal(t, int64(1), writes.Load(), "one physical write")
+	data, found, err := cm.Retrieve("photo.jpg", params)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []byte("rendition"), data)
+
+	stats, err := cm.GetStats()
+	require.NoError(t, err)
+	assert.Equal(t, int64(stores-1), stats.CoalescedWrites)
+	assert.Zero(t, stats.WriteConflicts)
+
+	// Later stores write again
+	require.NoError(t, cm.Store("photo.jpg", params, []byte("rendition")))
+	assert.Equal(t, int64(2), writes.Load())
+}
+
+// TestCacheManager_Store_ConcurrentConflict tests that a concurrent store
+// with different data keeps the first write and counts the conflict
+func TestCacheManager_Store_ConcurrentConflict(t *testing.T) {
+	// Arrange
+	cm, err := NewManager(t.TempDir())
+	require.NoError(t, err)
+	m := cm.(*manager)
+	params := ProcessingParams{Width: 100, Height: 100, Format: "webp", Quality: 75}
+	path := m.GetPath("photo.jpg", params)
+	release := make(chan struct{})
+	var writes atomic.Int64
+	m.files.writeFile = func(name string, data []byte, perm os.FileMode) error {
+		if writes.Add(1) == 1 {
+			<-release
+		}
+		return os.WriteFile(name, data, perm)
+	}
+
+	// Act
+	first := make(chan error, 1)
+	go func() { first <- cm.Store("photo.jpg", params, []byte("first")) }()
+	require.Eventually(t, func() bool { return writes.Load() == 1 }, 5*time.Second, time.Millisecond)
+	second := make(chan error, 1)
+	go func() { second <- cm.Store("photo.jpg", params, []byte("second")) }()
+	require.Eventually(t, func() bool { return waitingStores(m, path) == 1 }, 5*time.Second, time.Millisecond)
+	close(release)
+
+	// Assert
+	assert.NoError(t, <-first)
+	assert.NoError(t, <-second)
+	assert.Equal(t, int64(1), writes.Load())
+	data, _, err := cm.Retrieve("photo.jpg", params)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("first"), data)
+	stats, err := cm.GetStats()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.CoalescedWrites)
+	assert.Equal(t, int64(1), stats.WriteConflicts)
+}
+
+// TestCacheManager_Store_ConcurrentAfterFailure tests that stores waiting
+// for a failed write try their own
+func TestCacheManager_Store_ConcurrentAfterFailure(t *testing.T) {
+	// Arrange
+	cm, err := NewManager(t.TempDir())
+	require.NoError(t, err)
+	m := cm.(*manager)
+	params := ProcessingParams{Width: 100, Height: 100, Format: "webp", Quality: 75}
+	path := m.GetPath("photo.jpg", params)
+	release := make(chan struct{})
+	var writes atomic.Int64
+	m.files.writeFile = func(name string, data []byte, perm os.FileMode) error {
+		if writes.Add(1) == 1 {
+			<-release
+			return &os.PathError{Op: "open", Path: name, Err: syscall.ENOSPC}
+		}
+		return os.WriteFile(name, data, perm)
+	}
+
+	// Act
+	first := make(chan error, 1)
+	go func() { first <- cm.Store("photo.jpg", params, []byte("rendition")) }()
+	require.Eventually(t, func() bool { return writes.Load() == 1 }, 5*time.Second, time.Millisecond)
+	second := make(chan error, 1)
+	go func() { second <- cm.Store("photo.jpg", params, []byte("rendition")) }()
+	require.Eventually(t, func() bool { return waitingStores(m, path) == 1 }, 5*time.Second, time.Millisecond)
+	close(release)
+
+	// Assert
+	assert.Error(t, <-first)
+	assert.NoError(t, <-second)
+	assert.True(t, cm.Exists("photo.jpg", params))
+	stats, err := cm.GetStats()
+	require.NoError(t, err)
+	assert.Zero(t, stats.CoalescedWrites)
+}
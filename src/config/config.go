@@ -1,10 +1,139 @@
 package config
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+)
+
+// Miss behaviors control the response when a requested image does not exist
+const (
+	MissBehaviorFallback = "fallback" // Serve the group or system default image
+	MissBehaviorNotFound = "notfound" // Return 404 Not Found
+	MissBehaviorRedirect = "redirect" // Redirect (302) to PlaceholderURL
+)
+
+// Empty source behaviors control the response when a source file is empty
+const (
+	EmptySourceFallback = "fallback" // Treat it as missing and apply MissBehavior
+	EmptySourceError    = "error"    // Return 422 Unprocessable Entity
+)
+
+// Format mismatch policies control sources whose content is another
+// format than their extension names, e.g. a JPEG named photo.png
+const (
+	FormatMismatchContent = "content" // Log it and serve by the content's format
+	FormatMismatchStrict  = "strict"  // Return 422 Unprocessable Entity
+)
+
+// Path cases select how image paths are matched against file names
+const (
+	PathCaseSensitive   = "sensitive"   // Paths must match file names exactly
+	PathCaseInsensitive = "insensitive" // Paths match file names in any case
+)
+
+// Denied behaviors control the response for images under a denied path prefix
+const (
+	DeniedBehaviorForbidden = "forbidden" // Return 403 Forbidden
+	DeniedBehaviorFallback  = "fallback"  // Serve the system default image
+)
+
+// Invalid default image behaviors control what is served when the default
+// image is missing, unreadable or corrupt
+const (
+	InvalidDefaultImagePlaceholder = "placeholder" // Serve a placeholder generated in memory
+	InvalidDefaultImageError       = "error"       // Fail at startup, answer 500 at request time
+)
+
+// Query param modes control how ?width=, ?height=, ?quality= and ?format= are treated
+const (
+	QueryParamsNormalize = "normalize" // Merge into path parameters; path segments win
+	QueryParamsStrip     = "strip"     // Ignore the query string entirely
+)
+
+// Minimum TLS versions accepted by --tls-min-version
+const (
+	TLSVersion12 = "1.2"
+	TLSVersion13 = "1.3"
+)
+
+// Hash mismatch behaviors control the response to an outdated content-hash URL
+const (
+	HashMismatchNotFound = "notfound" // Return 404 Not Found
+	HashMismatchRedirect = "redirect" // Redirect (302) to the URL with the current hash
+)
+
+// Animated GIF modes control the output for animated GIFs requested without a format
+const (
+	AnimatedGIFWebP        = "webp"        // Animated WebP keeping every frame, encoded in Go
+	AnimatedGIFStatic      = "static"      // Static WebP of the first frame
+	AnimatedGIFPassthrough = "passthrough" // The original GIF, untouched
+)
+
+// Disallowed format behaviors control requests for an output format that
+// AllowedFormats or PathFormats exclude
+const (
+	DisallowedFormatSnap   = "snap"   // Serve the first allowed format instead
+	DisallowedFormatReject = "reject" // Return 400 Bad Request
+)
+
+// SourceFormatPassthrough is the source format rule that keeps the source's
+// format instead of transcoding
+const SourceFormatPassthrough = "passthrough"
+
+// Range modes control which image responses answer byte range requests
+const (
+	RangeOriginals   = "originals"   // Untouched originals served as stored
+	RangeTransformed = "transformed" // Processed renditions
+	RangeAll         = "all"         // Every image response
+	RangeNone        = "none"        // No image response
+)
+
+// Crop bounds modes control crop rectangles reaching outside the source image
+const (
+	CropBoundsClamp  = "clamp"  // Crop the part of the rectangle inside the image
+	CropBoundsReject = "reject" // Return 400 Bad Request
+)
+
+// Color space modes control the color space of processed images
+const (
+	ColorSpaceSRGB     = "srgb"     // Convert every source to sRGB
+	ColorSpacePreserve = "preserve" // Keep the source's color space and RGB profile
+)
+
+// Cache namespace sources select what isolates one tenant's cache entries
+const (
+	CacheNamespaceHeader = "header" // The CacheNamespaceHeader request header
+	CacheNamespacePath   = "path"   // The first segment of the image path
+)
+
+// Log formats accepted by --log-format
+const (
+	LogFormatJSON = "json" // One JSON object per line, for log ingestion
+	LogFormatText = "text" // key=value lines for reading in a terminal
+)
+
+// Log levels accepted by --log-level
+const (
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+)
+
+// Metrics label placeholders accepted by --metrics-label
+const (
+	MetricsLabelGroup  = "{group}"  // Group directory of the image, _root outside any
+	MetricsLabelPreset = "{preset}" // Name of the matching MetricsPresets rule, default or other
+	MetricsLabelFormat = "{format}" // Output format requested
 )
 
 // Config holds all application configuration
@@ -13,30 +142,478 @@ type Config struct {
 	ImagesDir        string
 	CacheDir         string
 	Dump             bool
+	SelfTest         bool
 	DefaultImagePath string
-	PreCacheEnabled  bool
-	PreCacheWorkers  int
+
+	// Archive is a .zip or .tar file whose images are served as if they
+	// were in ImagesDir, read without unpacking (empty = ImagesDir itself)
+	Archive string
+
+	// ConfigFile is a YAML or JSON file of settings keyed by flag name,
+	// loaded for every flag not given on the command line
+	ConfigFile string
+
+	PreCacheEnabled bool
+	PreCacheWorkers int
+	PreCacheRate    float64
+
+	// MaxSourcePixels is the pixel budget for images checked by /img/_validate,
+	// compared by /img/_diff and accepted by uploads (0 = unlimited)
+	MaxSourcePixels int
+
+	// Uploads through POST /img/*path, behind the command API key.
+	// UploadWarm lists parameter presets such as "800x600/webp" rendered
+	// right after each upload.
+	EnableUploads   bool
+	UploadOverwrite bool
+	UploadWarm      []string
+
+	// MaxVariantsPerFile caps the cached renditions of one source file (0 = unlimited)
+	MaxVariantsPerFile int
+
+	// MaxTotalVariants caps the cached renditions across all files (0 = unlimited)
+	MaxTotalVariants int
+
+	// CacheFrequencyWeight is how much longer eviction keeps a rendition
+	// per doubling of its recent uses, so frequently used renditions
+	// outlast ones used once (0 = least recently used only)
+	CacheFrequencyWeight time.Duration
+
+	// CacheShardLevels spreads cached files over hash prefix directories (0 = flat)
+	CacheShardLevels int
+
+	// DedupeSources caches renditions by source content, so identical
+	// images at different paths share them, at the cost of hashing each
+	// source once per modification
+	DedupeSources bool
+
+	// CacheMaxSourceVersions keeps the content-addressed renditions of only
+	// the newest versions of each source, pruning older ones every
+	// CacheJanitorInterval (0 = keep all). It needs DedupeSources.
+	CacheMaxSourceVersions int
+
+	// CacheNamespace selects where each request's cache namespace comes
+	// from, so tenants' renditions are cached and cleared apart (empty = off).
+	// CacheNamespaceHeader names the request header for the header source.
+	CacheNamespace       string
+	CacheNamespaceHeader string
+
+	// CacheMaxOpenFiles bounds the cache files read or written at once (0 = unlimited)
+	CacheMaxOpenFiles int
+
+	// Cold cache entries in CacheCompressFormats are gzip-compressed once
+	// unused for CacheCompressAfter (0 = off), checked every CacheJanitorInterval
+	// along with old source versions
+	CacheCompressAfter   time.Duration
+	CacheCompressFormats []string
+	CacheJanitorInterval time.Duration
+
+	// ServeSmallerOriginal serves the source bytes instead of a transcode
+	// that came out larger, as long as the request did not need a resize
+	ServeSmallerOriginal bool
+
+	// MaxUpscale caps requested dimensions at this multiple of the source's
+	// dimensions, keeping their ratio, e.g. 2 renders a 100px wide source at
+	// most 200px wide (0 = unlimited, 1 = never upscale)
+	MaxUpscale float64
+
+	// StreamOriginalsOver is the size in bytes from which pass-through
+	// originals are streamed from the source file instead of read into
+	// memory and cached (0 = never)
+	StreamOriginalsOver int64
+
+	// PanicFallback serves the default image when processing a source
+	// panics, instead of answering 500
+	PanicFallback bool
+
+	// InvalidDefaultImage selects what is served in place of a default
+	// image that is missing or cannot be rendered (empty = placeholder)
+	InvalidDefaultImage string
+
+	// FallbackCacheTTL limits how long default images cached under a
+	// missing file's path are reused, so the file is served soon after it
+	// is added (0 = as long as any other entry)
+	FallbackCacheTTL time.Duration
+
+	// ListingTTL is how long a cached directory listing answers existence
+	// checks before the directory is checked for changes (0 = every request)
+	ListingTTL time.Duration
+
+	// ResolverCacheSize is how many path resolutions are cached, the least
+	// recently used forgotten first (0 = unlimited)
+	ResolverCacheSize int
+
+	// PathCase selects whether image paths match file names in any case
+	// (empty = sensitive)
+	PathCase string
+
+	// HonorNoCache re-renders images for requests sent with
+	// Cache-Control: no-cache and refreshes their cache entry
+	HonorNoCache bool
+
+	// GroupPlaceholder serves a generated placeholder labeled with the group
+	// name for missing images in groups without their own default
+	GroupPlaceholder bool
+
+	// GroupIndex serves a JSON index of the image groups at /img/_groups
+	GroupIndex bool
+
+	// ThumbSize is the width and height of the square /thumb thumbnails
+	// requested without a size segment (0 = 150)
+	ThumbSize int
+
+	// MissBehavior selects how missing images are answered (empty = fallback)
+	MissBehavior   string
+	PlaceholderURL string
+
+	// While maintenance mode is on, image requests get MaintenanceImage
+	// (empty = 503 with Retry-After of MaintenanceRetryAfter, 0 = none)
+	MaintenanceImage      string
+	MaintenanceRetryAfter time.Duration
+
+	// EmptySource selects how source files smaller than MinSourceSize bytes
+	// are answered (empty = fallback)
+	EmptySource   string
+	MinSourceSize int64
+
+	// FormatMismatch selects how sources whose magic number contradicts
+	// their extension are answered (empty = content)
+	FormatMismatch string
+
+	// AllowPaths and DenyPaths restrict which image path prefixes are served.
+	// An empty allow list allows everything that is not denied.
+	AllowPaths     []string
+	DenyPaths      []string
+	DeniedBehavior string // Response for denied paths (empty = forbidden)
+
+	// QualityMetric selects the qauto metric: ssim or heuristic (empty = ssim)
+	QualityMetric string
+
+	// JPEGSubsampling is the default JPEG chroma subsampling: 444, 422 or 420
+	JPEGSubsampling string
+
+	// ColorSpace selects whether sources are converted to sRGB or keep
+	// their color space (empty = srgb)
+	ColorSpace string
+
+	// EmbedICC writes the sRGB ICC profile into images converted to sRGB
+	EmbedICC bool
+
+	// Progressive encodes JPEG output as progressive and PNG output as
+	// interlaced without a progressive URL segment
+	Progressive bool
+
+	// Sidecars reads per-image overrides from a JSON file next to each
+	// source, e.g. photo.jpg.json for photo.jpg
+	Sidecars bool
+
+	// DefaultOutputFormat is the format for requests without a format segment:
+	// webp, png or jpeg (empty = webp)
+	DefaultOutputFormat string
+
+	// SaveDataQuality caps the quality of requests sent with Save-Data: on,
+	// which are also served as WebP (0 = the hint is ignored)
+	SaveDataQuality int
+
+	// LoadShedAt is the number of processings in flight at which new
+	// renditions are encoded at reduced quality (0 = never)
+	LoadShedAt int
+
+	// LoadShedRestore is the number of processings in flight below which
+	// full quality returns (0 = below LoadShedAt)
+	LoadShedRestore int
+
+	// LoadShedQuality caps the quality of renditions encoded under load
+	LoadShedQuality int
+
+	// ClientHints sizes requests without dimensions from the Width client
+	// hint and scales requested dimensions by the DPR hint
+	ClientHints bool
+
+	// ClientHintsStep rounds hinted widths up to a multiple of this many
+	// pixels, bounding the renditions cached per image
+	ClientHintsStep int
+
+	// SlowRequestThreshold logs a warning for image processing slower than this (0 = off)
+	SlowRequestThreshold time.Duration
+
+	// QueryParams selects how image query parameters are handled (empty = normalize)
+	QueryParams string
+
+	// HashMismatch selects how outdated content-hash URLs are answered (empty = notfound)
+	HashMismatch string
+
+	// AnimatedGIF selects the output for animated GIF sources (empty = static).
+	// Animated WebP is opt-in, as libvips cannot write it and the frames go
+	// through the lossless encoder in the processor package.
+	AnimatedGIF string
+
+	// PreloadRenditions map a preset such as "1600x900/webp" to the related
+	// renditions its responses name in Link: rel=preload headers, e.g.
+	// "1600x900/webp=800x450/webp|400x225/webp" (empty = none)
+	PreloadRenditions []string
+
+	// MetricsLabel is the template of the route label image requests are
+	// counted under in /debug/metrics, built from the MetricsLabel
+	// placeholders, e.g. "{group}/{preset}" (empty = not counted). Raw paths
+	// are never labels, so the number of series stays bounded.
+	// MetricsPresets name parameter presets for {preset}, e.g.
+	// "thumb=200x200/webp"
+	MetricsLabel   string
+	MetricsPresets []string
+
+	// AllowedFormats restricts the output formats served (empty = all);
+	// PathFormats overrides it below path prefixes, e.g. "partners=jpeg|png"
+	// with the longest prefix winning. Allowing gif allows GIF passthrough.
+	// DisallowedFormat selects how other formats are answered (empty = snap).
+	AllowedFormats   []string
+	PathFormats      []string
+	DisallowedFormat string
+
+	// SourceFormatRules map JPEG, PNG and WebP sources to the output used
+	// when no format is requested, e.g. "png=webp" or "jpeg=passthrough"
+	// (empty = DefaultOutputFormat for every source)
+	SourceFormatRules []string
+
+	// ClientFormatRules restrict the output formats served to clients that
+	// cannot display the default format, by User-Agent family and optional
+	// major version bound ("safari<14=jpeg|png") or User-Agent substring
+	// ("ua:LegacyApp=jpeg"); the first matching rule wins (empty = off).
+	// Explicitly requested formats are always served.
+	ClientFormatRules []string
+
+	// RangeRequests selects which image responses accept Range requests;
+	// the others answer Accept-Ranges: none (empty = originals)
+	RangeRequests string
+
+	// CropBounds selects how crop rectangles outside the image are handled (empty = clamp)
+	CropBounds string
+
+	// TrimThreshold is the largest per-channel difference from the border
+	// color that trim segments still remove (0-255)
+	TrimThreshold int
+
+	// BasePath prefixes every route when mounted under a reverse proxy path
+	BasePath string
+
+	// HTTP server tuning for connection reuse under heavy load
+	IdleTimeout    time.Duration
+	MaxHeaderBytes int
+	EnableHTTP2    bool
+
+	// Connection read limits against slow clients (slowloris)
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	MaxBodyBytes      int64
+
+	// Request timeouts per endpoint class (0 = no limit)
+	HealthTimeout  time.Duration // /ping and health checks
+	ImageTimeout   time.Duration // /img processing
+	CommandTimeout time.Duration // /cmd and /debug endpoints
+
+	// Built-in HTTPS for deployments without a TLS-terminating proxy.
+	// TLS is enabled when both TLSCert and TLSKey are set.
+	TLSCert          string
+	TLSKey           string
+	TLSMinVersion    string // Minimum TLS version: 1.2 or 1.3 (empty = 1.2)
+	HTTPRedirectPort int    // Plain HTTP port redirecting to HTTPS (0 = off)
+
+	// CommandAPIKey protects the /cmd endpoints with an X-API-Key header when set
+	CommandAPIKey string
+
+	// CaptionSecret signs /img/og caption URLs; captions are off without it
+	CaptionSecret string
+
+	// AuditLog is the file every /cmd call is appended to as a JSON line
+	// (empty = the server log)
+	AuditLog string
+
+	// Webhooks are the URLs POSTed a JSON event after the cache is cleared,
+	// the images are updated with git or pre-caching completes. Each attempt
+	// is bounded by WebhookTimeout (0 = 5s) and failed deliveries are
+	// retried up to WebhookRetries times.
+	Webhooks       []string
+	WebhookTimeout time.Duration
+	WebhookRetries int
+
+	// Git operations run one at a time per repository; up to GitQueue more
+	// wait for at most GitQueueTimeout (0 = the request timeout) before 409
+	GitQueue        int
+	GitQueueTimeout time.Duration
+
+	// Logging output applied at startup (empty = json and info)
+	LogFormat string
+	LogLevel  string
+
+	// Production disables the /ping demo endpoint, runs gin in release mode
+	// and leaves internal error details out of responses
+	Production bool
 }
 
-// ParseArgs parses command-line arguments and returns a Config
+// ParseArgs parses command-line arguments and returns a Config. With
+// --config the file's settings fill in every flag not given on the command
+// line.
 func ParseArgs(args []string) (*Config, error) {
-	fs := flag.NewFlagSet("goimgserver", flag.ContinueOnError)
-
 	cfg := &Config{}
+	fs := newFlagSet(cfg)
+
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.ConfigFile != "" {
+		set := map[string]bool{}
+		fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		if err := loadFile(fs, cfg.ConfigFile, set); err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// newFlagSet defines every flag on a new flag set, storing defaults in cfg
+func newFlagSet(cfg *Config) *flag.FlagSet {
+	fs := flag.NewFlagSet("goimgserver", flag.ContinueOnError)
+	cfg.CacheCompressFormats = []string{"png"}
+	cfg.ClientFormatRules = []string{"safari<14=jpeg|png", "ie=jpeg|png"}
 
 	fs.IntVar(&cfg.Port, "port", 9000, "Server port")
 	fs.StringVar(&cfg.ImagesDir, "imagesdir", "./images", "Images directory")
 	fs.StringVar(&cfg.CacheDir, "cachedir", "./cache", "Cache directory")
+	fs.StringVar(&cfg.Archive, "archive", "", "Zip or tar archive of images served in place of the images directory")
 	fs.BoolVar(&cfg.Dump, "dump", false, "Dump settings to settings.conf")
+	fs.BoolVar(&cfg.SelfTest, "selftest", false, "Check processing and the cache, print a PASS/FAIL summary and exit")
+	fs.StringVar(&cfg.ConfigFile, "config", "", "YAML or JSON settings file keyed by flag name; command-line flags take precedence")
 	fs.BoolVar(&cfg.PreCacheEnabled, "precache", true, "Enable pre-caching of images on startup")
 	fs.IntVar(&cfg.PreCacheWorkers, "precache-workers", 0, "Number of workers for pre-cache (0 = auto, uses CPU count)")
+	fs.Float64Var(&cfg.PreCacheRate, "precache-rate", 0, "Maximum images pre-cached per second (0 = unlimited)")
+	fs.IntVar(&cfg.MaxSourcePixels, "max-source-pixels", 50_000_000, "Largest image in pixels that /img/_validate, /img/_diff and uploads accept (0 = unlimited)")
+	fs.BoolVar(&cfg.EnableUploads, "uploads", false, "Accept image uploads with POST /img/{path} (requires --cmd-api-key)")
+	fs.BoolVar(&cfg.UploadOverwrite, "upload-overwrite", false, "Allow uploads to replace existing images")
+	fs.Var((*listValue)(&cfg.UploadWarm), "upload-warm", "Comma-separated parameter presets rendered after each upload, e.g. 800x600/webp,200x200/jpeg")
+	fs.IntVar(&cfg.MaxVariantsPerFile, "max-variants-per-file", 200, "Maximum cached renditions per source file; least recently used are evicted (0 = unlimited)")
+	fs.IntVar(&cfg.MaxTotalVariants, "max-total-variants", 0, "Maximum cached renditions across all files; least recently used are evicted (0 = unlimited)")
+	fs.DurationVar(&cfg.CacheFrequencyWeight, "cache-frequency-weight", time.Hour, "How much longer eviction keeps a cached rendition per doubling of its recent uses (0 = least recently used only)")
+	fs.IntVar(&cfg.CacheMaxOpenFiles, "cache-max-open-files", 256, "Maximum cache files read or written at once; further operations wait (0 = unlimited)")
+	fs.BoolVar(&cfg.DedupeSources, "dedupe-sources", false, "Cache renditions by source content so identical images at different paths share them (hashes each source once per change)")
+	fs.IntVar(&cfg.CacheMaxSourceVersions, "cache-max-source-versions", 0, "Versions of each source whose renditions are kept with dedupe-sources; older ones are pruned by the cache janitor (0 = keep all)")
+	fs.IntVar(&cfg.CacheShardLevels, "cache-shard-levels", 0, "Hash prefix directory levels above each cached file, 0-2 (0 = flat layout)")
+	fs.StringVar(&cfg.CacheNamespace, "cache-namespace", "", "Isolate cache entries per tenant by namespace: header or path (first image path segment); empty = shared cache")
+	fs.StringVar(&cfg.CacheNamespaceHeader, "cache-namespace-header", "X-Tenant", "Request header naming the cache namespace when cache-namespace is header")
+	fs.DurationVar(&cfg.CacheCompressAfter, "cache-compress-after", 0, "Gzip cached renditions unused for this long (0 = off)")
+	fs.Var((*listValue)(&cfg.CacheCompressFormats), "cache-compress-formats", "Comma-separated cached formats that may be compressed when cold")
+	fs.DurationVar(&cfg.CacheJanitorInterval, "cache-janitor-interval", time.Hour, "How often to look for cold cache entries to compress and old source versions to prune")
+	fs.StringVar(&cfg.MissBehavior, "miss-behavior", MissBehaviorFallback, "Response for missing images: fallback, notfound or redirect")
+	fs.StringVar(&cfg.MaintenanceImage, "maintenance-image", "", "Image served for image requests in maintenance mode (empty = 503)")
+	fs.DurationVar(&cfg.MaintenanceRetryAfter, "maintenance-retry-after", 5*time.Minute, "Retry-After sent with 503 responses in maintenance mode (0 = none)")
+	fs.StringVar(&cfg.PlaceholderURL, "placeholder-url", "", "Redirect target for missing images when miss-behavior is redirect")
+	fs.StringVar(&cfg.EmptySource, "empty-source", EmptySourceFallback, "Response for empty source files: fallback (treat as missing) or error")
+	fs.Int64Var(&cfg.MinSourceSize, "min-source-size", 1, "Source files smaller than this many bytes are empty (0 = off)")
+	fs.StringVar(&cfg.FormatMismatch, "format-mismatch", FormatMismatchContent, "Response for sources whose content is another format than their extension: content (log it and serve by content) or strict (422)")
+	fs.Var((*listValue)(&cfg.AllowPaths), "allow-paths", "Comma-separated image path prefixes that may be served (empty = all)")
+	fs.Var((*listValue)(&cfg.DenyPaths), "deny-paths", "Comma-separated image path prefixes that are never served, e.g. internal,drafts")
+	fs.StringVar(&cfg.DeniedBehavior, "denied-behavior", DeniedBehaviorForbidden, "Response for denied paths: forbidden or fallback")
+	fs.StringVar(&cfg.QualityMetric, "qauto-metric", "ssim", "Metric for qauto perceptual quality: ssim or heuristic")
+	fs.StringVar(&cfg.JPEGSubsampling, "jpeg-subsampling", "420", "Default JPEG chroma subsampling: 444, 422 or 420")
+	fs.StringVar(&cfg.ColorSpace, "color-space", ColorSpaceSRGB, "Color space of processed images: srgb (convert CMYK, Adobe RGB and other sources) or preserve (keep the source's)")
+	fs.BoolVar(&cfg.EmbedICC, "embed-icc", false, "Embed the sRGB ICC profile in images converted to sRGB")
+	fs.BoolVar(&cfg.Progressive, "progressive", false, "Encode JPEG output as progressive and PNG output as interlaced by default")
+	fs.BoolVar(&cfg.Sidecars, "sidecars", false, "Read per-image overrides from a JSON sidecar next to each image, e.g. photo.jpg.json")
+	fs.StringVar(&cfg.DefaultOutputFormat, "default-format", "webp", "Output format for requests without a format segment: webp, png or jpeg")
+	fs.IntVar(&cfg.SaveDataQuality, "save-data-quality", 0, "Maximum quality for requests with Save-Data: on, which are served as WebP (0 = ignore the hint)")
+	fs.IntVar(&cfg.LoadShedAt, "load-shed-at", 0, "Processings in flight at which new renditions are encoded at reduced quality without qauto (0 = off)")
+	fs.IntVar(&cfg.LoadShedRestore, "load-shed-restore", 0, "Processings in flight below which full quality returns (0 = below load-shed-at)")
+	fs.IntVar(&cfg.LoadShedQuality, "load-shed-quality", 60, "Maximum quality of renditions encoded under load")
+	fs.BoolVar(&cfg.ClientHints, "client-hints", false, "Size images from the Width and DPR client hints, requested with Accept-CH")
+	fs.IntVar(&cfg.ClientHintsStep, "client-hints-step", 100, "Round widths derived from client hints up to a multiple of this many pixels")
+	fs.DurationVar(&cfg.SlowRequestThreshold, "slow-request-threshold", 500*time.Millisecond, "Log image processing slower than this duration (0 = off)")
+	fs.StringVar(&cfg.QueryParams, "query-params", QueryParamsNormalize, "Image query parameters: normalize (merge into path parameters) or strip (ignore)")
+	fs.StringVar(&cfg.HashMismatch, "hash-mismatch", HashMismatchNotFound, "Response for content-hash URLs whose hash is outdated: notfound or redirect")
+	fs.StringVar(&cfg.RangeRequests, "range-requests", RangeOriginals, "Image responses that accept Range requests: originals (served as stored), transformed, all or none")
+	fs.StringVar(&cfg.AnimatedGIF, "animated-gif", AnimatedGIFStatic, "Output for GIF sources without an explicit format: static (first frame), webp (animated) or passthrough (original GIF)")
+	fs.StringVar(&cfg.MetricsLabel, "metrics-label", "{group}", "Route label template for image request metrics from {group}, {preset} and {format}, e.g. {group}/{preset} (empty = no route metrics)")
+	fs.Var((*listValue)(&cfg.MetricsPresets), "metrics-presets", "Comma-separated name=preset rules naming parameter presets for the {preset} metrics label, e.g. thumb=200x200/webp,hero=1600x900/webp")
+	fs.Var((*listValue)(&cfg.PreloadRenditions), "preload-renditions", "Comma-separated preset=rendition|rendition rules adding Link: rel=preload headers for related renditions, e.g. 1600x900/webp=800x450/webp|400x225/webp")
+	fs.Var((*listValue)(&cfg.AllowedFormats), "allowed-formats", "Comma-separated output formats served: webp, png, jpeg, jpg, pdf or gif for GIF passthrough (empty = all)")
+	fs.Var((*listValue)(&cfg.PathFormats), "path-formats", "Comma-separated prefix=format|format rules overriding --allowed-formats below path prefixes, e.g. partners=jpeg|png")
+	fs.StringVar(&cfg.DisallowedFormat, "disallowed-format", DisallowedFormatSnap, "Requests for an output format that is not allowed: snap (serve the first allowed format) or reject (400)")
+	fs.Var((*listValue)(&cfg.ClientFormatRules), "client-formats", "Comma-separated client=format|format rules for requests without a format, by User-Agent family (safari, ie, edge, firefox, chrome) with an optional <major bound, or ua:substring; empty = off")
+	fs.Var((*listValue)(&cfg.SourceFormatRules), "source-format-rules", "Comma-separated source=output rules for requests without a format, e.g. png=webp,jpeg=passthrough (keep the source format)")
+	fs.StringVar(&cfg.CropBounds, "crop-bounds", CropBoundsClamp, "Crop rectangles reaching outside the image: clamp (crop what is inside) or reject (400)")
+	fs.IntVar(&cfg.TrimThreshold, "trim-threshold", 10, "Largest per-channel color difference from the border that trim removes, 0-255")
+	fs.StringVar(&cfg.BasePath, "base-path", "", "Prefix for all routes when served under a proxy path, e.g. /images")
+	fs.DurationVar(&cfg.IdleTimeout, "idle-timeout", 120*time.Second, "Keep-alive idle connection timeout")
+	fs.IntVar(&cfg.MaxHeaderBytes, "max-header-bytes", 1<<20, "Maximum size of request headers in bytes")
+	fs.DurationVar(&cfg.ReadHeaderTimeout, "read-header-timeout", 10*time.Second, "Time allowed to send request headers before the connection is closed")
+	fs.DurationVar(&cfg.ReadTimeout, "read-timeout", 30*time.Second, "Time allowed to read a whole request including the body")
+	fs.Int64Var(&cfg.MaxBodyBytes, "max-body-bytes", 64<<20, "Maximum size of request bodies in bytes (0 = unlimited)")
+	fs.BoolVar(&cfg.EnableHTTP2, "http2", false, "Enable HTTP/2 over cleartext (h2c)")
+	fs.DurationVar(&cfg.HealthTimeout, "health-timeout", 2*time.Second, "Request timeout for /ping and health checks (0 = no limit)")
+	fs.DurationVar(&cfg.ImageTimeout, "image-timeout", 20*time.Second, "Request timeout for image processing under /img (0 = no limit)")
+	fs.DurationVar(&cfg.CommandTimeout, "cmd-timeout", 25*time.Second, "Request timeout for /cmd and /debug endpoints (0 = no limit)")
+	fs.StringVar(&cfg.TLSCert, "tls-cert", "", "PEM certificate file; with --tls-key serves HTTPS on --port")
+	fs.StringVar(&cfg.TLSKey, "tls-key", "", "PEM private key file for --tls-cert")
+	fs.StringVar(&cfg.TLSMinVersion, "tls-min-version", TLSVersion12, "Minimum TLS version: 1.2 or 1.3")
+	fs.IntVar(&cfg.HTTPRedirectPort, "http-redirect-port", 0, "Plain HTTP port that redirects to HTTPS when TLS is enabled (0 = off)")
+	fs.IntVar(&cfg.GitQueue, "git-queue", 2, "Git updates that may wait while another runs on the images repository; more get 409 (0 = none wait)")
+	fs.DurationVar(&cfg.GitQueueTimeout, "git-queue-timeout", 20*time.Second, "How long a queued git update waits before 409 (0 = until the request times out)")
+	fs.StringVar(&cfg.CommandAPIKey, "cmd-api-key", "", "API key required in the X-API-Key header for /cmd endpoints (empty = no auth)")
+	fs.StringVar(&cfg.CaptionSecret, "caption-secret", "", "Secret signing /img/og caption URLs with HMAC-SHA256 (empty = captions off)")
+	fs.StringVar(&cfg.AuditLog, "audit-log", "", "File the audit entries of /cmd calls are appended to (empty = server log)")
+	fs.Var((*listValue)(&cfg.Webhooks), "webhooks", "Comma-separated URLs POSTed a JSON event after cache clears, git updates and pre-cache runs, e.g. for peers to clear their caches")
+	fs.DurationVar(&cfg.WebhookTimeout, "webhook-timeout", 5*time.Second, "How long each webhook delivery attempt may take")
+	fs.IntVar(&cfg.WebhookRetries, "webhook-retries", 3, "How often a failed webhook delivery is retried, with exponential backoff")
+	fs.StringVar(&cfg.LogFormat, "log-format", LogFormatJSON, "Log output format: json or text")
+	fs.StringVar(&cfg.LogLevel, "log-level", LogLevelInfo, "Minimum log level: debug, info, warn or error")
+	fs.BoolVar(&cfg.Production, "production", false, "Production mode: no /ping demo endpoint, release mode and no internal error details")
+	fs.BoolVar(&cfg.ServeSmallerOriginal, "serve-smaller-original", true, "Serve the original image when transcoding without resize would make it larger")
+	fs.Float64Var(&cfg.MaxUpscale, "max-upscale", 0, "Largest multiple of the source's dimensions an image is rendered at; larger requests are clamped, keeping their ratio (0 = unlimited, 1 = never upscale)")
+	fs.Int64Var(&cfg.StreamOriginalsOver, "stream-originals-over", 8<<20, "Stream pass-through originals of at least this many bytes from the source file without buffering or caching them (0 = never)")
+	fs.BoolVar(&cfg.PanicFallback, "panic-fallback", true, "Serve the default image when processing an image panics instead of a 500 error")
+	fs.StringVar(&cfg.InvalidDefaultImage, "invalid-default-image", InvalidDefaultImagePlaceholder, "When the default image is missing or invalid: placeholder (serve a generated one) or error (fail at startup, 500 at request time)")
+	fs.DurationVar(&cfg.ListingTTL, "listing-ttl", time.Second, "How long cached directory listings are trusted before image directories are checked for files added by other processes (0 = check every request)")
+	fs.IntVar(&cfg.ResolverCacheSize, "resolver-cache-size", 100000, "How many path resolutions are cached in memory, the least recently used evicted first (0 = unlimited)")
+	fs.StringVar(&cfg.PathCase, "path-case", defaultPathCase(), "How image paths match file names: sensitive or insensitive (any case, resolved to the file's own name)")
+	fs.DurationVar(&cfg.FallbackCacheTTL, "fallback-cache-ttl", time.Minute, "How long default images served for missing files are cached before the path is resolved again (0 = no limit)")
+	fs.BoolVar(&cfg.HonorNoCache, "honor-no-cache", false, "Re-render images for requests with Cache-Control: no-cache instead of serving the cached rendition")
+	fs.BoolVar(&cfg.GroupPlaceholder, "group-placeholder", false, "Serve a placeholder labeled with the group name for missing images in groups without a default")
+	fs.BoolVar(&cfg.GroupIndex, "group-index", false, "Serve a JSON index of the image groups with their image counts at /img/_groups")
+	fs.IntVar(&cfg.ThumbSize, "thumb-size", 150, "Width and height of square, center-cropped /thumb thumbnails without a size segment, 10-4000")
 
-	err := fs.Parse(args)
-	if err != nil {
-		return nil, err
+	return fs
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
+}
 
-	return cfg, nil
+// defaultPathCase matches paths the way the platform's file systems usually
+// do: in any case on macOS and Windows, exactly elsewhere
+func defaultPathCase() string {
+	switch runtime.GOOS {
+	case "darwin", "windows":
+		return PathCaseInsensitive
+	}
+	return PathCaseSensitive
+}
+
+// NormalizeBasePath returns path as "/prefix" without a trailing slash.
+// Empty and "/" mean no prefix.
+func NormalizeBasePath(path string) string {
+	path = strings.Trim(strings.TrimSpace(path), "/")
+	if path == "" {
+		return ""
+	}
+	return "/" + path
 }
 
 // Validate validates the configuration and creates directories if needed
@@ -46,6 +623,347 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("port must be between 1 and 65535, got %d", c.Port)
 	}
 
+	// Normalize base path to "/prefix" without a trailing slash
+	c.BasePath = NormalizeBasePath(c.BasePath)
+	if strings.ContainsAny(c.BasePath, "*:?#") {
+		return fmt.Errorf("invalid base path %q", c.BasePath)
+	}
+
+	if c.HealthTimeout < 0 || c.ImageTimeout < 0 || c.CommandTimeout < 0 {
+		return fmt.Errorf("invalid request timeouts health=%v image=%v command=%v: must not be negative", c.HealthTimeout, c.ImageTimeout, c.CommandTimeout)
+	}
+
+	if c.PreCacheRate < 0 {
+		return fmt.Errorf("invalid pre-cache rate %v: must not be negative", c.PreCacheRate)
+	}
+	if c.ReadHeaderTimeout < 0 || c.ReadTimeout < 0 {
+		return fmt.Errorf("invalid read timeouts header=%v read=%v: must not be negative", c.ReadHeaderTimeout, c.ReadTimeout)
+	}
+	if c.MaxBodyBytes < 0 {
+		return fmt.Errorf("invalid max body bytes %d: must not be negative", c.MaxBodyBytes)
+	}
+	if c.MaxSourcePixels < 0 {
+		return fmt.Errorf("invalid max source pixels %d: must not be negative", c.MaxSourcePixels)
+	}
+	if c.GitQueue < 0 || c.GitQueueTimeout < 0 {
+		return fmt.Errorf("invalid git queue %d with timeout %v: must not be negative", c.GitQueue, c.GitQueueTimeout)
+	}
+	if c.EnableUploads && c.CommandAPIKey == "" {
+		return fmt.Errorf("uploads require --cmd-api-key")
+	}
+	if c.Archive != "" {
+		if ext := strings.ToLower(filepath.Ext(c.Archive)); ext != ".zip" && ext != ".tar" {
+			return fmt.Errorf("invalid archive %q: must be a .zip or .tar file", c.Archive)
+		}
+		if info, err := os.Stat(c.Archive); err != nil || info.IsDir() {
+			return fmt.Errorf("invalid archive %q: must be a readable file", c.Archive)
+		}
+		if c.EnableUploads {
+			return fmt.Errorf("uploads cannot write to --archive")
+		}
+	}
+	if c.MaxVariantsPerFile < 0 {
+		return fmt.Errorf("invalid max variants per file %d: must not be negative", c.MaxVariantsPerFile)
+	}
+	if c.MaxTotalVariants < 0 {
+		return fmt.Errorf("invalid max total variants %d: must not be negative", c.MaxTotalVariants)
+	}
+	if c.CacheFrequencyWeight < 0 {
+		return fmt.Errorf("invalid cache frequency weight %v: must not be negative", c.CacheFrequencyWeight)
+	}
+	if c.CacheMaxOpenFiles < 0 {
+		return fmt.Errorf("invalid cache max open files %d: must not be negative", c.CacheMaxOpenFiles)
+	}
+	if c.CacheShardLevels < 0 || c.CacheShardLevels > 2 {
+		return fmt.Errorf("invalid cache shard levels %d: must be between 0 and 2", c.CacheShardLevels)
+	}
+	switch c.CacheNamespace {
+	case "", CacheNamespacePath:
+	case CacheNamespaceHeader:
+		if c.CacheNamespaceHeader == "" {
+			return fmt.Errorf("cache namespace %q requires a cache namespace header", c.CacheNamespace)
+		}
+	default:
+		return fmt.Errorf("invalid cache namespace %q: must be header or path", c.CacheNamespace)
+	}
+	if c.CacheCompressAfter < 0 {
+		return fmt.Errorf("invalid cache compress after %v: must not be negative", c.CacheCompressAfter)
+	}
+	if c.CacheCompressAfter > 0 && c.CacheJanitorInterval <= 0 {
+		return fmt.Errorf("invalid cache janitor interval %v: must be positive when cache compression is on", c.CacheJanitorInterval)
+	}
+	if c.CacheMaxSourceVersions < 0 {
+		return fmt.Errorf("invalid cache max source versions %d: must not be negative", c.CacheMaxSourceVersions)
+	}
+	if c.CacheMaxSourceVersions > 0 && !c.DedupeSources {
+		return fmt.Errorf("cache max source versions %d requires dedupe sources", c.CacheMaxSourceVersions)
+	}
+	if c.CacheMaxSourceVersions > 0 && c.CacheJanitorInterval <= 0 {
+		return fmt.Errorf("invalid cache janitor interval %v: must be positive when source versions are pruned", c.CacheJanitorInterval)
+	}
+	for _, format := range c.CacheCompressFormats {
+		switch format {
+		case "webp", "png", "jpeg", "jpg":
+		default:
+			return fmt.Errorf("invalid cache compress format %q: must be webp, png, jpeg or jpg", format)
+		}
+	}
+
+	// Validate miss behavior
+	switch c.MissBehavior {
+	case "", MissBehaviorFallback, MissBehaviorNotFound:
+	case MissBehaviorRedirect:
+		if c.PlaceholderURL == "" {
+			return fmt.Errorf("miss behavior %q requires a placeholder URL", c.MissBehavior)
+		}
+	default:
+		return fmt.Errorf("invalid miss behavior %q: must be fallback, notfound or redirect", c.MissBehavior)
+	}
+
+	// Validate maintenance mode
+	if c.MaintenanceImage != "" {
+		if info, err := os.Stat(c.MaintenanceImage); err != nil || info.IsDir() {
+			return fmt.Errorf("invalid maintenance image %q: must be a readable file", c.MaintenanceImage)
+		}
+	}
+	if c.AuditLog != "" {
+		if info, err := os.Stat(filepath.Dir(c.AuditLog)); err != nil || !info.IsDir() {
+			return fmt.Errorf("invalid audit log %q: directory does not exist", c.AuditLog)
+		}
+		if info, err := os.Stat(c.AuditLog); err == nil && info.IsDir() {
+			return fmt.Errorf("invalid audit log %q: must be a file", c.AuditLog)
+		}
+	}
+	for _, hook := range c.Webhooks {
+		if u, err := url.Parse(hook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid webhook URL %q: must be an absolute http or https URL", hook)
+		}
+	}
+	if c.WebhookTimeout < 0 {
+		return fmt.Errorf("invalid webhook timeout %v: must not be negative", c.WebhookTimeout)
+	}
+	if c.WebhookRetries < 0 {
+		return fmt.Errorf("invalid webhook retries %d: must not be negative", c.WebhookRetries)
+	}
+	if c.MaintenanceRetryAfter < 0 {
+		return fmt.Errorf("invalid maintenance retry after %v: must not be negative", c.MaintenanceRetryAfter)
+	}
+
+	// Validate invalid default image behavior
+	switch c.InvalidDefaultImage {
+	case "", InvalidDefaultImagePlaceholder, InvalidDefaultImageError:
+	default:
+		return fmt.Errorf("invalid default image behavior %q: must be placeholder or error", c.InvalidDefaultImage)
+	}
+
+	// Validate empty source behavior
+	switch c.EmptySource {
+	case "", EmptySourceFallback, EmptySourceError:
+	default:
+		return fmt.Errorf("invalid empty source behavior %q: must be fallback or error", c.EmptySource)
+	}
+	switch c.FormatMismatch {
+	case "", FormatMismatchContent, FormatMismatchStrict:
+	default:
+		return fmt.Errorf("invalid format mismatch policy %q: must be content or strict", c.FormatMismatch)
+	}
+	if c.MaxUpscale != 0 && !(c.MaxUpscale >= 1 && c.MaxUpscale <= 100) {
+		return fmt.Errorf("invalid max upscale %g: must be 0 (unlimited) or between 1 and 100", c.MaxUpscale)
+	}
+	if c.StreamOriginalsOver < 0 {
+		return fmt.Errorf("invalid stream originals size %d: must be 0 or more", c.StreamOriginalsOver)
+	}
+	if c.MinSourceSize < 0 {
+		return fmt.Errorf("invalid min source size %d: must be 0 or more", c.MinSourceSize)
+	}
+
+	// Validate path access rules
+	for _, prefix := range slices.Concat(c.AllowPaths, c.DenyPaths) {
+		if slices.Contains(strings.Split(filepath.ToSlash(prefix), "/"), "..") {
+			return fmt.Errorf("invalid path prefix %q: must not contain ..", prefix)
+		}
+	}
+	switch c.DeniedBehavior {
+	case "", DeniedBehaviorForbidden, DeniedBehaviorFallback:
+	default:
+		return fmt.Errorf("invalid denied behavior %q: must be forbidden or fallback", c.DeniedBehavior)
+	}
+
+	// Validate auto quality metric
+	switch c.QualityMetric {
+	case "", "ssim", "heuristic":
+	default:
+		return fmt.Errorf("invalid qauto metric %q: must be ssim or heuristic", c.QualityMetric)
+	}
+
+	// Validate JPEG chroma subsampling
+	switch c.JPEGSubsampling {
+	case "", "444", "422", "420":
+	default:
+		return fmt.Errorf("invalid JPEG subsampling %q: must be 444, 422 or 420", c.JPEGSubsampling)
+	}
+
+	// Validate color space mode
+	switch c.ColorSpace {
+	case "", ColorSpaceSRGB, ColorSpacePreserve:
+	default:
+		return fmt.Errorf("invalid color space %q: must be srgb or preserve", c.ColorSpace)
+	}
+
+	// Validate default output format
+	switch c.DefaultOutputFormat {
+	case "", "webp", "png", "jpeg", "jpg":
+	default:
+		return fmt.Errorf("invalid default output format %q: must be webp, png or jpeg", c.DefaultOutputFormat)
+	}
+
+	if c.ListingTTL < 0 {
+		return fmt.Errorf("invalid listing TTL %v: must not be negative", c.ListingTTL)
+	}
+	if c.ResolverCacheSize < 0 {
+		return fmt.Errorf("invalid resolver cache size %d: must not be negative", c.ResolverCacheSize)
+	}
+	switch c.PathCase {
+	case "", PathCaseSensitive, PathCaseInsensitive:
+	default:
+		return fmt.Errorf("invalid path case %q: must be sensitive or insensitive", c.PathCase)
+	}
+	if c.FallbackCacheTTL < 0 {
+		return fmt.Errorf("invalid fallback cache TTL %v: must not be negative", c.FallbackCacheTTL)
+	}
+
+	if c.SaveDataQuality < 0 || c.SaveDataQuality > 100 {
+		return fmt.Errorf("invalid save-data quality %d: must be between 0 and 100", c.SaveDataQuality)
+	}
+
+	if c.LoadShedAt < 0 {
+		return fmt.Errorf("invalid load shedding threshold %d: must not be negative", c.LoadShedAt)
+	}
+	if c.LoadShedRestore < 0 || c.LoadShedRestore > c.LoadShedAt {
+		return fmt.Errorf("invalid load shedding restore threshold %d: must be between 0 and load-shed-at (%d)", c.LoadShedRestore, c.LoadShedAt)
+	}
+	if c.LoadShedAt > 0 && (c.LoadShedQuality < 1 || c.LoadShedQuality > 100) {
+		return fmt.Errorf("invalid load shedding quality %d: must be between 1 and 100", c.LoadShedQuality)
+	}
+
+	if c.ThumbSize != 0 && (c.ThumbSize < 10 || c.ThumbSize > 4000) {
+		return fmt.Errorf("invalid thumbnail size %d: must be between 10 and 4000", c.ThumbSize)
+	}
+	if c.ClientHints && c.ClientHintsStep < 1 {
+		return fmt.Errorf("invalid client hints step %d: must be at least 1", c.ClientHintsStep)
+	}
+
+	// Validate query param mode
+	switch c.QueryParams {
+	case "", QueryParamsNormalize, QueryParamsStrip:
+	default:
+		return fmt.Errorf("invalid query params mode %q: must be normalize or strip", c.QueryParams)
+	}
+
+	// Validate hash mismatch behavior
+	switch c.HashMismatch {
+	case "", HashMismatchNotFound, HashMismatchRedirect:
+	default:
+		return fmt.Errorf("invalid hash mismatch behavior %q: must be notfound or redirect", c.HashMismatch)
+	}
+
+	// Validate animated GIF mode
+	switch c.AnimatedGIF {
+	case "", AnimatedGIFWebP, AnimatedGIFStatic, AnimatedGIFPassthrough:
+	default:
+		return fmt.Errorf("invalid animated GIF mode %q: must be webp, static or passthrough", c.AnimatedGIF)
+	}
+	if err := validateAllowedFormats("allowed format", c.AllowedFormats); err != nil {
+		return err
+	}
+	for _, rule := range c.PathFormats {
+		prefix, formats, ok := strings.Cut(rule, "=")
+		if !ok || strings.Trim(prefix, "/") == "" {
+			return fmt.Errorf("invalid path format rule %q: must be prefix=format|format", rule)
+		}
+		if err := validateAllowedFormats(fmt.Sprintf("path format rule %q format", rule), strings.Split(formats, "|")); err != nil {
+			return err
+		}
+	}
+	switch c.DisallowedFormat {
+	case "", DisallowedFormatSnap, DisallowedFormatReject:
+	default:
+		return fmt.Errorf("invalid disallowed format behavior %q: must be snap or reject", c.DisallowedFormat)
+	}
+	if strings.ContainsAny(strings.NewReplacer(MetricsLabelGroup, "", MetricsLabelPreset, "", MetricsLabelFormat, "").Replace(c.MetricsLabel), "{}") {
+		return fmt.Errorf("invalid metrics label %q: placeholders must be {group}, {preset} or {format}", c.MetricsLabel)
+	}
+	for _, rule := range c.MetricsPresets {
+		name, preset, ok := strings.Cut(rule, "=")
+		if !ok || name == "" || strings.Trim(preset, "/") == "" {
+			return fmt.Errorf("invalid metrics preset %q: must be name=preset", rule)
+		}
+	}
+	for _, rule := range c.PreloadRenditions {
+		preset, related, ok := strings.Cut(rule, "=")
+		if !ok || strings.Trim(preset, "/") == "" || slices.Contains(strings.Split(related, "|"), "") {
+			return fmt.Errorf("invalid preload rendition rule %q: must be preset=rendition|rendition", rule)
+		}
+	}
+	sources := map[string]bool{}
+	for _, rule := range c.SourceFormatRules {
+		source, output, ok := strings.Cut(rule, "=")
+		switch source {
+		case "jpeg", "png", "webp":
+		default:
+			return fmt.Errorf("invalid source format rule %q: source must be jpeg, png or webp", rule)
+		}
+		switch output {
+		case "jpeg", "png", "webp", SourceFormatPassthrough:
+		default:
+			return fmt.Errorf("invalid source format rule %q: output must be jpeg, png, webp or passthrough", rule)
+		}
+		if !ok || sources[source] {
+			return fmt.Errorf("invalid source format rule %q: one rule per source", rule)
+		}
+		sources[source] = true
+	}
+	for _, rule := range c.ClientFormatRules {
+		client, formats, ok := strings.Cut(rule, "=")
+		if !ok || !validClient(client) {
+			return fmt.Errorf("invalid client format rule %q: must be family=format|format, family<major=format|format or ua:substring=format|format", rule)
+		}
+		if err := validateAllowedFormats(fmt.Sprintf("client format rule %q format", rule), strings.Split(formats, "|")); err != nil {
+			return err
+		}
+	}
+
+	// Validate range mode
+	switch c.RangeRequests {
+	case "", RangeOriginals, RangeTransformed, RangeAll, RangeNone:
+	default:
+		return fmt.Errorf("invalid range mode %q: must be originals, transformed, all or none", c.RangeRequests)
+	}
+
+	switch c.CropBounds {
+	case "", CropBoundsClamp, CropBoundsReject:
+	default:
+		return fmt.Errorf("invalid crop bounds mode %q: must be clamp or reject", c.CropBounds)
+	}
+	if c.TrimThreshold < 0 || c.TrimThreshold > 255 {
+		return fmt.Errorf("invalid trim threshold %d: must be between 0 and 255", c.TrimThreshold)
+	}
+
+	switch c.LogFormat {
+	case "", LogFormatJSON, LogFormatText:
+	default:
+		return fmt.Errorf("invalid log format %q: must be json or text", c.LogFormat)
+	}
+	switch c.LogLevel {
+	case "", LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError:
+	default:
+		return fmt.Errorf("invalid log level %q: must be debug, info, warn or error", c.LogLevel)
+	}
+
+	if err := c.validateTLS(); err != nil {
+		return err
+	}
+
 	// Ensure directories exist, create if missing
 	if err := os.MkdirAll(c.ImagesDir, 0755); err != nil {
 		return fmt.Errorf("failed to create images directory: %w", err)
@@ -58,8 +976,132 @@ func (c *Config) Validate() error {
 	return nil
 }
 
-// DumpSettings writes current configuration to a file
+// validateTLS checks the HTTPS settings
+func (c *Config) validateTLS() error {
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return fmt.Errorf("tls cert and tls key must be set together")
+	}
+	for _, file := range []string{c.TLSCert, c.TLSKey} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			return fmt.Errorf("tls file %q is not readable: %w", file, err)
+		}
+	}
+
+	switch c.TLSMinVersion {
+	case "", TLSVersion12, TLSVersion13:
+	default:
+		return fmt.Errorf("invalid tls min version %q: must be 1.2 or 1.3", c.TLSMinVersion)
+	}
+
+	if c.HTTPRedirectPort != 0 {
+		if !c.TLSEnabled() {
+			return fmt.Errorf("http redirect port requires tls cert and tls key")
+		}
+		if c.HTTPRedirectPort < 1 || c.HTTPRedirectPort > 65535 || c.HTTPRedirectPort == c.Port {
+			return fmt.Errorf("invalid http redirect port %d: must be between 1 and 65535 and differ from the server port", c.HTTPRedirectPort)
+		}
+	}
+
+	return nil
+}
+
+// TLSEnabled reports whether HTTPS is configured
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCert != "" && c.TLSKey != ""
+}
+
+// MinTLSVersion returns the crypto/tls constant for TLSMinVersion
+func (c *Config) MinTLSVersion() uint16 {
+	if c.TLSMinVersion == TLSVersion13 {
+		return tls.VersionTLS13
+	}
+	return tls.VersionTLS12
+}
+
+// validateAllowedFormats checks a list of allowed output formats, which
+// must name a format that can be encoded for disallowed requests to snap to
+func validateAllowedFormats(name string, formats []string) error {
+	encodable := len(formats) == 0
+	for _, format := range formats {
+		switch format {
+		case "webp", "png", "jpeg", "jpg":
+			encodable = true
+		case "gif", "pdf":
+		default:
+			return fmt.Errorf("invalid %s %q: must be webp, png, jpeg, jpg, gif or pdf", name, format)
+		}
+	}
+	if !encodable {
+		return fmt.Errorf("invalid %s: must include webp, png, jpeg or jpg", name)
+	}
+	return nil
+}
+
+// ClientFamilies are the User-Agent families client format rules can name
+var ClientFamilies = []string{"safari", "ie", "edge", "firefox", "chrome"}
+
+// validClient checks the client of a client format rule
+func validClient(client string) bool {
+	if substring, ok := strings.CutPrefix(client, "ua:"); ok {
+		return substring != ""
+	}
+	family, bound, ok := strings.Cut(client, "<")
+	if ok {
+		if major, err := strconv.Atoi(bound); err != nil || major < 1 {
+			return false
+		}
+	}
+	return slices.Contains(ClientFamilies, family)
+}
+
+// ClientFormats returns the output formats allowed for a client of the
+// given User-Agent family and major version, nil when no rule applies
+func (c *Config) ClientFormats(userAgent, family string, major int) []string {
+	for _, rule := range c.ClientFormatRules {
+		client, formats, _ := strings.Cut(rule, "=")
+		if substring, ok := strings.CutPrefix(client, "ua:"); ok {
+			if strings.Contains(userAgent, substring) {
+				return strings.Split(formats, "|")
+			}
+			continue
+		}
+		name, bound, limited := strings.Cut(client, "<")
+		if name != family {
+			continue
+		}
+		if below, err := strconv.Atoi(bound); limited && (err != nil || major >= below) {
+			continue
+		}
+		return strings.Split(formats, "|")
+	}
+	return nil
+}
+
+// SourceFormat returns the output format for a source of the given format
+// requested without a format, "" when no rule applies
+func (c *Config) SourceFormat(source string) string {
+	for _, rule := range c.SourceFormatRules {
+		if from, output, _ := strings.Cut(rule, "="); from == source {
+			if output == SourceFormatPassthrough {
+				return source
+			}
+			return output
+		}
+	}
+	return ""
+}
+
+// DumpSettings writes current configuration to a file. Files named .yaml,
+// .yml or .json are written as settings files for --config, others as the
+// summary String returns.
 func (c *Config) DumpSettings(filename string) error {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml", ".json":
+		return c.dumpFile(filename)
+	}
 	content := c.String()
 	return os.WriteFile(filename, []byte(content), 0644)
 }
@@ -70,11 +1112,168 @@ func (c *Config) String() string {
 	sb.WriteString(fmt.Sprintf("Port: %d\n", c.Port))
 	sb.WriteString(fmt.Sprintf("ImagesDir: %s\n", c.ImagesDir))
 	sb.WriteString(fmt.Sprintf("CacheDir: %s\n", c.CacheDir))
+	if c.Archive != "" {
+		sb.WriteString(fmt.Sprintf("Archive: %s\n", c.Archive))
+	}
 	sb.WriteString(fmt.Sprintf("Dump: %v\n", c.Dump))
+	sb.WriteString(fmt.Sprintf("SelfTest: %v\n", c.SelfTest))
 	if c.DefaultImagePath != "" {
 		sb.WriteString(fmt.Sprintf("DefaultImagePath: %s\n", c.DefaultImagePath))
 	}
 	sb.WriteString(fmt.Sprintf("PreCacheEnabled: %v\n", c.PreCacheEnabled))
 	sb.WriteString(fmt.Sprintf("PreCacheWorkers: %d\n", c.PreCacheWorkers))
+	sb.WriteString(fmt.Sprintf("PreCacheRate: %v\n", c.PreCacheRate))
+	sb.WriteString(fmt.Sprintf("MaxSourcePixels: %d\n", c.MaxSourcePixels))
+	if c.EnableUploads {
+		sb.WriteString(fmt.Sprintf("Uploads: overwrite=%v warm=%s\n", c.UploadOverwrite, strings.Join(c.UploadWarm, ",")))
+	}
+	sb.WriteString(fmt.Sprintf("MaxVariantsPerFile: %d\n", c.MaxVariantsPerFile))
+	sb.WriteString(fmt.Sprintf("MaxTotalVariants: %d\n", c.MaxTotalVariants))
+	sb.WriteString(fmt.Sprintf("CacheFrequencyWeight: %v\n", c.CacheFrequencyWeight))
+	sb.WriteString(fmt.Sprintf("CacheShardLevels: %d\n", c.CacheShardLevels))
+	if c.DedupeSources {
+		sb.WriteString("DedupeSources: true\n")
+	}
+	if c.CacheMaxSourceVersions > 0 {
+		sb.WriteString(fmt.Sprintf("CacheMaxSourceVersions: %d\n", c.CacheMaxSourceVersions))
+	}
+	sb.WriteString(fmt.Sprintf("CacheMaxOpenFiles: %d\n", c.CacheMaxOpenFiles))
+	if c.CacheNamespace == CacheNamespaceHeader {
+		sb.WriteString(fmt.Sprintf("CacheNamespace: header %s\n", c.CacheNamespaceHeader))
+	} else if c.CacheNamespace != "" {
+		sb.WriteString(fmt.Sprintf("CacheNamespace: %s\n", c.CacheNamespace))
+	}
+	if c.CacheCompressAfter > 0 {
+		sb.WriteString(fmt.Sprintf("CacheCompressAfter: %v\n", c.CacheCompressAfter))
+		sb.WriteString(fmt.Sprintf("CacheCompressFormats: %s\n", strings.Join(c.CacheCompressFormats, ",")))
+		sb.WriteString(fmt.Sprintf("CacheJanitorInterval: %v\n", c.CacheJanitorInterval))
+	}
+	sb.WriteString(fmt.Sprintf("ServeSmallerOriginal: %v\n", c.ServeSmallerOriginal))
+	sb.WriteString(fmt.Sprintf("MaxUpscale: %g\n", c.MaxUpscale))
+	sb.WriteString(fmt.Sprintf("StreamOriginalsOver: %d\n", c.StreamOriginalsOver))
+	sb.WriteString(fmt.Sprintf("PanicFallback: %v\n", c.PanicFallback))
+	if c.InvalidDefaultImage != "" {
+		sb.WriteString(fmt.Sprintf("InvalidDefaultImage: %s\n", c.InvalidDefaultImage))
+	}
+	sb.WriteString(fmt.Sprintf("FallbackCacheTTL: %v\n", c.FallbackCacheTTL))
+	sb.WriteString(fmt.Sprintf("ListingTTL: %v\n", c.ListingTTL))
+	sb.WriteString(fmt.Sprintf("ResolverCacheSize: %d\n", c.ResolverCacheSize))
+	if c.PathCase != "" {
+		sb.WriteString(fmt.Sprintf("PathCase: %s\n", c.PathCase))
+	}
+	sb.WriteString(fmt.Sprintf("HonorNoCache: %v\n", c.HonorNoCache))
+	sb.WriteString(fmt.Sprintf("GroupPlaceholder: %v\n", c.GroupPlaceholder))
+	sb.WriteString(fmt.Sprintf("GroupIndex: %v\n", c.GroupIndex))
+	sb.WriteString(fmt.Sprintf("ThumbSize: %d\n", c.ThumbSize))
+	if c.MissBehavior != "" {
+		sb.WriteString(fmt.Sprintf("MissBehavior: %s\n", c.MissBehavior))
+	}
+	if c.PlaceholderURL != "" {
+		sb.WriteString(fmt.Sprintf("PlaceholderURL: %s\n", c.PlaceholderURL))
+	}
+	if c.MaintenanceImage != "" {
+		sb.WriteString(fmt.Sprintf("MaintenanceImage: %s\n", c.MaintenanceImage))
+	}
+	if c.EmptySource != "" {
+		sb.WriteString(fmt.Sprintf("EmptySource: %s\n", c.EmptySource))
+	}
+	sb.WriteString(fmt.Sprintf("MinSourceSize: %d\n", c.MinSourceSize))
+	if c.FormatMismatch != "" {
+		sb.WriteString(fmt.Sprintf("FormatMismatch: %s\n", c.FormatMismatch))
+	}
+	if len(c.AllowPaths) > 0 {
+		sb.WriteString(fmt.Sprintf("AllowPaths: %s\n", strings.Join(c.AllowPaths, ",")))
+	}
+	if len(c.DenyPaths) > 0 {
+		sb.WriteString(fmt.Sprintf("DenyPaths: %s\n", strings.Join(c.DenyPaths, ",")))
+	}
+	if c.DeniedBehavior != "" {
+		sb.WriteString(fmt.Sprintf("DeniedBehavior: %s\n", c.DeniedBehavior))
+	}
+	if c.QualityMetric != "" {
+		sb.WriteString(fmt.Sprintf("QualityMetric: %s\n", c.QualityMetric))
+	}
+	if c.JPEGSubsampling != "" {
+		sb.WriteString(fmt.Sprintf("JPEGSubsampling: %s\n", c.JPEGSubsampling))
+	}
+	if c.ColorSpace != "" {
+		sb.WriteString(fmt.Sprintf("ColorSpace: %s\n", c.ColorSpace))
+	}
+	sb.WriteString(fmt.Sprintf("EmbedICC: %v\n", c.EmbedICC))
+	sb.WriteString(fmt.Sprintf("Progressive: %v\n", c.Progressive))
+	sb.WriteString(fmt.Sprintf("Sidecars: %v\n", c.Sidecars))
+	if c.DefaultOutputFormat != "" {
+		sb.WriteString(fmt.Sprintf("DefaultOutputFormat: %s\n", c.DefaultOutputFormat))
+	}
+	if c.SaveDataQuality > 0 {
+		sb.WriteString(fmt.Sprintf("SaveDataQuality: %d\n", c.SaveDataQuality))
+	}
+	if c.LoadShedAt > 0 {
+		sb.WriteString(fmt.Sprintf("LoadShed: at=%d restore=%d quality=%d\n", c.LoadShedAt, c.LoadShedRestore, c.LoadShedQuality))
+	}
+	if c.ClientHints {
+		sb.WriteString(fmt.Sprintf("ClientHints: step=%d\n", c.ClientHintsStep))
+	}
+	sb.WriteString(fmt.Sprintf("SlowRequestThreshold: %v\n", c.SlowRequestThreshold))
+	if c.QueryParams != "" {
+		sb.WriteString(fmt.Sprintf("QueryParams: %s\n", c.QueryParams))
+	}
+	if c.HashMismatch != "" {
+		sb.WriteString(fmt.Sprintf("HashMismatch: %s\n", c.HashMismatch))
+	}
+	if c.AnimatedGIF != "" {
+		sb.WriteString(fmt.Sprintf("AnimatedGIF: %s\n", c.AnimatedGIF))
+	}
+	if len(c.AllowedFormats) > 0 || len(c.PathFormats) > 0 {
+		sb.WriteString(fmt.Sprintf("AllowedFormats: %s paths=%s disallowed=%s\n", strings.Join(c.AllowedFormats, ","), strings.Join(c.PathFormats, ","), c.DisallowedFormat))
+	}
+	sb.WriteString(fmt.Sprintf("MetricsLabel: %s\n", c.MetricsLabel))
+	if len(c.MetricsPresets) > 0 {
+		sb.WriteString(fmt.Sprintf("MetricsPresets: %s\n", strings.Join(c.MetricsPresets, ",")))
+	}
+	if len(c.PreloadRenditions) > 0 {
+		sb.WriteString(fmt.Sprintf("PreloadRenditions: %s\n", strings.Join(c.PreloadRenditions, ",")))
+	}
+	if len(c.ClientFormatRules) > 0 {
+		sb.WriteString(fmt.Sprintf("ClientFormatRules: %s\n", strings.Join(c.ClientFormatRules, ",")))
+	}
+	if len(c.SourceFormatRules) > 0 {
+		sb.WriteString(fmt.Sprintf("SourceFormatRules: %s\n", strings.Join(c.SourceFormatRules, ",")))
+	}
+	if c.RangeRequests != "" {
+		sb.WriteString(fmt.Sprintf("RangeRequests: %s\n", c.RangeRequests))
+	}
+	if c.CropBounds != "" {
+		sb.WriteString(fmt.Sprintf("CropBounds: %s\n", c.CropBounds))
+	}
+	sb.WriteString(fmt.Sprintf("TrimThreshold: %d\n", c.TrimThreshold))
+	if c.BasePath != "" {
+		sb.WriteString(fmt.Sprintf("BasePath: %s\n", c.BasePath))
+	}
+	sb.WriteString(fmt.Sprintf("IdleTimeout: %v\n", c.IdleTimeout))
+	sb.WriteString(fmt.Sprintf("MaxHeaderBytes: %d\n", c.MaxHeaderBytes))
+	sb.WriteString(fmt.Sprintf("ReadHeaderTimeout: %v\n", c.ReadHeaderTimeout))
+	sb.WriteString(fmt.Sprintf("ReadTimeout: %v\n", c.ReadTimeout))
+	sb.WriteString(fmt.Sprintf("MaxBodyBytes: %d\n", c.MaxBodyBytes))
+	sb.WriteString(fmt.Sprintf("EnableHTTP2: %v\n", c.EnableHTTP2))
+	sb.WriteString(fmt.Sprintf("Timeouts: health=%v image=%v command=%v\n", c.HealthTimeout, c.ImageTimeout, c.CommandTimeout))
+	sb.WriteString(fmt.Sprintf("TLS: %v\n", c.TLSEnabled()))
+	if c.TLSEnabled() {
+		sb.WriteString(fmt.Sprintf("TLSCert: %s\n", c.TLSCert))
+		sb.WriteString(fmt.Sprintf("TLSMinVersion: %s\n", c.TLSMinVersion))
+		sb.WriteString(fmt.Sprintf("HTTPRedirectPort: %d\n", c.HTTPRedirectPort))
+	}
+	sb.WriteString(fmt.Sprintf("CommandAuth: %v\n", c.CommandAPIKey != ""))
+	sb.WriteString(fmt.Sprintf("Captions: %v\n", c.CaptionSecret != ""))
+	if c.AuditLog != "" {
+		sb.WriteString(fmt.Sprintf("AuditLog: %s\n", c.AuditLog))
+	}
+	if len(c.Webhooks) > 0 {
+		// URLs may carry tokens; only their number is shown
+		sb.WriteString(fmt.Sprintf("Webhooks: %d timeout=%v retries=%d\n", len(c.Webhooks), c.WebhookTimeout, c.WebhookRetries))
+	}
+	sb.WriteString(fmt.Sprintf("GitQueue: %d timeout=%v\n", c.GitQueue, c.GitQueueTimeout))
+	sb.WriteString(fmt.Sprintf("Logging: format=%s level=%s\n", c.LogFormat, c.LogLevel))
+	sb.WriteString(fmt.Sprintf("Production: %v\n", c.Production))
 	return sb.String()
 }
@@ -1,10 +1,16 @@
 package config
 
 import (
+	"crypto/tls"
+	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 )
 
 // Test default values when no arguments are provided
@@ -87,6 +93,23 @@ func Test_ParseArgs_DumpFlag(t *testing.T) {
 	}
 }
 
+// Test selftest flag parsing
+func Test_ParseArgs_SelfTestFlag(t *testing.T) {
+	// Arrange
+	args := []string{"--selftest"}
+
+	// Act
+	cfg, err := ParseArgs(args)
+
+	// Assert
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if !cfg.SelfTest {
+		t.Error("Expected selftest to be true")
+	}
+}
+
 // Test port validation with valid range
 func Test_ValidatePort_ValidRange(t *testing.T) {
 	tests := []struct {
@@ -296,6 +319,1695 @@ func Test_String_WithDefaultImagePath(t *testing.T) {
 	}
 }
 
+// Test serve-smaller-original flag defaults to enabled and can be disabled
+func Test_ParseArgs_ServeSmallerOriginal(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if !cfg.ServeSmallerOriginal {
+		t.Error("Expected serve-smaller-original to be true by default")
+	}
+
+	cfg, err = ParseArgs([]string{"--serve-smaller-original=false"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.ServeSmallerOriginal {
+		t.Error("Expected serve-smaller-original to be false")
+	}
+}
+
+// Test panic-fallback flag defaults to enabled and can be disabled
+func Test_ParseArgs_PanicFallback(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if !cfg.PanicFallback {
+		t.Error("Expected panic-fallback to be true by default")
+	}
+
+	cfg, err = ParseArgs([]string{"--panic-fallback=false"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.PanicFallback {
+		t.Error("Expected panic-fallback to be false")
+	}
+}
+
+// Test group-index flag defaults to disabled
+func Test_ParseArgs_GroupIndex(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.GroupIndex {
+		t.Error("Expected group-index to be false by default")
+	}
+
+	cfg, err = ParseArgs([]string{"--group-index"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if !cfg.GroupIndex {
+		t.Error("Expected group-index to be true")
+	}
+}
+
+// Test thumb-size flag parsing and validation
+func Test_ParseArgs_ThumbSize(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.ThumbSize != 150 {
+		t.Errorf("Expected 150px thumbnails by default, got %d", cfg.ThumbSize)
+	}
+
+	cfg, err = ParseArgs([]string{"--thumb-size", "200"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.ThumbSize != 200 {
+		t.Errorf("Expected thumb size 200, got %d", cfg.ThumbSize)
+	}
+
+	for _, size := range []int{-1, 9, 4001} {
+		cfg.ThumbSize = size
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected error for thumb size %d", size)
+		}
+	}
+}
+
+// Test honor-no-cache flag defaults to disabled
+func Test_ParseArgs_HonorNoCache(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.HonorNoCache {
+		t.Error("Expected honor-no-cache to be false by default")
+	}
+
+	cfg, err = ParseArgs([]string{"--honor-no-cache"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if !cfg.HonorNoCache {
+		t.Error("Expected honor-no-cache to be true")
+	}
+}
+
+// Test save-data quality flag parsing and validation
+func Test_ParseArgs_SaveDataQuality(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.SaveDataQuality != 0 {
+		t.Errorf("Expected the Save-Data hint to be ignored by default, got quality %d", cfg.SaveDataQuality)
+	}
+
+	cfg, err = ParseArgs([]string{"--save-data-quality", "40"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.SaveDataQuality != 40 {
+		t.Errorf("Expected save-data quality 40, got %d", cfg.SaveDataQuality)
+	}
+
+	cfg.SaveDataQuality = 101
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for save-data quality above 100")
+	}
+}
+
+// Test load shedding flag parsing and validation
+func Test_ParseArgs_LoadShed(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.LoadShedAt != 0 || cfg.LoadShedQuality != 60 {
+		t.Errorf("Expected load shedding off with quality 60 by default, got at %d quality %d", cfg.LoadShedAt, cfg.LoadShedQuality)
+	}
+
+	cfg, err = ParseArgs([]string{"--load-shed-at", "8", "--load-shed-restore", "4", "--load-shed-quality", "50"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.LoadShedAt != 8 || cfg.LoadShedRestore != 4 || cfg.LoadShedQuality != 50 {
+		t.Errorf("Expected load shedding at 8, restore 4, quality 50, got %d, %d, %d", cfg.LoadShedAt, cfg.LoadShedRestore, cfg.LoadShedQuality)
+	}
+
+	tests := []struct {
+		at, restore, quality int
+		valid                bool
+	}{
+		{0, 0, 60, true},
+		{0, 0, 0, true},
+		{8, 8, 60, true},
+		{-1, 0, 60, false},
+		{8, 9, 60, false},
+		{8, -1, 60, false},
+		{8, 4, 0, false},
+		{8, 4, 101, false},
+	}
+	for _, tt := range tests {
+		cfg.LoadShedAt, cfg.LoadShedRestore, cfg.LoadShedQuality = tt.at, tt.restore, tt.quality
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with load shedding at %d, restore %d, quality %d: error %v, expected valid %v", tt.at, tt.restore, tt.quality, err, tt.valid)
+		}
+	}
+}
+
+// Test client hints flag parsing and validation
+func Test_ParseArgs_ClientHints(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.ClientHints || cfg.ClientHintsStep != 100 {
+		t.Errorf("Expected client hints off with step 100 by default, got %v step %d", cfg.ClientHints, cfg.ClientHintsStep)
+	}
+
+	cfg, err = ParseArgs([]string{"--client-hints", "--client-hints-step", "50"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if !cfg.ClientHints || cfg.ClientHintsStep != 50 {
+		t.Errorf("Expected client hints with step 50, got %v step %d", cfg.ClientHints, cfg.ClientHintsStep)
+	}
+
+	cfg.ClientHintsStep = 0
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for a client hints step of 0")
+	}
+}
+
+// Test fallback cache TTL flag parsing and validation
+func Test_ParseArgs_FallbackCacheTTL(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.FallbackCacheTTL != time.Minute {
+		t.Errorf("Expected fallback cache TTL 1m by default, got %v", cfg.FallbackCacheTTL)
+	}
+
+	cfg, err = ParseArgs([]string{"--fallback-cache-ttl", "10s"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.FallbackCacheTTL != 10*time.Second {
+		t.Errorf("Expected fallback cache TTL 10s, got %v", cfg.FallbackCacheTTL)
+	}
+
+	cfg.FallbackCacheTTL = -time.Second
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for a negative fallback cache TTL")
+	}
+}
+
+// Test listing TTL flag parsing and validation
+func Test_ParseArgs_ListingTTL(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.ListingTTL != time.Second {
+		t.Errorf("Expected listing TTL 1s by default, got %v", cfg.ListingTTL)
+	}
+
+	cfg, err = ParseArgs([]string{"--listing-ttl", "0"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.ListingTTL != 0 {
+		t.Errorf("Expected listing TTL 0, got %v", cfg.ListingTTL)
+	}
+
+	cfg.ListingTTL = -time.Second
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for a negative listing TTL")
+	}
+}
+
+// Test resolver cache size flag parsing and validation
+func Test_ParseArgs_ResolverCacheSize(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.ResolverCacheSize != 100000 {
+		t.Errorf("Expected resolver cache size 100000 by default, got %d", cfg.ResolverCacheSize)
+	}
+
+	cfg, err = ParseArgs([]string{"--resolver-cache-size", "0"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.ResolverCacheSize != 0 {
+		t.Errorf("Expected resolver cache size 0, got %d", cfg.ResolverCacheSize)
+	}
+
+	cfg.ResolverCacheSize = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for a negative resolver cache size")
+	}
+}
+
+// Test path case flag parsing and validation
+func Test_ParseArgs_PathCase(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if runtime.GOOS == "linux" && cfg.PathCase != PathCaseSensitive {
+		t.Errorf("Expected case-sensitive paths by default on Linux, got %q", cfg.PathCase)
+	}
+
+	cfg, err = ParseArgs([]string{"--path-case", "insensitive"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.PathCase != PathCaseInsensitive {
+		t.Errorf("Expected path case insensitive, got %q", cfg.PathCase)
+	}
+
+	cfg.PathCase = "lower"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for an invalid path case")
+	}
+}
+
+// Test max upscale flag parsing and validation
+func Test_ParseArgs_MaxUpscale(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.MaxUpscale != 0 {
+		t.Errorf("Expected unlimited upscaling by default, got %g", cfg.MaxUpscale)
+	}
+
+	cfg, err = ParseArgs([]string{"--max-upscale", "2.5"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.MaxUpscale != 2.5 {
+		t.Errorf("Expected max upscale 2.5, got %g", cfg.MaxUpscale)
+	}
+
+	for _, value := range []float64{-1, 0.5, 101, math.NaN()} {
+		cfg.MaxUpscale = value
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected max upscale %g to be rejected", value)
+		}
+	}
+}
+
+// Test streaming size flag parsing and validation
+func Test_ParseArgs_StreamOriginalsOver(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.StreamOriginalsOver != 8<<20 {
+		t.Errorf("Expected originals streamed from 8MB by default, got %d", cfg.StreamOriginalsOver)
+	}
+
+	cfg, err = ParseArgs([]string{"--stream-originals-over", "0"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.StreamOriginalsOver != 0 {
+		t.Errorf("Expected streaming off, got %d", cfg.StreamOriginalsOver)
+	}
+
+	cfg.StreamOriginalsOver = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for a negative stream size")
+	}
+}
+
+// Test pre-cache rate flag parsing and validation
+func Test_ParseArgs_PreCacheRate(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--precache-rate", "2.5"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.PreCacheRate != 2.5 {
+		t.Errorf("Expected pre-cache rate 2.5, got %v", cfg.PreCacheRate)
+	}
+
+	cfg.PreCacheRate = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for negative pre-cache rate")
+	}
+}
+
+// Test HTTP server tuning flags
+func Test_ParseArgs_ServerTuning(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--idle-timeout", "45s", "--max-header-bytes", "8192", "--http2"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.IdleTimeout != 45*time.Second {
+		t.Errorf("Expected idle timeout 45s, got %v", cfg.IdleTimeout)
+	}
+	if cfg.MaxHeaderBytes != 8192 {
+		t.Errorf("Expected max header bytes 8192, got %d", cfg.MaxHeaderBytes)
+	}
+	if !cfg.EnableHTTP2 {
+		t.Error("Expected http2 to be enabled")
+	}
+}
+
+// Test logging flags default to JSON at info level
+func Test_ParseArgs_Logging(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.LogFormat != LogFormatJSON || cfg.LogLevel != LogLevelInfo {
+		t.Errorf("Expected json/info logging by default, got %s/%s", cfg.LogFormat, cfg.LogLevel)
+	}
+
+	tests := []struct {
+		args  []string
+		valid bool
+	}{
+		{[]string{"--log-format", "text", "--log-level", "debug"}, true},
+		{[]string{"--log-level", "error"}, true},
+		{[]string{"--log-format", "xml"}, false},
+		{[]string{"--log-level", "verbose"}, false},
+	}
+	for _, tt := range tests {
+		cfg, err := ParseArgs(append(tt.args, "--imagesdir", t.TempDir(), "--cachedir", t.TempDir()))
+		if err != nil {
+			t.Fatalf("ParseArgs(%v) returned error: %v", tt.args, err)
+		}
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with %v: error = %v, expected valid %v", tt.args, err, tt.valid)
+		}
+	}
+}
+
+// Test the crop bounds flag
+func Test_ParseArgs_CropBounds(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.CropBounds != CropBoundsClamp {
+		t.Errorf("Expected clamp by default, got %q", cfg.CropBounds)
+	}
+
+	for _, tt := range []struct {
+		value string
+		valid bool
+	}{
+		{CropBoundsClamp, true},
+		{CropBoundsReject, true},
+		{"ignore", false},
+	} {
+		cfg, err := ParseArgs([]string{"--crop-bounds", tt.value, "--imagesdir", t.TempDir(), "--cachedir", t.TempDir()})
+		if err != nil {
+			t.Fatalf("ParseArgs() returned error: %v", err)
+		}
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with %q: error = %v, expected valid %v", tt.value, err, tt.valid)
+		}
+	}
+}
+
+// Test the range requests flag
+func Test_ParseArgs_RangeRequests(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.RangeRequests != RangeOriginals {
+		t.Errorf("Expected originals by default, got %q", cfg.RangeRequests)
+	}
+
+	for _, tt := range []struct {
+		value string
+		valid bool
+	}{
+		{RangeOriginals, true},
+		{RangeTransformed, true},
+		{RangeAll, true},
+		{RangeNone, true},
+		{"bytes", false},
+	} {
+		cfg, err := ParseArgs([]string{"--range-requests", tt.value, "--imagesdir", t.TempDir(), "--cachedir", t.TempDir()})
+		if err != nil {
+			t.Fatalf("ParseArgs() returned error: %v", err)
+		}
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with %q: error = %v, expected valid %v", tt.value, err, tt.valid)
+		}
+	}
+}
+
+// Test the allowed output format flags
+func Test_ParseArgs_AllowedFormats(t *testing.T) {
+	for _, tt := range []struct {
+		args  []string
+		valid bool
+	}{
+		{[]string{"--allowed-formats", "webp,jpeg"}, true},
+		{[]string{"--allowed-formats", "jpeg,gif", "--disallowed-format", "reject"}, true},
+		{[]string{"--path-formats", "partners=png|jpeg,partners/internal=webp"}, true},
+		{[]string{"--allowed-formats", "avif"}, false},
+		{[]string{"--allowed-formats", "webp,pdf"}, true},
+		{[]string{"--allowed-formats", "gif"}, false},
+		{[]string{"--allowed-formats", "pdf"}, false},
+		{[]string{"--path-formats", "partners"}, false},
+		{[]string{"--path-formats", "=png"}, false},
+		{[]string{"--path-formats", "partners=bmp"}, false},
+		{[]string{"--disallowed-format", "ignore"}, false},
+	} {
+		cfg, err := ParseArgs(append(tt.args, "--imagesdir", t.TempDir(), "--cachedir", t.TempDir()))
+		if err != nil {
+			t.Fatalf("ParseArgs() returned error: %v", err)
+		}
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with %v: error = %v, expected valid %v", tt.args, err, tt.valid)
+		}
+	}
+}
+
+// Test the preload renditions flag
+func Test_ParseArgs_PreloadRenditions(t *testing.T) {
+	for _, tt := range []struct {
+		value string
+		valid bool
+	}{
+		{"1600x900/webp=800x450/webp|400x225/webp", true},
+		{"1600x900/webp=800x450/webp,300x300=150x150", true},
+		{"1600x900/webp", false},
+		{"=800x450/webp", false},
+		{"1600x900/webp=", false},
+		{"1600x900/webp=800x450/webp||400x225/webp", false},
+	} {
+		cfg, err := ParseArgs([]string{"--preload-renditions", tt.value, "--imagesdir", t.TempDir(), "--cachedir", t.TempDir()})
+		if err != nil {
+			t.Fatalf("ParseArgs() returned error: %v", err)
+		}
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with %q: error = %v, expected valid %v", tt.value, err, tt.valid)
+		}
+	}
+}
+
+// Test the metrics label template and presets flags
+func Test_ParseArgs_MetricsLabel(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.MetricsLabel != MetricsLabelGroup {
+		t.Errorf("Expected metrics labeled by group by default, got %q", cfg.MetricsLabel)
+	}
+
+	for _, tt := range []struct {
+		label   string
+		presets string
+		valid   bool
+	}{
+		{"", "", true},
+		{"{group}/{preset}", "thumb=200x200/webp,hero=1600x900/webp", true},
+		{"img-{format}", "", true},
+		{"{path}", "", false},
+		{"{group", "", false},
+		{"{group}", "200x200/webp", false},
+		{"{group}", "=200x200/webp", false},
+		{"{group}", "thumb=", false},
+	} {
+		args := []string{"--metrics-label", tt.label, "--imagesdir", t.TempDir(), "--cachedir", t.TempDir()}
+		if tt.presets != "" {
+			args = append(args, "--metrics-presets", tt.presets)
+		}
+		cfg, err := ParseArgs(args)
+		if err != nil {
+			t.Fatalf("ParseArgs() returned error: %v", err)
+		}
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with %q and %q: error = %v, expected valid %v", tt.label, tt.presets, err, tt.valid)
+		}
+	}
+}
+
+// Test the source format rules flag
+func Test_ParseArgs_SourceFormatRules(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--source-format-rules", "png=webp,jpeg=passthrough"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	for source, expected := range map[string]string{"png": "webp", "jpeg": "jpeg", "webp": ""} {
+		if got := cfg.SourceFormat(source); got != expected {
+			t.Errorf("SourceFormat(%q) = %q, expected %q", source, got, expected)
+		}
+	}
+
+	for _, tt := range []struct {
+		value string
+		valid bool
+	}{
+		{"png=webp", true},
+		{"webp=png,jpeg=passthrough", true},
+		{"gif=webp", false},
+		{"png=avif", false},
+		{"png", false},
+		{"png=webp,png=jpeg", false},
+	} {
+		cfg, err := ParseArgs([]string{"--source-format-rules", tt.value, "--imagesdir", t.TempDir(), "--cachedir", t.TempDir()})
+		if err != nil {
+			t.Fatalf("ParseArgs() returned error: %v", err)
+		}
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with %q: error = %v, expected valid %v", tt.value, err, tt.valid)
+		}
+	}
+}
+
+// Test the client format rules, their defaults and matching
+func Test_ParseArgs_ClientFormatRules(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if !slices.Equal(cfg.ClientFormatRules, []string{"safari<14=jpeg|png", "ie=jpeg|png"}) {
+		t.Errorf("Unexpected default client format rules: %v", cfg.ClientFormatRules)
+	}
+	for _, tt := range []struct {
+		userAgent string
+		family    string
+		major     int
+		expected  []string
+	}{
+		{"", "safari", 13, []string{"jpeg", "png"}},
+		{"", "safari", 14, nil},
+		{"", "ie", 11, []string{"jpeg", "png"}},
+		{"", "chrome", 50, nil},
+		{"", "", 0, nil},
+	} {
+		if got := cfg.ClientFormats(tt.userAgent, tt.family, tt.major); !slices.Equal(got, tt.expected) {
+			t.Errorf("ClientFormats(%q, %d) = %v, expected %v", tt.family, tt.major, got, tt.expected)
+		}
+	}
+
+	cfg, err = ParseArgs([]string{"--client-formats", "ua:LegacyApp/=png,safari=webp|jpeg"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if got := cfg.ClientFormats("LegacyApp/2.1 Safari/605", "safari", 13); !slices.Equal(got, []string{"png"}) {
+		t.Errorf("Expected the User-Agent rule to win, got %v", got)
+	}
+	if got := cfg.ClientFormats("", "safari", 17); !slices.Equal(got, []string{"webp", "jpeg"}) {
+		t.Errorf("Expected the unbounded family rule to match, got %v", got)
+	}
+	cfg, err = ParseArgs([]string{"--client-formats", ""})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if len(cfg.ClientFormatRules) != 0 {
+		t.Errorf("Expected no client format rules, got %v", cfg.ClientFormatRules)
+	}
+
+	for _, tt := range []struct {
+		value string
+		valid bool
+	}{
+		{"safari<14=jpeg|png,ie=jpeg", true},
+		{"ua:Trident/=png", true},
+		{"firefox=webp", true},
+		{"opera=jpeg", false},
+		{"safari<0=jpeg", false},
+		{"safari<x=jpeg", false},
+		{"ua:=jpeg", false},
+		{"safari<14=avif", false},
+		{"safari<14=gif", false},
+		{"safari<14", false},
+	} {
+		cfg, err := ParseArgs([]string{"--client-formats", tt.value, "--imagesdir", t.TempDir(), "--cachedir", t.TempDir()})
+		if err != nil {
+			t.Fatalf("ParseArgs() returned error: %v", err)
+		}
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with %q: error = %v, expected valid %v", tt.value, err, tt.valid)
+		}
+	}
+}
+
+// Test the trim threshold flag
+func Test_ParseArgs_TrimThreshold(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.TrimThreshold != 10 {
+		t.Errorf("Expected trim threshold 10 by default, got %d", cfg.TrimThreshold)
+	}
+
+	for _, tt := range []struct {
+		value string
+		valid bool
+	}{
+		{"0", true},
+		{"255", true},
+		{"256", false},
+		{"-1", false},
+	} {
+		cfg, err := ParseArgs([]string{"--trim-threshold", tt.value, "--imagesdir", t.TempDir(), "--cachedir", t.TempDir()})
+		if err != nil {
+			t.Fatalf("ParseArgs() returned error: %v", err)
+		}
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with %q: error = %v, expected valid %v", tt.value, err, tt.valid)
+		}
+	}
+}
+
+// Test color space and ICC flags
+func Test_ParseArgs_ColorSpace(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.ColorSpace != ColorSpaceSRGB || cfg.EmbedICC {
+		t.Errorf("Expected srgb without a profile by default, got %q embed=%v", cfg.ColorSpace, cfg.EmbedICC)
+	}
+
+	for _, tt := range []struct {
+		value string
+		valid bool
+	}{
+		{ColorSpaceSRGB, true},
+		{ColorSpacePreserve, true},
+		{"cmyk", false},
+	} {
+		cfg, err := ParseArgs([]string{"--color-space", tt.value, "--embed-icc", "--imagesdir", t.TempDir(), "--cachedir", t.TempDir()})
+		if err != nil {
+			t.Fatalf("ParseArgs() returned error: %v", err)
+		}
+		if !cfg.EmbedICC {
+			t.Error("Expected --embed-icc to be set")
+		}
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with %q: error = %v, expected valid %v", tt.value, err, tt.valid)
+		}
+	}
+}
+
+// Test progressive encoding flag
+func Test_ParseArgs_Progressive(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.Progressive {
+		t.Error("Expected baseline encoding by default")
+	}
+
+	cfg, err = ParseArgs([]string{"--progressive"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if !cfg.Progressive {
+		t.Error("Expected --progressive to be set")
+	}
+}
+
+// Test sidecar flag parsing
+func Test_ParseArgs_Sidecars(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.Sidecars {
+		t.Error("Expected sidecars to be ignored by default")
+	}
+
+	cfg, err = ParseArgs([]string{"--sidecars"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if !cfg.Sidecars {
+		t.Error("Expected --sidecars to be set")
+	}
+}
+
+// Test default output format flag
+func Test_ParseArgs_DefaultFormat(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.DefaultOutputFormat != "webp" {
+		t.Errorf("Expected webp by default, got %q", cfg.DefaultOutputFormat)
+	}
+
+	for _, tt := range []struct {
+		value string
+		valid bool
+	}{
+		{"webp", true},
+		{"png", true},
+		{"jpeg", true},
+		{"gif", false},
+		{"avif", false},
+	} {
+		cfg, err := ParseArgs([]string{"--default-format", tt.value, "--imagesdir", t.TempDir(), "--cachedir", t.TempDir()})
+		if err != nil {
+			t.Fatalf("ParseArgs() returned error: %v", err)
+		}
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with %q: error = %v, expected valid %v", tt.value, err, tt.valid)
+		}
+	}
+}
+
+// Test upload flags
+func Test_ParseArgs_Uploads(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--uploads", "--upload-warm", "800x600/webp, 200x200/jpeg", "--imagesdir", t.TempDir(), "--cachedir", t.TempDir()})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if !cfg.EnableUploads || cfg.UploadOverwrite {
+		t.Errorf("Expected uploads without overwrite, got uploads=%v overwrite=%v", cfg.EnableUploads, cfg.UploadOverwrite)
+	}
+	if len(cfg.UploadWarm) != 2 || cfg.UploadWarm[0] != "800x600/webp" || cfg.UploadWarm[1] != "200x200/jpeg" {
+		t.Errorf("Unexpected upload warm presets %q", cfg.UploadWarm)
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected uploads without --cmd-api-key to be rejected")
+	}
+
+	cfg.CommandAPIKey = "secret"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() returned error: %v", err)
+	}
+}
+
+// Test the production flag
+func Test_ParseArgs_Production(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.Production {
+		t.Error("Expected development mode by default")
+	}
+
+	cfg, err = ParseArgs([]string{"--production"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if !cfg.Production {
+		t.Error("Expected --production to enable production mode")
+	}
+	if !strings.Contains(cfg.String(), "Production: true") {
+		t.Errorf("Expected production mode in String(), got %q", cfg.String())
+	}
+}
+
+// Test connection read limit flags
+func Test_ParseArgs_ReadLimits(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.ReadHeaderTimeout != 10*time.Second || cfg.ReadTimeout != 30*time.Second || cfg.MaxBodyBytes != 64<<20 {
+		t.Errorf("Unexpected default read limits: header=%v read=%v body=%d", cfg.ReadHeaderTimeout, cfg.ReadTimeout, cfg.MaxBodyBytes)
+	}
+
+	cfg, err = ParseArgs([]string{"--read-header-timeout", "2s", "--read-timeout", "15s", "--max-body-bytes", "1024"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.ReadHeaderTimeout != 2*time.Second || cfg.ReadTimeout != 15*time.Second || cfg.MaxBodyBytes != 1024 {
+		t.Errorf("Unexpected read limits: header=%v read=%v body=%d", cfg.ReadHeaderTimeout, cfg.ReadTimeout, cfg.MaxBodyBytes)
+	}
+
+	cfg.MaxBodyBytes = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for negative max body bytes")
+	}
+}
+
+// Test per endpoint class request timeout flags
+func Test_ParseArgs_RequestTimeouts(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.HealthTimeout != 2*time.Second || cfg.ImageTimeout != 20*time.Second || cfg.CommandTimeout != 25*time.Second {
+		t.Errorf("Unexpected default timeouts: health=%v image=%v command=%v", cfg.HealthTimeout, cfg.ImageTimeout, cfg.CommandTimeout)
+	}
+
+	cfg, err = ParseArgs([]string{"--health-timeout", "500ms", "--image-timeout", "1m", "--cmd-timeout", "0"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.HealthTimeout != 500*time.Millisecond || cfg.ImageTimeout != time.Minute || cfg.CommandTimeout != 0 {
+		t.Errorf("Unexpected timeouts: health=%v image=%v command=%v", cfg.HealthTimeout, cfg.ImageTimeout, cfg.CommandTimeout)
+	}
+
+	tmpDir := t.TempDir()
+	cfg.ImagesDir = filepath.Join(tmpDir, "images")
+	cfg.CacheDir = filepath.Join(tmpDir, "cache")
+	cfg.ImageTimeout = -time.Second
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected negative image timeout to be rejected")
+	}
+}
+
+// Test maintenance mode flags
+func Test_ParseArgs_Maintenance(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--imagesdir", t.TempDir(), "--cachedir", t.TempDir()})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.MaintenanceImage != "" || cfg.MaintenanceRetryAfter != 5*time.Minute {
+		t.Errorf("Unexpected maintenance defaults image=%q retry after=%v", cfg.MaintenanceImage, cfg.MaintenanceRetryAfter)
+	}
+
+	cfg.MaintenanceImage = filepath.Join(t.TempDir(), "missing.png")
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected a missing maintenance image to be rejected")
+	}
+	cfg.MaintenanceImage = filepath.Join(t.TempDir(), "maintenance.png")
+	if err := os.WriteFile(cfg.MaintenanceImage, []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() returned error: %v", err)
+	}
+	cfg.MaintenanceRetryAfter = -time.Second
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected negative maintenance retry after to be rejected")
+	}
+}
+
+// Test archive flag
+func Test_ParseArgs_Archive(t *testing.T) {
+	dir := t.TempDir()
+	zipFile := filepath.Join(dir, "images.zip")
+	if err := os.WriteFile(zipFile, []byte("zip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := ParseArgs([]string{"--archive", zipFile, "--imagesdir", t.TempDir(), "--cachedir", t.TempDir()})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.Archive != zipFile {
+		t.Errorf("Expected archive %q, got %q", zipFile, cfg.Archive)
+	}
+
+	for _, tt := range []struct {
+		value string
+		valid bool
+	}{
+		{zipFile, true},
+		{filepath.Join(dir, "missing.tar"), false},
+		{filepath.Join(dir, "images.rar"), false},
+		{dir, false},
+	} {
+		cfg.Archive = tt.value
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with %q: error = %v, expected valid %v", tt.value, err, tt.valid)
+		}
+	}
+
+	// Uploads cannot be written to an archive
+	cfg.Archive = zipFile
+	cfg.EnableUploads = true
+	cfg.CommandAPIKey = "key"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected uploads with an archive to be rejected")
+	}
+}
+
+// Test audit log flag
+func Test_ParseArgs_AuditLog(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := ParseArgs([]string{"--imagesdir", t.TempDir(), "--cachedir", t.TempDir()})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.AuditLog != "" {
+		t.Errorf("Expected audit entries in the server log by default, got %q", cfg.AuditLog)
+	}
+
+	for _, tt := range []struct {
+		value string
+		valid bool
+	}{
+		{filepath.Join(dir, "audit.log"), true},
+		{filepath.Join(dir, "missing", "audit.log"), false},
+		{dir, false},
+	} {
+		cfg.AuditLog = tt.value
+		if err := cfg.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate() with %q: error = %v, expected valid %v", tt.value, err, tt.valid)
+		}
+	}
+}
+
+// Test git queue flags
+func Test_ParseArgs_GitQueue(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.GitQueue != 2 || cfg.GitQueueTimeout != 20*time.Second {
+		t.Errorf("Unexpected default git queue %d timeout %v", cfg.GitQueue, cfg.GitQueueTimeout)
+	}
+
+	cfg, err = ParseArgs([]string{"--git-queue", "0", "--git-queue-timeout", "5s", "--imagesdir", t.TempDir(), "--cachedir", t.TempDir()})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.GitQueue != 0 || cfg.GitQueueTimeout != 5*time.Second {
+		t.Errorf("Unexpected git queue %d timeout %v", cfg.GitQueue, cfg.GitQueueTimeout)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() returned error: %v", err)
+	}
+
+	cfg.GitQueue = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected negative git queue to be rejected")
+	}
+}
+
+// Test webhook flags
+func Test_ParseArgs_Webhooks(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if len(cfg.Webhooks) != 0 || cfg.WebhookTimeout != 5*time.Second || cfg.WebhookRetries != 3 {
+		t.Errorf("Unexpected default webhooks %v timeout %v retries %d", cfg.Webhooks, cfg.WebhookTimeout, cfg.WebhookRetries)
+	}
+
+	cfg, err = ParseArgs([]string{"--webhooks", "http://peer1:9000/hook, https://peer2/hook?token=x", "--webhook-timeout", "1s", "--webhook-retries", "0", "--imagesdir", t.TempDir(), "--cachedir", t.TempDir()})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if !slices.Equal(cfg.Webhooks, []string{"http://peer1:9000/hook", "https://peer2/hook?token=x"}) || cfg.WebhookTimeout != time.Second || cfg.WebhookRetries != 0 {
+		t.Errorf("Unexpected webhooks %v timeout %v retries %d", cfg.Webhooks, cfg.WebhookTimeout, cfg.WebhookRetries)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() returned error: %v", err)
+	}
+	if strings.Contains(cfg.String(), "token") {
+		t.Error("Expected webhook URLs to be left out of the configuration summary")
+	}
+
+	for _, hook := range []string{"peer1/hook", "ftp://peer1/hook", "http:///hook"} {
+		cfg.Webhooks = []string{hook}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected webhook URL %q to be rejected", hook)
+		}
+	}
+	cfg.Webhooks = nil
+	cfg.WebhookRetries = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected negative webhook retries to be rejected")
+	}
+}
+
+// Test path access flags
+func Test_ParseArgs_PathAccess(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--deny-paths", "internal, drafts/,", "--allow-paths", "public", "--denied-behavior", "fallback"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if !slices.Equal(cfg.DenyPaths, []string{"internal", "drafts/"}) {
+		t.Errorf("Expected deny paths [internal drafts/], got %v", cfg.DenyPaths)
+	}
+	if !slices.Equal(cfg.AllowPaths, []string{"public"}) {
+		t.Errorf("Expected allow paths [public], got %v", cfg.AllowPaths)
+	}
+	if cfg.DeniedBehavior != DeniedBehaviorFallback {
+		t.Errorf("Expected denied behavior fallback, got %s", cfg.DeniedBehavior)
+	}
+}
+
+// Test path access validation
+func Test_Validate_PathAccess(t *testing.T) {
+	tests := []struct {
+		name      string
+		deny      []string
+		behavior  string
+		expectErr bool
+	}{
+		{"No rules", nil, "", false},
+		{"Deny prefix", []string{"internal"}, DeniedBehaviorForbidden, false},
+		{"Fallback", []string{"internal"}, DeniedBehaviorFallback, false},
+		{"Parent segment", []string{"../secret"}, "", true},
+		{"Invalid behavior", []string{"internal"}, "hide", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			cfg := &Config{
+				Port:           9000,
+				ImagesDir:      filepath.Join(tmpDir, "images"),
+				CacheDir:       filepath.Join(tmpDir, "cache"),
+				DenyPaths:      tt.deny,
+				DeniedBehavior: tt.behavior,
+			}
+
+			err := cfg.Validate()
+			if (err != nil) != tt.expectErr {
+				t.Errorf("Validate() error = %v, expectErr %v", err, tt.expectErr)
+			}
+		})
+	}
+}
+
+// Test miss behavior validation
+func Test_Validate_MissBehavior(t *testing.T) {
+	tests := []struct {
+		name           string
+		missBehavior   string
+		placeholderURL string
+		wantErr        bool
+	}{
+		{"Empty defaults to fallback", "", "", false},
+		{"Fallback", MissBehaviorFallback, "", false},
+		{"Not found", MissBehaviorNotFound, "", false},
+		{"Redirect with URL", MissBehaviorRedirect, "https://example.com/placeholder.png", false},
+		{"Redirect without URL", MissBehaviorRedirect, "", true},
+		{"Unknown", "teapot", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			cfg := &Config{
+				Port:           9000,
+				ImagesDir:      filepath.Join(tmpDir, "images"),
+				CacheDir:       filepath.Join(tmpDir, "cache"),
+				MissBehavior:   tt.missBehavior,
+				PlaceholderURL: tt.placeholderURL,
+			}
+
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Test invalid default image behavior validation
+func Test_Validate_InvalidDefaultImage(t *testing.T) {
+	tests := []struct {
+		name                string
+		invalidDefaultImage string
+		wantErr             bool
+	}{
+		{"Empty defaults to placeholder", "", false},
+		{"Placeholder", InvalidDefaultImagePlaceholder, false},
+		{"Error", InvalidDefaultImageError, false},
+		{"Unknown", "ignore", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			cfg := &Config{
+				Port:                9000,
+				ImagesDir:           filepath.Join(tmpDir, "images"),
+				CacheDir:            filepath.Join(tmpDir, "cache"),
+				InvalidDefaultImage: tt.invalidDefaultImage,
+			}
+
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Test empty source behavior validation
+func Test_Validate_EmptySource(t *testing.T) {
+	tests := []struct {
+		name          string
+		emptySource   string
+		minSourceSize int64
+		wantErr       bool
+	}{
+		{"Empty defaults to fallback", "", 1, false},
+		{"Fallback", EmptySourceFallback, 1, false},
+		{"Error", EmptySourceError, 64, false},
+		{"Detection off", EmptySourceFallback, 0, false},
+		{"Negative size", EmptySourceFallback, -1, true},
+		{"Unknown", "ignore", 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			cfg := &Config{
+				Port:          9000,
+				ImagesDir:     filepath.Join(tmpDir, "images"),
+				CacheDir:      filepath.Join(tmpDir, "cache"),
+				EmptySource:   tt.emptySource,
+				MinSourceSize: tt.minSourceSize,
+			}
+
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Test format mismatch flag parsing and validation
+func Test_ParseArgs_FormatMismatch(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.FormatMismatch != FormatMismatchContent {
+		t.Errorf("Expected format mismatch %q by default, got %q", FormatMismatchContent, cfg.FormatMismatch)
+	}
+
+	cfg, err = ParseArgs([]string{"--format-mismatch", "strict"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.FormatMismatch != FormatMismatchStrict {
+		t.Errorf("Expected format mismatch %q, got %q", FormatMismatchStrict, cfg.FormatMismatch)
+	}
+
+	cfg.FormatMismatch = "extension"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for an unknown format mismatch policy")
+	}
+}
+
+// Test Validate with qauto metric names
+func Test_Validate_QualityMetric(t *testing.T) {
+	for _, metric := range []string{"", "ssim", "heuristic", "psnr"} {
+		t.Run(metric, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			cfg := &Config{
+				Port:          9000,
+				ImagesDir:     filepath.Join(tmpDir, "images"),
+				CacheDir:      filepath.Join(tmpDir, "cache"),
+				QualityMetric: metric,
+			}
+
+			err := cfg.Validate()
+			if (err != nil) != (metric == "psnr") {
+				t.Errorf("Validate() error = %v for metric %q", err, metric)
+			}
+		})
+	}
+}
+
+// Test Validate with JPEG subsampling values
+func Test_Validate_JPEGSubsampling(t *testing.T) {
+	for _, subsampling := range []string{"", "444", "422", "420", "411"} {
+		t.Run(subsampling, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			cfg := &Config{
+				Port:            9000,
+				ImagesDir:       filepath.Join(tmpDir, "images"),
+				CacheDir:        filepath.Join(tmpDir, "cache"),
+				JPEGSubsampling: subsampling,
+			}
+
+			err := cfg.Validate()
+			if (err != nil) != (subsampling == "411") {
+				t.Errorf("Validate() error = %v for subsampling %q", err, subsampling)
+			}
+		})
+	}
+}
+
+// Test query param mode validation
+func Test_Validate_QueryParams(t *testing.T) {
+	for _, mode := range []string{"", QueryParamsNormalize, QueryParamsStrip, "merge"} {
+		t.Run(mode, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			cfg := &Config{
+				Port:        9000,
+				ImagesDir:   filepath.Join(tmpDir, "images"),
+				CacheDir:    filepath.Join(tmpDir, "cache"),
+				QueryParams: mode,
+			}
+
+			err := cfg.Validate()
+			if (err != nil) != (mode == "merge") {
+				t.Errorf("Validate() error = %v for query params mode %q", err, mode)
+			}
+		})
+	}
+}
+
+// Test hash mismatch behavior validation
+func Test_Validate_HashMismatch(t *testing.T) {
+	for _, mode := range []string{"", HashMismatchNotFound, HashMismatchRedirect, "fallback"} {
+		t.Run(mode, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			cfg := &Config{
+				Port:         9000,
+				ImagesDir:    filepath.Join(tmpDir, "images"),
+				CacheDir:     filepath.Join(tmpDir, "cache"),
+				HashMismatch: mode,
+			}
+
+			err := cfg.Validate()
+			if (err != nil) != (mode == "fallback") {
+				t.Errorf("Validate() error = %v for hash mismatch behavior %q", err, mode)
+			}
+		})
+	}
+}
+
+// Test animated GIF mode parsing and validation
+func Test_AnimatedGIF(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() error = %v", err)
+	}
+	if cfg.AnimatedGIF != AnimatedGIFStatic {
+		t.Errorf("AnimatedGIF = %q, expected %q by default", cfg.AnimatedGIF, AnimatedGIFStatic)
+	}
+
+	for _, mode := range []string{"", AnimatedGIFWebP, AnimatedGIFStatic, AnimatedGIFPassthrough, "gif"} {
+		t.Run(mode, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			cfg := &Config{
+				Port:        9000,
+				ImagesDir:   filepath.Join(tmpDir, "images"),
+				CacheDir:    filepath.Join(tmpDir, "cache"),
+				AnimatedGIF: mode,
+			}
+
+			err := cfg.Validate()
+			if (err != nil) != (mode == "gif") {
+				t.Errorf("Validate() error = %v for animated GIF mode %q", err, mode)
+			}
+		})
+	}
+}
+
+// Test TLS settings validation
+func Test_Validate_TLS(t *testing.T) {
+	tmpDir := t.TempDir()
+	certFile := filepath.Join(tmpDir, "cert.pem")
+	keyFile := filepath.Join(tmpDir, "key.pem")
+	for _, file := range []string{certFile, keyFile} {
+		if err := os.WriteFile(file, []byte("pem"), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", file, err)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		cert         string
+		key          string
+		minVersion   string
+		redirectPort int
+		expectError  bool
+	}{
+		{"Plain HTTP", "", "", "", 0, false},
+		{"TLS", certFile, keyFile, TLSVersion12, 0, false},
+		{"TLS 1.3 with redirect", certFile, keyFile, TLSVersion13, 8080, false},
+		{"Cert without key", certFile, "", "", 0, true},
+		{"Missing cert file", filepath.Join(tmpDir, "missing.pem"), keyFile, "", 0, true},
+		{"Invalid min version", certFile, keyFile, "1.1", 0, true},
+		{"Redirect without TLS", "", "", "", 8080, true},
+		{"Redirect on server port", certFile, keyFile, "", 9000, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Port:             9000,
+				ImagesDir:        filepath.Join(tmpDir, "images"),
+				CacheDir:         filepath.Join(tmpDir, "cache"),
+				TLSCert:          tt.cert,
+				TLSKey:           tt.key,
+				TLSMinVersion:    tt.minVersion,
+				HTTPRedirectPort: tt.redirectPort,
+			}
+
+			err := cfg.Validate()
+			if (err != nil) != tt.expectError {
+				t.Errorf("Validate() error = %v, expectError %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+// Test TLS minimum version mapping
+func Test_MinTLSVersion(t *testing.T) {
+	tests := map[string]uint16{
+		"":           tls.VersionTLS12,
+		TLSVersion12: tls.VersionTLS12,
+		TLSVersion13: tls.VersionTLS13,
+	}
+
+	for version, expected := range tests {
+		cfg := &Config{TLSMinVersion: version}
+		if got := cfg.MinTLSVersion(); got != expected {
+			t.Errorf("MinTLSVersion() for %q = %x, expected %x", version, got, expected)
+		}
+	}
+}
+
+// Test cache shard levels validation
+func Test_Validate_CacheShardLevels(t *testing.T) {
+	for _, levels := range []int{0, 1, 2, 3, -1} {
+		t.Run(fmt.Sprint(levels), func(t *testing.T) {
+			tmpDir := t.TempDir()
+			cfg := &Config{
+				Port:             9000,
+				ImagesDir:        filepath.Join(tmpDir, "images"),
+				CacheDir:         filepath.Join(tmpDir, "cache"),
+				CacheShardLevels: levels,
+			}
+
+			err := cfg.Validate()
+			if (err != nil) != (levels < 0 || levels > 2) {
+				t.Errorf("Validate() error = %v for cache shard levels %d", err, levels)
+			}
+		})
+	}
+}
+
+// Test cache max open files flag and validation
+func Test_ParseArgs_CacheMaxOpenFiles(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.CacheMaxOpenFiles != 256 {
+		t.Errorf("Expected default cache max open files 256, got %d", cfg.CacheMaxOpenFiles)
+	}
+
+	cfg, err = ParseArgs([]string{"--cache-max-open-files", "0"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.CacheMaxOpenFiles != 0 {
+		t.Errorf("Expected unlimited cache open files, got %d", cfg.CacheMaxOpenFiles)
+	}
+
+	cfg.CacheMaxOpenFiles = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for negative cache max open files")
+	}
+}
+
+// Test the source versions kept with dedupe-sources
+func Test_ParseArgs_CacheMaxSourceVersions(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.CacheMaxSourceVersions != 0 {
+		t.Errorf("Expected all source versions kept by default, got %d", cfg.CacheMaxSourceVersions)
+	}
+
+	cfg, err = ParseArgs([]string{"--dedupe-sources", "--cache-max-source-versions", "3"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.CacheMaxSourceVersions != 3 {
+		t.Errorf("Expected 3 source versions, got %d", cfg.CacheMaxSourceVersions)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"Negative", []string{"--dedupe-sources", "--cache-max-source-versions", "-1"}},
+		{"Without dedupe sources", []string{"--cache-max-source-versions", "2"}},
+		{"Without janitor", []string{"--dedupe-sources", "--cache-max-source-versions", "2", "--cache-janitor-interval", "0"}},
+	}
+	for _, tt := range tests {
+		cfg, err := ParseArgs(tt.args)
+		if err != nil {
+			t.Fatalf("%s: ParseArgs() returned error: %v", tt.name, err)
+		}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
+
+// Test cache namespace flags and validation
+func Test_ParseArgs_CacheNamespace(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.CacheNamespace != "" || cfg.CacheNamespaceHeader != "X-Tenant" {
+		t.Errorf("Expected no cache namespace with header X-Tenant by default, got %q %q", cfg.CacheNamespace, cfg.CacheNamespaceHeader)
+	}
+
+	cfg, err = ParseArgs([]string{"--cache-namespace", "header", "--cache-namespace-header", "X-Customer"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.CacheNamespace != CacheNamespaceHeader || cfg.CacheNamespaceHeader != "X-Customer" {
+		t.Errorf("Expected header namespace from X-Customer, got %q %q", cfg.CacheNamespace, cfg.CacheNamespaceHeader)
+	}
+
+	cfg.CacheNamespaceHeader = ""
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for a header namespace without a header")
+	}
+	cfg.CacheNamespace = "cookie"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for an unknown cache namespace source")
+	}
+}
+
+// Test max variants per file flag and validation
+func Test_MaxVariantsPerFile(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.MaxVariantsPerFile != 200 {
+		t.Errorf("Expected default max variants per file 200, got %d", cfg.MaxVariantsPerFile)
+	}
+
+	for _, limit := range []int{0, 50, -1} {
+		t.Run(fmt.Sprint(limit), func(t *testing.T) {
+			tmpDir := t.TempDir()
+			cfg := &Config{
+				Port:               9000,
+				ImagesDir:          filepath.Join(tmpDir, "images"),
+				CacheDir:           filepath.Join(tmpDir, "cache"),
+				MaxVariantsPerFile: limit,
+			}
+
+			err := cfg.Validate()
+			if (err != nil) != (limit < 0) {
+				t.Errorf("Validate() error = %v for max variants per file %d", err, limit)
+			}
+		})
+	}
+}
+
+// Test max total variants flag and validation
+func Test_MaxTotalVariants(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.MaxTotalVariants != 0 {
+		t.Errorf("Expected max total variants to default to unlimited, got %d", cfg.MaxTotalVariants)
+	}
+
+	cfg, err = ParseArgs([]string{"--max-total-variants", "100000"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.MaxTotalVariants != 100000 {
+		t.Errorf("Expected max total variants 100000, got %d", cfg.MaxTotalVariants)
+	}
+
+	tmpDir := t.TempDir()
+	cfg = &Config{
+		Port:             9000,
+		ImagesDir:        filepath.Join(tmpDir, "images"),
+		CacheDir:         filepath.Join(tmpDir, "cache"),
+		MaxTotalVariants: -1,
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected negative max total variants to be rejected")
+	}
+}
+
+// Test cache frequency weight flag and validation
+func Test_CacheFrequencyWeight(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.CacheFrequencyWeight != time.Hour {
+		t.Errorf("Expected cache frequency weight to default to 1h, got %v", cfg.CacheFrequencyWeight)
+	}
+
+	cfg, err = ParseArgs([]string{"--cache-frequency-weight", "0"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.CacheFrequencyWeight != 0 {
+		t.Errorf("Expected cache frequency weight 0, got %v", cfg.CacheFrequencyWeight)
+	}
+
+	tmpDir := t.TempDir()
+	cfg = &Config{
+		Port:                 9000,
+		ImagesDir:            filepath.Join(tmpDir, "images"),
+		CacheDir:             filepath.Join(tmpDir, "cache"),
+		CacheFrequencyWeight: -time.Minute,
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected negative cache frequency weight to be rejected")
+	}
+}
+
+// Test max source pixels flag and validation
+func Test_MaxSourcePixels(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--max-source-pixels", "1000000"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.MaxSourcePixels != 1000000 {
+		t.Errorf("Expected max source pixels 1000000, got %d", cfg.MaxSourcePixels)
+	}
+
+	tmpDir := t.TempDir()
+	cfg = &Config{
+		Port:            9000,
+		ImagesDir:       filepath.Join(tmpDir, "images"),
+		CacheDir:        filepath.Join(tmpDir, "cache"),
+		MaxSourcePixels: -1,
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected negative max source pixels to be rejected")
+	}
+}
+
+// Test cold cache compression flags and validation
+func Test_CacheCompression(t *testing.T) {
+	cfg, err := ParseArgs([]string{})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.CacheCompressAfter != 0 || !slices.Equal(cfg.CacheCompressFormats, []string{"png"}) || cfg.CacheJanitorInterval != time.Hour {
+		t.Errorf("Unexpected defaults: after=%v formats=%v interval=%v", cfg.CacheCompressAfter, cfg.CacheCompressFormats, cfg.CacheJanitorInterval)
+	}
+
+	cfg, err = ParseArgs([]string{"--cache-compress-after", "72h", "--cache-compress-formats", "png,webp", "--cache-janitor-interval", "10m"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.CacheCompressAfter != 72*time.Hour || !slices.Equal(cfg.CacheCompressFormats, []string{"png", "webp"}) || cfg.CacheJanitorInterval != 10*time.Minute {
+		t.Errorf("Unexpected values: after=%v formats=%v interval=%v", cfg.CacheCompressAfter, cfg.CacheCompressFormats, cfg.CacheJanitorInterval)
+	}
+
+	tests := []struct {
+		name        string
+		after       time.Duration
+		formats     []string
+		interval    time.Duration
+		expectError bool
+	}{
+		{"Off", 0, []string{"png"}, 0, false},
+		{"On", time.Hour, []string{"png", "jpeg"}, time.Minute, false},
+		{"Negative idle period", -time.Hour, nil, time.Minute, true},
+		{"No janitor interval", time.Hour, nil, 0, true},
+		{"Unknown format", time.Hour, []string{"gif"}, time.Minute, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			cfg := &Config{
+				Port:                 9000,
+				ImagesDir:            filepath.Join(tmpDir, "images"),
+				CacheDir:             filepath.Join(tmpDir, "cache"),
+				CacheCompressAfter:   tt.after,
+				CacheCompressFormats: tt.formats,
+				CacheJanitorInterval: tt.interval,
+			}
+
+			err := cfg.Validate()
+			if (err != nil) != tt.expectError {
+				t.Errorf("Validate() error = %v, expectError %v", err, tt.expectError)
+			}
+		})
+	}
+}
+
+// Test base path normalization
+func Test_NormalizeBasePath(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"/", ""},
+		{"/images", "/images"},
+		{"images/", "/images"},
+		{"/images/", "/images"},
+		{"/cdn/images", "/cdn/images"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeBasePath(tt.input); got != tt.expected {
+			t.Errorf("NormalizeBasePath(%q) = %q, expected %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+// Test Validate normalizes and checks the base path
+func Test_Validate_BasePath(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &Config{
+		Port:      9000,
+		ImagesDir: filepath.Join(tmpDir, "images"),
+		CacheDir:  filepath.Join(tmpDir, "cache"),
+		BasePath:  "images/",
+	}
+
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() failed: %v", err)
+	}
+	if cfg.BasePath != "/images" {
+		t.Errorf("BasePath = %q, expected /images", cfg.BasePath)
+	}
+
+	cfg.BasePath = "/img/*path"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Validate() expected error for wildcard base path")
+	}
+}
+
 // Test ParseArgs with invalid arguments
 func Test_ParseArgs_InvalidArgs(t *testing.T) {
 	// Arrange
@@ -5,6 +5,7 @@ import (
 	"image"
 	"image/color"
 	"image/jpeg"
+	"io"
 	"os"
 	"path/filepath"
 
@@ -32,9 +33,28 @@ func DetectDefaultImage(dir string) (string, bool) {
 // GenerateDefaultPlaceholder creates a 1000x1000px placeholder image
 // with white background and "goimgserver" text in black
 func GenerateDefaultPlaceholder(outputPath string) error {
+	return GeneratePlaceholder(outputPath, "goimgserver")
+}
+
+// GeneratePlaceholder creates a 1000x1000px JPEG placeholder image with
+// white background and text centered in black
+func GeneratePlaceholder(outputPath string, text string) error {
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer file.Close()
+
+	return EncodePlaceholder(file, text)
+}
+
+// EncodePlaceholder writes the JPEG placeholder GeneratePlaceholder creates
+// to w, so it can also be generated without a file
+func EncodePlaceholder(w io.Writer, text string) error {
 	const (
 		width  = 1000
 		height = 1000
+		scale  = 10
 	)
 
 	// Create image with white background
@@ -46,44 +66,27 @@ func GenerateDefaultPlaceholder(outputPath string) error {
 		}
 	}
 
-	// Draw text
-	text := "goimgserver"
-	
 	// Use basicfont for simplicity (it's part of golang.org/x/image/font)
-	// For better appearance, we'll draw the text multiple times to make it larger
-	point := fixed.Point26_6{
-		X: fixed.Int26_6(width/2 - 200) * 64,
-		Y: fixed.Int26_6(height/2 + 30) * 64,
-	}
-
 	drawer := &font.Drawer{
 		Dst:  img,
 		Src:  image.NewUniform(color.RGBA{0, 0, 0, 255}),
 		Face: basicfont.Face7x13,
-		Dot:  point,
 	}
+	left := (width - drawer.MeasureString(text).Ceil() - scale) / 2
 
 	// Draw text larger by drawing multiple times with offset
-	scale := 10
 	for i := 0; i < scale; i++ {
 		for j := 0; j < scale; j++ {
 			drawer.Dot = fixed.Point26_6{
-				X: (fixed.Int26_6(width/2-200) + fixed.Int26_6(i)) * 64,
+				X: (fixed.Int26_6(left) + fixed.Int26_6(i)) * 64,
 				Y: (fixed.Int26_6(height/2+30) + fixed.Int26_6(j)) * 64,
 			}
 			drawer.DrawString(text)
 		}
 	}
 
-	// Save as JPEG
-	file, err := os.Create(outputPath)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
-	}
-	defer file.Close()
-
 	opts := &jpeg.Options{Quality: 95}
-	if err := jpeg.Encode(file, img, opts); err != nil {
+	if err := jpeg.Encode(w, img, opts); err != nil {
 		return fmt.Errorf("failed to encode image: %w", err)
 	}
 
@@ -119,24 +122,26 @@ func ValidateDefaultImage(path string) error {
 	return nil
 }
 
-// SetupDefaultImage detects or generates the default image
+// SetupDefaultImage detects or generates the default image. DefaultImagePath
+// is set even when an error is returned, so with InvalidDefaultImage set to
+// placeholder the server can start and replace the default image with a
+// generated placeholder until the file is fixed.
 func (c *Config) SetupDefaultImage() error {
 	// Try to detect existing default image
 	if path, found := DetectDefaultImage(c.ImagesDir); found {
+		c.DefaultImagePath = path
 		// Validate the found image
 		if err := ValidateDefaultImage(path); err != nil {
 			return fmt.Errorf("found default image is invalid: %w", err)
 		}
-		c.DefaultImagePath = path
 		return nil
 	}
 
 	// Generate placeholder if not found
 	defaultPath := filepath.Join(c.ImagesDir, "default.jpg")
+	c.DefaultImagePath = defaultPath
 	if err := GenerateDefaultPlaceholder(defaultPath); err != nil {
 		return fmt.Errorf("failed to generate default placeholder: %w", err)
 	}
-
-	c.DefaultImagePath = defaultPath
 	return nil
 }
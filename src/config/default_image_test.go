@@ -1,6 +1,7 @@
 package config
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
 	"testing"
@@ -117,6 +118,30 @@ func Test_DefaultImage_GeneratePlaceholder(t *testing.T) {
 	}
 }
 
+// Test placeholders with different text differ
+func Test_DefaultImage_GeneratePlaceholder_Text(t *testing.T) {
+	tmpDir := t.TempDir()
+	var generated [][]byte
+	for _, text := range []string{"cats", "dogs"} {
+		outputPath := filepath.Join(tmpDir, text+".jpg")
+		if err := GeneratePlaceholder(outputPath, text); err != nil {
+			t.Fatalf("GeneratePlaceholder() returned error: %v", err)
+		}
+		if err := ValidateDefaultImage(outputPath); err != nil {
+			t.Fatalf("Generated placeholder is invalid: %v", err)
+		}
+		data, err := os.ReadFile(outputPath)
+		if err != nil {
+			t.Fatalf("Failed to read placeholder: %v", err)
+		}
+		generated = append(generated, data)
+	}
+
+	if bytes.Equal(generated[0], generated[1]) {
+		t.Error("Expected placeholders with different text to differ")
+	}
+}
+
 // Test default image readability validation
 func Test_DefaultImage_ValidationReadable(t *testing.T) {
 	t.Run("ValidImageFile", func(t *testing.T) {
@@ -323,4 +348,28 @@ func Test_DefaultImage_Setup_FoundButInvalid(t *testing.T) {
 	if err == nil {
 		t.Error("SetupDefaultImage() should fail when found image is invalid")
 	}
+	// The path is kept so a placeholder can stand in until it is fixed
+	if cfg.DefaultImagePath != corruptedDefault {
+		t.Errorf("Expected path %s, got %s", corruptedDefault, cfg.DefaultImagePath)
+	}
+}
+
+// Test in-memory placeholders match generated files
+func Test_DefaultImage_EncodePlaceholder(t *testing.T) {
+	var buf bytes.Buffer
+	if err := EncodePlaceholder(&buf, "goimgserver"); err != nil {
+		t.Fatalf("EncodePlaceholder() returned error: %v", err)
+	}
+
+	outputPath := filepath.Join(t.TempDir(), "default.jpg")
+	if err := GenerateDefaultPlaceholder(outputPath); err != nil {
+		t.Fatalf("GenerateDefaultPlaceholder() returned error: %v", err)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("Failed to read placeholder: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Error("Encoded placeholder differs from the generated file")
+	}
 }
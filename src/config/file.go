@@ -0,0 +1,165 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// commandFlags are startup actions rather than settings, so config files
+// neither hold nor accept them
+var commandFlags = map[string]bool{
+	"config":   true,
+	"dump":     true,
+	"selftest": true,
+}
+
+// secretFlags are left out of dumped settings files, like String leaves
+// them out of the summary
+var secretFlags = map[string]bool{
+	"cmd-api-key":    true,
+	"caption-secret": true,
+}
+
+// listValue is a comma-separated list flag
+type listValue []string
+
+// String joins the list with commas
+func (l *listValue) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+// Set replaces the list with the comma-separated items of value
+func (l *listValue) Set(value string) error {
+	*l = splitList(value)
+	return nil
+}
+
+// Get returns the list
+func (l *listValue) Get() any {
+	return []string(*l)
+}
+
+// LoadFile returns the default configuration overridden by the settings in
+// a YAML or JSON file, see ParseArgs
+func LoadFile(path string) (*Config, error) {
+	return ParseArgs([]string{"--config", path})
+}
+
+// isJSON reports whether a settings file is JSON by its extension
+func isJSON(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".json")
+}
+
+// loadFile sets the flags of fs from a settings file keyed by flag name,
+// skipping those in set. Lists may be YAML or JSON sequences or
+// comma-separated strings. Unknown keys are an error.
+func loadFile(fs *flag.FlagSet, path string, set map[string]bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var settings map[string]any
+	if isJSON(path) {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber() // Keep large integers out of float notation
+		err = decoder.Decode(&settings)
+	} else {
+		err = yaml.Unmarshal(data, &settings)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	var unknown []string
+	for key := range settings {
+		if fs.Lookup(key) == nil || commandFlags[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		slices.Sort(unknown)
+		return fmt.Errorf("unknown settings in config file %s: %s", path, strings.Join(unknown, ", "))
+	}
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		if set[key] {
+			continue
+		}
+		if err := fs.Set(key, settingString(settings[key])); err != nil {
+			return fmt.Errorf("invalid setting %s in config file %s: %w", key, path, err)
+		}
+	}
+	return nil
+}
+
+// settingString formats a decoded setting as a flag value
+func settingString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = settingString(item)
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(value)
+}
+
+// dumpFile writes c as a YAML or JSON settings file that LoadFile reads
+// back, without the secrets
+func (c *Config) dumpFile(filename string) error {
+	// Flags defined on a copy point at its fields, so their values are c's
+	dump := &Config{}
+	fs := newFlagSet(dump)
+	*dump = *c
+
+	settings := map[string]any{}
+	fs.VisitAll(func(f *flag.Flag) {
+		if commandFlags[f.Name] || secretFlags[f.Name] {
+			return
+		}
+		value := f.Value.(flag.Getter).Get()
+		switch v := value.(type) {
+		case time.Duration:
+			value = v.String()
+		case []string:
+			if v == nil {
+				value = []string{}
+			}
+		}
+		settings[f.Name] = value
+	})
+
+	var data []byte
+	var err error
+	if isJSON(filename) {
+		data, err = json.MarshalIndent(settings, "", "  ")
+		data = append(data, '\n')
+	} else {
+		data, err = yaml.Marshal(settings)
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes a settings file into a temporary directory
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+// Test YAML and JSON settings files populate the configuration
+func Test_LoadFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"YAML", "config.yaml", "port: 8080\nimagesdir: /srv/images\nimage-timeout: 5s\nprecache: false\nprecache-rate: 2.5\nmax-body-bytes: 134217728\ndeny-paths: [internal, drafts]\n"},
+		{"JSON", "config.json", `{"port": 8080, "imagesdir": "/srv/images", "image-timeout": "5s", "precache": false, "precache-rate": 2.5, "max-body-bytes": 134217728, "deny-paths": "internal,drafts"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadFile(writeConfigFile(t, tt.file, tt.content))
+			if err != nil {
+				t.Fatalf("LoadFile() returned error: %v", err)
+			}
+			if cfg.Port != 8080 || cfg.ImagesDir != "/srv/images" || cfg.ImageTimeout != 5*time.Second {
+				t.Errorf("Expected port 8080, /srv/images and 5s, got %d, %s and %v", cfg.Port, cfg.ImagesDir, cfg.ImageTimeout)
+			}
+			if cfg.PreCacheEnabled || cfg.PreCacheRate != 2.5 || cfg.MaxBodyBytes != 134217728 {
+				t.Errorf("Expected pre-caching off at 2.5/s and 128MB bodies, got %v, %v and %d", cfg.PreCacheEnabled, cfg.PreCacheRate, cfg.MaxBodyBytes)
+			}
+			if !reflect.DeepEqual(cfg.DenyPaths, []string{"internal", "drafts"}) {
+				t.Errorf("Expected deny paths [internal drafts], got %v", cfg.DenyPaths)
+			}
+			// Settings the file leaves out keep their defaults
+			if cfg.CacheDir != "./cache" {
+				t.Errorf("Expected default cache dir, got %s", cfg.CacheDir)
+			}
+		})
+	}
+}
+
+// Test command-line flags take precedence over the settings file
+func Test_ParseArgs_ConfigFilePrecedence(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "port: 8080\ncachedir: /srv/cache\n")
+
+	// Flags before and after --config both win
+	for _, args := range [][]string{
+		{"--port", "7000", "--config", path},
+		{"--config", path, "--port", "7000"},
+	} {
+		cfg, err := ParseArgs(args)
+		if err != nil {
+			t.Fatalf("ParseArgs(%v) returned error: %v", args, err)
+		}
+		if cfg.Port != 7000 {
+			t.Errorf("ParseArgs(%v): expected the flag's port 7000, got %d", args, cfg.Port)
+		}
+		if cfg.CacheDir != "/srv/cache" {
+			t.Errorf("ParseArgs(%v): expected the file's cache dir, got %s", args, cfg.CacheDir)
+		}
+	}
+
+	// A flag set to its default still wins
+	cfg, err := ParseArgs([]string{"--config", path, "--port", "9000"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+	if cfg.Port != 9000 {
+		t.Errorf("Expected port 9000 from the flag, got %d", cfg.Port)
+	}
+}
+
+// Test unknown keys and invalid values are reported
+func Test_LoadFile_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		expected string
+	}{
+		{"Unknown keys", "config.yaml", "port: 8080\nprot: 1\ncache_dir: x\n", "unknown settings in config file"},
+		{"Command flag", "config.yaml", "dump: true\n", "dump"},
+		{"Invalid value", "config.yaml", "port: eighty\n", "invalid setting port"},
+		{"Malformed JSON", "config.json", `{"port": `, "invalid config file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadFile(writeConfigFile(t, tt.file, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Fatalf("Expected error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+
+	_, err := LoadFile(writeConfigFile(t, "config.yaml", "prot: 1\ncache_dir: x\n"))
+	if err == nil || !strings.HasSuffix(err.Error(), "cache_dir, prot") {
+		t.Errorf("Expected every unknown key to be listed, got %v", err)
+	}
+	if _, err := LoadFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Expected error for a missing config file")
+	}
+}
+
+// Test settings dumped as YAML or JSON load back unchanged
+func Test_DumpSettings_RoundTrip(t *testing.T) {
+	cfg, err := ParseArgs([]string{
+		"--port", "8080",
+		"--image-timeout", "3s",
+		"--precache-rate", "1.5",
+		"--allow-paths", "public,shared",
+		"--upload-warm", "800x600/webp",
+		"--client-hints",
+	})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+
+	for _, name := range []string{"settings.yaml", "settings.json"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			if err := cfg.DumpSettings(path); err != nil {
+				t.Fatalf("DumpSettings() returned error: %v", err)
+			}
+			loaded, err := LoadFile(path)
+			if err != nil {
+				t.Fatalf("LoadFile() returned error: %v", err)
+			}
+			loaded.ConfigFile = ""
+			if !reflect.DeepEqual(loaded, cfg) {
+				t.Errorf("Loaded configuration differs:\n%s\nexpected:\n%s", loaded, cfg)
+			}
+		})
+	}
+}
+
+// Test dumped settings files leave out the secrets
+func Test_DumpSettings_OmitsSecrets(t *testing.T) {
+	cfg, err := ParseArgs([]string{"--cmd-api-key", "api-secret", "--caption-secret", "caption-secret"})
+	if err != nil {
+		t.Fatalf("ParseArgs() returned error: %v", err)
+	}
+
+	for _, name := range []string{"settings.yaml", "settings.json"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			if err := cfg.DumpSettings(path); err != nil {
+				t.Fatalf("DumpSettings() returned error: %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read dump: %v", err)
+			}
+			for _, secret := range []string{"api-secret", "caption-secret", "cmd-api-key"} {
+				if strings.Contains(string(data), secret) {
+					t.Errorf("Dump contains %q:\n%s", secret, data)
+				}
+			}
+			loaded, err := LoadFile(path)
+			if err != nil {
+				t.Fatalf("LoadFile() returned error: %v", err)
+			}
+			if loaded.CommandAPIKey != "" || loaded.CaptionSecret != "" {
+				t.Errorf("Loaded secrets = %q, %q, want none", loaded.CommandAPIKey, loaded.CaptionSecret)
+			}
+		})
+	}
+}
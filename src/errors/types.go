@@ -15,11 +15,13 @@ type ErrorType string
 const (
 	ErrorTypeValidation      ErrorType = "validation"
 	ErrorTypeNotFound        ErrorType = "not_found"
+	ErrorTypeForbidden       ErrorType = "forbidden"
 	ErrorTypeUnsupportedMedia ErrorType = "unsupported_media"
 	ErrorTypeUnprocessable   ErrorType = "unprocessable"
 	ErrorTypeInternal        ErrorType = "internal"
 	ErrorTypeTimeout         ErrorType = "timeout"
 	ErrorTypeConflict        ErrorType = "conflict"
+	ErrorTypePrecondition    ErrorType = "precondition"
 )
 
 var (
@@ -115,6 +117,8 @@ func (e *AppError) HTTPStatus() int {
 		return http.StatusBadRequest
 	case ErrorTypeNotFound:
 		return http.StatusNotFound
+	case ErrorTypeForbidden:
+		return http.StatusForbidden
 	case ErrorTypeUnsupportedMedia:
 		return http.StatusUnsupportedMediaType
 	case ErrorTypeUnprocessable:
@@ -123,6 +127,8 @@ func (e *AppError) HTTPStatus() int {
 		return http.StatusGatewayTimeout
 	case ErrorTypeConflict:
 		return http.StatusConflict
+	case ErrorTypePrecondition:
+		return http.StatusPreconditionFailed
 	case ErrorTypeInternal:
 		fallthrough
 	default:
@@ -137,6 +143,8 @@ func (e *AppError) Code() string {
 		return "VALIDATION_ERROR"
 	case ErrorTypeNotFound:
 		return "NOT_FOUND"
+	case ErrorTypeForbidden:
+		return "FORBIDDEN"
 	case ErrorTypeUnsupportedMedia:
 		return "UNSUPPORTED_MEDIA_TYPE"
 	case ErrorTypeUnprocessable:
@@ -145,6 +153,8 @@ func (e *AppError) Code() string {
 		return "TIMEOUT"
 	case ErrorTypeConflict:
 		return "CONFLICT"
+	case ErrorTypePrecondition:
+		return "PRECONDITION_FAILED"
 	case ErrorTypeInternal:
 		return "INTERNAL_ERROR"
 	default:
@@ -168,6 +178,8 @@ func (e *AppError) UserMessage() string {
 		return "Invalid request parameters"
 	case ErrorTypeNotFound:
 		return "Resource not found"
+	case ErrorTypeForbidden:
+		return "Access denied"
 	case ErrorTypeUnsupportedMedia:
 		return "Unsupported media type"
 	case ErrorTypeUnprocessable:
@@ -176,6 +188,8 @@ func (e *AppError) UserMessage() string {
 		return "Request timeout"
 	case ErrorTypeConflict:
 		return "Resource conflict"
+	case ErrorTypePrecondition:
+		return "Precondition failed"
 	case ErrorTypeInternal:
 		return "Internal server error"
 	default:
@@ -374,6 +388,17 @@ func NewImageNotFoundError(filename string) *AppError {
 	})
 }
 
+// NewAccessDeniedError creates an error for an image that may not be served
+func NewAccessDeniedError(filename string) *AppError {
+	return NewAppError(
+		fmt.Sprintf("Access denied: %s", filename),
+		ErrorTypeForbidden,
+		nil,
+	).WithDetails(map[string]interface{}{
+		"filename": filename,
+	})
+}
+
 // NewCorruptedImageError creates a corrupted image error
 func NewCorruptedImageError(filename string) *AppError {
 	return NewAppError(
@@ -385,6 +410,53 @@ func NewCorruptedImageError(filename string) *AppError {
 	})
 }
 
+// NewEmptyImageError creates an error for a source image file that is empty
+func NewEmptyImageError(filename string) *AppError {
+	return NewAppError(
+		fmt.Sprintf("Image file is empty: %s", filename),
+		ErrorTypeUnprocessable,
+		nil,
+	).WithDetails(map[string]interface{}{
+		"filename": filename,
+	})
+}
+
+// NewFormatMismatchError creates an error for a source image whose content
+// is another format than its extension names
+func NewFormatMismatchError(filename, extension, content string) *AppError {
+	return NewAppError(
+		fmt.Sprintf("Image content does not match its extension: %s is %s, not %s", filename, content, extension),
+		ErrorTypeUnprocessable,
+		nil,
+	).WithDetails(map[string]interface{}{
+		"filename":  filename,
+		"extension": extension,
+		"content":   content,
+	})
+}
+
+// NewTransformError creates an error for a post-processing transform that failed
+func NewTransformError(transform string, cause error) *AppError {
+	return NewAppError(
+		fmt.Sprintf("Image transform failed: %s", transform),
+		ErrorTypeUnprocessable,
+		cause,
+	).WithDetails(map[string]interface{}{
+		"transform": transform,
+	})
+}
+
+// NewProcessingPanicError creates an error for processing that panicked
+func NewProcessingPanicError(filename string, cause error) *AppError {
+	return NewAppError(
+		fmt.Sprintf("Image processing failed: %s", filename),
+		ErrorTypeInternal,
+		cause,
+	).WithDetails(map[string]interface{}{
+		"filename": filename,
+	})
+}
+
 // NewUnsupportedFormatError creates an unsupported format error
 func NewUnsupportedFormatError(format string) *AppError {
 	return NewAppError(
@@ -396,6 +468,30 @@ func NewUnsupportedFormatError(format string) *AppError {
 	})
 }
 
+// NewFormatNotAllowedError creates an error for an output format the
+// configuration does not allow for the image
+func NewFormatNotAllowedError(format string) *AppError {
+	return NewAppError(
+		fmt.Sprintf("Output format not allowed: %s", format),
+		ErrorTypeValidation,
+		nil,
+	).WithDetails(map[string]interface{}{
+		"format": format,
+	})
+}
+
+// NewInvalidSignatureError creates an error for a signed URL whose
+// signature is missing or does not match
+func NewInvalidSignatureError(path string) *AppError {
+	return NewAppError(
+		fmt.Sprintf("Invalid signature: %s", path),
+		ErrorTypeForbidden,
+		nil,
+	).WithDetails(map[string]interface{}{
+		"path": path,
+	})
+}
+
 // NewProcessingError creates a processing error
 func NewProcessingError(message string, cause error) *AppError {
 	return NewAppError(message, ErrorTypeInternal, cause)
@@ -419,6 +515,19 @@ func NewTimeoutError(operation, timeout string) *AppError {
 	})
 }
 
+// NewPreconditionFailedError creates an error for a request whose If-Match
+// does not match the current ETag
+func NewPreconditionFailedError(filename, etag string) *AppError {
+	return NewAppError(
+		fmt.Sprintf("Precondition failed: %s has changed", filename),
+		ErrorTypePrecondition,
+		nil,
+	).WithDetails(map[string]interface{}{
+		"filename": filename,
+		"etag":     etag,
+	})
+}
+
 // WrapFileSystemError wraps a file system error
 func WrapFileSystemError(err error) error {
 	if err == nil {
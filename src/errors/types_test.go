@@ -37,11 +37,13 @@ func TestErrorType_HTTPStatus(t *testing.T) {
 	}{
 		{"Validation error", ErrorTypeValidation, http.StatusBadRequest},
 		{"Not found error", ErrorTypeNotFound, http.StatusNotFound},
+		{"Forbidden error", ErrorTypeForbidden, http.StatusForbidden},
 		{"Unsupported media", ErrorTypeUnsupportedMedia, http.StatusUnsupportedMediaType},
 		{"Unprocessable entity", ErrorTypeUnprocessable, http.StatusUnprocessableEntity},
 		{"Internal error", ErrorTypeInternal, http.StatusInternalServerError},
 		{"Timeout error", ErrorTypeTimeout, http.StatusGatewayTimeout},
 		{"Conflict error", ErrorTypeConflict, http.StatusConflict},
+		{"Precondition error", ErrorTypePrecondition, http.StatusPreconditionFailed},
 	}
 	
 	for _, tt := range tests {
@@ -90,8 +92,10 @@ func TestErrorType_Code(t *testing.T) {
 	}{
 		{"Validation", ErrorTypeValidation, "VALIDATION_ERROR"},
 		{"Not found", ErrorTypeNotFound, "NOT_FOUND"},
+		{"Forbidden", ErrorTypeForbidden, "FORBIDDEN"},
 		{"Unsupported media", ErrorTypeUnsupportedMedia, "UNSUPPORTED_MEDIA_TYPE"},
 		{"Unprocessable", ErrorTypeUnprocessable, "UNPROCESSABLE_ENTITY"},
+		{"Precondition", ErrorTypePrecondition, "PRECONDITION_FAILED"},
 		{"Internal", ErrorTypeInternal, "INTERNAL_ERROR"},
 	}
 	
@@ -194,7 +198,11 @@ func TestImageError_ImageSpecific(t *testing.T) {
 		wantType  ErrorType
 	}{
 		{"Image not found", func() error { return NewImageNotFoundError("test.jpg") }, ErrorTypeNotFound},
+		{"Access denied", func() error { return NewAccessDeniedError("internal/test.jpg") }, ErrorTypeForbidden},
 		{"Corrupted image", func() error { return NewCorruptedImageError("test.jpg") }, ErrorTypeUnprocessable},
+		{"Format mismatch", func() error { return NewFormatMismatchError("photo.png", "png", "jpeg") }, ErrorTypeUnprocessable},
+		{"Transform failed", func() error { return NewTransformError("overlay", errors.New("missing")) }, ErrorTypeUnprocessable},
+		{"Processing panicked", func() error { return NewProcessingPanicError("test.jpg", errors.New("boom")) }, ErrorTypeInternal},
 		{"Unsupported format", func() error { return NewUnsupportedFormatError("bmp") }, ErrorTypeUnsupportedMedia},
 	}
 	
@@ -0,0 +1,86 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrBusy is returned when another git operation holds a repository and
+// the queue for it is full or the wait timed out
+var ErrBusy = errors.New("git operation already in progress")
+
+// RepoLocks serializes git operations per repository, so concurrent pulls
+// never share a working tree. Up to queue operations wait for the running
+// one, each for at most the timeout (0 = until its context is done); the
+// rest are turned away with ErrBusy.
+type RepoLocks struct {
+	mu      sync.Mutex
+	repos   map[string]*repoLock
+	queue   int
+	timeout time.Duration
+}
+
+// repoLock is held by the running operation and counts those waiting
+type repoLock struct {
+	held    chan struct{}
+	waiting int
+}
+
+// NewRepoLocks creates per-repository locks with a bounded queue
+func NewRepoLocks(queue int, timeout time.Duration) *RepoLocks {
+	return &RepoLocks{
+		repos:   make(map[string]*repoLock),
+		queue:   queue,
+		timeout: timeout,
+	}
+}
+
+// Acquire waits for the lock on the repository at dir and returns the
+// function that releases it
+func (l *RepoLocks) Acquire(ctx context.Context, dir string) (func(), error) {
+	key := filepath.Clean(dir)
+
+	l.mu.Lock()
+	lock, ok := l.repos[key]
+	if !ok {
+		lock = &repoLock{held: make(chan struct{}, 1)}
+		l.repos[key] = lock
+	}
+	release := func() { <-lock.held }
+	select {
+	case lock.held <- struct{}{}:
+		l.mu.Unlock()
+		return release, nil
+	default:
+	}
+	if lock.waiting >= l.queue {
+		l.mu.Unlock()
+		return nil, ErrBusy
+	}
+	lock.waiting++
+	l.mu.Unlock()
+
+	defer func() {
+		l.mu.Lock()
+		lock.waiting--
+		l.mu.Unlock()
+	}()
+
+	var expired <-chan time.Time
+	if l.timeout > 0 {
+		timer := time.NewTimer(l.timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case lock.held <- struct{}{}:
+		return release, nil
+	case <-expired:
+		return nil, ErrBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
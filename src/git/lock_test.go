@@ -0,0 +1,49 @@
+package git
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRepoLocks_QueueAndTimeout tests that a held repository queues up to
+// the limit, times out waiters and leaves other repositories free
+func TestRepoLocks_QueueAndTimeout(t *testing.T) {
+	// Arrange
+	locks := NewRepoLocks(1, 100*time.Millisecond)
+	ctx := context.Background()
+	release, err := locks.Acquire(ctx, "/images")
+	require.NoError(t, err)
+
+	// Act & Assert: one waiter times out while a second is turned away
+	waited := make(chan error)
+	go func() {
+		_, err := locks.Acquire(ctx, "/images/")
+		waited <- err
+	}()
+	require.Eventually(t, func() bool {
+		locks.mu.Lock()
+		defer locks.mu.Unlock()
+		return locks.repos["/images"].waiting == 1
+	}, time.Second, time.Millisecond)
+	_, err = locks.Acquire(ctx, "/images")
+	assert.ErrorIs(t, err, ErrBusy)
+	assert.ErrorIs(t, <-waited, ErrBusy)
+
+	// Other repositories are not blocked
+	other, err := locks.Acquire(ctx, "/other")
+	require.NoError(t, err)
+	other()
+
+	// A waiter gets the lock once it is released
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		release()
+	}()
+	release, err = locks.Acquire(ctx, "/images")
+	require.NoError(t, err)
+	release()
+}
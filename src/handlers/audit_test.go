@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"goimgserver/cache"
+	"goimgserver/git"
+	"goimgserver/resolver"
+	"goimgserver/security"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAuditLog_Commands tests that every /cmd call, accepted or rejected,
+// is recorded with its caller, parameters and outcome
+func TestAuditLog_Commands(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	gitOps := &mockGitOperations{isGitRepoResult: true, execGitPullResult: &git.GitPullResult{Success: true, Branch: "main"}}
+	commandHandler := NewCommandHandler(cfg, cacheManager, gitOps)
+	imageHandler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, &mockProcessor{})
+	maintenance := NewMaintenance(cfg)
+
+	var out bytes.Buffer
+	audit := NewAuditLog(&out)
+	router := gin.New()
+	cmdGroup := router.Group("/cmd", audit.Middleware(), security.APIKeyAuthMiddleware(security.NewAPIKeyAuthenticator([]string{"secret-key"})))
+	cmdGroup.POST("/clear", commandHandler.HandleClear)
+	cmdGroup.POST("/gitupdate", commandHandler.HandleGitUpdate)
+	cmdGroup.POST("/warm", imageHandler.HandleWarm)
+	cmdGroup.GET("/info", commandHandler.HandleInfo)
+	cmdGroup.POST("/maintenance", maintenance.HandleMaintenance)
+	cmdGroup.POST("/:name", commandHandler.HandleCommand)
+
+	tests := []struct {
+		method  string
+		url     string
+		body    string
+		key     string
+		command string
+		result  string
+	}{
+		{"POST", "/cmd/clear?namespace=acme", "", "secret-key", "clear", "ok"},
+		{"POST", "/cmd/gitupdate", "", "secret-key", "gitupdate", "ok"},
+		{"POST", "/cmd/warm", `{"url":"/img/test.jpg/300x200/webp"}`, "secret-key", "warm", "ok"},
+		{"GET", "/cmd/info", "", "secret-key", "info", "ok"},
+		{"POST", "/cmd/maintenance", `{"enabled":true}`, "secret-key", "maintenance", "ok"},
+		{"POST", "/cmd/bogus", "", "secret-key", "bogus", "failed"},
+		{"POST", "/cmd/clear", "", "wrong-key", "clear", "denied"},
+	}
+
+	// Act
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+		req.Header.Set("X-API-Key", tt.key)
+		req.RemoteAddr = "192.0.2.7:40000"
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// Assert
+	var entries []map[string]interface{}
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry), scanner.Text())
+		entries = append(entries, entry)
+	}
+	require.Len(t, entries, len(tests))
+
+	for i, tt := range tests {
+		entry := entries[i]
+		assert.Equal(t, "audit", entry["msg"], tt.url)
+		assert.NotEmpty(t, entry["time"], tt.url)
+		assert.Equal(t, "192.0.2.7", entry["ip"], tt.url)
+		assert.Equal(t, tt.method, entry["method"], tt.url)
+		assert.Equal(t, tt.command, entry["command"], tt.url)
+		assert.Equal(t, tt.result, entry["result"], tt.url)
+		assert.Contains(t, entry, "status", tt.url)
+		assert.Contains(t, entry, "duration_ms", tt.url)
+		assert.NotContains(t, out.String(), tt.key)
+		if tt.result == "denied" {
+			assert.Equal(t, "anonymous", entry["identity"], tt.url)
+			assert.Equal(t, float64(http.StatusUnauthorized), entry["status"], tt.url)
+		} else {
+			assert.True(t, strings.HasPrefix(entry["identity"].(string), "key:"), tt.url)
+		}
+	}
+
+	// Parameters are recorded from the query and the JSON body
+	assert.Equal(t, map[string]interface{}{"namespace": []interface{}{"acme"}}, entries[0]["query"])
+	assert.Equal(t, map[string]interface{}{"url": "/img/test.jpg/300x200/webp"}, entries[2]["body"])
+	assert.Equal(t, map[string]interface{}{"enabled": true}, entries[4]["body"])
+
+	// Handlers still read the recorded body
+	assert.True(t, maintenance.Enabled())
+}
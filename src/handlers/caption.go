@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"goimgserver/cache"
+	"goimgserver/processor"
+	"goimgserver/security"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CaptionSegment starts the path of a captioned image, such as an Open
+// Graph image: /img/og/photo.jpg?title=Hello&sig=<signature>
+const CaptionSegment = "og"
+
+// Captioned images are Open Graph sized JPEGs unless the path names
+// dimensions or a format
+const (
+	captionDimensions = "1200x630"
+	captionFormat     = "jpeg"
+)
+
+// errInvalidSignature is returned for a caption URL whose signature is
+// missing or does not match
+var errInvalidSignature = errors.New("invalid signature")
+
+// captionRequest reports whether segments address a captioned image. The
+// og prefix is only reserved while captions are configured, so a group of
+// that name is served as usual otherwise.
+func (h *ImageHandler) captionRequest(segments []string) bool {
+	return h.config.CaptionSecret != "" && len(segments) > 1 && segments[0] == CaptionSegment
+}
+
+// parseCaption checks the signature of a captioned image request and
+// returns its caption, from the title, position, size and color query
+// parameters, with the image path segments after the og prefix. The
+// signature covers those segments and every query parameter, so neither
+// the text nor the layout can be changed without the secret.
+func (h *ImageHandler) parseCaption(c *gin.Context, segments []string) ([]string, processor.Caption, error) {
+	segments = segments[1:]
+	query := c.Request.URL.Query()
+	if !security.ValidURLSignature(h.config.CaptionSecret, strings.Join(segments, "/"), query) {
+		return nil, processor.Caption{}, errInvalidSignature
+	}
+
+	caption := processor.Caption{
+		Text:     strings.TrimSpace(query.Get("title")),
+		Position: processor.CaptionPosition(query.Get("position")),
+		Color:    strings.ToLower(query.Get("color")),
+	}
+	if size := query.Get("size"); size != "" {
+		var err error
+		if caption.Size, err = strconv.Atoi(size); err != nil {
+			return nil, processor.Caption{}, processor.ErrInvalidCaption
+		}
+	}
+	if caption.Text == "" {
+		return nil, processor.Caption{}, processor.ErrInvalidCaption
+	}
+	if err := caption.Validate(); err != nil {
+		return nil, processor.Caption{}, err
+	}
+
+	_, paramSegments := h.parsePathAndParams(segments)
+	paramSegments = h.withQueryParams(paramSegments, query)
+	if !dimensionsRequested(paramSegments) {
+		segments = append(segments, captionDimensions)
+	}
+	if !formatRequested(paramSegments) {
+		segments = append(segments, captionFormat)
+	}
+	return segments, caption, nil
+}
+
+// withCaption adds the caption to the rendition parameters. Captioned
+// renditions are always rendered, never the stored original.
+func withCaption(params cache.ProcessingParams, caption processor.Caption) cache.ProcessingParams {
+	params.Caption = caption.Text
+	params.CaptionPosition = string(caption.Position)
+	if params.CaptionPosition == "" {
+		params.CaptionPosition = string(processor.CaptionBottom)
+	}
+	params.CaptionSize = caption.Size
+	if params.CaptionSize == 0 {
+		params.CaptionSize = processor.DefaultCaptionSize
+	}
+	params.CaptionColor = caption.Color
+	if params.CaptionColor == "" {
+		params.CaptionColor = processor.DefaultCaptionColor
+	}
+	params.Original = false
+	return params
+}
+
+// captionKey distinguishes captioned renditions for request coalescing
+func captionKey(params cache.ProcessingParams) string {
+	if params.Caption == "" {
+		return ""
+	}
+	return fmt.Sprintf("|caption|%s|%d|%s|%q", params.CaptionPosition, params.CaptionSize, params.CaptionColor, params.Caption)
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"goimgserver/config"
+	"goimgserver/processor"
+	"goimgserver/security"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCaptionSecret = "caption-secret"
+
+// signedCaptionURL returns the signed /img/og URL of path with the query
+func signedCaptionURL(path string, query url.Values) string {
+	query.Set(security.SignatureParam, security.SignURL(testCaptionSecret, path, query))
+	return "/img/" + CaptionSegment + "/" + path + "?" + query.Encode()
+}
+
+// withCaptionSecret signs captions with testCaptionSecret
+func withCaptionSecret(cfg *config.Config) {
+	cfg.CaptionSecret = testCaptionSecret
+}
+
+// TestImageHandler_GET_Caption tests that a signed caption URL renders the
+// caption as an Open Graph image, caches it per text and layout, and
+// leaves explicit dimensions and formats alone
+func TestImageHandler_GET_Caption(t *testing.T) {
+	// Arrange
+	router, _, proc := setupTestRouter(t, withCaptionSecret)
+	proc.render = true
+
+	// Act
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", signedCaptionURL("test.jpg", url.Values{"title": {"Hello"}}), nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Len(t, proc.calls, 1)
+	opts := proc.calls[0]
+	assert.Equal(t, 1200, opts.Width)
+	assert.Equal(t, 630, opts.Height)
+	assert.Equal(t, processor.FormatJPEG, opts.Format)
+	assert.Equal(t, processor.Caption{Text: "Hello", Position: processor.CaptionBottom, Size: processor.DefaultCaptionSize, Color: processor.DefaultCaptionColor}, opts.Caption)
+
+	// The same caption and layout are cached, other texts and layouts are not
+	pngURL := signedCaptionURL("cats/cat_white.jpg/600x315/png", url.Values{"title": {"Hello"}, "position": {"top"}, "size": {"32"}, "color": {"000000"}})
+	for _, tt := range []struct {
+		url         string
+		cacheStatus string
+	}{
+		{pngURL, cacheMiss},
+		{pngURL, cacheHit},
+		{signedCaptionURL("cats/cat_white.jpg/600x315/png", url.Values{"title": {"Hello!"}, "position": {"top"}, "size": {"32"}, "color": {"000000"}}), cacheMiss},
+		{signedCaptionURL("cats/cat_white.jpg/600x315/png", url.Values{"title": {"Hello"}, "position": {"center"}, "size": {"32"}, "color": {"000000"}}), cacheMiss},
+		{signedCaptionURL("cats/cat_white.jpg/600x315/png", url.Values{}), ""},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+		if tt.cacheStatus == "" {
+			assert.Equal(t, http.StatusBadRequest, w.Code, "a caption needs a title")
+			continue
+		}
+		require.Equal(t, http.StatusOK, w.Code, tt.url)
+		assert.Equal(t, tt.cacheStatus, w.Header().Get("X-Cache"), tt.url)
+	}
+	last := proc.calls[len(proc.calls)-1]
+	assert.Equal(t, 600, last.Width)
+	assert.Equal(t, processor.FormatPNG, last.Format)
+	assert.Equal(t, processor.Caption{Text: "Hello", Position: processor.CaptionCenter, Size: 32, Color: "000000"}, last.Caption)
+
+	// The uncaptioned image is cached apart
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/cats/cat_white.jpg/600x315/png", nil))
+	assert.Equal(t, cacheMiss, w.Header().Get("X-Cache"))
+	assert.Empty(t, proc.calls[len(proc.calls)-1].Caption.Text)
+}
+
+// TestImageHandler_GET_Caption_Rejected tests caption URLs that are not
+// signed with the secret or whose caption cannot be drawn
+func TestImageHandler_GET_Caption_Rejected(t *testing.T) {
+	signed := signedCaptionURL("test.jpg", url.Values{"title": {"Hello"}})
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+	}{
+		{"Unsigned", "/img/og/test.jpg?title=Hello", http.StatusForbidden},
+		{"Changed text", strings.Replace(signed, "title=Hello", "title=Goodbye", 1), http.StatusForbidden},
+		{"Added parameter", signed + "&size=200", http.StatusForbidden},
+		{"Other image", strings.Replace(signed, "test.jpg", "cats/cat_white.jpg", 1), http.StatusForbidden},
+		{"Too long", signedCaptionURL("test.jpg", url.Values{"title": {strings.Repeat("a", processor.MaxCaptionLength+1)}}), http.StatusBadRequest},
+		{"Control character", signedCaptionURL("test.jpg", url.Values{"title": {"two\nlines"}}), http.StatusBadRequest},
+		{"Size", signedCaptionURL("test.jpg", url.Values{"title": {"Hello"}, "size": {"huge"}}), http.StatusBadRequest},
+		{"Position", signedCaptionURL("test.jpg", url.Values{"title": {"Hello"}, "position": {"left"}}), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			router, _, proc := setupTestRouter(t, withCaptionSecret)
+
+			// Act
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+			// Assert
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Empty(t, proc.calls)
+		})
+	}
+}
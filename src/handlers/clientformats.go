@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"goimgserver/cache"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// clientFamily returns the browser family and major version a User-Agent
+// names, "" for clients that are not recognized. Browsers on iOS other than
+// Safari and Chromium-based browsers that are not Chrome or Edge are left
+// unrecognized rather than guessed.
+func clientFamily(userAgent string) (string, int) {
+	switch {
+	case strings.Contains(userAgent, "MSIE "):
+		return "ie", uaVersion(userAgent, "MSIE ")
+	case strings.Contains(userAgent, "Trident/"):
+		return "ie", uaVersion(userAgent, "rv:")
+	case strings.Contains(userAgent, "Edge/"):
+		return "edge", uaVersion(userAgent, "Edge/")
+	case strings.Contains(userAgent, "Edg/"):
+		return "edge", uaVersion(userAgent, "Edg/")
+	case strings.Contains(userAgent, "Firefox/"):
+		return "firefox", uaVersion(userAgent, "Firefox/")
+	case strings.Contains(userAgent, "OPR/"), strings.Contains(userAgent, "CriOS/"), strings.Contains(userAgent, "FxiOS/"):
+		return "", 0
+	case strings.Contains(userAgent, "Chrome/"):
+		return "chrome", uaVersion(userAgent, "Chrome/")
+	case strings.Contains(userAgent, "Safari/") && strings.Contains(userAgent, "Version/") && !strings.Contains(userAgent, "Android"):
+		return "safari", uaVersion(userAgent, "Version/")
+	}
+	return "", 0
+}
+
+// uaVersion returns the major version following token in userAgent, 0 when
+// there is none
+func uaVersion(userAgent, token string) int {
+	_, rest, _ := strings.Cut(userAgent, token)
+	end := strings.IndexFunc(rest, func(r rune) bool { return r < '0' || r > '9' })
+	if end >= 0 {
+		rest = rest[:end]
+	}
+	major, _ := strconv.Atoi(rest)
+	return major
+}
+
+// applyClientFormats restricts the output format of a request that did not
+// ask for one to those the client format rules allow for its User-Agent,
+// snapping to the first that can be encoded. GIF passthrough is kept, as
+// every client displays GIF. It reports whether the format depends on the
+// User-Agent, so the response must vary on it.
+func (h *ImageHandler) applyClientFormats(r *http.Request, params cache.ProcessingParams) (cache.ProcessingParams, bool) {
+	if len(h.config.ClientFormatRules) == 0 || params.Format == gifFormat {
+		return params, false
+	}
+	userAgent := r.UserAgent()
+	family, major := clientFamily(userAgent)
+	allowed := h.config.ClientFormats(userAgent, family, major)
+	if len(allowed) == 0 || slices.ContainsFunc(allowed, func(f string) bool { return sameFormat(f, params.Format) }) {
+		return params, true
+	}
+	for _, format := range allowed {
+		if format != gifFormat && format != pdfFormat {
+			params.Format = format
+			break
+		}
+	}
+	return h.applyDefaults(params), true
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"goimgserver/cache"
+	"goimgserver/processor"
+	"goimgserver/resolver"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// User-Agents of clients the default client format rules treat differently
+const (
+	safari13UA = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_6) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/13.1.2 Safari/605.1.15"
+	safari17UA = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15"
+	chromeUA   = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+	ie11UA     = "Mozilla/5.0 (Windows NT 10.0; Trident/7.0; rv:11.0) like Gecko"
+)
+
+func TestClientFamily(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		family    string
+		major     int
+	}{
+		{safari13UA, "safari", 13},
+		{safari17UA, "safari", 17},
+		{chromeUA, "chrome", 124},
+		{ie11UA, "ie", 11},
+		{"Mozilla/4.0 (compatible; MSIE 8.0; Windows NT 6.1; Trident/4.0)", "ie", 8},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.0.0", "edge", 124},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:125.0) Gecko/20100101 Firefox/125.0", "firefox", 125},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 13_7 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/13.1.2 Mobile/15E148 Safari/604.1", "safari", 13},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 13_7 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/86.0.4240.93 Mobile/15E148 Safari/604.1", "", 0},
+		{"Mozilla/5.0 (Linux; U; Android 4.0.3) AppleWebKit/534.30 (KHTML, like Gecko) Version/4.0 Mobile Safari/534.30", "", 0},
+		{"curl/8.5.0", "", 0},
+		{"", "", 0},
+	}
+
+	for _, tt := range tests {
+		family, major := clientFamily(tt.userAgent)
+		assert.Equal(t, tt.family, family, tt.userAgent)
+		assert.Equal(t, tt.major, major, tt.userAgent)
+	}
+}
+
+// TestImageHandler_GET_ClientFormats tests that clients the rules cannot
+// serve the default format get the first format they can display despite a
+// permissive Accept header, while other clients and explicit formats are
+// unaffected
+func TestImageHandler_GET_ClientFormats(t *testing.T) {
+	tests := []struct {
+		name       string
+		rules      []string
+		userAgent  string
+		url        string
+		wantFormat processor.ImageFormat
+		wantVary   bool
+	}{
+		{"Old Safari gets JPEG", []string{"safari<14=jpeg|png", "ie=jpeg|png"}, safari13UA, "/img/test.jpg/300x250", processor.FormatJPEG, true},
+		{"IE gets JPEG", []string{"safari<14=jpeg|png", "ie=jpeg|png"}, ie11UA, "/img/test.jpg/300x250", processor.FormatJPEG, true},
+		{"Current Safari keeps WebP", []string{"safari<14=jpeg|png", "ie=jpeg|png"}, safari17UA, "/img/test.jpg/300x250", processor.FormatWebP, true},
+		{"Chrome keeps WebP", []string{"safari<14=jpeg|png", "ie=jpeg|png"}, chromeUA, "/img/test.jpg/300x250", processor.FormatWebP, true},
+		{"Unknown client keeps WebP", []string{"safari<14=jpeg|png", "ie=jpeg|png"}, "", "/img/test.jpg/300x250", processor.FormatWebP, true},
+		{"Explicit format is served", []string{"safari<14=jpeg|png", "ie=jpeg|png"}, safari13UA, "/img/test.jpg/300x250/webp", processor.FormatWebP, false},
+		{"Allowed default is kept", []string{"safari<14=png|webp"}, safari13UA, "/img/test.jpg/300x250", processor.FormatWebP, true},
+		{"Override wins", []string{"safari<14=webp", "safari=png"}, safari13UA, "/img/test.jpg/300x250", processor.FormatWebP, true},
+		{"User-Agent substring", []string{"ua:Trident/7.0=png"}, ie11UA, "/img/test.jpg/300x250", processor.FormatPNG, true},
+		{"Off", nil, safari13UA, "/img/test.jpg/300x250", processor.FormatWebP, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+			cfg.ClientFormatRules = tt.rules
+
+			cacheManager, err := cache.NewManager(cacheDir)
+			require.NoError(t, err)
+			proc := &recordingProcessor{}
+			handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+			router := gin.New()
+			router.GET("/img/*path", handler.ServeImage)
+
+			// Act
+			req := httptest.NewRequest("GET", tt.url, nil)
+			req.Header.Set("Accept", "*/*")
+			req.Header.Set("User-Agent", tt.userAgent)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			// Assert
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.wantFormat, proc.opts.Format)
+			assert.Equal(t, tt.wantVary, slices.Contains(w.Header().Values("Vary"), "User-Agent"))
+		})
+	}
+}
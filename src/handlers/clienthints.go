@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"goimgserver/cache"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Client hint headers, the Sec-CH- names first. Both report physical
+// pixels: Width is the layout width of the image times the DPR.
+var (
+	widthHints = []string{"Sec-CH-Width", "Width"}
+	dprHints   = []string{"Sec-CH-DPR", "DPR"}
+)
+
+// acceptCH asks browsers to send the hints with image requests
+const acceptCH = "Sec-CH-Width, Sec-CH-DPR, Width, DPR"
+
+// varyClientHints lists the request headers a hinted response depends on
+const varyClientHints = "Sec-CH-Width, Width, Sec-CH-DPR, DPR"
+
+// clientHint returns the first of the headers r carries as a positive number
+func clientHint(r *http.Request, headers []string) (float64, bool) {
+	for _, header := range headers {
+		value := strings.TrimSpace(r.Header.Get(header))
+		if value == "" {
+			continue
+		}
+		hint, err := strconv.ParseFloat(value, 64)
+		if err != nil || hint <= 0 || math.IsInf(hint, 0) {
+			return 0, false
+		}
+		return hint, true
+	}
+	return 0, false
+}
+
+// applyClientHints sizes params from the Width and DPR hints of r. Requests
+// without dimensions take their width from the Width hint and keep the
+// aspect ratio; requested dimensions are scaled by the DPR hint. Widths are
+// rounded up to the configured step and kept within the dimension bounds.
+func (h *ImageHandler) applyClientHints(r *http.Request, params cache.ProcessingParams, dimensions bool) cache.ProcessingParams {
+	if !dimensions {
+		if width, ok := clientHint(r, widthHints); ok {
+			params.Width = h.snapWidth(width)
+			params.Height = 0
+		}
+		return params
+	}
+
+	dpr, ok := clientHint(r, dprHints)
+	if !ok || dpr == 1 {
+		return params
+	}
+	width := h.snapWidth(float64(params.Width) * dpr)
+	if params.Height > 0 {
+		height := int(math.Round(float64(params.Height) * float64(width) / float64(params.Width)))
+		params.Height = min(max(height, MinDimension), MaxDimension)
+	}
+	params.Width = width
+	return params
+}
+
+// snapWidth rounds width up to a multiple of the client hints step within
+// the dimension bounds
+func (h *ImageHandler) snapWidth(width float64) int {
+	step := max(h.config.ClientHintsStep, 1)
+	snapped := int(math.Ceil(min(width, MaxDimension)/float64(step))) * step
+	return min(max(snapped, MinDimension), MaxDimension)
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"goimgserver/cache"
+	"goimgserver/resolver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestImageHandler_GET_ClientHints tests renditions are sized from the Width and DPR hints
+func TestImageHandler_GET_ClientHints(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		headers map[string]string
+		width   int
+		height  int
+	}{
+		{"No hints", "/img/test.jpg/png", nil, DefaultWidth, DefaultHeight},
+		{"Width snapped to step", "/img/test.jpg/png", map[string]string{"Sec-CH-Width": "375"}, 400, 0},
+		{"Legacy Width", "/img/test.jpg/png", map[string]string{"Width": "820"}, 900, 0},
+		{"Width clamped", "/img/test.jpg/png", map[string]string{"Sec-CH-Width": "9000"}, MaxDimension, 0},
+		{"Width ignored with dimensions", "/img/test.jpg/300x200/png", map[string]string{"Sec-CH-Width": "750"}, 300, 200},
+		{"DPR scales dimensions", "/img/test.jpg/300x200/png", map[string]string{"Sec-CH-DPR": "2"}, 600, 400},
+		{"DPR snapped keeps aspect", "/img/test.jpg/300x200/png", map[string]string{"DPR": "1.5"}, 500, 333},
+		{"DPR scales width only", "/img/test.jpg/300/png", map[string]string{"Sec-CH-DPR": "3"}, 900, 0},
+		{"Invalid hint ignored", "/img/test.jpg/png", map[string]string{"Sec-CH-Width": "wide"}, DefaultWidth, DefaultHeight},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+			cfg.ClientHints = true
+			cfg.ClientHintsStep = 100
+
+			cacheManager, err := cache.NewManager(cacheDir)
+			require.NoError(t, err)
+			proc := &recordingProcessor{}
+			handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+			router := gin.New()
+			router.GET("/img/*path", handler.ServeImage)
+
+			// Act
+			req := httptest.NewRequest("GET", tt.url, nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			// Assert
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.width, proc.opts.Width)
+			assert.Equal(t, tt.height, proc.opts.Height)
+			assert.Equal(t, acceptCH, w.Header().Get("Accept-CH"))
+			assert.Equal(t, varyClientHints, w.Header().Get("Vary"))
+		})
+	}
+}
+
+// TestImageHandler_GET_ClientHintsDisabled tests hints are ignored unless configured
+func TestImageHandler_GET_ClientHintsDisabled(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	proc := &recordingProcessor{}
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	// Act
+	req := httptest.NewRequest("GET", "/img/test.jpg/300x200/png", nil)
+	req.Header.Set("Sec-CH-DPR", "2")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Assert
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 300, proc.opts.Width)
+	assert.Equal(t, 200, proc.opts.Height)
+	assert.Empty(t, w.Header().Get("Accept-CH"))
+	assert.Empty(t, w.Header().Get("Vary"))
+}
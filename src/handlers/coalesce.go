@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProcessingStats is a snapshot of request coalescing counters
+type ProcessingStats struct {
+	Coalesced   int64 `json:"coalesced"`   // Requests that shared another request's processing
+	Independent int64 `json:"independent"` // Requests that processed on their own
+	InFlight    int64 `json:"in_flight"`   // Processings currently running
+	QueueDepth  int64 `json:"queue_depth"` // Requests waiting on a running processing
+	Cancelled   int64 `json:"cancelled"`   // Requests whose client disconnected before the processing finished
+
+	LoadShedding   bool  `json:"load_shedding"`   // Whether new renditions are encoded at reduced quality
+	QualityReduced int64 `json:"quality_reduced"` // Responses encoded at reduced quality under load
+}
+
+// processingCall is a processing shared by identical requests
+type processingCall struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int // Callers still waiting, guarded by the group mutex
+	result  *rendition
+	err     error
+}
+
+// processingGroup coalesces identical concurrent processings so each
+// rendition is produced once, and counts how much work that saves
+type processingGroup struct {
+	mu    sync.Mutex
+	calls map[string]*processingCall
+
+	coalesced   atomic.Int64
+	independent atomic.Int64
+	inFlight    atomic.Int64
+	waiting     atomic.Int64
+	cancelled   atomic.Int64
+}
+
+// newProcessingGroup creates an empty processing group
+func newProcessingGroup() *processingGroup {
+	return &processingGroup{calls: make(map[string]*processingCall)}
+}
+
+// Do runs fn once per key at a time. Callers arriving while fn runs wait
+// for and share its result; shared reports whether that happened.
+func (g *processingGroup) Do(key string, fn func() (*rendition, error)) (result *rendition, shared bool, err error) {
+	return g.DoContext(context.Background(), key, func(context.Context) (*rendition, error) {
+		return fn()
+	})
+}
+
+// DoContext is Do for callers that may give up. A caller whose ctx ends
+// stops waiting and gets the context's error. The context passed to fn is
+// cancelled only once every caller sharing the processing has given up.
+func (g *processingGroup) DoContext(ctx context.Context, key string, fn func(context.Context) (*rendition, error)) (result *rendition, shared bool, err error) {
+	g.mu.Lock()
+	call, shared := g.calls[key]
+	if shared {
+		call.waiters++
+		g.mu.Unlock()
+		g.coalesced.Add(1)
+		g.waiting.Add(1)
+		defer g.waiting.Add(-1)
+	} else {
+		callCtx, cancel := context.WithCancel(context.Background())
+		call = &processingCall{done: make(chan struct{}), cancel: cancel, waiters: 1}
+		g.calls[key] = call
+		g.mu.Unlock()
+		g.independent.Add(1)
+		g.inFlight.Add(1)
+		go g.run(callCtx, key, call, fn)
+	}
+
+	select {
+	case <-call.done:
+		return call.result, shared, call.err
+	case <-ctx.Done():
+		g.leave(key, call)
+		if errors.Is(ctx.Err(), context.Canceled) {
+			g.cancelled.Add(1)
+		}
+		return nil, shared, ctx.Err()
+	}
+}
+
+// run executes a processing and releases its waiters
+func (g *processingGroup) run(ctx context.Context, key string, call *processingCall, fn func(context.Context) (*rendition, error)) {
+	defer func() {
+		if p := recover(); p != nil {
+			call.err = fmt.Errorf("processing panicked: %v", p)
+		}
+		g.inFlight.Add(-1)
+		g.mu.Lock()
+		if g.calls[key] == call {
+			delete(g.calls, key)
+		}
+		g.mu.Unlock()
+		call.cancel()
+		close(call.done)
+	}()
+
+	call.result, call.err = fn(ctx)
+}
+
+// leave removes a caller that gave up and cancels the processing when
+// nobody is left waiting, so later callers start a fresh one
+func (g *processingGroup) leave(key string, call *processingCall) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	call.waiters--
+	if call.waiters == 0 {
+		call.cancel()
+		if g.calls[key] == call {
+			delete(g.calls, key)
+		}
+	}
+}
+
+// Stats returns the current coalescing counters
+func (g *processingGroup) Stats() ProcessingStats {
+	return ProcessingStats{
+		Coalesced:   g.coalesced.Load(),
+		Independent: g.independent.Load(),
+		InFlight:    g.inFlight.Load(),
+		QueueDepth:  g.waiting.Load(),
+		Cancelled:   g.cancelled.Load(),
+	}
+}
+
+// ProcessingStats returns the handler's request coalescing and load
+// shedding counters
+func (h *ImageHandler) ProcessingStats() ProcessingStats {
+	stats := h.processing.Stats()
+	stats.LoadShedding = h.loadShed.active.Load()
+	stats.QualityReduced = h.loadShed.reduced.Load()
+	return stats
+}
+
+// HandleDebugProcessing handles the /debug/processing endpoint
+func (h *ImageHandler) HandleDebugProcessing(c *gin.Context) {
+	c.JSON(http.StatusOK, h.ProcessingStats())
+}
+
+// HandleProcessingMetrics exposes the coalescing counters in the
+// Prometheus text exposition format
+func (h *ImageHandler) HandleProcessingMetrics(c *gin.Context) {
+	stats := h.ProcessingStats()
+
+	var sb strings.Builder
+	writeMetric := func(name, kind, help string, value int64) {
+		sb.WriteString(fmt.Sprintf("# HELP %s %s\n", name, help))
+		sb.WriteString(fmt.Sprintf("# TYPE %s %s\n", name, kind))
+		sb.WriteString(fmt.Sprintf("%s %d\n", name, value))
+	}
+	writeMetric("goimgserver_processing_coalesced_total", "counter", "Requests that shared an in-flight processing.", stats.Coalesced)
+	writeMetric("goimgserver_processing_independent_total", "counter", "Requests that ran their own processing.", stats.Independent)
+	writeMetric("goimgserver_processing_in_flight", "gauge", "Processings currently running.", stats.InFlight)
+	writeMetric("goimgserver_processing_queue_depth", "gauge", "Requests waiting on an in-flight processing.", stats.QueueDepth)
+	writeMetric("goimgserver_processing_cancelled_total", "counter", "Requests whose client disconnected before processing finished.", stats.Cancelled)
+	shedding := int64(0)
+	if stats.LoadShedding {
+		shedding = 1
+	}
+	writeMetric("goimgserver_load_shedding", "gauge", "Whether new renditions are encoded at reduced quality under load.", shedding)
+	writeMetric("goimgserver_quality_reduced_total", "counter", "Responses encoded at reduced quality under load.", stats.QualityReduced)
+	h.writeRouteMetrics(&sb)
+
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(sb.String()))
+}
@@ -0,0 +1,474 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"goimgserver/cache"
+	"goimgserver/precache"
+	"goimgserver/processor"
+	"goimgserver/resolver"
+	"goimgserver/security"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingProcessor holds every Process call until release is closed
+type blockingProcessor struct {
+	mockProcessor
+	release chan struct{}
+	calls   atomic.Int64
+}
+
+func (p *blockingProcessor) Process(data []byte, opts processor.ProcessOptions) ([]byte, error) {
+	p.calls.Add(1)
+	<-p.release
+	return data, nil
+}
+
+// waitForQueueDepth polls until depth requests wait on a shared processing
+func waitForQueueDepth(t *testing.T, handler *ImageHandler, depth int64) {
+	deadline := time.Now().Add(5 * time.Second)
+	for handler.ProcessingStats().QueueDepth < depth {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for queue depth %d, stats %+v", depth, handler.ProcessingStats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestProcessingGroup_Coalesces tests that concurrent calls for one key share a single run
+func TestProcessingGroup_Coalesces(t *testing.T) {
+	// Arrange
+	group := newProcessingGroup()
+	release := make(chan struct{})
+	var runs atomic.Int64
+	const callers = 5
+
+	// Act
+	var wg sync.WaitGroup
+	results := make([]*rendition, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _, _ = group.Do("key", func() (*rendition, error) {
+				runs.Add(1)
+				<-release
+				return &rendition{data: []byte("shared")}, nil
+			})
+		}(i)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for group.Stats().QueueDepth < callers-1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, int64(1), group.Stats().InFlight)
+	close(release)
+	wg.Wait()
+
+	// Assert
+	stats := group.Stats()
+	assert.Equal(t, int64(1), runs.Load())
+	assert.Equal(t, int64(1), stats.Independent)
+	assert.Equal(t, int64(callers-1), stats.Coalesced)
+	assert.Equal(t, int64(0), stats.InFlight)
+	assert.Equal(t, int64(0), stats.QueueDepth)
+	for _, r := range results {
+		require.NotNil(t, r)
+		assert.Equal(t, "shared", string(r.data))
+	}
+}
+
+// TestProcessingGroup_DistinctKeys tests that different keys process independently
+func TestProcessingGroup_DistinctKeys(t *testing.T) {
+	group := newProcessingGroup()
+
+	for _, key := range []string{"a", "b", "a"} {
+		_, shared, err := group.Do(key, func() (*rendition, error) {
+			return &rendition{}, nil
+		})
+		require.NoError(t, err)
+		assert.False(t, shared)
+	}
+
+	stats := group.Stats()
+	assert.Equal(t, int64(3), stats.Independent)
+	assert.Equal(t, int64(0), stats.Coalesced)
+}
+
+// TestProcessingGroup_DoContext_CancelsWhenAllCallersLeave tests that a
+// processing is cancelled only after every caller sharing it has given up
+func TestProcessingGroup_DoContext_CancelsWhenAllCallersLeave(t *testing.T) {
+	// Arrange
+	group := newProcessingGroup()
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	fn := func(ctx context.Context) (*rendition, error) {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	}
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	secondCtx, cancelSecond := context.WithCancel(context.Background())
+
+	// Act
+	errs := make(chan error, 2)
+	go func() {
+		_, _, err := group.DoContext(firstCtx, "key", fn)
+		errs <- err
+	}()
+	<-started
+	go func() {
+		_, _, err := group.DoContext(secondCtx, "key", fn)
+		errs <- err
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for group.Stats().QueueDepth < 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancelFirst()
+	firstErr := <-errs
+
+	// Assert - the second caller keeps the processing alive
+	assert.ErrorIs(t, firstErr, context.Canceled)
+	select {
+	case <-cancelled:
+		t.Fatal("processing cancelled while a caller was still waiting")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	cancelSecond()
+	assert.ErrorIs(t, <-errs, context.Canceled)
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("processing not cancelled after every caller left")
+	}
+}
+
+// TestImageHandler_GET_ProcessingTimeout tests that a request whose deadline
+// passes during processing gets a timeout error
+func TestImageHandler_GET_ProcessingTimeout(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cfg.ImageTimeout = 50 * time.Millisecond
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+
+	proc := &blockingProcessor{release: make(chan struct{})}
+	defer close(proc.release)
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ImageTimeout)
+	defer cancel()
+	req := httptest.NewRequest("GET", "/img/test.jpg/800x600/jpeg", nil).WithContext(ctx)
+
+	// Act
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Assert
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "TIMEOUT", body["code"])
+	assert.Equal(t, int64(1), proc.calls.Load())
+}
+
+// TestImageHandler_GET_ClientDisconnect tests that a request whose client
+// goes away returns at once, is counted and leaves nothing in the cache
+func TestImageHandler_GET_ClientDisconnect(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+
+	proc := &blockingProcessor{release: make(chan struct{})}
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", "/img/test.jpg/800x600/jpeg", nil).WithContext(ctx)
+
+	// Act: the client disconnects while its image is processed
+	w := httptest.NewRecorder()
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		router.ServeHTTP(w, req)
+	}()
+	require.Eventually(t, func() bool { return proc.calls.Load() == 1 }, 5*time.Second, time.Millisecond)
+	cancel()
+
+	// Assert
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request did not return after its client disconnected")
+	}
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, int64(1), handler.ProcessingStats().Cancelled)
+
+	// The abandoned processing finishes without caching its result
+	close(proc.release)
+	require.Eventually(t, func() bool { return handler.ProcessingStats().InFlight == 0 }, 5*time.Second, time.Millisecond)
+	var cached []string
+	require.NoError(t, filepath.WalkDir(cacheDir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			cached = append(cached, path)
+		}
+		return err
+	}))
+	assert.Empty(t, cached)
+}
+
+// TestImageHandler_GET_TimeoutMiddleware tests the image route behind the
+// timeout middleware answers on time while processing is still running
+func TestImageHandler_GET_TimeoutMiddleware(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+
+	proc := &blockingProcessor{release: make(chan struct{})}
+	defer close(proc.release)
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+	router := gin.New()
+	router.GET("/img/*path", security.TimeoutMiddleware(50*time.Millisecond), handler.ServeImage)
+
+	// Act
+	start := time.Now()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg/800x600/jpeg", nil))
+
+	// Assert
+	assert.Equal(t, http.StatusRequestTimeout, w.Code)
+	assert.Contains(t, w.Body.String(), "TIMEOUT")
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, int64(0), handler.ProcessingStats().QueueDepth)
+}
+
+// TestImageHandler_GET_ConcurrentIdenticalRequests tests that identical requests are coalesced
+func TestImageHandler_GET_ConcurrentIdenticalRequests(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+
+	proc := &blockingProcessor{release: make(chan struct{})}
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+	const requests = 4
+
+	// Act
+	var wg sync.WaitGroup
+	codes := make([]int, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg/800x600/jpeg", nil))
+			codes[i] = w.Code
+		}(i)
+	}
+	waitForQueueDepth(t, handler, requests-1)
+	close(proc.release)
+	wg.Wait()
+
+	// Assert
+	for _, code := range codes {
+		assert.Equal(t, http.StatusOK, code)
+	}
+	stats := handler.ProcessingStats()
+	assert.Equal(t, int64(1), proc.calls.Load())
+	assert.Equal(t, int64(requests-1), stats.Coalesced)
+	assert.Equal(t, int64(1), stats.Independent)
+}
+
+// TestImageHandler_GET_ConcurrentConditionalRequests tests that conditional and
+// unconditional requests for a cold rendition share one processing and each
+// get the answer for their own validator
+func TestImageHandler_GET_ConcurrentConditionalRequests(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+
+	proc := &blockingProcessor{release: make(chan struct{})}
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+	_, etag := handler.currentETag(httptest.NewRequest("DELETE", "/img/test.jpg/800x600/jpeg", nil), []string{"test.jpg", "800x600", "jpeg"})
+	require.NotEmpty(t, etag)
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+	validators := []string{"", etag, `"stale"`, `"stale", W/` + etag, "", `"other"`}
+	expected := []int{http.StatusOK, http.StatusNotModified, http.StatusOK, http.StatusNotModified, http.StatusOK, http.StatusOK}
+
+	// Act
+	var wg sync.WaitGroup
+	responses := make([]*httptest.ResponseRecorder, len(validators))
+	for i, validator := range validators {
+		wg.Add(1)
+		go func(i int, validator string) {
+			defer wg.Done()
+			req := httptest.NewRequest("GET", "/img/test.jpg/800x600/jpeg", nil)
+			if validator != "" {
+				req.Header.Set("If-None-Match", validator)
+			}
+			responses[i] = httptest.NewRecorder()
+			router.ServeHTTP(responses[i], req)
+		}(i, validator)
+	}
+	waitForQueueDepth(t, handler, int64(len(validators)-1))
+	close(proc.release)
+	wg.Wait()
+
+	// Assert
+	assert.Equal(t, int64(1), proc.calls.Load())
+	assert.Equal(t, int64(len(validators)-1), handler.ProcessingStats().Coalesced)
+	for i, w := range responses {
+		assert.Equal(t, expected[i], w.Code, "validator %q", validators[i])
+		assert.Equal(t, etag, w.Header().Get("ETag"))
+		if expected[i] == http.StatusNotModified {
+			assert.Empty(t, w.Body.Bytes())
+		} else {
+			assert.NotEmpty(t, w.Body.Bytes())
+		}
+	}
+
+	// Once cached, the same validators are answered without processing
+	for i, validator := range validators {
+		req := httptest.NewRequest("GET", "/img/test.jpg/800x600/jpeg", nil)
+		if validator != "" {
+			req.Header.Set("If-None-Match", validator)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, expected[i], w.Code, "cached, validator %q", validators[i])
+	}
+	assert.Equal(t, int64(1), proc.calls.Load())
+}
+
+// TestDebugProcessing_Endpoints tests the JSON and Prometheus outputs behind auth
+func TestDebugProcessing_Endpoints(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, &mockProcessor{})
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+	debug := router.Group("/debug")
+	debug.Use(security.APIKeyAuthMiddleware(security.NewAPIKeyAuthenticator([]string{"secret"})))
+	debug.GET("/processing", handler.HandleDebugProcessing)
+	debug.GET("/metrics", handler.HandleProcessingMetrics)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg/800x600/jpeg", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// Act - without key
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/debug/processing", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Act - JSON with key
+	req := httptest.NewRequest("GET", "/debug/processing", nil)
+	req.Header.Set("X-API-Key", "secret")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	var stats ProcessingStats
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, int64(1), stats.Independent)
+	assert.Equal(t, int64(0), stats.Coalesced)
+
+	// Act - Prometheus with key
+	req = httptest.NewRequest("GET", "/debug/metrics", nil)
+	req.Header.Set("X-API-Key", "secret")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain"))
+	assert.Contains(t, w.Body.String(), "goimgserver_processing_independent_total 1\n")
+	assert.Contains(t, w.Body.String(), "# TYPE goimgserver_processing_in_flight gauge\n")
+}
+
+// TestImageHandler_GET_DuringPreCache tests that a live request for an image
+// the pre-cache is rendering shares that processing instead of starting another
+func TestImageHandler_GET_DuringPreCache(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+
+	proc := &blockingProcessor{release: make(chan struct{})}
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+	preCache := precache.NewWarmingProcessor(imagesDir, func(ctx context.Context, path string, params cache.ProcessingParams) error {
+		_, err := handler.WarmRendition(ctx, path, params)
+		return err
+	})
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	warmed := make(chan error, 1)
+	go func() {
+		warmed <- preCache.Process(context.Background(), filepath.Join(imagesDir, "test.jpg"))
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for proc.calls.Load() == 0 {
+		require.True(t, time.Now().Before(deadline), "pre-cache never started processing")
+		time.Sleep(time.Millisecond)
+	}
+
+	// Act
+	w := httptest.NewRecorder()
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg/1000x1000/webp/q95", nil))
+	}()
+	waitForQueueDepth(t, handler, 1)
+	close(proc.release)
+	<-served
+
+	// Assert
+	require.NoError(t, <-warmed)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int64(1), proc.calls.Load(), "pre-cache and request should share one processing")
+	assert.Equal(t, int64(1), handler.ProcessingStats().Coalesced)
+}
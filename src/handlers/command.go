@@ -2,10 +2,14 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"goimgserver/cache"
 	"goimgserver/config"
 	"goimgserver/git"
+	"goimgserver/processor"
+	"goimgserver/webhook"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -27,6 +31,8 @@ type CommandHandler struct {
 	config       *config.Config
 	cacheManager cache.CacheManager
 	gitOps       GitOperations
+	gitLocks     *git.RepoLocks
+	webhooks     *webhook.Notifier
 }
 
 // NewCommandHandler creates a new command handler
@@ -35,13 +41,31 @@ func NewCommandHandler(cfg *config.Config, cacheManager cache.CacheManager, gitO
 		config:       cfg,
 		cacheManager: cacheManager,
 		gitOps:       gitOps,
+		gitLocks:     git.NewRepoLocks(cfg.GitQueue, cfg.GitQueueTimeout),
 	}
 }
 
-// HandleClear handles the /cmd/clear endpoint
+// SetWebhooks sets the notifier told when the cache was cleared or the
+// images were updated (nil = none)
+func (h *CommandHandler) SetWebhooks(notifier *webhook.Notifier) {
+	h.webhooks = notifier
+}
+
+// HandleClear handles the /cmd/clear endpoint. With ?namespace= only that
+// cache namespace is cleared.
 func (h *CommandHandler) HandleClear(c *gin.Context) {
-	// Count files before clearing
-	stats, err := h.cacheManager.GetStats()
+	if namespace := c.Query("namespace"); namespace != "" {
+		h.clearNamespace(c, namespace)
+		return
+	}
+
+	// Count files before clearing. A client that gives up or times out
+	// stops the traversal; the rest of the cache stays.
+	ctx := c.Request.Context()
+	stats, err := h.cacheManager.GetStatsContext(ctx)
+	if abortTraversal(c, err) {
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -54,7 +78,11 @@ func (h *CommandHandler) HandleClear(c *gin.Context) {
 	freedSpace := stats.TotalSize
 
 	// Clear the cache
-	if err := h.cacheManager.ClearAll(); err != nil {
+	err = h.cacheManager.ClearAllContext(ctx)
+	if abortTraversal(c, err) {
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"error":   "Failed to clear cache",
@@ -62,6 +90,9 @@ func (h *CommandHandler) HandleClear(c *gin.Context) {
 		return
 	}
 
+	h.webhooks.Notify(webhook.EventCacheCleared, map[string]any{
+		"cleared_files": clearedFiles,
+	})
 	c.JSON(http.StatusOK, gin.H{
 		"success":       true,
 		"message":       "Cache cleared successfully",
@@ -70,6 +101,70 @@ func (h *CommandHandler) HandleClear(c *gin.Context) {
 	})
 }
 
+// abortTraversal ends a request whose cache traversal stopped because the
+// client disconnected or the request timed out, reporting whether it did.
+// Nobody is left to answer, the timeout middleware answers timeouts itself.
+func abortTraversal(c *gin.Context, err error) bool {
+	if !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	log.Printf("Cache traversal for %s stopped: %v", c.Request.URL.Path, err)
+	c.Abort()
+	return true
+}
+
+// clearNamespace clears the renditions cached in one namespace
+func (h *CommandHandler) clearNamespace(c *gin.Context, namespace string) {
+	if !cache.ValidNamespace(namespace) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "invalid namespace: " + namespace,
+			"code":    "INVALID_NAMESPACE",
+		})
+		return
+	}
+
+	// Count the namespace's files before clearing
+	var clearedFiles, freedSpace int64
+	err := h.cacheManager.IterateContext(c.Request.Context(), func(entry cache.CacheEntry) bool {
+		if cache.NamespaceOf(entry.Source) == namespace {
+			clearedFiles++
+			freedSpace += entry.Size
+		}
+		return true
+	})
+	if abortTraversal(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to get cache stats",
+		})
+		return
+	}
+
+	if err := h.cacheManager.ClearNamespace(namespace); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to clear cache",
+		})
+		return
+	}
+
+	h.webhooks.Notify(webhook.EventCacheCleared, map[string]any{
+		"namespace":     namespace,
+		"cleared_files": clearedFiles,
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"success":       true,
+		"message":       "Cache namespace cleared successfully",
+		"namespace":     namespace,
+		"cleared_files": clearedFiles,
+		"freed_space":   formatBytes(freedSpace),
+	})
+}
+
 // HandleGitUpdate handles the /cmd/gitupdate endpoint
 func (h *CommandHandler) HandleGitUpdate(c *gin.Context) {
 	imagesDir := h.config.ImagesDir
@@ -95,6 +190,18 @@ func (h *CommandHandler) HandleGitUpdate(c *gin.Context) {
 		return
 	}
 
+	// One git operation at a time per repository; others queue or get 409
+	release, err := h.gitLocks.Acquire(c.Request.Context(), imagesDir)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"success": false,
+			"error":   "git update not started: " + err.Error(),
+			"code":    "GIT_BUSY",
+		})
+		return
+	}
+	defer release()
+
 	// Execute git pull with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
@@ -109,12 +216,44 @@ func (h *CommandHandler) HandleGitUpdate(c *gin.Context) {
 		return
 	}
 
+	// Renditions of pulled images are stale; clear them before the next
+	// pull can change the tree again
+	cacheCleared := false
+	if result.Changes > 0 {
+		if err := h.cacheManager.ClearAll(); err != nil {
+			log.Printf("Warning: failed to clear cache after git update: %v", err)
+		} else {
+			cacheCleared = true
+		}
+	}
+
+	h.webhooks.Notify(webhook.EventGitUpdated, map[string]any{
+		"changes":       result.Changes,
+		"branch":        result.Branch,
+		"last_commit":   result.LastCommit,
+		"cache_cleared": cacheCleared,
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"success":       true,
+		"message":       "Git update completed",
+		"changes":       result.Changes,
+		"branch":        result.Branch,
+		"last_commit":   result.LastCommit,
+		"cache_cleared": cacheCleared,
+	})
+}
+
+// HandleInfo handles the /cmd/info endpoint, reporting the image library
+// version and the formats it can read and write
+func (h *CommandHandler) HandleInfo(c *gin.Context) {
+	info := processor.Capabilities()
+
 	c.JSON(http.StatusOK, gin.H{
-		"success":     true,
-		"message":     "Git update completed",
-		"changes":     result.Changes,
-		"branch":      result.Branch,
-		"last_commit": result.LastCommit,
+		"success":        true,
+		"vips_version":   info.VipsVersion,
+		"bimg_version":   info.BimgVersion,
+		"formats":        info.Formats,
+		"output_formats": info.OutputFormats(),
 	})
 }
 
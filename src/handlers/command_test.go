@@ -7,12 +7,17 @@ import (
 	"goimgserver/cache"
 	"goimgserver/config"
 	"goimgserver/git"
+	"goimgserver/processor"
+	"goimgserver/webhook"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -129,6 +134,143 @@ func TestCommandHandler_POST_Clear_EmptyCache(t *testing.T) {
 	assert.Equal(t, float64(0), response["cleared_files"].(float64))
 }
 
+// TestCommandHandler_POST_Clear_Namespace tests that clearing a namespace
+// leaves other tenants' renditions in place
+func TestCommandHandler_POST_Clear_Namespace(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	_, _, cfg, cacheManager := setupCommandTestEnvironment(t)
+	params := cache.ProcessingParams{Width: 100, Height: 100, Format: "webp", Quality: 90}
+	for _, namespace := range []string{"acme", "globex"} {
+		require.NoError(t, cacheManager.Store(cache.NamespacedPath(namespace, "/images/photo.jpg"), params, []byte(namespace)))
+	}
+
+	handler := NewCommandHandler(cfg, cacheManager, &mockGitOperations{})
+	router := gin.New()
+	router.POST("/cmd/clear", handler.HandleClear)
+
+	// Act
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/cmd/clear?namespace=acme", nil))
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "acme", response["namespace"])
+	assert.Equal(t, float64(1), response["cleared_files"])
+
+	assert.False(t, cacheManager.Exists(cache.NamespacedPath("acme", "/images/photo.jpg"), params))
+	assert.True(t, cacheManager.Exists(cache.NamespacedPath("globex", "/images/photo.jpg"), params))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/cmd/clear?namespace=../globex", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.True(t, cacheManager.Exists(cache.NamespacedPath("globex", "/images/photo.jpg"), params))
+}
+
+// TestCommandHandler_POST_Clear_Webhook tests that a cache clear and a git
+// update notify the webhooks, and that failing webhooks do not fail them
+func TestCommandHandler_POST_Clear_Webhook(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	_, _, cfg, cacheManager := setupCommandTestEnvironment(t)
+	var mu sync.Mutex
+	var received []webhook.Payload
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhook.Payload
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		mu.Lock()
+		received = append(received, payload)
+		mu.Unlock()
+	}))
+	defer peer.Close()
+	var failedAttempts atomic.Int32
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failedAttempts.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+
+	notifier := webhook.New([]string{peer.URL, down.URL}, time.Second, 1)
+	mockGit := &mockGitOperations{
+		isGitRepoResult:   true,
+		execGitPullResult: &git.GitPullResult{Changes: 2, Branch: "main", LastCommit: "abc123"},
+	}
+	handler := NewCommandHandler(cfg, cacheManager, mockGit)
+	handler.SetWebhooks(notifier)
+	router := gin.New()
+	router.POST("/cmd/clear", handler.HandleClear)
+	router.POST("/cmd/gitupdate", handler.HandleGitUpdate)
+
+	// Act
+	clear := httptest.NewRecorder()
+	router.ServeHTTP(clear, httptest.NewRequest("POST", "/cmd/clear", nil))
+	notifier.Wait()
+	namespace := httptest.NewRecorder()
+	router.ServeHTTP(namespace, httptest.NewRequest("POST", "/cmd/clear?namespace=acme", nil))
+	notifier.Wait()
+	update := httptest.NewRecorder()
+	router.ServeHTTP(update, httptest.NewRequest("POST", "/cmd/gitupdate", nil))
+	notifier.Wait()
+
+	// Assert
+	assert.Equal(t, http.StatusOK, clear.Code)
+	assert.Equal(t, http.StatusOK, namespace.Code)
+	assert.Equal(t, http.StatusOK, update.Code)
+	assert.Equal(t, int32(6), failedAttempts.Load(), "failed deliveries should be retried once")
+	require.Len(t, received, 3)
+
+	assert.Equal(t, webhook.EventCacheCleared, received[0].Event)
+	var response map[string]any
+	require.NoError(t, json.Unmarshal(clear.Body.Bytes(), &response))
+	assert.Equal(t, map[string]any{"cleared_files": response["cleared_files"]}, received[0].Data)
+	assert.Equal(t, webhook.EventCacheCleared, received[1].Event)
+	assert.Equal(t, map[string]any{"namespace": "acme", "cleared_files": float64(0)}, received[1].Data)
+	assert.Equal(t, webhook.EventGitUpdated, received[2].Event)
+	assert.Equal(t, map[string]any{
+		"changes":       float64(2),
+		"branch":        "main",
+		"last_commit":   "abc123",
+		"cache_cleared": true,
+	}, received[2].Data)
+}
+
+// TestCommandHandler_GET_Info tests the capabilities report
+func TestCommandHandler_GET_Info(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	_, _, cfg, cacheManager := setupCommandTestEnvironment(t)
+
+	handler := NewCommandHandler(cfg, cacheManager, &mockGitOperations{})
+
+	router := gin.New()
+	router.GET("/cmd/info", handler.HandleInfo)
+
+	req := httptest.NewRequest("GET", "/cmd/info", nil)
+	w := httptest.NewRecorder()
+
+	// Act
+	router.ServeHTTP(w, req)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Success       bool                               `json:"success"`
+		VipsVersion   string                             `json:"vips_version"`
+		Formats       map[string]processor.FormatSupport `json:"formats"`
+		OutputFormats []string                           `json:"output_formats"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.Success)
+	assert.NotEmpty(t, response.VipsVersion)
+	for _, format := range []string{"jpeg", "png", "webp"} {
+		assert.True(t, response.Formats[format].Input, format)
+		assert.Contains(t, response.OutputFormats, format)
+	}
+}
+
 // TestCommandHandler_POST_GitUpdate_ValidRepo tests git update in valid repo
 func TestCommandHandler_POST_GitUpdate_ValidRepo(t *testing.T) {
 	// Arrange
@@ -166,6 +308,76 @@ func TestCommandHandler_POST_GitUpdate_ValidRepo(t *testing.T) {
 	assert.Equal(t, float64(5), response["changes"])
 }
 
+// serializedGitOperations records how many pulls run at once
+type serializedGitOperations struct {
+	mockGitOperations
+	running   atomic.Int64
+	maxActive atomic.Int64
+	pulls     atomic.Int64
+	release   chan struct{}
+}
+
+func (m *serializedGitOperations) ExecuteGitPull(ctx context.Context, dir string) (*git.GitPullResult, error) {
+	active := m.running.Add(1)
+	defer m.running.Add(-1)
+	for {
+		max := m.maxActive.Load()
+		if active <= max || m.maxActive.CompareAndSwap(max, active) {
+			break
+		}
+	}
+	m.pulls.Add(1)
+	<-m.release
+	return &git.GitPullResult{Success: true, Branch: "main"}, nil
+}
+
+// TestCommandHandler_POST_GitUpdate_Serialized tests that concurrent git
+// updates run one at a time, queueing up to the limit and turning the rest
+// away with 409
+func TestCommandHandler_POST_GitUpdate_Serialized(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	_, _, cfg, cacheManager := setupCommandTestEnvironment(t)
+	cfg.GitQueue = 3
+	cfg.GitQueueTimeout = 10 * time.Second
+	mockGit := &serializedGitOperations{
+		mockGitOperations: mockGitOperations{isGitRepoResult: true},
+		release:           make(chan struct{}),
+	}
+	handler := NewCommandHandler(cfg, cacheManager, mockGit)
+	router := gin.New()
+	router.POST("/cmd/gitupdate", handler.HandleGitUpdate)
+
+	// Act: one running pull, three queued and two more
+	const requests = 6
+	codes := make(chan int, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("POST", "/cmd/gitupdate", nil))
+			codes <- w.Code
+		}()
+	}
+	require.Eventually(t, func() bool { return len(codes) == requests-1-cfg.GitQueue }, 5*time.Second, time.Millisecond)
+	for i := 0; i <= cfg.GitQueue; i++ {
+		mockGit.release <- struct{}{}
+	}
+	wg.Wait()
+	close(codes)
+
+	// Assert
+	counts := map[int]int{}
+	for code := range codes {
+		counts[code]++
+	}
+	assert.Equal(t, map[int]int{http.StatusOK: 1 + cfg.GitQueue, http.StatusConflict: requests - 1 - cfg.GitQueue}, counts)
+	assert.Equal(t, int64(1), mockGit.maxActive.Load(), "git pulls must not overlap")
+	assert.Equal(t, int64(1+cfg.GitQueue), mockGit.pulls.Load())
+}
+
 // TestCommandHandler_POST_GitUpdate_NotGitRepo tests non-git directory
 func TestCommandHandler_POST_GitUpdate_NotGitRepo(t *testing.T) {
 	// Arrange
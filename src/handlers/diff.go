@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"goimgserver/processor"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxDiffUploadSize limits uploaded comparison images
+const maxDiffUploadSize = 32 << 20
+
+// errDiffImageMissing is returned when a compared path does not exist
+var errDiffImageMissing = errors.New("image not found")
+
+// errDiffImageTooLarge is returned for a compared image over the pixel budget
+var errDiffImageTooLarge = errors.New("image too large")
+
+// diffRequest is the JSON body accepted by the diff endpoint
+type diffRequest struct {
+	A      string `json:"a" form:"a"`
+	B      string `json:"b" form:"b"`
+	Metric string `json:"metric" form:"metric"`
+	Diff   bool   `json:"diff" form:"diff"`
+}
+
+// HandleDiff handles the /img/_diff endpoint. It compares image a with
+// image b, where b is either a path or an "upload" file in a multipart
+// form, and optionally returns a base64 PNG diff image.
+func (h *ImageHandler) HandleDiff(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxDiffUploadSize)
+
+	var req diffRequest
+	if err := c.ShouldBind(&req); err != nil || req.A == "" {
+		diffError(c, http.StatusBadRequest, "request must include an image path a and an image path b or upload", "INVALID_REQUEST")
+		return
+	}
+
+	imgA, err := h.loadDiffImage(req.A)
+	if err != nil {
+		diffLoadError(c, err)
+		return
+	}
+
+	var imgB image.Image
+	if file, fileErr := c.FormFile("upload"); fileErr == nil {
+		f, err := file.Open()
+		if err != nil {
+			diffError(c, http.StatusBadRequest, "failed to read uploaded image", "INVALID_REQUEST")
+			return
+		}
+		defer f.Close()
+		imgB, err = h.decodeDiffImage(f)
+		if err != nil {
+			diffLoadError(c, err)
+			return
+		}
+	} else if req.B != "" {
+		imgB, err = h.loadDiffImage(req.B)
+		if err != nil {
+			diffLoadError(c, err)
+			return
+		}
+	} else {
+		diffError(c, http.StatusBadRequest, "request must include an image path a and an image path b or upload", "INVALID_REQUEST")
+		return
+	}
+
+	score, err := processor.CompareImages(imgA, imgB, req.Metric)
+	if err != nil {
+		diffError(c, http.StatusBadRequest, err.Error(), "INVALID_METRIC")
+		return
+	}
+
+	metric := req.Metric
+	if metric == "" {
+		metric = processor.CompareSSIM
+	}
+	response := gin.H{
+		"success": true,
+		"metric":  metric,
+		"score":   score,
+		"width":   imgA.Bounds().Dx(),
+		"height":  imgA.Bounds().Dy(),
+	}
+
+	if req.Diff {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, processor.DiffImage(imgA, imgB)); err != nil {
+			diffError(c, http.StatusInternalServerError, "failed to encode diff image", "DIFF_FAILED")
+			return
+		}
+		response["diff_image"] = "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// loadDiffImage resolves and decodes an image path without any fallback,
+// refusing paths the ACL denies
+func (h *ImageHandler) loadDiffImage(path string) (image.Image, error) {
+	result, err := h.resolver.Resolve(strings.TrimPrefix(path, "/"))
+	if err != nil || result.IsFallback {
+		return nil, errDiffImageMissing
+	}
+	if !h.allowed(result) {
+		return nil, fmt.Errorf("%w: %s", errAccessDenied, path)
+	}
+
+	f, err := h.files.Open(result.ResolvedPath)
+	if err != nil {
+		return nil, errDiffImageMissing
+	}
+	defer f.Close()
+	return h.decodeDiffImage(f)
+}
+
+// decodeDiffImage decodes JPEG, PNG or WebP data, refusing images over the
+// MaxSourcePixels budget from their header before decoding the pixels
+func (h *ImageHandler) decodeDiffImage(r io.Reader) (image.Image, error) {
+	var header bytes.Buffer
+	cfg, _, err := image.DecodeConfig(io.TeeReader(r, &header))
+	if err != nil {
+		return nil, processor.ErrInvalidImage
+	}
+	if budget := h.config.MaxSourcePixels; budget > 0 && cfg.Width*cfg.Height > budget {
+		return nil, fmt.Errorf("%w: image has %d pixels, over the %d pixel budget", errDiffImageTooLarge, cfg.Width*cfg.Height, budget)
+	}
+
+	img, _, err := image.Decode(io.MultiReader(&header, r))
+	if err != nil {
+		return nil, processor.ErrInvalidImage
+	}
+	return img, nil
+}
+
+// diffLoadError maps an image loading error to a response
+func diffLoadError(c *gin.Context, err error) {
+	if errors.Is(err, errDiffImageMissing) {
+		diffError(c, http.StatusNotFound, err.Error(), "NOT_FOUND")
+		return
+	}
+	if errors.Is(err, errAccessDenied) {
+		diffError(c, http.StatusForbidden, err.Error(), "FORBIDDEN")
+		return
+	}
+	diffError(c, http.StatusUnprocessableEntity, err.Error(), "INVALID_IMAGE")
+}
+
+// diffError writes a diff endpoint error response
+func diffError(c *gin.Context, status int, message, code string) {
+	c.JSON(status, gin.H{
+		"success": false,
+		"error":   message,
+		"code":    code,
+	})
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"goimgserver/cache"
+	"goimgserver/config"
+	"goimgserver/resolver"
+	"goimgserver/security"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stripesPNG encodes a 100x100 black and white striped image
+func stripesPNG(t *testing.T) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			if (x/5)%2 == 0 {
+				img.Set(x, y, color.Black)
+			} else {
+				img.Set(x, y, color.White)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+// setupDiffRouter creates a test router with a striped image
+func setupDiffRouter(t *testing.T) (*gin.Engine, string) {
+	router, handler, _ := setupTestRouter(t, func(cfg *config.Config) {
+		require.NoError(t, os.WriteFile(filepath.Join(cfg.ImagesDir, "stripes.png"), stripesPNG(t), 0644))
+	})
+	return router, handler.config.ImagesDir
+}
+
+// postDiff sends a JSON diff request and decodes the response
+func postDiff(t *testing.T, router *gin.Engine, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	req := httptest.NewRequest("POST", "/img/_diff", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return w, response
+}
+
+// TestDiff_IdenticalImages tests that an image compared with itself scores 1
+func TestDiff_IdenticalImages(t *testing.T) {
+	// Arrange
+	router, _ := setupDiffRouter(t)
+
+	// Act
+	w, response := postDiff(t, router, `{"a": "test.jpg", "b": "test.jpg"}`)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, true, response["success"])
+	assert.Equal(t, "ssim", response["metric"])
+	assert.InDelta(t, 1.0, response["score"], 0.0001)
+	assert.Nil(t, response["diff_image"])
+}
+
+// TestDiff_DifferentImages tests that clearly different images score low
+func TestDiff_DifferentImages(t *testing.T) {
+	router, _ := setupDiffRouter(t)
+
+	for _, metric := range []string{"ssim", "pixel"} {
+		t.Run(metric, func(t *testing.T) {
+			// Act
+			w, response := postDiff(t, router, `{"a": "test.jpg", "b": "stripes.png", "metric": "`+metric+`"}`)
+
+			// Assert
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Less(t, response["score"], 0.5)
+		})
+	}
+}
+
+// TestDiff_DiffImage tests that a PNG diff image is returned on request
+func TestDiff_DiffImage(t *testing.T) {
+	// Arrange
+	router, _ := setupDiffRouter(t)
+
+	// Act
+	w, response := postDiff(t, router, `{"a": "test.jpg", "b": "stripes.png", "diff": true}`)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	diffImage, ok := response["diff_image"].(string)
+	require.True(t, ok)
+	assert.True(t, strings.HasPrefix(diffImage, "data:image/png;base64,"))
+}
+
+// TestDiff_UploadedImage tests comparing a path against uploaded bytes
+func TestDiff_UploadedImage(t *testing.T) {
+	// Arrange
+	router, imagesDir := setupDiffRouter(t)
+	uploaded, err := os.ReadFile(filepath.Join(imagesDir, "test.jpg"))
+	require.NoError(t, err)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	require.NoError(t, mw.WriteField("a", "test.jpg"))
+	part, err := mw.CreateFormFile("upload", "upload.jpg")
+	require.NoError(t, err)
+	_, err = part.Write(uploaded)
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+
+	// Act
+	req := httptest.NewRequest("POST", "/img/_diff", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.InDelta(t, 1.0, response["score"], 0.0001)
+}
+
+// TestDiff_InvalidRequests tests error responses of the diff endpoint
+func TestDiff_InvalidRequests(t *testing.T) {
+	router, _ := setupDiffRouter(t)
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{"Invalid JSON", `{a:`, http.StatusBadRequest, "INVALID_REQUEST"},
+		{"Missing b", `{"a": "test.jpg"}`, http.StatusBadRequest, "INVALID_REQUEST"},
+		{"Missing image", `{"a": "test.jpg", "b": "missing.jpg"}`, http.StatusNotFound, "NOT_FOUND"},
+		{"Unknown metric", `{"a": "test.jpg", "b": "test.jpg", "metric": "psnr"}`, http.StatusBadRequest, "INVALID_METRIC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, response := postDiff(t, router, tt.body)
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedCode, response["code"])
+		})
+	}
+}
+
+// TestDiff_DeniedPath tests that paths the ACL denies cannot be compared
+func TestDiff_DeniedPath(t *testing.T) {
+	// Arrange
+	router, _, _ := setupTestRouter(t, func(cfg *config.Config) {
+		require.NoError(t, createTestImage(filepath.Join(cfg.ImagesDir, "internal", "secret.jpg"), 100, 100))
+		cfg.DenyPaths = []string{"internal"}
+	})
+
+	for _, body := range []string{`{"a": "internal/secret.jpg", "b": "test.jpg"}`, `{"a": "test.jpg", "b": "internal/secret.jpg"}`} {
+		// Act
+		w, response := postDiff(t, router, body)
+
+		// Assert
+		assert.Equal(t, http.StatusForbidden, w.Code, body)
+		assert.Equal(t, "FORBIDDEN", response["code"], body)
+	}
+}
+
+// TestDiff_PixelBudget tests that images over the pixel budget are refused
+// before they are decoded
+func TestDiff_PixelBudget(t *testing.T) {
+	// Arrange
+	router, _, _ := setupTestRouter(t, func(cfg *config.Config) { cfg.MaxSourcePixels = 100*100 - 1 })
+
+	// Act
+	w, response := postDiff(t, router, `{"a": "test.jpg", "b": "test.jpg"}`)
+
+	// Assert
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, "INVALID_IMAGE", response["code"])
+	assert.Contains(t, response["error"], "pixel budget")
+}
+
+// TestDiff_RequiresAPIKey tests the diff endpoint behind API key auth
+func TestDiff_RequiresAPIKey(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, &mockProcessor{})
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+	router.POST("/img/_diff", security.APIKeyAuthMiddleware(security.NewAPIKeyAuthenticator([]string{"secret"})), handler.HandleDiff)
+
+	// Act - without key
+	w, _ := postDiff(t, router, `{"a": "test.jpg", "b": "test.jpg"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Act - with key
+	req := httptest.NewRequest("POST", "/img/_diff", strings.NewReader(`{"a": "test.jpg", "b": "test.jpg"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", "secret")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
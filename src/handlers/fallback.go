@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"bytes"
+	"goimgserver/cache"
+	"goimgserver/config"
+	"goimgserver/resolver"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fallbackKey marks a response serving a fallback image, which clients may
+// only cache for the fallback grace window
+const fallbackKey = "fallback"
+
+// fallbackRenditions remembers when fallback renditions were cached so they
+// can be expired after a grace window, letting a file that lands under a
+// previously missing path replace the default image soon after
+type fallbackRenditions struct {
+	mu     sync.Mutex
+	stored map[string]time.Time
+}
+
+// newFallbackRenditions creates an empty fallback rendition record
+func newFallbackRenditions() *fallbackRenditions {
+	return &fallbackRenditions{stored: make(map[string]time.Time)}
+}
+
+// fresh reports whether the rendition under key was cached less than ttl
+// ago. Renditions cached before a restart are unknown and thus stale.
+func (f *fallbackRenditions) fresh(key string, ttl time.Duration) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stored, ok := f.stored[key]
+	return ok && time.Since(stored) < ttl
+}
+
+// record notes that the rendition under key was just cached, forgetting
+// renditions older than ttl
+func (f *fallbackRenditions) record(key string, ttl time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	for k, stored := range f.stored {
+		if now.Sub(stored) >= ttl {
+			delete(f.stored, k)
+		}
+	}
+	f.stored[key] = now
+}
+
+// placeholderText labels the placeholder served in place of a broken
+// default image
+const placeholderText = "goimgserver"
+
+// memoryPlaceholder is the placeholder served when the default image is
+// missing or cannot be rendered. It is generated once and kept in memory,
+// so serving it needs neither the images nor the cache directory.
+type memoryPlaceholder struct {
+	once sync.Once
+	data []byte
+	err  error
+}
+
+// get returns the placeholder, generating it on first use
+func (p *memoryPlaceholder) get() ([]byte, error) {
+	p.once.Do(func() {
+		var buf bytes.Buffer
+		p.err = config.EncodePlaceholder(&buf, placeholderText)
+		p.data = buf.Bytes()
+	})
+	return p.data, p.err
+}
+
+// serveDefaultPlaceholder answers a request whose system default image
+// failed to render with the in-memory placeholder, unless
+// InvalidDefaultImage is error. The placeholder is rendered with the
+// request's parameters, or served as generated if that fails too, and is
+// neither cached nor cacheable by clients. It reports whether it answered.
+func (h *ImageHandler) serveDefaultPlaceholder(c *gin.Context, result *resolver.ResolutionResult, params cache.ProcessingParams, err error) bool {
+	if h.config.InvalidDefaultImage == config.InvalidDefaultImageError || result.FallbackType != "system_default" {
+		return false
+	}
+	log.Printf("Error: default image %s cannot be served, serving a generated placeholder instead: %v", result.ResolvedPath, err)
+
+	data, err := h.placeholder.get()
+	if err != nil {
+		log.Printf("Error: failed to generate placeholder: %v", err)
+		return false
+	}
+	rendered, err := h.renderRecovered(c.Request.Context(), "generated placeholder", data, params)
+	if err != nil {
+		rendered = &rendition{data: data, format: "jpeg"}
+	}
+	c.Writer.Header().Del("ETag")
+	c.Writer.Header().Del("X-Content-Hash")
+	c.Set(degradedKey, true)
+	c.Header("X-Cache", cacheBypass)
+	h.serveImageData(c, rendered.data, rendered.format)
+	return true
+}
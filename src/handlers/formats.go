@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"goimgserver/cache"
+	"goimgserver/config"
+	"slices"
+	"strings"
+)
+
+// errFormatNotAllowed is returned for an output format the configuration
+// does not allow for the image
+var errFormatNotAllowed = errors.New("output format not allowed")
+
+// allowedFormats returns the output formats allowed for basePath: those of
+// the longest PathFormats prefix it lies below, else AllowedFormats (nil =
+// all)
+func (h *ImageHandler) allowedFormats(basePath string) []string {
+	allowed := h.config.AllowedFormats
+	longest := -1
+	path := strings.Trim(basePath, "/")
+	for _, rule := range h.config.PathFormats {
+		prefix, formats, _ := strings.Cut(rule, "=")
+		prefix = strings.Trim(prefix, "/")
+		if len(prefix) > longest && (path == prefix || strings.HasPrefix(path, prefix+"/")) {
+			allowed = strings.Split(formats, "|")
+			longest = len(prefix)
+		}
+	}
+	return allowed
+}
+
+// restrictFormat applies the allowed output formats to params. A format
+// that is not allowed snaps to the first allowed image format that can be
+// encoded, or is rejected with errFormatNotAllowed when it was requested;
+// defaults always snap.
+func (h *ImageHandler) restrictFormat(basePath string, params cache.ProcessingParams, requested bool) (cache.ProcessingParams, error) {
+	allowed := h.allowedFormats(basePath)
+	if len(allowed) == 0 || slices.ContainsFunc(allowed, func(f string) bool { return sameFormat(f, params.Format) }) {
+		return params, nil
+	}
+	if requested && h.config.DisallowedFormat == config.DisallowedFormatReject {
+		return params, fmt.Errorf("%w: %s", errFormatNotAllowed, params.Format)
+	}
+	for _, format := range allowed {
+		if format != gifFormat && format != pdfFormat {
+			params.Format = format
+			break
+		}
+	}
+	return h.applyDefaults(params), nil
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"goimgserver/cache"
+	"goimgserver/config"
+	"goimgserver/processor"
+	"goimgserver/resolver"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestImageHandler_GET_AllowedFormats tests that disallowed output formats
+// snap to the first allowed format or are rejected, globally and below path
+// prefixes, while allowed formats proceed
+func TestImageHandler_GET_AllowedFormats(t *testing.T) {
+	tests := []struct {
+		name       string
+		behavior   string
+		url        string
+		wantStatus int
+		wantFormat processor.ImageFormat
+	}{
+		{"Allowed", config.DisallowedFormatSnap, "/img/test.jpg/300x250/jpeg", http.StatusOK, processor.FormatJPEG},
+		{"Allowed alias", config.DisallowedFormatReject, "/img/test.jpg/300x250/jpg", http.StatusOK, processor.FormatJPG},
+		{"Snapped", config.DisallowedFormatSnap, "/img/test.jpg/300x250/png", http.StatusOK, processor.FormatWebP},
+		{"Rejected", config.DisallowedFormatReject, "/img/test.jpg/300x250/png", http.StatusBadRequest, ""},
+		{"Default snaps when rejecting", config.DisallowedFormatReject, "/img/test.jpg/300x250", http.StatusOK, processor.FormatWebP},
+		{"Path prefix allows", config.DisallowedFormatReject, "/img/partners/logo.jpg/300x250/png", http.StatusOK, processor.FormatPNG},
+		{"Path prefix snaps", config.DisallowedFormatSnap, "/img/partners/logo.jpg/300x250/webp", http.StatusOK, processor.FormatPNG},
+		{"Path prefix rejects", config.DisallowedFormatReject, "/img/partners/logo.jpg/300x250/webp", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+			cfg.DefaultOutputFormat = "png"
+			cfg.AllowedFormats = []string{"webp", "jpeg"}
+			cfg.PathFormats = []string{"partners=png"}
+			cfg.DisallowedFormat = tt.behavior
+			require.NoError(t, os.MkdirAll(filepath.Join(imagesDir, "partners"), 0755))
+			require.NoError(t, createTestImage(filepath.Join(imagesDir, "partners", "logo.jpg"), 100, 100))
+
+			cacheManager, err := cache.NewManager(cacheDir)
+			require.NoError(t, err)
+			proc := &recordingProcessor{}
+			handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+			router := gin.New()
+			router.GET("/img/*path", handler.ServeImage)
+
+			// Act
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+			// Assert
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantFormat, proc.opts.Format)
+			if tt.wantStatus == http.StatusBadRequest {
+				assert.Contains(t, w.Body.String(), "Output format not allowed")
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"errors"
+	"goimgserver/config"
+	"goimgserver/resolver"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListSegment ends a group path to list the group's images, e.g. /img/cats/_list
+const ListSegment = "_list"
+
+// GroupsSegment is the whole path of the group index, /img/_groups
+const GroupsSegment = "_groups"
+
+// groupSummary describes one group in the group index
+type groupSummary struct {
+	Group      string `json:"group"`
+	Images     int    `json:"images"`
+	HasDefault bool   `json:"has_default"`
+}
+
+// handleGroupIndex answers the groups the path ACL allows, sorted by path,
+// with how many of their images it allows and whether they have their own
+// default image
+func (h *ImageHandler) handleGroupIndex(c *gin.Context) {
+	groups, err := h.resolver.ListGroups()
+	if err != nil {
+		log.Printf("Error listing groups: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list groups"})
+		return
+	}
+
+	summaries := make([]groupSummary, 0, len(groups))
+	for _, group := range groups {
+		if !h.acl.Empty() && !h.acl.Allowed(group.Path) {
+			continue
+		}
+		images := 0
+		for _, name := range group.Images {
+			if h.acl.Empty() || h.acl.Allowed(path.Join(group.Path, name)) {
+				images++
+			}
+		}
+		summaries = append(summaries, groupSummary{Group: group.Path, Images: images, HasDefault: group.HasDefault})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"groups": summaries})
+}
+
+// groupDir reports whether name is a directory of the images directory and
+// returns its name on disk. With case-insensitive paths a directory named in
+// another case matches, an exact name first.
+func (h *ImageHandler) groupDir(name string) (string, bool) {
+	isDir := func(name string) bool {
+		info, err := h.files.Stat(filepath.Join(h.config.ImagesDir, name))
+		return err == nil && info.IsDir()
+	}
+	if h.config.PathCase != config.PathCaseInsensitive || name == "" {
+		return name, isDir(name)
+	}
+
+	entries, err := h.files.ReadDir(h.config.ImagesDir)
+	if err != nil {
+		return "", false
+	}
+	match := ""
+	for _, entry := range entries {
+		if entry.Name() == name && isDir(name) {
+			return name, true
+		}
+		if match == "" && strings.EqualFold(entry.Name(), name) && isDir(entry.Name()) {
+			match = entry.Name()
+		}
+	}
+	return match, match != ""
+}
+
+// groupListing returns the group of a /img/<group>/_list request
+func groupListing(segments []string) (string, bool) {
+	if len(segments) < 2 || segments[len(segments)-1] != ListSegment {
+		return "", false
+	}
+	group := strings.Join(segments[:len(segments)-1], "/")
+	return group, group != ""
+}
+
+// handleListGroup answers the images of a group that the path ACL allows.
+// A group that does not exist lists no images.
+func (h *ImageHandler) handleListGroup(c *gin.Context, group string) {
+	names, err := h.resolver.ListGroup(group)
+	if err != nil {
+		if errors.Is(err, resolver.ErrInvalidPath) || errors.Is(err, resolver.ErrPathTraversal) || errors.Is(err, resolver.ErrOutsideImageDir) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid path"})
+			return
+		}
+		log.Printf("Error listing group %s: %v", group, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list group"})
+		return
+	}
+
+	images := make([]string, 0, len(names))
+	for _, name := range names {
+		if h.acl.Empty() || h.acl.Allowed(filepath.Join(group, name)) {
+			images = append(images, name)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"group":  group,
+		"images": images,
+	})
+}
+
+// groupPlaceholderType is the fallback type of a generated group placeholder
+const groupPlaceholderType = "group_placeholder"
+
+// placeholderDir holds generated group placeholders in the cache directory
+const placeholderDir = "_placeholders"
+
+// groupPlaceholder replaces the system default served for a missing image in
+// a group without its own default by a placeholder labeled with the group
+// name, when GroupPlaceholder is on. The placeholder is generated once per
+// group and its renditions are cached per group and size.
+func (h *ImageHandler) groupPlaceholder(basePath string, result *resolver.ResolutionResult) *resolver.ResolutionResult {
+	if !h.config.GroupPlaceholder || result.FallbackType != "system_default" {
+		return result
+	}
+	group, _, grouped := strings.Cut(basePath, "/")
+	if !grouped || group == "" || strings.HasPrefix(group, ".") {
+		return result
+	}
+	// Denied paths must not reveal their group name
+	if !h.acl.Empty() && !h.acl.Allowed(basePath) {
+		return result
+	}
+	if info, err := h.files.Stat(filepath.Join(h.config.ImagesDir, group)); err != nil || !info.IsDir() {
+		return result
+	}
+
+	path := filepath.Join(h.config.CacheDir, placeholderDir, group+".jpg")
+	if _, err := os.Stat(path); err != nil {
+		if err := generatePlaceholder(path, group); err != nil {
+			log.Printf("Warning: failed to generate placeholder for group %s: %v", group, err)
+			return result
+		}
+	}
+	return &resolver.ResolutionResult{
+		ResolvedPath: path,
+		IsGrouped:    true,
+		IsFallback:   true,
+		FallbackType: groupPlaceholderType,
+	}
+}
+
+// generatePlaceholder writes a placeholder labeled text to path atomically,
+// so concurrent requests never read a partial file
+func generatePlaceholder(path, text string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	if err := config.GeneratePlaceholder(tmp.Name(), text); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"encoding/json"
+	"goimgserver/cache"
+	"goimgserver/config"
+	"goimgserver/resolver"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// groupListResponse is the JSON body of a group listing
+type groupListResponse struct {
+	Group  string   `json:"group"`
+	Images []string `json:"images"`
+}
+
+// TestImageHandler_ListGroup tests listing group images through /img/<group>/_list
+func TestImageHandler_ListGroup(t *testing.T) {
+	tests := []struct {
+		name     string
+		deny     []string
+		url      string
+		group    string
+		expected []string
+	}{
+		{"Populated group", nil, "/img/cats/_list", "cats", []string{"cat_black.png", "cat_white.jpg", "private.jpg"}},
+		{"Denied images are hidden", []string{"cats/private.jpg"}, "/img/cats/_list", "cats", []string{"cat_black.png", "cat_white.jpg"}},
+		{"Denied group lists nothing", []string{"cats"}, "/img/cats/_list", "cats", []string{}},
+		{"Nonexistent group", nil, "/img/birds/_list", "birds", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+			cfg.DenyPaths = tt.deny
+			require.NoError(t, createTestImage(filepath.Join(imagesDir, "cats", "cat_black.png"), 50, 50))
+			require.NoError(t, createTestImage(filepath.Join(imagesDir, "cats", "private.jpg"), 50, 50))
+			require.NoError(t, createTestImage(filepath.Join(imagesDir, "cats", "default.jpg"), 50, 50))
+			require.NoError(t, os.WriteFile(filepath.Join(imagesDir, "cats", ".DS_Store"), []byte("x"), 0644))
+
+			cacheManager, err := cache.NewManager(cacheDir)
+			require.NoError(t, err)
+			handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, &mockProcessor{})
+
+			router := gin.New()
+			router.GET("/img/*path", handler.ServeImage)
+
+			// Act
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+			// Assert
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+			var response groupListResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.group, response.Group)
+			assert.Equal(t, tt.expected, response.Images)
+		})
+	}
+}
+
+// groupIndexResponse is the JSON body of the group index
+type groupIndexResponse struct {
+	Groups []groupSummary `json:"groups"`
+}
+
+// TestImageHandler_GroupIndex tests the group index at /img/_groups over a
+// fixture tree, with and without a path ACL
+func TestImageHandler_GroupIndex(t *testing.T) {
+	tests := []struct {
+		name     string
+		allow    []string
+		deny     []string
+		expected []groupSummary
+	}{
+		{"All groups", nil, nil, []groupSummary{
+			{Group: "birds", Images: 0, HasDefault: true},
+			{Group: "cats", Images: 3, HasDefault: true},
+			{Group: "cats/kittens", Images: 2, HasDefault: false},
+			{Group: "dogs", Images: 1, HasDefault: false},
+		}},
+		{"Denied groups and images are left out", nil, []string{"dogs", "cats/private.jpg"}, []groupSummary{
+			{Group: "birds", Images: 0, HasDefault: true},
+			{Group: "cats", Images: 2, HasDefault: true},
+			{Group: "cats/kittens", Images: 2, HasDefault: false},
+		}},
+		{"Only allowed groups", []string{"cats/kittens"}, nil, []groupSummary{
+			{Group: "cats/kittens", Images: 2, HasDefault: false},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+			cfg.GroupIndex = true
+			cfg.AllowPaths = tt.allow
+			cfg.DenyPaths = tt.deny
+			for _, name := range []string{"cats/cat_black.png", "cats/private.jpg", "cats/default.jpg", "cats/kittens/a.jpg", "cats/kittens/b.webp", "dogs/rex.jpg", "birds/default.png"} {
+				require.NoError(t, createTestImage(filepath.Join(imagesDir, name), 50, 50))
+			}
+			require.NoError(t, os.WriteFile(filepath.Join(imagesDir, "cats", ".DS_Store"), []byte("x"), 0644))
+
+			cacheManager, err := cache.NewManager(cacheDir)
+			require.NoError(t, err)
+			handler := NewImageHandler(cfg, resolver.NewResolverWithCache(imagesDir), cacheManager, &mockProcessor{})
+
+			router := gin.New()
+			router.GET("/img/*path", handler.ServeImage)
+
+			for i := 0; i < 2; i++ {
+				// Act
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest("GET", "/img/_groups", nil))
+
+				// Assert: the same list, in the same order, from the cached scan
+				require.Equal(t, http.StatusOK, w.Code)
+				assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+				var response groupIndexResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, tt.expected, response.Groups)
+			}
+		})
+	}
+}
+
+// TestImageHandler_GroupIndex_Disabled tests that without GroupIndex
+// _groups is an ordinary image path
+func TestImageHandler_GroupIndex_Disabled(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, &mockProcessor{})
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	// Act
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/_groups", nil))
+
+	// Assert: the missing image falls back to the default image
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Header().Get("Content-Type"), "application/json")
+}
+
+// TestGroupListing tests recognising list requests
+func TestGroupListing(t *testing.T) {
+	tests := []struct {
+		segments []string
+		group    string
+		ok       bool
+	}{
+		{[]string{"cats", "_list"}, "cats", true},
+		{[]string{"animals", "cats", "_list"}, "animals/cats", true},
+		{[]string{"_list"}, "", false},
+		{[]string{"cats", "_list", "400x300"}, "", false},
+		{[]string{"cats", "cat_white.jpg"}, "", false},
+	}
+
+	for _, tt := range tests {
+		group, ok := groupListing(tt.segments)
+		assert.Equal(t, tt.ok, ok, tt.segments)
+		assert.Equal(t, tt.group, group, tt.segments)
+	}
+}
+
+// TestImageHandler_GET_GroupPlaceholder tests missing images in a group without a default get a group labeled placeholder
+func TestImageHandler_GET_GroupPlaceholder(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	require.NoError(t, os.MkdirAll(filepath.Join(imagesDir, "dogs"), 0755))
+	defaultData, err := os.ReadFile(cfg.DefaultImagePath)
+	require.NoError(t, err)
+
+	expected := make(map[string][]byte)
+	for _, group := range []string{"cats", "dogs"} {
+		path := filepath.Join(t.TempDir(), group+".jpg")
+		require.NoError(t, config.GeneratePlaceholder(path, group))
+		expected[group], err = os.ReadFile(path)
+		require.NoError(t, err)
+	}
+
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	proc := &countingProcessor{}
+	cfg.GroupPlaceholder = true
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		return w
+	}
+
+	// Act & Assert - the placeholder is labeled with the group
+	w := get("/img/cats/missing.jpg")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, expected["cats"], w.Body.Bytes())
+	assert.NotEqual(t, defaultData, w.Body.Bytes())
+
+	// Another missing image of the group reuses the cached rendition
+	w = get("/img/cats/other.jpg")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, expected["cats"], w.Body.Bytes())
+	assert.Equal(t, 1, proc.calls)
+
+	w = get("/img/dogs/missing.jpg")
+	assert.Equal(t, expected["dogs"], w.Body.Bytes())
+
+	// Existing images and missing images outside groups are unaffected
+	w = get("/img/cats/cat_white.jpg")
+	assert.NotEqual(t, expected["cats"], w.Body.Bytes())
+	w = get("/img/missing.jpg")
+	assert.Equal(t, defaultData, w.Body.Bytes())
+
+	// Disabled, the system default is served
+	cfg.GroupPlaceholder = false
+	w = get("/img/cats/gone.jpg")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, defaultData, w.Body.Bytes())
+}
+
+// TestImageHandler_GET_PathCase tests that group and image names in another
+// case, with trailing slashes, serve the image on disk only with
+// case-insensitive paths
+func TestImageHandler_GET_PathCase(t *testing.T) {
+	tests := []struct {
+		name     string
+		pathCase string
+		url      string
+		expected string
+	}{
+		{"Exact", config.PathCaseSensitive, "/img/cats/cat_white.jpg/300x200", "cats/cat_white.jpg"},
+		{"Trailing slash", config.PathCaseSensitive, "/img/cats/cat_white/300x200/", "cats/cat_white.jpg"},
+		{"Case-sensitive", config.PathCaseSensitive, "/img/CATS/Cat_White/300x200", "default.jpg"},
+		{"Case-insensitive", config.PathCaseInsensitive, "/img/CATS/Cat_White/300x200/", "cats/cat_white.jpg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			router, handler, proc := setupTestRouter(t, func(cfg *config.Config) { cfg.PathCase = tt.pathCase })
+
+			// Act
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+			// Assert
+			assert.Equal(t, http.StatusOK, w.Code)
+			expected, err := os.ReadFile(filepath.Join(handler.config.ImagesDir, tt.expected))
+			require.NoError(t, err)
+			assert.Equal(t, expected, proc.source)
+		})
+	}
+}
@@ -1,18 +1,33 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"goimgserver/cache"
 	"goimgserver/config"
+	apperrors "goimgserver/errors"
 	"goimgserver/processor"
 	"goimgserver/resolver"
+	"goimgserver/security"
+	"goimgserver/storage"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
 	"log"
 	"net/http"
-	"os"
+	"net/url"
 	"path/filepath"
+	"runtime/debug"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	_ "golang.org/x/image/webp"
 )
 
 // ImageHandler handles image serving requests
@@ -21,15 +36,52 @@ type ImageHandler struct {
 	resolver     resolver.FileResolver
 	cache        cache.CacheManager
 	processor    processor.ImageProcessor
+	processing   *processingGroup
+	acl          *security.PathACL
+	metadata     func([]byte) (*processor.ImageMetadata, error)
+	pdfSupported func() bool
+	fallbacks    *fallbackRenditions
+	loadShed     loadShedder
+	routes       routeMetrics
+
+	// mismatches holds the source paths whose format mismatch was logged
+	mismatches sync.Map
+
+	// placeholder stands in for a default image that cannot be served
+	placeholder *memoryPlaceholder
+
+	// files is where resolved sources are read from
+	files storage.FS
+
+	// sourceHashes keys renditions by source content when deduplicating
+	sourceHashes *cache.SourceHashes
 }
 
 // NewImageHandler creates a new image handler
 func NewImageHandler(cfg *config.Config, res resolver.FileResolver, cacheManager cache.CacheManager, proc processor.ImageProcessor) *ImageHandler {
+	files := storage.OS
+	if sr, ok := res.(resolver.StorageResolver); ok {
+		files = sr.Storage()
+	}
+	var sourceHashes *cache.SourceHashes
+	if cfg.DedupeSources {
+		sourceHashes = cache.NewSourceHashesFrom(files)
+	}
 	return &ImageHandler{
-		config:    cfg,
-		resolver:  res,
-		cache:     cacheManager,
-		processor: proc,
+		config:     cfg,
+		resolver:   res,
+		cache:      cacheManager,
+		processor:  proc,
+		processing: newProcessingGroup(),
+		acl:        security.NewPathACL(cfg.AllowPaths, cfg.DenyPaths),
+		metadata:   processor.GetMetadata,
+
+		pdfSupported: processor.PDFSupported,
+		fallbacks:  newFallbackRenditions(),
+		files:      files,
+
+		placeholder:  &memoryPlaceholder{},
+		sourceHashes: sourceHashes,
 	}
 }
 
@@ -38,8 +90,8 @@ func (h *ImageHandler) ServeImage(c *gin.Context) {
 	// Get the full path from the wildcard
 	requestPath := c.Param("path")
 	
-	// Remove leading slash
-	requestPath = strings.TrimPrefix(requestPath, "/")
+	// Remove leading slash; trailing ones are ignored like the resolver does
+	requestPath = strings.TrimRight(strings.TrimPrefix(requestPath, "/"), "/")
 	
 	// Split path into segments
 	segments := strings.Split(requestPath, "/")
@@ -47,6 +99,9 @@ func (h *ImageHandler) ServeImage(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid path"})
 		return
 	}
+	if h.config.MetricsLabel != "" {
+		h.routes.observe(h.routeLabel(segments, c.Request.URL.Query()))
+	}
 	
 	// Check for clear command
 	if hasClearCommand(segments) {
@@ -54,24 +109,388 @@ func (h *ImageHandler) ServeImage(c *gin.Context) {
 		return
 	}
 	
+	if ok, wantMap := spriteRequest(segments); ok {
+		h.handleSprite(c, wantMap)
+		return
+	}
+	
+	if h.config.GroupIndex && len(segments) == 1 && segments[0] == GroupsSegment {
+		h.handleGroupIndex(c)
+		return
+	}
+	
+	if basePath, ok := manifestRequest(segments); ok {
+		h.handleManifest(c, basePath)
+		return
+	}
+	
+	if group, ok := groupListing(segments); ok {
+		h.handleListGroup(c, group)
+		return
+	}
+	
+	var caption processor.Caption
+	if h.captionRequest(segments) {
+		var err error
+		segments, caption, err = h.parseCaption(c, segments)
+		if errors.Is(err, errInvalidSignature) {
+			apperrors.HandleError(c, apperrors.NewInvalidSignatureError(requestPath))
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	
+	h.serveRendition(c, segments, caption, false)
+}
+
+// serveRendition serves the image named by segments, rendered with the
+// parameter segments following its path. Captioned requests carry their
+// caption. Thumbnails are rendered to cover their dimensions, and take no
+// query parameters and no GIF passthrough.
+func (h *ImageHandler) serveRendition(c *gin.Context, segments []string, caption processor.Caption, thumbnail bool) {
 	// Parse path and parameters
 	basePath, paramSegments := h.parsePathAndParams(segments)
-	params := parseParameters(paramSegments)
+	paramSegments, requestedHash := splitContentHash(paramSegments)
+	if !thumbnail {
+		paramSegments = h.withQueryParams(paramSegments, c.Request.URL.Query())
+	}
+	if h.config.CacheNamespace == config.CacheNamespaceHeader {
+		c.Writer.Header().Add("Vary", h.config.CacheNamespaceHeader)
+	}
+	if h.config.ClientHints {
+		c.Header("Accept-CH", acceptCH)
+		c.Writer.Header().Add("Vary", varyClientHints)
+	}
+	if h.config.SaveDataQuality > 0 {
+		c.Writer.Header().Add("Vary", "Save-Data")
+	}
+	timer := newRequestTimer()
 	
-	// Resolve the file path
-	result, err := h.resolver.Resolve(basePath)
+	// Resolve the file and work out the rendition and its cache key
+	req, err := h.buildRendition(c.Request, basePath, paramSegments, caption, thumbnail)
+	timer.mark("resolve")
+	if len(h.config.PreloadRenditions) > 0 {
+		c.Set(preloadKey, h.preloadLinks(c, basePath, req.requested))
+	}
+	if req.varyUserAgent {
+		c.Writer.Header().Add("Vary", "User-Agent")
+	}
 	if err != nil {
-		// If resolution fails, try to use default image
-		if h.config.DefaultImagePath != "" {
-			result = &resolver.ResolutionResult{
-				ResolvedPath: h.config.DefaultImagePath,
-				IsFallback:   true,
-				FallbackType: "system_default",
+		h.handleRenditionError(c, req, err)
+		return
+	}
+	result, params, cacheKey := req.result, req.params, req.cacheKey
+	cacheParams := params
+	
+	graceWindow := h.fallbackGraceWindow(result)
+	if graceWindow > 0 {
+		c.Set(fallbackKey, true)
+	}
+	
+	// Content-hash URLs are only served for the current source version
+	contentHash := h.contentHash(cacheKey, result, cacheParams)
+	if contentHash != "" {
+		c.Header("X-Content-Hash", contentHash)
+		c.Header("ETag", etagFor(contentHash))
+	}
+	if requestedHash != "" {
+		if requestedHash != contentHash {
+			h.handleHashMismatch(c, basePath, requestedHash, contentHash)
+			return
+		}
+		c.Set(immutableKey, true)
+	}
+	
+	// Large originals are sent from the source file as they are read
+	if h.streamOriginal(c, result.ResolvedPath, params, timer) {
+		return
+	}
+	
+	// Requests that may not be served from cache still refresh the entry
+	cacheStatus := cacheMiss
+	var cachedData []byte
+	found := false
+	if h.config.HonorNoCache && noCacheRequested(c.Request) {
+		cacheStatus = cacheBypass
+	} else {
+		cachedData, found, err = h.cache.Retrieve(cacheKey, cacheParams)
+		// Fallback renditions expire after the grace window
+		if found && graceWindow > 0 && !h.fallbacks.fresh(processingKey(cacheKey, cacheParams), graceWindow) {
+			found = false
+		}
+	}
+	// Under load misses are rendered at reduced quality and cached apart,
+	// so full quality is rendered again once load drops. Content-hash URLs
+	// promise one rendition forever and are never reduced.
+	if !found && requestedHash == "" && h.shedding(h.processing.inFlight.Load()) {
+		if reduced, ok := h.shedQuality(params); ok {
+			params = reduced
+			cacheParams.Quality, cacheParams.AutoQuality = reduced.Quality, reduced.AutoQuality
+			h.loadShed.reduced.Add(1)
+			c.Header("X-Quality-Reduced", "load")
+			c.Set(degradedKey, true)
+			if contentHash = h.contentHash(cacheKey, result, cacheParams); contentHash != "" {
+				c.Header("X-Content-Hash", contentHash)
+				c.Header("ETag", etagFor(contentHash))
+			}
+			if cacheStatus == cacheMiss && graceWindow == 0 {
+				cachedData, found, err = h.cache.Retrieve(cacheKey, cacheParams)
 			}
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "file resolution failed"})
+		}
+	}
+	timer.mark("cache")
+	if err == nil && found {
+		// Serve from cache unless the entry's magic number does not match its format
+		if format, original, ok := h.verifyCached(cachedData, params.Format, result.ResolvedPath); ok {
+			// GIF is only ever passed through, so a cached GIF is the original
+			if original || format == gifFormat || params.Original {
+				c.Header("X-Served-Original", "true")
+				c.Set(originalKey, true)
+			} else if !sameFormat(format, params.Format) {
+				c.Header("X-Format-Downgraded-From", params.Format)
+			}
+			c.Header("Server-Timing", timer.serverTiming())
+			c.Header("X-Cache", cacheHit)
+			h.serveImageData(c, cachedData, format)
+			return
+		}
+		log.Printf("Warning: cached %s for %s does not match its format, reprocessing", params.Format, cacheKey)
+	}
+	
+	// Read, process and cache once for identical concurrent requests
+	rendered, shared, err := h.processing.DoContext(c.Request.Context(), processingKey(cacheKey, cacheParams), func(ctx context.Context) (*rendition, error) {
+		rendered, err := h.renderFile(ctx, result.ResolvedPath, cacheKey, cacheParams, params)
+		if err == nil && graceWindow > 0 {
+			h.fallbacks.record(processingKey(cacheKey, cacheParams), graceWindow)
+		}
+		return rendered, err
+	})
+	processing := timer.mark("process")
+	if !shared {
+		h.logSlowProcessing(result.ResolvedPath, cacheParams, processing)
+	}
+	if err != nil {
+		// A default image that cannot be served is replaced, not reported
+		if !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled) && h.serveDefaultPlaceholder(c, result, params, err) {
 			return
 		}
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			apperrors.HandleError(c, apperrors.NewTimeoutError("image processing", h.config.ImageTimeout.String()))
+		case errors.Is(err, context.Canceled):
+			// The client went away, there is nobody to answer
+			c.Abort()
+		case errors.Is(err, errReadImage):
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read image"})
+		case errors.Is(err, errProcessingPanic):
+			h.handleProcessingPanic(c, basePath, result, cacheParams, params, err)
+		case errors.Is(err, processor.ErrTransformFailed):
+			var transformErr *processor.TransformError
+			errors.As(err, &transformErr)
+			apperrors.HandleError(c, apperrors.NewTransformError(transformErr.Transform, err))
+		case errors.Is(err, processor.ErrCropOutOfBounds):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, processor.ErrInvalidImage):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "corrupted or invalid image"})
+		case errors.Is(err, processor.ErrUnsupportedInputFormat):
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "unsupported source image format"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("image processing failed: %v", err)})
+		}
+		return
+	}
+	// The source may have changed since the content hash was taken, so
+	// the response carries the hash of the version actually read
+	if contentHash != "" {
+		if current := h.versionHash(cacheKey, rendered.version, cacheParams); current != contentHash {
+			if requestedHash != "" {
+				h.handleHashMismatch(c, basePath, requestedHash, current)
+				return
+			}
+			c.Header("X-Content-Hash", current)
+			c.Header("ETag", etagFor(current))
+		}
+	}
+	if rendered.original {
+		c.Header("X-Served-Original", "true")
+		c.Set(originalKey, true)
+	} else if !sameFormat(rendered.format, params.Format) {
+		c.Header("X-Format-Downgraded-From", params.Format)
+	}
+	if rendered.quality > 0 {
+		c.Header("X-Image-Quality", strconv.Itoa(rendered.quality))
+	}
+	c.Header("Server-Timing", timer.serverTiming())
+	c.Header("X-Cache", cacheStatus)
+	
+	// Serve the processed image
+	h.serveImageData(c, rendered.data, rendered.format)
+}
+
+// handleRenditionError answers a request whose rendition could not be built
+func (h *ImageHandler) handleRenditionError(c *gin.Context, req *renditionRequest, err error) {
+	switch {
+	case errors.Is(err, errInvalidNamespace):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errAccessDenied):
+		apperrors.HandleError(c, apperrors.NewAccessDeniedError(req.basePath))
+	case errors.Is(err, resolver.ErrEmptySource):
+		apperrors.HandleError(c, apperrors.NewEmptyImageError(req.basePath))
+	case errors.Is(err, errImageMissing):
+		h.handleMiss(c, req.basePath)
+	case errors.Is(err, errFormatMismatch):
+		apperrors.HandleError(c, apperrors.NewFormatMismatchError(req.basePath, extensionFormat(req.result.ResolvedPath), req.contentFormat))
+	case errors.Is(err, errFormatNotAllowed):
+		apperrors.HandleError(c, apperrors.NewFormatNotAllowedError(req.params.Format))
+	case errors.Is(err, errPDFUnsupported):
+		apperrors.HandleError(c, apperrors.NewUnsupportedFormatError(pdfFormat))
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "file resolution failed"})
+	}
+}
+
+// parseParams parses parameter segments like parseParameters, using the
+// configured default output format when the segments name none
+func (h *ImageHandler) parseParams(segments []string) cache.ProcessingParams {
+	params := parseParameters(segments)
+	if h.config.DefaultOutputFormat != "" && !formatRequested(segments) {
+		params.Format = h.config.DefaultOutputFormat
+	}
+	return params
+}
+
+// applyDefaults fills parameters the request left to configuration,
+// including the trim threshold.
+// Chroma subsampling only applies to JPEG output, the sRGB profile only to
+// converted output, progressive encoding only to JPEG and PNG output.
+func (h *ImageHandler) applyDefaults(params cache.ProcessingParams) cache.ProcessingParams {
+	if params.Trim {
+		params.TrimThreshold = h.config.TrimThreshold
+	}
+	if h.config.ColorSpace == config.ColorSpacePreserve {
+		params.ColorSpace = config.ColorSpacePreserve
+	} else {
+		params.EmbedICC = h.config.EmbedICC
+	}
+	if params.Width > 0 || params.Height > 0 {
+		params.MaxUpscale = h.config.MaxUpscale
+	}
+	if params.Format != "jpeg" && params.Format != "jpg" {
+		params.ChromaSubsampling = ""
+	} else if params.ChromaSubsampling == "" {
+		params.ChromaSubsampling = h.config.JPEGSubsampling
+	}
+	switch params.Format {
+	case "jpeg", "jpg", "png":
+		params.Progressive = params.Progressive || h.config.Progressive
+	default:
+		params.Progressive = false
+	}
+	return params
+}
+
+// applySaveData reduces params for a client that asked to save data: WebP,
+// the most compact output, at no more than the configured quality
+func (h *ImageHandler) applySaveData(params cache.ProcessingParams) cache.ProcessingParams {
+	params.SaveData = true
+	params.Format = "webp"
+	params.AutoQuality = false
+	params.Quality = min(params.Quality, h.config.SaveDataQuality)
+	return h.applyDefaults(params)
+}
+
+// saveDataRequested reports whether the client sent the Save-Data: on hint
+func saveDataRequested(r *http.Request) bool {
+	return strings.EqualFold(strings.TrimSpace(r.Header.Get("Save-Data")), "on")
+}
+
+// X-Cache values: served from cache, freshly processed, or re-rendered or
+// streamed without reading the cache
+const (
+	cacheHit    = "HIT"
+	cacheMiss   = "MISS"
+	cacheBypass = "BYPASS"
+)
+
+// noCacheRequested reports whether the client asked not to be served a
+// stored response, with Cache-Control: no-cache or Pragma: no-cache
+func noCacheRequested(r *http.Request) bool {
+	for _, directive := range strings.Split(r.Header.Get("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-cache") {
+			return true
+		}
+	}
+	return r.Header.Get("Cache-Control") == "" && strings.EqualFold(r.Header.Get("Pragma"), "no-cache")
+}
+
+// gifFormat names GIF data; GIF is never produced, only passed through
+const gifFormat = "gif"
+
+// pdfFormat names a single-page PDF wrapping a JPEG rendition
+const pdfFormat = string(processor.FormatPDF)
+
+// passthroughGIF reports whether a source of contentFormat is served as
+// stored because it is a GIF, passthrough is configured and the request did
+// not ask for a format
+func (h *ImageHandler) passthroughGIF(contentFormat string, segments []string) bool {
+	return h.config.AnimatedGIF == config.AnimatedGIFPassthrough &&
+		contentFormat == gifFormat &&
+		!formatRequested(segments)
+}
+
+// applySourceFormat sets the output format from the rule for the source's
+// format when none was requested. Save-Data renditions stay WebP.
+func (h *ImageHandler) applySourceFormat(path string, segments []string, params cache.ProcessingParams) cache.ProcessingParams {
+	if len(h.config.SourceFormatRules) == 0 || params.SaveData || formatRequested(segments) {
+		return params
+	}
+	if format := h.config.SourceFormat(sourceFormat(h.files, path)); format != "" {
+		params.Format = format
+		params = h.applyDefaults(params)
+	}
+	return params
+}
+
+// withQueryParams appends query parameters to the path parameter segments
+// unless the query string is configured to be stripped
+func (h *ImageHandler) withQueryParams(segments []string, query url.Values) []string {
+	if h.config.QueryParams == config.QueryParamsStrip {
+		return segments
+	}
+	return append(segments, querySegments(query)...)
+}
+
+// bypassFallback reports whether missing images skip the default image fallback
+func (h *ImageHandler) bypassFallback() bool {
+	return h.config.MissBehavior == config.MissBehaviorNotFound || h.config.MissBehavior == config.MissBehaviorRedirect
+}
+
+// handleMiss answers a request for a missing image according to MissBehavior
+func (h *ImageHandler) handleMiss(c *gin.Context, basePath string) {
+	if h.config.MissBehavior == config.MissBehaviorRedirect {
+		c.Redirect(http.StatusFound, h.config.PlaceholderURL)
+		return
+	}
+	apperrors.HandleError(c, apperrors.NewImageNotFoundError(basePath))
+}
+
+// resolveImage resolves a base path, falling back to the configured default image
+func (h *ImageHandler) resolveImage(basePath string) (*resolver.ResolutionResult, error) {
+	result, err := h.resolver.Resolve(basePath)
+	if err != nil {
+		// If resolution fails, try to use default image. Empty sources are
+		// only resolved to an error when they should be reported as one.
+		if h.config.DefaultImagePath == "" || errors.Is(err, resolver.ErrEmptySource) {
+			return nil, err
+		}
+		result = &resolver.ResolutionResult{
+			ResolvedPath: h.config.DefaultImagePath,
+			IsFallback:   true,
+			FallbackType: "system_default",
+		}
 	}
 	
 	// If file not found in resolution result, use default image
@@ -79,57 +498,430 @@ func (h *ImageHandler) ServeImage(c *gin.Context) {
 		result.ResolvedPath = h.config.DefaultImagePath
 	}
 	
-	// Convert params to cache params
-	cacheParams := cache.ProcessingParams{
-		Width:   params.Width,
-		Height:  params.Height,
-		Format:  params.Format,
-		Quality: params.Quality,
+	return result, nil
+}
+
+// errAccessDenied is returned when the path ACL denies a resolved image
+var errAccessDenied = errors.New("access denied")
+
+// checkAccess applies the path ACL to a resolved image. Denied images are
+// replaced by the system default when DeniedBehavior is fallback.
+func (h *ImageHandler) checkAccess(result *resolver.ResolutionResult) (*resolver.ResolutionResult, error) {
+	if h.allowed(result) {
+		return result, nil
 	}
-	
-	// Check cache first (cache under the original request path for fallback images)
-	cacheKey := basePath
-	if result.IsFallback {
-		// For fallback images, cache under the original requested path
-		cacheKey = basePath
-	} else {
-		cacheKey = result.ResolvedPath
+	if h.config.DeniedBehavior != config.DeniedBehaviorFallback {
+		return nil, errAccessDenied
 	}
-	
-	cachedData, found, err := h.cache.Retrieve(cacheKey, cacheParams)
-	if err == nil && found {
-		// Serve from cache
-		h.serveImageData(c, cachedData, params.Format)
+
+	fallback, err := h.defaultImage()
+	if err != nil {
+		return nil, errAccessDenied
+	}
+	return fallback, nil
+}
+
+// allowed reports whether the path ACL allows a resolved image. The system
+// default image is always public.
+func (h *ImageHandler) allowed(result *resolver.ResolutionResult) bool {
+	if h.acl.Empty() || result.FallbackType == "system_default" {
+		return true
+	}
+
+	imagesDir, err := filepath.Abs(h.config.ImagesDir)
+	if err != nil {
+		return false
+	}
+	resolvedPath, err := filepath.Abs(result.ResolvedPath)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(imagesDir, resolvedPath)
+	if err != nil {
+		return false
+	}
+	return h.acl.Allowed(rel)
+}
+
+// cacheKeyFor returns the cache key for a resolved request.
+// Fallback images are cached under the original requested path, except
+// group placeholders which are shared by the whole group.
+func (h *ImageHandler) cacheKeyFor(basePath string, result *resolver.ResolutionResult) string {
+	if result.IsFallback && result.FallbackType != groupPlaceholderType {
+		return basePath
+	}
+	if h.sourceHashes != nil {
+		sum, err := h.sourceHashes.Sum(result.ResolvedPath)
+		if err == nil {
+			return cache.ContentPath(sum)
+		}
+		log.Printf("Warning: failed to hash %s, caching by path: %v", result.ResolvedPath, err)
+	}
+	return result.ResolvedPath
+}
+
+// fallbackGraceWindow returns how long a rendition of result may be served
+// from cache when it is a default image cached under the requested path, or
+// 0 when its lifetime is not limited
+func (h *ImageHandler) fallbackGraceWindow(result *resolver.ResolutionResult) time.Duration {
+	if !result.IsFallback || result.FallbackType == groupPlaceholderType {
+		return 0
+	}
+	return h.config.FallbackCacheTTL
+}
+
+// immutableKey marks a request whose content hash matched the current rendition
+const immutableKey = "immutable"
+
+// contentHash returns the hash used in content-hash URLs. It is GenerateKey
+// over the cache key and the source's size and modification time, so it
+// changes whenever the source file does. It is empty if the source is gone.
+func (h *ImageHandler) contentHash(cacheKey string, result *resolver.ResolutionResult, params cache.ProcessingParams) string {
+	info, err := h.files.Stat(result.ResolvedPath)
+	if err != nil {
+		return ""
+	}
+	return h.versionHash(cacheKey, sourceVersion{size: info.Size(), modTime: info.ModTime()}, params)
+}
+
+// versionHash returns the content hash of a rendition of one source version
+func (h *ImageHandler) versionHash(cacheKey string, version sourceVersion, params cache.ProcessingParams) string {
+	return h.cache.GenerateKey(cacheKey+"@"+version.String(), params)
+}
+
+// handleHashMismatch answers a content-hash URL whose hash is outdated
+// according to HashMismatch
+func (h *ImageHandler) handleHashMismatch(c *gin.Context, basePath, requested, current string) {
+	c.Header("Cache-Control", "no-cache")
+	if h.config.HashMismatch == config.HashMismatchRedirect && current != "" {
+		target := *c.Request.URL
+		target.Path = strings.Replace(target.Path, "h-"+requested, "h-"+current, 1)
+		target.RawPath = ""
+		c.Redirect(http.StatusFound, target.String())
 		return
 	}
+	apperrors.HandleError(c, apperrors.NewImageNotFoundError(basePath))
+}
+
+// errReadImage is returned when the resolved source file cannot be read
+var errReadImage = errors.New("failed to read image")
+
+// processingKey identifies a rendition for request coalescing
+func processingKey(cacheKey string, params cache.ProcessingParams) string {
+	return fmt.Sprintf("%s|%dx%d|%s|%d|%t|%s|%t|%d|%d|%t|%t|%s|%v|%t|%d|%s|%t|%t|%t|%t|%g|%t|%s", cacheKey, params.Width, params.Height, params.Format, params.Quality, params.AutoQuality, params.ChromaSubsampling, params.Poster, params.Frame, params.DPI, params.Pad, params.Cover, params.Background, params.Crop, params.Trim, params.TrimThreshold, params.ColorSpace, params.EmbedICC, params.SaveData, params.Progressive, params.NoUpscale, params.MaxUpscale, params.Original, params.Filter) + captionKey(params)
+}
+
+// renderFile reads the source image, renders it and stores the result in the
+// cache. Processing is skipped if ctx is cancelled once the file is read.
+func (h *ImageHandler) renderFile(ctx context.Context, path, cacheKey string, cacheParams, params cache.ProcessingParams) (*rendition, error) {
+	imageData, version, err := readSource(h.files, path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errReadImage, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	
-	// Read the image file
-	imageData, err := os.ReadFile(result.ResolvedPath)
+	rendered, err := h.renderRecovered(ctx, path, imageData, params)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read image"})
-		return
+		return nil, err
+	}
+	rendered.version = version
+	// A processing abandoned by every client is not cached, its
+	// result may be incomplete
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 	
+	h.storeRendition(cacheKey, cacheParams, rendered)
+	if err := h.cache.TrackVersion(cacheKey, path, version.modTime); err != nil {
+		log.Printf("Warning: failed to track source version of %s: %v", path, err)
+	}
+	return rendered, nil
+}
+
+// errProcessingPanic is returned when rendering a source panicked
+var errProcessingPanic = errors.New("image processing panicked")
+
+// renderRecovered renders like renderImage but turns a panic in the
+// processor into errProcessingPanic, logging the source, params and stack
+func (h *ImageHandler) renderRecovered(ctx context.Context, path string, imageData []byte, params cache.ProcessingParams) (rendered *rendition, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("Error: processing %s with %+v panicked: %v\n%s", path, params, p, debug.Stack())
+			rendered, err = nil, fmt.Errorf("%w: %v", errProcessingPanic, p)
+		}
+	}()
+	return h.renderImage(ctx, imageData, params)
+}
+
+// degradedKey marks a response that stands in for the requested rendition,
+// e.g. for an image that failed or one encoded at reduced quality under load
+const degradedKey = "degraded"
+
+// handleProcessingPanic answers a request whose processing panicked. With
+// PanicFallback the default image is rendered instead, unless misses are not
+// answered with fallbacks or the failing image already was the default.
+// The stand-in is not cached by clients.
+func (h *ImageHandler) handleProcessingPanic(c *gin.Context, basePath string, result *resolver.ResolutionResult, cacheParams, params cache.ProcessingParams, err error) {
+	if h.config.PanicFallback && !h.bypassFallback() && result.FallbackType != "system_default" {
+		if fallback, fbErr := h.defaultImage(); fbErr == nil && fallback.ResolvedPath != result.ResolvedPath {
+			rendered, fbErr := h.renderFile(c.Request.Context(), fallback.ResolvedPath, fallback.ResolvedPath, cacheParams, params)
+			if fbErr == nil {
+				c.Writer.Header().Del("ETag")
+				c.Writer.Header().Del("X-Content-Hash")
+				c.Set(degradedKey, true)
+				c.Header("X-Cache", cacheBypass)
+				h.serveImageData(c, rendered.data, rendered.format)
+				return
+			}
+		}
+	}
+	apperrors.HandleError(c, apperrors.NewProcessingPanicError(basePath, err))
+}
+
+// defaultImage resolves the system default image
+func (h *ImageHandler) defaultImage() (*resolver.ResolutionResult, error) {
+	if h.config.DefaultImagePath != "" {
+		return &resolver.ResolutionResult{
+			ResolvedPath: h.config.DefaultImagePath,
+			IsFallback:   true,
+			FallbackType: "system_default",
+		}, nil
+	}
+	return h.resolver.ResolveDefault()
+}
+
+// rendition is a rendered image ready to be cached and served
+type rendition struct {
+	data     []byte
+	format   string
+	original bool // Untouched source kept because transcoding made it larger
+	quality  int  // Quality chosen by qauto, 0 for fixed quality
+
+	// version is the source version rendered, set by renderFile
+	version sourceVersion
+}
+
+// formatDowngrades maps an output format to the next best one, tried when
+// encoding the former fails
+var formatDowngrades = map[string]string{
+	"webp": "jpeg",
+}
+
+// isDowngrade reports whether format is reached from requested by
+// following formatDowngrades
+func isDowngrade(requested, format string) bool {
+	for next := formatDowngrades[requested]; next != ""; next = formatDowngrades[next] {
+		if sameFormat(next, format) {
+			return true
+		}
+	}
+	return false
+}
+
+// renderImage validates and processes source image data for params
+func (h *ImageHandler) renderImage(ctx context.Context, imageData []byte, params cache.ProcessingParams) (*rendition, error) {
 	// Validate image
 	if err := h.processor.ValidateImage(imageData); err != nil {
-		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "corrupted or invalid image"})
-		return
+		if errors.Is(err, processor.ErrUnsupportedInputFormat) {
+			return nil, err
+		}
+		return nil, processor.ErrInvalidImage
+	}
+	if params.Format == gifFormat {
+		return &rendition{data: imageData, format: gifFormat, original: true}, nil
+	}
+	// Sources that are never transcoded are served as stored, unless their
+	// format has since become disallowed
+	if params.Original {
+		if sniffed, err := security.ValidateFileType(imageData); err == nil && sameFormat(sniffed, params.Format) {
+			return &rendition{data: imageData, format: params.Format, original: true}, nil
+		}
 	}
 	
-	// Process the image
-	processedData, err := h.processImage(imageData, params)
+	// Process the image, downgrading the format while encoding fails
+	processedData, quality, err := h.processImage(ctx, imageData, params)
+	for err != nil && errors.Is(err, processor.ErrInvalidImage) && formatDowngrades[params.Format] != "" {
+		log.Printf("Warning: encoding %s failed, downgrading to %s", params.Format, formatDowngrades[params.Format])
+		params.Format = formatDowngrades[params.Format]
+		params = h.applyDefaults(params)
+		processedData, quality, err = h.processImage(ctx, imageData, params)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("image processing failed: %v", err)})
-		return
+		return nil, err
 	}
 	
-	// Store in cache
-	if err := h.cache.Store(cacheKey, cacheParams, processedData); err != nil {
-		log.Printf("Warning: failed to cache image: %v", err)
+	// Keep the original if transcoding without a resize only made it larger.
+	// Posters never fall back to the animated source, nor DPI, padded,
+	// cropped, trimmed, filtered or captioned renditions to a source without
+	// the requested resolution, area, colors or text.
+	if h.config.ServeSmallerOriginal && !params.Poster && params.DPI == 0 && !params.Pad && params.Crop == [4]int{} && !params.Trim && !params.Progressive && params.Filter == "" && params.Caption == "" && params.Format != pdfFormat && len(processedData) > len(imageData) && !needsResize(imageData, params) {
+		if sniffed, err := security.ValidateFileType(imageData); err == nil {
+			return &rendition{data: imageData, format: sniffed, original: true}, nil
+		}
 	}
 	
-	// Serve the processed image
-	h.serveImageData(c, processedData, params.Format)
+	return &rendition{data: processedData, format: params.Format, quality: quality}, nil
+}
+
+// storeRendition caches a rendition. Auto quality renditions are also
+// stored under the chosen quality so fixed-quality requests can reuse them.
+// A read-only cache is not written and has already logged why.
+func (h *ImageHandler) storeRendition(cacheKey string, params cache.ProcessingParams, r *rendition) {
+	if err := h.cache.Store(cacheKey, params, r.data); err != nil {
+		if !errors.Is(err, cache.ErrReadOnly) {
+			log.Printf("Warning: failed to cache image: %v", err)
+		}
+		return
+	}
+	if params.AutoQuality && r.quality > 0 {
+		params.AutoQuality = false
+		params.Quality = r.quality
+		if err := h.cache.Store(cacheKey, params, r.data); err != nil {
+			log.Printf("Warning: failed to cache image: %v", err)
+		}
+	}
+}
+
+// verifyCached checks the magic number of cached data against the format it
+// was stored for. It returns the format to serve, whether the data is the
+// smaller original kept by ServeSmallerOriginal, and whether it is usable.
+func (h *ImageHandler) verifyCached(data []byte, format string, sourcePath string) (string, bool, bool) {
+	if format == pdfFormat {
+		return format, false, processor.IsPDF(data)
+	}
+	sniffed, err := security.ValidateFileType(data)
+	if err != nil {
+		return "", false, false
+	}
+	if sameFormat(sniffed, format) {
+		return format, false, true
+	}
+	
+	// A mismatch is only legitimate when the source itself was kept
+	if h.config.ServeSmallerOriginal && sourceFormat(h.files, sourcePath) == sniffed {
+		return sniffed, true, true
+	}
+	// or when encoding the requested format failed and a downgrade was stored
+	if isDowngrade(format, sniffed) {
+		return sniffed, false, true
+	}
+	return "", false, false
+}
+
+// sniffLength is the header length security.ValidateFileType inspects
+const sniffLength = 12
+
+// sourceFormat sniffs the format of the file at path from its header, ""
+// if unreadable
+func sourceFormat(files storage.FS, path string) string {
+	file, err := files.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	header := make([]byte, sniffLength)
+	n, err := io.ReadFull(file, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return ""
+	}
+	format, err := security.ValidateFileType(header[:n])
+	if err != nil {
+		return ""
+	}
+	return format
+}
+
+// needsResize reports whether the source would be scaled down by params.
+// Sources whose dimensions cannot be read are assumed to need a resize.
+func needsResize(data []byte, params cache.ProcessingParams) bool {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return true
+	}
+	if params.Width > 0 && cfg.Width > params.Width {
+		return true
+	}
+	if params.Height > 0 && cfg.Height > params.Height {
+		return true
+	}
+	return false
+}
+
+// upscaleLimit returns the multiple of the source's dimensions params may
+// be rendered at: 1 without upscaling, otherwise MaxUpscale (0 = unlimited)
+func upscaleLimit(params cache.ProcessingParams) float64 {
+	if params.NoUpscale {
+		return 1
+	}
+	return params.MaxUpscale
+}
+
+// withinSource scales the requested width and height of opts down, keeping
+// their ratio, until neither exceeds limit times the dimensions of the
+// region rendered: the source, or the part its crop and trim leave.
+// Sources whose dimensions cannot be read keep the requested size.
+func withinSource(data []byte, opts processor.ProcessOptions, limit float64) (int, int) {
+	width, height := opts.Width, opts.Height
+	regionWidth, regionHeight, ok := renderedRegion(data, opts)
+	if !ok {
+		return width, height
+	}
+	maxWidth, maxHeight := float64(regionWidth)*limit, float64(regionHeight)*limit
+	scale := 1.0
+	if float64(width) > maxWidth {
+		scale = maxWidth / float64(width)
+	}
+	if float64(height) > maxHeight {
+		scale = min(scale, maxHeight/float64(height))
+	}
+	if scale == 1 {
+		return width, height
+	}
+	return max(int(float64(width)*scale), min(width, 1)), max(int(float64(height)*scale), min(height, 1))
+}
+
+// renderedRegion returns the dimensions of the part of the source opts
+// render, cropped first and then trimmed like the processor does. Trimming
+// decodes the source; one Go cannot decode, or one over the processor's
+// MaxTrimPixels, keeps its cropped dimensions.
+func renderedRegion(data []byte, opts processor.ProcessOptions) (int, int, bool) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, false
+	}
+	region := processor.CropRect{Width: cfg.Width, Height: cfg.Height}
+	if !opts.Crop.Empty() {
+		if crop, err := opts.Crop.Fit(cfg.Width, cfg.Height, opts.ClampCrop); err == nil {
+			region = crop
+		}
+	}
+	if opts.Trim && processor.TrimmablePixels(cfg.Width, cfg.Height) {
+		if img, _, err := image.Decode(bytes.NewReader(data)); err == nil {
+			bounds := image.Rect(region.X, region.Y, region.X+region.Width, region.Y+region.Height).Add(img.Bounds().Min)
+			if sub, ok := img.(interface {
+				SubImage(image.Rectangle) image.Image
+			}); ok {
+				img = sub.SubImage(bounds)
+			}
+			if trimmed, ok := processor.TrimRect(img, opts.TrimThreshold); ok {
+				region = trimmed
+			}
+		}
+	}
+	return region.Width, region.Height, true
+}
+
+// sameFormat reports whether two format names refer to the same encoding
+func sameFormat(a, b string) bool {
+	normalize := func(f string) string {
+		if f == "jpg" {
+			return "jpeg"
+		}
+		return f
+	}
+	return normalize(a) == normalize(b)
 }
 
 // parsePathAndParams separates the base path from processing parameters
@@ -154,9 +946,8 @@ func (h *ImageHandler) parsePathAndParams(segments []string) (string, []string)
 	}
 	
 	// Check if first segment is a directory
-	firstPath := filepath.Join(h.config.ImagesDir, segments[0])
-	info, err := os.Stat(firstPath)
-	if err == nil && info.IsDir() {
+	if group, ok := h.groupDir(segments[0]); ok {
+		segments = append([]string{group}, segments[1:]...)
 		// It's a directory (grouped image)
 		if len(segments) == 1 {
 			// Just the folder name, accessing default
@@ -199,7 +990,7 @@ func (h *ImageHandler) looksLikeParameter(segment string) bool {
 		// Format like "webp", "png", "jpeg"
 		return true
 	}
-	if segment == "clear" {
+	if segment == "clear" || segment == PosterSegment || frameRegex.MatchString(segment) || dpiRegex.MatchString(segment) || segment == PadSegment || segment == TrimSegment || filterRegex.MatchString(segment) || backgroundRegex.MatchString(segment) || cropRegex.MatchString(segment) || contentHashRegex.MatchString(segment) || decodeToken(segment) != nil {
 		return true
 	}
 	// Check if it's a pure number (width only)
@@ -209,34 +1000,119 @@ func (h *ImageHandler) looksLikeParameter(segment string) bool {
 	return false
 }
 
-// processImage processes the image with the given parameters
-func (h *ImageHandler) processImage(data []byte, params cache.ProcessingParams) ([]byte, error) {
+// processImage processes the image with the given parameters.
+// For auto quality it also returns the chosen quality.
+func (h *ImageHandler) processImage(ctx context.Context, data []byte, params cache.ProcessingParams) ([]byte, int, error) {
 	opts := processor.ProcessOptions{
-		Width:   params.Width,
-		Height:  params.Height,
-		Format:  processor.ImageFormat(params.Format),
-		Quality: params.Quality,
+		Width:             params.Width,
+		Height:            params.Height,
+		Format:            processor.ImageFormat(params.Format),
+		Quality:           params.Quality,
+		ChromaSubsampling: processor.ChromaSubsampling(params.ChromaSubsampling),
+		Poster:            params.Poster,
+		Frame:             params.Frame,
+		DPI:               params.DPI,
+		Pad:               params.Pad,
+		Background:        params.Background,
+		Cover:             params.Cover,
+		ColorSpace:        processor.ColorSpace(params.ColorSpace),
+		EmbedICC:          params.EmbedICC,
+		Progressive:       params.Progressive,
+		Filter:            processor.Filter(params.Filter),
+		Caption: processor.Caption{
+			Text:     params.Caption,
+			Position: processor.CaptionPosition(params.CaptionPosition),
+			Size:     params.CaptionSize,
+			Color:    params.CaptionColor,
+		},
+	}
+	if params.Crop != [4]int{} {
+		opts.Crop = processor.CropRect{X: params.Crop[0], Y: params.Crop[1], Width: params.Crop[2], Height: params.Crop[3]}
+		opts.ClampCrop = h.config.CropBounds != config.CropBoundsReject
+	}
+	if params.Trim {
+		opts.Trim = true
+		opts.TrimThreshold = params.TrimThreshold
+	}
+	if limit := upscaleLimit(params); limit > 0 {
+		opts.Width, opts.Height = withinSource(data, opts, limit)
+	}
+	if sniffed, _ := security.ValidateFileType(data); sniffed == gifFormat {
+		opts.Animate = h.config.AnimatedGIF == config.AnimatedGIFWebP
+	}
+	// PDF pages wrap a JPEG rendition
+	if params.Format == pdfFormat {
+		opts.Format = processor.FormatJPEG
 	}
 	
-	return h.processor.Process(data, opts)
+	var processed []byte
+	var quality int
+	var err error
+	if params.AutoQuality {
+		aq := processor.DefaultAutoQualityOptions()
+		metric, metricErr := processor.MetricByName(h.config.QualityMetric)
+		if metricErr != nil {
+			return nil, 0, metricErr
+		}
+		aq.Metric = metric
+		processed, quality, err = processor.SelectQuality(ctx, h.processor, data, opts, aq)
+	} else {
+		processed, err = processor.ProcessContext(ctx, h.processor, data, opts)
+	}
+	if err == nil && params.Format == pdfFormat {
+		processed, err = processor.WrapPDF(processed, params.DPI)
+	}
+	return processed, quality, err
 }
 
 // serveImageData sends the image data to the client with appropriate headers
 func (h *ImageHandler) serveImageData(c *gin.Context, data []byte, format string) {
+	h.serveImageContent(c, io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data))), format)
+}
+
+// serveImageContent sends image content read from content, which may be a
+// source file, to the client with appropriate headers
+func (h *ImageHandler) serveImageContent(c *gin.Context, content *io.SectionReader, format string) {
 	// Set CORS headers
 	c.Header("Access-Control-Allow-Origin", "*")
 	c.Header("Access-Control-Allow-Methods", "GET, OPTIONS")
 	c.Header("Access-Control-Allow-Headers", "Accept, Content-Type")
 	
-	// Set cache headers
-	c.Header("Cache-Control", "public, max-age=31536000") // 1 year
+	// Set cache headers; content-hash URLs never change
+	cacheControl := "public, max-age=31536000" // 1 year
+	if c.GetBool(immutableKey) {
+		cacheControl += ", immutable"
+	}
+	if c.GetBool(fallbackKey) {
+		cacheControl = fmt.Sprintf("public, max-age=%d", int(h.config.FallbackCacheTTL.Seconds()))
+	}
+	if c.GetBool(degradedKey) {
+		cacheControl = "no-cache"
+	}
+	c.Header("Cache-Control", cacheControl)
+	
+	// Each client's validator is checked against the ETag of the data it
+	// is answered with, so requests sharing one processing still get their
+	// own 200 or 304
+	if etagNoneMatch(c.GetHeader("If-None-Match"), c.Writer.Header().Get("ETag")) {
+		c.Status(http.StatusNotModified)
+		return
+	}
 	
 	// Set content type based on format
 	contentType := h.getContentType(format)
 	c.Header("Content-Type", contentType)
+	for _, link := range c.GetStringSlice(preloadKey) {
+		c.Writer.Header().Add("Link", link)
+	}
 	
-	// Send the data
-	c.Data(http.StatusOK, contentType, data)
+	// Send the data, in parts when Range requests are accepted
+	if !h.acceptRanges(c.GetBool(originalKey)) {
+		c.Header("Accept-Ranges", "none")
+		c.DataFromReader(http.StatusOK, content.Size(), contentType, content, nil)
+		return
+	}
+	http.ServeContent(c.Writer, c.Request, "", time.Time{}, content)
 }
 
 // getContentType returns the MIME type for the given format
@@ -248,6 +1124,10 @@ func (h *ImageHandler) getContentType(format string) string {
 		return "image/png"
 	case "jpeg", "jpg":
 		return "image/jpeg"
+	case gifFormat:
+		return "image/gif"
+	case pdfFormat:
+		return "application/pdf"
 	default:
 		return "image/webp"
 	}
@@ -268,8 +1148,13 @@ func (h *ImageHandler) handleCacheClear(c *gin.Context, segments []string) {
 		return
 	}
 	
-	// Build the path
-	basePath := strings.Join(pathSegments, "/")
+	// Split into the image path and any size/quality segments
+	basePath, paramSegments := h.parsePathAndParams(pathSegments)
+	namespace, err := h.cacheNamespace(c.Request, basePath)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	
 	// Resolve the file path
 	result, err := h.resolver.Resolve(basePath)
@@ -277,9 +1162,29 @@ func (h *ImageHandler) handleCacheClear(c *gin.Context, segments []string) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
 		return
 	}
+	// Clear the key renditions are cached under, which is the request path
+	// for fallbacks and the content hash with deduplicated sources
+	cachePath := cache.NamespacedPath(namespace, h.cacheKeyFor(basePath, h.groupPlaceholder(basePath, result)))
+	
+	// With parameters, clear every format variant of that size and quality,
+	// taking the quality from the sidecar like the rendition does
+	if len(paramSegments) > 0 {
+		params := h.applySidecar(result.ResolvedPath, parseParameters(paramSegments), qualityRequested(paramSegments))
+		removed, err := h.cache.ClearVariants(cachePath, params)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to clear cache: %v", err)})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": "cache cleared",
+			"path":    basePath,
+			"removed": removed,
+		})
+		return
+	}
 	
 	// Clear cache for this path
-	if err := h.cache.Clear(result.ResolvedPath); err != nil {
+	if err := h.cache.Clear(cachePath); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to clear cache: %v", err)})
 		return
 	}
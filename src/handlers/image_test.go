@@ -1,15 +1,33 @@
 package handlers
 
 import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"goimgserver/cache"
 	"goimgserver/config"
 	"goimgserver/processor"
 	"goimgserver/resolver"
+	"goimgserver/security"
+	"goimgserver/server/health"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
@@ -74,6 +92,81 @@ func (m *mockProcessor) ValidateImage(data []byte) error {
 	return nil
 }
 
+// recordingProcessor records every Process call and returns the source
+// unchanged, or with render set a blank PNG the size bimg would render:
+// exactly the box when padding or covering it, otherwise the source fitted
+// inside the box
+type recordingProcessor struct {
+	mockProcessor
+	render bool
+
+	mu     sync.Mutex
+	calls  []processor.ProcessOptions
+	opts   processor.ProcessOptions // Options of the last call
+	source []byte                   // Source of the last call
+}
+
+func (p *recordingProcessor) Process(data []byte, opts processor.ProcessOptions) ([]byte, error) {
+	p.mu.Lock()
+	p.calls = append(p.calls, opts)
+	p.opts = opts
+	p.source = data
+	p.mu.Unlock()
+	if !p.render {
+		return data, nil
+	}
+
+	width, height := opts.Width, opts.Height
+	if source, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil && !opts.Pad && !opts.Cover {
+		scale := 1.0
+		switch {
+		case width > 0 && height > 0:
+			scale = min(float64(width)/float64(source.Width), float64(height)/float64(source.Height))
+		case width > 0:
+			scale = float64(width) / float64(source.Width)
+		case height > 0:
+			scale = float64(height) / float64(source.Height)
+		}
+		width, height = int(float64(source.Width)*scale), int(float64(source.Height)*scale)
+	}
+	var buf bytes.Buffer
+	err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, width, height)))
+	return buf.Bytes(), err
+}
+
+// setupTestHandler creates a handler for the test environment after
+// configure adjusts its config. Metadata is read with the standard library
+// decoders.
+func setupTestHandler(t *testing.T, configure func(cfg *config.Config)) (*ImageHandler, *recordingProcessor) {
+	gin.SetMode(gin.TestMode)
+	_, cacheDir, cfg := setupTestEnvironment(t)
+	if configure != nil {
+		configure(cfg)
+	}
+
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	fileResolver := resolver.NewResolverWithCache(cfg.ImagesDir)
+	fileResolver.SetCaseInsensitive(cfg.PathCase == config.PathCaseInsensitive)
+	proc := &recordingProcessor{}
+	handler := NewImageHandler(cfg, fileResolver, cacheManager, proc)
+	handler.metadata = decodeMetadata
+	return handler, proc
+}
+
+// setupTestRouter creates a handler with setupTestHandler and a router
+// serving /img and /thumb with purges and uploads the way the server does
+func setupTestRouter(t *testing.T, configure func(cfg *config.Config)) (*gin.Engine, *ImageHandler, *recordingProcessor) {
+	handler, proc := setupTestHandler(t, configure)
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+	router.POST("/img/*path", handler.HandlePost)
+	router.DELETE("/img/*path", handler.PurgeImage)
+	router.GET("/thumb/*path", handler.ServeThumbnail)
+	return router, handler, proc
+}
+
 // TestImageHandler_GET_DefaultSettings tests basic image access with default settings
 func TestImageHandler_GET_DefaultSettings(t *testing.T) {
 	// Arrange
@@ -343,6 +436,49 @@ func TestImageHandler_GET_GroupedCacheClear(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 }
 
+// TestImageHandler_GET_SizedCacheClear tests clearing every format of one size
+func TestImageHandler_GET_SizedCacheClear(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+
+	resolver := resolver.NewResolver(imagesDir)
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	proc := &mockProcessor{}
+
+	handler := NewImageHandler(cfg, resolver, cacheManager, proc)
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	for _, url := range []string{"/img/test.jpg/800x600/webp", "/img/test.jpg/800x600/jpeg", "/img/test.jpg/800x600/png", "/img/test.jpg/400x300/webp"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		require.Equal(t, http.StatusOK, w.Code, url)
+	}
+	resolvedPath := filepath.Join(imagesDir, "test.jpg")
+	sized := cache.ProcessingParams{Width: 800, Height: 600, Quality: DefaultQuality}
+	formats, err := cacheManager.Variants(resolvedPath, sized)
+	require.NoError(t, err)
+	require.Len(t, formats, 3)
+
+	// Act
+	req := httptest.NewRequest("GET", "/img/test.jpg/800x600/clear", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"removed":3`)
+	formats, err = cacheManager.Variants(resolvedPath, sized)
+	assert.NoError(t, err)
+	assert.Empty(t, formats)
+	formats, err = cacheManager.Variants(resolvedPath, cache.ProcessingParams{Width: 400, Height: 300, Quality: DefaultQuality})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"webp"}, formats)
+}
+
 // TestImageHandler_GET_CustomDimensions tests custom dimensions
 func TestImageHandler_GET_CustomDimensions(t *testing.T) {
 	// Arrange
@@ -704,60 +840,2139 @@ func TestImageHandler_Integration_CompleteFlow(t *testing.T) {
 	assert.Greater(t, len(w2.Body.Bytes()), 0)
 }
 
-// Benchmark tests
-func BenchmarkImageHandler_CacheHit(b *testing.B) {
+// inflatingProcessor is a mock processor whose output is always larger than its input
+type inflatingProcessor struct {
+	mockProcessor
+}
+
+func (m *inflatingProcessor) Process(data []byte, opts processor.ProcessOptions) ([]byte, error) {
+	return append(append([]byte{}, data...), make([]byte, 1024)...), nil
+}
+
+// TestImageHandler_GET_ServeSmallerOriginal tests that a larger transcode is replaced by the original
+func TestImageHandler_GET_ServeSmallerOriginal(t *testing.T) {
+	// Arrange
 	gin.SetMode(gin.TestMode)
-	
-	// Setup
-	imagesDir := b.TempDir()
-	cacheDir := b.TempDir()
-	
-	testImagePath := filepath.Join(imagesDir, "test.jpg")
-	if err := createTestImage(testImagePath, 100, 100); err != nil {
-		b.Fatal(err)
-	}
-	
-	defaultImagePath := filepath.Join(imagesDir, "default.jpg")
-	if err := createTestImage(defaultImagePath, 1000, 1000); err != nil {
-		b.Fatal(err)
-	}
-	
-	cfg := &config.Config{
-		ImagesDir:        imagesDir,
-		CacheDir:         cacheDir,
-		DefaultImagePath: defaultImagePath,
-	}
-	
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cfg.ServeSmallerOriginal = true
+
 	resolver := resolver.NewResolver(imagesDir)
-	cacheManager, _ := cache.NewManager(cacheDir)
-	proc := &mockProcessor{}
-	
-	handler := NewImageHandler(cfg, resolver, cacheManager, proc)
-	
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+
+	handler := NewImageHandler(cfg, resolver, cacheManager, &inflatingProcessor{})
+
 	router := gin.New()
 	router.GET("/img/*path", handler.ServeImage)
-	
-	// Prime the cache
-	req := httptest.NewRequest("GET", "/img/test.jpg", nil)
+
+	original, err := os.ReadFile(filepath.Join(imagesDir, "test.jpg"))
+	require.NoError(t, err)
+
+	// Act - 100x100 source fits the default 1000x1000 box, so no resize is needed
+	req := httptest.NewRequest("GET", "/img/test.jpg/webp", nil)
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
-	
-	// Reset timer
-	b.ResetTimer()
-	
-	// Benchmark
-	for i := 0; i < b.N; i++ {
-		req := httptest.NewRequest("GET", "/img/test.jpg", nil)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, original, w.Body.Bytes())
+	assert.Equal(t, "true", w.Header().Get("X-Served-Original"))
+	assert.Equal(t, "image/jpeg", w.Header().Get("Content-Type"))
+
+	// The cache keeps the smaller original
+	params := cache.ProcessingParams{Width: DefaultWidth, Height: DefaultHeight, Format: "webp", Quality: DefaultQuality}
+	cached, found, err := cacheManager.Retrieve(filepath.Join(imagesDir, "test.jpg"), params)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, original, cached)
+
+	// A cache hit is served with the original's content type
+	req = httptest.NewRequest("GET", "/img/test.jpg/webp", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, original, w.Body.Bytes())
+	assert.Equal(t, "true", w.Header().Get("X-Served-Original"))
+	assert.Equal(t, "image/jpeg", w.Header().Get("Content-Type"))
+}
+
+// TestImageHandler_GET_ServeSmallerOriginal_ResizeRequest tests that resized output is always served
+func TestImageHandler_GET_ServeSmallerOriginal_ResizeRequest(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cfg.ServeSmallerOriginal = true
+
+	resolver := resolver.NewResolver(imagesDir)
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+
+	handler := NewImageHandler(cfg, resolver, cacheManager, &inflatingProcessor{})
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	original, err := os.ReadFile(filepath.Join(imagesDir, "test.jpg"))
+	require.NoError(t, err)
+
+	// Act
+	req := httptest.NewRequest("GET", "/img/test.jpg/50x50/webp", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, len(original)+1024, len(w.Body.Bytes()))
+	assert.Empty(t, w.Header().Get("X-Served-Original"))
+}
+
+// TestImageHandler_GET_ServeSmallerOriginal_Disabled tests that the transcode is served when disabled
+func TestImageHandler_GET_ServeSmallerOriginal_Disabled(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cfg.ServeSmallerOriginal = false
+
+	resolver := resolver.NewResolver(imagesDir)
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+
+	handler := NewImageHandler(cfg, resolver, cacheManager, &inflatingProcessor{})
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	// Act
+	req := httptest.NewRequest("GET", "/img/test.jpg/webp", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("X-Served-Original"))
+	assert.Equal(t, "image/webp", w.Header().Get("Content-Type"))
+}
+
+// heifRejectingProcessor rejects HEIF sources like a libvips build without HEIF
+type heifRejectingProcessor struct {
+	mockProcessor
+}
+
+func (p *heifRejectingProcessor) ValidateImage(data []byte) error {
+	if processor.IsHEIF(data) {
+		return processor.ErrUnsupportedInputFormat
+	}
+	return p.mockProcessor.ValidateImage(data)
+}
+
+// copyHEICFixture copies the processor HEIC fixture into the images directory
+func copyHEICFixture(t *testing.T, imagesDir string) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "processor", "testdata", "sample.heic"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(imagesDir, "photo.heic"), data, 0644))
+}
+
+// TestImageHandler_GET_HEICSource tests that HEIC sources are transcoded, never passed through
+func TestImageHandler_GET_HEICSource(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cfg.ServeSmallerOriginal = true
+	copyHEICFixture(t, imagesDir)
+
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	proc := &recordingProcessor{}
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	for _, url := range []string{"/img/photo.heic", "/img/photo"} {
+		// Act
 		w := httptest.NewRecorder()
-		router.ServeHTTP(w, req)
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+
+		// Assert
+		assert.Equal(t, http.StatusOK, w.Code, url)
+		assert.Empty(t, w.Header().Get("X-Served-Original"), url)
+		assert.Equal(t, processor.FormatWebP, proc.opts.Format, url)
+		assert.Equal(t, "image/webp", w.Header().Get("Content-Type"), url)
 	}
 }
 
-func BenchmarkParseParameters(b *testing.B) {
-	segments := []string{"800x600", "webp", "q90"}
-	
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		_ = parseParameters(segments)
+// TestImageHandler_GET_HEICUnsupported tests the response when HEIF decoding is unavailable
+func TestImageHandler_GET_HEICUnsupported(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	copyHEICFixture(t, imagesDir)
+
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, &heifRejectingProcessor{})
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	// Act
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/photo.heic/jpeg", nil))
+
+	// Assert
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	assert.False(t, cacheManager.Exists(filepath.Join(imagesDir, "photo.heic"), cache.ProcessingParams{Width: DefaultWidth, Height: DefaultHeight, Format: "jpeg", Quality: DefaultQuality}))
+}
+
+// setupACLRouter creates a test router whose config restricts path access
+func setupACLRouter(t *testing.T, configure func(cfg *config.Config)) (*gin.Engine, string, cache.CacheManager) {
+	router, handler, _ := setupTestRouter(t, func(cfg *config.Config) {
+		require.NoError(t, createTestImage(filepath.Join(cfg.ImagesDir, "internal", "secret.jpg"), 100, 100))
+		require.NoError(t, createTestImage(filepath.Join(cfg.ImagesDir, "internal", "default.jpg"), 100, 100))
+		configure(cfg)
+	})
+	return router, handler.config.ImagesDir, handler.cache
+}
+
+// TestImageHandler_GET_DeniedPath tests that denied prefixes return 403 and siblings are served
+func TestImageHandler_GET_DeniedPath(t *testing.T) {
+	// Arrange
+	router, imagesDir, cacheManager := setupACLRouter(t, func(cfg *config.Config) {
+		cfg.DenyPaths = []string{"internal"}
+	})
+
+	// A rendition cached before the rule was added must not leak
+	params := cache.ProcessingParams{Width: DefaultWidth, Height: DefaultHeight, Format: "jpeg", Quality: DefaultQuality}
+	secret, err := os.ReadFile(filepath.Join(imagesDir, "internal", "secret.jpg"))
+	require.NoError(t, err)
+	require.NoError(t, cacheManager.Store(filepath.Join(imagesDir, "internal", "secret.jpg"), params, secret))
+
+	tests := []struct {
+		url            string
+		expectedStatus int
+	}{
+		{"/img/internal/secret.jpg", http.StatusForbidden},
+		{"/img/internal/secret.jpg/jpeg", http.StatusForbidden},
+		{"/img/internal/secret", http.StatusForbidden},
+		{"/img/internal", http.StatusForbidden},
+		{"/img/cats/cat_white.jpg", http.StatusOK},
+		{"/img/test.jpg", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		// Act
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+		// Assert
+		assert.Equal(t, tt.expectedStatus, w.Code, tt.url)
+		if tt.expectedStatus == http.StatusForbidden {
+			assert.Contains(t, w.Body.String(), "FORBIDDEN", tt.url)
+		}
+	}
+}
+
+// TestImageHandler_GET_DeniedPath_Fallback tests serving the default image for denied prefixes
+func TestImageHandler_GET_DeniedPath_Fallback(t *testing.T) {
+	// Arrange
+	var defaultImagePath string
+	router, _, _ := setupACLRouter(t, func(cfg *config.Config) {
+		cfg.DenyPaths = []string{"internal"}
+		cfg.DeniedBehavior = config.DeniedBehaviorFallback
+		defaultImagePath = cfg.DefaultImagePath
+	})
+	defaultImage, err := os.ReadFile(defaultImagePath)
+	require.NoError(t, err)
+
+	// Act
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/internal/secret.jpg", nil))
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, defaultImage, w.Body.Bytes())
+}
+
+// TestImageHandler_GET_AllowedPaths tests that an allow list restricts serving to its prefixes
+func TestImageHandler_GET_AllowedPaths(t *testing.T) {
+	// Arrange
+	router, _, _ := setupACLRouter(t, func(cfg *config.Config) {
+		cfg.AllowPaths = []string{"cats"}
+	})
+
+	tests := []struct {
+		url            string
+		expectedStatus int
+	}{
+		{"/img/cats/cat_white.jpg", http.StatusOK},
+		{"/img/test.jpg", http.StatusForbidden},
+		{"/img/internal/secret.jpg", http.StatusForbidden},
+		{"/img/missing.jpg", http.StatusOK}, // The system default is always public
+	}
+
+	for _, tt := range tests {
+		// Act
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+		// Assert
+		assert.Equal(t, tt.expectedStatus, w.Code, tt.url)
+	}
+}
+
+// TestImageHandler_GET_MissBehavior tests each configured response for a missing image
+func TestImageHandler_GET_MissBehavior(t *testing.T) {
+	tests := []struct {
+		name           string
+		missBehavior   string
+		expectedStatus int
+	}{
+		{"Default falls back", "", http.StatusOK},
+		{"Fallback", config.MissBehaviorFallback, http.StatusOK},
+		{"Not found", config.MissBehaviorNotFound, http.StatusNotFound},
+		{"Redirect", config.MissBehaviorRedirect, http.StatusFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+			cfg.MissBehavior = tt.missBehavior
+			cfg.PlaceholderURL = "https://cdn.example.com/placeholder.png"
+
+			resolver := resolver.NewResolver(imagesDir)
+			cacheManager, err := cache.NewManager(cacheDir)
+			require.NoError(t, err)
+
+			handler := NewImageHandler(cfg, resolver, cacheManager, &mockProcessor{})
+
+			router := gin.New()
+			router.GET("/img/*path", handler.ServeImage)
+
+			// Act
+			req := httptest.NewRequest("GET", "/img/missing.jpg/300x200", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			switch tt.missBehavior {
+			case config.MissBehaviorNotFound:
+				assert.Contains(t, w.Body.String(), "NOT_FOUND")
+			case config.MissBehaviorRedirect:
+				assert.Equal(t, cfg.PlaceholderURL, w.Header().Get("Location"))
+			}
+
+			// Existing images are unaffected
+			req = httptest.NewRequest("GET", "/img/test.jpg", nil)
+			w = httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+		})
+	}
+}
+
+// TestImageHandler_GET_EmptySource tests that a zero-byte source is served
+// the default image by default, or reported when configured, rather than
+// failing in the processor
+func TestImageHandler_GET_EmptySource(t *testing.T) {
+	tests := []struct {
+		name           string
+		asError        bool
+		missBehavior   string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{"Fallback by default", false, "", http.StatusOK, ""},
+		{"Fallback follows miss behavior", false, config.MissBehaviorNotFound, http.StatusNotFound, "NOT_FOUND"},
+		{"Error", true, "", http.StatusUnprocessableEntity, "UNPROCESSABLE_ENTITY"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+			cfg.MissBehavior = tt.missBehavior
+			require.NoError(t, os.WriteFile(filepath.Join(imagesDir, "broken.jpg"), nil, 0644))
+
+			resolver := resolver.NewResolver(imagesDir)
+			resolver.SetEmptySource(1, tt.asError)
+			cacheManager, err := cache.NewManager(cacheDir)
+			require.NoError(t, err)
+
+			handler := NewImageHandler(cfg, resolver, cacheManager, &mockProcessor{})
+
+			router := gin.New()
+			router.GET("/img/*path", handler.ServeImage)
+
+			// Act
+			req := httptest.NewRequest("GET", "/img/broken.jpg/300x200", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedCode != "" {
+				assert.Contains(t, w.Body.String(), tt.expectedCode)
+				return
+			}
+			defaultData, err := os.ReadFile(cfg.DefaultImagePath)
+			require.NoError(t, err)
+			assert.Equal(t, defaultData, w.Body.Bytes())
+		})
+	}
+}
+
+// countingProcessor is a mock processor that counts Process calls
+type countingProcessor struct {
+	mockProcessor
+	calls int
+}
+
+func (m *countingProcessor) Process(data []byte, opts processor.ProcessOptions) ([]byte, error) {
+	m.calls++
+	return data, nil
+}
+
+// TestImageHandler_GET_CacheHit_MagicNumberMismatch tests that a cache entry with the wrong format is reprocessed
+func TestImageHandler_GET_CacheHit_MagicNumberMismatch(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+
+	resolver := resolver.NewResolver(imagesDir)
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	proc := &countingProcessor{}
+
+	handler := NewImageHandler(cfg, resolver, cacheManager, proc)
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	// Store PNG bytes under a JPEG rendition
+	sourcePath := filepath.Join(imagesDir, "test.jpg")
+	params := cache.ProcessingParams{Width: DefaultWidth, Height: DefaultHeight, Format: "jpeg", Quality: DefaultQuality}
+	pngBytes := []byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A, 0x00, 0x00, 0x00, 0x0D}
+	require.NoError(t, cacheManager.Store(sourcePath, params, pngBytes))
+
+	// Act
+	req := httptest.NewRequest("GET", "/img/test.jpg/jpeg", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Assert - the entry was reprocessed and repaired
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, proc.calls)
+	assert.NotEqual(t, pngBytes, w.Body.Bytes())
+
+	repaired, found, err := cacheManager.Retrieve(sourcePath, params)
+	require.NoError(t, err)
+	require.True(t, found)
+	format, err := security.ValidateFileType(repaired)
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+
+	// The repaired entry is now served from cache
+	req = httptest.NewRequest("GET", "/img/test.jpg/jpeg", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, proc.calls)
+}
+
+// TestImageHandler_GET_AutoQuality tests qauto reports the chosen quality and caches it
+func TestImageHandler_GET_AutoQuality(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+
+	resolver := resolver.NewResolver(imagesDir)
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+
+	handler := NewImageHandler(cfg, resolver, cacheManager, &mockProcessor{})
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	// Act
+	req := httptest.NewRequest("GET", "/img/test.jpg/jpeg/qauto", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	quality, err := strconv.Atoi(w.Header().Get("X-Image-Quality"))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, quality, processor.MinAutoQuality)
+	assert.LessOrEqual(t, quality, processor.MaxAutoQuality)
+
+	// Cached under both the qauto and the chosen quality keys
+	stats, err := cacheManager.GetStats()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.TotalFiles)
+}
+
+// TestImageHandler_GET_ChromaSubsampling tests subsampling from the URL and config default
+func TestImageHandler_GET_ChromaSubsampling(t *testing.T) {
+	tests := []struct {
+		name          string
+		configDefault string
+		url           string
+		expected      processor.ChromaSubsampling
+	}{
+		{"Default", "", "/img/test.jpg/jpeg", ""},
+		{"Config default", "444", "/img/test.jpg/jpeg", processor.Subsampling444},
+		{"URL overrides config", "444", "/img/test.jpg/jpeg/c422", processor.Subsampling422},
+		{"Ignored for WebP", "444", "/img/test.jpg/webp/c444", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+			cfg.JPEGSubsampling = tt.configDefault
+
+			cacheManager, err := cache.NewManager(cacheDir)
+			require.NoError(t, err)
+			proc := &recordingProcessor{}
+			handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+			router := gin.New()
+			router.GET("/img/*path", handler.ServeImage)
+
+			// Act
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+			// Assert
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.expected, proc.opts.ChromaSubsampling)
+		})
+	}
+}
+
+// TestImageHandler_GET_QueryParams_SameCacheEntry tests query and path parameters share a cache entry
+func TestImageHandler_GET_QueryParams_SameCacheEntry(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	proc := &countingProcessor{}
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg/800/jpeg/q80", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// Act
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg?width=800&format=jpeg&quality=80", nil))
+
+	// Assert - the second request was served from the first request's entry
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, proc.calls)
+	stats, err := cacheManager.GetStats()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.TotalFiles)
+}
+
+// TestImageHandler_GET_QueryParams_Precedence tests path segments win over query parameters
+func TestImageHandler_GET_QueryParams_Precedence(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		url      string
+		expected processor.ProcessOptions
+	}{
+		{"Query only", "", "/img/test.jpg?width=400&height=300&format=png&quality=50",
+			processor.ProcessOptions{Width: 400, Height: 300, Format: processor.FormatPNG, Quality: 50}},
+		{"Path wins", "", "/img/test.jpg/800x600/jpeg/q90?width=400&height=300&format=png&quality=50",
+			processor.ProcessOptions{Width: 800, Height: 600, Format: processor.FormatJPEG, Quality: 90}},
+		{"Query fills gaps", "", "/img/test.jpg/800x600?format=png&quality=50",
+			processor.ProcessOptions{Width: 800, Height: 600, Format: processor.FormatPNG, Quality: 50}},
+		{"Strip mode ignores query", config.QueryParamsStrip, "/img/test.jpg/800x600?format=png&quality=50",
+			processor.ProcessOptions{Width: 800, Height: 600, Format: processor.FormatWebP, Quality: DefaultQuality}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+			cfg.QueryParams = tt.mode
+
+			cacheManager, err := cache.NewManager(cacheDir)
+			require.NoError(t, err)
+			proc := &recordingProcessor{}
+			handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+			router := gin.New()
+			router.GET("/img/*path", handler.ServeImage)
+
+			// Act
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+			// Assert
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.expected, proc.opts)
+		})
+	}
+}
+
+// TestImageHandler_GET_ContentHash_Immutable tests content-hash URLs for the current rendition
+func TestImageHandler_GET_ContentHash_Immutable(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	proc := &countingProcessor{}
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg/800x600/jpeg", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	hash := w.Header().Get("X-Content-Hash")
+	require.Len(t, hash, 64)
+	assert.NotContains(t, w.Header().Get("Cache-Control"), "immutable")
+
+	// Act
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg/800x600/jpeg/h-"+hash, nil))
+
+	// Assert - served immutable from the same cache entry
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "public, max-age=31536000, immutable", w.Header().Get("Cache-Control"))
+	assert.Equal(t, hash, w.Header().Get("X-Content-Hash"))
+	assert.Equal(t, 1, proc.calls)
+}
+
+// TestImageHandler_GET_ContentHash_Mismatch tests outdated content-hash URLs
+func TestImageHandler_GET_ContentHash_Mismatch(t *testing.T) {
+	tests := []struct {
+		name           string
+		mode           string
+		expectedStatus int
+	}{
+		{"Default returns not found", "", http.StatusNotFound},
+		{"Not found", config.HashMismatchNotFound, http.StatusNotFound},
+		{"Redirect to current hash", config.HashMismatchRedirect, http.StatusFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+			cfg.HashMismatch = tt.mode
+
+			cacheManager, err := cache.NewManager(cacheDir)
+			require.NoError(t, err)
+			handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, &mockProcessor{})
+
+			router := gin.New()
+			router.GET("/img/*path", handler.ServeImage)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg/800x600/jpeg", nil))
+			require.Equal(t, http.StatusOK, w.Code)
+			oldHash := w.Header().Get("X-Content-Hash")
+
+			// The source changes after the hash was published
+			changed := time.Now().Add(time.Hour)
+			require.NoError(t, os.Chtimes(filepath.Join(imagesDir, "test.jpg"), changed, changed))
+
+			// Act
+			w = httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg/800x600/jpeg/h-"+oldHash+"?v=1", nil))
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+			currentHash := w.Header().Get("X-Content-Hash")
+			assert.Len(t, currentHash, 64)
+			assert.NotEqual(t, oldHash, currentHash)
+			if tt.expectedStatus == http.StatusFound {
+				assert.Equal(t, "/img/test.jpg/800x600/jpeg/h-"+currentHash+"?v=1", w.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+// TestImageHandler_GET_PosterFrame tests poster and frame_N segments reach the processor
+func TestImageHandler_GET_PosterFrame(t *testing.T) {
+	tests := []struct {
+		name          string
+		url           string
+		expectPoster  bool
+		expectedFrame int
+	}{
+		{"No poster", "/img/test.jpg/200x200/png", false, 0},
+		{"Poster is the first frame", "/img/test.jpg/200x200/poster/png", true, 0},
+		{"Specific frame", "/img/test.jpg/200x200/frame_2/png", true, 2},
+		{"Frame as query parameter", "/img/test.jpg/200x200/png?frame=3", true, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+
+			cacheManager, err := cache.NewManager(cacheDir)
+			require.NoError(t, err)
+			proc := &recordingProcessor{}
+			handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+			router := gin.New()
+			router.GET("/img/*path", handler.ServeImage)
+
+			// Act
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+			// Assert
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.expectPoster, proc.opts.Poster)
+			assert.Equal(t, tt.expectedFrame, proc.opts.Frame)
+			params := cache.ProcessingParams{Width: 200, Height: 200, Format: "png", Quality: DefaultQuality, Poster: tt.expectPoster, Frame: tt.expectedFrame}
+			assert.True(t, cacheManager.Exists(filepath.Join(imagesDir, "test.jpg"), params))
+		})
+	}
+}
+
+// TestImageHandler_GET_DPI tests dpiN segments reach the processor and the cache key
+func TestImageHandler_GET_DPI(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		expectedDPI int
+	}{
+		{"No DPI", "/img/test.jpg/200x200/jpeg", 0},
+		{"DPI segment", "/img/test.jpg/200x200/dpi300/jpeg", 300},
+		{"DPI as query parameter", "/img/test.jpg/200x200/jpeg?dpi=150", 150},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+
+			cacheManager, err := cache.NewManager(cacheDir)
+			require.NoError(t, err)
+			proc := &recordingProcessor{}
+			handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+			router := gin.New()
+			router.GET("/img/*path", handler.ServeImage)
+
+			// Act
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+			// Assert
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.expectedDPI, proc.opts.DPI)
+			params := cache.ProcessingParams{Width: 200, Height: 200, Format: "jpeg", Quality: DefaultQuality, DPI: tt.expectedDPI}
+			assert.True(t, cacheManager.Exists(filepath.Join(imagesDir, "test.jpg"), params))
+		})
+	}
+}
+
+// TestImageHandler_GET_Pad tests m_pad and bg_RRGGBB reach the processor and the cache key
+func TestImageHandler_GET_Pad(t *testing.T) {
+	tests := []struct {
+		name               string
+		url                string
+		expectedPad        bool
+		expectedBackground string
+	}{
+		{"No padding", "/img/test.jpg/300x250/png", false, ""},
+		{"Pad", "/img/test.jpg/300x250/m_pad/png", true, ""},
+		{"Pad with background", "/img/test.jpg/300x250/m_pad/bg_ff0000/png", true, "ff0000"},
+		{"Pad without extension", "/img/test/300x250/bg_00ff00/m_pad/png", true, "00ff00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+
+			cacheManager, err := cache.NewManager(cacheDir)
+			require.NoError(t, err)
+			proc := &recordingProcessor{}
+			handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+			router := gin.New()
+			router.GET("/img/*path", handler.ServeImage)
+
+			// Act
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+			// Assert
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.expectedPad, proc.opts.Pad)
+			assert.Equal(t, tt.expectedBackground, proc.opts.Background)
+			params := cache.ProcessingParams{Width: 300, Height: 250, Format: "png", Quality: DefaultQuality, Pad: tt.expectedPad, Background: tt.expectedBackground}
+			assert.True(t, cacheManager.Exists(filepath.Join(imagesDir, "test.jpg"), params))
+		})
+	}
+}
+
+// TestImageHandler_GET_DefaultOutputFormat tests that requests without a
+// format segment are delivered in the configured default output format
+func TestImageHandler_GET_DefaultOutputFormat(t *testing.T) {
+	tests := []struct {
+		name           string
+		defaultFormat  string
+		url            string
+		expectedFormat string
+	}{
+		{"Built-in default", "", "/img/test.jpg/300x250", "webp"},
+		{"Configured default", "png", "/img/test.jpg/300x250", "png"},
+		{"Configured default without parameters", "jpeg", "/img/test.jpg", "jpeg"},
+		{"Explicit format wins", "png", "/img/test.jpg/300x250/webp", "webp"},
+		{"Query format wins", "png", "/img/test.jpg/300x250?format=jpeg", "jpeg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+			cfg.DefaultOutputFormat = tt.defaultFormat
+
+			cacheManager, err := cache.NewManager(cacheDir)
+			require.NoError(t, err)
+			proc := &recordingProcessor{}
+			handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+			router := gin.New()
+			router.GET("/img/*path", handler.ServeImage)
+
+			// Act
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+			// Assert
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, processor.ImageFormat(tt.expectedFormat), proc.opts.Format)
+			assert.Equal(t, "image/"+tt.expectedFormat, w.Header().Get("Content-Type"))
+		})
+	}
+}
+
+// TestImageHandler_GET_ColorSpace tests the color space and ICC settings
+// reach the processor and key the cached rendition
+func TestImageHandler_GET_ColorSpace(t *testing.T) {
+	tests := []struct {
+		name               string
+		colorSpace         string
+		embedICC           bool
+		expectedColorSpace processor.ColorSpace
+		expectedEmbed      bool
+	}{
+		{"Default converts to sRGB", "", false, "", false},
+		{"Converted with profile", config.ColorSpaceSRGB, true, "", true},
+		{"Preserved", config.ColorSpacePreserve, false, processor.ColorSpacePreserve, false},
+		{"Preserved ignores the sRGB profile", config.ColorSpacePreserve, true, processor.ColorSpacePreserve, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+			cfg.ColorSpace = tt.colorSpace
+			cfg.EmbedICC = tt.embedICC
+
+			cacheManager, err := cache.NewManager(cacheDir)
+			require.NoError(t, err)
+			proc := &recordingProcessor{}
+			handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+			router := gin.New()
+			router.GET("/img/*path", handler.ServeImage)
+
+			// Act
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg/300x250/png", nil))
+
+			// Assert
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.expectedColorSpace, proc.opts.ColorSpace)
+			assert.Equal(t, tt.expectedEmbed, proc.opts.EmbedICC)
+			params := cache.ProcessingParams{Width: 300, Height: 250, Format: "png", Quality: DefaultQuality, ColorSpace: string(tt.expectedColorSpace), EmbedICC: tt.expectedEmbed}
+			assert.True(t, cacheManager.Exists(filepath.Join(imagesDir, "test.jpg"), params))
+		})
+	}
+}
+
+// croppingProcessor checks crop rectangles against the source size like the
+// real processor and records the rectangle it would extract
+type croppingProcessor struct {
+	mockProcessor
+	crop processor.CropRect
+}
+
+func (p *croppingProcessor) Process(data []byte, opts processor.ProcessOptions) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, processor.ErrInvalidImage
+	}
+	if p.crop, err = opts.Crop.Fit(cfg.Width, cfg.Height, opts.ClampCrop); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// TestImageHandler_GET_Crop tests crop_x_y_w_h segments with clamped and rejected bounds
+func TestImageHandler_GET_Crop(t *testing.T) {
+	tests := []struct {
+		name         string
+		cropBounds   string
+		url          string
+		crop         [4]int
+		expectedCode int
+		expectedCrop processor.CropRect
+	}{
+		{"Inside", "", "/img/test.jpg/crop_10_20_30_40/png", [4]int{10, 20, 30, 40}, http.StatusOK, processor.CropRect{X: 10, Y: 20, Width: 30, Height: 40}},
+		{"Clamped by default", "", "/img/test.jpg/crop_80_50_40_40/png", [4]int{80, 50, 40, 40}, http.StatusOK, processor.CropRect{X: 80, Y: 50, Width: 20, Height: 40}},
+		{"Clamped", config.CropBoundsClamp, "/img/test/png/crop_80_90_40_40", [4]int{80, 90, 40, 40}, http.StatusOK, processor.CropRect{X: 80, Y: 90, Width: 20, Height: 10}},
+		{"Rejected", config.CropBoundsReject, "/img/test.jpg/crop_80_50_40_40/png", [4]int{80, 50, 40, 40}, http.StatusBadRequest, processor.CropRect{}},
+		{"Outside", config.CropBoundsClamp, "/img/test.jpg/crop_100_0_10_10/png", [4]int{100, 0, 10, 10}, http.StatusBadRequest, processor.CropRect{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+			cfg.CropBounds = tt.cropBounds
+
+			cacheManager, err := cache.NewManager(cacheDir)
+			require.NoError(t, err)
+			proc := &croppingProcessor{}
+			handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+			router := gin.New()
+			router.GET("/img/*path", handler.ServeImage)
+
+			// Act
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+			// Assert
+			assert.Equal(t, tt.expectedCode, w.Code)
+			assert.Equal(t, tt.expectedCrop, proc.crop)
+			if tt.expectedCode == http.StatusOK {
+				params := cache.ProcessingParams{Width: DefaultWidth, Height: DefaultHeight, Format: "png", Quality: DefaultQuality, Crop: tt.crop}
+				assert.True(t, cacheManager.Exists(filepath.Join(imagesDir, "test.jpg"), params))
+				uncropped := params
+				uncropped.Crop = [4]int{}
+				assert.False(t, cacheManager.Exists(filepath.Join(imagesDir, "test.jpg"), uncropped))
+			} else {
+				assert.Contains(t, w.Body.String(), processor.ErrCropOutOfBounds.Error())
+			}
+		})
+	}
+}
+
+// TestImageHandler_GET_Trim tests the trim segment and configured threshold
+func TestImageHandler_GET_Trim(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cfg.TrimThreshold = 25
+
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	proc := &recordingProcessor{}
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	// Act
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg/trim/300x250/png", nil))
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, proc.opts.Trim)
+	assert.Equal(t, 25, proc.opts.TrimThreshold)
+
+	params := cache.ProcessingParams{Width: 300, Height: 250, Format: "png", Quality: DefaultQuality, Trim: true, TrimThreshold: 25}
+	assert.True(t, cacheManager.Exists(filepath.Join(imagesDir, "test.jpg"), params))
+	untrimmed := params
+	untrimmed.Trim, untrimmed.TrimThreshold = false, 0
+	assert.False(t, cacheManager.Exists(filepath.Join(imagesDir, "test.jpg"), untrimmed))
+
+	// Without the segment nothing is trimmed
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/img/test.jpg/300x250/png", nil))
+	assert.False(t, proc.opts.Trim)
+	assert.Zero(t, proc.opts.TrimThreshold)
+}
+
+// TestImageHandler_GET_Progressive tests the progressive segment and
+// configured default, which only apply to JPEG and PNG output
+func TestImageHandler_GET_Progressive(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	proc := &recordingProcessor{}
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+	source := filepath.Join(imagesDir, "test.jpg")
+
+	// Act
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg/300x250/jpeg/progressive", nil))
+
+	// Assert: progressive renditions are cached apart from baseline ones
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, proc.opts.Progressive)
+	params := cache.ProcessingParams{Width: 300, Height: 250, Format: "jpeg", Quality: DefaultQuality, ChromaSubsampling: cfg.JPEGSubsampling, Progressive: true}
+	assert.True(t, cacheManager.Exists(source, params))
+	baseline := params
+	baseline.Progressive = false
+	assert.False(t, cacheManager.Exists(source, baseline))
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/img/test.jpg/300x250/jpeg", nil))
+	assert.False(t, proc.opts.Progressive)
+	assert.True(t, cacheManager.Exists(source, baseline))
+
+	// WebP has no progressive mode
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/img/test.jpg/300x250/webp/progressive", nil))
+	assert.False(t, proc.opts.Progressive)
+
+	// The configured default applies without the segment
+	cfg.Progressive = true
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/img/test.jpg/200x150/png", nil))
+	assert.True(t, proc.opts.Progressive)
+}
+
+// TestImageHandler_GET_ParamsToken tests requests carrying a params token
+func TestImageHandler_GET_ParamsToken(t *testing.T) {
+	token, err := EncodeParamsToken(cache.ProcessingParams{Width: 300, Height: 200, Format: "png", Quality: 80, DPI: 150})
+	require.NoError(t, err)
+	tests := []struct {
+		name     string
+		url      string
+		expected processor.ProcessOptions
+	}{
+		{"Single image", "/img/test.jpg/" + token, processor.ProcessOptions{Width: 300, Height: 200, Format: processor.FormatPNG, Quality: 80, DPI: 150}},
+		{"Grouped image", "/img/cats/cat_white/" + token, processor.ProcessOptions{Width: 300, Height: 200, Format: processor.FormatPNG, Quality: 80, DPI: 150}},
+		{"Invalid token uses defaults", "/img/test.jpg/t-bm90LWEtdG9rZW4", processor.ProcessOptions{Width: DefaultWidth, Height: DefaultHeight, Format: processor.FormatWebP, Quality: DefaultQuality}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+
+			cacheManager, err := cache.NewManager(cacheDir)
+			require.NoError(t, err)
+			proc := &recordingProcessor{}
+			handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+			router := gin.New()
+			router.GET("/img/*path", handler.ServeImage)
+
+			// Act
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+			// Assert
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.expected.Width, proc.opts.Width)
+			assert.Equal(t, tt.expected.Height, proc.opts.Height)
+			assert.Equal(t, tt.expected.Format, proc.opts.Format)
+			assert.Equal(t, tt.expected.Quality, proc.opts.Quality)
+			assert.Equal(t, tt.expected.DPI, proc.opts.DPI)
+		})
+	}
+}
+
+// halveTransform keeps the left half of a JPEG image
+type halveTransform struct{}
+
+func (halveTransform) Name() string { return "halve" }
+
+func (halveTransform) Apply(ctx context.Context, img []byte, opts processor.ProcessOptions) ([]byte, error) {
+	decoded, err := jpeg.Decode(bytes.NewReader(img))
+	if err != nil {
+		return nil, err
+	}
+	bounds := decoded.Bounds()
+	half := image.NewRGBA(image.Rect(0, 0, bounds.Dx()/2, bounds.Dy()))
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx()/2; x++ {
+			half.Set(x, y, decoded.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, half, nil)
+	return buf.Bytes(), err
+}
+
+// brokenTransform always fails
+type brokenTransform struct{}
+
+func (brokenTransform) Name() string { return "watermark" }
+
+func (brokenTransform) Apply(ctx context.Context, img []byte, opts processor.ProcessOptions) ([]byte, error) {
+	return nil, errors.New("watermark not loaded")
+}
+
+// TestImageHandler_GET_Transforms tests that registered transforms shape the served image
+func TestImageHandler_GET_Transforms(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	proc := processor.WithTransforms(&mockProcessor{}, halveTransform{})
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	// Act
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg/200x200/jpeg", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, w.Code)
+	served, err := jpeg.DecodeConfig(bytes.NewReader(w.Body.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, 50, served.Width)
+	assert.Equal(t, 100, served.Height)
+}
+
+// TestImageHandler_GET_TransformError tests that a failing transform is unprocessable
+func TestImageHandler_GET_TransformError(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	proc := processor.WithTransforms(&mockProcessor{}, halveTransform{}, brokenTransform{})
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	// Act
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg/200x200/jpeg", nil))
+
+	// Assert
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "UNPROCESSABLE_ENTITY", response["code"])
+	assert.Equal(t, map[string]interface{}{"transform": "watermark"}, response["details"])
+	assert.Equal(t, 0, cachedFiles(t, cacheDir), "failed renditions are not cached")
+}
+
+// createTestGIF writes a two-frame animated GIF
+func createTestGIF(path string) error {
+	palette := color.Palette{color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}}
+	anim := &gif.GIF{}
+	for i := range palette {
+		frame := image.NewPaletted(image.Rect(0, 0, 20, 20), palette)
+		for p := range frame.Pix {
+			frame.Pix[p] = uint8(i)
+		}
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 10)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return gif.EncodeAll(file, anim)
+}
+
+// TestImageHandler_GET_AnimatedGIF tests the animated GIF modes
+func TestImageHandler_GET_AnimatedGIF(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        string
+		url         string
+		passthrough bool
+		animate     bool
+	}{
+		{"Static by default", "", "/img/anim.gif/100x100", false, false},
+		{"Animated WebP", config.AnimatedGIFWebP, "/img/anim.gif/100x100", false, true},
+		{"Static", config.AnimatedGIFStatic, "/img/anim.gif/100x100", false, false},
+		{"Passthrough", config.AnimatedGIFPassthrough, "/img/anim.gif/100x100", true, false},
+		{"Passthrough without extension", config.AnimatedGIFPassthrough, "/img/anim", true, false},
+		{"Passthrough with explicit format", config.AnimatedGIFPassthrough, "/img/anim.gif/100x100/webp", false, false},
+		{"Passthrough with format query", config.AnimatedGIFPassthrough, "/img/anim.gif?format=png", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+			cfg.AnimatedGIF = tt.mode
+			gifPath := filepath.Join(imagesDir, "anim.gif")
+			require.NoError(t, createTestGIF(gifPath))
+			source, err := os.ReadFile(gifPath)
+			require.NoError(t, err)
+
+			cacheManager, err := cache.NewManager(cacheDir)
+			require.NoError(t, err)
+			proc := &recordingProcessor{}
+			handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+			router := gin.New()
+			router.GET("/img/*path", handler.ServeImage)
+
+			// Act & Assert (twice for passthrough to cover the cached copy)
+			requests := 1
+			if tt.passthrough {
+				requests = 2
+			}
+			for i := 0; i < requests; i++ {
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+				assert.Equal(t, http.StatusOK, w.Code)
+				if tt.passthrough {
+					assert.Equal(t, "image/gif", w.Header().Get("Content-Type"))
+					assert.Equal(t, source, w.Body.Bytes())
+				} else {
+					assert.NotEqual(t, "image/gif", w.Header().Get("Content-Type"))
+				}
+			}
+			if tt.passthrough {
+				assert.Empty(t, proc.opts.Format, "Passthrough should not process the GIF")
+			} else {
+				assert.Equal(t, tt.animate, proc.opts.Animate)
+			}
+		})
+	}
+}
+
+// panickingProcessor panics on one source and echoes any other
+type panickingProcessor struct {
+	mockProcessor
+	source []byte
+}
+
+func (p *panickingProcessor) Process(data []byte, opts processor.ProcessOptions) ([]byte, error) {
+	if bytes.Equal(data, p.source) {
+		panic("vips: segmentation fault in resize")
+	}
+	return data, nil
+}
+
+// TestImageHandler_GET_ProcessingPanic tests that a panicking processor is
+// answered with the default image or a controlled error
+func TestImageHandler_GET_ProcessingPanic(t *testing.T) {
+	tests := []struct {
+		name          string
+		panicFallback bool
+		missBehavior  string
+		fallback      bool
+	}{
+		{"Fallback to default image", true, "", true},
+		{"Fallback disabled", false, "", false},
+		{"No fallback when misses are not found", true, config.MissBehaviorNotFound, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+			cfg.PanicFallback = tt.panicFallback
+			cfg.MissBehavior = tt.missBehavior
+			require.NoError(t, createTestImage(filepath.Join(imagesDir, "other.jpg"), 50, 50))
+			source, err := os.ReadFile(filepath.Join(imagesDir, "test.jpg"))
+			require.NoError(t, err)
+			defaultImage, err := os.ReadFile(cfg.DefaultImagePath)
+			require.NoError(t, err)
+
+			cacheManager, err := cache.NewManager(cacheDir)
+			require.NoError(t, err)
+			handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, &panickingProcessor{source: source})
+
+			router := gin.New()
+			router.GET("/img/*path", handler.ServeImage)
+
+			// Act
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg/200x200/jpeg", nil))
+
+			// Assert
+			if tt.fallback {
+				assert.Equal(t, http.StatusOK, w.Code)
+				assert.Equal(t, defaultImage, w.Body.Bytes())
+				assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+				assert.Empty(t, w.Header().Get("ETag"))
+			} else {
+				assert.Equal(t, http.StatusInternalServerError, w.Code)
+				var response map[string]interface{}
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				assert.Equal(t, "INTERNAL_ERROR", response["code"])
+				assert.Equal(t, map[string]interface{}{"filename": "test.jpg"}, response["details"])
+			}
+
+			// The server keeps serving other images
+			w = httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/img/other.jpg/200x200/jpeg", nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+		})
+	}
+}
+
+// decodingProcessor fails on sources the standard library cannot decode,
+// like the real processor on corrupt files, and echoes any other
+type decodingProcessor struct {
+	mockProcessor
+}
+
+func (p *decodingProcessor) Process(data []byte, opts processor.ProcessOptions) ([]byte, error) {
+	if _, _, err := image.DecodeConfig(bytes.NewReader(data)); err != nil {
+		return nil, processor.ErrInvalidImage
+	}
+	return data, nil
+}
+
+// TestImageHandler_GET_InvalidDefaultImage tests that a corrupt or missing
+// default image is replaced by a generated placeholder
+func TestImageHandler_GET_InvalidDefaultImage(t *testing.T) {
+	tests := []struct {
+		name                string
+		invalidDefaultImage string
+		breakDefault        func(path string) error
+		expectedStatus      int
+	}{
+		{"Corrupt default", "", func(path string) error {
+			return os.WriteFile(path, []byte("\xff\xd8\xff\xe0 truncated"), 0644)
+		}, http.StatusOK},
+		{"Deleted default", config.InvalidDefaultImagePlaceholder, os.Remove, http.StatusOK},
+		{"Corrupt default reported", config.InvalidDefaultImageError, func(path string) error {
+			return os.WriteFile(path, []byte("\xff\xd8\xff\xe0 truncated"), 0644)
+		}, http.StatusUnprocessableEntity},
+		{"Deleted default reported", config.InvalidDefaultImageError, os.Remove, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+			cfg.InvalidDefaultImage = tt.invalidDefaultImage
+			require.NoError(t, tt.breakDefault(cfg.DefaultImagePath))
+
+			cacheManager, err := cache.NewManager(cacheDir)
+			require.NoError(t, err)
+			handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, &decodingProcessor{})
+
+			router := gin.New()
+			router.GET("/img/*path", handler.ServeImage)
+
+			for i := 0; i < 2; i++ {
+				// Act
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest("GET", "/img/missing.jpg/200x200/jpeg", nil))
+
+				// Assert
+				assert.Equal(t, tt.expectedStatus, w.Code)
+				if tt.expectedStatus != http.StatusOK {
+					continue
+				}
+				placeholder, format, err := image.DecodeConfig(bytes.NewReader(w.Body.Bytes()))
+				require.NoError(t, err, "placeholder must be a valid image")
+				assert.Equal(t, "jpeg", format)
+				assert.Equal(t, 1000, placeholder.Width)
+				assert.Equal(t, cacheBypass, w.Header().Get("X-Cache"))
+				assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+				assert.Empty(t, w.Header().Get("ETag"))
+			}
+
+			// Existing images are unaffected
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg/200x200/jpeg", nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, cacheMiss, w.Header().Get("X-Cache"))
+		})
+	}
+}
+
+// webpFailingProcessor fails WebP encoding and echoes other formats
+type webpFailingProcessor struct {
+	mockProcessor
+	formats []processor.ImageFormat
+}
+
+func (p *webpFailingProcessor) Process(data []byte, opts processor.ProcessOptions) ([]byte, error) {
+	p.formats = append(p.formats, opts.Format)
+	if opts.Format == processor.FormatWebP {
+		return nil, processor.ErrInvalidImage
+	}
+	return data, nil
+}
+
+// TestImageHandler_GET_FormatDowngrade tests a failed WebP encode is served and cached as JPEG
+func TestImageHandler_GET_FormatDowngrade(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+
+	resolver := resolver.NewResolver(imagesDir)
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	proc := &webpFailingProcessor{}
+
+	handler := NewImageHandler(cfg, resolver, cacheManager, proc)
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	for i := 0; i < 2; i++ {
+		// Act
+		req := httptest.NewRequest("GET", "/img/test.jpg/200x200/webp", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		// Assert - the second request is a cache hit with the same answer
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image/jpeg", w.Header().Get("Content-Type"))
+		assert.Equal(t, "webp", w.Header().Get("X-Format-Downgraded-From"))
+		assert.Empty(t, w.Header().Get("X-Served-Original"))
+	}
+	assert.Equal(t, []processor.ImageFormat{processor.FormatWebP, processor.FormatJPEG}, proc.formats)
+}
+
+// TestImageHandler_GET_FallbackFormat tests the default image is served in the requested format for missing images
+func TestImageHandler_GET_FallbackFormat(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		accept      string
+		format      processor.ImageFormat
+		contentType string
+	}{
+		{"AVIF client gets WebP", "/img/missing.jpg", "image/avif,image/webp,*/*", processor.FormatWebP, "image/webp"},
+		{"Explicit format", "/img/missing.jpg/png", "image/avif,*/*", processor.FormatPNG, "image/png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+			cacheManager, err := cache.NewManager(cacheDir)
+			require.NoError(t, err)
+			proc := &recordingProcessor{}
+			handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+			router := gin.New()
+			router.GET("/img/*path", handler.ServeImage)
+
+			req := httptest.NewRequest("GET", tt.url, nil)
+			req.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+
+			// Act
+			router.ServeHTTP(w, req)
+
+			// Assert - the default is rendered, not served as the JPEG source
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+			assert.Equal(t, tt.format, proc.opts.Format)
+			assert.Equal(t, DefaultWidth, proc.opts.Width)
+		})
+	}
+}
+
+// Benchmark tests
+func BenchmarkImageHandler_CacheHit(b *testing.B) {
+	gin.SetMode(gin.TestMode)
+	
+	// Setup
+	imagesDir := b.TempDir()
+	cacheDir := b.TempDir()
+	
+	testImagePath := filepath.Join(imagesDir, "test.jpg")
+	if err := createTestImage(testImagePath, 100, 100); err != nil {
+		b.Fatal(err)
+	}
+	
+	defaultImagePath := filepath.Join(imagesDir, "default.jpg")
+	if err := createTestImage(defaultImagePath, 1000, 1000); err != nil {
+		b.Fatal(err)
+	}
+	
+	cfg := &config.Config{
+		ImagesDir:        imagesDir,
+		CacheDir:         cacheDir,
+		DefaultImagePath: defaultImagePath,
+	}
+	
+	resolver := resolver.NewResolver(imagesDir)
+	cacheManager, _ := cache.NewManager(cacheDir)
+	proc := &mockProcessor{}
+	
+	handler := NewImageHandler(cfg, resolver, cacheManager, proc)
+	
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+	
+	// Prime the cache
+	req := httptest.NewRequest("GET", "/img/test.jpg", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	
+	// Reset timer
+	b.ResetTimer()
+	
+	// Benchmark
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest("GET", "/img/test.jpg", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+	}
+}
+
+func BenchmarkParseParameters(b *testing.B) {
+	segments := []string{"800x600", "webp", "q90"}
+	
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = parseParameters(segments)
+	}
+}
+
+// TestImageHandler_GET_XCache tests the X-Cache header on processed,
+// fallback, passthrough and no-cache requests
+func TestImageHandler_GET_XCache(t *testing.T) {
+	tests := []struct {
+		name         string
+		url          string
+		noCache      bool
+		honorNoCache bool
+		gifMode      string
+		expected     [2]string
+		calls        int
+	}{
+		{"Processed", "/img/test.jpg/300x250/jpeg", false, false, "", [2]string{"MISS", "HIT"}, 1},
+		{"Fallback", "/img/missing.jpg/300x250/jpeg", false, false, "", [2]string{"MISS", "HIT"}, 1},
+		{"GIF passthrough", "/img/anim.gif", false, false, config.AnimatedGIFPassthrough, [2]string{"MISS", "HIT"}, 0},
+		{"No-cache ignored", "/img/test.jpg/300x250/jpeg", true, false, "", [2]string{"MISS", "HIT"}, 1},
+		{"No-cache honored", "/img/test.jpg/300x250/jpeg", true, true, "", [2]string{"BYPASS", "BYPASS"}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+			cfg.HonorNoCache = tt.honorNoCache
+			cfg.AnimatedGIF = tt.gifMode
+			require.NoError(t, createTestGIF(filepath.Join(imagesDir, "anim.gif")))
+
+			cacheManager, err := cache.NewManager(cacheDir)
+			require.NoError(t, err)
+			proc := &countingProcessor{}
+			handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+			router := gin.New()
+			router.GET("/img/*path", handler.ServeImage)
+
+			// Act & Assert
+			for i, expected := range tt.expected {
+				req := httptest.NewRequest("GET", tt.url, nil)
+				if tt.noCache {
+					req.Header.Set("Cache-Control", "no-cache")
+				}
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+
+				require.Equal(t, http.StatusOK, w.Code)
+				assert.Equal(t, expected, w.Header().Get("X-Cache"), "request %d", i+1)
+			}
+			assert.Equal(t, tt.calls, proc.calls)
+		})
+	}
+}
+
+// qualityProcessor renders a noisy image of the requested size as JPEG at
+// the requested quality, so lower qualities produce smaller output
+type qualityProcessor struct {
+	mockProcessor
+	opts processor.ProcessOptions
+}
+
+func (p *qualityProcessor) Process(data []byte, opts processor.ProcessOptions) ([]byte, error) {
+	p.opts = opts
+	img := image.NewGray(image.Rect(0, 0, opts.Width, opts.Height))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i * 7919 % 251)
+	}
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: opts.Quality})
+	return buf.Bytes(), err
+}
+
+// TestImageHandler_GET_SaveData tests the Save-Data hint reduces quality and format
+func TestImageHandler_GET_SaveData(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cfg.SaveDataQuality = 40
+
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	proc := &qualityProcessor{}
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+	get := func(saveData string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/img/test.jpg/300x250/png/q90", nil)
+		if saveData != "" {
+			req.Header.Set("Save-Data", saveData)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		return w
+	}
+
+	// Act
+	full := get("")
+	fullOpts := proc.opts
+	reduced := get("on")
+	reducedOpts := proc.opts
+
+	// Assert
+	assert.Equal(t, processor.ProcessOptions{Width: 300, Height: 250, Format: processor.FormatPNG, Quality: 90}, fullOpts)
+	assert.Equal(t, processor.ProcessOptions{Width: 300, Height: 250, Format: processor.FormatWebP, Quality: 40}, reducedOpts)
+	assert.Less(t, reduced.Body.Len(), full.Body.Len())
+	assert.Equal(t, "image/webp", reduced.Header().Get("Content-Type"))
+	assert.Equal(t, "Save-Data", full.Header().Get("Vary"))
+	assert.Equal(t, "Save-Data", reduced.Header().Get("Vary"))
+	assert.NotEqual(t, full.Header().Get("ETag"), reduced.Header().Get("ETag"))
+
+	// Both variants are cached under their own keys
+	assert.Equal(t, full.Body.Bytes(), get("").Body.Bytes())
+	assert.Equal(t, reduced.Body.Bytes(), get("on").Body.Bytes())
+	assert.Equal(t, "HIT", get("on").Header().Get("X-Cache"))
+}
+
+// TestImageHandler_GET_SaveDataDisabled tests the hint is ignored unless configured
+func TestImageHandler_GET_SaveDataDisabled(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	proc := &recordingProcessor{}
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	// Act
+	req := httptest.NewRequest("GET", "/img/test.jpg/300x250/png/q90", nil)
+	req.Header.Set("Save-Data", "on")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, processor.FormatPNG, proc.opts.Format)
+	assert.Equal(t, 90, proc.opts.Quality)
+	assert.Empty(t, w.Header().Get("Vary"))
+}
+
+// TestNoCacheRequested tests the request directives that skip the cache
+func TestNoCacheRequested(t *testing.T) {
+	tests := []struct {
+		headers  map[string]string
+		expected bool
+	}{
+		{map[string]string{}, false},
+		{map[string]string{"Cache-Control": "no-cache"}, true},
+		{map[string]string{"Cache-Control": "max-age=0, No-Cache"}, true},
+		{map[string]string{"Cache-Control": "max-age=0"}, false},
+		{map[string]string{"Pragma": "no-cache"}, true},
+		{map[string]string{"Cache-Control": "max-age=60", "Pragma": "no-cache"}, false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/img/test.jpg", nil)
+		for name, value := range tt.headers {
+			req.Header.Set(name, value)
+		}
+		assert.Equal(t, tt.expected, noCacheRequested(req), "headers %v", tt.headers)
+	}
+}
+
+// makeReadOnly makes dir read-only and returns a function restoring it.
+// Root ignores directory permissions, so then dir is swapped for a file,
+// which fails writes beneath it the same way.
+func makeReadOnly(t *testing.T, dir string) func() {
+	t.Helper()
+	require.NoError(t, os.Chmod(dir, 0555))
+	probe := filepath.Join(dir, ".probe")
+	if err := os.WriteFile(probe, nil, 0644); err != nil {
+		return func() { require.NoError(t, os.Chmod(dir, 0755)) }
+	}
+	require.NoError(t, os.Remove(probe))
+	require.NoError(t, os.Chmod(dir, 0755))
+
+	moved := dir + ".writable"
+	require.NoError(t, os.Rename(dir, moved))
+	require.NoError(t, os.WriteFile(dir, nil, 0444))
+	return func() {
+		require.NoError(t, os.Remove(dir))
+		require.NoError(t, os.Rename(moved, dir))
+	}
+}
+
+// TestImageHandler_GET_ReadOnlyCache tests that requests are still served,
+// uncached, while the cache directory is read-only, that /health reports the
+// degraded cache and that caching resumes once writes succeed
+func TestImageHandler_GET_ReadOnlyCache(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	retry := 50 * time.Millisecond
+	cacheManager, err := cache.NewManagerWithOptions(cacheDir, cache.Options{WriteRetryInterval: retry})
+	require.NoError(t, err)
+	proc := &countingProcessor{}
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+	checker := health.NewChecker()
+	checker.AddNonCriticalCheck("cache_writes", func() bool { return !cacheManager.ReadOnly() })
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+	router.GET("/health", checker.DetailedHealthHandler)
+
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		return w
+	}
+	healthStatus := func() string {
+		w := get("/health")
+		require.Equal(t, http.StatusOK, w.Code)
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response["status"].(string)
+	}
+	assert.Equal(t, "ok", healthStatus())
+
+	// Act: the cache directory becomes read-only mid-run
+	restore := makeReadOnly(t, cacheDir)
+	for i := 0; i < 5; i++ {
+		w := get(fmt.Sprintf("/img/test.jpg/%dx100/jpeg", 100+i))
+
+		// Assert: every request is still served, just not cached
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, cacheMiss, w.Header().Get("X-Cache"))
+		assert.NotEmpty(t, w.Body.Bytes())
+	}
+	assert.True(t, cacheManager.ReadOnly())
+	assert.Equal(t, "degraded", healthStatus())
+
+	// Writes succeed again: the next retry resumes caching
+	restore()
+	time.Sleep(retry)
+	assert.Equal(t, http.StatusOK, get("/img/test.jpg/200x100/jpeg").Code)
+	assert.False(t, cacheManager.ReadOnly())
+	assert.Equal(t, "ok", healthStatus())
+	calls := proc.calls
+	assert.Equal(t, cacheHit, get("/img/test.jpg/200x100/jpeg").Header().Get("X-Cache"))
+	assert.Equal(t, calls, proc.calls)
+}
+
+// TestImageHandler_GET_FallbackCacheTTL tests a default image cached for a missing file expires after the grace window while real renditions stay cached
+func TestImageHandler_GET_FallbackCacheTTL(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cfg.FallbackCacheTTL = 100 * time.Millisecond
+
+	resolver := resolver.NewResolver(imagesDir)
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	proc := &countingProcessor{}
+
+	handler := NewImageHandler(cfg, resolver, cacheManager, proc)
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		return w
+	}
+
+	// Act & Assert - both are cached within the grace window
+	assert.Equal(t, cacheMiss, get("/img/missing.jpg").Header().Get("X-Cache"))
+	assert.Equal(t, cacheMiss, get("/img/test.jpg").Header().Get("X-Cache"))
+	w := get("/img/missing.jpg")
+	assert.Equal(t, cacheHit, w.Header().Get("X-Cache"))
+	assert.Equal(t, "public, max-age=0", w.Header().Get("Cache-Control"))
+	assert.Equal(t, cacheHit, get("/img/test.jpg").Header().Get("X-Cache"))
+	assert.Equal(t, 2, proc.calls)
+
+	// Act & Assert - only the fallback rendition expires
+	time.Sleep(150 * time.Millisecond)
+	assert.Equal(t, cacheMiss, get("/img/missing.jpg").Header().Get("X-Cache"))
+	w = get("/img/test.jpg")
+	assert.Equal(t, cacheHit, w.Header().Get("X-Cache"))
+	assert.Equal(t, "public, max-age=31536000", w.Header().Get("Cache-Control"))
+	assert.Equal(t, 3, proc.calls)
+}
+
+// TestImageHandler_GET_SourceFormatRules tests that requests without a format
+// transcode a PNG source per rule while a JPEG source keeps its format
+func TestImageHandler_GET_SourceFormatRules(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cfg.DefaultOutputFormat = "png"
+	cfg.SourceFormatRules = []string{"png=webp", "jpeg=" + config.SourceFormatPassthrough}
+	writeTestPNG(t, filepath.Join(imagesDir, "logo.png"), 100, 100, color.White)
+
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	proc := &recordingProcessor{}
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	tests := []struct {
+		url         string
+		format      processor.ImageFormat
+		contentType string
+	}{
+		{"/img/logo.png/300x250", processor.FormatWebP, "image/webp"},
+		{"/img/test.jpg/300x250", processor.FormatJPEG, "image/jpeg"},
+		{"/img/logo.png/300x250/png", processor.FormatPNG, "image/png"},
+		{"/img/test.jpg/300x250/webp", processor.FormatWebP, "image/webp"},
+	}
+	for _, tt := range tests {
+		// Act
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+		// Assert
+		require.Equal(t, http.StatusOK, w.Code, tt.url)
+		assert.Equal(t, tt.format, proc.opts.Format, tt.url)
+		assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"), tt.url)
+	}
+
+	// The cache key reflects the resulting format: the pass-through JPEG is
+	// the rendition an explicit JPEG request gets
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg/300x250/jpeg", nil))
+	assert.Equal(t, cacheHit, w.Header().Get("X-Cache"))
+}
+
+// TestImageHandler_GET_DedupeSources tests that identical sources at
+// different paths share the cache entry for the same transform
+func TestImageHandler_GET_DedupeSources(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cfg.DedupeSources = true
+	source, err := os.ReadFile(filepath.Join(imagesDir, "test.jpg"))
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(imagesDir, "copies"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(imagesDir, "copies", "same.jpg"), source, 0644))
+
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	proc := &countingProcessor{}
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	// Act
+	first := httptest.NewRecorder()
+	router.ServeHTTP(first, httptest.NewRequest("GET", "/img/test.jpg/300x250/jpeg", nil))
+	second := httptest.NewRecorder()
+	router.ServeHTTP(second, httptest.NewRequest("GET", "/img/copies/same.jpg/300x250/jpeg", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, first.Code)
+	require.Equal(t, http.StatusOK, second.Code)
+	assert.Equal(t, cacheMiss, first.Header().Get("X-Cache"))
+	assert.Equal(t, cacheHit, second.Header().Get("X-Cache"))
+	assert.Equal(t, 1, proc.calls)
+	assert.Equal(t, first.Body.Bytes(), second.Body.Bytes())
+	stats, err := cacheManager.GetStats()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.TotalFiles)
+
+	// Another transform of either path is a separate entry
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/copies/same.jpg/200x200/jpeg", nil))
+	assert.Equal(t, cacheMiss, w.Header().Get("X-Cache"))
+	assert.Equal(t, 2, proc.calls)
+}
+
+// TestImageHandler_GET_DedupeSources_PrunesOldVersions tests that only the
+// renditions of the newest versions of a rewritten source survive pruning
+func TestImageHandler_GET_DedupeSources_PrunesOldVersions(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cfg.DedupeSources = true
+	sourcePath := filepath.Join(imagesDir, "test.jpg")
+	copyPath := filepath.Join(imagesDir, "copy.jpg")
+
+	cacheManager, err := cache.NewManagerWithOptions(cacheDir, cache.Options{MaxSourceVersions: 2})
+	require.NoError(t, err)
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, &mockProcessor{})
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+	get := func(url string) string {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		require.Equal(t, http.StatusOK, w.Code, url)
+		return w.Header().Get("X-Cache")
+	}
+
+	// Act: the source is rewritten four times, each version requested;
+	// copy.jpg keeps the first version's content
+	modTime := time.Now().Add(-time.Hour)
+	for version := 1; version <= 4; version++ {
+		require.NoError(t, createTestImage(sourcePath, 100+version, 100))
+		require.NoError(t, os.Chtimes(sourcePath, modTime, modTime))
+		modTime = modTime.Add(time.Minute)
+		if version == 1 {
+			data, err := os.ReadFile(sourcePath)
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(copyPath, data, 0644))
+			assert.Equal(t, cacheMiss, get("/img/copy.jpg/300x250/jpeg"))
+			assert.Equal(t, cacheHit, get("/img/test.jpg/300x250/jpeg"))
+			continue
+		}
+		assert.Equal(t, cacheMiss, get("/img/test.jpg/300x250/jpeg"), "version %d", version)
+	}
+	pruned, err := cacheManager.PruneVersions()
+	require.NoError(t, err)
+
+	// Assert: versions 3 and 4 remain, and version 1 for copy.jpg
+	assert.Equal(t, 1, pruned)
+	stats, err := cacheManager.GetStats()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats.TotalFiles)
+	assert.Equal(t, cacheHit, get("/img/test.jpg/300x250/jpeg"))
+	assert.Equal(t, cacheHit, get("/img/copy.jpg/300x250/jpeg"))
+}
+
+// TestImageHandler_GET_DedupeSources_Clear tests that clearing a path
+// removes the renditions cached under its content hash, and those of a
+// fallback cached under the requested path
+func TestImageHandler_GET_DedupeSources_Clear(t *testing.T) {
+	tests := []struct {
+		name  string
+		url   string
+		clear string
+	}{
+		{"Whole path", "/img/test.jpg/300x250/jpeg", "/img/test.jpg/clear"},
+		{"Size", "/img/test.jpg/300x250/jpeg", "/img/test.jpg/300x250/clear"},
+		{"Fallback", "/img/missing.jpg/300x250/jpeg", "/img/missing.jpg/clear"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			router, _, proc := setupTestRouter(t, func(cfg *config.Config) { cfg.DedupeSources = true })
+			get := func(url string) *httptest.ResponseRecorder {
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+				require.Equal(t, http.StatusOK, w.Code, url)
+				return w
+			}
+			get(tt.url)
+			require.Equal(t, cacheHit, get(tt.url).Header().Get("X-Cache"))
+
+			// Act
+			get(tt.clear)
+
+			// Assert
+			assert.Equal(t, cacheMiss, get(tt.url).Header().Get("X-Cache"))
+			assert.Len(t, proc.calls, 2)
+		})
+	}
+}
+
+// writeFramedPNG writes a 100x100 white PNG with a black 20x20 square in
+// its middle, which trims to the square
+func writeFramedPNG(t *testing.T, path string) {
+	img := image.NewNRGBA(image.Rect(0, 0, 100, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 100; x++ {
+			img.Set(x, y, color.White)
+			if x >= 40 && x < 60 && y >= 40 && y < 60 {
+				img.Set(x, y, color.Black)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+}
+
+// writePNGChunk writes a PNG chunk with its length and checksum
+func writePNGChunk(buf *bytes.Buffer, kind string, data []byte) {
+	binary.Write(buf, binary.BigEndian, uint32(len(data)))
+	chunk := append([]byte(kind), data...)
+	buf.Write(chunk)
+	binary.Write(buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+}
+
+// dottedGrayPNG encodes a white width x height grayscale PNG with one black
+// pixel in its middle, row by row so the image is never held in memory
+func dottedGrayPNG(t *testing.T, width, height int) []byte {
+	var pixels bytes.Buffer
+	zw, err := zlib.NewWriterLevel(&pixels, zlib.BestSpeed)
+	require.NoError(t, err)
+	row := make([]byte, 1+width)
+	for y := 0; y < height; y++ {
+		for x := range row[1:] {
+			row[1+x] = 255
+		}
+		if y == height/2 {
+			row[1+width/2] = 0
+		}
+		_, err := zw.Write(row)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	header := make([]byte, 13)
+	binary.BigEndian.PutUint32(header[0:], uint32(width))
+	binary.BigEndian.PutUint32(header[4:], uint32(height))
+	header[8] = 8 // Bit depth; the color type 0 is grayscale
+	writePNGChunk(&buf, "IHDR", header)
+	writePNGChunk(&buf, "IDAT", pixels.Bytes())
+	writePNGChunk(&buf, "IEND", nil)
+	return buf.Bytes()
+}
+
+// TestRenderedRegion_PixelBudget tests that a trimmed source is measured
+// with its border only within the processor's pixel budget, and from its
+// header without being decoded over it
+func TestRenderedRegion_PixelBudget(t *testing.T) {
+	tests := []struct {
+		name     string
+		width    int
+		height   int
+		expected image.Point
+	}{
+		{"Within budget", 1000, 1000, image.Pt(1, 1)},
+		{"Over budget", 8192, 8200, image.Pt(8192, 8200)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			data := dottedGrayPNG(t, tt.width, tt.height)
+
+			// Act
+			width, height, ok := renderedRegion(data, processor.ProcessOptions{Trim: true})
+
+			// Assert
+			assert.True(t, ok)
+			assert.Equal(t, tt.expected, image.Pt(width, height))
+		})
+	}
+}
+
+// TestImageHandler_GET_MaxUpscale tests that requests beyond the configured
+// multiple of a small source, or of the area its crop or trim leaves, are
+// clamped to it, keeping their ratio, and that a sidecar's no_upscale still wins
+func TestImageHandler_GET_MaxUpscale(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxUpscale float64
+		noUpscale  bool
+		url        string
+		width      int
+		height     int
+	}{
+		{"Clamped", 2, false, "/img/test.jpg/4000x4000/png", 200, 200},
+		{"Clamped keeping ratio", 2, false, "/img/test.jpg/4000x1000/png", 200, 50},
+		{"Clamped by height", 2, false, "/img/test.jpg/1000x4000/png", 50, 200},
+		{"Within limit", 2, false, "/img/test.jpg/150x150/png", 150, 150},
+		{"Fractional limit", 1.5, false, "/img/test.jpg/400x400/png", 150, 150},
+		{"Unlimited", 0, false, "/img/test.jpg/4000x4000/png", 4000, 4000},
+		{"No upscale wins", 2, true, "/img/test.jpg/4000x4000/png", 100, 100},
+		{"Clamped to crop", 2, false, "/img/test.jpg/800x800/png/crop_0_0_50_50", 100, 100},
+		{"Clamped to trimmed area", 2, false, "/img/framed.png/800x800/png/trim", 40, 40},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			router, _, proc := setupTestRouter(t, func(cfg *config.Config) {
+				cfg.MaxUpscale = tt.maxUpscale
+				cfg.Sidecars = tt.noUpscale
+				writeFramedPNG(t, filepath.Join(cfg.ImagesDir, "framed.png"))
+				if tt.noUpscale {
+					require.NoError(t, os.WriteFile(filepath.Join(cfg.ImagesDir, "test.jpg.json"), []byte(`{"no_upscale": true}`), 0644))
+				}
+			})
+			proc.render = true
+
+			// Act
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+			// Assert
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			require.Len(t, proc.calls, 1)
+			assert.Equal(t, tt.width, proc.calls[0].Width)
+			assert.Equal(t, tt.height, proc.calls[0].Height)
+		})
 	}
 }
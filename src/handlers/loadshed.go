@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"goimgserver/cache"
+	"log"
+	"sync/atomic"
+)
+
+// loadShedder tracks whether processing load is high enough to encode new
+// renditions at reduced quality. Shedding starts once the configured number
+// of processings is in flight and stops once fewer than the restore
+// threshold are, so the quality does not flap around a single threshold.
+type loadShedder struct {
+	active  atomic.Bool
+	reduced atomic.Int64 // Responses encoded at reduced quality
+}
+
+// shedding reports whether new renditions are encoded at reduced quality
+// with inFlight processings running
+func (h *ImageHandler) shedding(inFlight int64) bool {
+	at := int64(h.config.LoadShedAt)
+	if at <= 0 {
+		return false
+	}
+	restore := int64(h.config.LoadShedRestore)
+	if restore <= 0 {
+		restore = at
+	}
+
+	s := &h.loadShed
+	switch {
+	case inFlight >= at:
+		if s.active.CompareAndSwap(false, true) {
+			log.Printf("Warning: %d image processings in flight, encoding new renditions at quality %d or less", inFlight, h.config.LoadShedQuality)
+		}
+	case inFlight < restore:
+		if s.active.CompareAndSwap(true, false) {
+			log.Printf("Image processing load dropped to %d in flight, encoding at full quality again", inFlight)
+		}
+	}
+	return s.active.Load()
+}
+
+// shedQuality lowers params to the load shedding quality and drops qauto,
+// whose trial encodes cost several times a plain one. ok is false when
+// params are already that cheap, or serve the source as stored.
+func (h *ImageHandler) shedQuality(params cache.ProcessingParams) (reduced cache.ProcessingParams, ok bool) {
+	limit := h.config.LoadShedQuality
+	if params.Original || params.Quality <= limit && !params.AutoQuality {
+		return params, false
+	}
+	params.Quality = min(params.Quality, limit)
+	params.AutoQuality = false
+	return params, true
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"goimgserver/cache"
+	"goimgserver/processor"
+	"goimgserver/resolver"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gatedProcessor blocks processings of one width until released and
+// records the options of all others
+type gatedProcessor struct {
+	mockProcessor
+	width   int
+	release chan struct{}
+
+	mu   sync.Mutex
+	opts []processor.ProcessOptions
+}
+
+func (p *gatedProcessor) Process(data []byte, opts processor.ProcessOptions) ([]byte, error) {
+	if opts.Width == p.width {
+		<-p.release
+		return data, nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.opts = append(p.opts, opts)
+	return data, nil
+}
+
+func (p *gatedProcessor) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.opts)
+}
+
+func (p *gatedProcessor) last() processor.ProcessOptions {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.opts[len(p.opts)-1]
+}
+
+// TestImageHandler_GET_LoadShedding tests that renditions are encoded at
+// reduced quality while processing is saturated and at full quality again
+// once load drops
+func TestImageHandler_GET_LoadShedding(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cfg.LoadShedAt = 1
+	cfg.LoadShedQuality = 40
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+
+	proc := &gatedProcessor{width: 800, release: make(chan struct{})}
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		return w
+	}
+	const url = "/img/test.jpg/300x200/jpeg/q90"
+
+	// Act: a slow processing saturates the server
+	blocked := make(chan struct{})
+	go func() {
+		defer close(blocked)
+		get("/img/test.jpg/800x600/jpeg")
+	}()
+	require.Eventually(t, func() bool { return handler.ProcessingStats().InFlight == 1 }, 5*time.Second, time.Millisecond)
+
+	// Assert: new renditions are reduced and not kept by clients
+	w := get(url)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 40, proc.last().Quality)
+	assert.Equal(t, "load", w.Header().Get("X-Quality-Reduced"))
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+	reducedETag := w.Header().Get("ETag")
+
+	before := proc.count()
+	qauto := get("/img/test.jpg/320x240/jpeg/qauto")
+	require.Equal(t, http.StatusOK, qauto.Code)
+	assert.Equal(t, before+1, proc.count(), "qauto trial encodes should be skipped under load")
+	assert.Equal(t, 40, proc.last().Quality)
+
+	stats := handler.ProcessingStats()
+	assert.True(t, stats.LoadShedding)
+	assert.Equal(t, int64(2), stats.QualityReduced)
+
+	// The reduced rendition is served from cache while load lasts
+	w = get(url)
+	assert.Equal(t, cacheHit, w.Header().Get("X-Cache"))
+	assert.Equal(t, "load", w.Header().Get("X-Quality-Reduced"))
+
+	// Act: load drops
+	close(proc.release)
+	<-blocked
+
+	// Assert: full quality is rendered again, under a different validator
+	w = get(url)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 90, proc.last().Quality)
+	assert.Empty(t, w.Header().Get("X-Quality-Reduced"))
+	assert.NotEqual(t, "no-cache", w.Header().Get("Cache-Control"))
+	assert.NotEqual(t, reducedETag, w.Header().Get("ETag"))
+	assert.False(t, handler.ProcessingStats().LoadShedding)
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"goimgserver/config"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Maintenance is the process-local maintenance mode toggled through
+// /cmd/maintenance. While it is on, image requests get the configured
+// maintenance image or 503 with Retry-After; health and /cmd endpoints are
+// not affected. It starts off and resets with the process.
+type Maintenance struct {
+	config *config.Config
+
+	mu    sync.RWMutex
+	on    bool
+	since time.Time
+}
+
+// maintenanceRequest is the body of POST /cmd/maintenance
+type maintenanceRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// NewMaintenance creates the maintenance mode, initially off
+func NewMaintenance(cfg *config.Config) *Maintenance {
+	return &Maintenance{config: cfg}
+}
+
+// Enabled reports whether maintenance mode is on
+func (m *Maintenance) Enabled() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.on
+}
+
+// Set turns maintenance mode on or off
+func (m *Maintenance) Set(on bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if on && !m.on {
+		m.since = time.Now()
+	}
+	m.on = on
+}
+
+// status returns the maintenance state as reported by /cmd/maintenance
+func (m *Maintenance) status() gin.H {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	status := gin.H{"success": true, "enabled": m.on}
+	if m.on {
+		status["since"] = m.since.UTC().Format(time.RFC3339)
+	}
+	return status
+}
+
+// Middleware answers image requests with the maintenance response while
+// maintenance mode is on
+func (m *Maintenance) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !m.Enabled() {
+			c.Next()
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		if m.config.MaintenanceImage != "" && (c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead) {
+			c.Header("X-Maintenance", "true")
+			c.File(m.config.MaintenanceImage)
+			c.Abort()
+			return
+		}
+		if m.config.MaintenanceRetryAfter > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(m.config.MaintenanceRetryAfter.Seconds())))
+		}
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"error": "service under maintenance",
+			"code":  "MAINTENANCE",
+		})
+	}
+}
+
+// HandleMaintenance handles /cmd/maintenance: GET reports the state and
+// POST with {"enabled": true|false} switches it
+func (m *Maintenance) HandleMaintenance(c *gin.Context) {
+	if c.Request.Method == http.MethodPost {
+		var req maintenanceRequest
+		if err := c.ShouldBindJSON(&req); err != nil || req.Enabled == nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "request body must be JSON with an enabled field",
+				"code":    "INVALID_REQUEST",
+			})
+			return
+		}
+		m.Set(*req.Enabled)
+		log.Printf("Maintenance mode enabled=%v", *req.Enabled)
+	}
+	c.JSON(http.StatusOK, m.status())
+}
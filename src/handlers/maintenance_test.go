@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"goimgserver/config"
+	"goimgserver/server/health"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupMaintenanceRouter serves images behind the maintenance middleware,
+// /cmd/maintenance and /health
+func setupMaintenanceRouter(t *testing.T, configure func(imagesDir string, m *Maintenance)) *gin.Engine {
+	t.Helper()
+	handler, _ := setupTestHandler(t, func(cfg *config.Config) {
+		cfg.MaintenanceRetryAfter = 2 * time.Minute
+	})
+	maintenance := NewMaintenance(handler.config)
+	if configure != nil {
+		configure(handler.config.ImagesDir, maintenance)
+	}
+
+	checker := health.NewChecker()
+	checker.AddCheck("filesystem", func() bool { return true })
+	router := gin.New()
+	router.GET("/img/*path", maintenance.Middleware(), handler.ServeImage)
+	router.GET("/cmd/maintenance", maintenance.HandleMaintenance)
+	router.POST("/cmd/maintenance", maintenance.HandleMaintenance)
+	router.GET("/health", checker.HealthHandler)
+	return router
+}
+
+// TestMaintenance_Toggle tests that maintenance mode answers image requests
+// with 503 and Retry-After while /health keeps working, until switched off
+func TestMaintenance_Toggle(t *testing.T) {
+	// Arrange
+	router := setupMaintenanceRouter(t, nil)
+	request := func(method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+	require.Equal(t, http.StatusOK, request("GET", "/img/test.jpg/300x250/jpeg", "").Code)
+
+	// Act: maintenance on
+	w := request("POST", "/cmd/maintenance", `{"enabled": true}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"enabled":true`)
+
+	// Assert
+	w = request("GET", "/img/test.jpg/300x250/jpeg", "")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "120", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "MAINTENANCE")
+	assert.Equal(t, http.StatusOK, request("GET", "/health", "").Code)
+	assert.Contains(t, request("GET", "/cmd/maintenance", "").Body.String(), `"enabled":true`)
+
+	// Switched off, images are served again
+	require.Equal(t, http.StatusOK, request("POST", "/cmd/maintenance", `{"enabled": false}`).Code)
+	w = request("GET", "/img/test.jpg/300x250/jpeg", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Retry-After"))
+
+	// A body without the enabled field is rejected
+	assert.Equal(t, http.StatusBadRequest, request("POST", "/cmd/maintenance", `{}`).Code)
+}
+
+// TestMaintenance_Image tests that the configured maintenance image is
+// served for every image request while maintenance mode is on
+func TestMaintenance_Image(t *testing.T) {
+	// Arrange
+	var notice string
+	router := setupMaintenanceRouter(t, func(imagesDir string, m *Maintenance) {
+		notice = filepath.Join(t.TempDir(), "maintenance.png")
+		writeTestPNG(t, notice, 40, 20, color.White)
+		m.config.MaintenanceImage = notice
+		m.Set(true)
+	})
+	expected, err := os.ReadFile(notice)
+	require.NoError(t, err)
+
+	for _, url := range []string{"/img/test.jpg/300x250/jpeg", "/img/missing.jpg"} {
+		// Act
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+
+		// Assert
+		assert.Equal(t, http.StatusOK, w.Code, url)
+		assert.Equal(t, "image/png", w.Header().Get("Content-Type"), url)
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"), url)
+		assert.Equal(t, expected, w.Body.Bytes(), url)
+	}
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"goimgserver/processor"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ManifestSegment ends an image path to answer the PWA icon set of the
+// image as a web app manifest fragment, e.g. /img/logo.png/manifest.json
+const ManifestSegment = "manifest.json"
+
+// PWA icon sizes: the manifest icons, each also listed as maskable, the
+// favicons and the Apple touch icon
+var (
+	manifestIconSizes = []int{192, 512}
+	faviconSizes      = []int{16, 32, 48}
+)
+
+const appleTouchIconSize = 180
+
+// hexColorRegex matches the background query parameter
+var hexColorRegex = regexp.MustCompile(`^[0-9a-f]{6}$`)
+
+// manifestIcon is one icon of a manifest fragment
+type manifestIcon struct {
+	Src     string `json:"src"`
+	Sizes   string `json:"sizes"`
+	Type    string `json:"type"`
+	Purpose string `json:"purpose,omitempty"`
+}
+
+// manifestFragment is the PWA icon set of an image
+type manifestFragment struct {
+	Icons          []manifestIcon `json:"icons"`
+	Favicons       []manifestIcon `json:"favicons"`
+	AppleTouchIcon manifestIcon   `json:"apple_touch_icon"`
+}
+
+// manifestRequest returns the image path of a /img/<path>/manifest.json
+// request
+func manifestRequest(segments []string) (string, bool) {
+	if len(segments) < 2 || segments[len(segments)-1] != ManifestSegment {
+		return "", false
+	}
+	basePath := strings.Join(segments[:len(segments)-1], "/")
+	return basePath, basePath != ""
+}
+
+// handleManifest answers the PWA icon set of an image: square PNG
+// renditions padded on the background query color (RRGGBB, default white),
+// rendered and cached through the image pipeline before they are listed.
+// The icons fragment is meant for a web app manifest; the maskable icons
+// are the same renditions, so the image should keep its content within the
+// maskable safe zone.
+func (h *ImageHandler) handleManifest(c *gin.Context, basePath string) {
+	background := c.Query("background")
+	if background != "" && !hexColorRegex.MatchString(background) {
+		manifestError(c, http.StatusBadRequest, "invalid background: must be 6 lowercase hex digits (RRGGBB)", "INVALID_REQUEST")
+		return
+	}
+	result, err := h.resolveImage(basePath)
+	if err == nil {
+		result, err = h.checkAccess(result)
+	}
+	if errors.Is(err, errAccessDenied) {
+		manifestError(c, http.StatusForbidden, fmt.Sprintf("%v: %s", errAccessDenied, basePath), "FORBIDDEN")
+		return
+	}
+	if err != nil || result.IsFallback {
+		manifestError(c, http.StatusNotFound, fmt.Sprintf("%v: %s", errImageMissing, basePath), "NOT_FOUND")
+		return
+	}
+	allowed := h.allowedFormats(basePath)
+	if len(allowed) > 0 && !slices.Contains(allowed, string(processor.FormatPNG)) {
+		manifestError(c, http.StatusBadRequest, fmt.Sprintf("%v: png", errFormatNotAllowed), "FORMAT_NOT_ALLOWED")
+		return
+	}
+
+	prefix := strings.TrimSuffix(c.Request.URL.Path, ManifestSegment)
+	icon := func(size int, purpose string) manifestIcon {
+		segments := []string{fmt.Sprintf("%dx%d", size, size), PadSegment}
+		if background != "" {
+			segments = append(segments, "bg_"+background)
+		}
+		segments = append(segments, string(processor.FormatPNG))
+		return manifestIcon{
+			Src:     prefix + strings.Join(segments, "/"),
+			Sizes:   fmt.Sprintf("%dx%d", size, size),
+			Type:    h.getContentType(string(processor.FormatPNG)),
+			Purpose: purpose,
+		}
+	}
+	fragment := manifestFragment{AppleTouchIcon: icon(appleTouchIconSize, "")}
+	for _, purpose := range []string{"any", "maskable"} {
+		for _, size := range manifestIconSizes {
+			fragment.Icons = append(fragment.Icons, icon(size, purpose))
+		}
+	}
+	for _, size := range faviconSizes {
+		fragment.Favicons = append(fragment.Favicons, icon(size, ""))
+	}
+
+	// Render and cache every icon, once per rendition
+	cacheStatus := cacheHit
+	warmed := make(map[string]bool)
+	for _, icon := range slices.Concat(fragment.Icons, fragment.Favicons, []manifestIcon{fragment.AppleTouchIcon}) {
+		if warmed[icon.Src] {
+			continue
+		}
+		warmed[icon.Src] = true
+		warm, err := h.WarmContext(c.Request.Context(), icon.Src)
+		if err != nil {
+			status, code := warmErrorStatus(err)
+			manifestError(c, status, err.Error(), code)
+			return
+		}
+		if !warm.CachedBefore {
+			cacheStatus = cacheMiss
+		}
+	}
+	c.Header("X-Cache", cacheStatus)
+	c.JSON(http.StatusOK, fragment)
+}
+
+// manifestError writes a manifest endpoint error response
+func manifestError(c *gin.Context, status int, message, code string) {
+	c.JSON(status, gin.H{
+		"success": false,
+		"error":   message,
+		"code":    code,
+	})
+}
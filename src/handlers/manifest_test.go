@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"goimgserver/processor"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestImageHandler_GET_Manifest tests that the icon set lists the standard
+// PWA sizes, that each icon is rendered and cached once, and that its
+// entries reference the cached renditions
+func TestImageHandler_GET_Manifest(t *testing.T) {
+	// Arrange
+	router, _, proc := setupTestRouter(t, nil)
+	proc.render = true
+
+	// Act
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg/manifest.json", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, cacheMiss, w.Header().Get("X-Cache"))
+	var fragment manifestFragment
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &fragment))
+
+	expected := []manifestIcon{
+		{Src: "/img/test.jpg/192x192/m_pad/png", Sizes: "192x192", Type: "image/png", Purpose: "any"},
+		{Src: "/img/test.jpg/512x512/m_pad/png", Sizes: "512x512", Type: "image/png", Purpose: "any"},
+		{Src: "/img/test.jpg/192x192/m_pad/png", Sizes: "192x192", Type: "image/png", Purpose: "maskable"},
+		{Src: "/img/test.jpg/512x512/m_pad/png", Sizes: "512x512", Type: "image/png", Purpose: "maskable"},
+	}
+	assert.Equal(t, expected, fragment.Icons)
+	var favicons []string
+	for _, icon := range fragment.Favicons {
+		favicons = append(favicons, icon.Sizes)
+		assert.Equal(t, "image/png", icon.Type)
+	}
+	assert.Equal(t, []string{"16x16", "32x32", "48x48"}, favicons)
+	assert.Equal(t, manifestIcon{Src: "/img/test.jpg/180x180/m_pad/png", Sizes: "180x180", Type: "image/png"}, fragment.AppleTouchIcon)
+
+	// Every distinct icon was rendered once as a padded square PNG
+	var rendered []int
+	for _, opts := range proc.calls {
+		assert.Equal(t, processor.FormatPNG, opts.Format)
+		assert.True(t, opts.Pad)
+		assert.Equal(t, opts.Width, opts.Height)
+		rendered = append(rendered, opts.Width)
+	}
+	slices.Sort(rendered)
+	assert.Equal(t, []int{16, 32, 48, 180, 192, 512}, rendered)
+
+	// The referenced renditions are served from the cache
+	for _, icon := range slices.Concat(fragment.Icons, fragment.Favicons, []manifestIcon{fragment.AppleTouchIcon}) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", icon.Src, nil))
+		assert.Equal(t, http.StatusOK, w.Code, icon.Src)
+		assert.Equal(t, cacheHit, w.Header().Get("X-Cache"), icon.Src)
+	}
+	assert.Len(t, proc.calls, 6)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg/manifest.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, cacheHit, w.Header().Get("X-Cache"))
+	assert.Len(t, proc.calls, 6)
+}
+
+// TestImageHandler_GET_Manifest_Background tests the padding color of the icons
+func TestImageHandler_GET_Manifest_Background(t *testing.T) {
+	// Arrange
+	router, _, proc := setupTestRouter(t, nil)
+	proc.render = true
+
+	// Act
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/cats/cat_white.jpg/manifest.json?background=1a2b3c", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, w.Code)
+	var fragment manifestFragment
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &fragment))
+	assert.Equal(t, "/img/cats/cat_white.jpg/192x192/m_pad/bg_1a2b3c/png", fragment.Icons[0].Src)
+	for _, opts := range proc.calls {
+		assert.Equal(t, "1a2b3c", opts.Background)
+	}
+}
+
+// TestImageHandler_GET_Manifest_Errors tests requests the icon set is not
+// generated for
+func TestImageHandler_GET_Manifest_Errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+		wantCode   string
+	}{
+		{"Missing image", "/img/missing.jpg/manifest.json", http.StatusNotFound, "NOT_FOUND"},
+		{"Invalid background", "/img/test.jpg/manifest.json?background=red", http.StatusBadRequest, "INVALID_REQUEST"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			router, _, proc := setupTestRouter(t, nil)
+
+			// Act
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+			// Assert
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantCode)
+			assert.Empty(t, proc.calls)
+		})
+	}
+}
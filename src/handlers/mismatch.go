@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"goimgserver/config"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// errFormatMismatch is returned for a source whose content is another
+// format than its extension names when the FormatMismatch policy is strict
+var errFormatMismatch = errors.New("source content does not match its extension")
+
+// extensionFormat returns the format path's extension names, "" for
+// extensions of formats security.ValidateFileType does not recognize
+func extensionFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		return "jpeg"
+	case ".png":
+		return "png"
+	case ".webp":
+		return "webp"
+	case ".gif":
+		return gifFormat
+	}
+	return ""
+}
+
+// checkSourceFormat returns the format of the source at path by its magic
+// number, "" when it is not recognized, e.g. HEIC, and left to the decoder.
+// Renditions are rendered from the content, so a source whose extension
+// names another format is served by its content; the mismatch is logged
+// once per path, or refused with errFormatMismatch under the strict policy.
+func (h *ImageHandler) checkSourceFormat(path string) (string, error) {
+	content := sourceFormat(h.files, path)
+	extension := extensionFormat(path)
+	if content == "" || extension == "" || sameFormat(content, extension) {
+		return content, nil
+	}
+	if h.config.FormatMismatch == config.FormatMismatchStrict {
+		return content, fmt.Errorf("%w: %s is %s", errFormatMismatch, path, content)
+	}
+	if _, logged := h.mismatches.LoadOrStore(path, true); !logged {
+		log.Printf("Warning: %s is %s content, not %s; serving it as %s", path, content, extension, content)
+	}
+	return content, nil
+}
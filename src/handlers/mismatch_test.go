@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"goimgserver/config"
+	"goimgserver/security"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestImageHandler_GET_FormatMismatch tests that mislabeled sources are
+// served by their content, never with the Content-Type of their extension,
+// or refused under the strict policy
+func TestImageHandler_GET_FormatMismatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      string
+		url         string
+		status      int
+		contentType string
+		processed   bool
+	}{
+		{"JPEG named .gif is transcoded", config.FormatMismatchContent, "/img/photo.gif/50x50", http.StatusOK, "image/png", true},
+		{"GIF named .png is passed through", config.FormatMismatchContent, "/img/anim.png/50x50", http.StatusOK, "image/gif", false},
+		{"Default policy", "", "/img/photo.gif/50x50", http.StatusOK, "image/png", true},
+		{"Strict JPEG named .gif", config.FormatMismatchStrict, "/img/photo.gif/50x50", http.StatusUnprocessableEntity, "", false},
+		{"Strict GIF named .png", config.FormatMismatchStrict, "/img/anim.png", http.StatusUnprocessableEntity, "", false},
+		{"Strict matching source", config.FormatMismatchStrict, "/img/test.jpg/50x50", http.StatusOK, "image/png", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			router, _, proc := setupTestRouter(t, func(cfg *config.Config) {
+				cfg.AnimatedGIF = config.AnimatedGIFPassthrough
+				cfg.DefaultOutputFormat = "png"
+				cfg.FormatMismatch = tt.policy
+				jpeg, err := os.ReadFile(filepath.Join(cfg.ImagesDir, "test.jpg"))
+				require.NoError(t, err)
+				require.NoError(t, os.WriteFile(filepath.Join(cfg.ImagesDir, "photo.gif"), jpeg, 0644))
+				require.NoError(t, createTestGIF(filepath.Join(cfg.ImagesDir, "anim.png")))
+			})
+			proc.render = true
+
+			// Act
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+			// Assert
+			require.Equal(t, tt.status, w.Code, w.Body.String())
+			assert.Equal(t, tt.processed, len(proc.calls) > 0)
+			if tt.status != http.StatusOK {
+				assert.Contains(t, w.Body.String(), "does not match its extension")
+				return
+			}
+			assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+			sniffed, err := security.ValidateFileType(w.Body.Bytes())
+			require.NoError(t, err)
+			assert.Equal(t, tt.contentType, "image/"+sniffed, "body does not match its Content-Type")
+		})
+	}
+}
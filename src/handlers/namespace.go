@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"errors"
+	"goimgserver/cache"
+	"goimgserver/config"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// errInvalidNamespace is returned for a request naming a cache namespace
+// that is not a valid namespace name
+var errInvalidNamespace = errors.New("invalid cache namespace")
+
+// cacheNamespace returns the cache namespace of a request for basePath: the
+// configured header, or the first path segment when it is a directory of the
+// images directory. It is empty when namespaces are off or none applies, so
+// the request uses the shared cache.
+func (h *ImageHandler) cacheNamespace(r *http.Request, basePath string) (string, error) {
+	var namespace string
+	switch h.config.CacheNamespace {
+	case config.CacheNamespaceHeader:
+		namespace = strings.TrimSpace(r.Header.Get(h.config.CacheNamespaceHeader))
+	case config.CacheNamespacePath:
+		first, _, _ := strings.Cut(filepath.ToSlash(basePath), "/")
+		if group, ok := h.groupDir(first); ok {
+			namespace = group
+		}
+	}
+	if namespace != "" && !cache.ValidNamespace(namespace) {
+		return "", errInvalidNamespace
+	}
+	return namespace, nil
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"goimgserver/cache"
+	"goimgserver/config"
+	"goimgserver/resolver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cachedSources returns the Source of every rendition in the cache
+func cachedSources(t *testing.T, cacheManager cache.CacheManager) []string {
+	var sources []string
+	require.NoError(t, cacheManager.Iterate(func(entry cache.CacheEntry) bool {
+		sources = append(sources, entry.Source)
+		return true
+	}))
+	return sources
+}
+
+// TestImageHandler_CacheNamespace_Header tests that tenants named by the
+// namespace header are cached apart
+func TestImageHandler_CacheNamespace_Header(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cfg.CacheNamespace = config.CacheNamespaceHeader
+	cfg.CacheNamespaceHeader = "X-Tenant"
+
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, &mockProcessor{})
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	for _, tenant := range []string{"acme", "globex", ""} {
+		req := httptest.NewRequest("GET", "/img/test.jpg/50x50/jpeg", nil)
+		if tenant != "" {
+			req.Header.Set("X-Tenant", tenant)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code, tenant)
+		assert.Contains(t, w.Header().Values("Vary"), "X-Tenant")
+	}
+
+	sources := cachedSources(t, cacheManager)
+	assert.Len(t, sources, 3)
+	namespaces := map[string]bool{}
+	for _, source := range sources {
+		namespaces[cache.NamespaceOf(source)] = true
+	}
+	assert.Equal(t, map[string]bool{"acme": true, "globex": true, "": true}, namespaces)
+
+	// Names that are not valid namespaces are rejected
+	req := httptest.NewRequest("GET", "/img/test.jpg/50x50/jpeg", nil)
+	req.Header.Set("X-Tenant", "../other")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// TestImageHandler_CacheNamespace_Path tests that the first path segment
+// namespaces images in a directory while root images stay shared
+func TestImageHandler_CacheNamespace_Path(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cfg.CacheNamespace = config.CacheNamespacePath
+
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, &mockProcessor{})
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	for _, path := range []string{"/img/cats/cat_white.jpg/50x50/jpeg", "/img/test.jpg/50x50/jpeg"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		require.Equal(t, http.StatusOK, w.Code, path)
+	}
+
+	namespaces := map[string]bool{}
+	for _, source := range cachedSources(t, cacheManager) {
+		namespaces[cache.NamespaceOf(source)] = true
+	}
+	assert.Equal(t, map[string]bool{"cats": true, "": true}, namespaces)
+}
+
+// TestWarm_CacheNamespace_Path tests that warming caches a directory's
+// image in the namespace its requests are served from
+func TestWarm_CacheNamespace_Path(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cfg.CacheNamespace = config.CacheNamespacePath
+
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, &mockProcessor{})
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	// Act
+	result, err := handler.Warm("/img/cats/cat_white.jpg/50x50/jpeg")
+
+	// Assert
+	require.NoError(t, err)
+	assert.False(t, result.CachedBefore)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/cats/cat_white.jpg/50x50/jpeg", nil))
+	assert.Equal(t, cacheHit, w.Header().Get("X-Cache"))
+	for _, source := range cachedSources(t, cacheManager) {
+		assert.Equal(t, "cats", cache.NamespaceOf(source))
+	}
+}
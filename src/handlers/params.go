@@ -1,9 +1,14 @@
 package handlers
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"goimgserver/cache"
+	"net/url"
 	"regexp"
 	"strconv"
+	"strings"
 )
 
 // Parameter parsing constants
@@ -16,14 +21,51 @@ const (
 	MaxDimension   = 4000
 	MinQuality     = 1
 	MaxQuality     = 100
+	MinDPI         = 1
+	MaxDPI         = 65535
+
+	// AutoQualitySegment selects perceptual quality instead of a fixed value
+	AutoQualitySegment = "qauto"
+
+	// PosterSegment selects the first frame of an animated image
+	PosterSegment = "poster"
+
+	// PadSegment fits the image inside WxH and pads it to exactly WxH
+	PadSegment = "m_pad"
+
+	// TrimSegment removes a uniform border before resizing
+	TrimSegment = "trim"
+
+	// ProgressiveSegment selects progressive JPEG or interlaced PNG output
+	ProgressiveSegment = "progressive"
+
+	// FilterPrefix starts a filter_<name> segment selecting a color filter
+	FilterPrefix = "filter_"
+
+	// MaxCropCoordinate bounds each value of a crop_x_y_w_h segment
+	MaxCropCoordinate = 100000
+
+	// TokenPrefix starts a t-<token> segment carrying base64url-encoded parameters
+	TokenPrefix = "t-"
+
+	// MaxTokenLength bounds a token segment, prefix included
+	MaxTokenLength = 256
 )
 
+// Valid JPEG chroma subsampling segments
+var chromaSegments = map[string]string{
+	"c444": "444",
+	"c422": "422",
+	"c420": "420",
+}
+
 // Valid image formats
 var validFormats = map[string]bool{
 	"webp": true,
 	"png":  true,
 	"jpeg": true,
 	"jpg":  true,
+	"pdf":  true,
 }
 
 // Regular expressions for parameter parsing
@@ -31,10 +73,44 @@ var (
 	dimensionsRegex = regexp.MustCompile(`^(\d+)x(\d+)$`)
 	widthOnlyRegex  = regexp.MustCompile(`^(\d+)$`)
 	qualityRegex    = regexp.MustCompile(`^q(\d+)$`)
+	frameRegex      = regexp.MustCompile(`^frame_(\d+)$`)
+	dpiRegex        = regexp.MustCompile(`^dpi(\d+)$`)
+	backgroundRegex = regexp.MustCompile(`^bg_([0-9a-f]{6})$`)
+	cropRegex       = regexp.MustCompile(`^crop_(\d+)_(\d+)_(\d+)_(\d+)$`)
+	filterRegex     = regexp.MustCompile(`^filter_(grayscale|sepia|monochrome)$`)
+
+	// contentHashRegex matches the h-<hash> segment of content-hash URLs
+	contentHashRegex = regexp.MustCompile(`^h-([0-9a-f]{64})$`)
+
+	// tokenRegex matches a t-<token> parameter segment
+	tokenRegex = regexp.MustCompile(`^t-([A-Za-z0-9_-]+)$`)
+
+	// tokenContentRegex matches the decoded parameter segments of a token
+	tokenContentRegex = regexp.MustCompile(`^[a-z0-9_]+(/[a-z0-9_]+)*$`)
 )
 
-// parseParameters parses URL segments into ProcessingParams with graceful handling
-// Invalid parameters are ignored, first valid parameter of each type wins
+// parseParameters parses URL segments into ProcessingParams with graceful handling.
+// It is the one definition of the parameter grammar: path segments, query
+// parameters (via querySegments) and t-<token> segments (via expandTokens)
+// are all reduced to segments and parsed here.
+//
+//	WxH | W              dimensions, 1..MaxDimension (W alone keeps the aspect ratio)
+//	qN | qauto           quality, 1..100, or chosen per image
+//	webp|png|jpeg|jpg|pdf output format
+//	c444 | c422 | c420   JPEG chroma subsampling
+//	poster | frame_N     static frame of an animated source
+//	dpiN                 output resolution, MinDPI..MaxDPI
+//	m_pad                pad to exactly WxH
+//	bg_RRGGBB            padding color
+//	crop_X_Y_W_H         source region cropped before resizing
+//	trim                 trim uniform borders
+//	progressive          progressive/interlaced encoding
+//	filter_NAME          grayscale, sepia or monochrome color filter
+//	t-<token>            base64url-encoded segments, expanded in place
+//
+// Segments may appear in any order. Invalid segments are ignored, and the
+// first valid segment of each type wins, so query parameters appended after
+// the path only fill in what the path did not set.
 func parseParameters(segments []string) cache.ProcessingParams {
 	params := cache.ProcessingParams{
 		Width:   DefaultWidth,
@@ -47,8 +123,17 @@ func parseParameters(segments []string) cache.ProcessingParams {
 	hasDimensions := false
 	hasFormat := false
 	hasQuality := false
+	hasChroma := false
+	hasFrame := false
+	hasDPI := false
+	hasMode := false
+	hasBackground := false
+	hasCrop := false
+	hasTrim := false
+	hasProgressive := false
+	hasFilter := false
 
-	for _, segment := range segments {
+	for _, segment := range expandTokens(segments) {
 		// Skip empty segments
 		if segment == "" {
 			continue
@@ -82,6 +167,11 @@ func parseParameters(segments []string) cache.ProcessingParams {
 		}
 
 		// Try to parse quality
+		if !hasQuality && segment == AutoQualitySegment {
+			params.AutoQuality = true
+			hasQuality = true
+			continue
+		}
 		if !hasQuality {
 			if matches := qualityRegex.FindStringSubmatch(segment); matches != nil {
 				quality, _ := strconv.Atoi(matches[1])
@@ -93,6 +183,93 @@ func parseParameters(segments []string) cache.ProcessingParams {
 			}
 		}
 
+		// Try to parse chroma subsampling
+		if !hasChroma {
+			if subsampling, ok := chromaSegments[segment]; ok {
+				params.ChromaSubsampling = subsampling
+				hasChroma = true
+				continue
+			}
+		}
+
+		// Try to parse poster frame
+		if !hasFrame && segment == PosterSegment {
+			params.Poster = true
+			hasFrame = true
+			continue
+		}
+		if !hasFrame {
+			if matches := frameRegex.FindStringSubmatch(segment); matches != nil {
+				if frame, err := strconv.Atoi(matches[1]); err == nil {
+					params.Poster = true
+					params.Frame = frame
+					hasFrame = true
+					continue
+				}
+			}
+		}
+
+		// Try to parse output resolution
+		if !hasDPI {
+			if matches := dpiRegex.FindStringSubmatch(segment); matches != nil {
+				if dpi, err := strconv.Atoi(matches[1]); err == nil && dpi >= MinDPI && dpi <= MaxDPI {
+					params.DPI = dpi
+					hasDPI = true
+					continue
+				}
+			}
+		}
+
+		// Try to parse fit mode
+		if !hasMode && segment == PadSegment {
+			params.Pad = true
+			hasMode = true
+			continue
+		}
+
+		// Try to parse padding color
+		if !hasBackground {
+			if matches := backgroundRegex.FindStringSubmatch(segment); matches != nil {
+				params.Background = matches[1]
+				hasBackground = true
+				continue
+			}
+		}
+
+		// Try to parse source crop rectangle
+		if !hasCrop {
+			if matches := cropRegex.FindStringSubmatch(segment); matches != nil {
+				if crop, ok := parseCrop(matches[1:]); ok {
+					params.Crop = crop
+					hasCrop = true
+					continue
+				}
+			}
+		}
+
+		// Try to parse border trimming
+		if !hasTrim && segment == TrimSegment {
+			params.Trim = true
+			hasTrim = true
+			continue
+		}
+
+		// Try to parse progressive encoding
+		if !hasProgressive && segment == ProgressiveSegment {
+			params.Progressive = true
+			hasProgressive = true
+			continue
+		}
+
+		// Try to parse color filter
+		if !hasFilter {
+			if matches := filterRegex.FindStringSubmatch(segment); matches != nil {
+				params.Filter = matches[1]
+				hasFilter = true
+				continue
+			}
+		}
+
 		// Try to parse format
 		if !hasFormat {
 			if validFormats[segment] {
@@ -108,6 +285,214 @@ func parseParameters(segments []string) cache.ProcessingParams {
 	return params
 }
 
+// parseCrop converts the x, y, width and height of a crop segment. The
+// rectangle must not be empty.
+func parseCrop(values []string) ([4]int, bool) {
+	var crop [4]int
+	for i, value := range values {
+		n, err := strconv.Atoi(value)
+		if err != nil || n > MaxCropCoordinate {
+			return [4]int{}, false
+		}
+		crop[i] = n
+	}
+	return crop, crop[2] > 0 && crop[3] > 0
+}
+
+// formatRequested reports whether segments set the output format explicitly
+func formatRequested(segments []string) bool {
+	for _, segment := range expandTokens(segments) {
+		if validFormats[segment] {
+			return true
+		}
+	}
+	return false
+}
+
+// dimensionsRequested reports whether the segments, tokens included, carry
+// valid dimensions
+func dimensionsRequested(segments []string) bool {
+	for _, segment := range expandTokens(segments) {
+		if matches := dimensionsRegex.FindStringSubmatch(segment); matches != nil {
+			width, _ := strconv.Atoi(matches[1])
+			height, _ := strconv.Atoi(matches[2])
+			if isValidDimension(width) && isValidDimension(height) {
+				return true
+			}
+		}
+		if matches := widthOnlyRegex.FindStringSubmatch(segment); matches != nil {
+			if width, _ := strconv.Atoi(matches[1]); isValidDimension(width) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// qualityRequested reports whether the segments, tokens included, carry a
+// valid quality or qauto
+func qualityRequested(segments []string) bool {
+	for _, segment := range expandTokens(segments) {
+		if segment == AutoQualitySegment {
+			return true
+		}
+		if matches := qualityRegex.FindStringSubmatch(segment); matches != nil {
+			if quality, _ := strconv.Atoi(matches[1]); isValidQuality(quality) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// querySegments converts ?width=, ?height=, ?quality=, ?format=, ?frame= and ?dpi=
+// into the equivalent path segments. Appended after the path segments, they only fill
+// in parameters the path did not set, so path segments win on conflict.
+// Height is only honoured together with width.
+func querySegments(query url.Values) []string {
+	var segments []string
+
+	if width := query.Get("width"); width != "" {
+		if height := query.Get("height"); height != "" {
+			segments = append(segments, width+"x"+height)
+		} else {
+			segments = append(segments, width)
+		}
+	}
+
+	if quality := strings.ToLower(query.Get("quality")); quality != "" {
+		if quality == "auto" || quality == AutoQualitySegment {
+			segments = append(segments, AutoQualitySegment)
+		} else {
+			segments = append(segments, "q"+strings.TrimPrefix(quality, "q"))
+		}
+	}
+
+	if format := strings.ToLower(query.Get("format")); format != "" {
+		segments = append(segments, format)
+	}
+
+	if frame := query.Get("frame"); frame != "" {
+		segments = append(segments, "frame_"+frame)
+	}
+
+	if dpi := query.Get("dpi"); dpi != "" {
+		segments = append(segments, "dpi"+dpi)
+	}
+
+	if filter := strings.ToLower(query.Get("filter")); filter != "" {
+		segments = append(segments, FilterPrefix+filter)
+	}
+
+	return segments
+}
+
+// splitContentHash removes the first h-<hash> segment and returns the
+// remaining segments with the hash, or "" when no hash segment is present
+func splitContentHash(segments []string) ([]string, string) {
+	for i, segment := range segments {
+		if matches := contentHashRegex.FindStringSubmatch(segment); matches != nil {
+			rest := append(append([]string{}, segments[:i]...), segments[i+1:]...)
+			return rest, matches[1]
+		}
+	}
+	return segments, ""
+}
+
+// ErrUnencodableParams is returned for parameters no URL segments parse to,
+// e.g. a height without a width
+var ErrUnencodableParams = errors.New("parameters have no URL form: a valid width is required")
+
+// EncodeParamsToken returns a t-<token> segment that parses to params. The
+// token is the base64url encoding of the equivalent parameter segments.
+// Sizes the URL grammar cannot express return ErrUnencodableParams.
+func EncodeParamsToken(params cache.ProcessingParams) (string, error) {
+	if !isValidDimension(params.Width) || (params.Height != 0 && !isValidDimension(params.Height)) {
+		return "", ErrUnencodableParams
+	}
+	segments := []string{strconv.Itoa(params.Width)}
+	if params.Height > 0 {
+		segments[0] += "x" + strconv.Itoa(params.Height)
+	}
+	if params.AutoQuality {
+		segments = append(segments, AutoQualitySegment)
+	} else if params.Quality > 0 {
+		segments = append(segments, "q"+strconv.Itoa(params.Quality))
+	}
+	if params.Format != "" {
+		segments = append(segments, params.Format)
+	}
+	if params.ChromaSubsampling != "" {
+		segments = append(segments, "c"+params.ChromaSubsampling)
+	}
+	if params.Poster {
+		segments = append(segments, "frame_"+strconv.Itoa(params.Frame))
+	}
+	if params.DPI > 0 {
+		segments = append(segments, "dpi"+strconv.Itoa(params.DPI))
+	}
+	if params.Pad {
+		segments = append(segments, PadSegment)
+	}
+	if params.Background != "" {
+		segments = append(segments, "bg_"+params.Background)
+	}
+	if params.Crop != [4]int{} {
+		segments = append(segments, fmt.Sprintf("crop_%d_%d_%d_%d", params.Crop[0], params.Crop[1], params.Crop[2], params.Crop[3]))
+	}
+	if params.Trim {
+		segments = append(segments, TrimSegment)
+	}
+	if params.Progressive {
+		segments = append(segments, ProgressiveSegment)
+	}
+	if params.Filter != "" {
+		segments = append(segments, FilterPrefix+params.Filter)
+	}
+	return TokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(strings.Join(segments, "/"))), nil
+}
+
+// expandTokens replaces each t-<token> segment with the segments it
+// encodes. Tokens that do not decode are dropped, leaving their parameters
+// at their defaults.
+func expandTokens(segments []string) []string {
+	var expanded []string
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, TokenPrefix) {
+			if expanded != nil {
+				expanded = append(expanded, segment)
+			}
+			continue
+		}
+		if expanded == nil {
+			expanded = append([]string{}, segments[:i]...)
+		}
+		expanded = append(expanded, decodeToken(segment)...)
+	}
+	if expanded == nil {
+		return segments
+	}
+	return expanded
+}
+
+// decodeToken returns the parameter segments in a t-<token> segment, or nil
+// if it is not a valid token. Only plain parameter syntax may be encoded, so
+// names like "t-shirt" are not mistaken for tokens.
+func decodeToken(segment string) []string {
+	if len(segment) > MaxTokenLength {
+		return nil
+	}
+	matches := tokenRegex.FindStringSubmatch(segment)
+	if matches == nil {
+		return nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(matches[1])
+	if err != nil || !tokenContentRegex.Match(decoded) {
+		return nil
+	}
+	return strings.Split(string(decoded), "/")
+}
+
 // hasClearCommand checks if clear command is present in segments
 func hasClearCommand(segments []string) bool {
 	for _, segment := range segments {
@@ -1,9 +1,19 @@
 package handlers
 
 import (
+	"encoding/base64"
+	"goimgserver/cache"
+	"goimgserver/processor"
+	"goimgserver/resolver"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestParseImageRequest_GracefulParsing_ValidParams tests parsing of valid parameters
@@ -463,3 +473,420 @@ func TestParseClearCommand(t *testing.T) {
 		})
 	}
 }
+
+// TestParseParameters_AutoQuality tests parsing of the qauto segment
+func TestParseParameters_AutoQuality(t *testing.T) {
+	tests := []struct {
+		name         string
+		segments     []string
+		expectAuto   bool
+		expectedQual int
+	}{
+		{"Auto quality", []string{"800x600", "qauto"}, true, 75},
+		{"Fixed quality first wins", []string{"q90", "qauto"}, false, 90},
+		{"Auto quality first wins", []string{"qauto", "q90"}, true, 75},
+		{"No quality", []string{"webp"}, false, 75},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			params := parseParameters(tt.segments)
+
+			// Assert
+			assert.Equal(t, tt.expectAuto, params.AutoQuality)
+			assert.Equal(t, tt.expectedQual, params.Quality)
+		})
+	}
+}
+
+// TestParseParameters_ChromaSubsampling tests parsing of chroma subsampling segments
+func TestParseParameters_ChromaSubsampling(t *testing.T) {
+	tests := []struct {
+		name     string
+		segments []string
+		expected string
+	}{
+		{"4:4:4", []string{"jpeg", "c444"}, "444"},
+		{"4:2:2", []string{"c422", "jpeg"}, "422"},
+		{"4:2:0", []string{"c420"}, "420"},
+		{"First wins", []string{"c444", "c420"}, "444"},
+		{"Invalid ignored", []string{"c411"}, ""},
+		{"Not set", []string{"800x600"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			params := parseParameters(tt.segments)
+
+			// Assert
+			assert.Equal(t, tt.expected, params.ChromaSubsampling)
+		})
+	}
+}
+
+// TestParseParameters_PosterFrame tests poster and frame_N segments
+func TestParseParameters_PosterFrame(t *testing.T) {
+	tests := []struct {
+		name          string
+		segments      []string
+		expectPoster  bool
+		expectedFrame int
+	}{
+		{"Poster", []string{"800x600", "poster"}, true, 0},
+		{"Frame", []string{"frame_4", "png"}, true, 4},
+		{"First wins", []string{"frame_2", "poster", "frame_5"}, true, 2},
+		{"Invalid ignored", []string{"frame_x", "frame_"}, false, 0},
+		{"Not set", []string{"800x600"}, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			params := parseParameters(tt.segments)
+
+			// Assert
+			assert.Equal(t, tt.expectPoster, params.Poster)
+			assert.Equal(t, tt.expectedFrame, params.Frame)
+		})
+	}
+}
+
+// TestParseParameters_DPI tests dpiN segments
+func TestParseParameters_DPI(t *testing.T) {
+	tests := []struct {
+		name        string
+		segments    []string
+		expectedDPI int
+	}{
+		{"DPI", []string{"800x600", "dpi300", "jpeg"}, 300},
+		{"First wins", []string{"dpi72", "dpi300"}, 72},
+		{"Out of range ignored", []string{"dpi0", "dpi70000"}, 0},
+		{"Not set", []string{"800x600"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			params := parseParameters(tt.segments)
+
+			// Assert
+			assert.Equal(t, tt.expectedDPI, params.DPI)
+		})
+	}
+}
+
+// TestParseParameters_Pad tests the m_pad and bg_RRGGBB segments
+func TestParseParameters_Pad(t *testing.T) {
+	tests := []struct {
+		name               string
+		segments           []string
+		expectedPad        bool
+		expectedBackground string
+	}{
+		{"Pad", []string{"300x250", "m_pad"}, true, ""},
+		{"Pad with background", []string{"300x250", "bg_ff0000", "m_pad", "png"}, true, "ff0000"},
+		{"First background wins", []string{"m_pad", "bg_000000", "bg_ffffff"}, true, "000000"},
+		{"Invalid background ignored", []string{"m_pad", "bg_red", "bg_FF0000", "bg_fff"}, true, ""},
+		{"Not set", []string{"300x250"}, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			params := parseParameters(tt.segments)
+
+			// Assert
+			assert.Equal(t, tt.expectedPad, params.Pad)
+			assert.Equal(t, tt.expectedBackground, params.Background)
+		})
+	}
+}
+
+// TestParseParameters_Crop tests crop_x_y_w_h segments
+func TestParseParameters_Crop(t *testing.T) {
+	tests := []struct {
+		name     string
+		segments []string
+		expected [4]int
+	}{
+		{"Crop", []string{"crop_100_50_400_300", "200x150"}, [4]int{100, 50, 400, 300}},
+		{"Origin", []string{"crop_0_0_10_10"}, [4]int{0, 0, 10, 10}},
+		{"First wins", []string{"crop_1_2_3_4", "crop_5_6_7_8"}, [4]int{1, 2, 3, 4}},
+		{"Empty rectangle ignored", []string{"crop_10_10_0_20"}, [4]int{}},
+		{"Too large ignored", []string{"crop_0_0_100001_10"}, [4]int{}},
+		{"Malformed ignored", []string{"crop_1_2_3", "crop_-1_0_10_10"}, [4]int{}},
+		{"Not set", []string{"200x150"}, [4]int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			params := parseParameters(tt.segments)
+
+			// Assert
+			assert.Equal(t, tt.expected, params.Crop)
+		})
+	}
+}
+
+// TestParseParameters_Trim tests the trim segment
+func TestParseParameters_Trim(t *testing.T) {
+	assert.True(t, parseParameters([]string{"trim", "200x150"}).Trim)
+	assert.True(t, parseParameters([]string{"200x150", "png", "trim"}).Trim)
+	assert.False(t, parseParameters([]string{"200x150", "trimmed"}).Trim)
+}
+
+// TestParseParameters_Progressive tests the progressive segment
+func TestParseParameters_Progressive(t *testing.T) {
+	assert.True(t, parseParameters([]string{"progressive", "200x150"}).Progressive)
+	assert.True(t, parseParameters([]string{"200x150", "jpeg", "progressive"}).Progressive)
+	assert.False(t, parseParameters([]string{"200x150", "jpeg"}).Progressive)
+}
+
+// TestParseParameters_Filter tests filter_<name> segments
+func TestParseParameters_Filter(t *testing.T) {
+	assert.Equal(t, "grayscale", parseParameters([]string{"filter_grayscale", "200x150"}).Filter)
+	assert.Equal(t, "sepia", parseParameters([]string{"200x150", "png", "filter_sepia"}).Filter)
+	assert.Equal(t, "monochrome", parseParameters([]string{"filter_monochrome"}).Filter)
+
+	// Unknown filters are ignored, and the first valid filter wins
+	params := parseParameters([]string{"200x150", "filter_blur", "png"})
+	assert.Equal(t, "", params.Filter)
+	assert.Equal(t, 200, params.Width)
+	assert.Equal(t, "png", params.Format)
+	assert.Equal(t, "sepia", parseParameters([]string{"filter_blur", "filter_sepia", "filter_grayscale"}).Filter)
+}
+
+// TestQuerySegments tests conversion of query parameters to path segments
+func TestQuerySegments(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{"Width only", "width=800", []string{"800"}},
+		{"Width and height", "width=800&height=600", []string{"800x600"}},
+		{"Height without width ignored", "height=600", nil},
+		{"Quality", "quality=80", []string{"q80"}},
+		{"Auto quality", "quality=auto", []string{"qauto"}},
+		{"Format", "format=PNG", []string{"png"}},
+		{"Frame", "frame=2", []string{"frame_2"}},
+		{"DPI", "dpi=300", []string{"dpi300"}},
+		{"Filter", "filter=Sepia", []string{"filter_sepia"}},
+		{"All", "format=webp&quality=90&width=300&height=200", []string{"300x200", "q90", "webp"}},
+		{"Unrelated ignored", "cache=true&foo=bar", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			query, err := url.ParseQuery(tt.query)
+			require.NoError(t, err)
+
+			// Act
+			segments := querySegments(query)
+
+			// Assert
+			assert.Equal(t, tt.expected, segments)
+		})
+	}
+}
+
+// TestSplitContentHash tests extraction of the h-<hash> segment
+func TestSplitContentHash(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+	tests := []struct {
+		name         string
+		segments     []string
+		expected     []string
+		expectedHash string
+	}{
+		{"No hash", []string{"800x600", "webp"}, []string{"800x600", "webp"}, ""},
+		{"Trailing hash", []string{"800x600", "webp", "h-" + hash}, []string{"800x600", "webp"}, hash},
+		{"Hash between params", []string{"800x600", "h-" + hash, "webp"}, []string{"800x600", "webp"}, hash},
+		{"Short hash ignored", []string{"800x600", "h-abc"}, []string{"800x600", "h-abc"}, ""},
+		{"Uppercase hash ignored", []string{"h-" + strings.ToUpper(hash)}, []string{"h-" + strings.ToUpper(hash)}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			segments, gotHash := splitContentHash(tt.segments)
+
+			// Assert
+			assert.Equal(t, tt.expected, segments)
+			assert.Equal(t, tt.expectedHash, gotHash)
+		})
+	}
+}
+
+// TestParamsToken_RoundTrip tests that encoded params parse back unchanged
+func TestParamsToken_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		params cache.ProcessingParams
+	}{
+		{"Dimensions", cache.ProcessingParams{Width: 800, Height: 600, Format: "webp", Quality: 90}},
+		{"Width only", cache.ProcessingParams{Width: 300, Format: "png", Quality: 75}},
+		{"Auto quality", cache.ProcessingParams{Width: 800, Height: 600, Format: "jpeg", Quality: DefaultQuality, AutoQuality: true}},
+		{"Chroma and DPI", cache.ProcessingParams{Width: 2400, Height: 1800, Format: "jpeg", Quality: 85, ChromaSubsampling: "444", DPI: 300}},
+		{"Poster frame", cache.ProcessingParams{Width: 200, Height: 200, Format: "png", Quality: 75, Poster: true, Frame: 3}},
+		{"Pad", cache.ProcessingParams{Width: 300, Height: 250, Format: "webp", Quality: 75, Pad: true, Background: "1a2b3c"}},
+		{"Crop", cache.ProcessingParams{Width: 200, Height: 150, Format: "png", Quality: 75, Crop: [4]int{100, 50, 400, 300}}},
+		{"Trim", cache.ProcessingParams{Width: 200, Height: 150, Format: "webp", Quality: 75, Trim: true}},
+		{"Progressive", cache.ProcessingParams{Width: 200, Height: 150, Format: "jpeg", Quality: 75, Progressive: true}},
+		{"Filter", cache.ProcessingParams{Width: 200, Height: 150, Format: "webp", Quality: 75, Filter: "sepia"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			token, err := EncodeParamsToken(tt.params)
+			require.NoError(t, err)
+			params := parseParameters([]string{token})
+
+			// Assert
+			assert.True(t, strings.HasPrefix(token, TokenPrefix))
+			assert.NotContains(t, token, "/")
+			assert.Equal(t, tt.params, params)
+		})
+	}
+}
+
+// TestParamsToken_Unencodable tests that sizes without a URL form are
+// refused rather than encoded as a token that parses to the defaults
+func TestParamsToken_Unencodable(t *testing.T) {
+	for _, params := range []cache.ProcessingParams{
+		{Height: 300, Format: "webp", Quality: 75},
+		{Format: "webp", Quality: 75},
+		{Width: MaxDimension + 1, Height: 300},
+		{Width: 300, Height: MinDimension - 1},
+	} {
+		token, err := EncodeParamsToken(params)
+
+		assert.ErrorIs(t, err, ErrUnencodableParams, "%+v", params)
+		assert.Empty(t, token)
+	}
+}
+
+// TestParseParameters_Token tests token segments among path segments
+func TestParseParameters_Token(t *testing.T) {
+	token, err := EncodeParamsToken(cache.ProcessingParams{Width: 400, Height: 300, Format: "png", Quality: 60})
+	require.NoError(t, err)
+	defaults := cache.ProcessingParams{Width: DefaultWidth, Height: DefaultHeight, Format: DefaultFormat, Quality: DefaultQuality}
+
+	tests := []struct {
+		name     string
+		segments []string
+		expected cache.ProcessingParams
+	}{
+		{"Token wins over later segments", []string{token, "800x600", "jpeg"}, cache.ProcessingParams{Width: 400, Height: 300, Format: "png", Quality: 60}},
+		{"Earlier segments win over token", []string{"jpeg", token}, cache.ProcessingParams{Width: 400, Height: 300, Format: "jpeg", Quality: 60}},
+		{"Invalid base64 ignored", []string{"t-!!!"}, defaults},
+		{"Undecodable token ignored", []string{"t-a"}, defaults},
+		{"Non-parameter content ignored", []string{"t-" + base64.RawURLEncoding.EncodeToString([]byte("../../etc"))}, defaults},
+		{"Invalid values fall back to defaults", []string{"t-" + base64.RawURLEncoding.EncodeToString([]byte("99999x1/q500/gif"))}, defaults},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			params := parseParameters(tt.segments)
+
+			// Assert
+			assert.Equal(t, tt.expected, params)
+		})
+	}
+}
+
+// TestDecodeToken_Names tests that names with the token prefix are not tokens
+func TestDecodeToken_Names(t *testing.T) {
+	for _, name := range []string{"t-shirt", "t-rex", "t-", "tshirt"} {
+		assert.Nil(t, decodeToken(name), name)
+	}
+}
+
+// TestFormatRequested tests detection of an explicit output format
+func TestFormatRequested(t *testing.T) {
+	token, err := EncodeParamsToken(cache.ProcessingParams{Width: 400, Height: 300, Format: "png"})
+	require.NoError(t, err)
+	tests := []struct {
+		name     string
+		segments []string
+		expected bool
+	}{
+		{"No segments", nil, false},
+		{"Dimensions only", []string{"400x300", "q80"}, false},
+		{"Invalid format", []string{"gif"}, false},
+		{"Format segment", []string{"400x300", "webp"}, true},
+		{"Format in token", []string{token}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, formatRequested(tt.segments))
+		})
+	}
+}
+
+// TestImageHandler_GET_EquivalentURLs tests that every spelling of the same
+// parameters, through the wildcard route, renders and caches one rendition
+func TestImageHandler_GET_EquivalentURLs(t *testing.T) {
+	const canonical = "/img/test.jpg/800x600/webp/q80"
+	token, err := EncodeParamsToken(cache.ProcessingParams{Width: 800, Height: 600, Format: "webp", Quality: 80})
+	require.NoError(t, err)
+	equivalent := []string{
+		"/img/test.jpg/q80/webp/800x600",
+		"/img/test.jpg/webp/800x600/q80",
+		"/img/test.jpg?width=800&height=600&format=webp&quality=80",
+		"/img/test.jpg/800x600?format=webp&quality=80",
+		"/img/test.jpg/800x600/webp/q80?width=100&format=png&quality=10",
+		"/img/test.jpg/800x600/bogus/webp/q80/-1x-1",
+		"/img/test.jpg/800x600/webp/q80/640x480/png/q10",
+		"/img/test.jpg/" + token,
+		"/img/test.jpg/" + token + "?format=png",
+	}
+
+	// serve answers url from a handler over cacheDir and returns the
+	// response with the options the processor was called with
+	gin.SetMode(gin.TestMode)
+	imagesDir, _, cfg := setupTestEnvironment(t)
+	serve := func(cacheDir, url string) (*httptest.ResponseRecorder, processor.ProcessOptions) {
+		cacheManager, err := cache.NewManager(cacheDir)
+		require.NoError(t, err)
+		proc := &recordingProcessor{}
+		handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+		router := gin.New()
+		router.GET("/img/*path", handler.ServeImage)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		require.Equal(t, http.StatusOK, w.Code, url)
+		return w, proc.opts
+	}
+
+	// Arrange
+	sharedCache := t.TempDir()
+	first, expectedOpts := serve(sharedCache, canonical)
+	assert.Equal(t, cacheMiss, first.Header().Get("X-Cache"))
+	assert.Equal(t, 800, expectedOpts.Width)
+	assert.Equal(t, 600, expectedOpts.Height)
+	assert.Equal(t, processor.FormatWebP, expectedOpts.Format)
+	assert.Equal(t, 80, expectedOpts.Quality)
+
+	for _, url := range equivalent {
+		// Act
+		hit, _ := serve(sharedCache, url)
+		fresh, opts := serve(t.TempDir(), url)
+
+		// Assert: the rendition is shared with the canonical URL, and
+		// rendered from scratch it is rendered with the same options
+		assert.Equal(t, cacheHit, hit.Header().Get("X-Cache"), url)
+		assert.Equal(t, first.Header().Get("ETag"), hit.Header().Get("ETag"), url)
+		assert.Equal(t, first.Body.Bytes(), hit.Body.Bytes(), url)
+		assert.Equal(t, expectedOpts, opts, url)
+		assert.Equal(t, first.Header().Get("Content-Type"), fresh.Header().Get("Content-Type"), url)
+	}
+}
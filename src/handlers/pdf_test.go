@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"goimgserver/cache"
+	"goimgserver/processor"
+	"goimgserver/resolver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestImageHandler_GET_PDF tests that pdf output wraps the JPEG rendition
+// in a page sized from the image and DPI, and is cached like any rendition
+func TestImageHandler_GET_PDF(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	proc := &recordingProcessor{}
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+	handler.pdfSupported = func() bool { return true }
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	// Act: the 100x100 test image at 144 dpi is a 50pt square page
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg/100x100/pdf/dpi144", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	assert.Equal(t, processor.FormatJPEG, proc.opts.Format)
+	assert.Equal(t, 144, proc.opts.DPI)
+	assert.True(t, processor.IsPDF(w.Body.Bytes()))
+	assert.Contains(t, w.Body.String(), "/MediaBox [0 0 50 50]")
+
+	cached := httptest.NewRecorder()
+	router.ServeHTTP(cached, httptest.NewRequest("GET", "/img/test.jpg/100x100/pdf/dpi144", nil))
+	require.Equal(t, http.StatusOK, cached.Code)
+	assert.Equal(t, cacheHit, cached.Header().Get("X-Cache"))
+	assert.Equal(t, "application/pdf", cached.Header().Get("Content-Type"))
+	assert.Equal(t, w.Body.Bytes(), cached.Body.Bytes())
+}
+
+// TestImageHandler_GET_PDF_Unsupported tests that pdf output is refused
+// where JPEG cannot be encoded
+func TestImageHandler_GET_PDF_Unsupported(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, &mockProcessor{})
+	handler.pdfSupported = func() bool { return false }
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	// Act
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg/100x100/pdf", nil))
+
+	// Assert
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"goimgserver/cache"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// preloadKey holds the Link header values for renditions related to the
+// requested one
+const preloadKey = "preload"
+
+// preloadLinks returns Link: rel=preload values for the renditions related
+// to params by the PreloadRenditions rules, e.g. the other srcset sizes of a
+// hero image, so browsers and CDNs with early hints fetch them up front.
+// A rule matches when its preset parses to the same parameters as the
+// request, whatever their order in the URL.
+func (h *ImageHandler) preloadLinks(c *gin.Context, basePath string, params cache.ProcessingParams) []string {
+	var links []string
+	prefix := strings.TrimSuffix(c.FullPath(), "*path")
+	for _, rule := range h.config.PreloadRenditions {
+		preset, related, _ := strings.Cut(rule, "=")
+		if h.applyDefaults(h.parseParams(strings.Split(preset, "/"))) != params {
+			continue
+		}
+		for _, rendition := range strings.Split(related, "|") {
+			target := url.URL{Path: prefix + basePath + "/" + strings.Trim(rendition, "/")}
+			links = append(links, "<"+target.EscapedPath()+">; rel=preload; as=image")
+		}
+	}
+	return links
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"goimgserver/cache"
+	"goimgserver/resolver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestImageHandler_GET_PreloadLinks tests that responses for a configured
+// preset name its related renditions in Link: rel=preload headers
+func TestImageHandler_GET_PreloadLinks(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cfg.PreloadRenditions = []string{
+		"1600x900/webp=800x450/webp|400x225/webp",
+		"300x300/jpeg=150x150/jpeg",
+	}
+
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, &mockProcessor{})
+	router := gin.New()
+	router.Group("/images").GET("/img/*path", handler.ServeImage)
+
+	heroLinks := []string{
+		"</images/img/test.jpg/800x450/webp>; rel=preload; as=image",
+		"</images/img/test.jpg/400x225/webp>; rel=preload; as=image",
+	}
+	tests := []struct {
+		url      string
+		expected []string
+	}{
+		{"/images/img/test.jpg/1600x900/webp", heroLinks},
+		{"/images/img/test.jpg/webp/1600x900", heroLinks},
+		{"/images/img/test.jpg/1600x900?format=webp", heroLinks},
+		{"/images/img/test.jpg/300x300/jpeg", []string{"</images/img/test.jpg/150x150/jpeg>; rel=preload; as=image"}},
+		{"/images/img/test.jpg/800x450/webp", nil},
+		{"/images/img/test.jpg/1600x900/png", nil},
+	}
+	for _, tt := range tests {
+		// Act: a fresh rendition, then the cached one
+		for i := 0; i < 2; i++ {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+			// Assert
+			require.Equal(t, http.StatusOK, w.Code, tt.url)
+			assert.Equal(t, tt.expected, w.Header().Values("Link"), tt.url)
+		}
+	}
+}
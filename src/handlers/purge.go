@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	apperrors "goimgserver/errors"
+	"goimgserver/processor"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PurgeImage handles DELETE /img/*path. It clears the cache like the clear
+// segment. With an If-Match header the purge only proceeds if one of the
+// listed ETags is the rendition's current ETag; otherwise it answers 412.
+func (h *ImageHandler) PurgeImage(c *gin.Context) {
+	requestPath := strings.TrimPrefix(c.Param("path"), "/")
+	segments := strings.Split(requestPath, "/")
+
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" {
+		basePath, current := h.currentETag(c.Request, segments)
+		if !etagMatches(ifMatch, current) {
+			if current != "" {
+				c.Header("ETag", current)
+			}
+			apperrors.HandleError(c, apperrors.NewPreconditionFailedError(basePath, current))
+			return
+		}
+	}
+
+	h.handleCacheClear(c, segments)
+}
+
+// currentETag returns the base path and the ETag ServeImage sends for the
+// rendition, or "" when the rendition cannot be built
+func (h *ImageHandler) currentETag(r *http.Request, segments []string) (string, string) {
+	basePath, paramSegments := h.parsePathAndParams(segments)
+	paramSegments, _ = splitContentHash(paramSegments)
+	paramSegments = h.withQueryParams(paramSegments, r.URL.Query())
+
+	req, err := h.buildRendition(r, basePath, paramSegments, processor.Caption{}, false)
+	if err != nil {
+		return basePath, ""
+	}
+	return basePath, etagFor(h.contentHash(req.cacheKey, req.result, req.params))
+}
+
+// etagFor quotes a content hash as a strong ETag
+func etagFor(contentHash string) string {
+	if contentHash == "" {
+		return ""
+	}
+	return `"` + contentHash + `"`
+}
+
+// etagMatches reports whether an If-Match header matches etag using strong
+// comparison. "*" matches any current rendition.
+func etagMatches(ifMatch, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// etagNoneMatch reports whether an If-None-Match header lists etag using
+// weak comparison, so the client's copy is current. "*" matches any
+// current rendition.
+func etagNoneMatch(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
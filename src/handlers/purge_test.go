@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/json"
+	"goimgserver/config"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cachedFiles counts the cache entries under cacheDir
+func cachedFiles(t *testing.T, cacheDir string) int {
+	count := 0
+	err := filepath.WalkDir(cacheDir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			count++
+		}
+		return err
+	})
+	require.NoError(t, err)
+	return count
+}
+
+// fetchETag requests an image and returns its ETag
+func fetchETag(t *testing.T, router *gin.Engine, url string) string {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	return etag
+}
+
+// purge sends a DELETE with an optional If-Match header
+func purge(router *gin.Engine, url, ifMatch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("DELETE", url, nil)
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// TestPurgeImage_MatchingETag tests that a purge with the current ETag clears the cache
+func TestPurgeImage_MatchingETag(t *testing.T) {
+	// Arrange
+	router, handler, _ := setupTestRouter(t, nil)
+	cacheDir := handler.config.CacheDir
+	etag := fetchETag(t, router, "/img/test.jpg/400x300")
+	require.Equal(t, 1, cachedFiles(t, cacheDir))
+
+	// Act
+	w := purge(router, "/img/test.jpg/400x300", etag)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 0, cachedFiles(t, cacheDir))
+}
+
+// TestPurgeImage_StaleETag tests that a purge with an outdated ETag is refused
+func TestPurgeImage_StaleETag(t *testing.T) {
+	// Arrange
+	router, handler, _ := setupTestRouter(t, nil)
+	cacheDir := handler.config.CacheDir
+	stale := fetchETag(t, router, "/img/test.jpg")
+
+	// The source is replaced and its rendition regenerated
+	source := filepath.Join(handler.config.ImagesDir, "test.jpg")
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(source, later, later))
+	current := fetchETag(t, router, "/img/test.jpg")
+	require.NotEqual(t, stale, current)
+	before := cachedFiles(t, cacheDir)
+
+	// Act
+	w := purge(router, "/img/test.jpg", stale)
+
+	// Assert
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Equal(t, current, w.Header().Get("ETag"))
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "PRECONDITION_FAILED", response["code"])
+	assert.Equal(t, before, cachedFiles(t, cacheDir))
+}
+
+// TestPurgeImage_SidecarETag tests that the ETag of a rendition a sidecar
+// adjusts is current for the purge
+func TestPurgeImage_SidecarETag(t *testing.T) {
+	// Arrange
+	router, handler, _ := setupTestRouter(t, func(cfg *config.Config) {
+		cfg.Sidecars = true
+		require.NoError(t, os.WriteFile(filepath.Join(cfg.ImagesDir, "test.jpg.json"), []byte(`{"quality":50}`), 0644))
+	})
+	cacheDir := handler.config.CacheDir
+	etag := fetchETag(t, router, "/img/test.jpg/400x300")
+
+	// Act
+	w := purge(router, "/img/test.jpg/400x300", etag)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 0, cachedFiles(t, cacheDir))
+}
+
+// TestPurgeImage_WithoutIfMatch tests that an unconditional purge clears the cache
+func TestPurgeImage_WithoutIfMatch(t *testing.T) {
+	// Arrange
+	router, handler, _ := setupTestRouter(t, nil)
+	cacheDir := handler.config.CacheDir
+	fetchETag(t, router, "/img/test.jpg")
+
+	// Act
+	w := purge(router, "/img/test.jpg", "")
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 0, cachedFiles(t, cacheDir))
+}
+
+// TestPurgeImage_DedupeSources tests that a purge clears the renditions
+// cached under the source's content hash
+func TestPurgeImage_DedupeSources(t *testing.T) {
+	// Arrange
+	router, handler, _ := setupTestRouter(t, func(cfg *config.Config) { cfg.DedupeSources = true })
+	cacheDir := handler.config.CacheDir
+	etag := fetchETag(t, router, "/img/test.jpg/400x300")
+	require.Equal(t, 1, cachedFiles(t, cacheDir))
+
+	// Act
+	w := purge(router, "/img/test.jpg/400x300", etag)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 0, cachedFiles(t, cacheDir))
+}
+
+// TestEtagMatches tests If-Match comparison
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		ifMatch string
+		etag    string
+		want    bool
+	}{
+		{"exact", `"abc"`, `"abc"`, true},
+		{"list", `"xyz", "abc"`, `"abc"`, true},
+		{"wildcard", "*", `"abc"`, true},
+		{"different", `"xyz"`, `"abc"`, false},
+		{"weak", `W/"abc"`, `"abc"`, false},
+		{"missing rendition", "*", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, etagMatches(tt.ifMatch, tt.etag))
+		})
+	}
+}
+
+// TestEtagNoneMatch tests If-None-Match comparison
+func TestEtagNoneMatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		etag        string
+		want        bool
+	}{
+		{"exact", `"abc"`, `"abc"`, true},
+		{"list", `"xyz", "abc"`, `"abc"`, true},
+		{"wildcard", "*", `"abc"`, true},
+		{"weak", `W/"abc"`, `"abc"`, true},
+		{"different", `"xyz"`, `"abc"`, false},
+		{"no header", "", `"abc"`, false},
+		{"no etag", "*", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, etagNoneMatch(tt.ifNoneMatch, tt.etag))
+		})
+	}
+}
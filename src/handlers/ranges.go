@@ -0,0 +1,23 @@
+package handlers
+
+import "goimgserver/config"
+
+// originalKey marks a response serving the source file as stored, without
+// processing
+const originalKey = "original"
+
+// acceptRanges reports whether an image response answers Range requests.
+// Originals are files that already exist, so serving them in parts is cheap;
+// transformed renditions must be rendered in full before any part is sent.
+func (h *ImageHandler) acceptRanges(original bool) bool {
+	switch h.config.RangeRequests {
+	case config.RangeAll:
+		return true
+	case config.RangeNone:
+		return false
+	case config.RangeTransformed:
+		return !original
+	default:
+		return original
+	}
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"goimgserver/cache"
+	"goimgserver/config"
+	"goimgserver/resolver"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestImageHandler_GET_RangeRequests tests that pass-through originals and
+// transformed renditions accept Range requests as configured
+func TestImageHandler_GET_RangeRequests(t *testing.T) {
+	const original = "/img/anim.gif"
+	const transformed = "/img/test.jpg/300x250/jpeg"
+
+	tests := []struct {
+		mode     string
+		accepted map[string]bool
+	}{
+		{"", map[string]bool{original: true, transformed: false}},
+		{config.RangeOriginals, map[string]bool{original: true, transformed: false}},
+		{config.RangeTransformed, map[string]bool{original: false, transformed: true}},
+		{config.RangeAll, map[string]bool{original: true, transformed: true}},
+		{config.RangeNone, map[string]bool{original: false, transformed: false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+			cfg.RangeRequests = tt.mode
+			cfg.AnimatedGIF = config.AnimatedGIFPassthrough
+			require.NoError(t, createTestGIF(filepath.Join(imagesDir, "anim.gif")))
+
+			cacheManager, err := cache.NewManager(cacheDir)
+			require.NoError(t, err)
+			handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, &mockProcessor{})
+			router := gin.New()
+			router.GET("/img/*path", handler.ServeImage)
+
+			for url, accepted := range tt.accepted {
+				acceptRanges := "none"
+				if accepted {
+					acceptRanges = "bytes"
+				}
+
+				// Fresh renditions
+				full := httptest.NewRecorder()
+				router.ServeHTTP(full, httptest.NewRequest("GET", url, nil))
+				require.Equal(t, http.StatusOK, full.Code, url)
+				assert.Equal(t, acceptRanges, full.Header().Get("Accept-Ranges"), url)
+
+				// Cached renditions asked for their first 10 bytes
+				req := httptest.NewRequest("GET", url, nil)
+				req.Header.Set("Range", "bytes=0-9")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+
+				assert.Equal(t, cacheHit, w.Header().Get("X-Cache"), url)
+				assert.Equal(t, acceptRanges, w.Header().Get("Accept-Ranges"), url)
+				if accepted {
+					assert.Equal(t, http.StatusPartialContent, w.Code, url)
+					assert.Equal(t, full.Body.Bytes()[:10], w.Body.Bytes(), url)
+				} else {
+					assert.Equal(t, http.StatusOK, w.Code, url)
+					assert.Equal(t, full.Body.Bytes(), w.Body.Bytes(), url)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"goimgserver/cache"
+	"goimgserver/processor"
+	"goimgserver/resolver"
+	"net/http"
+)
+
+// errImageMissing is returned when the image is missing and fallback is disabled
+var errImageMissing = errors.New("image not found")
+
+// errPDFUnsupported is returned for a PDF rendition when PDF output is not available
+var errPDFUnsupported = errors.New("pdf output not supported")
+
+// renditionRequest is a rendition request resolved to its source, final
+// parameters and cache key
+type renditionRequest struct {
+	basePath string
+	// requested are the parameters the URL alone asks for
+	requested     cache.ProcessingParams
+	params        cache.ProcessingParams
+	namespace     string
+	result        *resolver.ResolutionResult
+	contentFormat string
+	cacheKey      string
+	// varyUserAgent is set when the output format depends on the User-Agent
+	varyUserAgent bool
+}
+
+// buildRendition turns the parameter segments of a request for basePath
+// into the rendition's final parameters and cache key. Everything that
+// decides which rendition is served happens here, so ServeImage, warming,
+// pre-cache and purges agree on it. The returned request is never nil; on
+// error it holds what was resolved so far.
+func (h *ImageHandler) buildRendition(r *http.Request, basePath string, paramSegments []string, caption processor.Caption, thumbnail bool) (*renditionRequest, error) {
+	params := h.applyDefaults(h.parseParams(paramSegments))
+	req := &renditionRequest{basePath: basePath, requested: params, params: params}
+
+	namespace, err := h.cacheNamespace(r, basePath)
+	if err != nil {
+		return req, err
+	}
+	req.namespace = namespace
+	if h.config.ClientHints {
+		params = h.applyClientHints(r, params, dimensionsRequested(paramSegments))
+	}
+	if h.config.SaveDataQuality > 0 && saveDataRequested(r) {
+		params = h.applySaveData(params)
+	}
+	req.params = params
+
+	// Resolve the file path and apply the path ACL
+	result, err := h.resolveImage(basePath)
+	if err == nil {
+		result, err = h.checkAccess(result)
+	}
+	if errors.Is(err, errAccessDenied) || errors.Is(err, resolver.ErrEmptySource) {
+		return req, err
+	}
+	if h.bypassFallback() && (err != nil || result.IsFallback) {
+		return req, errImageMissing
+	}
+	if err != nil {
+		return req, err
+	}
+	result = h.groupPlaceholder(basePath, result)
+	req.result = result
+
+	req.contentFormat, err = h.checkSourceFormat(result.ResolvedPath)
+	if err != nil {
+		return req, err
+	}
+	if !thumbnail && h.passthroughGIF(req.contentFormat, paramSegments) {
+		params.Format = gifFormat
+	} else {
+		params = h.applySourceFormat(result.ResolvedPath, paramSegments, params)
+	}
+	params = h.applySidecar(result.ResolvedPath, params, qualityRequested(paramSegments))
+	if caption.Text != "" {
+		params = withCaption(params, caption)
+	}
+	if thumbnail {
+		params = withCover(params)
+	}
+	if !formatRequested(paramSegments) {
+		params, req.varyUserAgent = h.applyClientFormats(r, params)
+	}
+	params, err = h.restrictFormat(basePath, params, formatRequested(paramSegments))
+	req.params = params
+	if err != nil {
+		return req, err
+	}
+	if params.Format == pdfFormat && !h.pdfSupported() {
+		return req, errPDFUnsupported
+	}
+
+	// Cache under the original request path for fallback images, within
+	// the request's namespace
+	req.cacheKey = cache.NamespacedPath(namespace, h.cacheKeyFor(basePath, result))
+	return req, nil
+}
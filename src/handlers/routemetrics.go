@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"fmt"
+	"goimgserver/cache"
+	"goimgserver/config"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Route label values for images outside any group, for requests without
+// parameters and for parameters matching no preset
+const (
+	rootGroupLabel     = "_root"
+	defaultPresetLabel = "default"
+	otherPresetLabel   = "other"
+)
+
+// maxRouteLabels bounds the distinct route labels counted; requests with
+// further labels are counted under otherRouteLabel. Labels are built from
+// group directories, presets and formats, so the bound is only reached
+// with thousands of groups.
+const maxRouteLabels = 500
+
+// otherRouteLabel counts requests whose label came after maxRouteLabels
+const otherRouteLabel = "_other"
+
+// routeMetrics counts image requests per route label
+type routeMetrics struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+// observe counts a request under label
+func (m *routeMetrics) observe(label string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.counts == nil {
+		m.counts = make(map[string]int64)
+	}
+	if _, ok := m.counts[label]; !ok && len(m.counts) >= maxRouteLabels {
+		label = otherRouteLabel
+	}
+	m.counts[label]++
+}
+
+// snapshot returns a copy of the counts per label
+func (m *routeMetrics) snapshot() map[string]int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return maps.Clone(m.counts)
+}
+
+// routeLabel builds the metrics label of an image request from the
+// MetricsLabel template. Placeholders only ever take values from a bounded
+// set: group directories on disk, preset names and output formats.
+func (h *ImageHandler) routeLabel(segments []string, query url.Values) string {
+	template := h.config.MetricsLabel
+	group := rootGroupLabel
+	if strings.Contains(template, config.MetricsLabelGroup) {
+		if name, ok := h.groupDir(segments[0]); ok {
+			group = name
+		}
+	}
+	preset, format := defaultPresetLabel, ""
+	if strings.Contains(template, config.MetricsLabelPreset) || strings.Contains(template, config.MetricsLabelFormat) {
+		_, paramSegments := h.parsePathAndParams(segments)
+		paramSegments, _ = splitContentHash(paramSegments)
+		paramSegments = h.withQueryParams(paramSegments, query)
+		params := h.applyDefaults(h.parseParams(paramSegments))
+		format = params.Format
+		if len(paramSegments) > 0 {
+			preset = h.presetName(params)
+		}
+	}
+	return strings.NewReplacer(
+		config.MetricsLabelGroup, group,
+		config.MetricsLabelPreset, preset,
+		config.MetricsLabelFormat, format,
+	).Replace(template)
+}
+
+// presetName returns the name of the first MetricsPresets rule whose
+// parameters equal params, like preloadLinks matches its presets
+func (h *ImageHandler) presetName(params cache.ProcessingParams) string {
+	for _, rule := range h.config.MetricsPresets {
+		name, preset, _ := strings.Cut(rule, "=")
+		if h.applyDefaults(h.parseParams(strings.Split(strings.Trim(preset, "/"), "/"))) == params {
+			return name
+		}
+	}
+	return otherPresetLabel
+}
+
+// writeRouteMetrics writes the request counts per route label in the
+// Prometheus text exposition format, ordered by label
+func (h *ImageHandler) writeRouteMetrics(sb *strings.Builder) {
+	if h.config.MetricsLabel == "" {
+		return
+	}
+	const name = "goimgserver_image_requests_total"
+	sb.WriteString(fmt.Sprintf("# HELP %s Image requests by route label.\n", name))
+	sb.WriteString(fmt.Sprintf("# TYPE %s counter\n", name))
+	counts := h.routes.snapshot()
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	for _, label := range slices.Sorted(maps.Keys(counts)) {
+		sb.WriteString(fmt.Sprintf("%s{route=\"%s\"} %d\n", name, escape.Replace(label), counts[label]))
+	}
+}
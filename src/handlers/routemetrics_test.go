@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"fmt"
+	"goimgserver/config"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// routeSeries matches a route label series of the request counter
+var routeSeries = regexp.MustCompile(`(?m)^goimgserver_image_requests_total\{route="([^"]*)"\} (\d+)$`)
+
+// setupRouteMetricsRouter returns a test router serving metrics with the
+// given label template and presets
+func setupRouteMetricsRouter(t *testing.T, label string, presets ...string) *gin.Engine {
+	router, handler, _ := setupTestRouter(t, func(cfg *config.Config) {
+		cfg.MetricsLabel = label
+		cfg.MetricsPresets = presets
+	})
+	router.GET("/debug/metrics", handler.HandleProcessingMetrics)
+	return router
+}
+
+// routeCounts requests the metrics and returns the count per route label
+func routeCounts(t *testing.T, router *gin.Engine) (map[string]int, string) {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/debug/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	counts := map[string]int{}
+	for _, match := range routeSeries.FindAllStringSubmatch(w.Body.String(), -1) {
+		var n int
+		fmt.Sscan(match[2], &n)
+		counts[match[1]] = n
+	}
+	return counts, w.Body.String()
+}
+
+// TestImageHandler_RouteMetrics tests that many distinct paths collapse into
+// a few route labels by group and preset, never the raw path
+func TestImageHandler_RouteMetrics(t *testing.T) {
+	// Arrange
+	router := setupRouteMetricsRouter(t, "{group}/{preset}", "thumb=200x200/webp", "hero=1600x900/jpeg")
+
+	// Act
+	for i := 0; i < 100; i++ {
+		for _, url := range []string{
+			fmt.Sprintf("/img/photo%d.jpg", i),
+			fmt.Sprintf("/img/cats/cat%d.jpg/200x200/webp", i),
+			fmt.Sprintf("/img/cats/cat%d.jpg/%dx%d", i, 100+i, 100+i),
+			fmt.Sprintf("/img/dir%d/photo.jpg/1600x900/jpeg", i),
+			fmt.Sprintf("/img/test.jpg/h-%064d", i),
+		} {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		}
+	}
+	counts, body := routeCounts(t, router)
+
+	// Assert
+	assert.Contains(t, body, "# TYPE goimgserver_image_requests_total counter\n")
+	assert.Equal(t, map[string]int{
+		"_root/default": 200,
+		"cats/thumb":    100,
+		"cats/other":    100,
+		"_root/hero":    100,
+	}, counts)
+	assert.NotContains(t, body, "photo1.jpg")
+}
+
+// TestImageHandler_RouteMetrics_Template tests each placeholder and literal
+// text of the label template
+func TestImageHandler_RouteMetrics_Template(t *testing.T) {
+	tests := []struct {
+		label    string
+		url      string
+		expected string
+	}{
+		{"{group}", "/img/cats/cat_white.jpg/300x300", "cats"},
+		{"{group}", "/img/cats", "cats"},
+		{"{group}", "/img/test.jpg", "_root"},
+		{"{group}", "/img/missing/test.jpg", "_root"},
+		{"{preset}", "/img/test.jpg", "default"},
+		{"{preset}", "/img/test.jpg/400x300/webp", "card"},
+		{"{preset}", "/img/test.jpg?width=400&height=300&format=webp", "card"},
+		{"{preset}", "/img/test.jpg/400x300/png", "other"},
+		{"{format}", "/img/test.jpg", "webp"},
+		{"{format}", "/img/test.jpg/png", "png"},
+		{"img-{group}-{format}", "/img/cats/cat_white.jpg/jpeg", "img-cats-jpeg"},
+		{"static", "/img/cats/cat_white.jpg", "static"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.label+" "+tt.url, func(t *testing.T) {
+			// Arrange
+			router := setupRouteMetricsRouter(t, tt.label, "card=400x300/webp")
+
+			// Act
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+			counts, _ := routeCounts(t, router)
+
+			// Assert
+			assert.Equal(t, map[string]int{tt.expected: 1}, counts)
+		})
+	}
+}
+
+// TestImageHandler_RouteMetrics_Off tests that an empty template counts no
+// route series
+func TestImageHandler_RouteMetrics_Off(t *testing.T) {
+	router := setupRouteMetricsRouter(t, "")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg", nil))
+
+	_, body := routeCounts(t, router)
+
+	assert.NotContains(t, body, "goimgserver_image_requests_total")
+	assert.Contains(t, body, "goimgserver_processing_independent_total")
+}
+
+// TestRouteMetrics_Bound tests that labels past maxRouteLabels are counted
+// together
+func TestRouteMetrics_Bound(t *testing.T) {
+	var m routeMetrics
+	for i := 0; i < 3*maxRouteLabels; i++ {
+		m.observe(strings.Repeat("g", i%(2*maxRouteLabels)+1))
+	}
+
+	counts := m.snapshot()
+
+	assert.Len(t, counts, maxRouteLabels+1)
+	assert.Equal(t, int64(2), counts["g"])
+	assert.Equal(t, int64(maxRouteLabels), counts[otherRouteLabel])
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"goimgserver/cache"
+	"goimgserver/storage"
+	"io"
+	"io/fs"
+	"log"
+)
+
+// sidecarSuffix is appended to a source's path to find its sidecar
+const sidecarSuffix = ".json"
+
+// maxSidecarSize bounds the sidecar read, overrides are a few fields
+const maxSidecarSize = 64 << 10
+
+// sidecar holds the overrides for one image, read from a JSON file next to
+// it, e.g. photo.jpg.json for photo.jpg:
+//
+//	{"transcode": false}
+//	{"format": "png", "quality": 90, "no_upscale": true}
+type sidecar struct {
+	// Transcode false serves the source as stored for every request
+	Transcode *bool `json:"transcode"`
+
+	// Format is the output format, whatever the request asks for
+	Format string `json:"format"`
+
+	// Quality is the quality of requests that name none
+	Quality int `json:"quality"`
+
+	// NoUpscale keeps renditions within the source's dimensions
+	NoUpscale bool `json:"no_upscale"`
+}
+
+// readSidecar reads the sidecar of the source at path. Missing sidecars
+// are nil; unreadable or invalid ones are logged and nil as well, so a
+// broken sidecar never breaks its image.
+func readSidecar(files storage.FS, path string) *sidecar {
+	file, err := files.Open(path + sidecarSuffix)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Warning: ignoring sidecar of %s: %v", path, err)
+		}
+		return nil
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSidecarSize))
+	if err != nil {
+		log.Printf("Warning: ignoring sidecar of %s: %v", path, err)
+		return nil
+	}
+	var sc sidecar
+	if err := json.Unmarshal(data, &sc); err != nil {
+		log.Printf("Warning: ignoring sidecar of %s: %v", path, err)
+		return nil
+	}
+	if sc.Format != "" && !validFormats[sc.Format] {
+		log.Printf("Warning: ignoring sidecar of %s: invalid format %q", path, sc.Format)
+		return nil
+	}
+	if sc.Quality != 0 && !isValidQuality(sc.Quality) {
+		log.Printf("Warning: ignoring sidecar of %s: invalid quality %d", path, sc.Quality)
+		return nil
+	}
+	return &sc
+}
+
+// applySidecar merges the sidecar of the source at path over params.
+// Forced settings win over the request and configuration: no transcoding,
+// then the format and no upscaling. The sidecar's quality only fills in
+// for a request that names none, and stays within the Save-Data cap.
+// Merged settings are part of params, so they key the cache.
+func (h *ImageHandler) applySidecar(path string, params cache.ProcessingParams, qualityRequested bool) cache.ProcessingParams {
+	if !h.config.Sidecars {
+		return params
+	}
+	sc := readSidecar(h.files, path)
+	if sc == nil {
+		return params
+	}
+
+	if sc.Transcode != nil && !*sc.Transcode {
+		if format := sourceFormat(h.files, path); format != "" {
+			params.Format = format
+			params.Original = true
+			return params
+		}
+	}
+	if sc.Format != "" {
+		params.Format = sc.Format
+	}
+	if sc.Quality > 0 && !qualityRequested {
+		params.Quality = sc.Quality
+		if params.SaveData {
+			params.Quality = min(params.Quality, h.config.SaveDataQuality)
+		}
+	}
+	params.NoUpscale = params.NoUpscale || sc.NoUpscale
+	return h.applyDefaults(params)
+}
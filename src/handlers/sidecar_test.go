@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"goimgserver/config"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupSidecarTest creates a test router reading sidecars and returns its
+// images directory
+func setupSidecarTest(t *testing.T) (string, *gin.Engine, *recordingProcessor) {
+	router, handler, proc := setupTestRouter(t, func(cfg *config.Config) {
+		cfg.Sidecars = true
+	})
+	return handler.config.ImagesDir, router, proc
+}
+
+// TestImageHandler_GET_SidecarForceFormat tests that a sidecar's format
+// wins over the requested one and keys the cache
+func TestImageHandler_GET_SidecarForceFormat(t *testing.T) {
+	// Arrange
+	imagesDir, router, proc := setupSidecarTest(t)
+	const url = "/img/test.jpg/300x200/webp"
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "webp", string(proc.opts.Format))
+
+	// Act: the image gets a sidecar
+	require.NoError(t, os.WriteFile(filepath.Join(imagesDir, "test.jpg.json"), []byte(`{"format": "jpeg"}`), 0644))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+
+	// Assert: rendered anew instead of served from the WebP entry
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, cacheMiss, w.Header().Get("X-Cache"))
+	assert.Equal(t, "jpeg", string(proc.opts.Format))
+	assert.Equal(t, "image/jpeg", w.Header().Get("Content-Type"))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+	assert.Equal(t, cacheHit, w.Header().Get("X-Cache"))
+	assert.Equal(t, "image/jpeg", w.Header().Get("Content-Type"))
+}
+
+// TestImageHandler_GET_SidecarNoTranscode tests that a sidecar disabling
+// transcoding serves the source as stored
+func TestImageHandler_GET_SidecarNoTranscode(t *testing.T) {
+	// Arrange
+	imagesDir, router, proc := setupSidecarTest(t)
+	require.NoError(t, os.WriteFile(filepath.Join(imagesDir, "test.jpg.json"), []byte(`{"transcode": false}`), 0644))
+	source, err := os.ReadFile(filepath.Join(imagesDir, "test.jpg"))
+	require.NoError(t, err)
+
+	for _, cacheStatus := range []string{cacheMiss, cacheHit} {
+		// Act
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg/300x200/webp/q50", nil))
+
+		// Assert
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, cacheStatus, w.Header().Get("X-Cache"))
+		assert.Equal(t, source, w.Body.Bytes())
+		assert.Equal(t, "image/jpeg", w.Header().Get("Content-Type"))
+		assert.Equal(t, "true", w.Header().Get("X-Served-Original"))
+	}
+	assert.Empty(t, proc.opts.Format, "the source should not be processed")
+}
+
+// TestImageHandler_GET_SidecarOverrides tests the sidecar's default
+// quality and upscaling limit, and that invalid sidecars are ignored
+func TestImageHandler_GET_SidecarOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		sidecar string
+		url     string
+		width   int
+		height  int
+		quality int
+	}{
+		{"Default quality", `{"quality": 90}`, "/img/test.jpg/300x200/jpeg", 300, 200, 90},
+		{"Requested quality wins", `{"quality": 90}`, "/img/test.jpg/300x200/jpeg/q50", 300, 200, 50},
+		{"No upscale", `{"no_upscale": true}`, "/img/test.jpg/400x200/jpeg", 100, 50, DefaultQuality},
+		{"Within source", `{"no_upscale": true}`, "/img/test.jpg/80x40/jpeg", 80, 40, DefaultQuality},
+		{"Malformed", `{"quality": `, "/img/test.jpg/300x200/jpeg", 300, 200, DefaultQuality},
+		{"Invalid format", `{"format": "bmp", "quality": 90}`, "/img/test.jpg/300x200/jpeg", 300, 200, DefaultQuality},
+		{"Invalid quality", `{"quality": 101}`, "/img/test.jpg/300x200/jpeg", 300, 200, DefaultQuality},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			imagesDir, router, proc := setupSidecarTest(t)
+			require.NoError(t, os.WriteFile(filepath.Join(imagesDir, "test.jpg.json"), []byte(tt.sidecar), 0644))
+
+			// Act
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+			// Assert
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.width, proc.opts.Width)
+			assert.Equal(t, tt.height, proc.opts.Height)
+			assert.Equal(t, tt.quality, proc.opts.Quality)
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"goimgserver/storage"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// maxSourceReads bounds the attempts to read a source that keeps changing
+const maxSourceReads = 3
+
+// errSourceChanged is returned when a source changed during every read
+var errSourceChanged = errors.New("source changed while it was read")
+
+// sourceVersion identifies the version of a source file that was read
+type sourceVersion struct {
+	size    int64
+	modTime time.Time
+}
+
+// String formats the version for content hashes
+func (v sourceVersion) String() string {
+	return fmt.Sprintf("%d-%d", v.size, v.modTime.UnixNano())
+}
+
+// readSource reads a source image along with the version the bytes belong
+// to. A file replaced or rewritten while it was read, e.g. by a git pull,
+// is read again, so the bytes are never a mix of two versions.
+func readSource(files storage.FS, path string) ([]byte, sourceVersion, error) {
+	for attempt := 0; attempt < maxSourceReads; attempt++ {
+		data, version, err := readSourceOnce(files, path)
+		if !errors.Is(err, errSourceChanged) {
+			return data, version, err
+		}
+	}
+	return nil, sourceVersion{}, fmt.Errorf("%w: %s", errSourceChanged, path)
+}
+
+// readSourceOnce reads path and checks that neither the open file nor the
+// file at path changed while it was read
+func readSourceOnce(files storage.FS, path string) ([]byte, sourceVersion, error) {
+	f, err := files.Open(path)
+	if err != nil {
+		return nil, sourceVersion{}, err
+	}
+	defer f.Close()
+
+	before, err := f.Stat()
+	if err != nil {
+		return nil, sourceVersion{}, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, sourceVersion{}, err
+	}
+	after, err := files.Stat(path)
+	if err != nil {
+		return nil, sourceVersion{}, err
+	}
+
+	if int64(len(data)) != before.Size() || !sameVersion(before, after) {
+		return nil, sourceVersion{}, errSourceChanged
+	}
+	return data, sourceVersion{size: after.Size(), modTime: after.ModTime()}, nil
+}
+
+// sameVersion reports whether after is the version of the file before
+// describes. A rewrite shows in the size or modification time, a
+// replacement in the path now naming another file.
+func sameVersion(before, after fs.FileInfo) bool {
+	return storage.SameFile(before, after) && after.Size() == before.Size() && after.ModTime().Equal(before.ModTime())
+}
+
+// checkedSource reads an open source file and fails once the file at path
+// is no longer the version opened, so a source rewritten in place while it
+// is sent, e.g. by a git pull, cuts the response short rather than sending
+// a mix of two versions
+type checkedSource struct {
+	io.ReaderAt
+	files  storage.FS
+	path   string
+	opened fs.FileInfo
+}
+
+// ReadAt reads from the source and checks its version after the read, when
+// any rewrite of the bytes read already shows
+func (s *checkedSource) ReadAt(p []byte, off int64) (int, error) {
+	n, err := s.ReaderAt.ReadAt(p, off)
+	if now, statErr := s.files.Stat(s.path); statErr != nil || !sameVersion(s.opened, now) {
+		return 0, fmt.Errorf("%w: %s", errSourceChanged, s.path)
+	}
+	return n, err
+}
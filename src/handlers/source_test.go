@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"goimgserver/cache"
+	"goimgserver/resolver"
+	"goimgserver/storage"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReadSource tests a source is read with the version of its bytes
+func TestReadSource(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	require.NoError(t, os.WriteFile(path, []byte("version one"), 0644))
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+
+	// Act
+	data, version, err := readSource(storage.OS, path)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, []byte("version one"), data)
+	assert.Equal(t, int64(len(data)), version.size)
+	assert.True(t, version.modTime.Equal(modTime))
+
+	_, _, err = readSource(storage.OS, filepath.Join(t.TempDir(), "missing.jpg"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+// TestImageHandler_GET_SourceReplacedConcurrently tests responses stay consistent while the source is replaced
+func TestImageHandler_GET_SourceReplacedConcurrently(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cfg.HonorNoCache = true
+	sourcePath := filepath.Join(imagesDir, "test.jpg")
+
+	// Two versions of the source with distinct sizes and modification times
+	versionDir := t.TempDir()
+	versions := make([]struct {
+		data    []byte
+		modTime time.Time
+	}, 2)
+	for i, size := range []int{100, 60} {
+		path := filepath.Join(versionDir, "version.jpg")
+		require.NoError(t, createTestImage(path, size, size))
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		versions[i].data = data
+		versions[i].modTime = time.Date(2024, 1, 1, 0, 0, i, 0, time.UTC)
+	}
+	require.NotEqual(t, len(versions[0].data), len(versions[1].data))
+
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, &mockProcessor{})
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	params := handler.applyDefaults(handler.parseParams([]string{"jpeg"}))
+	etags := map[string]int{}
+	for i, v := range versions {
+		etags[etagFor(handler.versionHash(sourcePath, sourceVersion{size: int64(len(v.data)), modTime: v.modTime}, params))] = i
+	}
+
+	// Replace the source like a deployment or git pull: write a new file
+	// and rename it over the old one
+	replace := func(i int) {
+		v := versions[i%2]
+		tmp := sourcePath + ".new"
+		if os.WriteFile(tmp, v.data, 0644) == nil && os.Chtimes(tmp, v.modTime, v.modTime) == nil {
+			os.Rename(tmp, sourcePath)
+		}
+	}
+	replace(0)
+	var stop atomic.Bool
+	var writer sync.WaitGroup
+	writer.Add(1)
+	go func() {
+		defer writer.Done()
+		for i := 1; !stop.Load(); i++ {
+			replace(i)
+		}
+	}()
+
+	// Act
+	var readers sync.WaitGroup
+	seen := make([]atomic.Int64, len(versions))
+	for r := 0; r < 8; r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for i := 0; i < 25; i++ {
+				req := httptest.NewRequest("GET", "/img/test.jpg/jpeg", nil)
+				req.Header.Set("Cache-Control", "no-cache")
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+
+				// Assert: the bytes are one whole version and the ETag is that version's
+				if !assert.Equal(t, http.StatusOK, w.Code) {
+					continue
+				}
+				served, ok := etags[w.Header().Get("ETag")]
+				if assert.True(t, ok, "unknown ETag %q", w.Header().Get("ETag")) {
+					assert.Equal(t, versions[served].data, w.Body.Bytes(), "bytes do not match the ETag's version")
+					seen[served].Add(1)
+				}
+			}
+		}()
+	}
+	readers.Wait()
+	stop.Store(true)
+	writer.Wait()
+
+	assert.Positive(t, seen[0].Load()+seen[1].Load())
+}
+
+// TestImageHandler_GET_ArchiveSource tests resolving and serving images
+// from a zip archive mounted at the images directory
+func TestImageHandler_GET_ArchiveSource(t *testing.T) {
+	// Arrange: an in-memory zip whose images differ in size
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cfg.DefaultImagePath = "" // Fall back to the group and system defaults in the archive
+	sizes := map[string]int{"archived.jpg": 40, "dogs/rex.jpg": 45, "dogs/default.jpg": 50, "default.jpg": 60}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, size := range sizes {
+		path := filepath.Join(t.TempDir(), "image.jpg")
+		require.NoError(t, createTestImage(path, size, size))
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	fileResolver := resolver.NewResolverWithCache(imagesDir)
+	fileResolver.SetStorage(storage.Mount(imagesDir, archive))
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	handler := NewImageHandler(cfg, fileResolver, cacheManager, &mockProcessor{})
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	tests := []struct {
+		url  string
+		size int
+	}{
+		{"/img/archived.jpg/jpeg", 40},
+		{"/img/archived/jpeg", 40},
+		{"/img/dogs/rex.jpg/jpeg", 45},
+		{"/img/dogs/jpeg", 50},
+		{"/img/dogs/missing.jpg/jpeg", 50},
+		{"/img/missing.jpg/jpeg", 60},
+		// Files in the images directory on disk are hidden by the archive
+		{"/img/test.jpg/jpeg", 60},
+	}
+
+	for _, tt := range tests {
+		// Act
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+		// Assert
+		require.Equal(t, http.StatusOK, w.Code, tt.url)
+		decoded, _, err := image.DecodeConfig(bytes.NewReader(w.Body.Bytes()))
+		require.NoError(t, err, tt.url)
+		assert.Equal(t, tt.size, decoded.Width, tt.url)
+	}
+
+	names, err := fileResolver.ListGroup("dogs")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rex.jpg"}, names)
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goimgserver/cache"
+	"goimgserver/processor"
+	"image"
+	"image/png"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Sprite endpoints: /img/_sprite answers the sheet image and
+// /img/_sprite.json its coordinate map, for the same query
+const (
+	SpriteSegment    = "_sprite"
+	SpriteMapSegment = "_sprite.json"
+)
+
+// Spritesheet request limits
+const (
+	maxSprites        = 100
+	defaultSpriteCell = 64
+	maxSpriteCell     = 512
+	maxSpritePadding  = 64
+)
+
+// spriteCacheDir is the cache path sheets and maps are stored under, keyed by
+// their inputs and layout
+const spriteCacheDir = "_sprites"
+
+// errSpriteMissing is returned when a sprite input does not exist
+var errSpriteMissing = errors.New("image not found")
+
+// spriteRequest reports whether segments address a sprite endpoint and
+// whether it is the coordinate map
+func spriteRequest(segments []string) (bool, bool) {
+	if len(segments) != 1 {
+		return false, false
+	}
+	return segments[0] == SpriteSegment || segments[0] == SpriteMapSegment, segments[0] == SpriteMapSegment
+}
+
+// spriteQuery is a parsed sprite request
+type spriteQuery struct {
+	images  []string
+	opts    processor.SpriteOptions
+	format  string
+	quality int
+}
+
+// SpriteMap is the coordinate map answered by /img/_sprite.json
+type SpriteMap struct {
+	Image   string                          `json:"image"`
+	Width   int                             `json:"width"`
+	Height  int                             `json:"height"`
+	Sprites map[string]processor.SpriteRect `json:"sprites"`
+}
+
+// handleSprite answers /img/_sprite and /img/_sprite.json. The images query
+// parameter lists the image paths to pack, named by their path without
+// extension; layout, cell, padding, format and quality control the sheet.
+// Sheets and maps are cached under a key of the inputs' versions and the
+// layout, so editing an input renders a new sheet.
+func (h *ImageHandler) handleSprite(c *gin.Context, wantMap bool) {
+	query, err := parseSpriteQuery(c.Request.URL.Query())
+	if err != nil {
+		spriteError(c, http.StatusBadRequest, err.Error(), "INVALID_REQUEST")
+		return
+	}
+
+	paths := make([]string, len(query.images))
+	key := sha256.New()
+	fmt.Fprintf(key, "%s|%d|%d|%s|%d", query.opts.Layout, query.opts.Cell, query.opts.Padding, query.format, query.quality)
+	for i, name := range query.images {
+		result, err := h.resolver.Resolve(name)
+		if err != nil || result.IsFallback {
+			spriteError(c, http.StatusNotFound, fmt.Sprintf("%v: %s", errSpriteMissing, name), "NOT_FOUND")
+			return
+		}
+		if !h.allowed(result) {
+			spriteError(c, http.StatusForbidden, fmt.Sprintf("%v: %s", errAccessDenied, name), "FORBIDDEN")
+			return
+		}
+		info, err := h.files.Stat(result.ResolvedPath)
+		if err != nil {
+			spriteError(c, http.StatusNotFound, fmt.Sprintf("%v: %s", errSpriteMissing, name), "NOT_FOUND")
+			return
+		}
+		paths[i] = result.ResolvedPath
+		fmt.Fprintf(key, "|%s@%s", name, sourceVersion{size: info.Size(), modTime: info.ModTime()})
+	}
+	cacheKey := spriteCacheDir + "/" + hex.EncodeToString(key.Sum(nil))
+	sheetParams := cache.ProcessingParams{Format: query.format, Quality: query.quality}
+	mapParams := cache.ProcessingParams{Format: "json"}
+
+	sheet, sheetFound, _ := h.cache.Retrieve(cacheKey, sheetParams)
+	mapData, mapFound, _ := h.cache.Retrieve(cacheKey, mapParams)
+	cacheStatus := cacheHit
+	if !sheetFound || !mapFound {
+		cacheStatus = cacheMiss
+		sheet, mapData, err = h.renderSprite(query, paths)
+		if err != nil {
+			if errors.Is(err, processor.ErrSpriteTooLarge) {
+				spriteError(c, http.StatusBadRequest, err.Error(), "INVALID_REQUEST")
+			} else {
+				spriteError(c, http.StatusUnprocessableEntity, err.Error(), "INVALID_IMAGE")
+			}
+			return
+		}
+		for _, entry := range []struct {
+			params cache.ProcessingParams
+			data   []byte
+		}{{sheetParams, sheet}, {mapParams, mapData}} {
+			if err := h.cache.Store(cacheKey, entry.params, entry.data); err != nil {
+				log.Printf("Warning: failed to cache spritesheet: %v", err)
+			}
+		}
+	}
+	c.Header("X-Cache", cacheStatus)
+
+	if !wantMap {
+		h.serveImageData(c, sheet, query.format)
+		return
+	}
+
+	var spriteMap SpriteMap
+	if err := json.Unmarshal(mapData, &spriteMap); err != nil {
+		spriteError(c, http.StatusInternalServerError, "failed to read sprite map", "SPRITE_FAILED")
+		return
+	}
+	sheetURL := *c.Request.URL
+	sheetURL.Path = strings.TrimSuffix(sheetURL.Path, SpriteMapSegment) + SpriteSegment
+	sheetURL.RawPath = ""
+	spriteMap.Image = sheetURL.RequestURI()
+	c.JSON(http.StatusOK, spriteMap)
+}
+
+// renderSprite decodes and packs the images at paths, returning the encoded
+// sheet and its JSON coordinate map
+func (h *ImageHandler) renderSprite(query *spriteQuery, paths []string) ([]byte, []byte, error) {
+	sprites := make([]processor.Sprite, len(paths))
+	for i, resolved := range paths {
+		data, _, err := readSource(h.files, resolved)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", errReadImage, err)
+		}
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %s", processor.ErrInvalidImage, query.images[i])
+		}
+		sprites[i] = processor.Sprite{Name: spriteName(query.images[i]), Image: img}
+	}
+
+	packed, coords, err := processor.PackSprites(sprites, query.opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, packed); err != nil {
+		return nil, nil, err
+	}
+	sheet := buf.Bytes()
+	width, height := packed.Bounds().Dx(), packed.Bounds().Dy()
+	if query.format != "png" {
+		sheet, err = h.processor.Process(sheet, processor.ProcessOptions{
+			Width:   width,
+			Height:  height,
+			Format:  processor.ImageFormat(query.format),
+			Quality: query.quality,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	mapData, err := json.Marshal(SpriteMap{Width: width, Height: height, Sprites: coords})
+	if err != nil {
+		return nil, nil, err
+	}
+	return sheet, mapData, nil
+}
+
+// spriteName names a sprite by its image path without the extension
+func spriteName(imagePath string) string {
+	return strings.TrimSuffix(imagePath, path.Ext(imagePath))
+}
+
+// parseSpriteQuery reads and checks the sprite query parameters
+func parseSpriteQuery(values url.Values) (*spriteQuery, error) {
+	query := &spriteQuery{
+		images: splitSpriteList(values["images"]),
+		opts: processor.SpriteOptions{
+			Layout: values.Get("layout"),
+			Cell:   defaultSpriteCell,
+		},
+		format:  "png",
+		quality: processor.DefaultQuality,
+	}
+	if len(query.images) == 0 || len(query.images) > maxSprites {
+		return nil, fmt.Errorf("images must list 1 to %d image paths", maxSprites)
+	}
+	names := make(map[string]bool, len(query.images))
+	for _, name := range query.images {
+		if names[spriteName(name)] {
+			return nil, fmt.Errorf("duplicate sprite name %q", spriteName(name))
+		}
+		names[spriteName(name)] = true
+	}
+
+	switch query.opts.Layout {
+	case "":
+		query.opts.Layout = processor.SpriteLayoutGrid
+	case processor.SpriteLayoutGrid, processor.SpriteLayoutPack:
+	default:
+		return nil, fmt.Errorf("invalid layout %q: must be grid or pack", query.opts.Layout)
+	}
+	if value := values.Get("cell"); value != "" {
+		cell, err := strconv.Atoi(value)
+		if err != nil || cell < 1 || cell > maxSpriteCell {
+			return nil, fmt.Errorf("invalid cell %q: must be between 1 and %d", value, maxSpriteCell)
+		}
+		query.opts.Cell = cell
+	}
+	if query.opts.Layout == processor.SpriteLayoutPack {
+		query.opts.Cell = 0
+	}
+	if value := values.Get("padding"); value != "" {
+		padding, err := strconv.Atoi(value)
+		if err != nil || padding < 0 || padding > maxSpritePadding {
+			return nil, fmt.Errorf("invalid padding %q: must be between 0 and %d", value, maxSpritePadding)
+		}
+		query.opts.Padding = padding
+	}
+	if value := values.Get("format"); value != "" {
+		if !validFormats[value] || value == pdfFormat {
+			return nil, fmt.Errorf("invalid format %q: must be png, webp or jpeg", value)
+		}
+		query.format = value
+	}
+	if value := values.Get("quality"); value != "" {
+		quality, err := strconv.Atoi(value)
+		if err != nil || quality < processor.MinQuality || quality > processor.MaxQuality {
+			return nil, fmt.Errorf("invalid quality %q: must be between %d and %d", value, processor.MinQuality, processor.MaxQuality)
+		}
+		query.quality = quality
+	}
+	return query, nil
+}
+
+// splitSpriteList splits repeated or comma-separated images parameters
+func splitSpriteList(values []string) []string {
+	var images []string
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.Trim(strings.TrimSpace(name), "/"); name != "" {
+				images = append(images, name)
+			}
+		}
+	}
+	return images
+}
+
+// spriteError writes a sprite endpoint error response
+func spriteError(c *gin.Context, status int, message, code string) {
+	c.JSON(status, gin.H{
+		"success": false,
+		"error":   message,
+		"code":    code,
+	})
+}
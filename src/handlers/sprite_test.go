@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"goimgserver/config"
+	"goimgserver/processor"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestPNG writes a w x h PNG filled with c
+func writeTestPNG(t *testing.T, path string, w, h int, c color.Color) {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+}
+
+// setupSpriteRouter creates a test router with a directory of three icons
+func setupSpriteRouter(t *testing.T) *gin.Engine {
+	router, _, _ := setupTestRouter(t, func(cfg *config.Config) {
+		writeTestPNG(t, filepath.Join(cfg.ImagesDir, "icons", "home.png"), 40, 40, color.NRGBA{255, 0, 0, 255})
+		writeTestPNG(t, filepath.Join(cfg.ImagesDir, "icons", "search.png"), 80, 40, color.NRGBA{0, 255, 0, 255})
+		writeTestPNG(t, filepath.Join(cfg.ImagesDir, "icons", "menu.png"), 20, 60, color.NRGBA{0, 0, 255, 255})
+	})
+	return router
+}
+
+func TestImageHandler_Sprite_MapMatchesSheet(t *testing.T) {
+	router := setupSpriteRouter(t)
+	query := "?images=icons/home.png,icons/search.png,icons/menu.png&cell=32&padding=2"
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/_sprite.json"+query, nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var spriteMap SpriteMap
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &spriteMap))
+	assert.Equal(t, "/img/_sprite"+query, spriteMap.Image)
+	assert.Equal(t, 66, spriteMap.Width)
+	assert.Equal(t, 66, spriteMap.Height)
+	assert.Equal(t, map[string]processor.SpriteRect{
+		"icons/home":   {X: 0, Y: 0, W: 32, H: 32},
+		"icons/search": {X: 34, Y: 8, W: 32, H: 16},
+		"icons/menu":   {X: 10, Y: 34, W: 11, H: 32},
+	}, spriteMap.Sprites)
+
+	// The sheet has the map's dimensions and each sprite at its coordinates
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", spriteMap.Image, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Equal(t, cacheHit, w.Header().Get("X-Cache"))
+
+	sheet, err := png.Decode(bytes.NewReader(w.Body.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, spriteMap.Width, spriteMap.Height), sheet.Bounds())
+	colors := map[string]color.NRGBA{
+		"icons/home":   {255, 0, 0, 255},
+		"icons/search": {0, 255, 0, 255},
+		"icons/menu":   {0, 0, 255, 255},
+	}
+	for name, r := range spriteMap.Sprites {
+		got := color.NRGBAModel.Convert(sheet.At(r.X+r.W/2, r.Y+r.H/2))
+		assert.Equal(t, colors[name], got, name)
+	}
+}
+
+func TestImageHandler_Sprite_PackLayout(t *testing.T) {
+	router := setupSpriteRouter(t)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/_sprite.json?images=icons/home.png&images=icons/search.png&layout=pack", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var spriteMap SpriteMap
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &spriteMap))
+	// Packed sprites keep their own size
+	assert.Equal(t, processor.SpriteRect{X: 0, Y: 0, W: 40, H: 40}, spriteMap.Sprites["icons/home"])
+	assert.Equal(t, 40, spriteMap.Sprites["icons/search"].H)
+	assert.Equal(t, 80, spriteMap.Sprites["icons/search"].W)
+}
+
+func TestImageHandler_Sprite_Errors(t *testing.T) {
+	router := setupSpriteRouter(t)
+
+	tests := map[string]int{
+		"/img/_sprite": http.StatusBadRequest,
+		"/img/_sprite?images=icons/home.png&layout=spiral":          http.StatusBadRequest,
+		"/img/_sprite?images=icons/home.png&cell=0":                 http.StatusBadRequest,
+		"/img/_sprite?images=icons/home.png,icons/home.jpg":         http.StatusBadRequest,
+		"/img/_sprite?images=icons/missing.png":                     http.StatusNotFound,
+		"/img/_sprite.json?images=icons/home.png,icons/missing.png": http.StatusNotFound,
+	}
+	for url, status := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		assert.Equal(t, status, w.Code, url)
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"errors"
+	"goimgserver/cache"
+	"goimgserver/security"
+	"io"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamOriginal answers a request for a pass-through original of at least
+// StreamOriginalsOver bytes straight from the source file, so the file is
+// never held in memory whole. Streamed originals are not cached; the cache
+// would only hold a second copy of the file. It reports whether the request
+// was answered: smaller originals, renditions and sources whose magic number
+// does not match the format served are read and rendered as usual.
+func (h *ImageHandler) streamOriginal(c *gin.Context, path string, params cache.ProcessingParams, timer *requestTimer) bool {
+	if h.config.StreamOriginalsOver <= 0 || (params.Format != gifFormat && !params.Original) {
+		return false
+	}
+	file, err := h.files.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	source, ok := file.(io.ReaderAt)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	if err != nil || info.Size() < h.config.StreamOriginalsOver {
+		return false
+	}
+
+	// Only the header is checked, the image is not decoded
+	header := make([]byte, sniffLength)
+	n, err := source.ReadAt(header, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false
+	}
+	if format, err := security.ValidateFileType(header[:n]); err != nil || !sameFormat(format, params.Format) {
+		return false
+	}
+
+	// The response is bounded by the size at open and ends short of its
+	// Content-Length, which makes clients discard it, once the file is
+	// rewritten while it is sent
+	c.Header("X-Served-Original", "true")
+	c.Set(originalKey, true)
+	c.Header("Server-Timing", timer.serverTiming())
+	c.Header("X-Cache", cacheBypass)
+	checked := &checkedSource{ReaderAt: source, files: h.files, path: path, opened: info}
+	h.serveImageContent(c, io.NewSectionReader(checked, 0, info.Size()), params.Format)
+	return true
+}
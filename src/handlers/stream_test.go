@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"bytes"
+	"goimgserver/cache"
+	"goimgserver/config"
+	"goimgserver/resolver"
+	"goimgserver/storage"
+	"io/fs"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingFS opens files from the OS file system that count the bytes read
+// from them and the largest single read
+type countingFS struct {
+	storage.FS
+
+	mu      sync.Mutex
+	read    int64
+	largest int
+}
+
+func (c *countingFS) Open(path string) (fs.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &countingFile{File: f, fs: c}, nil
+}
+
+func (c *countingFS) count(n, requested int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.read += int64(n)
+	c.largest = max(c.largest, requested)
+}
+
+func (c *countingFS) reads() (int64, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.read, c.largest
+}
+
+// countingFile is an open file counting its reads into fs
+type countingFile struct {
+	*os.File
+	fs *countingFS
+}
+
+func (f *countingFile) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.fs.count(n, len(p))
+	return n, err
+}
+
+func (f *countingFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.File.ReadAt(p, off)
+	f.fs.count(n, len(p))
+	return n, err
+}
+
+// largeSource returns size bytes starting with header and filled with
+// random data, so any misplaced byte shows in the response
+func largeSource(header string, size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(data)
+	copy(data, header)
+	return data
+}
+
+// TestImageHandler_GET_StreamOriginals tests that large pass-through
+// originals are sent from the source file in small reads without being
+// cached, in full and in ranges
+func TestImageHandler_GET_StreamOriginals(t *testing.T) {
+	const size = 4 << 20
+	const maxRead = 64 << 10
+
+	tests := []struct {
+		name string
+		file string
+		data []byte
+	}{
+		{"GIF passthrough", "large.gif", largeSource("GIF89a", size)},
+		{"Sidecar original", "large.jpg", largeSource("\xff\xd8\xff\xe0", size)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+			cfg.AnimatedGIF = config.AnimatedGIFPassthrough
+			cfg.Sidecars = true
+			cfg.StreamOriginalsOver = 1 << 20
+			require.NoError(t, os.WriteFile(filepath.Join(imagesDir, tt.file), tt.data, 0644))
+			require.NoError(t, os.WriteFile(filepath.Join(imagesDir, "large.jpg.json"), []byte(`{"transcode": false}`), 0644))
+
+			cacheManager, err := cache.NewManager(cacheDir)
+			require.NoError(t, err)
+			handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, &mockProcessor{})
+			files := &countingFS{FS: storage.OS}
+			handler.files = files
+			router := gin.New()
+			router.GET("/img/*path", handler.ServeImage)
+
+			for attempt := 0; attempt < 2; attempt++ {
+				// Act
+				files.read, files.largest = 0, 0
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest("GET", "/img/"+tt.file, nil))
+
+				// Assert
+				require.Equal(t, http.StatusOK, w.Code)
+				assert.True(t, bytes.Equal(tt.data, w.Body.Bytes()), "streamed bytes differ from the source")
+				assert.Equal(t, "true", w.Header().Get("X-Served-Original"))
+				assert.Equal(t, cacheBypass, w.Header().Get("X-Cache"))
+				read, largest := files.reads()
+				assert.LessOrEqual(t, read, int64(size+4096), "source read more than once")
+				assert.LessOrEqual(t, largest, maxRead, "source read in one large buffer")
+			}
+
+			// Ranges are read from the file too
+			req := httptest.NewRequest("GET", "/img/"+tt.file, nil)
+			req.Header.Set("Range", "bytes=1000-1999")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusPartialContent, w.Code)
+			assert.Equal(t, tt.data[1000:2000], w.Body.Bytes())
+		})
+	}
+}
+
+// TestImageHandler_GET_StreamOriginals_Buffered tests that small originals,
+// originals with streaming off and renditions are read whole and cached
+func TestImageHandler_GET_StreamOriginals_Buffered(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int64
+		size      int
+		url       string
+	}{
+		{"Below threshold", 1 << 20, 512 << 10, "/img/large.gif"},
+		{"Streaming off", 0, 2 << 20, "/img/large.gif"},
+		{"Rendition", 1 << 20, 2 << 20, "/img/large.gif/png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			router, handler, proc := setupTestRouter(t, func(cfg *config.Config) {
+				cfg.AnimatedGIF = config.AnimatedGIFPassthrough
+				cfg.StreamOriginalsOver = tt.threshold
+				require.NoError(t, os.WriteFile(filepath.Join(cfg.ImagesDir, "large.gif"), largeSource("GIF89a", tt.size), 0644))
+			})
+			proc.render = true
+			files := &countingFS{FS: storage.OS}
+			handler.files = files
+
+			// Act
+			first := httptest.NewRecorder()
+			router.ServeHTTP(first, httptest.NewRequest("GET", tt.url, nil))
+			second := httptest.NewRecorder()
+			router.ServeHTTP(second, httptest.NewRequest("GET", tt.url, nil))
+
+			// Assert
+			require.Equal(t, http.StatusOK, first.Code)
+			assert.Equal(t, cacheMiss, first.Header().Get("X-Cache"))
+			assert.Equal(t, cacheHit, second.Header().Get("X-Cache"))
+			read, _ := files.reads()
+			assert.GreaterOrEqual(t, read, int64(tt.size), "source not read whole")
+		})
+	}
+}
+
+// rewritingFile is an open file that rewrites itself in place with other
+// bytes of the same size once it is read past the middle, like a git pull
+// rewriting a checked out file
+type rewritingFile struct {
+	*os.File
+	rewritten bool
+}
+
+func (f *rewritingFile) ReadAt(p []byte, off int64) (int, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if !f.rewritten && off > info.Size()/2 {
+		f.rewritten = true
+		data := largeSource("GIF89a", int(info.Size()))
+		data[len(data)-1]++
+		if err := os.WriteFile(f.Name(), data, 0644); err != nil {
+			return 0, err
+		}
+		later := info.ModTime().Add(time.Second)
+		if err := os.Chtimes(f.Name(), later, later); err != nil {
+			return 0, err
+		}
+	}
+	return f.File.ReadAt(p, off)
+}
+
+// rewritingFS opens files that rewrite themselves while they are read
+type rewritingFS struct {
+	storage.FS
+}
+
+func (r rewritingFS) Open(path string) (fs.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &rewritingFile{File: f}, nil
+}
+
+// TestImageHandler_GET_StreamOriginals_Rewritten tests that a streamed
+// original rewritten in place while it is sent ends short of its
+// Content-Length instead of completing with bytes of both versions
+func TestImageHandler_GET_StreamOriginals_Rewritten(t *testing.T) {
+	// Arrange
+	const size = 4 << 20
+	router, handler, _ := setupTestRouter(t, func(cfg *config.Config) {
+		cfg.AnimatedGIF = config.AnimatedGIFPassthrough
+		cfg.StreamOriginalsOver = 1 << 20
+		require.NoError(t, os.WriteFile(filepath.Join(cfg.ImagesDir, "large.gif"), largeSource("GIF89a", size), 0644))
+	})
+	handler.files = rewritingFS{FS: storage.OS}
+
+	// Act
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/large.gif", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get("X-Served-Original"))
+	assert.Equal(t, strconv.Itoa(size), w.Header().Get("Content-Length"))
+	assert.Less(t, w.Body.Len(), size, "the response should end short")
+}
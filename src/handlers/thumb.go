@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"fmt"
+	"goimgserver/cache"
+	"goimgserver/processor"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultThumbSize is the width and height of /thumb thumbnails when
+// ThumbSize is not configured
+const DefaultThumbSize = 150
+
+// ServeThumbnail handles /thumb requests with a square thumbnail of the
+// image, scaled to cover the square and cropped around the center. It is
+// ThumbSize pixels wide unless a last numeric segment gives the size, e.g.
+// /thumb/cats/cat_white.jpg/300. Only the image path and the size are read;
+// the /img parameter grammar does not apply.
+func (h *ImageHandler) ServeThumbnail(c *gin.Context) {
+	requestPath := strings.Trim(c.Param("path"), "/")
+	if requestPath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid path"})
+		return
+	}
+	segments := strings.Split(requestPath, "/")
+
+	size := h.config.ThumbSize
+	if size == 0 {
+		size = DefaultThumbSize
+	}
+	if last := len(segments) - 1; last > 0 && isNumericSegment(segments[last]) {
+		value, err := strconv.Atoi(segments[last])
+		if err != nil || !isValidDimension(value) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid thumbnail size %q: must be between %d and %d", segments[last], MinDimension, MaxDimension)})
+			return
+		}
+		size = value
+		segments = segments[:last]
+	}
+	if _, paramSegments := h.parsePathAndParams(segments); len(paramSegments) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "thumbnail paths take an image path and an optional size only"})
+		return
+	}
+
+	segments = append(segments, fmt.Sprintf("%dx%d", size, size))
+	if h.config.MetricsLabel != "" {
+		h.routes.observe(h.routeLabel(segments, nil))
+	}
+	h.serveRendition(c, segments, processor.Caption{}, true)
+}
+
+// isNumericSegment reports whether segment consists of digits only
+func isNumericSegment(segment string) bool {
+	return segment != "" && strings.Trim(segment, "0123456789") == ""
+}
+
+// withCover renders params to cover their dimensions, as thumbnails are:
+// never padded and never the stored original
+func withCover(params cache.ProcessingParams) cache.ProcessingParams {
+	params.Cover = true
+	params.Pad = false
+	params.Original = false
+	return params
+}
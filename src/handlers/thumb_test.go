@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"bytes"
+	"goimgserver/config"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupThumbRouter creates a rendering test router with PNG output and wide
+// and tall sources next to the test images
+func setupThumbRouter(t *testing.T, configure func(*config.Config)) (*gin.Engine, *recordingProcessor) {
+	router, _, proc := setupTestRouter(t, func(cfg *config.Config) {
+		cfg.DefaultOutputFormat = "png"
+		require.NoError(t, createTestImage(filepath.Join(cfg.ImagesDir, "wide.jpg"), 400, 200))
+		require.NoError(t, createTestImage(filepath.Join(cfg.ImagesDir, "cats", "tall.jpg"), 120, 360))
+		if configure != nil {
+			configure(cfg)
+		}
+	})
+	proc.render = true
+	return router, proc
+}
+
+// decodedSize returns the dimensions of an image response
+func decodedSize(t *testing.T, w *httptest.ResponseRecorder) image.Point {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(w.Body.Bytes()))
+	require.NoError(t, err)
+	return image.Pt(cfg.Width, cfg.Height)
+}
+
+// TestImageHandler_GET_Thumbnail tests that non-square sources become
+// square, cover-cropped thumbnails at the default and overridden sizes
+func TestImageHandler_GET_Thumbnail(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		thumb    int // Configured ThumbSize
+		expected int
+	}{
+		{"Default size", "/thumb/wide.jpg", 0, DefaultThumbSize},
+		{"Configured size", "/thumb/wide.jpg", 200, 200},
+		{"Size segment", "/thumb/wide.jpg/300", 0, 300},
+		{"Size segment over configured", "/thumb/wide.jpg/64", 200, 64},
+		{"Tall in group", "/thumb/cats/tall.jpg", 0, DefaultThumbSize},
+		{"Tall in group with size", "/thumb/cats/tall.jpg/90", 0, 90},
+		{"Without extension", "/thumb/cats/tall/90", 0, 90},
+		{"Trailing slash", "/thumb/wide.jpg/300/", 0, 300},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			router, proc := setupThumbRouter(t, func(cfg *config.Config) { cfg.ThumbSize = tt.thumb })
+
+			// Act
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+			// Assert
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			assert.Equal(t, image.Pt(tt.expected, tt.expected), decodedSize(t, w))
+			require.Len(t, proc.calls, 1)
+			assert.True(t, proc.calls[0].Cover)
+			assert.False(t, proc.calls[0].Pad)
+		})
+	}
+}
+
+// TestImageHandler_GET_Thumbnail_Cache tests that thumbnails are cached per
+// size and apart from /img renditions of the same dimensions
+func TestImageHandler_GET_Thumbnail_Cache(t *testing.T) {
+	// Arrange
+	router, proc := setupThumbRouter(t, nil)
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		require.Equal(t, http.StatusOK, w.Code, url)
+		return w
+	}
+
+	// Act & Assert
+	assert.Equal(t, cacheMiss, get("/thumb/wide.jpg").Header().Get("X-Cache"))
+	assert.Equal(t, cacheHit, get("/thumb/wide.jpg").Header().Get("X-Cache"))
+	assert.Equal(t, cacheHit, get("/thumb/wide.jpg/150").Header().Get("X-Cache"))
+	assert.Equal(t, cacheMiss, get("/thumb/wide.jpg/300").Header().Get("X-Cache"))
+
+	// /img fits the source inside the box instead
+	img := get("/img/wide.jpg/150x150/png")
+	assert.Equal(t, cacheMiss, img.Header().Get("X-Cache"))
+	assert.Equal(t, image.Pt(150, 75), decodedSize(t, img))
+	assert.Len(t, proc.calls, 3)
+}
+
+// TestImageHandler_GET_Thumbnail_Grammar tests that /thumb ignores the /img
+// query parameters and passthrough, and rejects other parameter segments
+func TestImageHandler_GET_Thumbnail_Grammar(t *testing.T) {
+	// Arrange
+	router, proc := setupThumbRouter(t, func(cfg *config.Config) {
+		cfg.AnimatedGIF = config.AnimatedGIFPassthrough
+		require.NoError(t, createTestGIF(filepath.Join(cfg.ImagesDir, "anim.gif")))
+	})
+
+	// Act - query parameters are not read, GIFs are not passed through
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/thumb/wide.jpg?width=500&format=jpeg", nil))
+	gif := httptest.NewRecorder()
+	router.ServeHTTP(gif, httptest.NewRequest("GET", "/thumb/anim.gif", nil))
+
+	// Assert
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, image.Pt(DefaultThumbSize, DefaultThumbSize), decodedSize(t, w))
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	require.Equal(t, http.StatusOK, gif.Code)
+	assert.Empty(t, gif.Header().Get("X-Served-Original"))
+	assert.Equal(t, image.Pt(DefaultThumbSize, DefaultThumbSize), decodedSize(t, gif))
+	assert.Len(t, proc.calls, 2)
+
+	for _, url := range []string{
+		"/thumb/wide.jpg/300x200",
+		"/thumb/wide.jpg/jpeg",
+		"/thumb/wide.jpg/300/jpeg",
+		"/thumb/wide.jpg/5",
+		"/thumb/wide.jpg/4001",
+		"/thumb/",
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, url)
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"fmt"
+	"goimgserver/cache"
+	"log"
+	"strings"
+	"time"
+)
+
+// timingPhase is one measured phase of an image request
+type timingPhase struct {
+	name     string
+	duration time.Duration
+}
+
+// requestTimer records the duration of each phase of an image request.
+// It feeds both the Server-Timing header and the slow request log.
+type requestTimer struct {
+	start  time.Time
+	last   time.Time
+	phases []timingPhase
+}
+
+// newRequestTimer starts timing a request
+func newRequestTimer() *requestTimer {
+	now := time.Now()
+	return &requestTimer{start: now, last: now}
+}
+
+// mark records the time since the previous mark as the named phase
+func (t *requestTimer) mark(name string) time.Duration {
+	now := time.Now()
+	d := now.Sub(t.last)
+	t.last = now
+	t.phases = append(t.phases, timingPhase{name: name, duration: d})
+	return d
+}
+
+// phase returns the duration recorded for name, or 0 if it was not reached
+func (t *requestTimer) phase(name string) time.Duration {
+	for _, p := range t.phases {
+		if p.name == name {
+			return p.duration
+		}
+	}
+	return 0
+}
+
+// serverTiming formats the phases and the total as a Server-Timing header
+func (t *requestTimer) serverTiming() string {
+	parts := make([]string, 0, len(t.phases)+1)
+	for _, p := range t.phases {
+		parts = append(parts, formatTiming(p.name, p.duration))
+	}
+	parts = append(parts, formatTiming("total", time.Since(t.start)))
+	return strings.Join(parts, ", ")
+}
+
+// formatTiming formats one Server-Timing metric in milliseconds
+func formatTiming(name string, d time.Duration) string {
+	return fmt.Sprintf("%s;dur=%.1f", name, float64(d.Microseconds())/1000)
+}
+
+// logSlowProcessing warns when processing took longer than the configured threshold
+func (h *ImageHandler) logSlowProcessing(resolvedPath string, params cache.ProcessingParams, d time.Duration) {
+	threshold := h.config.SlowRequestThreshold
+	if threshold <= 0 || d <= threshold {
+		return
+	}
+	log.Printf("Warning: slow image processing: path=%s params=%dx%d/%s/q%d auto=%t chroma=%s duration=%v threshold=%v",
+		resolvedPath, params.Width, params.Height, params.Format, params.Quality, params.AutoQuality, params.ChromaSubsampling, d, threshold)
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bytes"
+	"goimgserver/cache"
+	"goimgserver/processor"
+	"goimgserver/resolver"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowProcessor delays every Process call
+type slowProcessor struct {
+	mockProcessor
+	delay time.Duration
+}
+
+func (p *slowProcessor) Process(data []byte, opts processor.ProcessOptions) ([]byte, error) {
+	time.Sleep(p.delay)
+	return data, nil
+}
+
+// captureLog redirects the standard logger for the duration of a test
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+// TestRequestTimer_ServerTiming tests phase recording and header formatting
+func TestRequestTimer_ServerTiming(t *testing.T) {
+	// Arrange
+	timer := newRequestTimer()
+
+	// Act
+	timer.mark("resolve")
+	time.Sleep(5 * time.Millisecond)
+	d := timer.mark("process")
+	header := timer.serverTiming()
+
+	// Assert
+	assert.GreaterOrEqual(t, d, 5*time.Millisecond)
+	assert.Equal(t, d, timer.phase("process"))
+	assert.Equal(t, time.Duration(0), timer.phase("cache"))
+	assert.Regexp(t, `^resolve;dur=\d+\.\d, process;dur=\d+\.\d, total;dur=\d+\.\d$`, header)
+}
+
+// TestImageHandler_GET_SlowProcessingLog tests the slow processing warning threshold
+func TestImageHandler_GET_SlowProcessingLog(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		delay     time.Duration
+		expectLog bool
+	}{
+		{"Above threshold", 10 * time.Millisecond, 50 * time.Millisecond, true},
+		{"Below threshold", time.Second, 0, false},
+		{"Disabled", 0, 50 * time.Millisecond, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			gin.SetMode(gin.TestMode)
+			imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+			cfg.SlowRequestThreshold = tt.threshold
+
+			cacheManager, err := cache.NewManager(cacheDir)
+			require.NoError(t, err)
+			handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, &slowProcessor{delay: tt.delay})
+
+			router := gin.New()
+			router.GET("/img/*path", handler.ServeImage)
+			logs := captureLog(t)
+
+			// Act
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg/300x200/jpeg", nil))
+
+			// Assert
+			assert.Equal(t, http.StatusOK, w.Code)
+			if tt.expectLog {
+				assert.Contains(t, logs.String(), "slow image processing")
+				assert.Contains(t, logs.String(), "test.jpg")
+				assert.Contains(t, logs.String(), "300x200/jpeg")
+			} else {
+				assert.NotContains(t, logs.String(), "slow image processing")
+			}
+		})
+	}
+}
+
+// TestImageHandler_GET_ServerTimingHeader tests Server-Timing on processed and cached responses
+func TestImageHandler_GET_ServerTimingHeader(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, &mockProcessor{})
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+
+	// Act - processed
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg/300x200/jpeg", nil))
+	processed := w.Header().Get("Server-Timing")
+
+	// Act - cached
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg/300x200/jpeg", nil))
+	cached := w.Header().Get("Server-Timing")
+
+	// Assert
+	assert.Contains(t, processed, "resolve;dur=")
+	assert.Contains(t, processed, "process;dur=")
+	assert.Contains(t, processed, "total;dur=")
+	assert.Contains(t, cached, "cache;dur=")
+	assert.False(t, strings.Contains(cached, "process;dur="))
+}
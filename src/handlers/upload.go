@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goimgserver/resolver"
+	"goimgserver/security"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errUploadPath is returned for upload paths that are not plain image paths
+var errUploadPath = errors.New("upload path must be a relative image path ending in .jpg, .jpeg, .png or .webp")
+
+// errUploadExists is returned when an upload would replace an image and
+// overwriting is disabled
+var errUploadExists = errors.New("image already exists")
+
+// UploadResult describes an image stored by an upload
+type UploadResult struct {
+	Path     string   `json:"path"`
+	Format   string   `json:"format"`
+	Width    int      `json:"width"`
+	Height   int      `json:"height"`
+	Bytes    int      `json:"bytes"`
+	Replaced bool     `json:"replaced"`
+	Warmed   []string `json:"warmed,omitempty"`
+}
+
+// HandlePost handles POST /img/*path: the _diff and _validate endpoints,
+// and uploads for every other path
+func (h *ImageHandler) HandlePost(c *gin.Context) {
+	switch c.Param("path") {
+	case "/_diff":
+		h.HandleDiff(c)
+	case "/_validate":
+		h.HandleValidate(c)
+	default:
+		h.HandleUpload(c)
+	}
+}
+
+// HandleUpload stores the "upload" file of a multipart form at the request
+// path in the images directory. The file must be a JPEG, PNG or WebP image
+// matching the path's extension and within the size and pixel limits. It
+// is written atomically and the UploadWarm presets are rendered afterwards.
+func (h *ImageHandler) HandleUpload(c *gin.Context) {
+	if !h.config.EnableUploads {
+		uploadError(c, http.StatusNotFound, "uploads are disabled", "NOT_FOUND")
+		return
+	}
+
+	path := strings.TrimPrefix(c.Param("path"), "/")
+	if err := validateUploadPath(path); err != nil {
+		uploadError(c, http.StatusBadRequest, err.Error(), "INVALID_PATH")
+		return
+	}
+	if !h.acl.Allowed(path) {
+		uploadError(c, http.StatusForbidden, errAccessDenied.Error(), "FORBIDDEN")
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, security.MaxFileSize+maxMultipartOverhead)
+	file, err := c.FormFile("upload")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			uploadError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("%v: upload exceeds %d bytes", security.ErrFileTooLarge, security.MaxFileSize), "FILE_TOO_LARGE")
+			return
+		}
+		uploadError(c, http.StatusBadRequest, "request must include an upload file", "INVALID_REQUEST")
+		return
+	}
+	f, err := file.Open()
+	var data []byte
+	if err == nil {
+		data, err = io.ReadAll(f)
+		f.Close()
+	}
+	if err != nil {
+		uploadError(c, http.StatusBadRequest, "failed to read uploaded image", "INVALID_REQUEST")
+		return
+	}
+
+	// The magic number decides the type, whatever the client claims
+	format, err := security.ValidateFileType(data)
+	if err != nil || format == gifFormat {
+		uploadError(c, http.StatusUnsupportedMediaType, "upload is not a JPEG, PNG or WebP image", "UNSUPPORTED_FORMAT")
+		return
+	}
+	if ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")); !sameFormat(format, ext) {
+		uploadError(c, http.StatusBadRequest, fmt.Sprintf("upload is %s but the path ends in .%s", format, ext), "INVALID_REQUEST")
+		return
+	}
+	validation := h.Validate(data)
+	if !validation.Valid {
+		uploadError(c, http.StatusUnprocessableEntity, validation.Reason, "INVALID_IMAGE")
+		return
+	}
+
+	replaced, err := h.storeUpload(path, data)
+	if errors.Is(err, errUploadExists) {
+		uploadError(c, http.StatusConflict, fmt.Sprintf("%v: %s", err, path), "CONFLICT")
+		return
+	}
+	if err != nil {
+		log.Printf("Error: storing upload %s failed: %v", path, err)
+		uploadError(c, http.StatusInternalServerError, "failed to store image", "UPLOAD_FAILED")
+		return
+	}
+
+	c.JSON(http.StatusCreated, UploadResult{
+		Path:     path,
+		Format:   format,
+		Width:    validation.Width,
+		Height:   validation.Height,
+		Bytes:    len(data),
+		Replaced: replaced,
+		Warmed:   h.warmUpload(c.Request.Context(), path),
+	})
+}
+
+// validateUploadPath checks that path is a clean relative image path.
+// Hidden segments such as .git and reserved ones starting with "_" are
+// rejected.
+func validateUploadPath(path string) error {
+	if err := security.ValidatePath(path); err != nil {
+		return err
+	}
+	if filepath.ToSlash(filepath.Clean(path)) != path {
+		return errUploadPath
+	}
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, ".") || strings.HasPrefix(segment, "_") {
+			return errUploadPath
+		}
+	}
+	if err := security.ValidateFileExtension(path); err != nil {
+		return errUploadPath
+	}
+	return nil
+}
+
+// storeUpload writes data to path under the images directory through a
+// temporary file, so readers never see a partial image. It reports whether
+// an existing image was replaced.
+func (h *ImageHandler) storeUpload(path string, data []byte) (bool, error) {
+	target := filepath.Join(h.config.ImagesDir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return false, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return false, err
+	}
+
+	replaced := false
+	if h.config.UploadOverwrite {
+		_, statErr := os.Stat(target)
+		replaced = statErr == nil
+		err = os.Rename(tmp.Name(), target)
+	} else {
+		// Linking fails if the target exists, even when it is created concurrently
+		err = os.Link(tmp.Name(), target)
+		if errors.Is(err, fs.ErrExist) {
+			err = errUploadExists
+		}
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// Renditions of a replaced image, in every namespace, and fallbacks
+	// for a new one are stale
+	if replaced {
+		if err := h.cache.ClearAllNamespaces(target); err != nil {
+			log.Printf("Warning: failed to clear cache for %s: %v", path, err)
+		}
+	}
+	if caching, ok := h.resolver.(resolver.CachingResolver); ok {
+		caching.ClearCache()
+	}
+	return replaced, nil
+}
+
+// warmUpload renders the UploadWarm presets for an uploaded image and
+// returns the URLs that were warmed. Failures are logged, the upload stands.
+func (h *ImageHandler) warmUpload(ctx context.Context, path string) []string {
+	var warmed []string
+	for _, preset := range h.config.UploadWarm {
+		url := "/img/" + path + "/" + strings.Trim(preset, "/")
+		if _, err := h.WarmContext(ctx, url); err != nil {
+			log.Printf("Warning: warming %s after upload failed: %v", url, err)
+			continue
+		}
+		warmed = append(warmed, url)
+	}
+	return warmed
+}
+
+// uploadError writes an upload endpoint error response
+func uploadError(c *gin.Context, status int, message, code string) {
+	c.JSON(status, gin.H{
+		"success": false,
+		"error":   message,
+		"code":    code,
+	})
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"goimgserver/cache"
+	"goimgserver/config"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withUploads enables uploads
+func withUploads(cfg *config.Config) {
+	cfg.EnableUploads = true
+}
+
+// postUpload uploads data as the "upload" file of a multipart form
+func postUpload(t *testing.T, router *gin.Engine, path string, data []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("upload", filepath.Base(path))
+	require.NoError(t, err)
+	_, err = part.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+
+	req := httptest.NewRequest("POST", path, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// readTestImage returns the bytes of the 100x100 test image
+func readTestImage(t *testing.T, imagesDir string) []byte {
+	data, err := os.ReadFile(filepath.Join(imagesDir, "test.jpg"))
+	require.NoError(t, err)
+	return data
+}
+
+// TestUpload_ValidImage tests that a valid upload lands in the images directory and is served
+func TestUpload_ValidImage(t *testing.T) {
+	// Arrange
+	router, handler, _ := setupTestRouter(t, withUploads)
+	imagesDir := handler.config.ImagesDir
+	handler.config.UploadWarm = []string{"50x50/jpeg"}
+	data := readTestImage(t, imagesDir)
+
+	// A miss first caches the fallback resolution
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/products/shoe.jpg", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// Act
+	w = postUpload(t, router, "/img/products/shoe.jpg", data)
+
+	// Assert
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var result UploadResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, UploadResult{
+		Path:   "products/shoe.jpg",
+		Format: "jpeg",
+		Width:  100,
+		Height: 100,
+		Bytes:  len(data),
+		Warmed: []string{"/img/products/shoe.jpg/50x50/jpeg"},
+	}, result)
+
+	stored, err := os.ReadFile(filepath.Join(imagesDir, "products", "shoe.jpg"))
+	require.NoError(t, err)
+	assert.Equal(t, data, stored)
+	leftovers, err := filepath.Glob(filepath.Join(imagesDir, "products", ".upload-*"))
+	require.NoError(t, err)
+	assert.Empty(t, leftovers, "temporary files should be removed")
+
+	resolved, err := handler.resolver.Resolve("products/shoe.jpg")
+	require.NoError(t, err)
+	assert.False(t, resolved.IsFallback, "uploaded image should replace the cached fallback")
+	assert.True(t, handler.cache.Exists(resolved.ResolvedPath, handler.applyDefaults(cache.ProcessingParams{Width: 50, Height: 50, Format: "jpeg", Quality: DefaultQuality})))
+}
+
+// TestUpload_Rejected tests that unsafe paths and non-image uploads are rejected and nothing is stored
+func TestUpload_Rejected(t *testing.T) {
+	jpeg := []byte{0xFF, 0xD8, 0xFF, 0xE0}
+	tests := []struct {
+		name   string
+		path   string
+		data   func(valid []byte) []byte
+		status int
+		code   string
+	}{
+		{"Executable", "/img/evil.jpg", func([]byte) []byte { return append([]byte("MZ\x90\x00\x03\x00\x00\x00"), make([]byte, 64)...) }, http.StatusUnsupportedMediaType, "UNSUPPORTED_FORMAT"},
+		{"Script", "/img/shell.jpg", func([]byte) []byte { return []byte("#!/bin/sh\nrm -rf /\n") }, http.StatusUnsupportedMediaType, "UNSUPPORTED_FORMAT"},
+		{"Executable extension", "/img/evil.exe", func(valid []byte) []byte { return valid }, http.StatusBadRequest, "INVALID_PATH"},
+		{"Double extension", "/img/evil.php.jpg", func(valid []byte) []byte { return valid }, http.StatusBadRequest, "INVALID_PATH"},
+		{"Traversal", "/img/../escape.jpg", func(valid []byte) []byte { return valid }, http.StatusBadRequest, "INVALID_PATH"},
+		{"Encoded traversal", "/img/a/%2e%2e/%2e%2e/escape.jpg", func(valid []byte) []byte { return valid }, http.StatusBadRequest, "INVALID_PATH"},
+		{"Hidden directory", "/img/.git/hooks.jpg", func(valid []byte) []byte { return valid }, http.StatusBadRequest, "INVALID_PATH"},
+		{"Reserved name", "/img/_placeholders/cats.jpg", func(valid []byte) []byte { return valid }, http.StatusBadRequest, "INVALID_PATH"},
+		{"Extension mismatch", "/img/photo.png", func(valid []byte) []byte { return valid }, http.StatusBadRequest, "INVALID_REQUEST"},
+		{"Corrupt image", "/img/broken.jpg", func([]byte) []byte { return append(jpeg, "not really"...) }, http.StatusUnprocessableEntity, "INVALID_IMAGE"},
+		{"Existing image", "/img/test.jpg", func(valid []byte) []byte { return valid }, http.StatusConflict, "CONFLICT"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			router, handler, _ := setupTestRouter(t, withUploads)
+			imagesDir := handler.config.ImagesDir
+			valid := readTestImage(t, imagesDir)
+			before, err := filepath.Glob(filepath.Join(imagesDir, "*"))
+			require.NoError(t, err)
+
+			// Act
+			w := postUpload(t, router, tt.path, tt.data(valid))
+
+			// Assert
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+			var response map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.code, response["code"])
+			after, err := filepath.Glob(filepath.Join(imagesDir, "*"))
+			require.NoError(t, err)
+			assert.Equal(t, before, after, "nothing should be written")
+			stored, err := os.ReadFile(filepath.Join(imagesDir, "test.jpg"))
+			require.NoError(t, err)
+			assert.Equal(t, valid, stored)
+		})
+	}
+}
+
+// TestUpload_Overwrite tests that replacing an image is allowed when configured
+// and clears its renditions in every cache namespace
+func TestUpload_Overwrite(t *testing.T) {
+	// Arrange
+	router, handler, _ := setupTestRouter(t, withUploads)
+	imagesDir := handler.config.ImagesDir
+	handler.config.UploadOverwrite = true
+	target := filepath.Join(imagesDir, "test.jpg")
+	params := cache.ProcessingParams{Width: 80, Height: 80, Format: "webp", Quality: DefaultQuality}
+	require.NoError(t, handler.cache.Store(target, params, []byte("stale rendition")))
+	namespaced := cache.NamespacedPath("acme", target)
+	require.NoError(t, handler.cache.Store(namespaced, params, []byte("stale rendition")))
+
+	replacement := filepath.Join(t.TempDir(), "replacement.jpg")
+	require.NoError(t, createTestImage(replacement, 200, 150))
+	data, err := os.ReadFile(replacement)
+	require.NoError(t, err)
+
+	// Act
+	w := postUpload(t, router, "/img/test.jpg", data)
+
+	// Assert
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var result UploadResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.True(t, result.Replaced)
+	assert.Equal(t, 200, result.Width)
+	stored, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, data, stored)
+	assert.False(t, handler.cache.Exists(target, params), "renditions of the old image should be cleared")
+	assert.False(t, handler.cache.Exists(namespaced, params), "namespaced renditions of the old image should be cleared")
+}
+
+// TestUpload_Disabled tests that uploads are refused unless enabled while _validate keeps working
+func TestUpload_Disabled(t *testing.T) {
+	// Arrange
+	router, handler, _ := setupTestRouter(t, withUploads)
+	imagesDir := handler.config.ImagesDir
+	handler.config.EnableUploads = false
+	data := readTestImage(t, imagesDir)
+
+	// Act
+	upload := postUpload(t, router, "/img/new.jpg", data)
+	validate := postUpload(t, router, "/img/_validate", data)
+
+	// Assert
+	assert.Equal(t, http.StatusNotFound, upload.Code)
+	assert.NoFileExists(t, filepath.Join(imagesDir, "new.jpg"))
+	assert.Equal(t, http.StatusOK, validate.Code)
+	assert.Contains(t, validate.Body.String(), `"valid":true`)
+}
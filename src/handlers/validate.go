@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"goimgserver/processor"
+	"goimgserver/security"
+	"goimgserver/storage"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxMultipartOverhead allows for multipart headers around an upload
+const maxMultipartOverhead = 1 << 20
+
+// validateRequest is the JSON or form body accepted by the validate endpoint
+type validateRequest struct {
+	Path string `json:"path" form:"path"`
+}
+
+// ValidationResult reports whether an image is processable
+type ValidationResult struct {
+	Valid  bool   `json:"valid"`
+	Format string `json:"format"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// HandleValidate handles the /img/_validate endpoint. It checks an "upload"
+// file in a multipart form, or an image path, without serving or caching it.
+func (h *ImageHandler) HandleValidate(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, security.MaxFileSize+maxMultipartOverhead)
+
+	var data []byte
+	if file, err := c.FormFile("upload"); err == nil {
+		if err := security.ValidateFileSize(file.Size, security.MaxFileSize); err != nil {
+			c.JSON(http.StatusOK, ValidationResult{Reason: err.Error()})
+			return
+		}
+		f, err := file.Open()
+		if err == nil {
+			data, err = io.ReadAll(f)
+			f.Close()
+		}
+		if err != nil {
+			validateError(c, http.StatusBadRequest, "failed to read uploaded image", "INVALID_REQUEST")
+			return
+		}
+	} else {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusOK, ValidationResult{Reason: fmt.Sprintf("%v: upload exceeds %d bytes", security.ErrFileTooLarge, security.MaxFileSize)})
+			return
+		}
+
+		var req validateRequest
+		if err := c.ShouldBind(&req); err != nil || req.Path == "" {
+			validateError(c, http.StatusBadRequest, "request must include an upload or an image path", "INVALID_REQUEST")
+			return
+		}
+		data, err = h.readValidateImage(req.Path)
+		if errors.Is(err, errAccessDenied) {
+			validateError(c, http.StatusForbidden, err.Error(), "FORBIDDEN")
+			return
+		}
+		if err != nil {
+			validateError(c, http.StatusNotFound, "image not found", "NOT_FOUND")
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, h.Validate(data))
+}
+
+// readValidateImage reads an image path without any fallback
+func (h *ImageHandler) readValidateImage(path string) ([]byte, error) {
+	result, err := h.resolveImage(strings.TrimPrefix(path, "/"))
+	if err == nil {
+		result, err = h.checkAccess(result)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if result.IsFallback {
+		return nil, os.ErrNotExist
+	}
+	return storage.ReadFile(h.files, result.ResolvedPath)
+}
+
+// Validate checks that image data is within the file size and pixel
+// limits and can be decoded, and reports its format and dimensions
+func (h *ImageHandler) Validate(data []byte) ValidationResult {
+	if err := security.ValidateFileSize(int64(len(data)), security.MaxFileSize); err != nil {
+		return ValidationResult{Reason: err.Error()}
+	}
+	if err := h.processor.ValidateImage(data); err != nil {
+		if errors.Is(err, processor.ErrUnsupportedInputFormat) {
+			return ValidationResult{Reason: err.Error()}
+		}
+		return ValidationResult{Reason: processor.ErrInvalidImage.Error()}
+	}
+
+	metadata, err := h.metadata(data)
+	if err != nil {
+		if errors.Is(err, processor.ErrUnsupportedInputFormat) {
+			return ValidationResult{Reason: err.Error()}
+		}
+		return ValidationResult{Reason: processor.ErrInvalidImage.Error()}
+	}
+
+	result := ValidationResult{
+		Valid:  true,
+		Format: metadata.Type,
+		Width:  metadata.Width,
+		Height: metadata.Height,
+	}
+	if budget := h.config.MaxSourcePixels; budget > 0 && metadata.Width*metadata.Height > budget {
+		result.Valid = false
+		result.Reason = fmt.Sprintf("image has %d pixels, over the %d pixel budget", metadata.Width*metadata.Height, budget)
+	}
+	return result
+}
+
+// validateError writes a validate endpoint error response
+func validateError(c *gin.Context, status int, message, code string) {
+	c.JSON(status, gin.H{
+		"success": false,
+		"error":   message,
+		"code":    code,
+	})
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"goimgserver/config"
+	"goimgserver/processor"
+	"image"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeMetadata reads image metadata with the standard library decoders
+func decodeMetadata(data []byte) (*processor.ImageMetadata, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, processor.ErrInvalidImage
+	}
+	return &processor.ImageMetadata{Width: cfg.Width, Height: cfg.Height, Type: format, Frames: 1}, nil
+}
+
+// postValidateUpload uploads data to the validate endpoint and decodes the response
+func postValidateUpload(t *testing.T, router *gin.Engine, data []byte) (*httptest.ResponseRecorder, ValidationResult) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("upload", "upload.jpg")
+	require.NoError(t, err)
+	_, err = part.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+
+	req := httptest.NewRequest("POST", "/img/_validate", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var result ValidationResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	return w, result
+}
+
+// TestValidate_ValidUpload tests that a decodable upload is reported with its dimensions
+func TestValidate_ValidUpload(t *testing.T) {
+	// Arrange
+	router, handler, _ := setupTestRouter(t, nil)
+	imagesDir := handler.config.ImagesDir
+	data, err := os.ReadFile(filepath.Join(imagesDir, "test.jpg"))
+	require.NoError(t, err)
+
+	// Act
+	w, result := postValidateUpload(t, router, data)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, ValidationResult{Valid: true, Format: "jpeg", Width: 100, Height: 100}, result)
+}
+
+// TestValidate_CorruptUpload tests that undecodable data is rejected with a reason
+func TestValidate_CorruptUpload(t *testing.T) {
+	// Arrange
+	router, handler, _ := setupTestRouter(t, nil)
+	imagesDir := handler.config.ImagesDir
+	data, err := os.ReadFile(filepath.Join(imagesDir, "test.jpg"))
+	require.NoError(t, err)
+
+	// Act
+	w, result := postValidateUpload(t, router, append([]byte("garbage"), data[:len(data)/2]...))
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, result.Valid)
+	assert.Equal(t, processor.ErrInvalidImage.Error(), result.Reason)
+}
+
+// TestValidate_OverPixelBudget tests that an image larger than the pixel budget is rejected
+func TestValidate_OverPixelBudget(t *testing.T) {
+	// Arrange
+	router, handler, _ := setupTestRouter(t, func(cfg *config.Config) { cfg.MaxSourcePixels = 100*100 - 1 })
+	imagesDir := handler.config.ImagesDir
+	data, err := os.ReadFile(filepath.Join(imagesDir, "test.jpg"))
+	require.NoError(t, err)
+
+	// Act
+	w, result := postValidateUpload(t, router, data)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, result.Valid)
+	assert.Equal(t, 100, result.Width)
+	assert.Contains(t, result.Reason, "pixel budget")
+}
+
+// TestValidate_Path tests validating an image by path without fallback
+func TestValidate_Path(t *testing.T) {
+	// Arrange
+	router, _, _ := setupTestRouter(t, nil)
+	post := func(body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		req := httptest.NewRequest("POST", "/img/_validate", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w, response
+	}
+
+	// Act
+	valid, validResponse := post(`{"path": "cats/cat_white.jpg"}`)
+	missing, missingResponse := post(`{"path": "missing.jpg"}`)
+	empty, _ := post(`{}`)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, valid.Code)
+	assert.Equal(t, true, validResponse["valid"])
+	assert.Equal(t, http.StatusNotFound, missing.Code)
+	assert.Equal(t, "NOT_FOUND", missingResponse["code"])
+	assert.Equal(t, http.StatusBadRequest, empty.Code)
+}
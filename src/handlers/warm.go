@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"goimgserver/cache"
+	"goimgserver/processor"
+	"goimgserver/resolver"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errInvalidWarmURL is returned when a warm URL is not an image URL
+var errInvalidWarmURL = errors.New("url must be an image path under /img/")
+
+// warmRequest is the JSON body accepted by the warm endpoint
+type warmRequest struct {
+	URL string `json:"url"`
+}
+
+// WarmResult describes the outcome of warming a single image URL
+type WarmResult struct {
+	CachedBefore bool
+	CachedNow    bool
+	Bytes        int
+	Duration     time.Duration
+}
+
+// HandleWarm handles the /cmd/warm endpoint
+func (h *ImageHandler) HandleWarm(c *gin.Context) {
+	var req warmRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.URL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "request body must be JSON with a url field",
+			"code":    "INVALID_REQUEST",
+		})
+		return
+	}
+
+	result, err := h.WarmContext(c.Request.Context(), req.URL)
+	if err != nil {
+		status, code := warmErrorStatus(err)
+		c.JSON(status, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"code":    code,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":       true,
+		"url":           req.URL,
+		"cached_before": result.CachedBefore,
+		"cached_now":    result.CachedNow,
+		"bytes":         result.Bytes,
+		"duration":      result.Duration.String(),
+	})
+}
+
+// warmErrorStatus returns the response status and error code for a failure
+// to warm a rendition
+func warmErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, "TIMEOUT"
+	case errors.Is(err, errInvalidWarmURL):
+		return http.StatusBadRequest, "INVALID_URL"
+	case errors.Is(err, errInvalidNamespace):
+		return http.StatusBadRequest, "INVALID_NAMESPACE"
+	case errors.Is(err, errImageMissing):
+		return http.StatusNotFound, "NOT_FOUND"
+	case errors.Is(err, errAccessDenied):
+		return http.StatusForbidden, "FORBIDDEN"
+	case errors.Is(err, resolver.ErrEmptySource):
+		return http.StatusUnprocessableEntity, "EMPTY_IMAGE"
+	case errors.Is(err, errFormatMismatch):
+		return http.StatusUnprocessableEntity, "FORMAT_MISMATCH"
+	case errors.Is(err, errFormatNotAllowed):
+		return http.StatusBadRequest, "FORMAT_NOT_ALLOWED"
+	case errors.Is(err, errPDFUnsupported):
+		return http.StatusUnsupportedMediaType, "UNSUPPORTED_FORMAT"
+	case errors.Is(err, processor.ErrTransformFailed):
+		return http.StatusUnprocessableEntity, "TRANSFORM_FAILED"
+	case errors.Is(err, processor.ErrInvalidImage):
+		return http.StatusUnprocessableEntity, "INVALID_IMAGE"
+	case errors.Is(err, processor.ErrUnsupportedInputFormat):
+		return http.StatusUnsupportedMediaType, "UNSUPPORTED_FORMAT"
+	}
+	return http.StatusInternalServerError, "WARM_FAILED"
+}
+
+// Warm parses an image URL exactly like ServeImage and caches the
+// rendition if it is missing. URLs may include the configured base path.
+func (h *ImageHandler) Warm(url string) (*WarmResult, error) {
+	return h.WarmContext(context.Background(), url)
+}
+
+// WarmContext is Warm that stops waiting for processing when ctx ends
+func (h *ImageHandler) WarmContext(ctx context.Context, url string) (*WarmResult, error) {
+	start := time.Now()
+
+	// Strip the query string, base path and route prefix and split into segments
+	url, rawQuery, _ := strings.Cut(url, "?")
+	query, _ := neturl.ParseQuery(rawQuery)
+	if base := h.config.BasePath; base != "" && strings.HasPrefix(url, base+"/") {
+		url = strings.TrimPrefix(url, base)
+	}
+	if !strings.HasPrefix(url, "/img/") {
+		return nil, errInvalidWarmURL
+	}
+	requestPath := strings.TrimPrefix(url, "/img/")
+	segments := strings.Split(requestPath, "/")
+	if requestPath == "" || hasClearCommand(segments) {
+		return nil, errInvalidWarmURL
+	}
+
+	// Parse path and parameters
+	basePath, paramSegments := h.parsePathAndParams(segments)
+	paramSegments, _ = splitContentHash(paramSegments)
+	paramSegments = h.withQueryParams(paramSegments, query)
+	return h.warm(ctx, start, basePath, paramSegments)
+}
+
+// WarmRendition caches the rendition of the image at path with params if it
+// is missing. It shares in-flight processing with live requests for the
+// same rendition, so an image is never rendered or written twice at once.
+// The params are applied like the equivalent URL segments.
+func (h *ImageHandler) WarmRendition(ctx context.Context, path string, params cache.ProcessingParams) (*WarmResult, error) {
+	token, err := EncodeParamsToken(params)
+	if err != nil {
+		return nil, err
+	}
+	return h.warm(ctx, time.Now(), path, []string{token})
+}
+
+// warm builds the rendition of basePath like a request without headers
+// and renders it through the processing group unless it is already cached
+func (h *ImageHandler) warm(ctx context.Context, start time.Time, basePath string, paramSegments []string) (*WarmResult, error) {
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, (&neturl.URL{Path: "/img/" + basePath}).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req, err := h.buildRendition(r, basePath, paramSegments, processor.Caption{}, false)
+	if err != nil {
+		return nil, err
+	}
+	params, cacheKey := req.params, req.cacheKey
+
+	// Already cached renditions only report their size
+	if cachedData, found, err := h.cache.Retrieve(cacheKey, params); err == nil && found {
+		if _, _, ok := h.verifyCached(cachedData, params.Format, req.result.ResolvedPath); ok {
+			return &WarmResult{
+				CachedBefore: true,
+				CachedNow:    true,
+				Bytes:        len(cachedData),
+				Duration:     time.Since(start),
+			}, nil
+		}
+	}
+
+	rendered, _, err := h.processing.DoContext(ctx, processingKey(cacheKey, params), func(ctx context.Context) (*rendition, error) {
+		return h.renderFile(ctx, req.result.ResolvedPath, cacheKey, params, params)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &WarmResult{
+		CachedBefore: false,
+		CachedNow:    h.cache.Exists(cacheKey, params),
+		Bytes:        len(rendered.data),
+		Duration:     time.Since(start),
+	}, nil
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"goimgserver/cache"
+	"goimgserver/config"
+	"goimgserver/resolver"
+	"goimgserver/security"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupWarmRouter creates a test router with the warm endpoint registered
+func setupWarmRouter(t *testing.T) (*gin.Engine, cache.CacheManager) {
+	router, handler, _ := setupTestRouter(t, nil)
+	router.POST("/cmd/warm", handler.HandleWarm)
+	return router, handler.cache
+}
+
+// postWarm sends a warm request and decodes the JSON response
+func postWarm(t *testing.T, router *gin.Engine, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	req := httptest.NewRequest("POST", "/cmd/warm", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return w, response
+}
+
+// TestWarm_NewRendition tests warming a rendition that is not cached yet
+func TestWarm_NewRendition(t *testing.T) {
+	// Arrange
+	router, cacheManager := setupWarmRouter(t)
+
+	// Act
+	w, response := postWarm(t, router, `{"url": "/img/test.jpg/800x600/jpeg"}`)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, true, response["success"])
+	assert.Equal(t, false, response["cached_before"])
+	assert.Equal(t, true, response["cached_now"])
+	assert.Greater(t, response["bytes"], float64(0))
+	assert.NotEmpty(t, response["duration"])
+
+	stats, err := cacheManager.GetStats()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.TotalFiles)
+}
+
+// TestWarm_AlreadyCached tests re-warming a rendition that is already cached
+func TestWarm_AlreadyCached(t *testing.T) {
+	// Arrange
+	router, _ := setupWarmRouter(t)
+	w, _ := postWarm(t, router, `{"url": "/img/test.jpg/800x600/jpeg"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// Act
+	w, response := postWarm(t, router, `{"url": "/img/test.jpg/800x600/jpeg"}`)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, true, response["cached_before"])
+	assert.Equal(t, true, response["cached_now"])
+}
+
+// TestWarm_InvalidRequests tests rejection of malformed warm requests
+func TestWarm_InvalidRequests(t *testing.T) {
+	router, _ := setupWarmRouter(t)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"Invalid JSON", `{url:`},
+		{"Missing url", `{}`},
+		{"Not an image URL", `{"url": "/cmd/clear"}`},
+		{"Clear command", `{"url": "/img/test.jpg/clear"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, response := postWarm(t, router, tt.body)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Equal(t, false, response["success"])
+		})
+	}
+}
+
+// TestWarm_RequiresAPIKey tests the warm endpoint behind API key auth
+func TestWarm_RequiresAPIKey(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, &mockProcessor{})
+
+	router := gin.New()
+	cmd := router.Group("/cmd")
+	cmd.Use(security.APIKeyAuthMiddleware(security.NewAPIKeyAuthenticator([]string{"secret"})))
+	cmd.POST("/warm", handler.HandleWarm)
+
+	// Act - without key
+	w, _ := postWarm(t, router, `{"url": "/img/test.jpg"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Act - with key
+	req := httptest.NewRequest("POST", "/cmd/warm", strings.NewReader(`{"url": "/img/test.jpg"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", "secret")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// TestWarm_BasePath tests warming URLs that include the configured base path
+func TestWarm_BasePath(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	cfg.BasePath = "/images"
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, &mockProcessor{})
+
+	router := gin.New()
+	routes := router.Group(cfg.BasePath)
+	routes.POST("/cmd/warm", handler.HandleWarm)
+
+	// Act
+	req := httptest.NewRequest("POST", "/images/cmd/warm", strings.NewReader(`{"url": "/images/img/test.jpg/800x600/jpeg"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, cacheManager.Exists(filepath.Join(imagesDir, "test.jpg"), cache.ProcessingParams{
+		Width: 800, Height: 600, Format: "jpeg", Quality: DefaultQuality,
+	}))
+
+	// URLs without the base path still work
+	_, err = handler.Warm("/img/test.jpg/800x600/jpeg")
+	assert.NoError(t, err)
+}
+
+// TestWarm_DeniedPath tests that denied prefixes cannot be warmed
+func TestWarm_DeniedPath(t *testing.T) {
+	// Arrange
+	gin.SetMode(gin.TestMode)
+	imagesDir, cacheDir, cfg := setupTestEnvironment(t)
+	require.NoError(t, createTestImage(filepath.Join(imagesDir, "internal", "secret.jpg"), 100, 100))
+	cfg.DenyPaths = []string{"internal"}
+
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+	handler := NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, &mockProcessor{})
+
+	router := gin.New()
+	router.POST("/cmd/warm", handler.HandleWarm)
+
+	// Act
+	w, response := postWarm(t, router, `{"url": "/img/internal/secret.jpg/jpeg"}`)
+
+	// Assert
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "FORBIDDEN", response["code"])
+}
+
+// TestWarm_SameRenditionAsRequest tests that warming a URL finds the
+// rendition a request for it cached, source format rules included
+func TestWarm_SameRenditionAsRequest(t *testing.T) {
+	// Arrange
+	router, handler, proc := setupTestRouter(t, func(cfg *config.Config) { cfg.SourceFormatRules = []string{"jpeg=png"} })
+	proc.render = true
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/img/test.jpg/200x200", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "image/png", w.Header().Get("Content-Type"))
+
+	// Act
+	result, err := handler.Warm("/img/test.jpg/200x200")
+
+	// Assert
+	require.NoError(t, err)
+	assert.True(t, result.CachedBefore)
+}
+
+// TestWarmRendition_HeightOnly tests that a rendition the URL grammar cannot
+// express is refused instead of warming the default size
+func TestWarmRendition_HeightOnly(t *testing.T) {
+	// Arrange
+	_, handler, proc := setupTestRouter(t, nil)
+
+	// Act
+	result, err := handler.WarmRendition(context.Background(), "test.jpg", cache.ProcessingParams{Height: 300, Format: "jpeg", Quality: 80})
+
+	// Assert
+	assert.ErrorIs(t, err, ErrUnencodableParams)
+	assert.Nil(t, result)
+	assert.Empty(t, proc.calls)
+}
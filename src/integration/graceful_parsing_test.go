@@ -2,8 +2,16 @@ package integration
 
 import (
 	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 
+	"goimgserver/cache"
+	"goimgserver/config"
+	"goimgserver/handlers"
+	"goimgserver/processor"
+	"goimgserver/resolver"
 	"goimgserver/testutils"
 
 	"github.com/gin-gonic/gin"
@@ -11,321 +19,251 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+// recordingProcessor returns images unchanged and records the options of
+// the last Process call
+type recordingProcessor struct {
+	mu   sync.Mutex
+	opts processor.ProcessOptions
+}
+
+func (p *recordingProcessor) Resize(data []byte, width, height int) ([]byte, error) {
+	return data, nil
+}
+
+func (p *recordingProcessor) ConvertFormat(data []byte, format processor.ImageFormat) ([]byte, error) {
+	return data, nil
+}
+
+func (p *recordingProcessor) AdjustQuality(data []byte, quality int) ([]byte, error) {
+	return data, nil
+}
+
+func (p *recordingProcessor) Process(data []byte, opts processor.ProcessOptions) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.opts = opts
+	return data, nil
+}
+
+func (p *recordingProcessor) ValidateImage(data []byte) error {
+	if len(data) == 0 {
+		return processor.ErrInvalidImage
+	}
+	return nil
+}
+
+// last returns the options of the last Process call
+func (p *recordingProcessor) last() processor.ProcessOptions {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.opts
+}
+
+// setupParsingServer serves the named JPEG fixtures through the image
+// handler on its wildcard route, the only route parameters are parsed on
+func setupParsingServer(t *testing.T, names ...string) (*gin.Engine, *recordingProcessor, string) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	imagesDir := filepath.Join(tmpDir, "images")
+	cacheDir := filepath.Join(tmpDir, "cache")
+	require.NoError(t, os.MkdirAll(imagesDir, 0755))
+	for _, name := range append([]string{"test.jpg"}, names...) {
+		require.NoError(t, testutils.CreateTestImage(filepath.Join(imagesDir, name), 100, 100, testutils.FormatJPEG))
+	}
+
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+
+	cfg := &config.Config{ImagesDir: imagesDir, CacheDir: cacheDir}
+	proc := &recordingProcessor{}
+	handler := handlers.NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, proc)
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+	return router, proc, imagesDir
+}
+
 // TestIntegration_GracefulParsing_EndToEnd tests graceful URL parsing in complete workflows
 func TestIntegration_GracefulParsing_EndToEnd(t *testing.T) {
-	router := gin.New()
-	
-	// Simulate an image endpoint with parameter parsing
-	router.GET("/img/:filename/:dimensions", func(c *gin.Context) {
-		filename := c.Param("filename")
-		dimensions := c.Param("dimensions")
-		
-		// Gracefully parse dimensions (basic simulation)
-		width := 800  // default
-		height := 600 // default
-		
-		// In real implementation, parse dimensions string
-		// For now, just acknowledge the request
-		c.JSON(http.StatusOK, gin.H{
-			"filename":   filename,
-			"dimensions": dimensions,
-			"width":      width,
-			"height":     height,
-		})
-	})
-	
+	router, proc, _ := setupParsingServer(t, "test-image_01.jpg")
+
 	tests := []struct {
 		name           string
 		path           string
-		expectedStatus int
-		shouldContain  string
+		expectedWidth  int
+		expectedHeight int
+		expectedFormat processor.ImageFormat
 	}{
 		{
 			name:           "Valid dimensions",
 			path:           "/img/test.jpg/800x600",
-			expectedStatus: http.StatusOK,
-			shouldContain:  "test.jpg",
+			expectedWidth:  800,
+			expectedHeight: 600,
+			expectedFormat: processor.FormatWebP,
 		},
 		{
 			name:           "Complex URL with extra params",
-			path:           "/img/test.jpg/800x600?quality=80&format=webp",
-			expectedStatus: http.StatusOK,
-			shouldContain:  "test.jpg",
+			path:           "/img/test.jpg/800x600?quality=80&format=png",
+			expectedWidth:  800,
+			expectedHeight: 600,
+			expectedFormat: processor.FormatPNG,
 		},
 		{
 			name:           "URL with special characters in filename",
-			path:           "/img/test-image_01.jpg/800x600",
-			expectedStatus: http.StatusOK,
-			shouldContain:  "test-image_01.jpg",
+			path:           "/img/test-image_01.jpg/640x480/jpeg",
+			expectedWidth:  640,
+			expectedHeight: 480,
+			expectedFormat: processor.FormatJPEG,
 		},
 	}
-	
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			rec := testutils.MakeTestRequest(router, "GET", tt.path, nil, nil)
-			
-			assert.Equal(t, tt.expectedStatus, rec.Code)
-			assert.Contains(t, rec.Body.String(), tt.shouldContain)
+
+			require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+			opts := proc.last()
+			assert.Equal(t, tt.expectedWidth, opts.Width)
+			assert.Equal(t, tt.expectedHeight, opts.Height)
+			assert.Equal(t, tt.expectedFormat, opts.Format)
 		})
 	}
 }
 
-// TestIntegration_GracefulParsing_CacheConsistency tests cache consistency with graceful parsing
+// TestIntegration_GracefulParsing_CacheConsistency tests that the cache key
+// follows the parsed parameters, not the spelling of the URL
 func TestIntegration_GracefulParsing_CacheConsistency(t *testing.T) {
-	router := gin.New()
-	
-	// Simulate cache behavior
-	cache := make(map[string]string)
-	
-	router.GET("/img/:filename/:dimensions", func(c *gin.Context) {
-		filename := c.Param("filename")
-		dimensions := c.Param("dimensions")
-		
-		// Create cache key (simplified)
-		cacheKey := filename + "_" + dimensions
-		
-		// Check cache
-		if cached, ok := cache[cacheKey]; ok {
-			c.JSON(http.StatusOK, gin.H{
-				"cached":  true,
-				"data":    cached,
-				"cacheKey": cacheKey,
-			})
-			return
-		}
-		
-		// Process and cache
-		result := "processed_" + filename
-		cache[cacheKey] = result
-		
-		c.JSON(http.StatusOK, gin.H{
-			"cached":  false,
-			"data":    result,
-			"cacheKey": cacheKey,
+	router, _, _ := setupParsingServer(t)
+
+	tests := []struct {
+		name          string
+		path          string
+		expectedCache string
+	}{
+		{"First request - no cache", "/img/test.jpg/800x600/webp", "MISS"},
+		{"Second request - from cache", "/img/test.jpg/800x600/webp", "HIT"},
+		{"Reordered segments - same cache key", "/img/test.jpg/webp/800x600", "HIT"},
+		{"Query parameters - same cache key", "/img/test.jpg?width=800&height=600&format=webp", "HIT"},
+		{"Invalid segment ignored - same cache key", "/img/test.jpg/800x600/invalid/webp", "HIT"},
+		{"Different dimensions - different cache key", "/img/test.jpg/1024x768/webp", "MISS"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := testutils.MakeTestRequest(router, "GET", tt.path, nil, nil)
+
+			require.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, tt.expectedCache, rec.Header().Get("X-Cache"))
 		})
-	})
-	
-	t.Run("First request - no cache", func(t *testing.T) {
-		rec := testutils.MakeTestRequest(router, "GET", "/img/test.jpg/800x600", nil, nil)
-		
-		assert.Equal(t, http.StatusOK, rec.Code)
-		
-		var response map[string]interface{}
-		err := testutils.ParseJSONResponse(rec, &response)
-		require.NoError(t, err)
-		
-		assert.Equal(t, false, response["cached"])
-		assert.Contains(t, response["data"], "processed_test.jpg")
-	})
-	
-	t.Run("Second request - from cache", func(t *testing.T) {
-		rec := testutils.MakeTestRequest(router, "GET", "/img/test.jpg/800x600", nil, nil)
-		
-		assert.Equal(t, http.StatusOK, rec.Code)
-		
-		var response map[string]interface{}
-		err := testutils.ParseJSONResponse(rec, &response)
-		require.NoError(t, err)
-		
-		assert.Equal(t, true, response["cached"])
-	})
-	
-	t.Run("Different dimensions - different cache key", func(t *testing.T) {
-		rec := testutils.MakeTestRequest(router, "GET", "/img/test.jpg/1024x768", nil, nil)
-		
-		assert.Equal(t, http.StatusOK, rec.Code)
-		
-		var response map[string]interface{}
-		err := testutils.ParseJSONResponse(rec, &response)
-		require.NoError(t, err)
-		
-		// Should not be cached (different dimensions)
-		assert.Equal(t, false, response["cached"])
-	})
+	}
 }
 
-// TestIntegration_GracefulParsing_InvalidParameters tests handling of invalid parameters
+// TestIntegration_GracefulParsing_InvalidParameters tests that invalid
+// parameters fall back to the defaults instead of failing the request
 func TestIntegration_GracefulParsing_InvalidParameters(t *testing.T) {
-	router := gin.New()
-	
-	router.GET("/img/:filename/:dimensions", func(c *gin.Context) {
-		filename := c.Param("filename")
-		dimensions := c.Param("dimensions")
-		
-		// Gracefully handle invalid dimensions by using defaults
-		width := 800
-		height := 600
-		
-		// In real implementation, would parse and validate dimensions
-		// If invalid, fall back to defaults
-		
-		c.JSON(http.StatusOK, gin.H{
-			"filename":   filename,
-			"dimensions": dimensions,
-			"width":      width,
-			"height":     height,
-			"used_defaults": true,
-		})
-	})
-	
+	router, proc, _ := setupParsingServer(t)
+
 	tests := []struct {
-		name       string
-		path       string
-		shouldWork bool
+		name string
+		path string
 	}{
-		{
-			name:       "Invalid dimensions format",
-			path:       "/img/test.jpg/invalid",
-			shouldWork: true, // Should gracefully use defaults
-		},
-		{
-			name:       "Empty dimensions",
-			path:       "/img/test.jpg/",
-			shouldWork: true, // Gin routing might handle this differently
-		},
-		{
-			name:       "Negative dimensions",
-			path:       "/img/test.jpg/-100x-100",
-			shouldWork: true, // Should gracefully use defaults
-		},
-		{
-			name:       "Zero dimensions",
-			path:       "/img/test.jpg/0x0",
-			shouldWork: true, // Should gracefully use defaults
-		},
+		{"Invalid dimensions format", "/img/test.jpg/invalid"},
+		{"Empty dimensions", "/img/test.jpg/"},
+		{"Negative dimensions", "/img/test.jpg/-100x-100"},
+		{"Zero dimensions", "/img/test.jpg/0x0"},
+		{"Oversized dimensions", "/img/test.jpg/99999x99999"},
+		{"Invalid quality and format", "/img/test.jpg/q0/gif"},
 	}
-	
-	for _, tt := range tests {
+
+	for i, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			rec := testutils.MakeTestRequest(router, "GET", tt.path, nil, nil)
-			
-			if tt.shouldWork {
-				// Should not error, even with invalid input
-				assert.NotEqual(t, http.StatusInternalServerError, rec.Code)
+
+			require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+			// Every URL parses to the defaults, so only the first renders
+			if i > 0 {
+				assert.Equal(t, "HIT", rec.Header().Get("X-Cache"))
+				return
 			}
+			opts := proc.last()
+			assert.Equal(t, handlers.DefaultWidth, opts.Width)
+			assert.Equal(t, handlers.DefaultHeight, opts.Height)
+			assert.Equal(t, processor.ImageFormat(handlers.DefaultFormat), opts.Format)
+			assert.Equal(t, handlers.DefaultQuality, opts.Quality)
 		})
 	}
 }
 
 // TestIntegration_GracefulParsing_QueryParameters tests query parameter handling
 func TestIntegration_GracefulParsing_QueryParameters(t *testing.T) {
-	router := gin.New()
-	
-	router.GET("/img/:filename/:dimensions", func(c *gin.Context) {
-		filename := c.Param("filename")
-		dimensions := c.Param("dimensions")
-		
-		// Parse query parameters with defaults
-		quality := c.DefaultQuery("quality", "85")
-		format := c.DefaultQuery("format", "jpeg")
-		
-		c.JSON(http.StatusOK, gin.H{
-			"filename":   filename,
-			"dimensions": dimensions,
-			"quality":    quality,
-			"format":     format,
-		})
-	})
-	
+	router, proc, _ := setupParsingServer(t)
+
 	tests := []struct {
-		name     string
-		path     string
-		expected map[string]string
+		name            string
+		path            string
+		expectedQuality int
+		expectedFormat  processor.ImageFormat
 	}{
 		{
-			name: "No query parameters",
-			path: "/img/test.jpg/800x600",
-			expected: map[string]string{
-				"quality": "85",
-				"format":  "jpeg",
-			},
+			name:            "No query parameters",
+			path:            "/img/test.jpg/800x600",
+			expectedQuality: handlers.DefaultQuality,
+			expectedFormat:  processor.ImageFormat(handlers.DefaultFormat),
 		},
 		{
-			name: "Custom quality",
-			path: "/img/test.jpg/800x600?quality=95",
-			expected: map[string]string{
-				"quality": "95",
-				"format":  "jpeg",
-			},
+			name:            "Custom quality",
+			path:            "/img/test.jpg/800x600?quality=95",
+			expectedQuality: 95,
+			expectedFormat:  processor.ImageFormat(handlers.DefaultFormat),
 		},
 		{
-			name: "Custom format",
-			path: "/img/test.jpg/800x600?format=webp",
-			expected: map[string]string{
-				"quality": "85",
-				"format":  "webp",
-			},
+			name:            "Custom format",
+			path:            "/img/test.jpg/800x600?format=jpeg",
+			expectedQuality: handlers.DefaultQuality,
+			expectedFormat:  processor.FormatJPEG,
 		},
 		{
-			name: "Multiple parameters",
-			path: "/img/test.jpg/800x600?quality=90&format=png",
-			expected: map[string]string{
-				"quality": "90",
-				"format":  "png",
-			},
+			name:            "Multiple parameters",
+			path:            "/img/test.jpg/800x600?quality=90&format=png",
+			expectedQuality: 90,
+			expectedFormat:  processor.FormatPNG,
+		},
+		{
+			name:            "Path wins over query",
+			path:            "/img/test.jpg/800x600/q60/jpeg?quality=90&format=png",
+			expectedQuality: 60,
+			expectedFormat:  processor.FormatJPEG,
 		},
 	}
-	
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			rec := testutils.MakeTestRequest(router, "GET", tt.path, nil, nil)
-			
-			assert.Equal(t, http.StatusOK, rec.Code)
-			
-			var response map[string]interface{}
-			err := testutils.ParseJSONResponse(rec, &response)
-			require.NoError(t, err)
-			
-			for key, expectedValue := range tt.expected {
-				assert.Equal(t, expectedValue, response[key], "Mismatch for parameter: %s", key)
-			}
+
+			require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+			opts := proc.last()
+			assert.Equal(t, tt.expectedQuality, opts.Quality)
+			assert.Equal(t, tt.expectedFormat, opts.Format)
 		})
 	}
 }
 
 // TestIntegration_GracefulParsing_SpecialCharacters tests handling of special characters
 func TestIntegration_GracefulParsing_SpecialCharacters(t *testing.T) {
-	router := gin.New()
-	
-	router.GET("/img/:filename/:dimensions", func(c *gin.Context) {
-		filename := c.Param("filename")
-		dimensions := c.Param("dimensions")
-		
-		c.JSON(http.StatusOK, gin.H{
-			"filename":   filename,
-			"dimensions": dimensions,
-		})
-	})
-	
-	tests := []struct {
-		name     string
-		filename string
-	}{
-		{
-			name:     "Filename with dashes",
-			filename: "test-image-01.jpg",
-		},
-		{
-			name:     "Filename with underscores",
-			filename: "test_image_01.jpg",
-		},
-		{
-			name:     "Filename with numbers",
-			filename: "image123.jpg",
-		},
-		{
-			name:     "Filename with dots",
-			filename: "test.image.jpg",
-		},
-	}
-	
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			path := "/img/" + tt.filename + "/800x600"
-			rec := testutils.MakeTestRequest(router, "GET", path, nil, nil)
-			
-			assert.Equal(t, http.StatusOK, rec.Code)
-			assert.Contains(t, rec.Body.String(), tt.filename)
+	filenames := []string{"test-image-01.jpg", "test_image_01.jpg", "image123.jpg", "test.image.jpg"}
+	router, proc, imagesDir := setupParsingServer(t, filenames...)
+
+	for _, filename := range filenames {
+		t.Run(filename, func(t *testing.T) {
+			rec := testutils.MakeTestRequest(router, "GET", "/img/"+filename+"/800x600", nil, nil)
+
+			require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+			// The processor returns its input, so the body is the source
+			source, err := os.ReadFile(filepath.Join(imagesDir, filename))
+			require.NoError(t, err)
+			assert.Equal(t, source, rec.Body.Bytes())
+			assert.Equal(t, 800, proc.last().Width)
+			assert.Equal(t, 600, proc.last().Height)
 		})
 	}
 }
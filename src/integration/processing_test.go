@@ -0,0 +1,133 @@
+//go:build integration
+
+package integration
+
+import (
+	"bytes"
+	"embed"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"goimgserver/cache"
+	"goimgserver/config"
+	"goimgserver/handlers"
+	"goimgserver/processor"
+	"goimgserver/resolver"
+	"goimgserver/security"
+	"goimgserver/testutils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "golang.org/x/image/webp"
+)
+
+// Fixtures: photo.jpg is 400x300, photo.png is 40x30
+//
+//go:embed testdata/photo.jpg testdata/photo.png
+var processingFixtures embed.FS
+
+// setupProcessingServer wires the real processor into the image handler.
+// It skips the test when libvips cannot transcode in this environment.
+func setupProcessingServer(t *testing.T) (*gin.Engine, cache.CacheManager, string) {
+	t.Helper()
+	if err := processor.Probe(); err != nil {
+		t.Skipf("real image processing unavailable: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	imagesDir := filepath.Join(tmpDir, "images")
+	cacheDir := filepath.Join(tmpDir, "cache")
+	require.NoError(t, os.MkdirAll(imagesDir, 0755))
+
+	for _, name := range []string{"photo.jpg", "photo.png"} {
+		data, err := processingFixtures.ReadFile("testdata/" + name)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(imagesDir, name), data, 0644))
+	}
+
+	cacheManager, err := cache.NewManager(cacheDir)
+	require.NoError(t, err)
+
+	cfg := &config.Config{ImagesDir: imagesDir, CacheDir: cacheDir}
+	handler := handlers.NewImageHandler(cfg, resolver.NewResolver(imagesDir), cacheManager, processor.New())
+
+	router := gin.New()
+	router.GET("/img/*path", handler.ServeImage)
+	return router, cacheManager, imagesDir
+}
+
+// decodeResponse checks the response's real format and returns its dimensions
+func decodeResponse(t *testing.T, resp *http.Response, body []byte, expectedFormat string) (int, int) {
+	t.Helper()
+	format, err := security.ValidateFileType(body)
+	require.NoError(t, err)
+	assert.Equal(t, expectedFormat, format)
+	assert.Equal(t, "image/"+expectedFormat, resp.Header.Get("Content-Type"))
+
+	cfg, decoded, err := image.DecodeConfig(bytes.NewReader(body))
+	require.NoError(t, err)
+	assert.Equal(t, expectedFormat, decoded)
+	return cfg.Width, cfg.Height
+}
+
+// TestIntegration_Processing_FormatAndDimensions tests real transcoding through /img
+func TestIntegration_Processing_FormatAndDimensions(t *testing.T) {
+	router, _, _ := setupProcessingServer(t)
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedFormat string
+		expectedWidth  int
+		expectedHeight int
+	}{
+		{"JPEG to WebP", "/img/photo.jpg/200x150/webp", "webp", 200, 150},
+		{"JPEG to PNG", "/img/photo.jpg/200x150/png", "png", 200, 150},
+		{"JPEG to JPEG", "/img/photo.jpg/200x150/jpeg", "jpeg", 200, 150},
+		{"Width only keeps aspect ratio", "/img/photo.jpg/100/jpeg", "jpeg", 100, 75},
+		{"Default format is WebP", "/img/photo.jpg/200x150", "webp", 200, 150},
+		{"PNG source", "/img/photo.png/20x15/jpeg", "jpeg", 20, 15},
+		{"Query parameters", "/img/photo.jpg?width=120&format=png", "png", 120, 90},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := testutils.MakeTestRequest(router, "GET", tt.path, nil, nil)
+			require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+			width, height := decodeResponse(t, rec.Result(), rec.Body.Bytes(), tt.expectedFormat)
+			assert.Equal(t, tt.expectedWidth, width)
+			assert.Equal(t, tt.expectedHeight, height)
+		})
+	}
+}
+
+// TestIntegration_Processing_CacheHitMiss tests that a second request is served from cache
+func TestIntegration_Processing_CacheHitMiss(t *testing.T) {
+	router, cacheManager, imagesDir := setupProcessingServer(t)
+	params := cache.ProcessingParams{Width: 200, Height: 150, Format: "webp", Quality: handlers.DefaultQuality}
+	sourcePath := filepath.Join(imagesDir, "photo.jpg")
+	require.False(t, cacheManager.Exists(sourcePath, params))
+
+	// Miss: processed and stored
+	miss := testutils.MakeTestRequest(router, "GET", "/img/photo.jpg/200x150/webp", nil, nil)
+	require.Equal(t, http.StatusOK, miss.Code)
+	assert.Contains(t, miss.Header().Get("Server-Timing"), "process;")
+	assert.True(t, cacheManager.Exists(sourcePath, params))
+
+	// Hit: served from cache without processing
+	hit := testutils.MakeTestRequest(router, "GET", "/img/photo.jpg/200x150/webp", nil, nil)
+	require.Equal(t, http.StatusOK, hit.Code)
+	assert.NotContains(t, hit.Header().Get("Server-Timing"), "process;")
+	assert.Equal(t, miss.Body.Bytes(), hit.Body.Bytes())
+
+	width, height := decodeResponse(t, hit.Result(), hit.Body.Bytes(), "webp")
+	assert.Equal(t, 200, width)
+	assert.Equal(t, 150, height)
+}
@@ -24,20 +24,8 @@ func NewLogger(w io.Writer, level slog.Level) *Logger {
 
 // NewLoggerFromConfig creates a logger from configuration
 func NewLoggerFromConfig(w io.Writer, config *Config) *Logger {
-	opts := &slog.HandlerOptions{
-		Level:     config.Level,
-		AddSource: config.AddSource,
-	}
-	
-	var handler slog.Handler
-	if config.JSONFormat {
-		handler = slog.NewJSONHandler(w, opts)
-	} else {
-		handler = slog.NewTextHandler(w, opts)
-	}
-	
 	return &Logger{
-		logger: slog.New(handler),
+		logger: slog.New(newHandler(w, config)),
 	}
 }
 
@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// ParseLevel parses a level name: debug, info, warn or error
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %q", name)
+	}
+}
+
+// Setup makes a logger built from config the process default. Both slog and
+// the standard log package write through it, so components logging with
+// log.Printf are leveled too.
+func Setup(w io.Writer, config *Config) *slog.Logger {
+	handler := newHandler(w, config)
+	logger := slog.New(handler)
+	slog.SetDefault(logger)
+	log.SetOutput(&levelWriter{handler: handler})
+	return logger
+}
+
+// newHandler builds the slog handler for config
+func newHandler(w io.Writer, config *Config) slog.Handler {
+	opts := &slog.HandlerOptions{
+		Level:     config.Level,
+		AddSource: config.AddSource,
+	}
+	if config.JSONFormat {
+		return slog.NewJSONHandler(w, opts)
+	}
+	return slog.NewTextHandler(w, opts)
+}
+
+// levelPrefixes map the message prefixes used with the standard log
+// package to levels
+var levelPrefixes = []struct {
+	prefix string
+	level  slog.Level
+}{
+	{"Debug: ", slog.LevelDebug},
+	{"Warning: ", slog.LevelWarn},
+	{"Error: ", slog.LevelError},
+}
+
+// levelWriter turns standard log lines into records, taking the level from
+// a "Warning: " or "Error: " prefix and defaulting to info
+type levelWriter struct {
+	handler slog.Handler
+}
+
+// Write logs one standard log line
+func (w *levelWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	level := slog.LevelInfo
+	for _, lp := range levelPrefixes {
+		if strings.HasPrefix(msg, lp.prefix) {
+			msg, level = strings.TrimPrefix(msg, lp.prefix), lp.level
+			break
+		}
+	}
+
+	ctx := context.Background()
+	if !w.handler.Enabled(ctx, level) {
+		return len(p), nil
+	}
+	return len(p), w.handler.Handle(ctx, slog.NewRecord(time.Now(), level, msg, 0))
+}
@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// restoreDefaults puts the process wide loggers back after a test
+func restoreDefaults(t *testing.T) {
+	t.Helper()
+	logger, writer, flags := slog.Default(), log.Writer(), log.Flags()
+	t.Cleanup(func() {
+		slog.SetDefault(logger)
+		log.SetOutput(writer)
+		log.SetFlags(flags)
+	})
+}
+
+// decodeLines parses JSON log lines
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry), line)
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// TestParseLevel tests level names
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected slog.Level
+		valid    bool
+	}{
+		{"debug", slog.LevelDebug, true},
+		{"info", slog.LevelInfo, true},
+		{"WARN", slog.LevelWarn, true},
+		{"error", slog.LevelError, true},
+		{"verbose", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, err := ParseLevel(tt.name)
+			if !tt.valid {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, level)
+		})
+	}
+}
+
+// TestSetup_JSON tests slog and standard log output is JSON at the configured level
+func TestSetup_JSON(t *testing.T) {
+	restoreDefaults(t)
+	buf := &bytes.Buffer{}
+	Setup(buf, &Config{Level: slog.LevelWarn, JSONFormat: true})
+
+	slog.Info("skipped info")
+	slog.Warn("cache nearly full", "usage", 91)
+	log.Printf("Started processing")
+	log.Printf("Warning: failed to cache image: %v", "disk full")
+	log.Printf("Error: processing %s panicked", "a.jpg")
+
+	entries := decodeLines(t, buf)
+	require.Len(t, entries, 3)
+
+	assert.Equal(t, "WARN", entries[0]["level"])
+	assert.Equal(t, "cache nearly full", entries[0]["msg"])
+	assert.Equal(t, float64(91), entries[0]["usage"])
+	assert.Contains(t, entries[0], "time")
+
+	assert.Equal(t, "WARN", entries[1]["level"])
+	assert.Equal(t, "failed to cache image: disk full", entries[1]["msg"])
+
+	assert.Equal(t, "ERROR", entries[2]["level"])
+	assert.Equal(t, "processing a.jpg panicked", entries[2]["msg"])
+}
+
+// TestSetup_Text tests the text format and debug level
+func TestSetup_Text(t *testing.T) {
+	restoreDefaults(t)
+	buf := &bytes.Buffer{}
+	Setup(buf, &Config{Level: slog.LevelDebug})
+
+	log.Printf("Debug: resolved %s", "cats/a.jpg")
+	log.Printf("Pre-cache complete")
+
+	output := buf.String()
+	assert.Contains(t, output, `level=DEBUG msg="resolved cats/a.jpg"`)
+	assert.Contains(t, output, `level=INFO msg="Pre-cache complete"`)
+}
@@ -1,23 +1,28 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"goimgserver/cache"
 	"goimgserver/config"
+	apperrors "goimgserver/errors"
 	"goimgserver/git"
 	"goimgserver/handlers"
+	"goimgserver/logging"
 	"goimgserver/precache"
 	"goimgserver/processor"
 	"goimgserver/resolver"
+	"goimgserver/security"
+	"goimgserver/selftest"
 	"goimgserver/server"
+	"goimgserver/storage"
+	"goimgserver/webhook"
+	"io"
 	"log"
-	"net/http"
 	"os"
 	"path/filepath"
 	"time"
-
-	"github.com/gin-gonic/gin"
 )
 
 // imageProcessorAdapter adapts processor.ImageProcessor to precache.ProcessorInterface
@@ -43,6 +48,10 @@ func (a *imageProcessorAdapter) Process(data []byte, opts interface{}) ([]byte,
 	return a.processor.Process(data, processOpts)
 }
 
+// transforms are custom post-processing steps, e.g. a brand overlay, run in
+// order on every processed image. Register them here at startup.
+var transforms []processor.Transform
+
 func main() {
 	// Parse command-line arguments
 	cfg, err := config.ParseArgs(os.Args[1:])
@@ -55,9 +64,34 @@ func main() {
 		log.Fatalf("Configuration validation failed: %v", err)
 	}
 
+	// Route all logs, including the standard log package, through the
+	// configured leveled logger
+	logLevel, err := logging.ParseLevel(cmp.Or(cfg.LogLevel, config.LogLevelInfo))
+	if err != nil {
+		log.Fatalf("Configuration validation failed: %v", err)
+	}
+	logging.Setup(os.Stderr, &logging.Config{
+		Level:      logLevel,
+		JSONFormat: cfg.LogFormat != config.LogFormatText,
+	})
+
+	// Error responses only carry internal details during development
+	apperrors.SetDevelopmentMode(!cfg.Production)
+
 	// Setup default image
 	if err := cfg.SetupDefaultImage(); err != nil {
-		log.Fatalf("Failed to setup default image: %v", err)
+		if cfg.InvalidDefaultImage == config.InvalidDefaultImageError {
+			log.Fatalf("Failed to setup default image: %v", err)
+		}
+		log.Printf("Error: failed to setup default image, serving a generated placeholder until %s is fixed: %v", cfg.DefaultImagePath, err)
+	}
+
+	// Run the self-test and exit if requested
+	if cfg.SelfTest {
+		if err := selftest.Run(os.Stdout, cfg.CacheDir, processor.New()); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
 	}
 
 	// Dump settings if requested
@@ -79,17 +113,59 @@ func main() {
 	
 	// Create resolver
 	fileResolver := resolver.NewResolverWithCache(cfg.ImagesDir)
+	fileResolver.SetFallbackTTL(cfg.FallbackCacheTTL)
+	fileResolver.SetListingTTL(cfg.ListingTTL)
+	fileResolver.SetCacheLimit(cfg.ResolverCacheSize)
+	fileResolver.SetEmptySource(cfg.MinSourceSize, cfg.EmptySource == config.EmptySourceError)
+	fileResolver.SetCaseInsensitive(cfg.PathCase == config.PathCaseInsensitive)
+	if cfg.Archive != "" {
+		// The archive's images are served as if they were in the images directory
+		archive, archiveFile, err := storage.OpenArchive(cfg.Archive)
+		if err != nil {
+			log.Fatalf("Failed to open archive: %v", err)
+		}
+		defer archiveFile.Close()
+		fileResolver.SetStorage(storage.Mount(cfg.ImagesDir, archive))
+		log.Printf("Serving images from archive %s", cfg.Archive)
+	}
 	log.Println("File resolver initialized")
+	if cfg.GroupIndex {
+		// Scan the groups once so the first index request is cheap
+		if groups, err := fileResolver.ListGroups(); err != nil {
+			log.Printf("Warning: failed to index image groups: %v", err)
+		} else {
+			log.Printf("Indexed %d image groups", len(groups))
+		}
+	}
 	
 	// Create cache manager
-	cacheManager, err := cache.NewManager(cfg.CacheDir)
+	cacheManager, err := cache.NewManagerWithOptions(cfg.CacheDir, cache.Options{
+		MaxVariantsPerFile: cfg.MaxVariantsPerFile,
+		MaxTotalVariants:   cfg.MaxTotalVariants,
+		ShardLevels:        cfg.CacheShardLevels,
+		CompressAfter:      cfg.CacheCompressAfter,
+		CompressFormats:    cfg.CacheCompressFormats,
+		MaxOpenFiles:       cfg.CacheMaxOpenFiles,
+		MaxSourceVersions:  cfg.CacheMaxSourceVersions,
+		FrequencyWeight:    cfg.CacheFrequencyWeight,
+	})
 	if err != nil {
 		log.Fatalf("Failed to create cache manager: %v", err)
 	}
 	log.Println("Cache manager initialized")
+	// The janitor also saves the access counts that order eviction and warm-up
+	if cfg.CacheCompressAfter > 0 || cfg.CacheMaxSourceVersions > 0 || (cfg.CacheFrequencyWeight > 0 && cfg.CacheJanitorInterval > 0) {
+		go cache.RunJanitor(context.Background(), cacheManager, cfg.CacheJanitorInterval)
+	}
+	if cfg.CacheCompressAfter > 0 {
+		log.Printf("Cache janitor compressing entries unused for %v", cfg.CacheCompressAfter)
+	}
+	if cfg.CacheMaxSourceVersions > 0 {
+		log.Printf("Cache janitor keeping renditions of the %d newest versions of each source", cfg.CacheMaxSourceVersions)
+	}
 	
 	// Create image processor
-	imageProcessor := processor.New()
+	imageProcessor := processor.WithTransforms(processor.New(), transforms...)
 	log.Println("Image processor initialized")
 	
 	// Create image handler
@@ -100,8 +176,12 @@ func main() {
 	gitOps := git.NewOperations()
 	log.Println("Git operations initialized")
 	
+	// Tell peers about cache clears, git updates and pre-cache runs
+	webhooks := webhook.New(cfg.Webhooks, cfg.WebhookTimeout, cfg.WebhookRetries)
+
 	// Create command handler
 	commandHandler := handlers.NewCommandHandler(cfg, cacheManager, gitOps)
+	commandHandler.SetWebhooks(webhooks)
 	log.Println("Command handler initialized")
 	
 	// Run pre-cache if enabled
@@ -113,6 +193,27 @@ func main() {
 			DefaultImagePath: cfg.DefaultImagePath,
 			Enabled:          cfg.PreCacheEnabled,
 			Workers:          cfg.PreCacheWorkers,
+			Rate:             cfg.PreCacheRate,
+			// Render through the image handler so pre-cache and live
+			// requests for the same rendition share one processing
+			Warm: func(ctx context.Context, path string, params cache.ProcessingParams) error {
+				_, err := imageHandler.WarmRendition(ctx, path, params)
+				return err
+			},
+			Done: func(stats *precache.Stats, err error) {
+				data := map[string]any{}
+				if stats != nil {
+					data["total_images"] = stats.TotalImages
+					data["processed"] = stats.ProcessedOK
+					data["skipped"] = stats.Skipped
+					data["errors"] = stats.Errors
+					data["duration_ms"] = stats.Duration.Milliseconds()
+				}
+				if err != nil {
+					data["error"] = err.Error()
+				}
+				webhooks.Notify(webhook.EventPreCacheCompleted, data)
+			},
 		}
 		
 		// Create processor adapter for pre-cache (adapts processor.ImageProcessor to precache.ProcessorInterface)
@@ -136,15 +237,26 @@ func main() {
 	
 	// Create server configuration
 	serverConfig := &server.Config{
-		Port:            cfg.Port,
-		ReadTimeout:     30 * time.Second,
-		WriteTimeout:    30 * time.Second,
-		ShutdownTimeout: 10 * time.Second,
-		EnableCORS:      true,
-		EnableRateLimit: false, // Can be enabled in production
-		RateLimit:       100,
-		RatePer:         time.Minute,
-		Production:      false,
+		Port:              cfg.Port,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      30 * time.Second,
+		ShutdownTimeout:   10 * time.Second,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		MaxBodyBytes:      cfg.MaxBodyBytes,
+		EnableHTTP2:       cfg.EnableHTTP2,
+		BasePath:          cfg.BasePath,
+		TLSCertFile:       cfg.TLSCert,
+		TLSKeyFile:        cfg.TLSKey,
+		TLSMinVersion:     cfg.MinTLSVersion(),
+		RedirectPort:      cfg.HTTPRedirectPort,
+		HealthTimeout:     cfg.HealthTimeout,
+		EnableCORS:        true,
+		EnableRateLimit:   false, // Can be enabled in production
+		RateLimit:         100,
+		RatePer:           time.Minute,
+		Production:        cfg.Production,
 	}
 	
 	// Create server
@@ -155,34 +267,84 @@ func main() {
 		_, err := cacheManager.GetStats()
 		return err == nil
 	})
+	srv.AddNonCriticalHealthCheck("cache_writes", func() bool {
+		return !cacheManager.ReadOnly()
+	})
 	srv.AddHealthCheck("filesystem", func() bool {
 		_, err := os.Stat(cfg.ImagesDir)
 		return err == nil
 	})
 	
-	// Define a simple GET endpoint
-	srv.Router.GET("/ping", func(c *gin.Context) {
-		// Return JSON response
-		c.JSON(http.StatusOK, gin.H{
-			"message": "pong",
-		})
-	})
-	
-	// Image endpoints
-	srv.Router.GET("/img/*path", imageHandler.ServeImage)
+	// Image endpoints, answered with the maintenance response while
+	// maintenance mode is on
+	maintenance := handlers.NewMaintenance(cfg)
+	imageTimeout := security.TimeoutMiddleware(cfg.ImageTimeout)
+	srv.Routes.GET("/img/*path", maintenance.Middleware(), imageTimeout, imageHandler.ServeImage)
+	srv.Routes.HEAD("/img/*path", maintenance.Middleware(), imageTimeout, imageHandler.ServeImage)
+	srv.Routes.GET("/thumb/*path", maintenance.Middleware(), imageTimeout, imageHandler.ServeThumbnail)
+	srv.Routes.HEAD("/thumb/*path", maintenance.Middleware(), imageTimeout, imageHandler.ServeThumbnail)
 	log.Println("Image endpoints registered")
 	
-	// Command endpoints
-	srv.Router.POST("/cmd/clear", commandHandler.HandleClear)
-	srv.Router.POST("/cmd/gitupdate", commandHandler.HandleGitUpdate)
-	srv.Router.POST("/cmd/:name", commandHandler.HandleCommand)
+	// Command endpoints (API key protected when configured). Every call is
+	// audited, including those the API key check rejects.
+	var auditOut io.Writer
+	if cfg.AuditLog != "" {
+		auditFile, err := os.OpenFile(cfg.AuditLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			log.Fatalf("Failed to open audit log: %v", err)
+		}
+		defer auditFile.Close()
+		auditOut = auditFile
+	}
+	cmdGroup := srv.Routes.Group("/cmd", security.TimeoutMiddleware(cfg.CommandTimeout), handlers.NewAuditLog(auditOut).Middleware())
+	if cfg.CommandAPIKey != "" {
+		cmdGroup.Use(security.APIKeyAuthMiddleware(security.NewAPIKeyAuthenticator([]string{cfg.CommandAPIKey})))
+	}
+	cmdGroup.POST("/clear", commandHandler.HandleClear)
+	cmdGroup.POST("/gitupdate", commandHandler.HandleGitUpdate)
+	cmdGroup.GET("/info", commandHandler.HandleInfo)
+	// Warming renders arbitrary URLs and maintenance mode takes the image
+	// endpoints offline, so both are only exposed behind the command API key
+	if cfg.CommandAPIKey != "" {
+		cmdGroup.POST("/warm", imageHandler.HandleWarm)
+		cmdGroup.GET("/maintenance", maintenance.HandleMaintenance)
+		cmdGroup.POST("/maintenance", maintenance.HandleMaintenance)
+	}
+	cmdGroup.POST("/:name", commandHandler.HandleCommand)
 	log.Println("Command endpoints registered")
 
+	// Debug and test endpoints are only exposed behind the command API key
+	if cfg.CommandAPIKey != "" {
+		apiKeyAuth := security.APIKeyAuthMiddleware(security.NewAPIKeyAuthenticator([]string{cfg.CommandAPIKey}))
+		debugGroup := srv.Routes.Group("/debug", security.TimeoutMiddleware(cfg.CommandTimeout))
+		debugGroup.Use(apiKeyAuth)
+		debugGroup.GET("/processing", imageHandler.HandleDebugProcessing)
+		debugGroup.GET("/metrics", imageHandler.HandleProcessingMetrics)
+		// One route serves /img/_diff, /img/_validate and uploads, since a
+		// catch-all cannot share its segment with fixed paths
+		srv.Routes.POST("/img/*path", apiKeyAuth, maintenance.Middleware(), imageTimeout, imageHandler.HandlePost)
+		srv.Routes.DELETE("/img/*path", apiKeyAuth, maintenance.Middleware(), imageTimeout, imageHandler.PurgeImage)
+		log.Println("Debug endpoints registered")
+		if cfg.EnableUploads {
+			log.Println("Upload endpoint registered")
+		}
+	} else {
+		log.Println("Debug endpoints disabled (no --cmd-api-key)")
+	}
+
+	// OPTIONS lists the methods each image and command route allows, for
+	// CORS preflights and API discovery
+	srv.HandleOptions("/img/*path")
+	srv.HandleOptions("/thumb/*path")
+	srv.HandleOptions("/cmd/*path")
+
 	// Print server startup message
 	fmt.Println("Server started and running.")
 	fmt.Printf("Server will listen on 127.0.0.1:%d (localhost:%d on Windows)\n", cfg.Port, cfg.Port)
-	fmt.Printf("GET http://127.0.0.1:%d/ping to test; you should see message pong.\n", cfg.Port)
-	fmt.Printf("GET http://127.0.0.1:%d/health for health check.\n", cfg.Port)
+	if !cfg.Production {
+		fmt.Printf("GET http://127.0.0.1:%d%s/ping to test; you should see message pong.\n", cfg.Port, cfg.BasePath)
+	}
+	fmt.Printf("GET http://127.0.0.1:%d%s/health for health check.\n", cfg.Port, cfg.BasePath)
 	fmt.Printf("Images directory: %s\n", cfg.ImagesDir)
 	fmt.Printf("Cache directory: %s\n", cfg.CacheDir)
 	fmt.Printf("Default image: %s\n", cfg.DefaultImagePath)
@@ -191,4 +353,13 @@ func main() {
 	if err := srv.Run(); err != nil {
 		log.Fatalf("Server error: %v", err)
 	}
+	// Deliver the webhooks still in flight, within the shutdown timeout
+	webhookCtx, cancelWebhooks := context.WithTimeout(context.Background(), serverConfig.ShutdownTimeout)
+	if err := webhooks.WaitContext(webhookCtx); err != nil {
+		log.Printf("Warning: webhooks still in flight at shutdown: %v", err)
+	}
+	cancelWebhooks()
+	if err := cacheManager.SaveAccessCounts(); err != nil {
+		log.Printf("Warning: failed to save cache access counts: %v", err)
+	}
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"path/filepath"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -50,8 +51,8 @@ func TestPerformance_LoadTesting_ConcurrentUsers(t *testing.T) {
 			
 			// Create router
 			router := gin.New()
-			router.GET("/img/:filename/:dimensions", func(c *gin.Context) {
-				filename := c.Param("filename")
+			router.GET("/img/*path", func(c *gin.Context) {
+				filename, _, _ := strings.Cut(strings.TrimPrefix(c.Param("path"), "/"), "/")
 				
 				result, err := res.Resolve(filename)
 				if err != nil {
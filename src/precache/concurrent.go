@@ -11,6 +11,7 @@ type ConcurrentExecutor struct {
 	processor Processor
 	workers   int
 	progress  ProgressReporter
+	rate      float64 // Images started per second, 0 = unlimited
 }
 
 // NewConcurrentExecutor creates a new concurrent executor
@@ -90,9 +91,24 @@ func (e *ConcurrentExecutor) Execute(ctx context.Context, imagePaths []string) (
 		}()
 	}
 	
-	// Send jobs to workers
+	// Send jobs to workers, paced by the rate limit so warming does not
+	// starve live traffic
 	go func() {
-		for _, imagePath := range imagePaths {
+		var tick <-chan time.Time
+		if e.rate > 0 {
+			ticker := time.NewTicker(time.Duration(float64(time.Second) / e.rate))
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for i, imagePath := range imagePaths {
+			if tick != nil && i > 0 {
+				select {
+				case <-ctx.Done():
+					close(jobs)
+					return
+				case <-tick:
+				}
+			}
 			select {
 			case <-ctx.Done():
 				close(jobs)
@@ -172,6 +172,41 @@ func Test_Concurrent_Cancellation(t *testing.T) {
 	assert.True(t, stats.ProcessedOK+stats.Errors < numImages, "Should not process all images due to cancellation")
 }
 
+// startRecorder records when each image starts processing
+type startRecorder struct {
+	mu     sync.Mutex
+	starts []time.Time
+}
+
+func (r *startRecorder) Process(ctx context.Context, imagePath string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.starts = append(r.starts, time.Now())
+	return nil
+}
+
+func Test_Concurrent_RateLimit(t *testing.T) {
+	imagePaths := make([]string, 10)
+	for i := range imagePaths {
+		imagePaths[i] = fmt.Sprintf("image%d.jpg", i)
+	}
+	recorder := &startRecorder{}
+	
+	// Many workers would process everything at once without the limit
+	executor := NewConcurrentExecutor(recorder, 8, NewProgress())
+	executor.rate = 50
+	
+	stats, err := executor.Execute(context.Background(), imagePaths)
+	
+	require.NoError(t, err)
+	assert.Equal(t, len(imagePaths), stats.ProcessedOK)
+	require.Len(t, recorder.starts, len(imagePaths))
+	
+	// 10 images at 50 per second take at least 9 intervals of 20ms
+	window := recorder.starts[len(recorder.starts)-1].Sub(recorder.starts[0])
+	assert.GreaterOrEqual(t, window, 9*20*time.Millisecond*9/10, "Images started faster than the rate limit")
+}
+
 func Test_Concurrent_WorkerPool(t *testing.T) {
 	// Create test directories
 	tmpDir := t.TempDir()
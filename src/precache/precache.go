@@ -14,6 +14,8 @@ type PreCache struct {
 	config   *PreCacheConfig
 	scanner  Scanner
 	executor *ConcurrentExecutor
+	resolver resolver.FileResolver
+	cache    cache.CacheManager
 }
 
 // New creates a new PreCache instance
@@ -29,13 +31,19 @@ func New(config *PreCacheConfig, fileResolver resolver.FileResolver, cacheManage
 	
 	scanner := NewScanner()
 	preCacheProcessor := NewProcessor(config.ImageDir, fileResolver, cacheManager, processor)
+	if config.Warm != nil {
+		preCacheProcessor = NewWarmingProcessor(config.ImageDir, config.Warm)
+	}
 	progress := NewProgress()
 	executor := NewConcurrentExecutor(preCacheProcessor, config.Workers, progress)
+	executor.rate = config.Rate
 	
 	return &PreCache{
 		config:   config,
 		scanner:  scanner,
 		executor: executor,
+		resolver: fileResolver,
+		cache:    cacheManager,
 	}, nil
 }
 
@@ -61,6 +69,9 @@ func (p *PreCache) Run(ctx context.Context) (*Stats, error) {
 		return &Stats{}, nil
 	}
 	
+	// Warm the images used most first
+	imagePaths = p.byAccessFrequency(ctx, imagePaths)
+	
 	// Execute pre-caching with concurrent processing
 	stats, err := p.executor.Execute(ctx, imagePaths)
 	if err != nil {
@@ -70,12 +81,16 @@ func (p *PreCache) Run(ctx context.Context) (*Stats, error) {
 	return stats, nil
 }
 
-// RunAsync executes the pre-cache process asynchronously
+// RunAsync executes the pre-cache process asynchronously, calling the
+// configured Done function once it has ended
 func (p *PreCache) RunAsync(ctx context.Context) {
 	go func() {
-		_, err := p.Run(ctx)
+		stats, err := p.Run(ctx)
 		if err != nil {
 			log.Printf("Pre-cache async error: %v", err)
 		}
+		if p.config.Done != nil {
+			p.config.Done(stats, err)
+		}
 	}()
 }
@@ -0,0 +1,47 @@
+package precache
+
+import (
+	"cmp"
+	"context"
+	"goimgserver/cache"
+	"log"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// byAccessFrequency orders image paths by the uses counted for their cached
+// renditions, most used first, keeping the scan order among images used
+// equally often. Images cached under another key, such as a content path,
+// count as unused.
+func (p *PreCache) byAccessFrequency(ctx context.Context, imagePaths []string) []string {
+	if p.cache == nil || p.resolver == nil {
+		return imagePaths
+	}
+	sourceHits := make(map[string]int)
+	err := p.cache.IterateContext(ctx, func(entry cache.CacheEntry) bool {
+		sourceHits[entry.Source] += entry.Hits
+		return true
+	})
+	if err != nil {
+		log.Printf("Warning: failed to read cache access counts, warming in scan order: %v", err)
+		return imagePaths
+	}
+
+	hits := make(map[string]int, len(imagePaths))
+	for _, imagePath := range imagePaths {
+		relPath, err := filepath.Rel(p.config.ImageDir, imagePath)
+		if err != nil {
+			continue
+		}
+		result, err := p.resolver.Resolve(relPath)
+		if err != nil {
+			continue
+		}
+		hits[imagePath] = sourceHits[strings.TrimPrefix(filepath.ToSlash(result.ResolvedPath), "/")]
+	}
+	slices.SortStableFunc(imagePaths, func(a, b string) int {
+		return cmp.Compare(hits[b], hits[a])
+	})
+	return imagePaths
+}
@@ -0,0 +1,58 @@
+package precache
+
+import (
+	"context"
+	"goimgserver/cache"
+	"goimgserver/resolver"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that the images whose renditions are used most are warmed first
+func Test_PreCache_WarmsFrequentlyUsedFirst(t *testing.T) {
+	imageDir := t.TempDir()
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg"} {
+		require.NoError(t, os.WriteFile(filepath.Join(imageDir, name), []byte("image"), 0644))
+	}
+	fileResolver := resolver.NewResolverWithCache(imageDir)
+	cacheManager, err := cache.NewManager(t.TempDir())
+	require.NoError(t, err)
+
+	// c is used most, then b; a and d are not cached
+	thumb := cache.ProcessingParams{Width: 100, Height: 100, Format: "webp", Quality: 80}
+	for name, uses := range map[string]int{"b.jpg": 1, "c.jpg": 3} {
+		result, err := fileResolver.Resolve(name)
+		require.NoError(t, err)
+		require.NoError(t, cacheManager.Store(result.ResolvedPath, thumb, []byte("thumb")))
+		for range uses {
+			_, found, err := cacheManager.Retrieve(result.ResolvedPath, thumb)
+			require.NoError(t, err)
+			require.True(t, found)
+		}
+	}
+
+	var mu sync.Mutex
+	var warmed []string
+	config := &PreCacheConfig{
+		ImageDir: imageDir,
+		Enabled:  true,
+		Workers:  1,
+		Warm: func(ctx context.Context, path string, params cache.ProcessingParams) error {
+			mu.Lock()
+			defer mu.Unlock()
+			warmed = append(warmed, path)
+			return nil
+		},
+	}
+	preCache, err := New(config, fileResolver, cacheManager, &mockImageProcessor{})
+	require.NoError(t, err)
+
+	_, err = preCache.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c.jpg", "b.jpg", "a.jpg", "d.jpg"}, warmed)
+}
@@ -9,6 +9,14 @@ import (
 	"path/filepath"
 )
 
+// DefaultParams are the pre-cache rendition parameters (1000x1000, WebP, q95)
+var DefaultParams = cache.ProcessingParams{
+	Width:   1000,
+	Height:  1000,
+	Format:  "webp",
+	Quality: 95,
+}
+
 // ProcessorInterface defines the minimal interface for image processing
 type ProcessorInterface interface {
 	Process(data []byte, opts interface{}) ([]byte, error)
@@ -46,13 +54,7 @@ func (p *preCacheProcessor) Process(ctx context.Context, imagePath string) error
 		return fmt.Errorf("failed to resolve path: %w", err)
 	}
 	
-	// Define default pre-cache parameters (1000x1000, WebP, q95)
-	params := cache.ProcessingParams{
-		Width:   1000,
-		Height:  1000,
-		Format:  "webp",
-		Quality: 95,
-	}
+	params := DefaultParams
 	
 	// Check if already cached
 	if p.cache.Exists(result.ResolvedPath, params) {
@@ -80,3 +82,31 @@ func (p *preCacheProcessor) Process(ctx context.Context, imagePath string) error
 	
 	return nil
 }
+
+// warmingProcessor implements Processor by handing each image to a WarmFunc
+type warmingProcessor struct {
+	imageDir string
+	warm     WarmFunc
+}
+
+// NewWarmingProcessor creates a pre-cache processor that renders through
+// warm, e.g. the image handler, instead of processing images itself
+func NewWarmingProcessor(imageDir string, warm WarmFunc) Processor {
+	return &warmingProcessor{
+		imageDir: imageDir,
+		warm:     warm,
+	}
+}
+
+// Process warms the default rendition of a single image
+func (p *warmingProcessor) Process(ctx context.Context, imagePath string) error {
+	relPath, err := filepath.Rel(p.imageDir, imagePath)
+	if err != nil {
+		return fmt.Errorf("failed to get relative path: %w", err)
+	}
+	
+	if err := p.warm(ctx, filepath.ToSlash(relPath), DefaultParams); err != nil {
+		return fmt.Errorf("failed to warm image: %w", err)
+	}
+	return nil
+}
@@ -317,3 +317,24 @@ func getTestJPEGData() []byte {
 		0x7f, 0xff, 0xd9,
 	}
 }
+
+func Test_WarmingProcessor_UsesWarmFunc(t *testing.T) {
+	imageDir := t.TempDir()
+	imagePath := filepath.Join(imageDir, "cats", "cat.jpg")
+	
+	var gotPath string
+	var gotParams cache.ProcessingParams
+	proc := NewWarmingProcessor(imageDir, func(ctx context.Context, path string, params cache.ProcessingParams) error {
+		gotPath, gotParams = path, params
+		return nil
+	})
+	
+	require.NoError(t, proc.Process(context.Background(), imagePath))
+	assert.Equal(t, "cats/cat.jpg", gotPath)
+	assert.Equal(t, DefaultParams, gotParams)
+	
+	failing := NewWarmingProcessor(imageDir, func(context.Context, string, cache.ProcessingParams) error {
+		return assert.AnError
+	})
+	assert.ErrorIs(t, failing.Process(context.Background(), imagePath), assert.AnError)
+}
@@ -12,6 +12,8 @@ var supportedExtensions = map[string]bool{
 	".jpeg": true,
 	".png":  true,
 	".webp": true,
+	".heic": true,
+	".heif": true,
 }
 
 // directoryScanner implements Scanner interface
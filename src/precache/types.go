@@ -3,6 +3,7 @@ package precache
 import (
 	"context"
 	"errors"
+	"goimgserver/cache"
 	"time"
 )
 
@@ -23,6 +24,14 @@ type Processor interface {
 	Process(ctx context.Context, imagePath string) error
 }
 
+// WarmFunc renders and caches the rendition of the image at path, relative
+// to the image directory, unless it is already cached
+type WarmFunc func(ctx context.Context, path string, params cache.ProcessingParams) error
+
+// DoneFunc is told the outcome of a pre-cache run; stats is nil when the
+// images could not be scanned
+type DoneFunc func(stats *Stats, err error)
+
 // ProgressReporter reports progress during pre-caching
 type ProgressReporter interface {
 	// Start begins progress tracking
@@ -45,6 +54,9 @@ type PreCacheConfig struct {
 	DefaultImagePath string
 	Enabled          bool
 	Workers          int
+	Rate             float64  // Images per second, 0 = unlimited
+	Warm             WarmFunc // Renders through the server when set, sharing in-flight processing with live requests
+	Done             DoneFunc // Called by RunAsync once the run has ended
 }
 
 // Stats contains pre-cache statistics
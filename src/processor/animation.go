@@ -0,0 +1,416 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/gif"
+	"image/png"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// MaxAnimationPixels bounds the frames times output pixels of an animated
+// WebP encoded in Go; larger animations are served as a still WebP
+const MaxAnimationPixels = 64 << 20
+
+// errAnimationTooLarge is returned when an animation exceeds its pixel budget
+var errAnimationTooLarge = errors.New("animation exceeds the pixel budget")
+
+// webpChunk is a RIFF chunk of a WebP file
+type webpChunk struct {
+	fourCC  string
+	payload []byte
+}
+
+// webpFrame is an ANMF frame of an animated WebP
+type webpFrame struct {
+	x, y          int
+	width, height int
+	noBlend       bool // Replace the canvas area instead of alpha blending
+	dispose       bool // Clear the frame area to transparent after display
+	chunks        []webpChunk
+}
+
+// FrameCount returns the number of frames in an animated GIF or WebP, or 1
+// for any other image
+func FrameCount(data []byte) int {
+	switch {
+	case isGIF(data):
+		if g, err := gif.DecodeAll(bytes.NewReader(data)); err == nil && len(g.Image) > 0 {
+			return len(g.Image)
+		}
+	case isWebP(data):
+		if _, frames, err := parseAnimatedWebP(data); err == nil && len(frames) > 0 {
+			return len(frames)
+		}
+	}
+	return 1
+}
+
+// ExtractFrame renders frame index of an animated GIF or WebP onto the full
+// canvas and returns it as PNG. Indices past the last frame select the last
+// frame. Images that are not animated are returned unchanged.
+func ExtractFrame(data []byte, index int) ([]byte, error) {
+	if FrameCount(data) <= 1 {
+		return data, nil
+	}
+	if index < 0 {
+		index = 0
+	}
+
+	var frame image.Image
+	var err error
+	if isGIF(data) {
+		frame, err = gifFrame(data, index)
+	} else {
+		frame, err = webpAnimationFrame(data, index)
+	}
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, frame); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// isGIF reports whether data starts with a GIF signature
+func isGIF(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("GIF87a")) || bytes.HasPrefix(data, []byte("GIF89a"))
+}
+
+// isWebP reports whether data is a RIFF WebP container
+func isWebP(data []byte) bool {
+	return len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP"
+}
+
+// gifFrame composites GIF frames up to index, honouring each frame's disposal
+func gifFrame(data []byte, index int) (image.Image, error) {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	index = min(index, len(g.Image)-1)
+
+	var frame image.Image
+	err = compositeGIF(g, func(i int, canvas *image.RGBA) bool {
+		frame = canvas
+		return i < index
+	})
+	return frame, err
+}
+
+// compositeGIF draws the frames of g in order and calls visit with the
+// canvas after each one, before the frame is disposed. The canvas is reused,
+// so visit must copy what it keeps. Returning false stops early.
+func compositeGIF(g *gif.GIF, visit func(index int, canvas *image.RGBA) bool) error {
+	if len(g.Image) == 0 {
+		return ErrInvalidImage
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	for i, frame := range g.Image {
+		var previous *image.RGBA
+		if g.Disposal[i] == gif.DisposalPrevious {
+			previous = image.NewRGBA(canvas.Bounds())
+			draw.Draw(previous, previous.Bounds(), canvas, image.Point{}, draw.Src)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		if !visit(i, canvas) {
+			break
+		}
+
+		switch g.Disposal[i] {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return nil
+}
+
+// animatedWebP re-encodes an animated GIF as a lossless animated WebP of
+// width x height, sized like bimg: both dimensions stretch, a single one
+// keeps the aspect ratio. Frames only carry the area that changed since the
+// previous frame and unchanged frames extend the previous duration.
+// Animations of more than maxPixels frames times output pixels return
+// errAnimationTooLarge.
+func animatedWebP(data []byte, width, height, maxPixels int) ([]byte, error) {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	width, height = scaledSize(g.Config.Width, g.Config.Height, width, height)
+	if len(g.Image)*width*height > maxPixels {
+		return nil, errAnimationTooLarge
+	}
+
+	// Enlarging keeps the GIF palette, which the encoder codes far smaller
+	var scaler draw.Scaler = draw.CatmullRom
+	if width > g.Config.Width || height > g.Config.Height {
+		scaler = draw.NearestNeighbor
+	}
+
+	type animationFrame struct {
+		img      *image.NRGBA
+		duration int
+	}
+	var frames []animationFrame
+	var previous *image.NRGBA
+	alpha := false
+	err = compositeGIF(g, func(i int, canvas *image.RGBA) bool {
+		scaled := image.NewNRGBA(image.Rect(0, 0, width, height))
+		scaler.Scale(scaled, scaled.Bounds(), canvas, canvas.Bounds(), draw.Src, nil)
+
+		changed := scaled.Bounds()
+		if previous != nil {
+			changed = changedRect(previous, scaled)
+		}
+		duration := gifDelay(g.Delay[i])
+		if changed.Empty() {
+			frames[len(frames)-1].duration += duration
+			return true
+		}
+
+		// Frame offsets are stored halved. Each frame keeps a copy of its
+		// area only, so the full canvases are not retained.
+		changed.Min.X &^= 1
+		changed.Min.Y &^= 1
+		frame := image.NewNRGBA(changed)
+		draw.Draw(frame, changed, scaled, changed.Min, draw.Src)
+		alpha = alpha || !frame.Opaque()
+		frames = append(frames, animationFrame{img: frame, duration: duration})
+		previous = scaled
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+
+	header := make([]byte, 10)
+	header[0] = 0x02 // Animation flag
+	if alpha {
+		header[0] |= 0x10
+	}
+	putUint24(header[4:], width-1)
+	putUint24(header[7:], height-1)
+	writeWebPChunk(&body, "VP8X", header)
+
+	// Transparent background and the GIF's loop count
+	anim := make([]byte, 6)
+	binary.LittleEndian.PutUint16(anim[4:], uint16(webpLoopCount(g.LoopCount)))
+	writeWebPChunk(&body, "ANIM", anim)
+
+	for _, frame := range frames {
+		var payload bytes.Buffer
+		rect := frame.img.Rect
+		frameHeader := make([]byte, 16)
+		putUint24(frameHeader[0:], rect.Min.X/2)
+		putUint24(frameHeader[3:], rect.Min.Y/2)
+		putUint24(frameHeader[6:], rect.Dx()-1)
+		putUint24(frameHeader[9:], rect.Dy()-1)
+		putUint24(frameHeader[12:], min(frame.duration, 1<<24-1))
+		frameHeader[15] = 0x02 // Replace the area instead of blending
+		payload.Write(frameHeader)
+		writeWebPChunk(&payload, "VP8L", EncodeVP8L(frame.img))
+		writeWebPChunk(&body, "ANMF", payload.Bytes())
+	}
+
+	var riff bytes.Buffer
+	writeWebPChunk(&riff, "RIFF", body.Bytes())
+	return riff.Bytes(), nil
+}
+
+// scaledSize returns the output size for a source of srcWidth x srcHeight
+func scaledSize(srcWidth, srcHeight, width, height int) (int, int) {
+	switch {
+	case width > 0 && height > 0:
+		return width, height
+	case width > 0:
+		return width, max(1, (srcHeight*width+srcWidth/2)/srcWidth)
+	case height > 0:
+		return max(1, (srcWidth*height+srcHeight/2)/srcHeight), height
+	default:
+		return srcWidth, srcHeight
+	}
+}
+
+// changedRect returns the bounding box of the pixels that differ between a and b
+func changedRect(a, b *image.NRGBA) image.Rectangle {
+	var changed image.Rectangle
+	for y := b.Rect.Min.Y; y < b.Rect.Max.Y; y++ {
+		rowA := a.Pix[a.PixOffset(b.Rect.Min.X, y):]
+		rowB := b.Pix[b.PixOffset(b.Rect.Min.X, y):]
+		for x := 0; x < b.Rect.Dx(); x++ {
+			if !bytes.Equal(rowA[x*4:x*4+4], rowB[x*4:x*4+4]) {
+				changed = changed.Union(image.Rect(b.Rect.Min.X+x, y, b.Rect.Min.X+x+1, y+1))
+			}
+		}
+	}
+	return changed
+}
+
+// gifDelay converts a GIF delay in hundredths of a second to milliseconds.
+// Like browsers, delays of 10ms or less play at 100ms.
+func gifDelay(delay int) int {
+	if delay <= 1 {
+		return 100
+	}
+	return delay * 10
+}
+
+// webpLoopCount converts a GIF loop count (0 = forever, -1 = play once,
+// n = n extra loops) to an ANIM loop count (0 = forever, n = play n times)
+func webpLoopCount(loopCount int) int {
+	switch {
+	case loopCount == 0:
+		return 0
+	case loopCount < 0:
+		return 1
+	default:
+		return min(loopCount+1, 0xffff)
+	}
+}
+
+// webpAnimationFrame composites animated WebP frames up to index
+func webpAnimationFrame(data []byte, index int) (image.Image, error) {
+	canvasRect, frames, err := parseAnimatedWebP(data)
+	if err != nil {
+		return nil, err
+	}
+	index = min(index, len(frames)-1)
+
+	canvas := image.NewRGBA(canvasRect)
+	for i := 0; i <= index; i++ {
+		frame := frames[i]
+		decoded, err := webp.Decode(bytes.NewReader(frame.still()))
+		if err != nil {
+			return nil, err
+		}
+
+		rect := image.Rect(frame.x, frame.y, frame.x+frame.width, frame.y+frame.height)
+		op := draw.Over
+		if frame.noBlend {
+			op = draw.Src
+		}
+		draw.Draw(canvas, rect, decoded, decoded.Bounds().Min, op)
+
+		if frame.dispose && i < index {
+			draw.Draw(canvas, rect, image.Transparent, image.Point{}, draw.Src)
+		}
+	}
+	return canvas, nil
+}
+
+// parseAnimatedWebP returns the canvas and frames of an animated WebP
+func parseAnimatedWebP(data []byte) (image.Rectangle, []webpFrame, error) {
+	chunks, err := parseWebPChunks(data[12:])
+	if err != nil {
+		return image.Rectangle{}, nil, err
+	}
+
+	var canvas image.Rectangle
+	var frames []webpFrame
+	for _, chunk := range chunks {
+		switch chunk.fourCC {
+		case "VP8X":
+			if len(chunk.payload) < 10 {
+				return image.Rectangle{}, nil, ErrInvalidImage
+			}
+			canvas = image.Rect(0, 0, uint24(chunk.payload[4:])+1, uint24(chunk.payload[7:])+1)
+		case "ANMF":
+			if len(chunk.payload) < 16 {
+				return image.Rectangle{}, nil, ErrInvalidImage
+			}
+			p := chunk.payload
+			frameChunks, err := parseWebPChunks(p[16:])
+			if err != nil {
+				return image.Rectangle{}, nil, err
+			}
+			frames = append(frames, webpFrame{
+				x:       uint24(p[0:]) * 2,
+				y:       uint24(p[3:]) * 2,
+				width:   uint24(p[6:]) + 1,
+				height:  uint24(p[9:]) + 1,
+				noBlend: p[15]&0x02 != 0,
+				dispose: p[15]&0x01 != 0,
+				chunks:  frameChunks,
+			})
+		}
+	}
+	return canvas, frames, nil
+}
+
+// parseWebPChunks splits RIFF chunk data, skipping the odd-size padding byte
+func parseWebPChunks(data []byte) ([]webpChunk, error) {
+	var chunks []webpChunk
+	for pos := 0; pos+8 <= len(data); {
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		start := pos + 8
+		if size < 0 || size > len(data)-start {
+			return nil, ErrInvalidImage
+		}
+		chunks = append(chunks, webpChunk{fourCC: string(data[pos : pos+4]), payload: data[start : start+size]})
+		pos = start + size + size&1
+	}
+	return chunks, nil
+}
+
+// still wraps the frame's bitstream as a standalone WebP. Frames with an
+// ALPH chunk need the extended VP8X header to carry their alpha.
+func (f webpFrame) still() []byte {
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	for _, chunk := range f.chunks {
+		if chunk.fourCC == "ALPH" {
+			header := make([]byte, 10)
+			header[0] = 0x10 // Alpha flag
+			putUint24(header[4:], f.width-1)
+			putUint24(header[7:], f.height-1)
+			writeWebPChunk(&body, "VP8X", header)
+			break
+		}
+	}
+	for _, chunk := range f.chunks {
+		switch chunk.fourCC {
+		case "ALPH", "VP8 ", "VP8L":
+			writeWebPChunk(&body, chunk.fourCC, chunk.payload)
+		}
+	}
+
+	var riff bytes.Buffer
+	writeWebPChunk(&riff, "RIFF", body.Bytes())
+	return riff.Bytes()
+}
+
+// writeWebPChunk appends a RIFF chunk with its padding byte
+func writeWebPChunk(buf *bytes.Buffer, fourCC string, payload []byte) {
+	buf.WriteString(fourCC)
+	binary.Write(buf, binary.LittleEndian, uint32(len(payload)))
+	buf.Write(payload)
+	if len(payload)%2 == 1 {
+		buf.WriteByte(0)
+	}
+}
+
+// uint24 reads a little-endian 24-bit integer
+func uint24(b []byte) int {
+	return int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+}
+
+// putUint24 writes a little-endian 24-bit integer
+func putUint24(b []byte, v int) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+}
@@ -0,0 +1,257 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"slices"
+	"testing"
+)
+
+// Fixtures: animated.gif and animated.webp are 20x20 with three frames:
+// red, a green 10x10 square at (10,10) over the red, and blue
+var (
+	red   = color.RGBA{255, 0, 0, 255}
+	green = color.RGBA{0, 255, 0, 255}
+	blue  = color.RGBA{0, 0, 255, 255}
+)
+
+// Test frame counting for animated and static images
+func TestFrameCount(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     int
+	}{
+		{"animated.gif", 3},
+		{"animated.webp", 3},
+		{"sample.webp", 1},
+		{"sample.jpg", 1},
+		{"sample.png", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			if got := FrameCount(loadTestImage(t, tt.filename)); got != tt.want {
+				t.Errorf("FrameCount() = %d, expected %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// Test extracting frames from animated fixtures
+func TestExtractFrame(t *testing.T) {
+	tests := []struct {
+		name        string
+		index       int
+		topLeft     color.RGBA
+		bottomRight color.RGBA
+	}{
+		{"First frame", 0, red, red},
+		{"Middle frame composited over the first", 1, red, green},
+		{"Last frame", 2, blue, blue},
+		{"Out of range clamps to last frame", 99, blue, blue},
+		{"Negative index selects first frame", -1, red, red},
+	}
+
+	for _, filename := range []string{"animated.gif", "animated.webp"} {
+		data := loadTestImage(t, filename)
+		for _, tt := range tests {
+			t.Run(filename+"/"+tt.name, func(t *testing.T) {
+				frame, err := ExtractFrame(data, tt.index)
+				if err != nil {
+					t.Fatalf("ExtractFrame() returned error: %v", err)
+				}
+
+				img, err := png.Decode(bytes.NewReader(frame))
+				if err != nil {
+					t.Fatalf("Frame is not a PNG: %v", err)
+				}
+				if img.Bounds() != image.Rect(0, 0, 20, 20) {
+					t.Errorf("Expected 20x20 canvas, got %v", img.Bounds())
+				}
+				if got := color.RGBAModel.Convert(img.At(5, 5)); got != tt.topLeft {
+					t.Errorf("Pixel (5,5) = %v, expected %v", got, tt.topLeft)
+				}
+				if got := color.RGBAModel.Convert(img.At(15, 15)); got != tt.bottomRight {
+					t.Errorf("Pixel (15,15) = %v, expected %v", got, tt.bottomRight)
+				}
+			})
+		}
+	}
+}
+
+// Test static images pass through unchanged
+func TestExtractFrame_StaticImage(t *testing.T) {
+	data := loadTestImage(t, "sample.png")
+
+	frame, err := ExtractFrame(data, 3)
+	if err != nil {
+		t.Fatalf("ExtractFrame() returned error: %v", err)
+	}
+	if !bytes.Equal(frame, data) {
+		t.Error("Expected static image to be returned unchanged")
+	}
+}
+
+// Test GetMetadata reports the frame count
+func TestGetMetadata_Frames(t *testing.T) {
+	metadata, err := GetMetadata(loadTestImage(t, "animated.gif"))
+	if err != nil {
+		t.Fatalf("GetMetadata failed: %v", err)
+	}
+	if metadata.Frames != 3 || !metadata.Animated() {
+		t.Errorf("Expected 3 animated frames, got %d", metadata.Frames)
+	}
+}
+
+// Test Process renders the requested poster frame
+func TestImageProcessor_Process_Poster(t *testing.T) {
+	processor := New()
+	data := loadTestImage(t, "animated.gif")
+
+	opts := ProcessOptions{Width: 20, Height: 20, Format: FormatPNG, Quality: DefaultQuality, Poster: true, Frame: 2}
+	result, err := processor.Process(data, opts)
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(result))
+	if err != nil {
+		t.Fatalf("Result is not a PNG: %v", err)
+	}
+	if got := color.RGBAModel.Convert(img.At(10, 10)); got != blue {
+		t.Errorf("Pixel (10,10) = %v, expected %v", got, blue)
+	}
+}
+
+// Test Process keeps the animation of GIFs converted to WebP
+func TestImageProcessor_Process_AnimatedGIF(t *testing.T) {
+	processor := New()
+	data := loadTestImage(t, "animated.gif")
+
+	tests := []struct {
+		name   string
+		opts   ProcessOptions
+		frames int
+	}{
+		{"Animated WebP", ProcessOptions{Width: 40, Height: 40, Format: FormatWebP, Quality: DefaultQuality, Animate: true}, 3},
+		{"Without Animate", ProcessOptions{Width: 40, Height: 40, Format: FormatWebP, Quality: DefaultQuality}, 1},
+		{"Poster wins", ProcessOptions{Width: 40, Height: 40, Format: FormatWebP, Quality: DefaultQuality, Animate: true, Poster: true}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := processor.Process(data, tt.opts)
+			if err != nil {
+				t.Fatalf("Process failed: %v", err)
+			}
+			if got := FrameCount(result); got != tt.frames {
+				t.Errorf("FrameCount() = %d, expected %d", got, tt.frames)
+			}
+		})
+	}
+}
+
+// Test animated GIFs convert to an animated WebP with the same frames
+func TestAnimatedWebP(t *testing.T) {
+	data := loadTestImage(t, "animated.gif")
+
+	result, err := animatedWebP(data, 40, 0, MaxAnimationPixels)
+	if err != nil {
+		t.Fatalf("animatedWebP failed: %v", err)
+	}
+	if !isWebP(result) {
+		t.Fatal("Result is not a WebP")
+	}
+	if got := FrameCount(result); got != 3 {
+		t.Fatalf("FrameCount() = %d, expected 3", got)
+	}
+
+	canvas, frames, err := parseAnimatedWebP(result)
+	if err != nil {
+		t.Fatalf("parseAnimatedWebP failed: %v", err)
+	}
+	if canvas != image.Rect(0, 0, 40, 40) {
+		t.Errorf("Canvas = %v, expected 40x40", canvas)
+	}
+	// The green square is the only change of the second frame
+	if second := frames[1]; second.x != 20 || second.y != 20 || second.width != 20 || second.height != 20 {
+		t.Errorf("Second frame covers (%d,%d) %dx%d, expected (20,20) 20x20", second.x, second.y, second.width, second.height)
+	}
+
+	expected := [][2]color.RGBA{{red, red}, {red, green}, {blue, blue}}
+	for i, want := range expected {
+		frame, err := ExtractFrame(result, i)
+		if err != nil {
+			t.Fatalf("ExtractFrame(%d) failed: %v", i, err)
+		}
+		img, err := png.Decode(bytes.NewReader(frame))
+		if err != nil {
+			t.Fatalf("Frame %d is not a PNG: %v", i, err)
+		}
+		if got := color.RGBAModel.Convert(img.At(10, 10)); got != want[0] {
+			t.Errorf("Frame %d pixel (10,10) = %v, expected %v", i, got, want[0])
+		}
+		if got := color.RGBAModel.Convert(img.At(30, 30)); got != want[1] {
+			t.Errorf("Frame %d pixel (30,30) = %v, expected %v", i, got, want[1])
+		}
+	}
+}
+
+// Test animations over the pixel budget are refused so Process falls back
+// to a still WebP
+func TestAnimatedWebP_PixelBudget(t *testing.T) {
+	data := loadTestImage(t, "animated.gif")
+
+	if _, err := animatedWebP(data, 40, 40, 3*40*40); err != nil {
+		t.Errorf("animatedWebP within budget failed: %v", err)
+	}
+	if _, err := animatedWebP(data, 40, 40, 3*40*40-1); !errors.Is(err, errAnimationTooLarge) {
+		t.Errorf("animatedWebP over budget error = %v, expected %v", err, errAnimationTooLarge)
+	}
+}
+
+// Test GIF delays and loop counts map to their WebP equivalents and
+// repeated frames extend the previous frame
+func TestAnimatedWebP_Timing(t *testing.T) {
+	g, err := gif.DecodeAll(bytes.NewReader(loadTestImage(t, "animated.gif")))
+	if err != nil {
+		t.Fatalf("DecodeAll failed: %v", err)
+	}
+	g.Image = append(g.Image, g.Image[2])
+	g.Disposal = append(g.Disposal, gif.DisposalNone)
+	g.Delay = []int{0, 50, 50, 30}
+	g.LoopCount = 2
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatalf("EncodeAll failed: %v", err)
+	}
+
+	result, err := animatedWebP(buf.Bytes(), 0, 0, MaxAnimationPixels)
+	if err != nil {
+		t.Fatalf("animatedWebP failed: %v", err)
+	}
+	chunks, err := parseWebPChunks(result[12:])
+	if err != nil {
+		t.Fatalf("parseWebPChunks failed: %v", err)
+	}
+
+	var durations []int
+	for _, chunk := range chunks {
+		switch chunk.fourCC {
+		case "ANIM":
+			if loops := binary.LittleEndian.Uint16(chunk.payload[4:]); loops != 3 {
+				t.Errorf("Loop count = %d, expected 3", loops)
+			}
+		case "ANMF":
+			durations = append(durations, uint24(chunk.payload[12:]))
+		}
+	}
+	if want := []int{100, 500, 800}; !slices.Equal(durations, want) {
+		t.Errorf("Durations = %v, expected %v", durations, want)
+	}
+}
@@ -0,0 +1,78 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"sort"
+
+	"github.com/h2non/bimg"
+)
+
+// FormatSupport reports whether a format can be decoded and encoded
+type FormatSupport struct {
+	Input  bool `json:"input"`
+	Output bool `json:"output"`
+}
+
+// CapabilityInfo describes the linked image library and its codecs
+type CapabilityInfo struct {
+	VipsVersion string                   `json:"vips_version"`
+	BimgVersion string                   `json:"bimg_version"`
+	Formats     map[string]FormatSupport `json:"formats"`
+}
+
+// Capabilities reports the libvips version and which formats the linked
+// build can read and write. Codecs such as AVIF and HEIF are optional in
+// libvips, so the result differs between installations.
+func Capabilities() CapabilityInfo {
+	info := CapabilityInfo{
+		VipsVersion: bimg.VipsVersion,
+		BimgVersion: bimg.Version,
+		Formats:     make(map[string]FormatSupport, len(bimg.ImageTypes)),
+	}
+
+	for imageType, name := range bimg.ImageTypes {
+		supported := bimg.IsImageTypeSupportedByVips(imageType)
+		info.Formats[name] = FormatSupport{Input: supported.Load, Output: supported.Save}
+	}
+
+	// PDF pages are written without libvips, wrapping a JPEG
+	pdf := info.Formats[string(FormatPDF)]
+	pdf.Output = PDFSupported()
+	info.Formats[string(FormatPDF)] = pdf
+
+	return info
+}
+
+// OutputFormats returns the sorted names of formats that can be produced
+func (c CapabilityInfo) OutputFormats() []string {
+	var formats []string
+	for name, support := range c.Formats {
+		if support.Output {
+			formats = append(formats, name)
+		}
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// Probe checks that the linked libvips can actually transcode by resizing a
+// tiny image to every output format. Tests use it to skip real processing
+// where libvips or one of its codecs is unavailable.
+func Probe() error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 16, 16))); err != nil {
+		return err
+	}
+
+	proc := New()
+	for _, format := range []ImageFormat{FormatJPEG, FormatPNG, FormatWebP} {
+		opts := ProcessOptions{Width: MinDimension, Height: MinDimension, Format: format, Quality: DefaultQuality}
+		if _, err := proc.Process(buf.Bytes(), opts); err != nil {
+			return fmt.Errorf("libvips cannot produce %s: %w", format, err)
+		}
+	}
+	return nil
+}
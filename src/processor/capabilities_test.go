@@ -0,0 +1,40 @@
+package processor
+
+import (
+	"slices"
+	"testing"
+)
+
+// Test Capabilities reports the core formats
+func TestCapabilities_CoreFormats(t *testing.T) {
+	info := Capabilities()
+
+	if info.VipsVersion == "" {
+		t.Error("Expected a libvips version")
+	}
+	for _, format := range []ImageFormat{FormatJPEG, FormatPNG, FormatWebP} {
+		support, ok := info.Formats[string(format)]
+		if !ok {
+			t.Errorf("Expected %s in capabilities", format)
+			continue
+		}
+		if !support.Input || !support.Output {
+			t.Errorf("Expected %s input and output support, got %+v", format, support)
+		}
+	}
+}
+
+// Test OutputFormats lists only writable formats in order
+func TestCapabilityInfo_OutputFormats(t *testing.T) {
+	info := CapabilityInfo{Formats: map[string]FormatSupport{
+		"webp": {Input: true, Output: true},
+		"gif":  {Input: true},
+		"jpeg": {Input: true, Output: true},
+	}}
+
+	formats := info.OutputFormats()
+
+	if !slices.Equal(formats, []string{"jpeg", "webp"}) {
+		t.Errorf("OutputFormats() = %v, expected [jpeg webp]", formats)
+	}
+}
@@ -0,0 +1,210 @@
+package processor
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// CaptionPosition places a caption on the image
+type CaptionPosition string
+
+const (
+	CaptionBottom CaptionPosition = "bottom" // Default
+	CaptionTop    CaptionPosition = "top"
+	CaptionCenter CaptionPosition = "center"
+)
+
+// Caption limits: the length in characters and the font size in pixels
+const (
+	MaxCaptionLength   = 200
+	DefaultCaptionSize = 48
+	MinCaptionSize     = 8
+	MaxCaptionSize     = 200
+)
+
+// DefaultCaptionColor is the text color when none is given
+const DefaultCaptionColor = "ffffff"
+
+// captionBand darkens the rows behind a caption so light text stays
+// readable on any image
+var captionBand = color.NRGBA{A: 128}
+
+// ErrInvalidCaption is returned for captions that cannot be drawn
+var ErrInvalidCaption = errors.New("invalid caption: text must be 1-200 printable characters, size 8-200, position top, center or bottom")
+
+// Caption is text drawn across the output, e.g. the title of an Open Graph
+// image. Text is drawn as given, never interpreted as markup.
+type Caption struct {
+	Text     string
+	Position CaptionPosition // Empty = bottom
+	Size     int             // Font size in pixels, 0 = DefaultCaptionSize
+	Color    string          // RRGGBB hex, empty = DefaultCaptionColor
+}
+
+// Validate reports whether the caption can be drawn. A caption without
+// text draws nothing and is valid.
+func (c Caption) Validate() error {
+	if c.Text == "" {
+		return nil
+	}
+	if !utf8.ValidString(c.Text) || utf8.RuneCountInString(c.Text) > MaxCaptionLength || strings.TrimSpace(c.Text) == "" {
+		return ErrInvalidCaption
+	}
+	if strings.ContainsFunc(c.Text, func(r rune) bool { return !unicode.IsPrint(r) }) {
+		return ErrInvalidCaption
+	}
+	if c.Size != 0 && (c.Size < MinCaptionSize || c.Size > MaxCaptionSize) {
+		return ErrInvalidCaption
+	}
+	switch c.Position {
+	case "", CaptionBottom, CaptionTop, CaptionCenter:
+	default:
+		return ErrInvalidCaption
+	}
+	if c.Color != "" {
+		if _, err := ParseColor(c.Color); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// captionFont is the parsed Go Regular font captions are drawn in
+var captionFont = sync.OnceValues(func() (*opentype.Font, error) {
+	return opentype.Parse(goregular.TTF)
+})
+
+// DrawCaption returns a copy of img with the caption drawn on a darkened
+// band across it. Text is wrapped at word boundaries to the image width,
+// lines are centered, and lines that do not fit the height are dropped
+// with the last one kept ending in an ellipsis.
+func DrawCaption(img image.Image, caption Caption) (*image.NRGBA, error) {
+	if err := caption.Validate(); err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(out, out.Bounds(), img, bounds.Min, draw.Src)
+	if caption.Text == "" {
+		return out, nil
+	}
+
+	size := caption.Size
+	if size == 0 {
+		size = DefaultCaptionSize
+	}
+	colorValue := caption.Color
+	if colorValue == "" {
+		colorValue = DefaultCaptionColor
+	}
+	textColor, err := ParseColor(colorValue)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := captionFont()
+	if err != nil {
+		return nil, err
+	}
+	face, err := opentype.NewFace(parsed, &opentype.FaceOptions{Size: float64(size), DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	width, height := out.Bounds().Dx(), out.Bounds().Dy()
+	margin := size / 2
+	metrics := face.Metrics()
+	lineHeight := metrics.Height.Ceil()
+	lines := wrapCaption(face, strings.Fields(caption.Text), fixed.I(width-2*margin))
+	if maxLines := max((height-2*margin)/lineHeight, 1); len(lines) > maxLines {
+		lines = lines[:maxLines]
+		lines[maxLines-1] = ellipsize(face, lines[maxLines-1], fixed.I(width-2*margin))
+	}
+
+	blockHeight := len(lines) * lineHeight
+	top := height - margin - blockHeight
+	switch caption.Position {
+	case CaptionTop:
+		top = margin
+	case CaptionCenter:
+		top = (height - blockHeight) / 2
+	}
+	band := image.Rect(0, top-margin/2, width, top+blockHeight+margin/2).Intersect(out.Bounds())
+	draw.Draw(out, band, image.NewUniform(captionBand), image.Point{}, draw.Over)
+
+	drawer := &font.Drawer{
+		Dst:  out,
+		Src:  image.NewUniform(color.NRGBA{R: textColor.R, G: textColor.G, B: textColor.B, A: 255}),
+		Face: face,
+	}
+	for i, line := range lines {
+		left := (fixed.I(width) - drawer.MeasureString(line)) / 2
+		drawer.Dot = fixed.Point26_6{X: left, Y: fixed.I(top+i*lineHeight) + metrics.Ascent}
+		drawer.DrawString(line)
+	}
+	return out, nil
+}
+
+// wrapCaption breaks words into lines no wider than maxWidth. Words wider
+// than a line on their own are broken between characters.
+func wrapCaption(face font.Face, words []string, maxWidth fixed.Int26_6) []string {
+	var lines []string
+	line := ""
+	for _, word := range words {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if font.MeasureString(face, candidate) <= maxWidth {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+		line = word
+		for font.MeasureString(face, line) > maxWidth && utf8.RuneCountInString(line) > 1 {
+			head := fitCaption(face, line, maxWidth)
+			lines = append(lines, head)
+			line = line[len(head):]
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// fitCaption returns the longest prefix of text, at least one character,
+// no wider than maxWidth
+func fitCaption(face font.Face, text string, maxWidth fixed.Int26_6) string {
+	end := 0
+	for i, r := range text {
+		next := i + utf8.RuneLen(r)
+		if end > 0 && font.MeasureString(face, text[:next]) > maxWidth {
+			break
+		}
+		end = next
+	}
+	return text[:end]
+}
+
+// ellipsize shortens line until it fits maxWidth with an ellipsis appended
+func ellipsize(face font.Face, line string, maxWidth fixed.Int26_6) string {
+	for line != "" && font.MeasureString(face, line+"…") > maxWidth {
+		_, size := utf8.DecodeLastRuneInString(line)
+		line = line[:len(line)-size]
+	}
+	return strings.TrimRight(line, " ") + "…"
+}
@@ -0,0 +1,187 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// changedRows returns the first and last row with a pixel that differs
+// between a and b, or -1, -1 when none does
+func changedRows(a, b image.Image) (first, last int) {
+	first, last = -1, -1
+	bounds := a.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if color.NRGBAModel.Convert(a.At(x, y)) != color.NRGBAModel.Convert(b.At(x, y)) {
+				if first < 0 {
+					first = y
+				}
+				last = y
+				break
+			}
+		}
+	}
+	return first, last
+}
+
+// Test caption limits and the characters a caption may hold
+func TestCaption_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		caption Caption
+		valid   bool
+	}{
+		{"No caption", Caption{}, true},
+		{"Plain", Caption{Text: "Hello, world"}, true},
+		{"Unicode", Caption{Text: "Grüße 🎉"}, true},
+		{"Longest", Caption{Text: strings.Repeat("a", MaxCaptionLength)}, true},
+		{"Too long", Caption{Text: strings.Repeat("a", MaxCaptionLength+1)}, false},
+		{"Blank", Caption{Text: "   "}, false},
+		{"Newline", Caption{Text: "two\nlines"}, false},
+		{"Control character", Caption{Text: "bell\a"}, false},
+		{"Invalid UTF-8", Caption{Text: "\xff\xfe"}, false},
+		{"Markup is text", Caption{Text: "<b>bold</b> & <span font='99'>"}, true},
+		{"Size", Caption{Text: "a", Size: MaxCaptionSize}, true},
+		{"Size too small", Caption{Text: "a", Size: MinCaptionSize - 1}, false},
+		{"Size too large", Caption{Text: "a", Size: MaxCaptionSize + 1}, false},
+		{"Position", Caption{Text: "a", Position: CaptionCenter}, true},
+		{"Unknown position", Caption{Text: "a", Position: "left"}, false},
+		{"Color", Caption{Text: "a", Color: "ff8800"}, true},
+		{"Invalid color", Caption{Text: "a", Color: "orange"}, false},
+	}
+
+	for _, tt := range tests {
+		if err := tt.caption.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: Validate() = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+// Test that the caption changes pixels only in the band at its position,
+// in its color
+func TestDrawCaption(t *testing.T) {
+	src := solidImage(600, 300, color.NRGBA{R: 40, G: 120, B: 200, A: 255})
+
+	tests := []struct {
+		position CaptionPosition
+		minRow   int
+		maxRow   int
+	}{
+		{"", 200, 299},
+		{CaptionBottom, 200, 299},
+		{CaptionTop, 0, 99},
+		{CaptionCenter, 100, 199},
+	}
+
+	for _, tt := range tests {
+		out, err := DrawCaption(src, Caption{Text: "Hello", Position: tt.position, Size: 40, Color: "ffff00"})
+		if err != nil {
+			t.Fatalf("DrawCaption(%q) failed: %v", tt.position, err)
+		}
+		first, last := changedRows(src, out)
+		if first < 0 {
+			t.Fatalf("DrawCaption(%q) changed no pixels", tt.position)
+		}
+		if first < tt.minRow || last > tt.maxRow {
+			t.Errorf("DrawCaption(%q) changed rows %d-%d, want within %d-%d", tt.position, first, last, tt.minRow, tt.maxRow)
+		}
+	}
+
+	// The text is drawn in its color: some pixels are yellow
+	out, err := DrawCaption(src, Caption{Text: "Hello", Size: 40, Color: "ffff00"})
+	if err != nil {
+		t.Fatalf("DrawCaption failed: %v", err)
+	}
+	yellow := false
+	for y := 0; y < 300 && !yellow; y++ {
+		for x := 0; x < 600; x++ {
+			if c := out.NRGBAAt(x, y); c.R == 255 && c.G == 255 && c.B == 0 {
+				yellow = true
+				break
+			}
+		}
+	}
+	if !yellow {
+		t.Error("Expected caption pixels in the text color")
+	}
+
+	// The source is not modified and no text draws nothing
+	if first, _ := changedRows(src, solidImage(600, 300, color.NRGBA{R: 40, G: 120, B: 200, A: 255})); first >= 0 {
+		t.Error("DrawCaption modified its source")
+	}
+	blank, err := DrawCaption(src, Caption{})
+	if err != nil {
+		t.Fatalf("DrawCaption failed: %v", err)
+	}
+	if first, _ := changedRows(src, blank); first >= 0 {
+		t.Error("Expected no change without caption text")
+	}
+
+	if _, err := DrawCaption(src, Caption{Text: strings.Repeat("a", MaxCaptionLength+1)}); err != ErrInvalidCaption {
+		t.Errorf("Expected ErrInvalidCaption for an over-long caption, got %v", err)
+	}
+}
+
+// Test that long captions wrap to the image width and that lines beyond
+// the height are dropped
+func TestDrawCaption_Wrap(t *testing.T) {
+	src := solidImage(200, 400, color.Black)
+	short, err := DrawCaption(src, Caption{Text: "Hi", Size: 20})
+	if err != nil {
+		t.Fatalf("DrawCaption failed: %v", err)
+	}
+	long, err := DrawCaption(src, Caption{Text: strings.Repeat("word ", 20), Size: 20})
+	if err != nil {
+		t.Fatalf("DrawCaption failed: %v", err)
+	}
+	shortFirst, _ := changedRows(src, short)
+	longFirst, _ := changedRows(src, long)
+	if longFirst >= shortFirst {
+		t.Errorf("Expected a wrapped caption to take more rows: starts at %d, one line at %d", longFirst, shortFirst)
+	}
+
+	// A caption taller than the image keeps within it
+	small := solidImage(100, 40, color.Black)
+	out, err := DrawCaption(small, Caption{Text: strings.Repeat("overflowing ", 16), Size: 16})
+	if err != nil {
+		t.Fatalf("DrawCaption failed: %v", err)
+	}
+	if out.Bounds() != small.Bounds() {
+		t.Errorf("Expected bounds %v, got %v", small.Bounds(), out.Bounds())
+	}
+}
+
+func TestImageProcessor_Process_Caption(t *testing.T) {
+	processor := New()
+	data := colorfulPNG(t)
+	plain, err := processor.Process(data, ProcessOptions{Width: 64, Height: 48, Format: FormatPNG, Quality: 90})
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	result, err := processor.Process(data, ProcessOptions{Width: 64, Height: 48, Format: FormatPNG, Quality: 90, Caption: Caption{Text: "Hi", Size: 12, Position: CaptionTop}})
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	plainImg, err := png.Decode(bytes.NewReader(plain))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(result))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	first, last := changedRows(plainImg, img)
+	if first < 0 || last >= 24 {
+		t.Errorf("Expected the caption to change the top half only, changed rows %d-%d", first, last)
+	}
+
+	caption := Caption{Text: strings.Repeat("a", MaxCaptionLength+1)}
+	if _, err := processor.Process(data, ProcessOptions{Width: 64, Format: FormatPNG, Quality: 90, Caption: caption}); err != ErrInvalidCaption {
+		t.Errorf("Expected ErrInvalidCaption, got %v", err)
+	}
+}
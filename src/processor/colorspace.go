@@ -0,0 +1,58 @@
+package processor
+
+import (
+	"errors"
+
+	"github.com/h2non/bimg"
+)
+
+// ColorSpace selects the color space of processed images
+type ColorSpace string
+
+const (
+	ColorSpaceSRGB     ColorSpace = "srgb"     // Convert every source to sRGB
+	ColorSpacePreserve ColorSpace = "preserve" // Keep the source's space and ICC profile
+)
+
+// ErrInvalidColorSpace is returned for unknown color space modes
+var ErrInvalidColorSpace = errors.New("invalid color space: must be srgb or preserve")
+
+// ParseColorSpace parses a color space mode. An empty string selects sRGB.
+func ParseColorSpace(s string) (ColorSpace, error) {
+	switch ColorSpace(s) {
+	case "", ColorSpaceSRGB:
+		return ColorSpaceSRGB, nil
+	case ColorSpacePreserve:
+		return ColorSpacePreserve, nil
+	}
+	return "", ErrInvalidColorSpace
+}
+
+// colorOptions converts to sRGB unless the space is preserved. Sources with
+// an ICC profile, e.g. Adobe RGB, are transformed through it, CMYK sources
+// through libvips' built-in CMYK profile.
+func colorOptions(opts bimg.Options, space ColorSpace) bimg.Options {
+	if space == ColorSpaceSRGB {
+		opts.Interpretation = bimg.InterpretationSRGB
+		opts.OutputICC = "srgb"
+	}
+	return opts
+}
+
+// applyProfile embeds the ICC profile matching the output's color space in
+// encoded data, since deterministicOptions strips the source's. Converted
+// output gets the sRGB profile when embed is set. Preserved output keeps an
+// RGB source profile; CMYK and grey profiles do not describe the RGB pixels
+// every output format is written with.
+func applyProfile(data, source []byte, space ColorSpace, embed bool) ([]byte, error) {
+	profile := SRGBProfile()
+	if space == ColorSpacePreserve {
+		profile = ICCProfile(source)
+		if len(profile) < 20 || string(profile[16:20]) != "RGB " {
+			return data, nil
+		}
+	} else if !embed {
+		return data, nil
+	}
+	return EmbedICCProfile(data, profile)
+}
@@ -0,0 +1,295 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// cmykJPEG encodes a 64x32 Adobe CMYK JPEG, pure cyan on the left and pure
+// magenta on the right, like print workflows produce
+func cmykJPEG(t *testing.T) []byte {
+	t.Helper()
+	const width, height = 64, 32
+	inks := [2][4]float64{{255, 0, 0, 0}, {0, 255, 0, 0}}
+
+	quant := scaleQuantTables(95)
+	comps := make([]*jpegComponent, 4)
+	for ci := range comps {
+		// Adobe stores inverted ink values
+		plane := make([]float64, width*height)
+		for i := range plane {
+			plane[i] = 255 - inks[i%width/32][ci] - 128
+		}
+		comps[ci] = &jpegComponent{id: byte(ci + 1), h: 1, v: 1}
+		for y := 0; y < height; y += 8 {
+			for x := 0; x < width; x += 8 {
+				comps[ci].blocks = append(comps[ci].blocks, quantizeBlock(extractBlock(plane, width, x, y, 1, 1), &quant[0]))
+			}
+		}
+	}
+	mcus := width / 8 * height / 8
+
+	var dcFreq, acFreq [257]int
+	forEachSymbol(comps, mcus, func(_ int, dc bool, symbol byte, _ int32, _ int) {
+		if dc {
+			dcFreq[symbol]++
+		} else {
+			acFreq[symbol]++
+		}
+	})
+	unused := [257]int{1}
+	tables := [4]huffmanTable{buildHuffmanTable(dcFreq), buildHuffmanTable(unused), buildHuffmanTable(acFreq), buildHuffmanTable(unused)}
+
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	writeJPEGHeaders(bw, width, height, comps, &quant, &tables)
+	ew := &entropyWriter{w: bw}
+	forEachSymbol(comps, mcus, func(_ int, dc bool, symbol byte, value int32, size int) {
+		t := &tables[2]
+		if dc {
+			t = &tables[0]
+		}
+		ew.writeBits(t.codes[symbol], t.lengths[symbol])
+		if size > 0 {
+			if value < 0 {
+				value--
+			}
+			ew.writeBits(uint32(value)&(1<<size-1), size)
+		}
+	})
+	ew.flush()
+	bw.Write([]byte{0xff, 0xd9})
+	bw.Flush()
+
+	// APP14 Adobe segment with transform 0 marks the components as CMYK
+	adobe := []byte{0xFF, 0xEE, 0, 14, 'A', 'd', 'o', 'b', 'e', 0, 100, 0, 0, 0, 0, 0}
+	data := append(buf.Bytes()[:2:2], adobe...)
+	data = append(data, buf.Bytes()[2:]...)
+
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("CMYK fixture does not decode: %v", err)
+	}
+	if _, ok := img.(*image.CMYK); !ok {
+		t.Fatalf("Expected a CMYK fixture, decoded %T", img)
+	}
+	return data
+}
+
+// Test ParseColorSpace accepts srgb and preserve and defaults to sRGB
+func TestParseColorSpace(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected ColorSpace
+		err      error
+	}{
+		{"", ColorSpaceSRGB, nil},
+		{"srgb", ColorSpaceSRGB, nil},
+		{"preserve", ColorSpacePreserve, nil},
+		{"cmyk", "", ErrInvalidColorSpace},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseColorSpace(tt.value)
+		if err != tt.err || got != tt.expected {
+			t.Errorf("ParseColorSpace(%q) = %q, %v, expected %q, %v", tt.value, got, err, tt.expected, tt.err)
+		}
+	}
+}
+
+// Test the sRGB profile has a valid ICC header and tag table
+func TestSRGBProfile(t *testing.T) {
+	profile := SRGBProfile()
+
+	if size := binary.BigEndian.Uint32(profile); int(size) != len(profile) {
+		t.Fatalf("Header size %d, profile is %d bytes", size, len(profile))
+	}
+	if got := string(profile[12:24]) + string(profile[36:40]); got != "mntrRGB XYZ acsp" {
+		t.Errorf("Expected an RGB display profile, got %q", got)
+	}
+
+	count := int(binary.BigEndian.Uint32(profile[128:]))
+	tags := map[string]bool{}
+	for i := 0; i < count; i++ {
+		entry := profile[132+12*i:]
+		offset, size := binary.BigEndian.Uint32(entry[4:]), binary.BigEndian.Uint32(entry[8:])
+		if offset%4 != 0 || int(offset+size) > len(profile) {
+			t.Errorf("Tag %s at %d+%d is outside the profile", entry[:4], offset, size)
+		}
+		tags[string(entry[:4])] = true
+	}
+	for _, tag := range []string{"desc", "cprt", "wtpt", "rXYZ", "gXYZ", "bXYZ", "rTRC", "gTRC", "bTRC"} {
+		if !tags[tag] {
+			t.Errorf("Missing required tag %s", tag)
+		}
+	}
+}
+
+// Test profiles are embedded, read back and replaced without changing the pixels
+func TestEmbedICCProfile(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 24, 16))
+	for i := range src.Pix {
+		src.Pix[i] = byte(i * 7)
+	}
+	var jpg, pngData bytes.Buffer
+	if err := jpeg.Encode(&jpg, src, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatalf("JPEG encode failed: %v", err)
+	}
+	if err := png.Encode(&pngData, src); err != nil {
+		t.Fatalf("PNG encode failed: %v", err)
+	}
+	var lossless bytes.Buffer
+	writeWebPChunk(&lossless, "RIFF", append([]byte("WEBP"), webpChunkBytes("VP8L", EncodeVP8L(src))...))
+
+	large := bytes.Repeat([]byte{0xAB}, 2*maxJPEGICCChunk+100)
+	tests := []struct {
+		name    string
+		data    []byte
+		profile []byte
+	}{
+		{"JPEG", jpg.Bytes(), SRGBProfile()},
+		{"JPEG multi-segment", jpg.Bytes(), large},
+		{"PNG", pngData.Bytes(), SRGBProfile()},
+		{"WebP lossless", lossless.Bytes(), SRGBProfile()},
+		{"WebP animated", loadTestImage(t, "animated.webp"), SRGBProfile()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ICCProfile(tt.data) != nil {
+				t.Fatal("Fixture already carries a profile")
+			}
+			embedded, err := EmbedICCProfile(tt.data, tt.profile)
+			if err != nil {
+				t.Fatalf("EmbedICCProfile failed: %v", err)
+			}
+			if !bytes.Equal(ICCProfile(embedded), tt.profile) {
+				t.Fatal("Embedded profile does not read back")
+			}
+
+			// Embedding again replaces the profile
+			other := []byte("replacement profile")
+			replaced, err := EmbedICCProfile(embedded, other)
+			if err != nil {
+				t.Fatalf("EmbedICCProfile failed: %v", err)
+			}
+			if !bytes.Equal(ICCProfile(replaced), other) {
+				t.Error("Profile was not replaced")
+			}
+
+			if isWebP(tt.data) {
+				if FrameCount(replaced) != FrameCount(tt.data) {
+					t.Errorf("Frame count changed from %d to %d", FrameCount(tt.data), FrameCount(replaced))
+				}
+				if FrameCount(tt.data) == 1 {
+					if _, err := webp.Decode(bytes.NewReader(replaced)); err != nil {
+						t.Errorf("WebP no longer decodes: %v", err)
+					}
+				}
+				return
+			}
+			before, _, _ := image.Decode(bytes.NewReader(tt.data))
+			after, _, err := image.Decode(bytes.NewReader(replaced))
+			if err != nil {
+				t.Fatalf("Image no longer decodes: %v", err)
+			}
+			if before.At(5, 5) != after.At(5, 5) {
+				t.Errorf("Pixels changed: %v != %v", before.At(5, 5), after.At(5, 5))
+			}
+		})
+	}
+}
+
+// webpChunkBytes encodes a single RIFF chunk
+func webpChunkBytes(fourCC string, payload []byte) []byte {
+	var buf bytes.Buffer
+	writeWebPChunk(&buf, fourCC, payload)
+	return buf.Bytes()
+}
+
+// Test applyProfile only embeds profiles that describe the output
+func TestApplyProfile(t *testing.T) {
+	var output bytes.Buffer
+	if err := png.Encode(&output, image.NewNRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	adobeRGB := append(bytes.Clone(SRGBProfile()[:128]), "Adobe RGB (1998)"...)
+	cmykProfile := bytes.Clone(adobeRGB)
+	copy(cmykProfile[16:], "CMYK")
+	source := func(profile []byte) []byte {
+		data, err := EmbedICCProfile(output.Bytes(), profile)
+		if err != nil {
+			t.Fatalf("EmbedICCProfile failed: %v", err)
+		}
+		return data
+	}
+
+	tests := []struct {
+		name     string
+		source   []byte
+		space    ColorSpace
+		embed    bool
+		expected []byte
+	}{
+		{"sRGB without embedding", source(adobeRGB), ColorSpaceSRGB, false, nil},
+		{"sRGB embedded", source(adobeRGB), ColorSpaceSRGB, true, SRGBProfile()},
+		{"Preserved RGB profile", source(adobeRGB), ColorSpacePreserve, false, adobeRGB},
+		{"Preserved CMYK profile", source(cmykProfile), ColorSpacePreserve, true, nil},
+		{"Preserved without profile", output.Bytes(), ColorSpacePreserve, false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := applyProfile(output.Bytes(), tt.source, tt.space, tt.embed)
+			if err != nil {
+				t.Fatalf("applyProfile failed: %v", err)
+			}
+			if got := ICCProfile(result); !bytes.Equal(got, tt.expected) {
+				t.Errorf("Profile = %.20q, expected %.20q", got, tt.expected)
+			}
+		})
+	}
+}
+
+// Test a CMYK JPEG is converted to sRGB for every output format
+func TestImageProcessor_Process_CMYK(t *testing.T) {
+	processor := New()
+	data := cmykJPEG(t)
+
+	for _, format := range []ImageFormat{FormatJPEG, FormatPNG, FormatWebP} {
+		t.Run(string(format), func(t *testing.T) {
+			result, err := processor.Process(data, ProcessOptions{Width: 64, Height: 32, Format: format, Quality: 95, EmbedICC: true})
+			if err != nil {
+				t.Fatalf("Process failed: %v", err)
+			}
+			img, _, err := image.Decode(bytes.NewReader(result))
+			if err != nil {
+				t.Fatalf("Decode failed: %v", err)
+			}
+			if _, ok := img.(*image.CMYK); ok {
+				t.Fatal("Output is still CMYK")
+			}
+			if !bytes.Equal(ICCProfile(result), SRGBProfile()) {
+				t.Error("Output does not carry the sRGB profile")
+			}
+
+			// Cyan and magenta ink land on their sRGB hues
+			cyan := color.NRGBAModel.Convert(img.At(8, 16)).(color.NRGBA)
+			magenta := color.NRGBAModel.Convert(img.At(56, 16)).(color.NRGBA)
+			if cyan.R > 80 || cyan.B < 160 {
+				t.Errorf("Cyan ink rendered as %v", cyan)
+			}
+			if magenta.G > 80 || magenta.R < 160 {
+				t.Errorf("Magenta ink rendered as %v", magenta)
+			}
+		})
+	}
+}
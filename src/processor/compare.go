@@ -0,0 +1,106 @@
+package processor
+
+import (
+	"errors"
+	"image"
+	"image/color"
+
+	"golang.org/x/image/draw"
+)
+
+// Comparison metrics for CompareImages
+const (
+	CompareSSIM  = "ssim"  // Structural similarity of luma
+	ComparePixel = "pixel" // Fraction of matching pixels
+)
+
+// PixelTolerance is the largest per-channel difference (0-255) that still
+// counts as a matching pixel
+const PixelTolerance = 8
+
+// ErrUnknownMetric is returned for unsupported comparison metrics
+var ErrUnknownMetric = errors.New("unknown comparison metric: must be ssim or pixel")
+
+// CompareImages scores the similarity of a and b from 0 to 1, where 1 means
+// identical. b is scaled to a's dimensions before comparing.
+func CompareImages(a, b image.Image, metric string) (float64, error) {
+	b = NormalizeSize(b, a.Bounds().Dx(), a.Bounds().Dy())
+
+	switch metric {
+	case "", CompareSSIM:
+		return NewSSIMMetric().Score(a, b), nil
+	case ComparePixel:
+		return pixelMatch(a, b), nil
+	default:
+		return 0, ErrUnknownMetric
+	}
+}
+
+// NormalizeSize scales img to w x h, returning it unchanged if it already matches
+func NormalizeSize(img image.Image, w, h int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() == w && bounds.Dy() == h {
+		return img
+	}
+	scaled := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.BiLinear.Scale(scaled, scaled.Bounds(), img, bounds, draw.Src, nil)
+	return scaled
+}
+
+// DiffImage highlights pixels that differ between a and b in red over a
+// dimmed grayscale copy of a. b is scaled to a's dimensions first.
+func DiffImage(a, b image.Image) *image.RGBA {
+	bounds := a.Bounds()
+	b = NormalizeSize(b, bounds.Dx(), bounds.Dy())
+	bb := b.Bounds()
+
+	out := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			ca := a.At(bounds.Min.X+x, bounds.Min.Y+y)
+			diff := channelDiff(ca, b.At(bb.Min.X+x, bb.Min.Y+y))
+			if diff > PixelTolerance {
+				// Stronger differences are brighter
+				out.SetRGBA(x, y, color.RGBA{R: uint8(128 + diff/2), A: 255})
+				continue
+			}
+			gray := color.GrayModel.Convert(ca).(color.Gray).Y / 3
+			out.SetRGBA(x, y, color.RGBA{R: gray, G: gray, B: gray, A: 255})
+		}
+	}
+	return out
+}
+
+// pixelMatch returns the fraction of pixels within PixelTolerance
+func pixelMatch(a, b image.Image) float64 {
+	ab, bb := a.Bounds(), b.Bounds()
+	total := ab.Dx() * ab.Dy()
+	if total == 0 {
+		return 1
+	}
+
+	matching := 0
+	for y := 0; y < ab.Dy(); y++ {
+		for x := 0; x < ab.Dx(); x++ {
+			if channelDiff(a.At(ab.Min.X+x, ab.Min.Y+y), b.At(bb.Min.X+x, bb.Min.Y+y)) <= PixelTolerance {
+				matching++
+			}
+		}
+	}
+	return float64(matching) / float64(total)
+}
+
+// channelDiff returns the largest 8-bit channel difference, alpha included
+func channelDiff(a, b color.Color) int {
+	r1, g1, b1, a1 := a.RGBA()
+	r2, g2, b2, a2 := b.RGBA()
+	diff := 0
+	for _, d := range [4][2]uint32{{r1, r2}, {g1, g2}, {b1, b2}, {a1, a2}} {
+		v := int(d[0]>>8) - int(d[1]>>8)
+		if v < 0 {
+			v = -v
+		}
+		diff = max(diff, v)
+	}
+	return diff
+}
@@ -0,0 +1,98 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// checkerImage creates a black and white checkerboard
+func checkerImage(w, h, cell int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if (x/cell+y/cell)%2 == 0 {
+				img.Set(x, y, color.White)
+			} else {
+				img.Set(x, y, color.Black)
+			}
+		}
+	}
+	return img
+}
+
+// Test identical images score 1 with both metrics
+func TestCompareImages_Identical(t *testing.T) {
+	img := gradientImage(64, 48)
+
+	for _, metric := range []string{CompareSSIM, ComparePixel} {
+		score, err := CompareImages(img, img, metric)
+		if err != nil {
+			t.Fatalf("CompareImages(%s) failed: %v", metric, err)
+		}
+		if score < 0.999 {
+			t.Errorf("CompareImages(%s) = %f, expected 1", metric, score)
+		}
+	}
+}
+
+// Test clearly different images score low with both metrics
+func TestCompareImages_Different(t *testing.T) {
+	a := gradientImage(64, 64)
+	b := checkerImage(64, 64, 4)
+
+	for _, metric := range []string{CompareSSIM, ComparePixel} {
+		score, err := CompareImages(a, b, metric)
+		if err != nil {
+			t.Fatalf("CompareImages(%s) failed: %v", metric, err)
+		}
+		if score > 0.5 {
+			t.Errorf("CompareImages(%s) = %f, expected a low score", metric, score)
+		}
+	}
+}
+
+// Test images with different dimensions are normalized before comparing
+func TestCompareImages_DifferentSizes(t *testing.T) {
+	score, err := CompareImages(gradientImage(64, 64), gradientImage(128, 128), CompareSSIM)
+
+	if err != nil {
+		t.Fatalf("CompareImages() failed: %v", err)
+	}
+	if score < 0.9 {
+		t.Errorf("CompareImages() = %f, expected a scaled copy to score high", score)
+	}
+}
+
+// Test unknown metrics are rejected
+func TestCompareImages_UnknownMetric(t *testing.T) {
+	img := gradientImage(16, 16)
+
+	if _, err := CompareImages(img, img, "psnr"); err != ErrUnknownMetric {
+		t.Errorf("CompareImages() error = %v, expected ErrUnknownMetric", err)
+	}
+}
+
+// Test the diff image marks changed pixels in red
+func TestDiffImage_HighlightsChanges(t *testing.T) {
+	a := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	b := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	for i := range a.Pix {
+		a.Pix[i], b.Pix[i] = 255, 255
+	}
+	b.Set(3, 4, color.Black)
+
+	diff := DiffImage(a, b)
+
+	if diff.Bounds().Dx() != 10 || diff.Bounds().Dy() != 10 {
+		t.Fatalf("DiffImage() size = %v, expected 10x10", diff.Bounds())
+	}
+	changed := diff.RGBAAt(3, 4)
+	if changed.R < 128 || changed.G != 0 || changed.B != 0 {
+		t.Errorf("changed pixel = %v, expected red", changed)
+	}
+	unchanged := diff.RGBAAt(0, 0)
+	if unchanged.R != unchanged.G || unchanged.G != unchanged.B {
+		t.Errorf("unchanged pixel = %v, expected gray", unchanged)
+	}
+}
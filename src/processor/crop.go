@@ -0,0 +1,66 @@
+package processor
+
+import (
+	"errors"
+
+	"github.com/h2non/bimg"
+)
+
+// ErrCropOutOfBounds is returned for a Crop reaching outside the image
+// when ClampCrop is not set
+var ErrCropOutOfBounds = errors.New("crop rectangle is outside the image")
+
+// CropRect is a region of the source image in pixels
+type CropRect struct {
+	X, Y          int
+	Width, Height int
+}
+
+// Empty reports whether the rectangle selects nothing, i.e. no crop
+func (r CropRect) Empty() bool {
+	return r.Width <= 0 || r.Height <= 0
+}
+
+// Fit checks r against a width x height image. With clamp the part inside
+// the image is returned; otherwise r must lie entirely within it.
+func (r CropRect) Fit(width, height int, clamp bool) (CropRect, error) {
+	if r.Empty() || r.X < 0 || r.Y < 0 {
+		return CropRect{}, ErrCropOutOfBounds
+	}
+	if r.X+r.Width <= width && r.Y+r.Height <= height {
+		return r, nil
+	}
+	if !clamp || r.X >= width || r.Y >= height {
+		return CropRect{}, ErrCropOutOfBounds
+	}
+	r.Width = min(r.Width, width-r.X)
+	r.Height = min(r.Height, height-r.Y)
+	return r, nil
+}
+
+// extractArea crops data to rect, checked against the image bounds, and
+// returns it as a lossless PNG for the resize that follows. bimg extracts
+// after resizing, so the region is cut out in a pass of its own.
+func extractArea(data []byte, rect CropRect, clamp bool) ([]byte, error) {
+	img := bimg.NewImage(data)
+	size, err := img.Size()
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	rect, err = rect.Fit(size.Width, size.Height, clamp)
+	if err != nil {
+		return nil, err
+	}
+
+	cropped, err := img.Process(deterministicOptions(bimg.Options{
+		Left:       rect.X,
+		Top:        rect.Y,
+		AreaWidth:  rect.Width,
+		AreaHeight: rect.Height,
+		Type:       bimg.PNG,
+	}))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	return cropped, nil
+}
@@ -0,0 +1,128 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// quadrantPNG encodes a 200x100 PNG with red, green, blue and white quadrants
+func quadrantPNG(t *testing.T) []byte {
+	t.Helper()
+	colors := [2][2]color.NRGBA{
+		{{R: 255, A: 255}, {G: 255, A: 255}},
+		{{B: 255, A: 255}, {R: 255, G: 255, B: 255, A: 255}},
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, 200, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			img.SetNRGBA(x, y, colors[y/50][x/100])
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// Test CropRect.Fit accepts regions inside the image and clamps or rejects others
+func TestCropRect_Fit(t *testing.T) {
+	tests := []struct {
+		name     string
+		rect     CropRect
+		clamp    bool
+		expected CropRect
+		err      error
+	}{
+		{"Inside", CropRect{10, 20, 100, 50}, false, CropRect{10, 20, 100, 50}, nil},
+		{"Whole image", CropRect{0, 0, 200, 100}, false, CropRect{0, 0, 200, 100}, nil},
+		{"Overflow rejected", CropRect{150, 50, 100, 100}, false, CropRect{}, ErrCropOutOfBounds},
+		{"Overflow clamped", CropRect{150, 50, 100, 100}, true, CropRect{150, 50, 50, 50}, nil},
+		{"Outside clamped", CropRect{200, 0, 10, 10}, true, CropRect{}, ErrCropOutOfBounds},
+		{"Negative origin", CropRect{-1, 0, 10, 10}, true, CropRect{}, ErrCropOutOfBounds},
+		{"Empty", CropRect{0, 0, 0, 10}, true, CropRect{}, ErrCropOutOfBounds},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.rect.Fit(200, 100, tt.clamp)
+			if err != tt.err {
+				t.Fatalf("Fit error = %v, expected %v", err, tt.err)
+			}
+			if got != tt.expected {
+				t.Errorf("Fit = %+v, expected %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+// Test a crop extracts the region before resizing and formatting
+func TestImageProcessor_Process_Crop(t *testing.T) {
+	processor := New()
+	data := quadrantPNG(t)
+
+	tests := []struct {
+		name   string
+		opts   ProcessOptions
+		width  int
+		height int
+		checks map[image.Point]color.NRGBA
+	}{
+		{
+			"Centered region",
+			ProcessOptions{Format: FormatPNG, Quality: 90, Crop: CropRect{50, 25, 100, 50}},
+			100, 50,
+			map[image.Point]color.NRGBA{
+				{25, 12}: {R: 255, A: 255},
+				{75, 12}: {G: 255, A: 255},
+				{25, 37}: {B: 255, A: 255},
+				{75, 37}: {R: 255, G: 255, B: 255, A: 255},
+			},
+		},
+		{
+			"Region resized",
+			ProcessOptions{Width: 40, Height: 40, Format: FormatPNG, Quality: 90, Crop: CropRect{100, 0, 100, 50}},
+			40, 20,
+			map[image.Point]color.NRGBA{{20, 10}: {G: 255, A: 255}},
+		},
+		{
+			"Clamped region",
+			ProcessOptions{Format: FormatPNG, Quality: 90, Crop: CropRect{150, 60, 100, 100}, ClampCrop: true},
+			50, 40,
+			map[image.Point]color.NRGBA{{25, 20}: {R: 255, G: 255, B: 255, A: 255}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			if opts.Width == 0 {
+				opts.Width = tt.width
+			}
+			result, err := processor.Process(data, opts)
+			if err != nil {
+				t.Fatalf("Process failed: %v", err)
+			}
+			img, err := png.Decode(bytes.NewReader(result))
+			if err != nil {
+				t.Fatalf("Decode failed: %v", err)
+			}
+			if size := img.Bounds().Size(); size != image.Pt(tt.width, tt.height) {
+				t.Fatalf("Expected %dx%d, got %v", tt.width, tt.height, size)
+			}
+			for p, expected := range tt.checks {
+				if got := color.NRGBAModel.Convert(img.At(p.X, p.Y)).(color.NRGBA); got != expected {
+					t.Errorf("Pixel %v = %v, expected %v", p, got, expected)
+				}
+			}
+		})
+	}
+
+	opts := ProcessOptions{Width: 100, Format: FormatPNG, Quality: 90, Crop: CropRect{150, 60, 100, 100}}
+	if _, err := processor.Process(data, opts); err != ErrCropOutOfBounds {
+		t.Errorf("Expected ErrCropOutOfBounds for a region outside the image, got %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math"
+)
+
+// DPI constraints. JFIF stores the density as a 16-bit value.
+const (
+	MinDPI = 1
+	MaxDPI = 65535
+)
+
+// ErrInvalidDPI is returned for densities outside MinDPI to MaxDPI
+var ErrInvalidDPI = errors.New("invalid dpi: must be between 1 and 65535")
+
+// inchesPerMeter converts PNG pixels per meter to dots per inch
+const inchesPerMeter = 1 / 0.0254
+
+// pngSignature starts every PNG file
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// SetDensity records dpi as the resolution of encoded JPEG (JFIF) or PNG
+// (pHYs) data without touching the pixels. WebP has no resolution field,
+// so other formats are returned unchanged.
+func SetDensity(data []byte, dpi int) ([]byte, error) {
+	if dpi < MinDPI || dpi > MaxDPI {
+		return nil, ErrInvalidDPI
+	}
+	switch {
+	case isJPEG(data):
+		return setJPEGDensity(data, dpi), nil
+	case bytes.HasPrefix(data, pngSignature):
+		return setPNGDensity(data, dpi)
+	}
+	return data, nil
+}
+
+// Density returns the resolution recorded in JPEG or PNG data in dots per
+// inch, or 0 when there is none
+func Density(data []byte) int {
+	switch {
+	case isJPEG(data):
+		if segment := jfifSegment(data); segment >= 0 {
+			units := data[segment+11]
+			x := float64(binary.BigEndian.Uint16(data[segment+12:]))
+			switch units {
+			case 1: // Dots per inch
+				return int(x)
+			case 2: // Dots per centimeter
+				return int(math.Round(x * 2.54))
+			}
+		}
+	case bytes.HasPrefix(data, pngSignature):
+		for _, chunk := range pngChunks(data) {
+			if chunk.fourCC == "pHYs" && len(chunk.payload) == 9 && chunk.payload[8] == 1 {
+				return int(math.Round(float64(binary.BigEndian.Uint32(chunk.payload)) / inchesPerMeter))
+			}
+		}
+	}
+	return 0
+}
+
+// isJPEG reports whether data starts with a JPEG SOI marker
+func isJPEG(data []byte) bool {
+	return len(data) >= 4 && data[0] == 0xFF && data[1] == 0xD8
+}
+
+// jfifSegment returns the offset of the JFIF APP0 marker among the
+// application segments following SOI, or -1
+func jfifSegment(data []byte) int {
+	for pos := 2; pos+4 <= len(data) && data[pos] == 0xFF && data[pos+1] >= 0xE0 && data[pos+1] <= 0xEF; {
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if data[pos+1] == 0xE0 && length >= 14 && pos+16 <= len(data) && string(data[pos+4:pos+9]) == "JFIF\x00" {
+			return pos
+		}
+		pos += 2 + length
+	}
+	return -1
+}
+
+// setJPEGDensity updates the JFIF density, inserting a JFIF segment after
+// SOI when the file has none
+func setJPEGDensity(data []byte, dpi int) []byte {
+	if segment := jfifSegment(data); segment >= 0 {
+		out := bytes.Clone(data)
+		out[segment+11] = 1 // Dots per inch
+		binary.BigEndian.PutUint16(out[segment+12:], uint16(dpi))
+		binary.BigEndian.PutUint16(out[segment+14:], uint16(dpi))
+		return out
+	}
+
+	jfif := []byte{0xFF, 0xE0, 0, 16, 'J', 'F', 'I', 'F', 0, 1, 1, 1, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint16(jfif[12:], uint16(dpi))
+	binary.BigEndian.PutUint16(jfif[14:], uint16(dpi))
+
+	out := make([]byte, 0, len(data)+len(jfif))
+	out = append(out, data[:2]...)
+	out = append(out, jfif...)
+	return append(out, data[2:]...)
+}
+
+// pngChunk is a chunk of a PNG file
+type pngChunk struct {
+	fourCC  string
+	payload []byte
+}
+
+// pngChunks splits PNG data into its chunks, stopping at truncated data
+func pngChunks(data []byte) []pngChunk {
+	var chunks []pngChunk
+	for pos := len(pngSignature); pos+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			break
+		}
+		chunks = append(chunks, pngChunk{fourCC: string(data[pos+4 : pos+8]), payload: data[pos+8 : pos+8+length]})
+		pos = end
+	}
+	return chunks
+}
+
+// setPNGDensity replaces any pHYs chunk with one for dpi, placed before
+// the image data as the PNG specification requires
+func setPNGDensity(data []byte, dpi int) ([]byte, error) {
+	phys := make([]byte, 9)
+	ppm := uint32(math.Round(float64(dpi) * inchesPerMeter))
+	binary.BigEndian.PutUint32(phys, ppm)
+	binary.BigEndian.PutUint32(phys[4:], ppm)
+	phys[8] = 1 // Meter
+
+	var out bytes.Buffer
+	out.Write(pngSignature)
+	written := false
+	for _, chunk := range pngChunks(data) {
+		switch {
+		case chunk.fourCC == "pHYs":
+			continue
+		case chunk.fourCC == "IDAT" && !written:
+			writePNGChunk(&out, "pHYs", phys)
+			written = true
+		}
+		writePNGChunk(&out, chunk.fourCC, chunk.payload)
+	}
+	if !written {
+		return nil, ErrInvalidImage
+	}
+	return out.Bytes(), nil
+}
+
+// writePNGChunk appends a chunk with its CRC
+func writePNGChunk(buf *bytes.Buffer, fourCC string, payload []byte) {
+	binary.Write(buf, binary.BigEndian, uint32(len(payload)))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(fourCC))
+	crc.Write(payload)
+	buf.WriteString(fourCC)
+	buf.Write(payload)
+	binary.Write(buf, binary.BigEndian, crc.Sum32())
+}
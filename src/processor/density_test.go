@@ -0,0 +1,121 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+)
+
+// Test density is written without changing the pixels
+func TestSetDensity(t *testing.T) {
+	tests := []struct {
+		filename string
+		dpi      int
+	}{
+		{"sample.jpg", 300},
+		{"sample.png", 300},
+		{"sample.png", 72},
+		{"small.png", 600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			data := loadTestImage(t, tt.filename)
+			before, _, err := image.DecodeConfig(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("Failed to decode fixture: %v", err)
+			}
+
+			result, err := SetDensity(data, tt.dpi)
+			if err != nil {
+				t.Fatalf("SetDensity() returned error: %v", err)
+			}
+			if got := Density(result); got != tt.dpi {
+				t.Errorf("Density() = %d, expected %d", got, tt.dpi)
+			}
+
+			// Setting it again replaces the previous value
+			again, err := SetDensity(result, 150)
+			if err != nil {
+				t.Fatalf("SetDensity() returned error: %v", err)
+			}
+			if got := Density(again); got != 150 {
+				t.Errorf("Density() after update = %d, expected 150", got)
+			}
+
+			img, _, err := image.Decode(bytes.NewReader(again))
+			if err != nil {
+				t.Fatalf("Result no longer decodes: %v", err)
+			}
+			if img.Bounds().Dx() != before.Width || img.Bounds().Dy() != before.Height {
+				t.Errorf("Dimensions changed from %dx%d to %v", before.Width, before.Height, img.Bounds())
+			}
+		})
+	}
+}
+
+// Test JPEG data without a JFIF segment gets one
+func TestSetDensity_JPEGWithoutJFIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := EncodeJPEG(&buf, image.NewGray(image.Rect(0, 0, 16, 16)), 80, Subsampling444); err != nil {
+		t.Fatalf("EncodeJPEG failed: %v", err)
+	}
+	if Density(buf.Bytes()) != 0 {
+		t.Fatal("Expected no density before SetDensity")
+	}
+
+	result, err := SetDensity(buf.Bytes(), 300)
+	if err != nil {
+		t.Fatalf("SetDensity() returned error: %v", err)
+	}
+	if got := Density(result); got != 300 {
+		t.Errorf("Density() = %d, expected 300", got)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(result)); err != nil {
+		t.Errorf("Result no longer decodes: %v", err)
+	}
+}
+
+// Test invalid densities and formats without a resolution field
+func TestSetDensity_InvalidAndUnsupported(t *testing.T) {
+	data := loadTestImage(t, "sample.png")
+	for _, dpi := range []int{0, -1, MaxDPI + 1} {
+		if _, err := SetDensity(data, dpi); err != ErrInvalidDPI {
+			t.Errorf("SetDensity(%d) error = %v, expected ErrInvalidDPI", dpi, err)
+		}
+	}
+
+	webp := loadTestImage(t, "sample.webp")
+	result, err := SetDensity(webp, 300)
+	if err != nil || !bytes.Equal(result, webp) {
+		t.Errorf("Expected WebP to be returned unchanged, got error %v", err)
+	}
+}
+
+// Test Process records the requested DPI while resizing as usual
+func TestImageProcessor_Process_DPI(t *testing.T) {
+	processor := New()
+	data := loadTestImage(t, "sample.jpg")
+
+	for _, format := range []ImageFormat{FormatJPEG, FormatPNG} {
+		t.Run(string(format), func(t *testing.T) {
+			opts := ProcessOptions{Width: 200, Height: 150, Format: format, Quality: DefaultQuality, DPI: 300}
+			result, err := processor.Process(data, opts)
+			if err != nil {
+				t.Fatalf("Process failed: %v", err)
+			}
+
+			metadata, err := GetMetadata(result)
+			if err != nil {
+				t.Fatalf("GetMetadata failed: %v", err)
+			}
+			if metadata.DPI != 300 {
+				t.Errorf("Expected 300 DPI, got %d", metadata.DPI)
+			}
+			if metadata.Width != 200 || metadata.Height != 150 {
+				t.Errorf("Expected 200x150, got %dx%d", metadata.Width, metadata.Height)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+
+	"github.com/h2non/bimg"
+)
+
+// Filter is a color filter applied to the output
+type Filter string
+
+const (
+	FilterNone       Filter = ""
+	FilterGrayscale  Filter = "grayscale"  // Luma only, R = G = B
+	FilterSepia      Filter = "sepia"      // Warm brown tones
+	FilterMonochrome Filter = "monochrome" // Black or white pixels only
+)
+
+// ErrInvalidFilter is returned for unknown filters
+var ErrInvalidFilter = errors.New("invalid filter: must be grayscale, sepia or monochrome")
+
+// monochromeThreshold is the luma from which a monochrome pixel is white
+const monochromeThreshold = 128
+
+// ParseFilter parses a filter name. An empty string applies no filter.
+func ParseFilter(s string) (Filter, error) {
+	switch Filter(s) {
+	case FilterNone, FilterGrayscale, FilterSepia, FilterMonochrome:
+		return Filter(s), nil
+	}
+	return "", ErrInvalidFilter
+}
+
+// ApplyFilter returns a copy of img with filter applied to every pixel.
+// Alpha is kept.
+func ApplyFilter(img image.Image, filter Filter) *image.NRGBA {
+	bounds := img.Bounds()
+	out := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			c := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+			out.SetNRGBA(x, y, filterColor(c, filter))
+		}
+	}
+	return out
+}
+
+// filterColor applies filter to one pixel. Grayscale and monochrome use
+// the Rec. 601 luma, sepia the common sepia tone matrix.
+func filterColor(c color.NRGBA, filter Filter) color.NRGBA {
+	r, g, b := float64(c.R), float64(c.G), float64(c.B)
+	switch filter {
+	case FilterGrayscale:
+		y := clampChannel(0.299*r + 0.587*g + 0.114*b)
+		return color.NRGBA{R: y, G: y, B: y, A: c.A}
+	case FilterMonochrome:
+		var y uint8
+		if 0.299*r+0.587*g+0.114*b >= monochromeThreshold {
+			y = 255
+		}
+		return color.NRGBA{R: y, G: y, B: y, A: c.A}
+	case FilterSepia:
+		return color.NRGBA{
+			R: clampChannel(0.393*r + 0.769*g + 0.189*b),
+			G: clampChannel(0.349*r + 0.686*g + 0.168*b),
+			B: clampChannel(0.272*r + 0.534*g + 0.131*b),
+			A: c.A,
+		}
+	}
+	return c
+}
+
+// clampChannel rounds v to a color channel value
+func clampChannel(v float64) uint8 {
+	if v >= 255 {
+		return 255
+	}
+	if v <= 0 {
+		return 0
+	}
+	return uint8(v + 0.5)
+}
+
+// paintResized renders data with the resize options as a lossless PNG,
+// applies filter, draws caption and returns the painted PNG. Filtering the
+// resized image keeps monochrome output free of the grays resampling would
+// add, and captions keep their font size whatever the source size.
+func paintResized(data []byte, bimgOpts bimg.Options, filter Filter, caption Caption) ([]byte, error) {
+	bimgOpts.Type = bimg.PNG
+	resized, err := bimg.NewImage(data).Process(deterministicOptions(bimgOpts))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	img, _, err := image.Decode(bytes.NewReader(resized))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	if filter != FilterNone {
+		img = ApplyFilter(img, filter)
+	}
+	if caption.Text != "" {
+		if img, err = DrawCaption(img, caption); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
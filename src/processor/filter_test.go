@@ -0,0 +1,129 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// colorfulPNG encodes a 64x48 PNG with a horizontal hue gradient, a
+// vertical brightness gradient and a half-transparent bottom row
+func colorfulPNG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			c := color.NRGBA{R: uint8(x * 4), G: uint8(255 - x*4), B: uint8(y * 5), A: 255}
+			if y == 47 {
+				c.A = 128
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// Test filter names, including unknown ones
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Filter
+		err      error
+	}{
+		{"", FilterNone, nil},
+		{"grayscale", FilterGrayscale, nil},
+		{"sepia", FilterSepia, nil},
+		{"monochrome", FilterMonochrome, nil},
+		{"greyscale", "", ErrInvalidFilter},
+		{"Sepia", "", ErrInvalidFilter},
+	}
+
+	for _, tt := range tests {
+		filter, err := ParseFilter(tt.input)
+		if err != tt.err || filter != tt.expected {
+			t.Errorf("ParseFilter(%q) = %q, %v; want %q, %v", tt.input, filter, err, tt.expected, tt.err)
+		}
+	}
+}
+
+// Test each filter's effect on sampled pixels
+func TestApplyFilter(t *testing.T) {
+	src, err := png.Decode(bytes.NewReader(colorfulPNG(t)))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	samples := []image.Point{{0, 0}, {10, 5}, {31, 20}, {63, 40}, {40, 47}}
+
+	grayscale := ApplyFilter(src, FilterGrayscale)
+	for _, p := range samples {
+		c := grayscale.NRGBAAt(p.X, p.Y)
+		if c.R != c.G || c.G != c.B {
+			t.Errorf("Grayscale pixel at %v is not gray: %v", p, c)
+		}
+	}
+
+	monochrome := ApplyFilter(src, FilterMonochrome)
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			if c := monochrome.NRGBAAt(x, y); (c.R != 0 && c.R != 255) || c.R != c.G || c.G != c.B {
+				t.Fatalf("Monochrome pixel at %d,%d is not black or white: %v", x, y, c)
+			}
+		}
+	}
+
+	// Sepia turns gray into a warm tone: red over green over blue
+	gray := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	gray.SetNRGBA(0, 0, color.NRGBA{R: 128, G: 128, B: 128, A: 255})
+	if c := ApplyFilter(gray, FilterSepia).NRGBAAt(0, 0); !(c.R > c.G && c.G > c.B) {
+		t.Errorf("Expected a sepia tone, got %v", c)
+	}
+	sepia := ApplyFilter(src, FilterSepia)
+	for _, p := range samples {
+		if c := sepia.NRGBAAt(p.X, p.Y); c.R < c.G || c.G < c.B {
+			t.Errorf("Sepia pixel at %v is not warm: %v", p, c)
+		}
+	}
+
+	// Alpha is kept, and no filter leaves pixels unchanged
+	for _, filtered := range []*image.NRGBA{grayscale, monochrome, sepia} {
+		if a := filtered.NRGBAAt(40, 47).A; a != 128 {
+			t.Errorf("Expected alpha 128, got %d", a)
+		}
+	}
+	if c := ApplyFilter(src, FilterNone).NRGBAAt(10, 5); c != src.(*image.NRGBA).NRGBAAt(10, 5) {
+		t.Errorf("Expected an unfiltered pixel, got %v", c)
+	}
+}
+
+func TestImageProcessor_Process_Filter(t *testing.T) {
+	processor := New()
+	data := colorfulPNG(t)
+
+	result, err := processor.Process(data, ProcessOptions{Width: 32, Height: 24, Format: FormatPNG, Quality: 90, Filter: FilterGrayscale})
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(result))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(32, 24) {
+		t.Fatalf("Expected 32x24, got %v", size)
+	}
+	for _, p := range []image.Point{{0, 0}, {16, 12}, {31, 23}} {
+		c := color.NRGBAModel.Convert(img.At(p.X, p.Y)).(color.NRGBA)
+		if c.R != c.G || c.G != c.B {
+			t.Errorf("Grayscale pixel at %v is not gray: %v", p, c)
+		}
+	}
+
+	if _, err := processor.Process(data, ProcessOptions{Width: 32, Format: FormatPNG, Quality: 90, Filter: "blur"}); err != ErrInvalidFilter {
+		t.Errorf("Expected ErrInvalidFilter, got %v", err)
+	}
+}
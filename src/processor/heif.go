@@ -0,0 +1,55 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/h2non/bimg"
+)
+
+// heifBrands are ISO BMFF brands used by HEIC/HEIF still images and sequences
+var heifBrands = map[string]bool{
+	"heic": true,
+	"heix": true,
+	"heim": true,
+	"heis": true,
+	"hevc": true,
+	"hevx": true,
+	"hevm": true,
+	"hevs": true,
+	"mif1": true,
+	"msf1": true,
+}
+
+// IsHEIF reports whether data starts with an ftyp box declaring a HEIF brand.
+// AVIF shares the container and the mif1 brand, so avif brands are rejected.
+func IsHEIF(data []byte) bool {
+	if len(data) < 16 || !bytes.Equal(data[4:8], []byte("ftyp")) {
+		return false
+	}
+
+	size := int(binary.BigEndian.Uint32(data[0:4]))
+	if size < 16 || size > len(data) {
+		return false
+	}
+
+	// Major brand followed by a minor version and the compatible brands
+	brands := []string{string(data[8:12])}
+	for i := 16; i+4 <= size; i += 4 {
+		brands = append(brands, string(data[i:i+4]))
+	}
+
+	isHEIF := false
+	for _, brand := range brands {
+		if brand == "avif" || brand == "avis" {
+			return false
+		}
+		isHEIF = isHEIF || heifBrands[brand]
+	}
+	return isHEIF
+}
+
+// HEIFSupported reports whether the linked libvips can decode HEIF
+func HEIFSupported() bool {
+	return bimg.IsImageTypeSupportedByVips(bimg.HEIF).Load
+}
@@ -0,0 +1,126 @@
+package processor
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+// ftypBox builds an ftyp box with the given major and compatible brands
+func ftypBox(major string, compatible ...string) []byte {
+	size := 16 + 4*len(compatible)
+	box := []byte{0, 0, 0, byte(size), 'f', 't', 'y', 'p'}
+	box = append(box, major...)
+	box = append(box, 0, 0, 0, 0)
+	for _, brand := range compatible {
+		box = append(box, brand...)
+	}
+	return append(box, make([]byte, 16)...)
+}
+
+// Test HEIF detection from ftyp brands
+func TestIsHEIF(t *testing.T) {
+	fixture, err := os.ReadFile("testdata/sample.heic")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	jpeg, err := os.ReadFile("testdata/sample.jpg")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected bool
+	}{
+		{"HEIC fixture", fixture, true},
+		{"heic major brand", ftypBox("heic", "mif1", "heic"), true},
+		{"mif1 major brand", ftypBox("mif1", "heic"), true},
+		{"HEIF sequence", ftypBox("msf1", "hevc"), true},
+		{"AVIF", ftypBox("avif", "mif1", "miaf"), false},
+		{"AVIF with mif1 major brand", ftypBox("mif1", "avif"), false},
+		{"MP4", ftypBox("isom", "iso2", "mp41"), false},
+		{"JPEG", jpeg, false},
+		{"Truncated", []byte("\x00\x00\x00\x18ftyp"), false},
+		{"Empty", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsHEIF(tt.data); got != tt.expected {
+				t.Errorf("IsHEIF() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+// Test HEIC sources are rejected as unsupported without libvips HEIF support
+func TestImageProcessor_ValidateImage_HEIFUnsupported(t *testing.T) {
+	if HEIFSupported() {
+		t.Skip("libvips supports HEIF")
+	}
+
+	data, err := os.ReadFile("testdata/sample.heic")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	if err := New().ValidateImage(data); !errors.Is(err, ErrUnsupportedInputFormat) {
+		t.Errorf("ValidateImage() error = %v, expected ErrUnsupportedInputFormat", err)
+	}
+	if _, err := GetMetadata(data); !errors.Is(err, ErrUnsupportedInputFormat) {
+		t.Errorf("GetMetadata() error = %v, expected ErrUnsupportedInputFormat", err)
+	}
+}
+
+// Test HEIC metadata is reported as heif
+func TestGetMetadata_HEIC(t *testing.T) {
+	if !HEIFSupported() {
+		t.Skip("libvips lacks HEIF support")
+	}
+
+	data, err := os.ReadFile("testdata/sample.heic")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	metadata, err := GetMetadata(data)
+	if err != nil {
+		t.Fatalf("GetMetadata failed: %v", err)
+	}
+	if metadata.Type != "heif" {
+		t.Errorf("Type = %s, expected heif", metadata.Type)
+	}
+	if metadata.Width == 0 || metadata.Height == 0 {
+		t.Errorf("Expected non-zero dimensions, got %dx%d", metadata.Width, metadata.Height)
+	}
+}
+
+// Test HEIC sources transcode to browser formats
+func TestImageProcessor_Process_HEIC(t *testing.T) {
+	if !HEIFSupported() {
+		t.Skip("libvips lacks HEIF support")
+	}
+
+	data, err := os.ReadFile("testdata/sample.heic")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	proc := New()
+	for _, format := range []ImageFormat{FormatWebP, FormatJPEG} {
+		result, err := proc.Process(data, ProcessOptions{Width: 200, Height: 200, Format: format, Quality: 80})
+		if err != nil {
+			t.Fatalf("Process to %s failed: %v", format, err)
+		}
+
+		metadata, err := GetMetadata(result)
+		if err != nil {
+			t.Fatalf("GetMetadata failed: %v", err)
+		}
+		if metadata.Type != string(format) {
+			t.Errorf("Type = %s, expected %s", metadata.Type, format)
+		}
+	}
+}
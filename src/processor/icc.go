@@ -0,0 +1,314 @@
+package processor
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"math"
+	"sync"
+)
+
+// jpegICCMarker starts the payload of a JPEG APP2 segment carrying part of an
+// ICC profile
+const jpegICCMarker = "ICC_PROFILE\x00"
+
+// maxJPEGICCChunk is the profile bytes that fit one APP2 segment after its
+// length, marker, sequence number and count
+const maxJPEGICCChunk = 65535 - 2 - len(jpegICCMarker) - 2
+
+// SRGBProfile returns an ICC v2 display profile for sRGB: D50-adapted sRGB
+// primaries and a 1024-entry tone curve of the sRGB transfer function. It is
+// built once and must not be modified.
+var SRGBProfile = sync.OnceValue(buildSRGBProfile)
+
+// buildSRGBProfile encodes the sRGB ICC profile
+func buildSRGBProfile() []byte {
+	xyz := func(x, y, z float64) []byte {
+		b := []byte("XYZ \x00\x00\x00\x00")
+		for _, v := range []float64{x, y, z} {
+			b = binary.BigEndian.AppendUint32(b, uint32(int32(math.Round(v*65536))))
+		}
+		return b
+	}
+
+	desc := []byte("desc\x00\x00\x00\x00")
+	name := "sRGB IEC61966-2.1\x00"
+	desc = binary.BigEndian.AppendUint32(desc, uint32(len(name)))
+	desc = append(desc, name...)
+	desc = append(desc, make([]byte, 4+4+2+1+67)...) // Empty Unicode and ScriptCode descriptions
+
+	curve := []byte("curv\x00\x00\x00\x00")
+	const points = 1024
+	curve = binary.BigEndian.AppendUint32(curve, points)
+	for i := 0; i < points; i++ {
+		v := float64(i) / (points - 1)
+		if v <= 0.04045 {
+			v /= 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		curve = binary.BigEndian.AppendUint16(curve, uint16(math.Round(v*65535)))
+	}
+
+	// The three tone curves share one tag element
+	tags := []struct {
+		signature string
+		data      []byte
+	}{
+		{"desc", desc},
+		{"cprt", []byte("text\x00\x00\x00\x00No copyright, use freely\x00")},
+		{"wtpt", xyz(0.9642, 1.0, 0.8249)},
+		{"rXYZ", xyz(0.4360747, 0.2225045, 0.0139322)},
+		{"gXYZ", xyz(0.3850649, 0.7168786, 0.0971045)},
+		{"bXYZ", xyz(0.1430804, 0.0606169, 0.7141733)},
+		{"rTRC", curve},
+		{"gTRC", nil},
+		{"bTRC", nil},
+	}
+
+	table := binary.BigEndian.AppendUint32(nil, uint32(len(tags)))
+	var elements []byte
+	offset := 128 + 4 + 12*len(tags)
+	var last, lastSize int
+	for _, tag := range tags {
+		if tag.data != nil {
+			last, lastSize = offset+len(elements), len(tag.data)
+			elements = append(elements, tag.data...)
+			for len(elements)%4 != 0 {
+				elements = append(elements, 0)
+			}
+		}
+		table = append(table, tag.signature...)
+		table = binary.BigEndian.AppendUint32(table, uint32(last))
+		table = binary.BigEndian.AppendUint32(table, uint32(lastSize))
+	}
+
+	header := make([]byte, 128)
+	binary.BigEndian.PutUint32(header, uint32(128+len(table)+len(elements)))
+	binary.BigEndian.PutUint32(header[8:], 0x02100000) // Version 2.1
+	copy(header[12:], "mntrRGB XYZ ")
+	for i, v := range []uint16{1998, 2, 9} { // Fixed creation date keeps output deterministic
+		binary.BigEndian.PutUint16(header[24+2*i:], v)
+	}
+	copy(header[36:], "acsp")
+	copy(header[68:], xyz(0.9642, 1.0, 0.8249)[8:]) // D50 illuminant
+
+	profile := append(header, table...)
+	return append(profile, elements...)
+}
+
+// ICCProfile returns the ICC profile embedded in JPEG, PNG or WebP data, or
+// nil when there is none
+func ICCProfile(data []byte) []byte {
+	switch {
+	case isJPEG(data):
+		return jpegICCProfile(data)
+	case bytes.HasPrefix(data, pngSignature):
+		for _, chunk := range pngChunks(data) {
+			if chunk.fourCC != "iCCP" {
+				continue
+			}
+			// Profile name, NUL, compression method 0, zlib data
+			name := bytes.IndexByte(chunk.payload, 0)
+			if name < 0 || name+2 > len(chunk.payload) || chunk.payload[name+1] != 0 {
+				return nil
+			}
+			r, err := zlib.NewReader(bytes.NewReader(chunk.payload[name+2:]))
+			if err != nil {
+				return nil
+			}
+			profile, err := io.ReadAll(r)
+			if err != nil {
+				return nil
+			}
+			return profile
+		}
+	case isWebP(data):
+		chunks, err := parseWebPChunks(data[12:])
+		if err != nil {
+			return nil
+		}
+		for _, chunk := range chunks {
+			if chunk.fourCC == "ICCP" {
+				return bytes.Clone(chunk.payload)
+			}
+		}
+	}
+	return nil
+}
+
+// EmbedICCProfile replaces the ICC profile of encoded JPEG, PNG or WebP data
+// with profile without touching the pixels. Other data is returned unchanged.
+func EmbedICCProfile(data, profile []byte) ([]byte, error) {
+	switch {
+	case isJPEG(data):
+		return embedJPEGICCProfile(data, profile), nil
+	case bytes.HasPrefix(data, pngSignature):
+		return embedPNGICCProfile(data, profile)
+	case isWebP(data):
+		return embedWebPICCProfile(data, profile)
+	}
+	return data, nil
+}
+
+// jpegSegments calls visit with the offset and length of each marker
+// segment between SOI and the start of scan
+func jpegSegments(data []byte, visit func(pos, length int)) {
+	for pos := 2; pos+4 <= len(data) && data[pos] == 0xFF && data[pos+1] != 0xDA; {
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return
+		}
+		visit(pos, length)
+		pos += 2 + length
+	}
+}
+
+// isJPEGICCSegment reports whether the segment at pos is an ICC APP2 segment
+func isJPEGICCSegment(data []byte, pos, length int) bool {
+	return data[pos+1] == 0xE2 && length >= 2+len(jpegICCMarker)+2 && string(data[pos+4:pos+4+len(jpegICCMarker)]) == jpegICCMarker
+}
+
+// jpegICCProfile joins the ICC profile chunks of JPEG APP2 segments in
+// sequence order
+func jpegICCProfile(data []byte) []byte {
+	chunks := map[int][]byte{}
+	count := 0
+	jpegSegments(data, func(pos, length int) {
+		if isJPEGICCSegment(data, pos, length) {
+			header := pos + 4 + len(jpegICCMarker)
+			chunks[int(data[header])] = data[header+2 : pos+2+length]
+			count = int(data[header+1])
+		}
+	})
+
+	var profile []byte
+	for seq := 1; seq <= count; seq++ {
+		chunk, ok := chunks[seq]
+		if !ok {
+			return nil
+		}
+		profile = append(profile, chunk...)
+	}
+	return profile
+}
+
+// embedJPEGICCProfile drops any ICC segments and writes profile in APP2
+// segments after SOI and the JFIF header
+func embedJPEGICCProfile(data, profile []byte) []byte {
+	insert := 2
+	if segment := jfifSegment(data); segment >= 0 {
+		insert = segment + 2 + int(binary.BigEndian.Uint16(data[segment+2:]))
+	}
+
+	out := make([]byte, 0, len(data)+len(profile)+64)
+	out = append(out, data[:insert]...)
+	count := (len(profile) + maxJPEGICCChunk - 1) / maxJPEGICCChunk
+	for seq := 1; seq <= count; seq++ {
+		chunk := profile[(seq-1)*maxJPEGICCChunk : min(seq*maxJPEGICCChunk, len(profile))]
+		out = append(out, 0xFF, 0xE2)
+		out = binary.BigEndian.AppendUint16(out, uint16(2+len(jpegICCMarker)+2+len(chunk)))
+		out = append(out, jpegICCMarker...)
+		out = append(out, byte(seq), byte(count))
+		out = append(out, chunk...)
+	}
+
+	rest := insert
+	jpegSegments(data, func(pos, length int) {
+		if pos < insert {
+			return
+		}
+		if isJPEGICCSegment(data, pos, length) {
+			out = append(out, data[rest:pos]...)
+			rest = pos + 2 + length
+		}
+	})
+	return append(out, data[rest:]...)
+}
+
+// embedPNGICCProfile replaces any iCCP or sRGB chunk with an iCCP chunk for
+// profile right after IHDR, ahead of PLTE and IDAT as PNG requires
+func embedPNGICCProfile(data, profile []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	compressed.WriteString("ICC Profile\x00\x00")
+	zw, _ := zlib.NewWriterLevel(&compressed, zlib.BestCompression)
+	zw.Write(profile)
+	zw.Close()
+
+	var out bytes.Buffer
+	out.Write(pngSignature)
+	written := false
+	for _, chunk := range pngChunks(data) {
+		switch chunk.fourCC {
+		case "iCCP", "sRGB":
+			continue
+		}
+		writePNGChunk(&out, chunk.fourCC, chunk.payload)
+		if chunk.fourCC == "IHDR" {
+			writePNGChunk(&out, "iCCP", compressed.Bytes())
+			written = true
+		}
+	}
+	if !written {
+		return nil, ErrInvalidImage
+	}
+	return out.Bytes(), nil
+}
+
+// embedWebPICCProfile sets the ICC flag of the VP8X header, adding one to
+// simple files, and places an ICCP chunk for profile right after it
+func embedWebPICCProfile(data, profile []byte) ([]byte, error) {
+	chunks, err := parseWebPChunks(data[12:])
+	if err != nil || len(chunks) == 0 {
+		return nil, ErrInvalidImage
+	}
+
+	var header []byte
+	switch first := chunks[0]; first.fourCC {
+	case "VP8X":
+		if len(first.payload) < 10 {
+			return nil, ErrInvalidImage
+		}
+		header = bytes.Clone(first.payload)
+		chunks = chunks[1:]
+	case "VP8 ":
+		// Key frame start code, then 14-bit width and height
+		p := first.payload
+		if len(p) < 10 || p[3] != 0x9d || p[4] != 0x01 || p[5] != 0x2a {
+			return nil, ErrInvalidImage
+		}
+		header = make([]byte, 10)
+		putUint24(header[4:], int(binary.LittleEndian.Uint16(p[6:])&0x3fff)-1)
+		putUint24(header[7:], int(binary.LittleEndian.Uint16(p[8:])&0x3fff)-1)
+	case "VP8L":
+		// Signature, then 14-bit width-1 and height-1. The alpha flag is
+		// left unset: VP8L carries its own alpha and golang.org/x/image
+		// rejects the flag on lossless images.
+		p := first.payload
+		if len(p) < 5 || p[0] != 0x2f {
+			return nil, ErrInvalidImage
+		}
+		bits := binary.LittleEndian.Uint32(p[1:])
+		header = make([]byte, 10)
+		putUint24(header[4:], int(bits&0x3fff))
+		putUint24(header[7:], int(bits>>14&0x3fff))
+	default:
+		return nil, ErrInvalidImage
+	}
+	header[0] |= 0x20 // ICC profile flag
+
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	writeWebPChunk(&body, "VP8X", header)
+	writeWebPChunk(&body, "ICCP", profile)
+	for _, chunk := range chunks {
+		if chunk.fourCC != "ICCP" {
+			writeWebPChunk(&body, chunk.fourCC, chunk.payload)
+		}
+	}
+
+	var riff bytes.Buffer
+	writeWebPChunk(&riff, "RIFF", body.Bytes())
+	return riff.Bytes(), nil
+}
@@ -1,12 +1,20 @@
 package processor
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"github.com/h2non/bimg"
+	"image"
+	_ "image/png"
 )
 
 // bimgProcessor implements ImageProcessor using bimg
-type bimgProcessor struct{}
+type bimgProcessor struct {
+	// noFastThumbnails renders small thumbnails through the generic
+	// pipeline, for comparing it with the fast path
+	noFastThumbnails bool
+}
 
 // New creates a new ImageProcessor instance
 func New() ImageProcessor {
@@ -32,7 +40,7 @@ func (p *bimgProcessor) Resize(data []byte, width, height int) ([]byte, error) {
 		options.Force = false
 	}
 	
-	result, err := img.Process(options)
+	result, err := img.Process(deterministicOptions(options))
 	if err != nil {
 		return nil, fmt.Errorf("resize failed: %w", err)
 	}
@@ -53,7 +61,7 @@ func (p *bimgProcessor) ConvertFormat(data []byte, format ImageFormat) ([]byte,
 		Type: bimgType,
 	}
 	
-	result, err := img.Process(options)
+	result, err := img.Process(deterministicOptions(options))
 	if err != nil {
 		return nil, fmt.Errorf("format conversion failed: %w", err)
 	}
@@ -73,7 +81,7 @@ func (p *bimgProcessor) AdjustQuality(data []byte, quality int) ([]byte, error)
 		Quality: quality,
 	}
 	
-	result, err := img.Process(options)
+	result, err := img.Process(deterministicOptions(options))
 	if err != nil {
 		return nil, fmt.Errorf("quality adjustment failed: %w", err)
 	}
@@ -101,21 +109,152 @@ func (p *bimgProcessor) Process(data []byte, opts ProcessOptions) ([]byte, error
 		return nil, err
 	}
 	
+	subsampling, err := ParseChromaSubsampling(string(opts.ChromaSubsampling))
+	if err != nil {
+		return nil, err
+	}
+	
+	if opts.DPI != 0 && (opts.DPI < MinDPI || opts.DPI > MaxDPI) {
+		return nil, ErrInvalidDPI
+	}
+	
+	colorSpace, err := ParseColorSpace(string(opts.ColorSpace))
+	if err != nil {
+		return nil, err
+	}
+	
+	if opts.Trim && (opts.TrimThreshold < 0 || opts.TrimThreshold > 255) {
+		return nil, ErrInvalidTrimThreshold
+	}
+	
+	filter, err := ParseFilter(string(opts.Filter))
+	if err != nil {
+		return nil, err
+	}
+	
+	if err := opts.Caption.Validate(); err != nil {
+		return nil, err
+	}
+	
+	bimgOpts, err := resizeOptions(opts, bimgType)
+	if err != nil {
+		return nil, err
+	}
+	bimgOpts = colorOptions(bimgOpts, colorSpace)
+	if !p.noFastThumbnails && fastThumbnail(data, opts, subsampling) {
+		bimgOpts = thumbnailOptions(bimgOpts)
+	}
+	source := data
+	
+	// bimg cannot write animations, so animated GIFs are re-encoded in Go.
+	// Padded, cropped, trimmed, filtered and captioned renditions, and
+	// animations over the pixel budget, are rendered from the first frame by bimg.
+	if opts.Animate && !opts.Poster && !opts.Pad && opts.Crop.Empty() && !opts.Trim && filter == FilterNone && opts.Caption.Text == "" && bimgType == bimg.WEBP && isGIF(data) && FrameCount(data) > 1 {
+		animated, err := animatedWebP(data, opts.Width, opts.Height, MaxAnimationPixels)
+		if !errors.Is(err, errAnimationTooLarge) {
+			return animated, err
+		}
+	}
+	
+	// bimg only decodes the first frame, so posters are composited in Go
+	if opts.Poster {
+		frame, err := ExtractFrame(data, opts.Frame)
+		if err != nil {
+			return nil, err
+		}
+		data = frame
+	}
+	
+	if !opts.Crop.Empty() {
+		cropped, err := extractArea(data, opts.Crop, opts.ClampCrop)
+		if err != nil {
+			return nil, err
+		}
+		data = cropped
+	}
+	
+	if opts.Trim {
+		trimmed, err := trimBorders(data, opts.TrimThreshold)
+		if err != nil {
+			return nil, err
+		}
+		data = trimmed
+	}
+	
+	// bimg has no recolor operation and renders text only as a tiled
+	// watermark, so filters and captions are applied in Go to the resized
+	// image, which is then only encoded
+	if filter != FilterNone || opts.Caption.Text != "" {
+		filtered, err := paintResized(data, bimgOpts, filter, opts.Caption)
+		if err != nil {
+			return nil, err
+		}
+		data = filtered
+		bimgOpts = bimg.Options{Type: bimgType}
+	}
+	
 	img := bimg.NewImage(data)
 	
-	bimgOpts := bimg.Options{
-		Width:   opts.Width,
-		Height:  opts.Height,
-		Type:    bimgType,
-		Quality: opts.Quality,
+	var result []byte
+	if bimgType == bimg.JPEG && subsampling != Subsampling420 {
+		// bimg has no subsampling option, so finer chroma is encoded in Go
+		result, err = p.processJPEG(img, bimgOpts, opts.Quality, subsampling)
+	} else {
+		bimgOpts.Quality = opts.Quality
+		encodeOpts := deterministicOptions(bimgOpts)
+		encodeOpts.Interlace = opts.Progressive && (bimgType == bimg.JPEG || bimgType == bimg.PNG)
+		if result, err = img.Process(encodeOpts); err != nil {
+			err = ErrInvalidImage
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	
+	if result, err = applyProfile(result, source, colorSpace, opts.EmbedICC); err != nil {
+		return nil, err
 	}
 	
-	result, err := img.Process(bimgOpts)
+	// bimg cannot set the resolution either, so it is written into the file
+	if opts.DPI > 0 {
+		return SetDensity(result, opts.DPI)
+	}
+	
+	return result, nil
+}
+
+// processJPEG resizes to a lossless PNG with bimg and encodes it as JPEG
+// with the requested chroma subsampling
+func (p *bimgProcessor) processJPEG(img *bimg.Image, bimgOpts bimg.Options, quality int, subsampling ChromaSubsampling) ([]byte, error) {
+	bimgOpts.Type = bimg.PNG
+	resized, err := img.Process(deterministicOptions(bimgOpts))
 	if err != nil {
 		return nil, ErrInvalidImage
 	}
 	
-	return result, nil
+	decoded, _, err := image.Decode(bytes.NewReader(resized))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	
+	var buf bytes.Buffer
+	if err := EncodeJPEG(&buf, decoded, quality, subsampling); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// pngCompression is the fixed zlib level for PNG output
+const pngCompression = 6
+
+// deterministicOptions pins encoder settings so the same source and options
+// always produce byte-identical output. All metadata (EXIF timestamps, XMP,
+// ICC) is stripped and progressive encoding is disabled unless requested.
+func deterministicOptions(opts bimg.Options) bimg.Options {
+	opts.StripMetadata = true
+	opts.Interlace = false
+	opts.Compression = pngCompression
+	return opts
 }
 
 // ValidateImage checks if the data is a valid image
@@ -124,6 +263,11 @@ func (p *bimgProcessor) ValidateImage(data []byte) error {
 		return ErrInvalidImage
 	}
 	
+	// HEIF decoding is an optional libvips codec
+	if IsHEIF(data) && !HEIFSupported() {
+		return ErrUnsupportedInputFormat
+	}
+	
 	img := bimg.NewImage(data)
 	imgType := img.Type()
 	
@@ -204,6 +348,11 @@ func formatToBimgType(format ImageFormat) (bimg.ImageType, error) {
 
 // GetMetadata extracts metadata from image data using bimg
 func GetMetadata(data []byte) (*ImageMetadata, error) {
+	heif := IsHEIF(data)
+	if heif && !HEIFSupported() {
+		return nil, ErrUnsupportedInputFormat
+	}
+	
 	img := bimg.NewImage(data)
 	
 	size, err := img.Size()
@@ -212,10 +361,15 @@ func GetMetadata(data []byte) (*ImageMetadata, error) {
 	}
 	
 	imgType := img.Type()
+	if heif {
+		imgType = "heif"
+	}
 	
 	return &ImageMetadata{
 		Width:  size.Width,
 		Height: size.Height,
 		Type:   imgType,
+		Frames: FrameCount(data),
+		DPI:    Density(data),
 	}, nil
 }
@@ -1,8 +1,14 @@
 package processor
 
 import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
 	"os"
 	"testing"
+
+	"github.com/h2non/bimg"
 )
 
 // Test processor creation
@@ -321,6 +327,104 @@ func TestImageProcessor_Process_CombinedOperations(t *testing.T) {
 	}
 }
 
+// Test JPEG chroma subsampling on a high-chroma-edge image
+func TestImageProcessor_Process_ChromaSubsampling(t *testing.T) {
+	processor := New()
+	var src bytes.Buffer
+	if err := png.Encode(&src, chromaEdgeImage(200, 100)); err != nil {
+		t.Fatalf("png.Encode() failed: %v", err)
+	}
+	
+	outputs := make(map[ChromaSubsampling][]byte)
+	for _, subsampling := range []ChromaSubsampling{Subsampling444, Subsampling422, Subsampling420} {
+		result, err := processor.Process(src.Bytes(), ProcessOptions{
+			Width:             200,
+			Height:            100,
+			Format:            FormatJPEG,
+			Quality:           80,
+			ChromaSubsampling: subsampling,
+		})
+		if err != nil {
+			t.Fatalf("Process(%s) failed: %v", subsampling, err)
+		}
+		decoded, err := jpeg.Decode(bytes.NewReader(result))
+		if err != nil {
+			t.Fatalf("Process(%s) output is not a JPEG: %v", subsampling, err)
+		}
+		if decoded.Bounds().Dx() != 200 || decoded.Bounds().Dy() != 100 {
+			t.Errorf("Process(%s) size = %v, expected 200x100", subsampling, decoded.Bounds())
+		}
+		outputs[subsampling] = result
+	}
+	
+	if bytes.Equal(outputs[Subsampling444], outputs[Subsampling420]) {
+		t.Error("4:4:4 and 4:2:0 output should differ")
+	}
+	if ycbcr, ok := mustDecodeJPEG(t, outputs[Subsampling444]).(*image.YCbCr); !ok || ycbcr.SubsampleRatio != image.YCbCrSubsampleRatio444 {
+		t.Error("4:4:4 output should not subsample chroma")
+	}
+}
+
+// mustDecodeJPEG decodes JPEG data or fails the test
+func mustDecodeJPEG(t *testing.T, data []byte) image.Image {
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("jpeg.Decode() failed: %v", err)
+	}
+	return img
+}
+
+// Test encoding the same source twice is byte-for-byte identical for every format
+func TestImageProcessor_Process_Deterministic(t *testing.T) {
+	processor := New()
+	data := loadTestImage(t, "sample.jpg")
+	
+	tests := []struct {
+		name string
+		opts ProcessOptions
+	}{
+		{"WebP", ProcessOptions{Width: 300, Height: 200, Format: FormatWebP, Quality: 80}},
+		{"PNG", ProcessOptions{Width: 300, Height: 200, Format: FormatPNG, Quality: 80}},
+		{"JPEG", ProcessOptions{Width: 300, Height: 200, Format: FormatJPEG, Quality: 80}},
+		{"JPEG 4:4:4", ProcessOptions{Width: 300, Height: 200, Format: FormatJPEG, Quality: 80, ChromaSubsampling: Subsampling444}},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, err := processor.Process(data, tt.opts)
+			if err != nil {
+				t.Fatalf("Process() failed: %v", err)
+			}
+			second, err := processor.Process(data, tt.opts)
+			if err != nil {
+				t.Fatalf("Process() failed: %v", err)
+			}
+			
+			if !bytes.Equal(first, second) {
+				t.Errorf("Process() output differs between runs (%d vs %d bytes)", len(first), len(second))
+			}
+		})
+	}
+}
+
+// Test encoder options are pinned for deterministic output
+func TestDeterministicOptions(t *testing.T) {
+	opts := deterministicOptions(bimg.Options{Width: 100, Interlace: true, Type: bimg.PNG})
+	
+	if !opts.StripMetadata {
+		t.Error("expected metadata to be stripped")
+	}
+	if opts.Interlace {
+		t.Error("expected interlacing to be disabled")
+	}
+	if opts.Compression != pngCompression {
+		t.Errorf("Compression = %d, expected %d", opts.Compression, pngCompression)
+	}
+	if opts.Width != 100 || opts.Type != bimg.PNG {
+		t.Error("expected other options to be preserved")
+	}
+}
+
 // Test error handling for corrupted images
 func TestImageProcessor_Process_CorruptedImage(t *testing.T) {
 	processor := New()
@@ -506,6 +610,10 @@ func TestImageProcessor_Process_InvalidOptions(t *testing.T) {
 			"Invalid format",
 			ProcessOptions{Width: 100, Height: 100, Format: ImageFormat("bmp"), Quality: 75},
 		},
+		{
+			"Invalid chroma subsampling",
+			ProcessOptions{Width: 100, Height: 100, Format: FormatJPEG, Quality: 75, ChromaSubsampling: "411"},
+		},
 	}
 	
 	for _, tt := range tests {
@@ -0,0 +1,530 @@
+package processor
+
+import (
+	"bufio"
+	"errors"
+	"image"
+	"io"
+	"math"
+)
+
+// ChromaSubsampling selects how JPEG chroma planes are downsampled
+type ChromaSubsampling string
+
+const (
+	Subsampling444 ChromaSubsampling = "444" // Full chroma resolution
+	Subsampling422 ChromaSubsampling = "422" // Chroma halved horizontally
+	Subsampling420 ChromaSubsampling = "420" // Chroma halved both ways (libvips default)
+)
+
+// ErrInvalidSubsampling is returned for unknown chroma subsampling modes
+var ErrInvalidSubsampling = errors.New("invalid chroma subsampling: must be 444, 422 or 420")
+
+// ParseChromaSubsampling parses "444", "4:4:4" and similar forms.
+// An empty string selects the 4:2:0 default.
+func ParseChromaSubsampling(s string) (ChromaSubsampling, error) {
+	switch s {
+	case "", "420", "4:2:0":
+		return Subsampling420, nil
+	case "422", "4:2:2":
+		return Subsampling422, nil
+	case "444", "4:4:4":
+		return Subsampling444, nil
+	default:
+		return "", ErrInvalidSubsampling
+	}
+}
+
+// factors returns the luma horizontal and vertical sampling factors
+func (s ChromaSubsampling) factors() (int, int) {
+	switch s {
+	case Subsampling444:
+		return 1, 1
+	case Subsampling422:
+		return 2, 1
+	default:
+		return 2, 2
+	}
+}
+
+// Standard JPEG quantization tables (ITU T.81 Annex K) in natural order
+var baseQuantTables = [2][64]int{
+	{
+		16, 11, 10, 16, 24, 40, 51, 61,
+		12, 12, 14, 19, 26, 58, 60, 55,
+		14, 13, 16, 24, 40, 57, 69, 56,
+		14, 17, 22, 29, 51, 87, 80, 62,
+		18, 22, 37, 56, 68, 109, 103, 77,
+		24, 35, 55, 64, 81, 104, 113, 92,
+		49, 64, 78, 87, 103, 121, 120, 101,
+		72, 92, 95, 98, 112, 100, 103, 99,
+	},
+	{
+		17, 18, 24, 47, 99, 99, 99, 99,
+		18, 21, 26, 66, 99, 99, 99, 99,
+		24, 26, 56, 99, 99, 99, 99, 99,
+		47, 66, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+		99, 99, 99, 99, 99, 99, 99, 99,
+	},
+}
+
+// zigzag maps zigzag scan position to natural block index
+var zigzag = func() [64]int {
+	var order [64]int
+	i := 0
+	for sum := 0; sum < 15; sum++ {
+		for k := 0; k <= sum; k++ {
+			// Odd diagonals run top-right to bottom-left
+			y, x := k, sum-k
+			if sum%2 == 0 {
+				y, x = sum-k, k
+			}
+			if x < 8 && y < 8 {
+				order[i] = y*8 + x
+				i++
+			}
+		}
+	}
+	return order
+}()
+
+// dctCos holds cos((2x+1)uπ/16) scaled by the DCT normalisation factor
+var dctCos = func() [8][8]float64 {
+	var t [8][8]float64
+	for u := 0; u < 8; u++ {
+		c := math.Sqrt(2.0 / 8)
+		if u == 0 {
+			c = math.Sqrt(1.0 / 8)
+		}
+		for x := 0; x < 8; x++ {
+			t[u][x] = c * math.Cos(float64(2*x+1)*float64(u)*math.Pi/16)
+		}
+	}
+	return t
+}()
+
+// jpegComponent is one colour plane prepared for encoding
+type jpegComponent struct {
+	id     byte
+	h, v   int // Sampling factors
+	table  int // Quantization and Huffman table index
+	blocks [][64]int32
+}
+
+// EncodeJPEG encodes img as a baseline JPEG with the given quality (1-100)
+// and chroma subsampling. Huffman tables are optimised for the image.
+func EncodeJPEG(w io.Writer, img image.Image, quality int, subsampling ChromaSubsampling) error {
+	if err := validateQuality(quality); err != nil {
+		return err
+	}
+	if _, err := ParseChromaSubsampling(string(subsampling)); err != nil {
+		return err
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || width > 65535 || height > 65535 {
+		return ErrInvalidDimensions
+	}
+
+	quant := scaleQuantTables(quality)
+	hs, vs := subsampling.factors()
+	mcuW, mcuH := 8*hs, 8*vs
+	mcusX := (width + mcuW - 1) / mcuW
+	mcusY := (height + mcuH - 1) / mcuH
+
+	y, cb, cr := toYCbCrPlanes(img, mcusX*mcuW, mcusY*mcuH)
+	comps := []*jpegComponent{
+		{id: 1, h: hs, v: vs, table: 0},
+		{id: 2, h: 1, v: 1, table: 1},
+		{id: 3, h: 1, v: 1, table: 1},
+	}
+
+	// Quantize every block in MCU order
+	planeW := mcusX * mcuW
+	for my := 0; my < mcusY; my++ {
+		for mx := 0; mx < mcusX; mx++ {
+			for by := 0; by < vs; by++ {
+				for bx := 0; bx < hs; bx++ {
+					block := extractBlock(y, planeW, mx*mcuW+bx*8, my*mcuH+by*8, 1, 1)
+					comps[0].blocks = append(comps[0].blocks, quantizeBlock(block, &quant[0]))
+				}
+			}
+			comps[1].blocks = append(comps[1].blocks, quantizeBlock(extractBlock(cb, planeW, mx*mcuW, my*mcuH, hs, vs), &quant[1]))
+			comps[2].blocks = append(comps[2].blocks, quantizeBlock(extractBlock(cr, planeW, mx*mcuW, my*mcuH, hs, vs), &quant[1]))
+		}
+	}
+
+	// First pass: count symbols, then build optimal tables
+	var dcFreq, acFreq [2][257]int
+	forEachSymbol(comps, mcusX*mcusY, func(table int, dc bool, symbol byte, _ int32, _ int) {
+		if dc {
+			dcFreq[table][symbol]++
+		} else {
+			acFreq[table][symbol]++
+		}
+	})
+	var tables [4]huffmanTable
+	for i := 0; i < 2; i++ {
+		tables[i] = buildHuffmanTable(dcFreq[i])
+		tables[2+i] = buildHuffmanTable(acFreq[i])
+	}
+
+	bw := bufio.NewWriter(w)
+	writeJPEGHeaders(bw, width, height, comps, &quant, &tables)
+
+	// Second pass: entropy code the scan
+	ew := &entropyWriter{w: bw}
+	forEachSymbol(comps, mcusX*mcusY, func(table int, dc bool, symbol byte, value int32, size int) {
+		t := &tables[2+table]
+		if dc {
+			t = &tables[table]
+		}
+		ew.writeBits(t.codes[symbol], t.lengths[symbol])
+		if size > 0 {
+			if value < 0 {
+				value--
+			}
+			ew.writeBits(uint32(value)&(1<<size-1), size)
+		}
+	})
+	ew.flush()
+
+	bw.Write([]byte{0xff, 0xd9})
+	return bw.Flush()
+}
+
+// scaleQuantTables scales the base tables for quality like libjpeg does
+func scaleQuantTables(quality int) [2][64]int {
+	scale := 200 - 2*quality
+	if quality < 50 {
+		scale = 5000 / quality
+	}
+	var q [2][64]int
+	for t := range baseQuantTables {
+		for i, base := range baseQuantTables[t] {
+			v := (base*scale + 50) / 100
+			q[t][i] = min(max(v, 1), 255)
+		}
+	}
+	return q
+}
+
+// toYCbCrPlanes converts img to level-shifted Y, Cb and Cr planes padded to
+// w x h by replicating the edge pixels
+func toYCbCrPlanes(img image.Image, w, h int) ([]float64, []float64, []float64) {
+	bounds := img.Bounds()
+	y := make([]float64, w*h)
+	cb := make([]float64, w*h)
+	cr := make([]float64, w*h)
+	for py := 0; py < h; py++ {
+		sy := bounds.Min.Y + min(py, bounds.Dy()-1)
+		for px := 0; px < w; px++ {
+			sx := bounds.Min.X + min(px, bounds.Dx()-1)
+			r32, g32, b32, _ := img.At(sx, sy).RGBA()
+			r, g, b := float64(r32>>8), float64(g32>>8), float64(b32>>8)
+			i := py*w + px
+			y[i] = 0.299*r + 0.587*g + 0.114*b - 128
+			cb[i] = -0.168736*r - 0.331264*g + 0.5*b
+			cr[i] = 0.5*r - 0.418688*g - 0.081312*b
+		}
+	}
+	return y, cb, cr
+}
+
+// extractBlock reads an 8x8 block at (x, y), averaging sx x sy pixels per sample
+func extractBlock(plane []float64, stride, x, y, sx, sy int) [64]float64 {
+	var block [64]float64
+	n := float64(sx * sy)
+	for by := 0; by < 8; by++ {
+		for bx := 0; bx < 8; bx++ {
+			var sum float64
+			for dy := 0; dy < sy; dy++ {
+				row := (y+by*sy+dy)*stride + x + bx*sx
+				for dx := 0; dx < sx; dx++ {
+					sum += plane[row+dx]
+				}
+			}
+			block[by*8+bx] = sum / n
+		}
+	}
+	return block
+}
+
+// quantizeBlock applies the forward DCT and quantization, returning
+// coefficients in zigzag order
+func quantizeBlock(block [64]float64, quant *[64]int) [64]int32 {
+	var tmp, coef [64]float64
+	for y := 0; y < 8; y++ {
+		for u := 0; u < 8; u++ {
+			var s float64
+			for x := 0; x < 8; x++ {
+				s += dctCos[u][x] * block[y*8+x]
+			}
+			tmp[y*8+u] = s
+		}
+	}
+	for u := 0; u < 8; u++ {
+		for v := 0; v < 8; v++ {
+			var s float64
+			for y := 0; y < 8; y++ {
+				s += dctCos[v][y] * tmp[y*8+u]
+			}
+			coef[v*8+u] = s
+		}
+	}
+
+	var out [64]int32
+	for i, natural := range zigzag {
+		out[i] = int32(math.Round(coef[natural] / float64(quant[natural])))
+	}
+	return out
+}
+
+// forEachSymbol walks the scan in MCU order and reports every Huffman symbol
+// with the value and bit size that follows it
+func forEachSymbol(comps []*jpegComponent, mcus int, emit func(table int, dc bool, symbol byte, value int32, size int)) {
+	prevDC := make([]int32, len(comps))
+	next := make([]int, len(comps))
+	for m := 0; m < mcus; m++ {
+		for ci, c := range comps {
+			for b := 0; b < c.h*c.v; b++ {
+				block := &c.blocks[next[ci]]
+				next[ci]++
+
+				diff := block[0] - prevDC[ci]
+				prevDC[ci] = block[0]
+				size := bitSize(diff)
+				emit(c.table, true, byte(size), diff, size)
+
+				run := 0
+				for k := 1; k < 64; k++ {
+					if block[k] == 0 {
+						run++
+						continue
+					}
+					for run > 15 {
+						emit(c.table, false, 0xf0, 0, 0)
+						run -= 16
+					}
+					size := bitSize(block[k])
+					emit(c.table, false, byte(run<<4|size), block[k], size)
+					run = 0
+				}
+				if run > 0 {
+					emit(c.table, false, 0x00, 0, 0)
+				}
+			}
+		}
+	}
+}
+
+// bitSize returns the number of bits needed for |v|
+func bitSize(v int32) int {
+	if v < 0 {
+		v = -v
+	}
+	n := 0
+	for v > 0 {
+		n++
+		v >>= 1
+	}
+	return n
+}
+
+// huffmanTable is a canonical Huffman table with its DHT encoding
+type huffmanTable struct {
+	counts  [16]byte // Number of codes of each length 1-16
+	symbols []byte   // Symbols ordered by code length
+	codes   [256]uint32
+	lengths [256]int
+}
+
+// buildHuffmanTable builds a length-limited optimal table from symbol
+// frequencies (ITU T.81 Annex K.2). freq[256] is reserved so that no code
+// consists of all ones.
+func buildHuffmanTable(freq [257]int) huffmanTable {
+	orig := freq
+	freq[256] = 1
+	var codeSize [257]int
+	var others [257]int
+	for i := range others {
+		others[i] = -1
+	}
+
+	for {
+		// Find the two least frequent entries, preferring higher indices
+		c1, c2 := -1, -1
+		for i := 0; i < 257; i++ {
+			if freq[i] > 0 && (c1 < 0 || freq[i] <= freq[c1]) {
+				c1 = i
+			}
+		}
+		for i := 0; i < 257; i++ {
+			if freq[i] > 0 && i != c1 && (c2 < 0 || freq[i] <= freq[c2]) {
+				c2 = i
+			}
+		}
+		if c2 < 0 {
+			break
+		}
+
+		freq[c1] += freq[c2]
+		freq[c2] = 0
+		codeSize[c1]++
+		for others[c1] >= 0 {
+			c1 = others[c1]
+			codeSize[c1]++
+		}
+		others[c1] = c2
+		codeSize[c2]++
+		for others[c2] >= 0 {
+			c2 = others[c2]
+			codeSize[c2]++
+		}
+	}
+
+	var bits [33]int
+	for _, size := range codeSize {
+		if size > 32 {
+			// Extremely skewed counts: flatten them and rebuild
+			return buildHuffmanTable(halveFrequencies(orig))
+		}
+		if size > 0 {
+			bits[size]++
+		}
+	}
+
+	// Limit code lengths to 16 bits
+	for i := 32; i > 16; i-- {
+		for bits[i] > 0 {
+			j := i - 2
+			for bits[j] == 0 {
+				j--
+			}
+			bits[i] -= 2
+			bits[i-1]++
+			bits[j+1] += 2
+			bits[j]--
+		}
+	}
+
+	// Drop the reserved symbol, which has the longest code
+	i := 16
+	for bits[i] == 0 {
+		i--
+	}
+	bits[i]--
+
+	var t huffmanTable
+	for l := 1; l <= 16; l++ {
+		t.counts[l-1] = byte(bits[l])
+	}
+	for size := 1; size <= 32; size++ {
+		for s := 0; s < 256; s++ {
+			if codeSize[s] == size {
+				t.symbols = append(t.symbols, byte(s))
+			}
+		}
+	}
+
+	// Assign canonical codes
+	code := uint32(0)
+	k := 0
+	for l := 1; l <= 16; l++ {
+		for n := 0; n < int(t.counts[l-1]); n++ {
+			t.codes[t.symbols[k]] = code
+			t.lengths[t.symbols[k]] = l
+			code++
+			k++
+		}
+		code <<= 1
+	}
+	return t
+}
+
+// halveFrequencies halves non-zero counts, keeping them non-zero
+func halveFrequencies(freq [257]int) [257]int {
+	for i, f := range freq {
+		if f > 0 {
+			freq[i] = (f + 1) / 2
+		}
+	}
+	return freq
+}
+
+// writeJPEGHeaders writes SOI, DQT, SOF0, DHT and SOS
+func writeJPEGHeaders(w *bufio.Writer, width, height int, comps []*jpegComponent, quant *[2][64]int, tables *[4]huffmanTable) {
+	w.Write([]byte{0xff, 0xd8})
+
+	// Quantization tables in zigzag order
+	w.Write([]byte{0xff, 0xdb, 0, 2 + 2*65})
+	for t := 0; t < 2; t++ {
+		w.WriteByte(byte(t))
+		for _, natural := range zigzag {
+			w.WriteByte(byte(quant[t][natural]))
+		}
+	}
+
+	// Baseline frame header
+	w.Write([]byte{0xff, 0xc0, 0, byte(8 + 3*len(comps)), 8, byte(height >> 8), byte(height), byte(width >> 8), byte(width), byte(len(comps))})
+	for _, c := range comps {
+		w.Write([]byte{c.id, byte(c.h<<4 | c.v), byte(c.table)})
+	}
+
+	// Huffman tables: DC 0-1, AC 0-1
+	for i, t := range tables {
+		class := byte(0)
+		if i >= 2 {
+			class = 1
+		}
+		length := 2 + 1 + 16 + len(t.symbols)
+		w.Write([]byte{0xff, 0xc4, byte(length >> 8), byte(length), class<<4 | byte(i%2)})
+		w.Write(t.counts[:])
+		w.Write(t.symbols)
+	}
+
+	// Scan header
+	w.Write([]byte{0xff, 0xda, 0, byte(6 + 2*len(comps)), byte(len(comps))})
+	for _, c := range comps {
+		w.Write([]byte{c.id, byte(c.table<<4 | c.table)})
+	}
+	w.Write([]byte{0, 63, 0})
+}
+
+// entropyWriter packs Huffman coded bits with 0xFF byte stuffing
+type entropyWriter struct {
+	w     *bufio.Writer
+	bits  uint32
+	nBits int
+}
+
+// writeBits appends the low n bits of v
+func (e *entropyWriter) writeBits(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		e.bits = e.bits<<1 | (v>>uint(i))&1
+		e.nBits++
+		if e.nBits == 8 {
+			e.writeByte(byte(e.bits))
+			e.bits, e.nBits = 0, 0
+		}
+	}
+}
+
+// writeByte writes one entropy coded byte, stuffing a zero after 0xFF
+func (e *entropyWriter) writeByte(b byte) {
+	e.w.WriteByte(b)
+	if b == 0xff {
+		e.w.WriteByte(0)
+	}
+}
+
+// flush pads the final byte with one bits
+func (e *entropyWriter) flush() {
+	if e.nBits > 0 {
+		e.writeBits(1<<(8-e.nBits)-1, 8-e.nBits)
+	}
+}
@@ -0,0 +1,173 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"testing"
+)
+
+// chromaEdgeImage creates one pixel wide red and blue stripes, which
+// chroma subsampling smears into purple
+func chromaEdgeImage(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{220, 20, 20, 255}
+			if x%2 == 1 {
+				c = color.RGBA{20, 20, 220, 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// meanAbsError returns the mean absolute RGB difference between two images
+func meanAbsError(a, b image.Image) float64 {
+	bounds := a.Bounds()
+	var sum float64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r1, g1, b1, _ := a.At(x, y).RGBA()
+			r2, g2, b2, _ := b.At(x, y).RGBA()
+			sum += math.Abs(float64(r1>>8)-float64(r2>>8)) +
+				math.Abs(float64(g1>>8)-float64(g2>>8)) +
+				math.Abs(float64(b1>>8)-float64(b2>>8))
+		}
+	}
+	return sum / float64(3*bounds.Dx()*bounds.Dy())
+}
+
+// encodeAndDecode encodes img with EncodeJPEG and decodes it with image/jpeg
+func encodeAndDecode(t *testing.T, img image.Image, quality int, subsampling ChromaSubsampling) ([]byte, image.Image) {
+	var buf bytes.Buffer
+	if err := EncodeJPEG(&buf, img, quality, subsampling); err != nil {
+		t.Fatalf("EncodeJPEG() failed: %v", err)
+	}
+	decoded, err := jpeg.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("jpeg.Decode() failed: %v", err)
+	}
+	return buf.Bytes(), decoded
+}
+
+// Test each subsampling mode is written to the frame header
+func TestEncodeJPEG_SubsamplingRatio(t *testing.T) {
+	tests := []struct {
+		subsampling ChromaSubsampling
+		expected    image.YCbCrSubsampleRatio
+	}{
+		{Subsampling444, image.YCbCrSubsampleRatio444},
+		{Subsampling422, image.YCbCrSubsampleRatio422},
+		{Subsampling420, image.YCbCrSubsampleRatio420},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.subsampling), func(t *testing.T) {
+			_, decoded := encodeAndDecode(t, chromaEdgeImage(37, 21), 90, tt.subsampling)
+
+			ycbcr, ok := decoded.(*image.YCbCr)
+			if !ok {
+				t.Fatalf("decoded image is %T, expected *image.YCbCr", decoded)
+			}
+			if ycbcr.SubsampleRatio != tt.expected {
+				t.Errorf("SubsampleRatio = %v, expected %v", ycbcr.SubsampleRatio, tt.expected)
+			}
+			if decoded.Bounds().Dx() != 37 || decoded.Bounds().Dy() != 21 {
+				t.Errorf("decoded size = %v, expected 37x21", decoded.Bounds())
+			}
+		})
+	}
+}
+
+// Test 4:4:4 keeps high-chroma edges that 4:2:0 bleeds
+func TestEncodeJPEG_ChromaEdges(t *testing.T) {
+	img := chromaEdgeImage(64, 64)
+
+	full, fullDecoded := encodeAndDecode(t, img, 90, Subsampling444)
+	sub, subDecoded := encodeAndDecode(t, img, 90, Subsampling420)
+
+	if bytes.Equal(full, sub) {
+		t.Fatal("4:4:4 and 4:2:0 output should differ")
+	}
+	fullErr := meanAbsError(img, fullDecoded)
+	subErr := meanAbsError(img, subDecoded)
+	if fullErr >= subErr {
+		t.Errorf("4:4:4 error %.2f should be lower than 4:2:0 error %.2f", fullErr, subErr)
+	}
+}
+
+// Test a smooth image survives a round trip
+func TestEncodeJPEG_RoundTrip(t *testing.T) {
+	img := gradientImage(100, 60)
+
+	_, decoded := encodeAndDecode(t, img, 95, Subsampling444)
+
+	if e := meanAbsError(img, decoded); e > 3 {
+		t.Errorf("mean error %.2f too high for quality 95", e)
+	}
+}
+
+// Test lower quality produces smaller output
+func TestEncodeJPEG_QualityAffectsSize(t *testing.T) {
+	img := noiseImage(64, 64)
+
+	high, _ := encodeAndDecode(t, img, 95, Subsampling444)
+	low, _ := encodeAndDecode(t, img, 30, Subsampling444)
+
+	if len(low) >= len(high) {
+		t.Errorf("quality 30 size %d should be below quality 95 size %d", len(low), len(high))
+	}
+}
+
+// Test encoding twice produces identical bytes
+func TestEncodeJPEG_Deterministic(t *testing.T) {
+	img := noiseImage(50, 30)
+
+	for _, subsampling := range []ChromaSubsampling{Subsampling444, Subsampling422, Subsampling420} {
+		first, _ := encodeAndDecode(t, img, 85, subsampling)
+		second, _ := encodeAndDecode(t, img, 85, subsampling)
+		if !bytes.Equal(first, second) {
+			t.Errorf("EncodeJPEG(%s) output differs between runs", subsampling)
+		}
+	}
+}
+
+// Test invalid encoder arguments
+func TestEncodeJPEG_InvalidArguments(t *testing.T) {
+	img := gradientImage(16, 16)
+	var buf bytes.Buffer
+
+	if err := EncodeJPEG(&buf, img, 0, Subsampling444); err != ErrInvalidQuality {
+		t.Errorf("EncodeJPEG() quality 0 error = %v, expected ErrInvalidQuality", err)
+	}
+	if err := EncodeJPEG(&buf, img, 80, "411"); err != ErrInvalidSubsampling {
+		t.Errorf("EncodeJPEG() 411 error = %v, expected ErrInvalidSubsampling", err)
+	}
+}
+
+// Test parsing subsampling names
+func TestParseChromaSubsampling(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected ChromaSubsampling
+		wantErr  bool
+	}{
+		{"", Subsampling420, false},
+		{"420", Subsampling420, false},
+		{"4:2:2", Subsampling422, false},
+		{"444", Subsampling444, false},
+		{"4:4:4", Subsampling444, false},
+		{"411", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseChromaSubsampling(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.expected {
+			t.Errorf("ParseChromaSubsampling(%q) = %q, %v", tt.input, got, err)
+		}
+	}
+}
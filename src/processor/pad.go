@@ -0,0 +1,56 @@
+package processor
+
+import (
+	"encoding/hex"
+	"errors"
+
+	"github.com/h2non/bimg"
+)
+
+// DefaultBackground is the padding color when none is given
+const DefaultBackground = "ffffff"
+
+// ErrInvalidColor is returned for background colors that are not RRGGBB hex
+var ErrInvalidColor = errors.New("invalid color: must be 6 hex digits (RRGGBB)")
+
+// ParseColor parses an RRGGBB hex color. An empty string is DefaultBackground.
+func ParseColor(value string) (bimg.Color, error) {
+	if value == "" {
+		value = DefaultBackground
+	}
+	if len(value) != 6 {
+		return bimg.Color{}, ErrInvalidColor
+	}
+	rgb, err := hex.DecodeString(value)
+	if err != nil {
+		return bimg.Color{}, ErrInvalidColor
+	}
+	return bimg.Color{R: rgb[0], G: rgb[1], B: rgb[2]}, nil
+}
+
+// resizeOptions returns the bimg resize options for opts. Padding fits the
+// image inside the box and embeds it centered on the background color, so
+// the output is exactly Width x Height. Covering scales the image to cover
+// the box, enlarging small sources, and crops it to the center, which also
+// gives exactly Width x Height.
+func resizeOptions(opts ProcessOptions, imageType bimg.ImageType) (bimg.Options, error) {
+	bimgOpts := bimg.Options{
+		Width:  opts.Width,
+		Height: opts.Height,
+		Type:   imageType,
+	}
+	if opts.Pad && opts.Width > 0 && opts.Height > 0 {
+		background, err := ParseColor(opts.Background)
+		if err != nil {
+			return bimg.Options{}, err
+		}
+		bimgOpts.Embed = true
+		bimgOpts.Extend = bimg.ExtendBackground
+		bimgOpts.Background = background
+	} else if opts.Cover && opts.Width > 0 && opts.Height > 0 {
+		bimgOpts.Crop = true
+		bimgOpts.Enlarge = true
+		bimgOpts.Gravity = bimg.GravityCentre
+	}
+	return bimgOpts, nil
+}
@@ -0,0 +1,195 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/h2non/bimg"
+)
+
+// Test ParseColor accepts RRGGBB hex and defaults to white
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected bimg.Color
+		err      error
+	}{
+		{"", bimg.Color{R: 255, G: 255, B: 255}, nil},
+		{"ff0000", bimg.Color{R: 255}, nil},
+		{"0A141E", bimg.Color{R: 10, G: 20, B: 30}, nil},
+		{"fff", bimg.Color{}, ErrInvalidColor},
+		{"gg0000", bimg.Color{}, ErrInvalidColor},
+		{"#ff0000", bimg.Color{}, ErrInvalidColor},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseColor(tt.value)
+		if err != tt.err {
+			t.Errorf("ParseColor(%q) error = %v, expected %v", tt.value, err, tt.err)
+		}
+		if got != tt.expected {
+			t.Errorf("ParseColor(%q) = %+v, expected %+v", tt.value, got, tt.expected)
+		}
+	}
+}
+
+// Test resizeOptions only embeds on a background when padding a full box
+func TestResizeOptions_Pad(t *testing.T) {
+	opts, err := resizeOptions(ProcessOptions{Width: 300, Height: 250, Pad: true, Background: "102030"}, bimg.PNG)
+	if err != nil {
+		t.Fatalf("resizeOptions failed: %v", err)
+	}
+	if !opts.Embed || opts.Extend != bimg.ExtendBackground || opts.Background != (bimg.Color{R: 16, G: 32, B: 48}) {
+		t.Errorf("Expected embed on background 102030, got %+v", opts)
+	}
+	if opts.Width != 300 || opts.Height != 250 || opts.Type != bimg.PNG {
+		t.Errorf("Expected 300x250 PNG, got %dx%d type %v", opts.Width, opts.Height, opts.Type)
+	}
+
+	if opts, _ := resizeOptions(ProcessOptions{Width: 300, Pad: true}, bimg.PNG); opts.Embed {
+		t.Error("Expected no embedding without a height")
+	}
+	if opts, _ := resizeOptions(ProcessOptions{Width: 300, Height: 250}, bimg.PNG); opts.Embed {
+		t.Error("Expected no embedding without Pad")
+	}
+	if _, err := resizeOptions(ProcessOptions{Width: 300, Height: 250, Pad: true, Background: "red"}, bimg.PNG); err != ErrInvalidColor {
+		t.Errorf("Expected ErrInvalidColor, got %v", err)
+	}
+}
+
+// Test resizeOptions crops to the center, enlarging if needed, when covering a full box
+func TestResizeOptions_Cover(t *testing.T) {
+	opts, err := resizeOptions(ProcessOptions{Width: 150, Height: 150, Cover: true}, bimg.WEBP)
+	if err != nil {
+		t.Fatalf("resizeOptions failed: %v", err)
+	}
+	if !opts.Crop || !opts.Enlarge || opts.Gravity != bimg.GravityCentre || opts.Embed {
+		t.Errorf("Expected an enlarging center crop, got %+v", opts)
+	}
+
+	if opts, _ := resizeOptions(ProcessOptions{Width: 150, Cover: true}, bimg.WEBP); opts.Crop {
+		t.Error("Expected no crop without a height")
+	}
+	if opts, _ := resizeOptions(ProcessOptions{Width: 150, Height: 150, Cover: true, Pad: true}, bimg.WEBP); opts.Crop || !opts.Embed {
+		t.Error("Expected padding to win over cover")
+	}
+}
+
+// Test covering non-square sources produces exactly square output from the center
+func TestImageProcessor_Process_Cover(t *testing.T) {
+	processor := New()
+
+	tests := []struct {
+		name          string
+		width, height int
+		size          int
+	}{
+		{"Wide", 400, 200, 150},
+		{"Tall", 200, 400, 150},
+		{"Smaller than the box", 60, 30, 150},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Green center third along the long side, red elsewhere
+			src := image.NewNRGBA(image.Rect(0, 0, tt.width, tt.height))
+			long := max(tt.width, tt.height)
+			for y := 0; y < tt.height; y++ {
+				for x := 0; x < tt.width; x++ {
+					pos := x
+					if tt.height > tt.width {
+						pos = y
+					}
+					c := color.NRGBA{R: 255, A: 255}
+					if pos >= long/3 && pos < 2*long/3 {
+						c = color.NRGBA{G: 255, A: 255}
+					}
+					src.SetNRGBA(x, y, c)
+				}
+			}
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, src); err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+
+			result, err := processor.Process(buf.Bytes(), ProcessOptions{Width: tt.size, Height: tt.size, Cover: true, Format: FormatPNG, Quality: 90})
+			if err != nil {
+				t.Fatalf("Process failed: %v", err)
+			}
+			img, _, err := image.Decode(bytes.NewReader(result))
+			if err != nil {
+				t.Fatalf("Decode failed: %v", err)
+			}
+			if size := img.Bounds().Size(); size != image.Pt(tt.size, tt.size) {
+				t.Fatalf("Expected exactly %dx%d, got %v", tt.size, tt.size, size)
+			}
+			if got := color.NRGBAModel.Convert(img.At(tt.size/2, tt.size/2)).(color.NRGBA); got.G < 200 || got.R > 55 {
+				t.Errorf("Expected the green center kept, got %v", got)
+			}
+		})
+	}
+}
+
+// Test padding a wide image produces the exact box with colored bands
+func TestImageProcessor_Process_Pad(t *testing.T) {
+	processor := New()
+	src := image.NewNRGBA(image.Rect(0, 0, 200, 100))
+	for i := 0; i < len(src.Pix); i += 4 {
+		src.Pix[i+1], src.Pix[i+3] = 255, 255
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		opts  ProcessOptions
+		delta int
+	}{
+		{"PNG", ProcessOptions{Format: FormatPNG}, 0},
+		{"JPEG 4:4:4", ProcessOptions{Format: FormatJPEG, ChromaSubsampling: Subsampling444}, 16},
+		{"WebP", ProcessOptions{Format: FormatWebP}, 16},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.Width, opts.Height, opts.Quality = 120, 120, 95
+			opts.Pad, opts.Background = true, "ff0000"
+
+			result, err := processor.Process(buf.Bytes(), opts)
+			if err != nil {
+				t.Fatalf("Process failed: %v", err)
+			}
+			img, _, err := image.Decode(bytes.NewReader(result))
+			if err != nil {
+				t.Fatalf("Decode failed: %v", err)
+			}
+			if size := img.Bounds().Size(); size != image.Pt(120, 120) {
+				t.Fatalf("Expected exactly 120x120, got %v", size)
+			}
+
+			// The 120x60 image is centered between two 30px bands
+			checks := []struct {
+				x, y     int
+				expected color.NRGBA
+			}{
+				{60, 5, color.NRGBA{R: 255, A: 255}},
+				{60, 114, color.NRGBA{R: 255, A: 255}},
+				{60, 60, color.NRGBA{G: 255, A: 255}},
+			}
+			for _, check := range checks {
+				got := color.NRGBAModel.Convert(img.At(check.x, check.y)).(color.NRGBA)
+				if abs(int(got.R)-int(check.expected.R)) > tt.delta ||
+					abs(int(got.G)-int(check.expected.G)) > tt.delta ||
+					abs(int(got.B)-int(check.expected.B)) > tt.delta {
+					t.Errorf("Pixel (%d,%d) = %v, expected %v", check.x, check.y, got, check.expected)
+				}
+			}
+		})
+	}
+}
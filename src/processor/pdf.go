@@ -0,0 +1,101 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"math"
+	"strconv"
+
+	"github.com/h2non/bimg"
+)
+
+// FormatPDF is a single-page PDF wrapping a JPEG rendition
+const FormatPDF ImageFormat = "pdf"
+
+// pdfPointsPerInch is the size of the PDF user space unit
+const pdfPointsPerInch = 72
+
+// ErrInvalidPDFImage is returned by WrapPDF for data that is not a JPEG
+var ErrInvalidPDFImage = errors.New("pdf page must wrap a JPEG image")
+
+// PDFSupported reports whether PDF pages can be produced. libvips cannot
+// write PDF, so pages wrap a JPEG and need libvips to encode JPEG.
+func PDFSupported() bool {
+	return bimg.IsImageTypeSupportedByVips(bimg.JPEG).Save
+}
+
+// IsPDF reports whether data starts with the PDF signature
+func IsPDF(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("%PDF-"))
+}
+
+// WrapPDF embeds a JPEG unchanged in a single-page PDF. The page is the
+// image's size printed at dpi (0 = 72, one point per pixel). The document
+// carries no dates or IDs, so the same JPEG always gives the same PDF.
+func WrapPDF(jpegData []byte, dpi int) ([]byte, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(jpegData))
+	if err != nil || format != "jpeg" {
+		return nil, ErrInvalidPDFImage
+	}
+	colorSpace := "/DeviceRGB"
+	switch cfg.ColorModel {
+	case color.GrayModel:
+		colorSpace = "/DeviceGray"
+	case color.CMYKModel:
+		colorSpace = "/DeviceCMYK"
+	}
+	if dpi <= 0 {
+		dpi = pdfPointsPerInch
+	}
+	width := pdfPoints(cfg.Width, dpi)
+	height := pdfPoints(cfg.Height, dpi)
+
+	content := fmt.Sprintf("q %s 0 0 %s 0 0 cm /Im0 Do Q", width, height)
+	objects := [][]byte{
+		[]byte("<< /Type /Catalog /Pages 2 0 R >>"),
+		[]byte("<< /Type /Pages /Kids [3 0 R] /Count 1 >>"),
+		[]byte(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /XObject << /Im0 4 0 R >> >> /Contents 5 0 R >>", width, height)),
+		pdfStream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter /DCTDecode", cfg.Width, cfg.Height, colorSpace), jpegData),
+		pdfStream("", []byte(content)),
+	}
+
+	var buf bytes.Buffer
+	// The binary comment marks the file as binary for transfer tools
+	buf.WriteString("%PDF-1.4\n%\xE2\xE3\xCF\xD3\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n", i+1)
+		buf.Write(object)
+		buf.WriteString("\nendobj\n")
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes(), nil
+}
+
+// pdfStream returns a stream object with the given dictionary entries
+func pdfStream(dict string, data []byte) []byte {
+	var buf bytes.Buffer
+	if dict != "" {
+		dict += " "
+	}
+	fmt.Fprintf(&buf, "<< %s/Length %d >>\nstream\n", dict, len(data))
+	buf.Write(data)
+	buf.WriteString("\nendstream")
+	return buf.Bytes()
+}
+
+// pdfPoints converts pixels at dpi to points, to a thousandth of a point
+func pdfPoints(pixels, dpi int) string {
+	points := math.Round(float64(pixels)*pdfPointsPerInch/float64(dpi)*1000) / 1000
+	return strconv.FormatFloat(points, 'f', -1, 64)
+}
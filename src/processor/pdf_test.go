@@ -0,0 +1,100 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+// Test WrapPDF produces a valid single-page PDF sized from the image and DPI
+func TestWrapPDF(t *testing.T) {
+	rgb := encodeJPEG(t, image.NewRGBA(image.Rect(0, 0, 300, 150)), 75)
+	gray := encodeJPEG(t, image.NewGray(image.Rect(0, 0, 300, 150)), 75)
+
+	tests := []struct {
+		name       string
+		data       []byte
+		dpi        int
+		mediaBox   string
+		colorSpace string
+	}{
+		{"72 dpi by default", rgb, 0, "[0 0 300 150]", "/DeviceRGB"},
+		{"150 dpi", rgb, 150, "[0 0 144 72]", "/DeviceRGB"},
+		{"300 dpi", rgb, 300, "[0 0 72 36]", "/DeviceRGB"},
+		{"fractional points", rgb, 96, "[0 0 225 112.5]", "/DeviceRGB"},
+		{"grayscale", gray, 0, "[0 0 300 150]", "/DeviceGray"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pdf, err := WrapPDF(tt.data, tt.dpi)
+			if err != nil {
+				t.Fatalf("WrapPDF() returned error: %v", err)
+			}
+
+			if !IsPDF(pdf) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+				t.Fatalf("Expected a PDF document, got %q...", pdf[:min(len(pdf), 16)])
+			}
+			if !bytes.Contains(pdf, []byte("/MediaBox "+tt.mediaBox)) {
+				t.Errorf("Expected page size %s", tt.mediaBox)
+			}
+			if !bytes.Contains(pdf, []byte("/Width 300 /Height 150 /ColorSpace "+tt.colorSpace)) {
+				t.Errorf("Expected a 300x150 %s image", tt.colorSpace)
+			}
+			if !bytes.Contains(pdf, tt.data) {
+				t.Error("Expected the JPEG to be embedded unchanged")
+			}
+			checkXref(t, pdf)
+		})
+	}
+}
+
+// checkXref verifies the cross-reference table points at each object
+func checkXref(t *testing.T, pdf []byte) {
+	t.Helper()
+	matches := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(pdf)
+	if matches == nil {
+		t.Fatal("Expected a startxref entry")
+	}
+	xref, _ := strconv.Atoi(string(matches[1]))
+	if !bytes.HasPrefix(pdf[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[xref:], -1)
+	if len(entries) != 5 {
+		t.Fatalf("Expected 5 objects in the xref table, got %d", len(entries))
+	}
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		if !bytes.HasPrefix(pdf[offset:], []byte(fmt.Sprintf("%d 0 obj\n", i+1))) {
+			t.Errorf("xref entry %d does not point at object %d", i+1, i+1)
+		}
+	}
+}
+
+// Test WrapPDF is deterministic and rejects data that is not a JPEG
+func TestWrapPDF_Input(t *testing.T) {
+	data := encodeJPEG(t, image.NewRGBA(image.Rect(0, 0, 32, 32)), 75)
+	first, err := WrapPDF(data, 0)
+	if err != nil {
+		t.Fatalf("WrapPDF() returned error: %v", err)
+	}
+	second, _ := WrapPDF(data, 0)
+	if !bytes.Equal(first, second) {
+		t.Error("Expected identical PDFs for the same JPEG")
+	}
+
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 32, 32))); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	for name, input := range map[string][]byte{"PNG": pngData.Bytes(), "garbage": []byte("not an image")} {
+		if _, err := WrapPDF(input, 0); err != ErrInvalidPDFImage {
+			t.Errorf("WrapPDF(%s) error = %v, expected ErrInvalidPDFImage", name, err)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package processor
+
+import "bytes"
+
+// pngInterlaceOffset is the position of the interlace method in a PNG,
+// the last byte of the IHDR chunk data
+const pngInterlaceOffset = 28
+
+// IsProgressive reports whether data is a progressive JPEG, with a SOF2
+// frame header, or an Adam7 interlaced PNG
+func IsProgressive(data []byte) bool {
+	switch {
+	case isJPEG(data):
+		progressive := false
+		jpegSegments(data, func(pos, length int) {
+			if data[pos+1] == 0xC2 {
+				progressive = true
+			}
+		})
+		return progressive
+	case bytes.HasPrefix(data, pngSignature):
+		return len(data) > pngInterlaceOffset && string(data[12:16]) == "IHDR" && data[pngInterlaceOffset] == 1
+	}
+	return false
+}
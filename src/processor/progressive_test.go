@@ -0,0 +1,76 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// Test progressive JPEG and interlaced PNG headers are detected
+func TestIsProgressive(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+
+	var baselineJPEG bytes.Buffer
+	if err := jpeg.Encode(&baselineJPEG, img, nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+	progressiveJPEG := bytes.Replace(baselineJPEG.Bytes(), []byte{0xFF, 0xC0}, []byte{0xFF, 0xC2}, 1)
+
+	var plainPNG bytes.Buffer
+	if err := png.Encode(&plainPNG, img); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	interlacedPNG := append([]byte{}, plainPNG.Bytes()...)
+	interlacedPNG[pngInterlaceOffset] = 1
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected bool
+	}{
+		{"baseline JPEG", baselineJPEG.Bytes(), false},
+		{"progressive JPEG", progressiveJPEG, true},
+		{"PNG", plainPNG.Bytes(), false},
+		{"interlaced PNG", interlacedPNG, true},
+		{"GIF", []byte("GIF89a"), false},
+		{"empty", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsProgressive(tt.data); got != tt.expected {
+				t.Errorf("IsProgressive() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+// Test Process encodes progressive JPEG and interlaced PNG only on request
+func TestImageProcessor_Process_Progressive(t *testing.T) {
+	processor := New()
+	data := loadTestImage(t, "sample.jpg")
+
+	for _, format := range []ImageFormat{FormatJPEG, FormatPNG} {
+		for _, progressive := range []bool{false, true} {
+			opts := ProcessOptions{Width: 200, Height: 150, Format: format, Quality: DefaultQuality, Progressive: progressive}
+			result, err := processor.Process(data, opts)
+			if err != nil {
+				t.Fatalf("Process(%s, progressive=%v) failed: %v", format, progressive, err)
+			}
+			if got := IsProgressive(result); got != progressive {
+				t.Errorf("Process(%s, progressive=%v) output progressive = %v", format, progressive, got)
+			}
+		}
+	}
+
+	// WebP has no progressive mode, the option is ignored
+	result, err := processor.Process(data, ProcessOptions{Width: 200, Height: 150, Format: FormatWebP, Quality: DefaultQuality, Progressive: true})
+	if err != nil {
+		t.Fatalf("Process(webp) failed: %v", err)
+	}
+	if IsProgressive(result) {
+		t.Error("Expected WebP output not to be reported progressive")
+	}
+}
@@ -0,0 +1,294 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+
+	"github.com/h2non/bimg"
+	_ "golang.org/x/image/webp"
+)
+
+// Auto quality search bounds and defaults
+const (
+	MinAutoQuality      = 40
+	MaxAutoQuality      = 95
+	DefaultSSIMTarget   = 0.98
+	DefaultAutoMaxSteps = 6
+	metricSampleSize    = 256
+	ssimWindow          = 8
+
+	// heuristicDecodePixels bounds the sources HeuristicQuality decodes
+	// whole; larger ones are shrunk by libvips first, which decodes JPEGs
+	// at a fraction of their size
+	heuristicDecodePixels = 4 << 20
+)
+
+// QualityMetric scores how closely a candidate matches a reference image.
+// A score of 1 means the images are identical.
+type QualityMetric interface {
+	// Name returns the metric name
+	Name() string
+
+	// Score compares candidate against reference
+	Score(reference, candidate image.Image) float64
+}
+
+// AutoQualityOptions controls the perceptual quality search
+type AutoQualityOptions struct {
+	Metric   QualityMetric // nil selects the heuristic without searching
+	Target   float64       // Minimum acceptable score
+	Min      int           // Lowest quality tried
+	Max      int           // Highest quality tried
+	MaxSteps int           // Maximum number of encodes during the search
+}
+
+// DefaultAutoQualityOptions returns SSIM-based search options
+func DefaultAutoQualityOptions() AutoQualityOptions {
+	return AutoQualityOptions{
+		Metric:   NewSSIMMetric(),
+		Target:   DefaultSSIMTarget,
+		Min:      MinAutoQuality,
+		Max:      MaxAutoQuality,
+		MaxSteps: DefaultAutoMaxSteps,
+	}
+}
+
+// MetricByName returns the quality metric for name.
+// "heuristic" returns nil, which selects the heuristic fallback.
+func MetricByName(name string) (QualityMetric, error) {
+	switch name {
+	case "", "ssim":
+		return NewSSIMMetric(), nil
+	case "heuristic":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown quality metric: %s", name)
+	}
+}
+
+// SelectQuality processes data with the lowest quality whose output still
+// meets the metric target, using a bounded binary search. It returns the
+// processed image and the chosen quality. When no metric is configured or
+// an output cannot be decoded for scoring, HeuristicQuality is used instead.
+// The search stops with ctx's error once ctx ends.
+func SelectQuality(ctx context.Context, p ImageProcessor, data []byte, opts ProcessOptions, aq AutoQualityOptions) ([]byte, int, error) {
+	if aq.Min < MinQuality || aq.Min > aq.Max || aq.Max > MaxQuality {
+		return nil, 0, ErrInvalidQuality
+	}
+
+	if aq.Metric == nil {
+		return processHeuristic(ctx, p, data, opts, aq)
+	}
+
+	// Encode a near-lossless reference at the target dimensions
+	opts.Quality = MaxQuality
+	refData, err := ProcessContext(ctx, p, data, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	reference, _, err := image.Decode(bytes.NewReader(refData))
+	if err != nil {
+		return processHeuristic(ctx, p, data, opts, aq)
+	}
+
+	lo, hi := aq.Min, aq.Max
+	bestQuality := 0
+	var best []byte
+	for step := 0; lo <= hi && (aq.MaxSteps <= 0 || step < aq.MaxSteps); step++ {
+		mid := (lo + hi) / 2
+		opts.Quality = mid
+		out, err := ProcessContext(ctx, p, data, opts)
+		if err != nil {
+			return nil, 0, err
+		}
+		candidate, _, err := image.Decode(bytes.NewReader(out))
+		if err != nil {
+			return processHeuristic(ctx, p, data, opts, aq)
+		}
+
+		if aq.Metric.Score(reference, candidate) >= aq.Target {
+			best, bestQuality = out, mid
+			hi = mid - 1
+		} else {
+			lo = mid + 1
+		}
+	}
+
+	// Nothing met the target within the budget: use the upper bound
+	if best == nil {
+		opts.Quality = aq.Max
+		out, err := ProcessContext(ctx, p, data, opts)
+		if err != nil {
+			return nil, 0, err
+		}
+		return out, aq.Max, nil
+	}
+
+	return best, bestQuality, nil
+}
+
+// processHeuristic processes data once with the heuristic quality
+func processHeuristic(ctx context.Context, p ImageProcessor, data []byte, opts ProcessOptions, aq AutoQualityOptions) ([]byte, int, error) {
+	quality := HeuristicQuality(data, aq.Min, aq.Max)
+	opts.Quality = quality
+	out, err := ProcessContext(ctx, p, data, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	return out, quality, nil
+}
+
+// HeuristicQuality estimates a quality from source complexity without
+// encoding. Smooth images show artifacts easily and get a higher quality,
+// busy images mask them and get a lower one. Undecodable sources get max.
+func HeuristicQuality(data []byte, min, max int) int {
+	img, err := decodeSample(data)
+	if err != nil {
+		return max
+	}
+
+	lum, w, h := sampleLuma(img)
+	if w < 2 || h < 2 {
+		return max
+	}
+
+	// Mean absolute horizontal and vertical gradient, 0-255
+	var sum float64
+	for y := 0; y < h-1; y++ {
+		for x := 0; x < w-1; x++ {
+			v := lum[y*w+x]
+			sum += math.Abs(v-lum[y*w+x+1]) + math.Abs(v-lum[(y+1)*w+x])
+		}
+	}
+	gradient := sum / float64(2*(w-1)*(h-1))
+
+	// Gradients of 32 and above count as fully busy
+	busy := math.Min(gradient/32, 1)
+	return max - int(math.Round(busy*float64(max-min)))
+}
+
+// decodeSample decodes data for sampling, shrunk to metricSampleSize
+// pixels on its longer side when it is over heuristicDecodePixels
+func decodeSample(data []byte) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height <= heuristicDecodePixels {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		return img, err
+	}
+
+	shrink := bimg.Options{Width: metricSampleSize, Type: bimg.PNG}
+	if cfg.Height > cfg.Width {
+		shrink = bimg.Options{Height: metricSampleSize, Type: bimg.PNG}
+	}
+	shrunk, err := bimg.NewImage(data).Process(deterministicOptions(shrink))
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(shrunk))
+	return img, err
+}
+
+// ssimMetric implements QualityMetric using mean structural similarity
+type ssimMetric struct{}
+
+// NewSSIMMetric creates a QualityMetric based on SSIM over luma
+func NewSSIMMetric() QualityMetric {
+	return &ssimMetric{}
+}
+
+// Name returns the metric name
+func (m *ssimMetric) Name() string {
+	return "ssim"
+}
+
+// Score computes the mean SSIM of non-overlapping windows on downsampled luma
+func (m *ssimMetric) Score(reference, candidate image.Image) float64 {
+	if reference.Bounds().Dx() != candidate.Bounds().Dx() || reference.Bounds().Dy() != candidate.Bounds().Dy() {
+		return 0
+	}
+
+	a, w, h := sampleLuma(reference)
+	b, _, _ := sampleLuma(candidate)
+
+	const (
+		c1 = (0.01 * 255) * (0.01 * 255)
+		c2 = (0.03 * 255) * (0.03 * 255)
+	)
+
+	var total float64
+	windows := 0
+	for wy := 0; wy+ssimWindow <= h; wy += ssimWindow {
+		for wx := 0; wx+ssimWindow <= w; wx += ssimWindow {
+			var meanA, meanB float64
+			for y := wy; y < wy+ssimWindow; y++ {
+				for x := wx; x < wx+ssimWindow; x++ {
+					meanA += a[y*w+x]
+					meanB += b[y*w+x]
+				}
+			}
+			n := float64(ssimWindow * ssimWindow)
+			meanA /= n
+			meanB /= n
+
+			var varA, varB, cov float64
+			for y := wy; y < wy+ssimWindow; y++ {
+				for x := wx; x < wx+ssimWindow; x++ {
+					da := a[y*w+x] - meanA
+					db := b[y*w+x] - meanB
+					varA += da * da
+					varB += db * db
+					cov += da * db
+				}
+			}
+			varA /= n - 1
+			varB /= n - 1
+			cov /= n - 1
+
+			total += ((2*meanA*meanB + c1) * (2*cov + c2)) /
+				((meanA*meanA + meanB*meanB + c1) * (varA + varB + c2))
+			windows++
+		}
+	}
+
+	// Images smaller than one window compare by exact luma equality
+	if windows == 0 {
+		for i := range a {
+			if a[i] != b[i] {
+				return 0
+			}
+		}
+		return 1
+	}
+
+	return total / float64(windows)
+}
+
+// sampleLuma returns the luma plane of img, downsampled by nearest neighbour
+// so that neither side exceeds metricSampleSize pixels
+func sampleLuma(img image.Image) ([]float64, int, int) {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	scale := math.Max(float64(srcW), float64(srcH)) / metricSampleSize
+	if scale < 1 {
+		scale = 1
+	}
+	w := int(float64(srcW) / scale)
+	h := int(float64(srcH) / scale)
+
+	lum := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+int(float64(x)*scale), bounds.Min.Y+int(float64(y)*scale)).RGBA()
+			lum[y*w+x] = (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 257
+		}
+	}
+	return lum, w, h
+}
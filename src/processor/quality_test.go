@@ -0,0 +1,263 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// jpegProcessor is a pure Go ImageProcessor that re-encodes as JPEG
+type jpegProcessor struct {
+	calls int
+}
+
+func (p *jpegProcessor) Resize(data []byte, width, height int) ([]byte, error) {
+	return data, nil
+}
+
+func (p *jpegProcessor) ConvertFormat(data []byte, format ImageFormat) ([]byte, error) {
+	return data, nil
+}
+
+func (p *jpegProcessor) AdjustQuality(data []byte, quality int) ([]byte, error) {
+	return p.Process(data, ProcessOptions{Quality: quality})
+}
+
+func (p *jpegProcessor) Process(data []byte, opts ProcessOptions) ([]byte, error) {
+	p.calls++
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: opts.Quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (p *jpegProcessor) ValidateImage(data []byte) error {
+	return nil
+}
+
+// gradientImage creates a smooth test image
+func gradientImage(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 255 / w), uint8(y * 255 / h), 128, 255})
+		}
+	}
+	return img
+}
+
+// noiseImage creates a busy test image
+func noiseImage(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	seed := uint32(1)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			seed = seed*1664525 + 1013904223
+			v := uint8(seed >> 24)
+			img.Set(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+	return img
+}
+
+// encodeJPEG encodes img at the given quality
+func encodeJPEG(t *testing.T, img image.Image, quality int) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatalf("jpeg.Encode() failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// Test SSIM of identical images
+func TestSSIMMetric_Identical(t *testing.T) {
+	img := gradientImage(64, 64)
+
+	score := NewSSIMMetric().Score(img, img)
+
+	if score < 0.999 {
+		t.Errorf("Score() = %f, expected ~1 for identical images", score)
+	}
+}
+
+// Test SSIM drops for heavily degraded images
+func TestSSIMMetric_Degraded(t *testing.T) {
+	img := noiseImage(64, 64)
+	degraded, _, err := image.Decode(bytes.NewReader(encodeJPEG(t, img, 5)))
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+
+	score := NewSSIMMetric().Score(img, degraded)
+
+	if score >= DefaultSSIMTarget {
+		t.Errorf("Score() = %f, expected below %f for a degraded image", score, DefaultSSIMTarget)
+	}
+}
+
+// Test SSIM of images with different dimensions
+func TestSSIMMetric_DifferentSizes(t *testing.T) {
+	score := NewSSIMMetric().Score(gradientImage(64, 64), gradientImage(32, 32))
+
+	if score != 0 {
+		t.Errorf("Score() = %f, expected 0 for mismatched sizes", score)
+	}
+}
+
+// Test auto quality search stays within bounds and meets the target
+func TestSelectQuality_WithinBounds(t *testing.T) {
+	p := &jpegProcessor{}
+	data := encodeJPEG(t, gradientImage(128, 128), 100)
+	aq := DefaultAutoQualityOptions()
+
+	out, quality, err := SelectQuality(context.Background(), p, data, ProcessOptions{Format: FormatJPEG}, aq)
+
+	if err != nil {
+		t.Fatalf("SelectQuality() failed: %v", err)
+	}
+	if quality < aq.Min || quality > aq.Max {
+		t.Errorf("quality = %d, expected within [%d, %d]", quality, aq.Min, aq.Max)
+	}
+	if _, _, err := image.Decode(bytes.NewReader(out)); err != nil {
+		t.Errorf("SelectQuality() output is not decodable: %v", err)
+	}
+	// Reference plus at most MaxSteps search encodes
+	if p.calls > aq.MaxSteps+1 {
+		t.Errorf("Process() called %d times, expected at most %d", p.calls, aq.MaxSteps+1)
+	}
+}
+
+// Test auto quality picks a lower quality when the target is easy to meet
+func TestSelectQuality_LowTarget(t *testing.T) {
+	data := encodeJPEG(t, gradientImage(128, 128), 100)
+	aq := DefaultAutoQualityOptions()
+	aq.Target = 0
+
+	_, quality, err := SelectQuality(context.Background(), &jpegProcessor{}, data, ProcessOptions{}, aq)
+
+	if err != nil {
+		t.Fatalf("SelectQuality() failed: %v", err)
+	}
+	if quality != aq.Min {
+		t.Errorf("quality = %d, expected min %d", quality, aq.Min)
+	}
+}
+
+// Test auto quality uses the upper bound when the target is unreachable
+func TestSelectQuality_UnreachableTarget(t *testing.T) {
+	data := encodeJPEG(t, noiseImage(64, 64), 100)
+	aq := DefaultAutoQualityOptions()
+	aq.Target = 1.1
+
+	_, quality, err := SelectQuality(context.Background(), &jpegProcessor{}, data, ProcessOptions{}, aq)
+
+	if err != nil {
+		t.Fatalf("SelectQuality() failed: %v", err)
+	}
+	if quality != aq.Max {
+		t.Errorf("quality = %d, expected max %d", quality, aq.Max)
+	}
+}
+
+// Test heuristic mode encodes exactly once
+func TestSelectQuality_Heuristic(t *testing.T) {
+	p := &jpegProcessor{}
+	data := encodeJPEG(t, gradientImage(64, 64), 100)
+	aq := DefaultAutoQualityOptions()
+	aq.Metric = nil
+
+	_, quality, err := SelectQuality(context.Background(), p, data, ProcessOptions{}, aq)
+
+	if err != nil {
+		t.Fatalf("SelectQuality() failed: %v", err)
+	}
+	if quality < aq.Min || quality > aq.Max {
+		t.Errorf("quality = %d, expected within [%d, %d]", quality, aq.Min, aq.Max)
+	}
+	if p.calls != 1 {
+		t.Errorf("Process() called %d times, expected 1", p.calls)
+	}
+}
+
+// cancellingProcessor is a jpegProcessor that cancels the search's context
+// once it has encoded the reference
+type cancellingProcessor struct {
+	jpegProcessor
+	cancel context.CancelFunc
+}
+
+func (p *cancellingProcessor) Process(data []byte, opts ProcessOptions) ([]byte, error) {
+	defer p.cancel()
+	return p.jpegProcessor.Process(data, opts)
+}
+
+// Test the search stops once its context is cancelled
+func TestSelectQuality_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := &cancellingProcessor{cancel: cancel}
+	data := encodeJPEG(t, gradientImage(128, 128), 100)
+
+	_, _, err := SelectQuality(ctx, p, data, ProcessOptions{Format: FormatJPEG}, DefaultAutoQualityOptions())
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("SelectQuality() error = %v, expected context.Canceled", err)
+	}
+	if p.calls != 1 {
+		t.Errorf("Process() called %d times, expected only the reference", p.calls)
+	}
+}
+
+// Test invalid search bounds
+func TestSelectQuality_InvalidBounds(t *testing.T) {
+	aq := DefaultAutoQualityOptions()
+	aq.Min, aq.Max = 90, 50
+
+	_, _, err := SelectQuality(context.Background(), &jpegProcessor{}, nil, ProcessOptions{}, aq)
+
+	if err != ErrInvalidQuality {
+		t.Errorf("SelectQuality() error = %v, expected ErrInvalidQuality", err)
+	}
+}
+
+// Test heuristic gives smooth images a higher quality than busy ones
+func TestHeuristicQuality_SmoothVsBusy(t *testing.T) {
+	smooth := HeuristicQuality(encodeJPEG(t, gradientImage(64, 64), 100), MinAutoQuality, MaxAutoQuality)
+	busy := HeuristicQuality(encodeJPEG(t, noiseImage(64, 64), 100), MinAutoQuality, MaxAutoQuality)
+
+	if smooth <= busy {
+		t.Errorf("smooth quality %d should exceed busy quality %d", smooth, busy)
+	}
+	if busy < MinAutoQuality || smooth > MaxAutoQuality {
+		t.Errorf("qualities %d/%d outside [%d, %d]", busy, smooth, MinAutoQuality, MaxAutoQuality)
+	}
+}
+
+// Test heuristic with undecodable data
+func TestHeuristicQuality_InvalidData(t *testing.T) {
+	if q := HeuristicQuality([]byte("not an image"), MinAutoQuality, MaxAutoQuality); q != MaxAutoQuality {
+		t.Errorf("HeuristicQuality() = %d, expected %d", q, MaxAutoQuality)
+	}
+}
+
+// Test metric lookup by name
+func TestMetricByName(t *testing.T) {
+	if m, err := MetricByName("ssim"); err != nil || m == nil || m.Name() != "ssim" {
+		t.Errorf("MetricByName(ssim) = %v, %v", m, err)
+	}
+	if m, err := MetricByName("heuristic"); err != nil || m != nil {
+		t.Errorf("MetricByName(heuristic) = %v, %v, expected nil metric", m, err)
+	}
+	if _, err := MetricByName("psnr"); err == nil {
+		t.Error("MetricByName(psnr) expected error")
+	}
+}
@@ -0,0 +1,134 @@
+package processor
+
+import (
+	"errors"
+	"image"
+	"math"
+	"sort"
+
+	"golang.org/x/image/draw"
+)
+
+// Spritesheet layouts for PackSprites
+const (
+	SpriteLayoutGrid = "grid" // Every sprite scaled to fit a Cell x Cell square
+	SpriteLayoutPack = "pack" // Sprites kept at their size and packed in shelves
+)
+
+// ErrSpriteTooLarge is returned when a spritesheet would exceed MaxDimension
+var ErrSpriteTooLarge = errors.New("spritesheet exceeds the maximum dimensions")
+
+// Sprite is a named image placed on a spritesheet
+type Sprite struct {
+	Name  string
+	Image image.Image
+}
+
+// SpriteRect is where a sprite was placed on the sheet
+type SpriteRect struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+// SpriteOptions controls how PackSprites lays out a sheet
+type SpriteOptions struct {
+	Layout  string // grid or pack (empty = grid)
+	Cell    int    // Cell size of the grid layout in pixels
+	Padding int    // Transparent pixels between sprites
+}
+
+// PackSprites draws sprites onto one transparent sheet and returns it with
+// each sprite's rectangle by name. The grid layout scales every sprite to fit
+// a cell, keeping its aspect ratio, and centers it there; the pack layout
+// keeps their size, placing the tallest first in rows about as wide as the
+// sheet is tall.
+func PackSprites(sprites []Sprite, opts SpriteOptions) (*image.NRGBA, map[string]SpriteRect, error) {
+	if len(sprites) == 0 {
+		return nil, nil, errors.New("no sprites to pack")
+	}
+
+	var rects []SpriteRect
+	var width, height int
+	switch opts.Layout {
+	case "", SpriteLayoutGrid:
+		if opts.Cell < 1 {
+			return nil, nil, errors.New("grid layout needs a positive cell size")
+		}
+		rects, width, height = gridLayout(sprites, opts.Cell, opts.Padding)
+	case SpriteLayoutPack:
+		rects, width, height = shelfLayout(sprites, opts.Padding)
+	default:
+		return nil, nil, errors.New("unknown sprite layout: must be grid or pack")
+	}
+	if width > MaxDimension || height > MaxDimension {
+		return nil, nil, ErrSpriteTooLarge
+	}
+
+	sheet := image.NewNRGBA(image.Rect(0, 0, width, height))
+	coords := make(map[string]SpriteRect, len(sprites))
+	for i, sprite := range sprites {
+		r := rects[i]
+		target := image.Rect(r.X, r.Y, r.X+r.W, r.Y+r.H)
+		bounds := sprite.Image.Bounds()
+		if bounds.Dx() == r.W && bounds.Dy() == r.H {
+			draw.Draw(sheet, target, sprite.Image, bounds.Min, draw.Src)
+		} else {
+			draw.CatmullRom.Scale(sheet, target, sprite.Image, bounds, draw.Src, nil)
+		}
+		coords[sprite.Name] = r
+	}
+	return sheet, coords, nil
+}
+
+// gridLayout places sprites row by row in a square-ish grid of cell x cell
+// squares, each sprite fitted and centered in its cell
+func gridLayout(sprites []Sprite, cell, padding int) ([]SpriteRect, int, int) {
+	columns := int(math.Ceil(math.Sqrt(float64(len(sprites)))))
+	rows := (len(sprites) + columns - 1) / columns
+
+	rects := make([]SpriteRect, len(sprites))
+	for i, sprite := range sprites {
+		bounds := sprite.Image.Bounds()
+		w, h := scaledSize(bounds.Dx(), bounds.Dy(), cell, 0)
+		if bounds.Dy() > bounds.Dx() {
+			w, h = scaledSize(bounds.Dx(), bounds.Dy(), 0, cell)
+		}
+		x := (i%columns)*(cell+padding) + (cell-w)/2
+		y := (i/columns)*(cell+padding) + (cell-h)/2
+		rects[i] = SpriteRect{X: x, Y: y, W: w, H: h}
+	}
+	return rects, columns*cell + (columns-1)*padding, rows*cell + (rows-1)*padding
+}
+
+// shelfLayout packs sprites at their own size into rows, tallest first, with
+// rows limited to the width of a square holding their total area
+func shelfLayout(sprites []Sprite, padding int) ([]SpriteRect, int, int) {
+	order := make([]int, len(sprites))
+	area, widest := 0, 0
+	for i, sprite := range sprites {
+		order[i] = i
+		bounds := sprite.Image.Bounds()
+		area += (bounds.Dx() + padding) * (bounds.Dy() + padding)
+		widest = max(widest, bounds.Dx())
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return sprites[order[a]].Image.Bounds().Dy() > sprites[order[b]].Image.Bounds().Dy()
+	})
+	rowWidth := max(widest, int(math.Ceil(math.Sqrt(float64(area)))))
+
+	rects := make([]SpriteRect, len(sprites))
+	x, y, shelf, width := 0, 0, 0, 0
+	for _, i := range order {
+		bounds := sprites[i].Image.Bounds()
+		if x > 0 && x+bounds.Dx() > rowWidth {
+			x, y, shelf = 0, y+shelf+padding, 0
+		}
+		rects[i] = SpriteRect{X: x, Y: y, W: bounds.Dx(), H: bounds.Dy()}
+		width = max(width, x+bounds.Dx())
+		shelf = max(shelf, bounds.Dy())
+		x += bounds.Dx() + padding
+	}
+	return rects, width, y + shelf
+}
@@ -0,0 +1,92 @@
+package processor
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// solidImage returns a w x h image filled with c
+func solidImage(w, h int, c color.Color) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	return img
+}
+
+// overlaps reports whether two sprite rectangles share a pixel
+func overlaps(a, b SpriteRect) bool {
+	return a.X < b.X+b.W && b.X < a.X+a.W && a.Y < b.Y+b.H && b.Y < a.Y+a.H
+}
+
+func TestPackSprites_Grid(t *testing.T) {
+	red := color.NRGBA{255, 0, 0, 255}
+	blue := color.NRGBA{0, 0, 255, 255}
+	sprites := []Sprite{
+		{Name: "square", Image: solidImage(64, 64, red)},
+		{Name: "wide", Image: solidImage(64, 32, blue)},
+		{Name: "tall", Image: solidImage(16, 64, red)},
+	}
+
+	sheet, coords, err := PackSprites(sprites, SpriteOptions{Cell: 32, Padding: 2})
+	require.NoError(t, err)
+
+	// Three sprites fill a 2x2 grid of 32px cells with 2px gaps
+	assert.Equal(t, image.Rect(0, 0, 66, 66), sheet.Bounds())
+	assert.Equal(t, SpriteRect{X: 0, Y: 0, W: 32, H: 32}, coords["square"])
+	assert.Equal(t, SpriteRect{X: 34, Y: 8, W: 32, H: 16}, coords["wide"])
+	assert.Equal(t, SpriteRect{X: 12, Y: 34, W: 8, H: 32}, coords["tall"])
+
+	// The sheet holds each sprite at its coordinates, transparent elsewhere
+	wide := coords["wide"]
+	assert.Equal(t, blue, sheet.NRGBAAt(wide.X+wide.W/2, wide.Y+wide.H/2))
+	assert.Equal(t, uint8(0), sheet.NRGBAAt(wide.X+wide.W/2, wide.Y-1).A)
+	assert.Equal(t, red, sheet.NRGBAAt(coords["tall"].X, coords["tall"].Y))
+}
+
+func TestPackSprites_Pack(t *testing.T) {
+	sizes := map[string][2]int{"a": {40, 10}, "b": {20, 30}, "c": {30, 20}, "d": {10, 10}, "e": {50, 5}}
+	var sprites []Sprite
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		size := sizes[name]
+		sprites = append(sprites, Sprite{Name: name, Image: solidImage(size[0], size[1], color.White)})
+	}
+
+	sheet, coords, err := PackSprites(sprites, SpriteOptions{Layout: SpriteLayoutPack, Padding: 1})
+	require.NoError(t, err)
+	require.Len(t, coords, len(sprites))
+
+	maxX, maxY := 0, 0
+	for name, r := range coords {
+		// Packed sprites keep their size and stay on the sheet
+		assert.Equal(t, sizes[name], [2]int{r.W, r.H}, name)
+		assert.True(t, image.Rect(r.X, r.Y, r.X+r.W, r.Y+r.H).In(sheet.Bounds()), name)
+		assert.Equal(t, uint8(255), sheet.NRGBAAt(r.X, r.Y).A, name)
+		maxX, maxY = max(maxX, r.X+r.W), max(maxY, r.Y+r.H)
+		for other, o := range coords {
+			if other != name {
+				assert.False(t, overlaps(r, o), "%s overlaps %s", name, other)
+			}
+		}
+	}
+	// The sheet is exactly as large as the placed sprites need
+	assert.Equal(t, image.Rect(0, 0, maxX, maxY), sheet.Bounds())
+	// The tallest sprite opens the first row
+	assert.Equal(t, SpriteRect{X: 0, Y: 0, W: 20, H: 30}, coords["b"])
+}
+
+func TestPackSprites_Invalid(t *testing.T) {
+	sprite := []Sprite{{Name: "a", Image: solidImage(10, 10, color.White)}}
+
+	_, _, err := PackSprites(nil, SpriteOptions{Cell: 32})
+	assert.Error(t, err)
+	_, _, err = PackSprites(sprite, SpriteOptions{Layout: "spiral", Cell: 32})
+	assert.Error(t, err)
+	_, _, err = PackSprites(sprite, SpriteOptions{Layout: SpriteLayoutGrid})
+	assert.Error(t, err)
+	_, _, err = PackSprites(sprite, SpriteOptions{Cell: MaxDimension + 1})
+	assert.ErrorIs(t, err, ErrSpriteTooLarge)
+}
@@ -0,0 +1,40 @@
+package processor
+
+import "github.com/h2non/bimg"
+
+// MaxThumbnailSize is the largest output dimension rendered by the thumbnail
+// fast path
+const MaxThumbnailSize = 256
+
+// thumbnailInterpolator resamples fast-path thumbnails. Its 2x2 window lets
+// bimg shrink by the whole resize factor up front: JPEG and WebP sources are
+// decoded at 1/2, 1/4 or 1/8 scale by libjpeg and libwebp (shrink-on-load)
+// and box filtered to near the target, leaving only a small residual
+// resample. The default bicubic window shrinks less and resamples more of the
+// full image, which costs most when a large photo becomes a small thumbnail.
+const thumbnailInterpolator = bimg.Bilinear
+
+// fastThumbnail reports whether opts render a small thumbnail of a JPEG or
+// WebP source without any step that needs the full-resolution image
+func fastThumbnail(data []byte, opts ProcessOptions, subsampling ChromaSubsampling) bool {
+	if opts.Width == 0 && opts.Height == 0 {
+		return false
+	}
+	if opts.Width > MaxThumbnailSize || opts.Height > MaxThumbnailSize {
+		return false
+	}
+	if opts.Poster || opts.Pad || !opts.Crop.Empty() || opts.Trim {
+		return false
+	}
+	// Finer chroma subsampling is encoded in Go from a full PNG render
+	if (opts.Format == FormatJPEG || opts.Format == FormatJPG) && subsampling != Subsampling420 {
+		return false
+	}
+	return isJPEG(data) || isWebP(data)
+}
+
+// thumbnailOptions switches bimg options to the thumbnail fast path
+func thumbnailOptions(opts bimg.Options) bimg.Options {
+	opts.Interpolator = thumbnailInterpolator
+	return opts
+}
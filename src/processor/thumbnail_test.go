@@ -0,0 +1,107 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"testing"
+)
+
+// thumbnailOpts are the options of a 128px wide PNG thumbnail
+var thumbnailOpts = ProcessOptions{Width: 128, Format: FormatPNG, Quality: DefaultQuality}
+
+func TestFastThumbnail_Eligibility(t *testing.T) {
+	jpeg := loadTestImage(t, "large.jpg")
+	png := loadTestImage(t, "sample.png")
+
+	tests := []struct {
+		name string
+		data []byte
+		opts ProcessOptions
+		want bool
+	}{
+		{"JPEG thumbnail", jpeg, thumbnailOpts, true},
+		{"Height only", jpeg, ProcessOptions{Height: MaxThumbnailSize, Format: FormatWebP}, true},
+		{"Larger than a thumbnail", jpeg, ProcessOptions{Width: MaxThumbnailSize + 1, Format: FormatWebP}, false},
+		{"No dimensions", jpeg, ProcessOptions{Format: FormatWebP}, false},
+		{"Padded", jpeg, ProcessOptions{Width: 128, Height: 128, Pad: true, Format: FormatWebP}, false},
+		{"Trimmed", jpeg, ProcessOptions{Width: 128, Trim: true, Format: FormatWebP}, false},
+		{"JPEG 4:4:4", jpeg, ProcessOptions{Width: 128, Format: FormatJPEG, ChromaSubsampling: Subsampling444}, false},
+		{"PNG source", png, thumbnailOpts, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subsampling, err := ParseChromaSubsampling(string(tt.opts.ChromaSubsampling))
+			if err != nil {
+				t.Fatalf("ParseChromaSubsampling failed: %v", err)
+			}
+			if got := fastThumbnail(tt.data, tt.opts, subsampling); got != tt.want {
+				t.Errorf("fastThumbnail() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestProcess_Thumbnail_MatchesGeneric tests that the fast path renders a
+// thumbnail visually equivalent to the generic pipeline's
+func TestProcess_Thumbnail_MatchesGeneric(t *testing.T) {
+	data := loadTestImage(t, "large.jpg")
+
+	fast, err := New().Process(data, thumbnailOpts)
+	if err != nil {
+		t.Fatalf("Process (fast path) failed: %v", err)
+	}
+	generic, err := (&bimgProcessor{noFastThumbnails: true}).Process(data, thumbnailOpts)
+	if err != nil {
+		t.Fatalf("Process (generic) failed: %v", err)
+	}
+
+	fastImg, _, err := image.Decode(bytes.NewReader(fast))
+	if err != nil {
+		t.Fatalf("Failed to decode fast path thumbnail: %v", err)
+	}
+	genericImg, _, err := image.Decode(bytes.NewReader(generic))
+	if err != nil {
+		t.Fatalf("Failed to decode generic thumbnail: %v", err)
+	}
+	if fastImg.Bounds() != genericImg.Bounds() {
+		t.Fatalf("Fast path size %v, generic %v", fastImg.Bounds(), genericImg.Bounds())
+	}
+	if fastImg.Bounds().Dx() != thumbnailOpts.Width {
+		t.Errorf("Expected width %d, got %d", thumbnailOpts.Width, fastImg.Bounds().Dx())
+	}
+
+	score, err := CompareImages(genericImg, fastImg, "ssim")
+	if err != nil {
+		t.Fatalf("CompareImages failed: %v", err)
+	}
+	if score < 0.95 {
+		t.Errorf("Fast path thumbnail differs from generic: SSIM %.4f, want at least 0.95", score)
+	}
+}
+
+// benchmarkThumbnail benchmarks thumbnailing the large source to 128px
+func benchmarkThumbnail(b *testing.B, p ImageProcessor) {
+	data, err := os.ReadFile("testdata/large.jpg")
+	if err != nil {
+		b.Fatalf("Failed to load test image: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := p.Process(data, thumbnailOpts); err != nil {
+			b.Fatalf("Process failed: %v", err)
+		}
+	}
+}
+
+// BenchmarkProcess_Thumbnail_FastPath benchmarks the thumbnail fast path
+func BenchmarkProcess_Thumbnail_FastPath(b *testing.B) {
+	benchmarkThumbnail(b, New())
+}
+
+// BenchmarkProcess_Thumbnail_Generic benchmarks the same thumbnail through
+// the generic pipeline
+func BenchmarkProcess_Thumbnail_Generic(b *testing.B) {
+	benchmarkThumbnail(b, &bimgProcessor{noFastThumbnails: true})
+}
@@ -0,0 +1,108 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Transform is a custom post-processing step such as a face blur or a brand
+// overlay. Transforms are registered at startup with WithTransforms and run
+// in order on every processed image. Apply must return the image in
+// opts.Format.
+type Transform interface {
+	// Name identifies the transform in errors
+	Name() string
+
+	// Apply transforms a processed image
+	Apply(ctx context.Context, img []byte, opts ProcessOptions) ([]byte, error)
+}
+
+// ErrTransformFailed is matched by every error returned by a Transform
+var ErrTransformFailed = errors.New("image transform failed")
+
+// TransformError reports which transform failed
+type TransformError struct {
+	Transform string
+	Err       error
+}
+
+// Error returns the failing transform and its error
+func (e *TransformError) Error() string {
+	return fmt.Sprintf("transform %s failed: %v", e.Transform, e.Err)
+}
+
+// Unwrap matches ErrTransformFailed and the transform's own error
+func (e *TransformError) Unwrap() []error {
+	return []error{ErrTransformFailed, e.Err}
+}
+
+// ContextProcessor is an ImageProcessor that passes a context to its transforms
+type ContextProcessor interface {
+	ImageProcessor
+
+	// ProcessContext is Process that stops between transforms once ctx ends
+	ProcessContext(ctx context.Context, data []byte, opts ProcessOptions) ([]byte, error)
+}
+
+// transformingProcessor runs transforms after another processor's Process
+type transformingProcessor struct {
+	ImageProcessor
+	transforms []Transform
+}
+
+// WithTransforms returns proc with transforms run in order after Process.
+// Without transforms proc is returned unchanged.
+func WithTransforms(proc ImageProcessor, transforms ...Transform) ImageProcessor {
+	if len(transforms) == 0 {
+		return proc
+	}
+	if chained, ok := proc.(*transformingProcessor); ok {
+		return &transformingProcessor{
+			ImageProcessor: chained.ImageProcessor,
+			transforms:     append(append([]Transform{}, chained.transforms...), transforms...),
+		}
+	}
+	return &transformingProcessor{
+		ImageProcessor: proc,
+		transforms:     append([]Transform{}, transforms...),
+	}
+}
+
+// Process runs the core pipeline and then every transform
+func (p *transformingProcessor) Process(data []byte, opts ProcessOptions) ([]byte, error) {
+	return p.ProcessContext(context.Background(), data, opts)
+}
+
+// ProcessContext runs the core pipeline and then every transform with ctx
+func (p *transformingProcessor) ProcessContext(ctx context.Context, data []byte, opts ProcessOptions) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	result, err := p.ImageProcessor.Process(data, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, transform := range p.transforms {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if result, err = transform.Apply(ctx, result, opts); err != nil {
+			return nil, &TransformError{Transform: transform.Name(), Err: err}
+		}
+	}
+	return result, nil
+}
+
+// ProcessContext processes data with proc, passing ctx to its transforms
+// when it is a ContextProcessor. Nothing is processed once ctx has ended.
+func ProcessContext(ctx context.Context, proc ImageProcessor, data []byte, opts ProcessOptions) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if cp, ok := proc.(ContextProcessor); ok {
+		return cp.ProcessContext(ctx, data, opts)
+	}
+	return proc.Process(data, opts)
+}
@@ -0,0 +1,165 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/jpeg"
+	"testing"
+)
+
+// noopTransform returns images unchanged and records that it ran
+type noopTransform struct {
+	ran *[]string
+}
+
+func (t noopTransform) Name() string { return "noop" }
+
+func (t noopTransform) Apply(ctx context.Context, img []byte, opts ProcessOptions) ([]byte, error) {
+	*t.ran = append(*t.ran, t.Name())
+	return img, nil
+}
+
+// cropTransform keeps the left half of an image
+type cropTransform struct {
+	ran *[]string
+}
+
+func (t cropTransform) Name() string { return "crop" }
+
+func (t cropTransform) Apply(ctx context.Context, img []byte, opts ProcessOptions) ([]byte, error) {
+	*t.ran = append(*t.ran, t.Name())
+	decoded, _, err := image.Decode(bytes.NewReader(img))
+	if err != nil {
+		return nil, err
+	}
+	bounds := decoded.Bounds()
+	half := decoded.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}).SubImage(image.Rect(bounds.Min.X, bounds.Min.Y, bounds.Min.X+bounds.Dx()/2, bounds.Max.Y))
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, half, &jpeg.Options{Quality: opts.Quality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// failingTransform always fails
+type failingTransform struct{}
+
+var errOverlayMissing = errors.New("overlay missing")
+
+func (failingTransform) Name() string { return "overlay" }
+
+func (failingTransform) Apply(ctx context.Context, img []byte, opts ProcessOptions) ([]byte, error) {
+	return nil, errOverlayMissing
+}
+
+// encodeTestJPEG encodes a gradient as JPEG
+func encodeTestJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, gradientImage(w, h), nil); err != nil {
+		t.Fatalf("jpeg.Encode() error = %v", err)
+	}
+	return buf.Bytes()
+}
+
+// Test transforms run in order after the core pipeline
+func TestWithTransforms_RunsInOrder(t *testing.T) {
+	var ran []string
+	proc := WithTransforms(&jpegProcessor{}, noopTransform{&ran}, cropTransform{&ran}, noopTransform{&ran})
+
+	result, err := proc.Process(encodeTestJPEG(t, 120, 80), ProcessOptions{Quality: 80})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	if got := len(ran); got != 3 || ran[0] != "noop" || ran[1] != "crop" || ran[2] != "noop" {
+		t.Errorf("Transforms ran as %v, want [noop crop noop]", ran)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(result))
+	if err != nil {
+		t.Fatalf("DecodeConfig() error = %v", err)
+	}
+	if cfg.Width != 60 || cfg.Height != 80 {
+		t.Errorf("Expected 60x80 after crop, got %dx%d", cfg.Width, cfg.Height)
+	}
+}
+
+// Test chaining WithTransforms appends to the existing chain
+func TestWithTransforms_Chained(t *testing.T) {
+	var ran []string
+	base := &jpegProcessor{}
+	proc := WithTransforms(WithTransforms(base, noopTransform{&ran}), cropTransform{&ran})
+
+	if _, err := proc.Process(encodeTestJPEG(t, 40, 40), ProcessOptions{Quality: 80}); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+
+	if len(ran) != 2 || ran[0] != "noop" || ran[1] != "crop" {
+		t.Errorf("Transforms ran as %v, want [noop crop]", ran)
+	}
+	if base.calls != 1 {
+		t.Errorf("Expected the core pipeline to run once, ran %d times", base.calls)
+	}
+}
+
+// Test without transforms the processor is returned unchanged
+func TestWithTransforms_None(t *testing.T) {
+	base := &jpegProcessor{}
+
+	if proc := WithTransforms(base); proc != base {
+		t.Error("Expected WithTransforms without transforms to return the processor")
+	}
+}
+
+// Test a failing transform reports its name and stops the chain
+func TestWithTransforms_Error(t *testing.T) {
+	var ran []string
+	proc := WithTransforms(&jpegProcessor{}, failingTransform{}, noopTransform{&ran})
+
+	_, err := proc.Process(encodeTestJPEG(t, 40, 40), ProcessOptions{Quality: 80})
+
+	if !errors.Is(err, ErrTransformFailed) || !errors.Is(err, errOverlayMissing) {
+		t.Fatalf("Expected a transform failure wrapping the cause, got %v", err)
+	}
+	var transformErr *TransformError
+	if !errors.As(err, &transformErr) || transformErr.Transform != "overlay" {
+		t.Errorf("Expected the overlay transform to be reported, got %v", err)
+	}
+	if len(ran) != 0 {
+		t.Errorf("Expected later transforms to be skipped, ran %v", ran)
+	}
+}
+
+// Test a cancelled context stops before the transforms
+func TestProcessContext_Cancelled(t *testing.T) {
+	var ran []string
+	proc := WithTransforms(&jpegProcessor{}, noopTransform{&ran})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := ProcessContext(ctx, proc, encodeTestJPEG(t, 40, 40), ProcessOptions{Quality: 80})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if len(ran) != 0 {
+		t.Errorf("Expected no transforms to run, ran %v", ran)
+	}
+}
+
+// Test ProcessContext falls back to Process for plain processors
+func TestProcessContext_PlainProcessor(t *testing.T) {
+	base := &jpegProcessor{}
+
+	if _, err := ProcessContext(context.Background(), base, encodeTestJPEG(t, 40, 40), ProcessOptions{Quality: 80}); err != nil {
+		t.Fatalf("ProcessContext() error = %v", err)
+	}
+	if base.calls != 1 {
+		t.Errorf("Expected Process to run once, ran %d times", base.calls)
+	}
+}
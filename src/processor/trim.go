@@ -0,0 +1,155 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+
+	"github.com/h2non/bimg"
+)
+
+// DefaultTrimThreshold is the per-channel difference from the border color
+// still trimmed, which absorbs scanner noise and JPEG artifacts
+const DefaultTrimThreshold = 10
+
+// ErrInvalidTrimThreshold is returned for a TrimThreshold outside 0-255
+var ErrInvalidTrimThreshold = errors.New("invalid trim threshold: must be between 0 and 255")
+
+// MaxTrimPixels bounds the pixels of a source decoded to find its border.
+// Larger sources are rendered untrimmed rather than decoded.
+const MaxTrimPixels = 64 << 20
+
+// TrimmablePixels reports whether a width x height source is within
+// MaxTrimPixels
+func TrimmablePixels(width, height int) bool {
+	return width > 0 && height > 0 && width <= MaxTrimPixels/height
+}
+
+// TrimRect returns the region of img inside its uniform border. The border
+// color is the top-left pixel's, and rows and columns whose pixels all lie
+// within threshold of it on every channel are trimmed. It reports false
+// when there is no border or the whole image is uniform.
+func TrimRect(img image.Image, threshold int) (CropRect, bool) {
+	bounds := img.Bounds()
+	at := pixelReader(img)
+	border := at(bounds.Min.X, bounds.Min.Y)
+	near := func(a, b uint8) bool {
+		d := int(a) - int(b)
+		return d <= threshold && -d <= threshold
+	}
+	isBorder := func(x, y int) bool {
+		c := at(x, y)
+		return near(c.R, border.R) && near(c.G, border.G) && near(c.B, border.B) && near(c.A, border.A)
+	}
+	rowIsBorder := func(y, x0, x1 int) bool {
+		for x := x0; x < x1; x++ {
+			if !isBorder(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+	colIsBorder := func(x, y0, y1 int) bool {
+		for y := y0; y < y1; y++ {
+			if !isBorder(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+
+	top, bottom := bounds.Min.Y, bounds.Max.Y
+	for top < bottom && rowIsBorder(top, bounds.Min.X, bounds.Max.X) {
+		top++
+	}
+	if top == bottom {
+		return CropRect{}, false
+	}
+	for rowIsBorder(bottom-1, bounds.Min.X, bounds.Max.X) {
+		bottom--
+	}
+	left, right := bounds.Min.X, bounds.Max.X
+	for colIsBorder(left, top, bottom) {
+		left++
+	}
+	for colIsBorder(right-1, top, bottom) {
+		right--
+	}
+
+	rect := CropRect{X: left - bounds.Min.X, Y: top - bounds.Min.Y, Width: right - left, Height: bottom - top}
+	if rect.Width == bounds.Dx() && rect.Height == bounds.Dy() {
+		return CropRect{}, false
+	}
+	return rect, true
+}
+
+// pixelReader returns a function reading the pixels of img as NRGBA. The
+// types the standard decoders produce are read from their pixel buffers
+// rather than through At, which allocates for every pixel.
+func pixelReader(img image.Image) func(x, y int) color.NRGBA {
+	switch img := img.(type) {
+	case *image.NRGBA:
+		return func(x, y int) color.NRGBA {
+			p := img.Pix[img.PixOffset(x, y):]
+			return color.NRGBA{R: p[0], G: p[1], B: p[2], A: p[3]}
+		}
+	case *image.YCbCr:
+		return func(x, y int) color.NRGBA {
+			r, g, b, _ := img.YCbCrAt(x, y).RGBA()
+			return color.NRGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(b >> 8), A: 255}
+		}
+	case *image.Gray:
+		return func(x, y int) color.NRGBA {
+			v := img.Pix[img.PixOffset(x, y)]
+			return color.NRGBA{R: v, G: v, B: v, A: 255}
+		}
+	case *image.Paletted:
+		palette := make([]color.NRGBA, len(img.Palette))
+		for i, c := range img.Palette {
+			palette[i] = color.NRGBAModel.Convert(c).(color.NRGBA)
+		}
+		return func(x, y int) color.NRGBA {
+			if i := int(img.Pix[img.PixOffset(x, y)]); i < len(palette) {
+				return palette[i]
+			}
+			return color.NRGBA{}
+		}
+	}
+	return func(x, y int) color.NRGBA {
+		return color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+	}
+}
+
+// trimBorders removes the uniform border of data and returns the rest as a
+// lossless PNG for the resize that follows, or data itself when there is no
+// border or the source is over MaxTrimPixels. Sources Go cannot decode,
+// e.g. HEIF, are decoded by libvips.
+func trimBorders(data []byte, threshold int) ([]byte, error) {
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		if !TrimmablePixels(cfg.Width, cfg.Height) {
+			return data, nil
+		}
+	} else if size, err := bimg.NewImage(data).Size(); err != nil {
+		return nil, ErrInvalidImage
+	} else if !TrimmablePixels(size.Width, size.Height) {
+		return data, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		converted, err := bimg.NewImage(data).Process(deterministicOptions(bimg.Options{Type: bimg.PNG}))
+		if err != nil {
+			return nil, ErrInvalidImage
+		}
+		if img, _, err = image.Decode(bytes.NewReader(converted)); err != nil {
+			return nil, ErrInvalidImage
+		}
+	}
+
+	rect, ok := TrimRect(img, threshold)
+	if !ok {
+		return data, nil
+	}
+	return extractArea(data, rect, false)
+}
@@ -0,0 +1,154 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// borderedPNG encodes a 120x80 PNG with a solid white border around a
+// 60x40 red and blue block at x=20, y=30
+func borderedPNG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 120, 80))
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 120; x++ {
+			c := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+			if x >= 20 && x < 80 && y >= 30 && y < 70 {
+				c = color.NRGBA{R: 255, A: 255}
+				if x >= 50 {
+					c = color.NRGBA{B: 255, A: 255}
+				}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// Test TrimRect finds the content inside a uniform border
+func TestTrimRect(t *testing.T) {
+	bordered, err := png.Decode(bytes.NewReader(borderedPNG(t)))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	// Off-white noise in the border stays within the threshold
+	noisy := image.NewNRGBA(image.Rect(0, 0, 40, 40))
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 40; x++ {
+			v := 250 + byte((x+y)%5)
+			noisy.SetNRGBA(x, y, color.NRGBA{R: v, G: v, B: v, A: 255})
+		}
+	}
+	for y := 10; y < 20; y++ {
+		for x := 5; x < 35; x++ {
+			noisy.SetNRGBA(x, y, color.NRGBA{A: 255})
+		}
+	}
+
+	// The same black block on white in the decoders' other pixel types
+	ycbcr := image.NewYCbCr(image.Rect(0, 0, 40, 40), image.YCbCrSubsampleRatio444)
+	gray := image.NewGray(image.Rect(0, 0, 40, 40))
+	paletted := image.NewPaletted(image.Rect(0, 0, 40, 40), color.Palette{color.Black, color.White})
+	for y := 0; y < 40; y++ {
+		for x := 0; x < 40; x++ {
+			block := x >= 5 && x < 35 && y >= 10 && y < 20
+			v := byte(255)
+			if block {
+				v = 0
+			}
+			ycbcr.Y[ycbcr.YOffset(x, y)] = v
+			ycbcr.Cb[ycbcr.COffset(x, y)] = 128
+			ycbcr.Cr[ycbcr.COffset(x, y)] = 128
+			gray.Pix[gray.PixOffset(x, y)] = v
+			paletted.Pix[paletted.PixOffset(x, y)] = v / 255
+		}
+	}
+
+	uniform := image.NewNRGBA(image.Rect(0, 0, 20, 20))
+	offset := bordered.(interface {
+		SubImage(image.Rectangle) image.Image
+	}).SubImage(image.Rect(10, 10, 120, 80))
+
+	tests := []struct {
+		name      string
+		img       image.Image
+		threshold int
+		expected  CropRect
+		ok        bool
+	}{
+		{"Solid border", bordered, DefaultTrimThreshold, CropRect{20, 30, 60, 40}, true},
+		{"Noisy border", noisy, DefaultTrimThreshold, CropRect{5, 10, 30, 10}, true},
+		{"Noise above threshold", noisy, 0, CropRect{}, false},
+		{"Offset bounds", offset, 0, CropRect{10, 20, 60, 40}, true},
+		{"Uniform image", uniform, DefaultTrimThreshold, CropRect{}, false},
+		{"YCbCr", ycbcr, 0, CropRect{5, 10, 30, 10}, true},
+		{"Gray", gray, 0, CropRect{5, 10, 30, 10}, true},
+		{"Paletted", paletted, 0, CropRect{5, 10, 30, 10}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := TrimRect(tt.img, tt.threshold)
+			if ok != tt.ok || got != tt.expected {
+				t.Errorf("TrimRect = %+v, %v, expected %+v, %v", got, ok, tt.expected, tt.ok)
+			}
+		})
+	}
+}
+
+// Test a source over MaxTrimPixels is left whole without being decoded
+func TestTrimBorders_PixelBudget(t *testing.T) {
+	// A PNG header claiming 10000x10000 pixels, with no pixel data after it
+	data := borderedPNG(t)[:33]
+	binary.BigEndian.PutUint32(data[16:], 10000)
+	binary.BigEndian.PutUint32(data[20:], 10000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+
+	result, err := trimBorders(data, DefaultTrimThreshold)
+	if err != nil {
+		t.Fatalf("trimBorders failed: %v", err)
+	}
+	if !bytes.Equal(result, data) {
+		t.Error("Expected the source unchanged")
+	}
+	if TrimmablePixels(10000, 10000) || !TrimmablePixels(8192, 8192) {
+		t.Errorf("TrimmablePixels disagrees with MaxTrimPixels %d", MaxTrimPixels)
+	}
+}
+
+// Test a trimmed image loses its border before it is resized
+func TestImageProcessor_Process_Trim(t *testing.T) {
+	processor := New()
+	data := borderedPNG(t)
+
+	result, err := processor.Process(data, ProcessOptions{Width: 60, Format: FormatPNG, Quality: 90, Trim: true, TrimThreshold: DefaultTrimThreshold})
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(result))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(60, 40) {
+		t.Fatalf("Expected the 60x40 content, got %v", size)
+	}
+	for _, p := range []image.Point{{0, 0}, {59, 39}, {0, 39}, {59, 0}} {
+		if c := color.NRGBAModel.Convert(img.At(p.X, p.Y)).(color.NRGBA); c == (color.NRGBA{R: 255, G: 255, B: 255, A: 255}) {
+			t.Errorf("Border pixel left at %v", p)
+		}
+	}
+
+	if _, err := processor.Process(data, ProcessOptions{Width: 60, Format: FormatPNG, Quality: 90, Trim: true, TrimThreshold: 256}); err != ErrInvalidTrimThreshold {
+		t.Errorf("Expected ErrInvalidTrimThreshold, got %v", err)
+	}
+}
@@ -34,10 +34,66 @@ var (
 
 // ProcessOptions contains options for image processing
 type ProcessOptions struct {
-	Width   int
-	Height  int
-	Format  ImageFormat
-	Quality int
+	Width             int
+	Height            int
+	Format            ImageFormat
+	Quality           int
+	ChromaSubsampling ChromaSubsampling // JPEG only, empty = 4:2:0
+
+	// Poster renders Frame of an animated GIF or WebP as a static image.
+	// Frames past the last one select the last frame.
+	Poster bool
+	Frame  int
+
+	// Animate keeps every frame when an animated GIF is converted to WebP.
+	// Otherwise only the first frame is rendered.
+	Animate bool
+
+	// DPI records the output resolution for print without changing the
+	// pixel dimensions (0 = leave as encoded). Only JPEG and PNG carry it.
+	DPI int
+
+	// Pad fits the image inside Width x Height and fills the remaining
+	// area with Background (RRGGBB hex, empty = white), so the output is
+	// exactly the requested size. It needs both dimensions.
+	Pad        bool
+	Background string
+
+	// Cover fills Width x Height, scaling the image up or down until it
+	// covers the box and cropping the overflow around the center, so the
+	// output is exactly the requested size. It needs both dimensions and is
+	// ignored with Pad.
+	Cover bool
+
+	// Crop extracts a region of the source before resizing (empty = whole
+	// image). A region reaching outside the image fails with
+	// ErrCropOutOfBounds unless ClampCrop limits it to the image.
+	Crop      CropRect
+	ClampCrop bool
+
+	// Trim removes a uniform border, e.g. the whitespace around a scan or
+	// logo, after any Crop and before resizing. TrimThreshold is the largest
+	// per-channel difference from the border color still trimmed (0-255).
+	Trim          bool
+	TrimThreshold int
+
+	// ColorSpace converts the output to sRGB or keeps the source's space
+	// (empty = sRGB). EmbedICC writes the sRGB ICC profile into converted
+	// output.
+	ColorSpace ColorSpace
+	EmbedICC   bool
+
+	// Progressive encodes JPEG output as progressive and PNG output as
+	// interlaced, so browsers can show a coarse image while it loads.
+	// JPEG with finer chroma than 4:2:0 is encoded in Go and stays baseline.
+	Progressive bool
+
+	// Filter recolors the resized image before it is encoded (empty = none)
+	Filter Filter
+
+	// Caption is drawn onto the resized image after any Filter (empty Text
+	// = none)
+	Caption Caption
 }
 
 // ImageMetadata contains basic image information
@@ -45,6 +101,13 @@ type ImageMetadata struct {
 	Width  int
 	Height int
 	Type   string
+	Frames int // Number of frames, 1 for still images
+	DPI    int // Recorded resolution in dots per inch, 0 if none
+}
+
+// Animated reports whether the image has more than one frame
+func (m *ImageMetadata) Animated() bool {
+	return m.Frames > 1
 }
 
 // ImageProcessor defines the interface for image processing operations
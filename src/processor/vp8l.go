@@ -0,0 +1,706 @@
+package processor
+
+import (
+	"image"
+	"sort"
+)
+
+// VP8L (lossless WebP) bitstream constants
+const (
+	vp8lSignature = 0x2f
+
+	vp8lPredictorTransform = 0
+	vp8lSubtractGreen      = 2
+	vp8lColorIndexing      = 3
+
+	vp8lPredictorBits   = 4 // Predictor blocks are 16x16 pixels
+	vp8lLengthCodes     = 24
+	vp8lDistanceCodes   = 40
+	vp8lPlaneCodes      = 120
+	vp8lMaxCodeLength   = 15
+	vp8lMaxLengthLength = 7 // Limit of the code length code
+	vp8lMinMatch        = 3
+	vp8lMaxMatch        = 4096
+	vp8lWindow          = 1<<20 - vp8lPlaneCodes
+	vp8lMaxChain        = 32
+)
+
+// vp8lCodeLengthOrder is the order in which code length code lengths are stored
+var vp8lCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// vp8lPlaneOffsets maps the first 120 distance codes to (x, y) neighbours
+var vp8lPlaneOffsets = [vp8lPlaneCodes][2]int{
+	{0, 1}, {1, 0}, {1, 1}, {-1, 1}, {0, 2}, {2, 0}, {1, 2}, {-1, 2},
+	{2, 1}, {-2, 1}, {2, 2}, {-2, 2}, {0, 3}, {3, 0}, {1, 3}, {-1, 3},
+	{3, 1}, {-3, 1}, {2, 3}, {-2, 3}, {3, 2}, {-3, 2}, {0, 4}, {4, 0},
+	{1, 4}, {-1, 4}, {4, 1}, {-4, 1}, {3, 3}, {-3, 3}, {2, 4}, {-2, 4},
+	{4, 2}, {-4, 2}, {0, 5}, {3, 4}, {-3, 4}, {4, 3}, {-4, 3}, {5, 0},
+	{1, 5}, {-1, 5}, {5, 1}, {-5, 1}, {2, 5}, {-2, 5}, {5, 2}, {-5, 2},
+	{4, 4}, {-4, 4}, {3, 5}, {-3, 5}, {5, 3}, {-5, 3}, {0, 6}, {6, 0},
+	{1, 6}, {-1, 6}, {6, 1}, {-6, 1}, {2, 6}, {-2, 6}, {6, 2}, {-6, 2},
+	{4, 5}, {-4, 5}, {5, 4}, {-5, 4}, {3, 6}, {-3, 6}, {6, 3}, {-6, 3},
+	{0, 7}, {7, 0}, {1, 7}, {-1, 7}, {5, 5}, {-5, 5}, {7, 1}, {-7, 1},
+	{4, 6}, {-4, 6}, {6, 4}, {-6, 4}, {2, 7}, {-2, 7}, {7, 2}, {-7, 2},
+	{3, 7}, {-3, 7}, {7, 3}, {-7, 3}, {5, 6}, {-5, 6}, {6, 5}, {-6, 5},
+	{8, 0}, {4, 7}, {-4, 7}, {7, 4}, {-7, 4}, {8, 1}, {8, 2}, {6, 6},
+	{-6, 6}, {8, 3}, {5, 7}, {-5, 7}, {7, 5}, {-7, 5}, {8, 4}, {6, 7},
+	{-6, 7}, {7, 6}, {-7, 6}, {8, 5}, {7, 7}, {-7, 7}, {8, 6}, {8, 7},
+}
+
+// EncodeVP8L encodes img as a lossless VP8L bitstream, the payload of a
+// "VP8L" chunk. Images with at most 256 colors are palette coded, others
+// use the subtract-green and predictor transforms.
+func EncodeVP8L(img *image.NRGBA) []byte {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	pixels := make([]uint32, 0, width*height)
+	alpha := false
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(img.Rect.Min.X, y):]
+		for x := 0; x < width; x++ {
+			p := row[x*4 : x*4+4]
+			pixels = append(pixels, uint32(p[3])<<24|uint32(p[0])<<16|uint32(p[1])<<8|uint32(p[2]))
+			alpha = alpha || p[3] != 0xff
+		}
+	}
+
+	w := &bitWriter{}
+	w.writeBits(vp8lSignature, 8)
+	w.writeBits(uint32(width-1), 14)
+	w.writeBits(uint32(height-1), 14)
+	w.writeBits(boolBit(alpha), 1)
+	w.writeBits(0, 3) // Version
+
+	if palette := vp8lPalette(pixels); palette != nil {
+		pixels, width = vp8lIndexPixels(w, pixels, width, height, palette)
+	} else {
+		vp8lSubtractGreenPixels(w, pixels)
+		vp8lPredictPixels(w, pixels, width, height)
+	}
+	w.writeBits(0, 1) // No more transforms
+
+	vp8lWriteImage(w, pixels, width, true)
+	return w.bytes()
+}
+
+// bitWriter packs values least significant bit first
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+// writeBits appends the low n bits of v, n <= 32
+func (w *bitWriter) writeBits(v uint32, n uint) {
+	w.acc |= uint64(v) << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nbits -= 8
+	}
+}
+
+// bytes flushes the partial byte and returns the stream
+func (w *bitWriter) bytes() []byte {
+	if w.nbits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.nbits = 0, 0
+	}
+	return w.buf
+}
+
+// boolBit converts b to a single bit
+func boolBit(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// vp8lPalette returns the sorted colors of pixels, or nil for more than 256
+func vp8lPalette(pixels []uint32) []uint32 {
+	seen := make(map[uint32]bool)
+	for _, p := range pixels {
+		if !seen[p] {
+			if len(seen) == 256 {
+				return nil
+			}
+			seen[p] = true
+		}
+	}
+	palette := make([]uint32, 0, len(seen))
+	for p := range seen {
+		palette = append(palette, p)
+	}
+	sort.Slice(palette, func(i, j int) bool { return palette[i] < palette[j] })
+	return palette
+}
+
+// vp8lIndexPixels writes the color indexing transform and returns the
+// index image, bundling several indices per pixel for small palettes
+func vp8lIndexPixels(w *bitWriter, pixels []uint32, width, height int, palette []uint32) ([]uint32, int) {
+	w.writeBits(1, 1)
+	w.writeBits(vp8lColorIndexing, 2)
+	w.writeBits(uint32(len(palette)-1), 8)
+
+	// The palette is stored as a one row image of deltas
+	deltas := make([]uint32, len(palette))
+	for i, p := range palette {
+		deltas[i] = p
+		if i > 0 {
+			deltas[i] = subPixels(p, palette[i-1])
+		}
+	}
+	vp8lWriteImage(w, deltas, len(deltas), false)
+
+	index := make(map[uint32]uint32, len(palette))
+	for i, p := range palette {
+		index[p] = uint32(i)
+	}
+
+	var bits uint
+	switch {
+	case len(palette) <= 2:
+		bits = 3
+	case len(palette) <= 4:
+		bits = 2
+	case len(palette) <= 16:
+		bits = 1
+	}
+	packedWidth := (width + 1<<bits - 1) >> bits
+	bitsPerIndex := 8 >> bits
+	packed := make([]uint32, packedWidth*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*packedWidth + x>>bits
+			shift := uint(bitsPerIndex * (x & (1<<bits - 1)))
+			packed[i] |= index[pixels[y*width+x]] << (8 + shift)
+		}
+	}
+	for i := range packed {
+		packed[i] |= 0xff000000
+	}
+	return packed, packedWidth
+}
+
+// vp8lSubtractGreenPixels writes the subtract-green transform and applies it
+func vp8lSubtractGreenPixels(w *bitWriter, pixels []uint32) {
+	w.writeBits(1, 1)
+	w.writeBits(vp8lSubtractGreen, 2)
+	for i, p := range pixels {
+		g := p >> 8 & 0xff
+		r := (p>>16 - g) & 0xff
+		b := (p - g) & 0xff
+		pixels[i] = p&0xff00ff00 | r<<16 | b
+	}
+}
+
+// vp8lPredictPixels writes the predictor transform and replaces pixels with
+// their residuals. Each block uses the mode with the smallest residuals.
+func vp8lPredictPixels(w *bitWriter, pixels []uint32, width, height int) {
+	blockSize := 1 << vp8lPredictorBits
+	blocksX := (width + blockSize - 1) / blockSize
+	blocksY := (height + blockSize - 1) / blockSize
+	modes := make([]uint32, blocksX*blocksY)
+
+	for by := 0; by < blocksY; by++ {
+		for bx := 0; bx < blocksX; bx++ {
+			best, bestCost := 0, -1
+			for mode := 0; mode < 14; mode++ {
+				cost := 0
+				for y := by * blockSize; y < min((by+1)*blockSize, height); y++ {
+					for x := bx * blockSize; x < min((bx+1)*blockSize, width); x++ {
+						cost += residualCost(subPixels(pixels[y*width+x], vp8lPredict(pixels, width, x, y, mode)))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+			modes[by*blocksX+bx] = 0xff000000 | uint32(best)<<8
+		}
+	}
+
+	w.writeBits(1, 1)
+	w.writeBits(vp8lPredictorTransform, 2)
+	w.writeBits(vp8lPredictorBits-2, 3)
+	vp8lWriteImage(w, modes, blocksX, false)
+
+	// Predictions use the original neighbours, so residuals are computed
+	// bottom-up before any pixel they depend on is overwritten
+	for y := height - 1; y >= 0; y-- {
+		for x := width - 1; x >= 0; x-- {
+			mode := int(modes[(y>>vp8lPredictorBits)*blocksX+x>>vp8lPredictorBits] >> 8 & 0xff)
+			pixels[y*width+x] = subPixels(pixels[y*width+x], vp8lPredict(pixels, width, x, y, mode))
+		}
+	}
+}
+
+// vp8lPredict returns the prediction of pixel (x, y) for mode. The first
+// row and column have fixed predictors.
+func vp8lPredict(pixels []uint32, width, x, y, mode int) uint32 {
+	pos := y*width + x
+	switch {
+	case x == 0 && y == 0:
+		return 0xff000000
+	case y == 0:
+		return pixels[pos-1]
+	case x == 0:
+		return pixels[pos-width]
+	}
+
+	// The top-right neighbour of the last column wraps to the current row
+	l, t, tl, tr := pixels[pos-1], pixels[pos-width], pixels[pos-width-1], pixels[pos-width+1]
+	switch mode {
+	case 0:
+		return 0xff000000
+	case 1:
+		return l
+	case 2:
+		return t
+	case 3:
+		return tr
+	case 4:
+		return tl
+	case 5:
+		return average2(average2(l, tr), t)
+	case 6:
+		return average2(l, tl)
+	case 7:
+		return average2(l, t)
+	case 8:
+		return average2(tl, t)
+	case 9:
+		return average2(t, tr)
+	case 10:
+		return average2(average2(l, tl), average2(t, tr))
+	case 11:
+		return selectPredictor(l, t, tl)
+	case 12:
+		return clampAddSubtractFull(l, t, tl)
+	default:
+		return clampAddSubtractHalf(average2(l, t), tl)
+	}
+}
+
+// channel returns the 8-bit channel of p at shift
+func channel(p uint32, shift uint) int {
+	return int(p >> shift & 0xff)
+}
+
+// average2 averages two pixels per channel, rounding down
+func average2(a, b uint32) uint32 {
+	return ((a^b)&0xfefefefe)>>1 + a&b
+}
+
+// selectPredictor picks whichever of l and t is closer to the gradient estimate
+func selectPredictor(l, t, tl uint32) uint32 {
+	distL, distT := 0, 0
+	for shift := uint(0); shift < 32; shift += 8 {
+		estimate := channel(l, shift) + channel(t, shift) - channel(tl, shift)
+		distL += magnitude(estimate - channel(l, shift))
+		distT += magnitude(estimate - channel(t, shift))
+	}
+	if distL < distT {
+		return l
+	}
+	return t
+}
+
+// clampAddSubtractFull predicts a + b - c per channel
+func clampAddSubtractFull(a, b, c uint32) uint32 {
+	var p uint32
+	for shift := uint(0); shift < 32; shift += 8 {
+		p |= clampByte(channel(a, shift)+channel(b, shift)-channel(c, shift)) << shift
+	}
+	return p
+}
+
+// clampAddSubtractHalf predicts a + (a - b) / 2 per channel
+func clampAddSubtractHalf(a, b uint32) uint32 {
+	var p uint32
+	for shift := uint(0); shift < 32; shift += 8 {
+		p |= clampByte(channel(a, shift)+(channel(a, shift)-channel(b, shift))/2) << shift
+	}
+	return p
+}
+
+// clampByte clamps v to [0, 255]
+func clampByte(v int) uint32 {
+	return uint32(max(0, min(255, v)))
+}
+
+// magnitude returns the absolute value of v
+func magnitude(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// subPixels subtracts b from a per channel, modulo 256
+func subPixels(a, b uint32) uint32 {
+	ag := (a | 0x00ff00ff) - (b & 0xff00ff00)
+	rb := (a | 0xff00ff00) - (b & 0x00ff00ff)
+	return ag&0xff00ff00 | rb&0x00ff00ff
+}
+
+// residualCost estimates the cost of a residual as its signed magnitude
+func residualCost(r uint32) int {
+	cost := 0
+	for shift := uint(0); shift < 32; shift += 8 {
+		cost += magnitude(int(int8(r >> shift)))
+	}
+	return cost
+}
+
+// vp8lSymbol is a literal pixel or a backward reference
+type vp8lSymbol struct {
+	pixel    uint32
+	length   int // 0 for a literal
+	distance int // Distance code, 1-based
+}
+
+// vp8lWriteImage entropy codes pixels. Only the main image has the meta
+// prefix bit; all images use a single prefix code group.
+func vp8lWriteImage(w *bitWriter, pixels []uint32, width int, main bool) {
+	w.writeBits(0, 1) // No color cache
+	if main {
+		w.writeBits(0, 1) // No meta prefix codes
+	}
+
+	symbols := vp8lBackwardReferences(pixels, width)
+
+	green := make([]uint32, 256+vp8lLengthCodes)
+	red := make([]uint32, 256)
+	blue := make([]uint32, 256)
+	alpha := make([]uint32, 256)
+	distance := make([]uint32, vp8lDistanceCodes)
+	for _, s := range symbols {
+		if s.length == 0 {
+			green[s.pixel>>8&0xff]++
+			red[s.pixel>>16&0xff]++
+			blue[s.pixel&0xff]++
+			alpha[s.pixel>>24]++
+			continue
+		}
+		code, _, _ := prefixEncode(s.length)
+		green[256+code]++
+		code, _, _ = prefixEncode(s.distance)
+		distance[code]++
+	}
+
+	codes := [5]*prefixCode{}
+	for i, histogram := range [][]uint32{green, red, blue, alpha, distance} {
+		codes[i] = writePrefixCode(w, histogram)
+	}
+
+	for _, s := range symbols {
+		if s.length == 0 {
+			codes[0].write(w, int(s.pixel>>8&0xff))
+			codes[1].write(w, int(s.pixel>>16&0xff))
+			codes[2].write(w, int(s.pixel&0xff))
+			codes[3].write(w, int(s.pixel>>24))
+			continue
+		}
+		code, extraBits, extra := prefixEncode(s.length)
+		codes[0].write(w, 256+code)
+		w.writeBits(extra, extraBits)
+		code, extraBits, extra = prefixEncode(s.distance)
+		codes[4].write(w, code)
+		w.writeBits(extra, extraBits)
+	}
+}
+
+// vp8lBackwardReferences finds LZ77 matches greedily using hash chains
+// over pixel pairs. The pixel above and the previous pixel are always tried
+// since they have the shortest distance codes.
+func vp8lBackwardReferences(pixels []uint32, width int) []vp8lSymbol {
+	const hashBits = 16
+	head := make([]int32, 1<<hashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	chain := make([]int32, len(pixels))
+	hash := func(i int) uint32 {
+		return (pixels[i]*0x9e3779b1 ^ pixels[i+1]*0x85ebca6b) >> (32 - hashBits)
+	}
+	insert := func(i int) {
+		if i+1 < len(pixels) {
+			h := hash(i)
+			chain[i] = head[h]
+			head[h] = int32(i)
+		}
+	}
+
+	planeCodes := make(map[int]int, vp8lPlaneCodes)
+	for i := len(vp8lPlaneOffsets) - 1; i >= 0; i-- {
+		if d := vp8lPlaneOffsets[i][0] + vp8lPlaneOffsets[i][1]*width; d >= 1 {
+			planeCodes[d] = i + 1
+		}
+	}
+
+	matchLength := func(i, candidate int) int {
+		n := 0
+		for i+n < len(pixels) && n < vp8lMaxMatch && pixels[candidate+n] == pixels[i+n] {
+			n++
+		}
+		return n
+	}
+
+	var symbols []vp8lSymbol
+	for i := 0; i < len(pixels); {
+		bestLength, bestDistance := 0, 0
+		try := func(candidate int) {
+			if candidate < 0 || i-candidate > vp8lWindow {
+				return
+			}
+			if n := matchLength(i, candidate); n > bestLength {
+				bestLength, bestDistance = n, i-candidate
+			}
+		}
+		try(i - 1)
+		try(i - width)
+		if i+1 < len(pixels) {
+			for candidate, steps := int(head[hash(i)]), 0; candidate >= 0 && steps < vp8lMaxChain; candidate, steps = int(chain[candidate]), steps+1 {
+				try(candidate)
+			}
+		}
+
+		if bestLength < vp8lMinMatch {
+			symbols = append(symbols, vp8lSymbol{pixel: pixels[i]})
+			insert(i)
+			i++
+			continue
+		}
+
+		code, ok := planeCodes[bestDistance]
+		if !ok {
+			code = bestDistance + vp8lPlaneCodes
+		}
+		symbols = append(symbols, vp8lSymbol{length: bestLength, distance: code})
+		for end := i + bestLength; i < end; i++ {
+			insert(i)
+		}
+	}
+	return symbols
+}
+
+// prefixEncode splits a length or distance value (>= 1) into its prefix
+// code and extra bits
+func prefixEncode(value int) (code int, extraBits uint, extra uint32) {
+	v := value - 1
+	if v < 4 {
+		return v, 0, 0
+	}
+	high := 0
+	for v>>(high+1) != 0 {
+		high++
+	}
+	second := v >> (high - 1) & 1
+	extraBits = uint(high - 1)
+	return 2*high + second, extraBits, uint32(v & (1<<extraBits - 1))
+}
+
+// prefixCode is a canonical prefix code with reversed code words
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint16
+}
+
+// write emits symbol s
+func (c *prefixCode) write(w *bitWriter, s int) {
+	w.writeBits(uint32(c.codes[s]), uint(c.lengths[s]))
+}
+
+// writePrefixCode chooses a code for histogram and writes its description.
+// Up to two symbols below 256 use the simple form; a single symbol then
+// takes no bits at all.
+func writePrefixCode(w *bitWriter, histogram []uint32) *prefixCode {
+	var used []int
+	for s, n := range histogram {
+		if n > 0 {
+			used = append(used, s)
+		}
+	}
+
+	if len(used) <= 2 && (len(used) == 0 || used[len(used)-1] < 256) {
+		if len(used) == 0 {
+			used = []int{0}
+		}
+		w.writeBits(1, 1) // Simple code
+		w.writeBits(uint32(len(used)-1), 1)
+		if used[0] < 2 {
+			w.writeBits(0, 1)
+			w.writeBits(uint32(used[0]), 1)
+		} else {
+			w.writeBits(1, 1)
+			w.writeBits(uint32(used[0]), 8)
+		}
+		lengths := make([]uint8, len(histogram))
+		if len(used) == 2 {
+			w.writeBits(uint32(used[1]), 8)
+			lengths[used[0]], lengths[used[1]] = 1, 1
+		}
+		return &prefixCode{lengths: lengths, codes: canonicalCodes(lengths)}
+	}
+
+	lengths := huffmanLengths(histogram, vp8lMaxCodeLength)
+	w.writeBits(0, 1) // Normal code
+
+	// Code lengths are run-length coded with symbols 16 (repeat previous),
+	// 17 and 18 (runs of zeros)
+	type token struct {
+		symbol    int
+		extra     uint32
+		extraBits uint
+	}
+	var tokens []token
+	for i := 0; i < len(lengths); {
+		v := lengths[i]
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == v {
+			run++
+		}
+		i += run
+		if v == 0 {
+			for ; run >= 11; run -= min(run, 138) {
+				tokens = append(tokens, token{18, uint32(min(run, 138) - 11), 7})
+			}
+			if run >= 3 {
+				tokens = append(tokens, token{17, uint32(run - 3), 3})
+				run = 0
+			}
+		} else {
+			tokens = append(tokens, token{int(v), 0, 0})
+			run--
+			for ; run >= 3; run -= min(run, 6) {
+				tokens = append(tokens, token{16, uint32(min(run, 6) - 3), 2})
+			}
+		}
+		for ; run > 0; run-- {
+			tokens = append(tokens, token{int(v), 0, 0})
+		}
+	}
+
+	var tokenHistogram [19]uint32
+	for _, t := range tokens {
+		tokenHistogram[t.symbol]++
+	}
+	tokenLengths := huffmanLengths(tokenHistogram[:], vp8lMaxLengthLength)
+	count := len(vp8lCodeLengthOrder)
+	for count > 4 && tokenLengths[vp8lCodeLengthOrder[count-1]] == 0 {
+		count--
+	}
+	w.writeBits(uint32(count-4), 4)
+	for _, s := range vp8lCodeLengthOrder[:count] {
+		w.writeBits(uint32(tokenLengths[s]), 3)
+	}
+	w.writeBits(0, 1) // Lengths cover the whole alphabet
+
+	tokenCode := &prefixCode{lengths: tokenLengths, codes: canonicalCodes(tokenLengths)}
+	for _, t := range tokens {
+		tokenCode.write(w, t.symbol)
+		w.writeBits(t.extra, t.extraBits)
+	}
+	return &prefixCode{lengths: lengths, codes: canonicalCodes(lengths)}
+}
+
+// huffmanLengths builds Huffman code lengths of at most maxLength bits. A
+// lone symbol is paired with another so every code is complete. Histograms
+// that would exceed maxLength are flattened until the tree fits.
+func huffmanLengths(histogram []uint32, maxLength int) []uint8 {
+	counts := make([]uint64, len(histogram))
+	used := 0
+	for s, n := range histogram {
+		counts[s] = uint64(n)
+		if n > 0 {
+			used++
+		}
+	}
+	if used == 1 {
+		for s := range counts {
+			if counts[s] == 0 {
+				counts[s] = 1
+				break
+			}
+		}
+	}
+
+	type node struct {
+		weight      uint64
+		symbol      int
+		left, right int
+	}
+	lengths := make([]uint8, len(histogram))
+	for floor := uint64(1); ; floor *= 2 {
+		var nodes []node
+		for s, n := range counts {
+			if n > 0 {
+				nodes = append(nodes, node{weight: max(n, floor), symbol: s, left: -1, right: -1})
+			}
+		}
+		sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].weight < nodes[j].weight })
+		leaves := len(nodes)
+
+		// Leaves and merged nodes are both consumed in weight order
+		nextLeaf, nextNode := 0, leaves
+		take := func() int {
+			if nextLeaf < leaves && (nextNode >= len(nodes) || nodes[nextLeaf].weight <= nodes[nextNode].weight) {
+				nextLeaf++
+				return nextLeaf - 1
+			}
+			nextNode++
+			return nextNode - 1
+		}
+		for i := 0; i < leaves-1; i++ {
+			a, b := take(), take()
+			nodes = append(nodes, node{weight: nodes[a].weight + nodes[b].weight, symbol: -1, left: a, right: b})
+		}
+
+		depth := make([]int, len(nodes))
+		for i := len(nodes) - 1; i >= leaves; i-- {
+			depth[nodes[i].left] = depth[i] + 1
+			depth[nodes[i].right] = depth[i] + 1
+		}
+		deepest := 0
+		for i := 0; i < leaves; i++ {
+			lengths[nodes[i].symbol] = uint8(depth[i])
+			deepest = max(deepest, depth[i])
+		}
+		if deepest <= maxLength {
+			return lengths
+		}
+	}
+}
+
+// canonicalCodes assigns canonical code words, bit-reversed for LSB-first output
+func canonicalCodes(lengths []uint8) []uint16 {
+	var counts [vp8lMaxCodeLength + 1]int
+	for _, l := range lengths {
+		counts[l]++
+	}
+	counts[0] = 0
+
+	var next [vp8lMaxCodeLength + 1]int
+	code := 0
+	for bits := 1; bits <= vp8lMaxCodeLength; bits++ {
+		code = (code + counts[bits-1]) << 1
+		next[bits] = code
+	}
+
+	codes := make([]uint16, len(lengths))
+	for s, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		c := next[l]
+		next[l]++
+		var reversed uint16
+		for i := uint8(0); i < l; i++ {
+			reversed = reversed<<1 | uint16(c>>i&1)
+		}
+		codes[s] = reversed
+	}
+	return codes
+}
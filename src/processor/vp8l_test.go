@@ -0,0 +1,116 @@
+package processor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// toNRGBA converts img to non-premultiplied RGBA
+func toNRGBA(img image.Image) *image.NRGBA {
+	out := image.NewNRGBA(img.Bounds())
+	draw.Draw(out, out.Bounds(), img, img.Bounds().Min, draw.Src)
+	return out
+}
+
+// paletteImage creates an image using n colors with a transparent stripe
+func paletteImage(w, h, n int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := (x/3 + y) % n
+			img.SetNRGBA(x, y, color.NRGBA{uint8(i * 37), uint8(i * 91), uint8(255 - i*13), 255})
+			if x == w/2 {
+				img.SetNRGBA(x, y, color.NRGBA{})
+			}
+		}
+	}
+	return img
+}
+
+// decodeVP8L wraps a VP8L bitstream in a WebP container and decodes it
+func decodeVP8L(t *testing.T, bitstream []byte) image.Image {
+	t.Helper()
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	writeWebPChunk(&body, "VP8L", bitstream)
+	var riff bytes.Buffer
+	writeWebPChunk(&riff, "RIFF", body.Bytes())
+
+	img, err := webp.Decode(bytes.NewReader(riff.Bytes()))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	return img
+}
+
+// Test EncodeVP8L is lossless for palette and true color images
+func TestEncodeVP8L_RoundTrip(t *testing.T) {
+	translucent := toNRGBA(gradientImage(33, 17))
+	for i := 3; i < len(translucent.Pix); i += 4 {
+		translucent.Pix[i] = uint8(i * 7)
+	}
+
+	tests := []struct {
+		name string
+		img  *image.NRGBA
+	}{
+		{"Single pixel", paletteImage(1, 1, 1)},
+		{"Two colors", paletteImage(37, 21, 2)},
+		{"Four colors", paletteImage(40, 9, 4)},
+		{"Sixteen colors", paletteImage(19, 30, 16)},
+		{"Full palette", paletteImage(64, 64, 255)},
+		{"Gradient", toNRGBA(gradientImage(120, 80))},
+		{"Noise", toNRGBA(noiseImage(50, 45))},
+		{"Translucent", translucent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded := toNRGBA(decodeVP8L(t, EncodeVP8L(tt.img)))
+			if decoded.Bounds() != tt.img.Bounds() {
+				t.Fatalf("Bounds = %v, expected %v", decoded.Bounds(), tt.img.Bounds())
+			}
+			if !bytes.Equal(decoded.Pix, tt.img.Pix) {
+				t.Error("Decoded pixels differ from the source")
+			}
+		})
+	}
+}
+
+// Test EncodeVP8L compresses flat areas with backward references
+func TestEncodeVP8L_Compresses(t *testing.T) {
+	img := paletteImage(400, 400, 1)
+	if size := len(EncodeVP8L(img)); size > 200 {
+		t.Errorf("Encoded size = %d bytes, expected a few dozen for a flat image", size)
+	}
+}
+
+// Test huffmanLengths respects the length limit for skewed histograms
+func TestHuffmanLengths_Limit(t *testing.T) {
+	histogram := make([]uint32, 40)
+	for i := range histogram {
+		histogram[i] = 1 << min(i, 31)
+	}
+	for _, limit := range []int{7, 15} {
+		lengths := huffmanLengths(histogram, limit)
+
+		// Kraft sum of a complete code is exactly one
+		kraft := 0.0
+		for _, l := range lengths {
+			if int(l) > limit {
+				t.Fatalf("Length %d exceeds limit %d", l, limit)
+			}
+			if l > 0 {
+				kraft += 1 / float64(uint64(1)<<l)
+			}
+		}
+		if kraft != 1 {
+			t.Errorf("Kraft sum = %v, expected 1", kraft)
+		}
+	}
+}
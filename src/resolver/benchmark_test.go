@@ -1,7 +1,9 @@
 package resolver
 
 import (
+	"fmt"
 	"testing"
+	"time"
 )
 
 // BenchmarkFileResolver_SingleImage_WithExtension benchmarks direct resolution
@@ -98,3 +100,44 @@ func BenchmarkFileResolver_PathTraversal(b *testing.B) {
 		_, _ = resolver.Resolve("../secret.txt")
 	}
 }
+
+// BenchmarkFileResolver_LargeGroup_Stat benchmarks cold resolution in a large
+// group with stat-per-candidate checks; half the names fall back to the default
+func BenchmarkFileResolver_LargeGroup_Stat(b *testing.B) {
+	tmpDir := setupLargeGroup(b, 1000)
+	resolver := NewResolver(tmpDir)
+	
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = resolver.Resolve(fmt.Sprintf("gallery/photo_%04d", i%2000))
+	}
+}
+
+// BenchmarkFileResolver_LargeGroup_Listing benchmarks cold resolution in a
+// large group with cached directory listings; half the names fall back to the
+// default
+func BenchmarkFileResolver_LargeGroup_Listing(b *testing.B) {
+	tmpDir := setupLargeGroup(b, 1000)
+	resolver := NewResolverWithCache(tmpDir)
+	
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resolver.cache.Clear()
+		_, _ = resolver.Resolve(fmt.Sprintf("gallery/photo_%04d", i%2000))
+	}
+}
+
+// BenchmarkFileResolver_LargeGroup_ListingTTL benchmarks cold resolution in a
+// large group whose listing is trusted for a TTL instead of checked with a
+// stat of the directory; half the names fall back to the default
+func BenchmarkFileResolver_LargeGroup_ListingTTL(b *testing.B) {
+	tmpDir := setupLargeGroup(b, 1000)
+	resolver := NewResolverWithCache(tmpDir)
+	resolver.SetListingTTL(time.Minute)
+	
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resolver.cache.Clear()
+		_, _ = resolver.Resolve(fmt.Sprintf("gallery/photo_%04d", i%2000))
+	}
+}
@@ -1,29 +1,72 @@
 package resolver
 
 import (
+	"container/list"
 	"sync"
+	"time"
 )
 
-// Cache provides thread-safe caching for file resolution results
+// Cache provides thread-safe caching for file resolution results. With a
+// maximum number of entries it evicts the least recently used result;
+// evicted paths are simply resolved again.
 type Cache struct {
-	mu      sync.RWMutex
-	entries map[string]*ResolutionResult
+	mu          sync.Mutex
+	entries     map[string]*list.Element
+	recent      *list.List    // Entries by last use, most recent first
+	maxEntries  int           // Entries kept at most (0 = unlimited)
+	fallbackTTL time.Duration // Lifetime of fallback results (0 = unlimited)
 }
 
-// NewCache creates a new resolution cache
+// cacheEntry is a cached result and when it expires (zero = never)
+type cacheEntry struct {
+	key     string
+	result  *ResolutionResult
+	expires time.Time
+}
+
+// NewCache creates a new resolution cache without an entry limit
 func NewCache() *Cache {
 	return &Cache{
-		entries: make(map[string]*ResolutionResult),
+		entries: make(map[string]*list.Element),
+		recent:  list.New(),
 	}
 }
 
+// SetMaxEntries limits the number of cached results (0 = unlimited),
+// evicting the least recently used ones beyond it
+func (c *Cache) SetMaxEntries(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
+	c.maxEntries = n
+	c.evict()
+}
+
+// SetFallbackTTL limits how long fallback results are cached, so a path
+// that fell back to a default image resolves to its file soon after the
+// file is added. Results stored before the call keep their lifetime.
+func (c *Cache) SetFallbackTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
+	c.fallbackTTL = ttl
+}
+
 // Get retrieves a cached resolution result
 func (c *Cache) Get(key string) (*ResolutionResult, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	
-	result, found := c.entries[key]
-	return result, found
+	element, found := c.entries[key]
+	if !found {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		return nil, false
+	}
+	c.recent.MoveToFront(element)
+	return entry.result, true
 }
 
 // Set stores a resolution result in the cache
@@ -31,7 +74,27 @@ func (c *Cache) Set(key string, result *ResolutionResult) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	
-	c.entries[key] = result
+	entry := &cacheEntry{key: key, result: result}
+	if result.IsFallback && c.fallbackTTL > 0 {
+		entry.expires = time.Now().Add(c.fallbackTTL)
+	}
+	if element, found := c.entries[key]; found {
+		element.Value = entry
+		c.recent.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.recent.PushFront(entry)
+	c.evict()
+}
+
+// evict removes the least recently used entries beyond maxEntries. The
+// caller holds the lock.
+func (c *Cache) evict() {
+	for c.maxEntries > 0 && c.recent.Len() > c.maxEntries {
+		oldest := c.recent.Back()
+		c.recent.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
 }
 
 // Invalidate removes a specific entry from the cache
@@ -39,7 +102,10 @@ func (c *Cache) Invalidate(key string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	
-	delete(c.entries, key)
+	if element, found := c.entries[key]; found {
+		c.recent.Remove(element)
+		delete(c.entries, key)
+	}
 }
 
 // Clear removes all entries from the cache
@@ -47,13 +113,14 @@ func (c *Cache) Clear() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	
-	c.entries = make(map[string]*ResolutionResult)
+	c.entries = make(map[string]*list.Element)
+	c.recent.Init()
 }
 
 // Size returns the number of cached entries
 func (c *Cache) Size() int {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	
 	return len(c.entries)
 }
@@ -1,8 +1,11 @@
 package resolver
 
 import (
+	"fmt"
+	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -144,3 +147,102 @@ func TestFileResolver_Concurrent_ThreadSafety(t *testing.T) {
 	
 	wg.Wait()
 }
+
+// TestCache_FallbackTTL tests fallback results expire after the TTL while other results persist
+func TestCache_FallbackTTL(t *testing.T) {
+	cache := NewCache()
+	cache.SetFallbackTTL(50 * time.Millisecond)
+	
+	cache.Set("missing.jpg", &ResolutionResult{ResolvedPath: "/default.jpg", IsFallback: true})
+	cache.Set("cat.jpg", &ResolutionResult{ResolvedPath: "/cat.jpg"})
+	
+	_, found := cache.Get("missing.jpg")
+	assert.True(t, found, "Fallback should be cached within the TTL")
+	
+	time.Sleep(100 * time.Millisecond)
+	_, found = cache.Get("missing.jpg")
+	assert.False(t, found, "Fallback should expire after the TTL")
+	_, found = cache.Get("cat.jpg")
+	assert.True(t, found, "Other results should not expire")
+}
+
+// TestFileResolver_FallbackTTL_PicksUpNewFile tests a path that fell back resolves to its file once added and the TTL passed
+func TestFileResolver_FallbackTTL_PicksUpNewFile(t *testing.T) {
+	tmpDir := setupTestDir(t)
+	resolver := NewResolverWithCache(tmpDir)
+	resolver.SetFallbackTTL(50 * time.Millisecond)
+	
+	result, err := resolver.Resolve("added.jpg")
+	require.NoError(t, err)
+	require.True(t, result.IsFallback)
+	
+	createTestFile(t, tmpDir, "added.jpg")
+	time.Sleep(100 * time.Millisecond)
+	
+	result, err = resolver.Resolve("added.jpg")
+	require.NoError(t, err)
+	assert.False(t, result.IsFallback)
+	assert.Equal(t, filepath.Join(tmpDir, "added.jpg"), result.ResolvedPath)
+}
+
+// TestCache_MaxEntries tests inserting beyond the limit evicts the least recently used entries while recently used ones stay cached
+func TestCache_MaxEntries(t *testing.T) {
+	cache := NewCache()
+	cache.SetMaxEntries(100)
+	
+	cache.Set("hot.jpg", &ResolutionResult{ResolvedPath: "/hot.jpg"})
+	for i := 0; i < 10000; i++ {
+		cache.Set(fmt.Sprintf("scan%d.jpg", i), &ResolutionResult{ResolvedPath: "/default.jpg", IsFallback: true})
+		// Keep one entry in use
+		_, found := cache.Get("hot.jpg")
+		require.True(t, found, "Recently used entry should stay cached")
+		assert.LessOrEqual(t, cache.Size(), 100)
+	}
+	
+	assert.Equal(t, 100, cache.Size())
+	_, found := cache.Get("scan0.jpg")
+	assert.False(t, found, "Oldest entry should be evicted")
+	result, found := cache.Get("scan9999.jpg")
+	assert.True(t, found, "Newest entry should be cached")
+	assert.Equal(t, "/default.jpg", result.ResolvedPath)
+	
+	// Lowering the limit evicts at once, replacing an entry refreshes it
+	cache.Set("scan9950.jpg", &ResolutionResult{ResolvedPath: "/scan9950.jpg"})
+	cache.SetMaxEntries(2)
+	assert.Equal(t, 2, cache.Size())
+	result, found = cache.Get("scan9950.jpg")
+	assert.True(t, found)
+	assert.Equal(t, "/scan9950.jpg", result.ResolvedPath)
+	_, found = cache.Get("hot.jpg")
+	assert.False(t, found)
+	
+	// Invalidated and cleared entries leave no trace in the recency list
+	cache.Invalidate("scan9950.jpg")
+	assert.Equal(t, 1, cache.Size())
+	cache.Clear()
+	cache.Set("a.jpg", &ResolutionResult{ResolvedPath: "/a.jpg"})
+	cache.Set("b.jpg", &ResolutionResult{ResolvedPath: "/b.jpg"})
+	cache.Set("c.jpg", &ResolutionResult{ResolvedPath: "/c.jpg"})
+	assert.Equal(t, 2, cache.Size())
+}
+
+// TestFileResolver_CacheLimit tests evicted paths resolve again to the same result
+func TestFileResolver_CacheLimit(t *testing.T) {
+	tmpDir := setupTestDir(t)
+	resolver := NewResolverWithCache(tmpDir)
+	resolver.SetCacheLimit(2)
+	
+	first, err := resolver.Resolve("cat.jpg")
+	require.NoError(t, err)
+	for _, path := range []string{"dog.png", "missing1.jpg", "missing2.jpg"} {
+		_, err := resolver.Resolve(path)
+		require.NoError(t, err)
+	}
+	
+	assert.Equal(t, 2, resolver.cache.Size())
+	_, found := resolver.cache.Get("cat.jpg")
+	assert.False(t, found, "Oldest resolution should be evicted")
+	again, err := resolver.Resolve("cat.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, first, again)
+}
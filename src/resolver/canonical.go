@@ -0,0 +1,143 @@
+package resolver
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// canonicalCache remembers the on-disk spelling of request paths resolved
+// case-insensitively, keyed by the lowercased path. Only paths whose every
+// segment matched one name are kept, so it grows with the files found rather
+// than with the spellings requested.
+type canonicalCache struct {
+	mu    sync.RWMutex
+	paths map[string]string
+}
+
+// newCanonicalCache creates an empty canonicalization cache
+func newCanonicalCache() *canonicalCache {
+	return &canonicalCache{paths: make(map[string]string)}
+}
+
+func (c *canonicalCache) get(key string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	path, found := c.paths[key]
+	return path, found
+}
+
+func (c *canonicalCache) set(key, path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paths[key] = path
+}
+
+// Clear drops every remembered spelling
+func (c *canonicalCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paths = make(map[string]string)
+}
+
+// SetCaseInsensitive sets whether request paths match file and directory
+// names in any case. Matches resolve to the name on disk, so every spelling
+// of a path shares one resolved path, and a name spelled exactly as
+// requested wins over other case variants. Extensions probed for paths
+// without one are still matched as listed, e.g. photo.JPG is not found for
+// a request of photo.
+func (r *Resolver) SetCaseInsensitive(enabled bool) {
+	r.caseInsensitive = enabled
+	if enabled && r.canonical == nil {
+		r.canonical = newCanonicalCache()
+	}
+}
+
+// normalizeRequestPath drops trailing slashes, so cats/ and cats resolve
+// and are cached alike
+func normalizeRequestPath(requestPath string) string {
+	if trimmed := strings.TrimRight(requestPath, "/"); trimmed != "" {
+		return trimmed
+	}
+	return requestPath
+}
+
+// canonicalPath returns cleanPath spelled as on disk. Segments without a
+// match are kept as requested, so a missing path resolves like before.
+func (r *Resolver) canonicalPath(s *scan, cleanPath string) string {
+	key := strings.ToLower(cleanPath)
+	if path, found := r.canonical.get(key); found {
+		return path
+	}
+
+	segments := strings.Split(cleanPath, string(filepath.Separator))
+	dir := r.imageDir
+	unique := true
+	for i, segment := range segments {
+		name, matches := matchName(s.names(dir), segment, i == len(segments)-1)
+		if matches == 0 {
+			return filepath.Join(segments...)
+		}
+		unique = unique && matches == 1
+		segments[i] = name
+		dir = filepath.Join(dir, name)
+	}
+
+	path := filepath.Join(segments...)
+	if unique {
+		r.canonical.set(key, path)
+	}
+	return path
+}
+
+// matchName returns the name in names equal to segment in any case and how
+// many distinct names matched; an exact match wins, then the first in sort
+// order. The last segment of a path may omit the extension, so it also
+// matches the name before one.
+func matchName(names []string, segment string, last bool) (string, int) {
+	var match string
+	matches := 0
+	exact := false
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if last && !strings.EqualFold(name, segment) {
+			// Match the name without its extension, e.g. Photo for photo.jpg
+			if len(name) <= len(segment) || name[len(segment)] != '.' {
+				continue
+			}
+			name = name[:len(segment)]
+		}
+		if !strings.EqualFold(name, segment) || seen[name] {
+			continue
+		}
+		seen[name] = true
+		matches++
+		if name == segment {
+			match, exact = name, true
+		} else if !exact && (match == "" || name < match) {
+			match = name
+		}
+	}
+	return match, matches
+}
+
+// names lists the entries of dir, from the cached listing when there is one
+func (s *scan) names(dir string) []string {
+	if s.listings != nil {
+		entries, _ := s.listings.entries(dir)
+		names := make([]string, 0, len(entries))
+		for name := range entries {
+			names = append(names, name)
+		}
+		return names
+	}
+	entries, err := s.files.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
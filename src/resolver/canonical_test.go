@@ -0,0 +1,139 @@
+package resolver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestResolver_Resolve_PathCase tests that case variants resolve to the file
+// on disk only when paths are case-insensitive, with and without cached
+// listings
+func TestResolver_Resolve_PathCase(t *testing.T) {
+	tmpDir := setupTestDir(t)
+	createTestFile(t, tmpDir, "Animals/Zebra.PNG")
+
+	tests := []struct {
+		path          string
+		sensitive     string // Resolved path when case-sensitive
+		insensitive   string // Resolved path when case-insensitive
+		insensitiveFb bool   // Whether the insensitive resolution is a fallback
+	}{
+		{"cat.jpg", "cat.jpg", "cat.jpg", false},
+		{"Cat.JPG", "default.jpg", "cat.jpg", false},
+		{"CAT", "default.jpg", "cat.jpg", false},
+		{"Cats", "default.jpg", "cats/default.jpg", false},
+		{"CATS/Cat_White", "default.jpg", "cats/cat_white.jpg", false},
+		{"cats/CAT_WHITE.png", "cats/default.jpg", "cats/cat_white.png", false},
+		{"Cats/missing", "default.jpg", "cats/default.jpg", true},
+		{"animals/zebra.png", "default.jpg", "Animals/Zebra.PNG", false},
+		{"Animals/Zebra.PNG", "Animals/Zebra.PNG", "Animals/Zebra.PNG", false},
+		{"missing", "default.jpg", "default.jpg", true},
+	}
+
+	for _, cached := range []bool{false, true} {
+		for _, tt := range tests {
+			t.Run(tt.path, func(t *testing.T) {
+				for _, insensitive := range []bool{false, true} {
+					res := NewResolver(tmpDir)
+					if cached {
+						res = NewResolverWithCache(tmpDir)
+					}
+					res.SetCaseInsensitive(insensitive)
+
+					result, err := res.Resolve(tt.path)
+
+					require.NoError(t, err)
+					expected := tt.sensitive
+					if insensitive {
+						expected = tt.insensitive
+						assert.Equal(t, tt.insensitiveFb, result.IsFallback)
+					}
+					assert.Equal(t, filepath.Join(tmpDir, expected), result.ResolvedPath, "insensitive=%v cached=%v", insensitive, cached)
+				}
+			})
+		}
+	}
+}
+
+// TestResolver_Resolve_PathCase_ExactWins tests that among names differing
+// only in case the exactly spelled one wins, and that other spellings pick
+// the same one every time
+func TestResolver_Resolve_PathCase_ExactWins(t *testing.T) {
+	tmpDir := setupTestDir(t)
+	createTestFile(t, tmpDir, "Photo.jpg")
+	createTestFile(t, tmpDir, "photo.jpg")
+	entries, err := os.ReadDir(tmpDir)
+	require.NoError(t, err)
+	names := 0
+	for _, entry := range entries {
+		if entry.Name() == "Photo.jpg" || entry.Name() == "photo.jpg" {
+			names++
+		}
+	}
+	if names < 2 {
+		t.Skip("file system is case-insensitive")
+	}
+
+	res := NewResolverWithCache(tmpDir)
+	res.SetCaseInsensitive(true)
+	for _, tt := range []struct{ path, expected string }{
+		{"photo.jpg", "photo.jpg"},
+		{"Photo.jpg", "Photo.jpg"},
+		{"PHOTO.JPG", "Photo.jpg"},
+		{"photo.jpg", "photo.jpg"},
+		{"PHOTO", "Photo.jpg"},
+	} {
+		result, err := res.Resolve(tt.path)
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(tmpDir, tt.expected), result.ResolvedPath, tt.path)
+	}
+}
+
+// TestResolver_Resolve_PathCase_ClearCache tests that a renamed file is
+// found again once the cache is cleared
+func TestResolver_Resolve_PathCase_ClearCache(t *testing.T) {
+	tmpDir := setupTestDir(t)
+	res := NewResolverWithCache(tmpDir)
+	res.SetCaseInsensitive(true)
+	result, err := res.Resolve("DOG.png")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(tmpDir, "dog.png"), result.ResolvedPath)
+
+	require.NoError(t, os.Rename(filepath.Join(tmpDir, "dog.png"), filepath.Join(tmpDir, "Dog.png")))
+	res.ClearCache()
+	result, err = res.Resolve("DOG.png")
+
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(tmpDir, "Dog.png"), result.ResolvedPath)
+}
+
+// TestResolver_Resolve_TrailingSlash tests that trailing slashes resolve like
+// the path without them, in either case mode
+func TestResolver_Resolve_TrailingSlash(t *testing.T) {
+	tmpDir := setupTestDir(t)
+	paths := []string{"cat.jpg", "cat", "cats", "cats/cat_white", "cats/cat_white.png", "dogs/missing", "missing"}
+
+	for _, insensitive := range []bool{false, true} {
+		for _, path := range paths {
+			res := NewResolverWithCache(tmpDir)
+			res.SetCaseInsensitive(insensitive)
+			expected, err := NewResolver(tmpDir).Resolve(path)
+			require.NoError(t, err)
+
+			for _, variant := range []string{path + "/", path + "//"} {
+				result, err := res.Resolve(variant)
+				require.NoError(t, err)
+				assert.Equal(t, expected, result, variant)
+			}
+		}
+	}
+
+	// The root stays rejected rather than resolving the images directory
+	result, err := NewResolver(tmpDir).Resolve("/")
+	require.NoError(t, err)
+	assert.Equal(t, "system_default", result.FallbackType)
+}
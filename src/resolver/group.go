@@ -0,0 +1,181 @@
+package resolver
+
+import (
+	"errors"
+	"goimgserver/storage"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ListGroup returns the file names of the images in a group directory,
+// sorted. Group defaults, hidden files, subdirectories and files that are
+// not images are left out. A group that does not exist lists no images.
+func (r *Resolver) ListGroup(group string) ([]string, error) {
+	cleanGroup, err := sanitizePath(group, r.imageDir)
+	if err != nil {
+		return nil, err
+	}
+	groupPath := filepath.Join(r.imageDir, cleanGroup)
+
+	entries, err := r.files.ReadDir(groupPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) || !dirExists(r.files, groupPath) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	images, _ := r.groupImages(groupPath, entries)
+	return images, nil
+}
+
+// groupImages returns the sorted image names among the entries of a group
+// directory, as ListGroup lists them, and whether the group has a default
+func (r *Resolver) groupImages(groupPath string, entries []fs.DirEntry) ([]string, bool) {
+	names := []string{}
+	hasDefault := false
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := strings.ToLower(filepath.Ext(name))
+		if strings.HasPrefix(name, ".") || !isSourceExtension(ext) {
+			continue
+		}
+
+		// Symlinks are listed when they point to a file inside the images directory
+		fullPath := filepath.Join(groupPath, name)
+		if !fileExists(r.files, fullPath) || validateResolvedPath(fullPath, r.imageDir) != nil {
+			continue
+		}
+		if strings.TrimSuffix(name, filepath.Ext(name)) == "default" {
+			hasDefault = true
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, hasDefault
+}
+
+// ListGroups returns every group directory below the images directory,
+// nested ones included, sorted by path. Hidden directories and symlinked
+// directories are left out. With caching the scan is kept until ClearCache
+// or, once the listing TTL has passed, until a group directory changes.
+func (r *Resolver) ListGroups() ([]Group, error) {
+	if r.groups != nil {
+		if groups, ok := r.groups.current(r.files); ok {
+			return groups, nil
+		}
+	}
+
+	groups := []Group{}
+	dirs := make(map[string]time.Time)
+	if err := r.scanGroups(r.imageDir, "", &groups, dirs); err != nil {
+		return nil, err
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Path < groups[j].Path })
+	if r.groups != nil {
+		r.groups.store(groups, dirs)
+	}
+	return groups, nil
+}
+
+// scanGroups adds the groups below dir, whose path relative to the images
+// directory is rel, recording the modification time of each directory read
+func (r *Resolver) scanGroups(dir, rel string, groups *[]Group, dirs map[string]time.Time) error {
+	info, err := r.files.Stat(dir)
+	if err != nil {
+		return err
+	}
+	entries, err := r.files.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	dirs[dir] = info.ModTime()
+
+	if rel != "" {
+		images, hasDefault := r.groupImages(dir, entries)
+		*groups = append(*groups, Group{Path: rel, Images: images, HasDefault: hasDefault})
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if err := r.scanGroups(filepath.Join(dir, entry.Name()), path.Join(rel, entry.Name()), groups, dirs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupIndex keeps the result of ListGroups with the modification times of
+// the directories it read. Within the TTL it is trusted without a stat;
+// after that one stat per directory tells whether it is still current.
+type groupIndex struct {
+	mu      sync.Mutex
+	groups  []Group
+	dirs    map[string]time.Time
+	checked time.Time
+	ttl     time.Duration
+}
+
+// current returns the kept groups if no directory changed since the scan
+func (g *groupIndex) current(files storage.FS) ([]Group, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.dirs == nil {
+		return nil, false
+	}
+	if g.ttl > 0 && time.Since(g.checked) < g.ttl {
+		return g.groups, true
+	}
+	for dir, modTime := range g.dirs {
+		info, err := files.Stat(dir)
+		if err != nil || !info.ModTime().Equal(modTime) {
+			return nil, false
+		}
+	}
+	g.checked = time.Now()
+	return g.groups, true
+}
+
+// store keeps the result of a scan
+func (g *groupIndex) store(groups []Group, dirs map[string]time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.groups = groups
+	g.dirs = dirs
+	g.checked = time.Now()
+}
+
+// setTTL sets how long the kept groups are used without a stat
+func (g *groupIndex) setTTL(ttl time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.ttl = ttl
+}
+
+// Clear drops the kept groups
+func (g *groupIndex) Clear() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.groups = nil
+	g.dirs = nil
+}
+
+// isSourceExtension reports whether ext (lower case, with dot) is a source image extension
+func isSourceExtension(ext string) bool {
+	for _, candidate := range sourceExtensions {
+		if ext == candidate {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package resolver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestResolver_ListGroup_Populated tests listing the images of a group
+func TestResolver_ListGroup_Populated(t *testing.T) {
+	// Arrange
+	tmpDir := setupTestDir(t)
+	createTestFile(t, tmpDir, "cats/.hidden.jpg")
+	createTestFile(t, tmpDir, "cats/notes.txt")
+	createTestFile(t, tmpDir, "cats/anim.gif")
+	createTestFile(t, tmpDir, "cats/kittens/small.jpg")
+	resolver := NewResolver(tmpDir)
+
+	// Act
+	names, err := resolver.ListGroup("cats")
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, []string{"anim.gif", "cat_white.jpg", "cat_white.png", "funny_white.png"}, names)
+}
+
+// TestResolver_ListGroup_Empty tests that empty and missing groups list nothing
+func TestResolver_ListGroup_Empty(t *testing.T) {
+	tmpDir := setupTestDir(t)
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "empty"), 0755))
+	resolver := NewResolver(tmpDir)
+
+	for _, group := range []string{"empty", "missing", "cat.jpg"} {
+		t.Run(group, func(t *testing.T) {
+			names, err := resolver.ListGroup(group)
+			require.NoError(t, err)
+			assert.NotNil(t, names)
+			assert.Empty(t, names)
+		})
+	}
+}
+
+// TestResolver_ListGroup_Security tests that symlinks leaving the images
+// directory and traversal attempts are rejected
+func TestResolver_ListGroup_Security(t *testing.T) {
+	// Arrange
+	tmpDir := setupTestDir(t)
+	outside := filepath.Join(t.TempDir(), "secret.jpg")
+	require.NoError(t, os.WriteFile(outside, []byte("secret"), 0644))
+	require.NoError(t, os.Symlink(outside, filepath.Join(tmpDir, "cats", "secret.jpg")))
+	require.NoError(t, os.Symlink(filepath.Join(tmpDir, "cat.jpg"), filepath.Join(tmpDir, "cats", "linked.jpg")))
+	resolver := NewResolver(tmpDir)
+
+	// Act
+	names, err := resolver.ListGroup("cats")
+
+	// Assert
+	require.NoError(t, err)
+	assert.Contains(t, names, "linked.jpg")
+	assert.NotContains(t, names, "secret.jpg")
+
+	_, err = resolver.ListGroup("../etc")
+	assert.ErrorIs(t, err, ErrPathTraversal)
+}
+
+// TestResolver_ListGroups tests indexing every group with its images and default
+func TestResolver_ListGroups(t *testing.T) {
+	// Arrange
+	tmpDir := setupTestDir(t)
+	createTestFile(t, tmpDir, "cats/kittens/small.jpg")
+	createTestFile(t, tmpDir, "cats/notes.txt")
+	createTestFile(t, tmpDir, ".trash/old.jpg")
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "empty"), 0755))
+	require.NoError(t, os.Symlink(filepath.Join(tmpDir, "dogs"), filepath.Join(tmpDir, "hounds")))
+	resolver := NewResolver(tmpDir)
+
+	// Act
+	groups, err := resolver.ListGroups()
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, []Group{
+		{Path: "cats", Images: []string{"cat_white.jpg", "cat_white.png", "funny_white.png"}, HasDefault: true},
+		{Path: "cats/kittens", Images: []string{"small.jpg"}},
+		{Path: "dogs", Images: []string{"puppy.jpg"}, HasDefault: true},
+		{Path: "empty", Images: []string{}},
+	}, groups)
+}
+
+// TestResolver_ListGroups_Cached tests that the index is kept until the
+// cache is cleared or, after the TTL, a group directory changes
+func TestResolver_ListGroups_Cached(t *testing.T) {
+	tmpDir := setupTestDir(t)
+	resolver := NewResolverWithCache(tmpDir)
+	resolver.SetListingTTL(time.Hour)
+	paths := func() []string {
+		groups, err := resolver.ListGroups()
+		require.NoError(t, err)
+		var paths []string
+		for _, group := range groups {
+			paths = append(paths, group.Path)
+		}
+		return paths
+	}
+	assert.Equal(t, []string{"cats", "dogs"}, paths())
+
+	// Added behind the server's back: the index is still trusted
+	createTestFile(t, tmpDir, "birds/robin.jpg")
+	assert.Equal(t, []string{"cats", "dogs"}, paths())
+
+	// Added through the server, which clears the cache
+	resolver.ClearCache()
+	assert.Equal(t, []string{"birds", "cats", "dogs"}, paths())
+
+	// Without a TTL every change is seen, nested ones included
+	resolver.SetListingTTL(0)
+	createTestFile(t, tmpDir, "birds/owls/barn.jpg")
+	assert.Equal(t, []string{"birds", "birds/owls", "cats", "dogs"}, paths())
+	createTestFile(t, tmpDir, "birds/owls/snowy.jpg")
+	groups, err := resolver.ListGroups()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"barn.jpg", "snowy.jpg"}, groups[1].Images)
+}
@@ -0,0 +1,164 @@
+package resolver
+
+import (
+	"goimgserver/storage"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// dirListing is the set of names in a directory as of its modification time
+// and when that was last checked
+type dirListing struct {
+	modTime time.Time
+	checked time.Time
+	entries map[string]fs.FileMode
+}
+
+// listingCache reads each directory once and answers existence checks from
+// the listing until the directory changes. Within the TTL a listing is
+// trusted without a stat of the directory; Clear drops every listing when
+// images are added or replaced through the server.
+type listingCache struct {
+	mu    sync.RWMutex
+	dirs  map[string]*dirListing
+	ttl   time.Duration // How long a listing is used unchecked (0 = check every scan)
+	files storage.FS
+}
+
+// newListingCache creates an empty cache of listings read from files
+func newListingCache(files storage.FS) *listingCache {
+	return &listingCache{
+		dirs:  make(map[string]*dirListing),
+		files: files,
+	}
+}
+
+// setTTL sets how long a listing is used without checking the directory
+func (l *listingCache) setTTL(ttl time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.ttl = ttl
+}
+
+// entries returns the names in dir with their types. A stat of dir guards
+// against stale listings older than the TTL; ok is false when dir cannot be
+// listed.
+func (l *listingCache) entries(dir string) (map[string]fs.FileMode, bool) {
+	l.mu.RLock()
+	listing, found := l.dirs[dir]
+	fresh := found && l.ttl > 0 && time.Since(listing.checked) < l.ttl
+	l.mu.RUnlock()
+	if fresh {
+		return listing.entries, true
+	}
+
+	info, err := l.files.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return nil, false
+	}
+	now := time.Now()
+	if found && listing.modTime.Equal(info.ModTime()) {
+		l.mu.Lock()
+		listing.checked = now
+		l.mu.Unlock()
+		return listing.entries, true
+	}
+
+	dirEntries, err := l.files.ReadDir(dir)
+	if err != nil {
+		return nil, false
+	}
+	listing = &dirListing{
+		modTime: info.ModTime(),
+		checked: now,
+		entries: make(map[string]fs.FileMode, len(dirEntries)),
+	}
+	for _, entry := range dirEntries {
+		listing.entries[entry.Name()] = entry.Type()
+	}
+
+	l.mu.Lock()
+	l.dirs[dir] = listing
+	l.mu.Unlock()
+	return listing.entries, true
+}
+
+// Clear drops every listing
+func (l *listingCache) Clear() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.dirs = make(map[string]*dirListing)
+}
+
+// scan answers existence checks for one resolution. It checks each
+// directory's listing for freshness at most once.
+type scan struct {
+	files    storage.FS
+	listings *listingCache
+	dirs     map[string]map[string]fs.FileMode
+}
+
+// newScan starts a resolution scan; without listings it stats every path
+func (r *Resolver) newScan() *scan {
+	return &scan{files: r.files, listings: r.listings}
+}
+
+// lookup reports whether path is listed and, if its type is known without a
+// stat, whether it is a directory. Symlinks and other special entries report
+// known as false so the caller stats them like before.
+func (s *scan) lookup(path string) (listed, known, isDir bool) {
+	dir := filepath.Dir(path)
+	entries, ok := s.dirs[dir]
+	if !ok {
+		entries, _ = s.listings.entries(dir)
+		if s.dirs == nil {
+			s.dirs = make(map[string]map[string]fs.FileMode)
+		}
+		s.dirs[dir] = entries
+	}
+	if entries == nil {
+		return true, false, false
+	}
+	mode, found := entries[filepath.Base(path)]
+	if !found {
+		return false, true, false
+	}
+	if mode.IsRegular() || mode.IsDir() {
+		return true, true, mode.IsDir()
+	}
+	return true, false, false
+}
+
+// fileExists checks if a regular file exists
+func (s *scan) fileExists(path string) bool {
+	if s.listings == nil {
+		return fileExists(s.files, path)
+	}
+	listed, known, isDir := s.lookup(path)
+	if !listed {
+		return false
+	}
+	if !known {
+		return fileExists(s.files, path)
+	}
+	return !isDir
+}
+
+// dirExists checks if a directory exists
+func (s *scan) dirExists(path string) bool {
+	if s.listings == nil {
+		return dirExists(s.files, path)
+	}
+	listed, known, isDir := s.lookup(path)
+	if !listed {
+		return false
+	}
+	if !known {
+		return dirExists(s.files, path)
+	}
+	return isDir
+}
@@ -0,0 +1,130 @@
+package resolver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupLargeGroup creates a group with many files and extensions
+func setupLargeGroup(t testing.TB, files int) string {
+	t.Helper()
+	tmpDir := t.TempDir()
+	groupDir := filepath.Join(tmpDir, "gallery")
+	require.NoError(t, os.MkdirAll(groupDir, 0755))
+
+	extensions := []string{".jpg", ".jpeg", ".png", ".webp"}
+	for i := 0; i < files; i++ {
+		name := fmt.Sprintf("photo_%04d%s", i, extensions[i%len(extensions)])
+		require.NoError(t, os.WriteFile(filepath.Join(groupDir, name), []byte("test content"), 0644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(groupDir, "default.webp"), []byte("test content"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "default.jpg"), []byte("test content"), 0644))
+	return tmpDir
+}
+
+// TestResolver_Listings_MatchStatResolution tests that listing-based
+// resolution matches stat-based resolution
+func TestResolver_Listings_MatchStatResolution(t *testing.T) {
+	tmpDir := setupTestDir(t)
+	createTestFile(t, tmpDir, "cats/kitten.webp")
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "empty"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "folder.jpg"), 0755))
+	require.NoError(t, os.Symlink(filepath.Join(tmpDir, "dog.png"), filepath.Join(tmpDir, "alias.png")))
+	require.NoError(t, os.Symlink(filepath.Join(tmpDir, "cats"), filepath.Join(tmpDir, "kittens")))
+	require.NoError(t, os.Symlink(filepath.Join(tmpDir, "missing.jpg"), filepath.Join(tmpDir, "broken.jpg")))
+
+	paths := []string{
+		"cat.jpg", "cat", "dog", "logo", "profile", "profile.webp",
+		"cats", "cats/cat_white", "cats/cat_white.png", "cats/funny_white", "cats/kitten", "cats/missing",
+		"dogs", "dogs/puppy", "dogs/missing.jpg",
+		"empty", "empty/anything", "folder", "folder.jpg",
+		"alias", "alias.png", "kittens", "kittens/cat_white", "broken", "broken.jpg",
+		"missing", "missing/deep/path", "../secret.txt",
+	}
+
+	statResolver := NewResolver(tmpDir)
+	listingResolver := NewResolverWithCache(tmpDir)
+
+	for _, path := range paths {
+		t.Run(path, func(t *testing.T) {
+			expected, expectedErr := statResolver.Resolve(path)
+			actual, actualErr := listingResolver.Resolve(path)
+
+			assert.Equal(t, expectedErr, actualErr)
+			assert.Equal(t, expected, actual)
+		})
+	}
+}
+
+// TestResolver_Listings_SeeNewFiles tests that a cached listing is refreshed
+// when its directory changes
+func TestResolver_Listings_SeeNewFiles(t *testing.T) {
+	tmpDir := setupTestDir(t)
+	resolver := NewResolverWithCache(tmpDir)
+
+	result, err := resolver.Resolve("cats/tabby")
+	require.NoError(t, err)
+	assert.True(t, result.IsFallback)
+
+	createTestFile(t, tmpDir, "cats/tabby.png")
+
+	result, err = resolver.Resolve("cats/tabby.png")
+	require.NoError(t, err)
+	assert.False(t, result.IsFallback)
+	assert.Equal(t, filepath.Join(tmpDir, "cats", "tabby.png"), result.ResolvedPath)
+}
+
+// TestResolver_Listings_TTL tests that a listing is trusted within its TTL
+// and that new files are seen once the TTL passes or the cache is cleared
+func TestResolver_Listings_TTL(t *testing.T) {
+	tmpDir := setupTestDir(t)
+	resolver := NewResolverWithCache(tmpDir)
+	resolver.SetListingTTL(time.Hour)
+	resolve := func(path string) *ResolutionResult {
+		result, err := resolver.Resolve(path)
+		require.NoError(t, err)
+		return result
+	}
+
+	assert.True(t, resolve("cats/tabby").IsFallback)
+
+	// Added behind the server's back: the listing is still trusted
+	createTestFile(t, tmpDir, "cats/tabby.png")
+	assert.True(t, resolve("cats/tabby.png").IsFallback)
+
+	// Added through the server, which clears the cache
+	resolver.ClearCache()
+	result := resolve("cats/tabby.png")
+	assert.False(t, result.IsFallback)
+	assert.Equal(t, filepath.Join(tmpDir, "cats", "tabby.png"), result.ResolvedPath)
+
+	// Removed files are seen once the TTL passes
+	resolver.SetListingTTL(10 * time.Millisecond)
+	resolver.ClearCache()
+	assert.False(t, resolve("cats/tabby").IsFallback)
+	require.NoError(t, os.Remove(filepath.Join(tmpDir, "cats", "tabby.png")))
+	resolver.cache.Clear()
+	time.Sleep(20 * time.Millisecond)
+	assert.True(t, resolve("cats/tabby").IsFallback)
+}
+
+// TestResolver_Listings_LargeGroup tests resolution within a large group
+func TestResolver_Listings_LargeGroup(t *testing.T) {
+	tmpDir := setupLargeGroup(t, 200)
+	statResolver := NewResolver(tmpDir)
+	listingResolver := NewResolverWithCache(tmpDir)
+
+	for _, path := range []string{"gallery", "gallery/photo_0001", "gallery/photo_0002.png", "gallery/photo_9999"} {
+		expected, err := statResolver.Resolve(path)
+		require.NoError(t, err)
+		actual, err := listingResolver.Resolve(path)
+		require.NoError(t, err)
+		assert.Equal(t, expected, actual, path)
+	}
+}
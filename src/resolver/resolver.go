@@ -1,34 +1,131 @@
 package resolver
 
 import (
-	"os"
+	"fmt"
+	"goimgserver/storage"
+	"log"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
+// sourceExtensions lists source image extensions in priority order.
+// HEIC/HEIF sources are always transcoded.
+var sourceExtensions = []string{".jpg", ".jpeg", ".png", ".webp", ".gif", ".heic", ".heif"}
+
+// DefaultMinSourceSize is the smallest source file, in bytes, that is not
+// treated as empty
+const DefaultMinSourceSize = 1
+
 // Resolver implements FileResolver interface
 type Resolver struct {
 	imageDir string
+	files    storage.FS
 	cache    *Cache
+	listings *listingCache
+	groups   *groupIndex
+
+	minSourceSize    int64
+	emptySourceError bool
+
+	caseInsensitive bool
+	canonical       *canonicalCache
 }
 
 // NewResolver creates a new file resolver
 func NewResolver(imageDir string) *Resolver {
 	return &Resolver{
-		imageDir: imageDir,
+		imageDir:      imageDir,
+		files:         storage.OS,
+		minSourceSize: DefaultMinSourceSize,
 	}
 }
 
 // NewResolverWithCache creates a new file resolver with caching enabled
 func NewResolverWithCache(imageDir string) *Resolver {
 	return &Resolver{
-		imageDir: imageDir,
-		cache:    NewCache(),
+		imageDir:      imageDir,
+		files:         storage.OS,
+		cache:         NewCache(),
+		listings:      newListingCache(storage.OS),
+		groups:        &groupIndex{},
+		minSourceSize: DefaultMinSourceSize,
+	}
+}
+
+// SetFallbackTTL limits how long resolutions that fell back to a default
+// image are cached (0 = as long as any other)
+func (r *Resolver) SetFallbackTTL(ttl time.Duration) {
+	if r.cache != nil {
+		r.cache.SetFallbackTTL(ttl)
+	}
+}
+
+// SetCacheLimit bounds the number of cached resolutions (0 = unlimited),
+// so paths requested once, such as scanner misses, cannot grow the cache
+// without limit; the least recently used are forgotten first
+func (r *Resolver) SetCacheLimit(n int) {
+	if r.cache != nil {
+		r.cache.SetMaxEntries(n)
+	}
+}
+
+// SetListingTTL sets how long a cached directory listing answers existence
+// checks without a stat of the directory (0 = stat on every resolution).
+// Files added or removed by other processes are seen once the TTL passes.
+func (r *Resolver) SetListingTTL(ttl time.Duration) {
+	if r.listings != nil {
+		r.listings.setTTL(ttl)
+	}
+	if r.groups != nil {
+		r.groups.setTTL(ttl)
+	}
+}
+
+// SetStorage sets where images are read from, e.g. an archive mounted at
+// the images directory with storage.Mount. Like the other settings it is
+// meant to be set before the resolver is used.
+func (r *Resolver) SetStorage(files storage.FS) {
+	r.files = files
+	if r.listings != nil {
+		r.listings.files = files
+	}
+	r.ClearCache()
+}
+
+// Storage returns where images are read from
+func (r *Resolver) Storage() storage.FS {
+	return r.files
+}
+
+// SetEmptySource sets the size below which source files are treated as
+// empty (0 = never) and whether resolving one is an error instead of a miss
+func (r *Resolver) SetEmptySource(minSize int64, asError bool) {
+	r.minSourceSize = minSize
+	r.emptySourceError = asError
+}
+
+// ClearCache forgets cached resolutions, directory listings and groups, so
+// paths that fell back to a default image resolve to files added since
+func (r *Resolver) ClearCache() {
+	if r.cache != nil {
+		r.cache.Clear()
+	}
+	if r.listings != nil {
+		r.listings.Clear()
+	}
+	if r.groups != nil {
+		r.groups.Clear()
+	}
+	if r.canonical != nil {
+		r.canonical.Clear()
 	}
 }
 
 // Resolve resolves a request path to an actual file path
 func (r *Resolver) Resolve(requestPath string) (*ResolutionResult, error) {
+	requestPath = normalizeRequestPath(requestPath)
+
 	// Check cache if available
 	if r.cache != nil {
 		if result, found := r.cache.Get(requestPath); found {
@@ -36,19 +133,21 @@ func (r *Resolver) Resolve(requestPath string) (*ResolutionResult, error) {
 		}
 	}
 	
-	// Extension priority order
-	extensions := []string{".jpg", ".jpeg", ".png", ".webp"}
+	s := r.newScan()
 	
 	// Sanitize and validate the request path
 	cleanPath, err := sanitizePath(requestPath, r.imageDir)
 	if err != nil {
 		// On security error, fall back to system default
-		result, sysErr := r.resolveSystemDefault()
+		result, sysErr := r.resolveSystemDefault(s)
 		if sysErr == nil && r.cache != nil {
 			r.cache.Set(requestPath, result)
 		}
 		return result, sysErr
 	}
+	if r.caseInsensitive {
+		cleanPath = r.canonicalPath(s, cleanPath)
+	}
 	
 	// Check if path has extension
 	ext := filepath.Ext(cleanPath)
@@ -61,10 +160,20 @@ func (r *Resolver) Resolve(requestPath string) (*ResolutionResult, error) {
 	if hasExtension {
 		// Direct path with extension
 		fullPath := filepath.Join(r.imageDir, cleanPath)
-		if fileExists(fullPath) {
+		if s.fileExists(fullPath) {
 			// Validate the resolved path (for symlinks)
 			if err := validateResolvedPath(fullPath, r.imageDir); err != nil {
-				result, fbErr := r.resolveFallback(cleanPath, isGrouped)
+				result, fbErr := r.resolveFallback(s, cleanPath, isGrouped)
+				if fbErr == nil && r.cache != nil {
+					r.cache.Set(requestPath, result)
+				}
+				return result, fbErr
+			}
+			if r.emptySource(fullPath) {
+				if r.emptySourceError {
+					return nil, fmt.Errorf("%w: %s", ErrEmptySource, cleanPath)
+				}
+				result, fbErr := r.resolveFallback(s, cleanPath, isGrouped)
 				if fbErr == nil && r.cache != nil {
 					r.cache.Set(requestPath, result)
 				}
@@ -82,7 +191,7 @@ func (r *Resolver) Resolve(requestPath string) (*ResolutionResult, error) {
 		}
 		
 		// If file doesn't exist, try fallback
-		result, err := r.resolveFallback(cleanPath, isGrouped)
+		result, err := r.resolveFallback(s, cleanPath, isGrouped)
 		if err == nil && r.cache != nil {
 			r.cache.Set(requestPath, result)
 		}
@@ -94,11 +203,17 @@ func (r *Resolver) Resolve(requestPath string) (*ResolutionResult, error) {
 	
 	// Check if this might be a group (directory exists)
 	groupPath := filepath.Join(r.imageDir, basePath)
-	if dirExists(groupPath) {
+	if s.dirExists(groupPath) {
 		// Try to resolve group default
-		for _, ext := range extensions {
+		for _, ext := range sourceExtensions {
 			defaultPath := filepath.Join(groupPath, "default"+ext)
-			if fileExists(defaultPath) {
+			if s.fileExists(defaultPath) {
+				if r.emptySource(defaultPath) {
+					if r.emptySourceError {
+						return nil, fmt.Errorf("%w: %s", ErrEmptySource, cleanPath)
+					}
+					continue
+				}
 				result := &ResolutionResult{
 					ResolvedPath: defaultPath,
 					IsGrouped:    true,
@@ -111,7 +226,7 @@ func (r *Resolver) Resolve(requestPath string) (*ResolutionResult, error) {
 			}
 		}
 		// Group exists but no default found - fallback to system default
-		result, err := r.resolveSystemDefault()
+		result, err := r.resolveSystemDefault(s)
 		if err == nil && r.cache != nil {
 			r.cache.Set(requestPath, result)
 		}
@@ -119,13 +234,19 @@ func (r *Resolver) Resolve(requestPath string) (*ResolutionResult, error) {
 	}
 	
 	// Try to find file with extension priority
-	for _, ext := range extensions {
+	for _, ext := range sourceExtensions {
 		testPath := filepath.Join(r.imageDir, basePath+ext)
-		if fileExists(testPath) {
+		if s.fileExists(testPath) {
 			// Validate the resolved path (for symlinks)
 			if err := validateResolvedPath(testPath, r.imageDir); err != nil {
 				continue
 			}
+			if r.emptySource(testPath) {
+				if r.emptySourceError {
+					return nil, fmt.Errorf("%w: %s", ErrEmptySource, cleanPath)
+				}
+				continue
+			}
 			result := &ResolutionResult{
 				ResolvedPath: testPath,
 				IsGrouped:    isGrouped,
@@ -139,7 +260,7 @@ func (r *Resolver) Resolve(requestPath string) (*ResolutionResult, error) {
 	}
 	
 	// Not found - try fallback
-	result, err := r.resolveFallback(basePath, isGrouped)
+	result, err := r.resolveFallback(s, basePath, isGrouped)
 	if err == nil && r.cache != nil {
 		r.cache.Set(requestPath, result)
 	}
@@ -147,7 +268,7 @@ func (r *Resolver) Resolve(requestPath string) (*ResolutionResult, error) {
 }
 
 // resolveFallback handles fallback resolution
-func (r *Resolver) resolveFallback(requestPath string, isGrouped bool) (*ResolutionResult, error) {
+func (r *Resolver) resolveFallback(s *scan, requestPath string, isGrouped bool) (*ResolutionResult, error) {
 	extensions := []string{".jpg", ".jpeg", ".png", ".webp"}
 	
 	// If grouped, try group default first
@@ -160,7 +281,7 @@ func (r *Resolver) resolveFallback(requestPath string, isGrouped bool) (*Resolut
 			// Try group default
 			for _, ext := range extensions {
 				defaultPath := filepath.Join(groupPath, "default"+ext)
-				if fileExists(defaultPath) {
+				if s.fileExists(defaultPath) {
 					return &ResolutionResult{
 						ResolvedPath: defaultPath,
 						IsGrouped:    true,
@@ -173,16 +294,16 @@ func (r *Resolver) resolveFallback(requestPath string, isGrouped bool) (*Resolut
 	}
 	
 	// Fall back to system default
-	return r.resolveSystemDefault()
+	return r.resolveSystemDefault(s)
 }
 
 // resolveSystemDefault resolves to the system default image
-func (r *Resolver) resolveSystemDefault() (*ResolutionResult, error) {
+func (r *Resolver) resolveSystemDefault(s *scan) (*ResolutionResult, error) {
 	extensions := []string{".jpg", ".jpeg", ".png", ".webp"}
 	
 	for _, ext := range extensions {
 		defaultPath := filepath.Join(r.imageDir, "default"+ext)
-		if fileExists(defaultPath) {
+		if s.fileExists(defaultPath) {
 			return &ResolutionResult{
 				ResolvedPath: defaultPath,
 				IsGrouped:    false,
@@ -195,6 +316,11 @@ func (r *Resolver) resolveSystemDefault() (*ResolutionResult, error) {
 	return nil, ErrFileNotFound
 }
 
+// ResolveDefault resolves the system default image
+func (r *Resolver) ResolveDefault() (*ResolutionResult, error) {
+	return r.resolveSystemDefault(r.newScan())
+}
+
 // ResolveWithDefault resolves with a specific default path
 func (r *Resolver) ResolveWithDefault(requestPath string, defaultPath string) (*ResolutionResult, error) {
 	result, err := r.Resolve(requestPath)
@@ -203,7 +329,7 @@ func (r *Resolver) ResolveWithDefault(requestPath string, defaultPath string) (*
 	}
 	
 	// Use provided default
-	if fileExists(defaultPath) {
+	if fileExists(r.files, defaultPath) {
 		return &ResolutionResult{
 			ResolvedPath: defaultPath,
 			IsGrouped:    false,
@@ -215,9 +341,23 @@ func (r *Resolver) ResolveWithDefault(requestPath string, defaultPath string) (*
 	return nil, ErrFileNotFound
 }
 
+// emptySource reports whether the file at path is smaller than the minimum
+// source size. Empty sources are logged so broken uploads can be found.
+func (r *Resolver) emptySource(path string) bool {
+	if r.minSourceSize <= 0 {
+		return false
+	}
+	info, err := r.files.Stat(path)
+	if err != nil || info.Size() >= r.minSourceSize {
+		return false
+	}
+	log.Printf("Warning: source image %s is %d bytes, below the minimum of %d; treating it as empty", path, info.Size(), r.minSourceSize)
+	return true
+}
+
 // fileExists checks if a file exists
-func fileExists(path string) bool {
-	info, err := os.Stat(path)
+func fileExists(files storage.FS, path string) bool {
+	info, err := files.Stat(path)
 	if err != nil {
 		return false
 	}
@@ -225,8 +365,8 @@ func fileExists(path string) bool {
 }
 
 // dirExists checks if a directory exists
-func dirExists(path string) bool {
-	info, err := os.Stat(path)
+func dirExists(files storage.FS, path string) bool {
+	info, err := files.Stat(path)
 	if err != nil {
 		return false
 	}
@@ -188,6 +188,18 @@ func TestFileResolver_ResolveSingle_MultipleExtensions(t *testing.T) {
 			requestPath:  "test",
 			expectedFile: "test.webp",
 		},
+		{
+			name:         "webp wins over heic",
+			createFiles:  []string{"test.webp", "test.heic"},
+			requestPath:  "test",
+			expectedFile: "test.webp",
+		},
+		{
+			name:         "heic when others missing",
+			createFiles:  []string{"test.heic"},
+			requestPath:  "test",
+			expectedFile: "test.heic",
+		},
 		{
 			name:         "jpeg same priority as jpg",
 			createFiles:  []string{"test.jpeg", "test.png"},
@@ -391,3 +403,47 @@ func TestFileResolver_ResolveWithDefault(t *testing.T) {
 		})
 	}
 }
+
+// TestFileResolver_Resolve_EmptySource tests that empty source files are
+// treated as missing by default and as an error when configured
+func TestFileResolver_Resolve_EmptySource(t *testing.T) {
+	tmpDir := setupTestDir(t)
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "blank.jpg"), nil, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "cats", "blank.jpg"), nil, 0644))
+	// An empty profile.jpg gives way to profile.png
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "profile.jpg"), nil, 0644))
+
+	resolver := NewResolver(tmpDir)
+	tests := []struct {
+		requestPath  string
+		expectPath   string
+		fallbackType string
+	}{
+		{"blank.jpg", filepath.Join(tmpDir, "default.jpg"), "system_default"},
+		{"blank", filepath.Join(tmpDir, "default.jpg"), "system_default"},
+		{"cats/blank.jpg", filepath.Join(tmpDir, "cats", "default.jpg"), "group_default"},
+		{"profile", filepath.Join(tmpDir, "profile.png"), ""},
+	}
+	for _, tt := range tests {
+		result, err := resolver.Resolve(tt.requestPath)
+		require.NoError(t, err, tt.requestPath)
+		assert.Equal(t, tt.expectPath, result.ResolvedPath, tt.requestPath)
+		assert.Equal(t, tt.fallbackType, result.FallbackType, tt.requestPath)
+	}
+
+	resolver.SetEmptySource(DefaultMinSourceSize, true)
+	for _, requestPath := range []string{"blank.jpg", "blank", "cats/blank.jpg", "profile"} {
+		_, err := resolver.Resolve(requestPath)
+		assert.ErrorIs(t, err, ErrEmptySource, requestPath)
+	}
+
+	// Files below a larger minimum size are empty too; 0 turns detection off
+	resolver.SetEmptySource(64, false)
+	result, err := resolver.Resolve("cat.jpg")
+	require.NoError(t, err)
+	assert.True(t, result.IsFallback)
+	resolver.SetEmptySource(0, true)
+	result, err = resolver.Resolve("blank.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(tmpDir, "blank.jpg"), result.ResolvedPath)
+}
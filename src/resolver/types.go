@@ -1,6 +1,9 @@
 package resolver
 
-import "errors"
+import (
+	"errors"
+	"goimgserver/storage"
+)
 
 // ResolutionResult represents the result of file resolution
 type ResolutionResult struct {
@@ -14,6 +17,33 @@ type ResolutionResult struct {
 type FileResolver interface {
 	Resolve(requestPath string) (*ResolutionResult, error)
 	ResolveWithDefault(requestPath string, defaultPath string) (*ResolutionResult, error)
+	ResolveDefault() (*ResolutionResult, error)
+	ListGroup(group string) ([]string, error)
+	ListGroups() ([]Group, error)
+}
+
+// Group is an image group directory found by ListGroups
+type Group struct {
+	Path       string   // Relative to the images directory, slash separated
+	Images     []string // Image file names, as ListGroup lists them
+	HasDefault bool     // Whether the group has its own default image
+}
+
+// CachingResolver is a FileResolver that caches resolutions
+type CachingResolver interface {
+	FileResolver
+
+	// ClearCache forgets cached resolutions once images are added or replaced
+	ClearCache()
+}
+
+// StorageResolver is a FileResolver that reports where the files it
+// resolves are read from
+type StorageResolver interface {
+	FileResolver
+
+	// Storage returns where resolved paths are read from
+	Storage() storage.FS
 }
 
 // Common errors
@@ -22,4 +52,5 @@ var (
 	ErrPathTraversal   = errors.New("path traversal attempt detected")
 	ErrOutsideImageDir = errors.New("resolved path is outside image directory")
 	ErrFileNotFound    = errors.New("file not found")
+	ErrEmptySource     = errors.New("source file is empty")
 )
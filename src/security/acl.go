@@ -0,0 +1,66 @@
+package security
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// PathACL decides which image paths may be served publicly
+type PathACL struct {
+	allow []string
+	deny  []string
+}
+
+// NewPathACL creates a PathACL from allowed and denied path prefixes.
+// An empty allow list allows every path that is not denied.
+func NewPathACL(allow, deny []string) *PathACL {
+	return &PathACL{
+		allow: normalizePrefixes(allow),
+		deny:  normalizePrefixes(deny),
+	}
+}
+
+// Allowed reports whether a path relative to the images directory may be
+// served. Denied prefixes win over allowed ones. Prefixes match whole path
+// segments, so "internal" matches "internal/a.jpg" but not "internals/a.jpg".
+func (a *PathACL) Allowed(relPath string) bool {
+	relPath = strings.Trim(filepath.ToSlash(filepath.Clean(relPath)), "/")
+
+	for _, prefix := range a.deny {
+		if hasPathPrefix(relPath, prefix) {
+			return false
+		}
+	}
+
+	if len(a.allow) == 0 {
+		return true
+	}
+	for _, prefix := range a.allow {
+		if hasPathPrefix(relPath, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Empty reports whether the ACL allows every path
+func (a *PathACL) Empty() bool {
+	return len(a.allow) == 0 && len(a.deny) == 0
+}
+
+// hasPathPrefix reports whether path is prefix or lies below it
+func hasPathPrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// normalizePrefixes trims slashes and drops empty prefixes
+func normalizePrefixes(prefixes []string) []string {
+	var normalized []string
+	for _, prefix := range prefixes {
+		prefix = strings.Trim(filepath.ToSlash(strings.TrimSpace(prefix)), "/")
+		if prefix != "" {
+			normalized = append(normalized, prefix)
+		}
+	}
+	return normalized
+}
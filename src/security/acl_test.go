@@ -0,0 +1,43 @@
+package security
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPathACL_Allowed tests allow and deny prefix matching
+func TestPathACL_Allowed(t *testing.T) {
+	tests := []struct {
+		name     string
+		allow    []string
+		deny     []string
+		path     string
+		expected bool
+	}{
+		{"empty allows everything", nil, nil, "internal/a.jpg", true},
+		{"denied prefix", nil, []string{"internal"}, "internal/a.jpg", false},
+		{"denied nested prefix", nil, []string{"internal"}, "internal/reports/a.jpg", false},
+		{"denied sibling allowed", nil, []string{"internal"}, "cats/a.jpg", true},
+		{"segment boundary", nil, []string{"internal"}, "internals/a.jpg", true},
+		{"denied single file", nil, []string{"secret.jpg"}, "secret.jpg", false},
+		{"slashes trimmed", nil, []string{"/internal/"}, "internal/a.jpg", false},
+		{"allowed prefix", []string{"public"}, nil, "public/a.jpg", true},
+		{"outside allow list", []string{"public"}, nil, "cats/a.jpg", false},
+		{"deny wins over allow", []string{"public"}, []string{"public/drafts"}, "public/drafts/a.jpg", false},
+		{"dot segments cleaned", nil, []string{"internal"}, "cats/../internal/a.jpg", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			acl := NewPathACL(tt.allow, tt.deny)
+
+			// Act
+			allowed := acl.Allowed(tt.path)
+
+			// Assert
+			assert.Equal(t, tt.expected, allowed)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package security
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/hex"
 	"net/http"
@@ -12,6 +13,23 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// IdentityKey is the gin context key under which the auth middlewares store
+// the identity of an authenticated caller
+const IdentityKey = "auth_identity"
+
+// credentialIdentity names a caller by a short fingerprint of its
+// credential, so logs can tell callers apart without recording secrets
+func credentialIdentity(kind, secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return kind + ":" + hex.EncodeToString(sum[:])[:12]
+}
+
+// Identity returns the identity the auth middleware stored for the request,
+// or "" when it was not authenticated
+func Identity(c *gin.Context) string {
+	return c.GetString(IdentityKey)
+}
+
 // TokenAuthenticator handles token-based authentication
 type TokenAuthenticator struct {
 	validTokens map[string]bool
@@ -117,6 +135,7 @@ func TokenAuthMiddleware(auth interface{}) gin.HandlerFunc {
 			return
 		}
 
+		c.Set(IdentityKey, credentialIdentity("token", token))
 		c.Next()
 	}
 }
@@ -219,6 +238,7 @@ func APIKeyAuthMiddleware(auth *APIKeyAuthenticator) gin.HandlerFunc {
 			return
 		}
 
+		c.Set(IdentityKey, credentialIdentity("key", apiKey))
 		c.Next()
 	}
 }
@@ -3,6 +3,7 @@ package security
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -160,6 +161,32 @@ func TestAuthentication_APIKey_Validation(t *testing.T) {
 	}
 }
 
+// TestAuthentication_APIKey_Identity tests that an authenticated caller is
+// identified by a fingerprint of its key rather than the key itself
+func TestAuthentication_APIKey_Identity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	auth := NewAPIKeyAuthenticator([]string{"first-key-12345", "second-key-12345"})
+	router := gin.New()
+	router.Use(APIKeyAuthMiddleware(auth))
+	router.GET("/whoami", func(c *gin.Context) {
+		c.String(http.StatusOK, Identity(c))
+	})
+
+	identities := map[string]bool{}
+	for _, key := range []string{"first-key-12345", "second-key-12345", "first-key-12345"} {
+		req := httptest.NewRequest("GET", "/whoami", nil)
+		req.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.True(t, strings.HasPrefix(w.Body.String(), "key:"), w.Body.String())
+		assert.NotContains(t, w.Body.String(), key)
+		identities[w.Body.String()] = true
+	}
+	assert.Len(t, identities, 2, "each key should have one identity")
+}
+
 // TestAuthentication_APIKey_Storage tests secure key storage
 func TestAuthentication_APIKey_Storage(t *testing.T) {
 	auth := NewAPIKeyAuthenticator([]string{})
@@ -53,31 +53,158 @@ func (m *MemoryLimiter) Release(amount int64) {
 	m.current.Add(-amount)
 }
 
-// TimeoutMiddleware creates middleware that enforces request timeouts
+// TimeoutMiddleware creates middleware that enforces request timeouts.
+// The request context is cancelled at the deadline so handlers can stop
+// early; anything they write afterwards is discarded in favour of the
+// timeout response. A zero timeout disables the limit.
 func TimeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
 		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
 		defer cancel()
 
 		c.Request = c.Request.WithContext(ctx)
+		writer := &timeoutWriter{ResponseWriter: c.Writer, header: c.Writer.Header().Clone(), status: http.StatusOK}
+		c.Writer = writer
 
 		finished := make(chan struct{})
+		panicked := make(chan interface{}, 1)
 		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+				}
+				close(finished)
+			}()
 			c.Next()
-			close(finished)
 		}()
 
 		select {
 		case <-finished:
 			// Request completed in time
 		case <-ctx.Done():
-			// Timeout occurred
-			c.AbortWithStatusJSON(http.StatusRequestTimeout, gin.H{
-				"error": "Request timeout",
-				"code":  "TIMEOUT",
-			})
+			// Timeout occurred: answer now, then wait for the handler
+			// since the gin context is reused once this returns
+			writer.timeout()
+			<-finished
 		}
+
+		c.Writer = writer.ResponseWriter
+		select {
+		case p := <-panicked:
+			panic(p)
+		default:
+		}
+		if writer.timedOut {
+			c.Abort()
+		}
+	}
+}
+
+// timeoutWriter guards a response shared by a handler goroutine and
+// TimeoutMiddleware. The handler gets its own header map, which is copied
+// to the response on its first write.
+type timeoutWriter struct {
+	gin.ResponseWriter
+	mu       sync.Mutex
+	header   http.Header
+	status   int
+	timedOut bool
+}
+
+// timeout sends the timeout response unless the handler already wrote one
+func (w *timeoutWriter) timeout() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.timedOut = true
+	if w.ResponseWriter.Written() {
+		return
 	}
+	w.ResponseWriter.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.ResponseWriter.WriteHeader(http.StatusRequestTimeout)
+	w.ResponseWriter.WriteString(`{"code":"TIMEOUT","error":"Request timeout"}`)
+}
+
+// commit writes the handler's status and headers before its first body write
+func (w *timeoutWriter) commit() {
+	if w.ResponseWriter.Written() {
+		return
+	}
+	header := w.ResponseWriter.Header()
+	for key, values := range w.header {
+		header[key] = values
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.timedOut && !w.ResponseWriter.Written() {
+		w.status = code
+	}
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.timedOut {
+		w.commit()
+	}
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	w.commit()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *timeoutWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.timedOut {
+		w.commit()
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *timeoutWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut || w.ResponseWriter.Written() {
+		return w.ResponseWriter.Status()
+	}
+	return w.status
+}
+
+func (w *timeoutWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Size()
+}
+
+func (w *timeoutWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Written()
 }
 
 // ConcurrencyLimiter creates middleware that limits concurrent requests
@@ -152,7 +279,8 @@ func (m *DiskSpaceMonitor) IsThresholdExceeded() bool {
 	return usage.Used > m.threshold
 }
 
-// RequestSizeLimiter creates middleware that limits request body size
+// RequestSizeLimiter creates middleware that limits request body size.
+// Bodies without a declared length are cut off while being read.
 func RequestSizeLimiter(maxSize int64) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if c.Request.ContentLength > maxSize {
@@ -163,6 +291,7 @@ func RequestSizeLimiter(maxSize int64) gin.HandlerFunc {
 			})
 			return
 		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize)
 		c.Next()
 	}
 }
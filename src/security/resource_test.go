@@ -82,6 +82,49 @@ func TestResourceProtection_ProcessingTimeouts_Operations(t *testing.T) {
 	assert.Equal(t, http.StatusRequestTimeout, w2.Code, "Slow request should timeout")
 }
 
+// TestResourceProtection_ProcessingTimeouts_PerGroup tests that each route
+// group enforces its own timeout and that handlers see the cancellation
+func TestResourceProtection_ProcessingTimeouts_PerGroup(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	var cancelled atomic.Int32
+	work := func(c *gin.Context) {
+		select {
+		case <-time.After(100 * time.Millisecond):
+			c.Header("X-Work", "done")
+			c.JSON(http.StatusOK, gin.H{"message": "done"})
+		case <-c.Request.Context().Done():
+			cancelled.Add(1)
+		}
+	}
+
+	health := router.Group("/health", TimeoutMiddleware(20*time.Millisecond))
+	health.GET("/work", work)
+	images := router.Group("/img", TimeoutMiddleware(2*time.Second))
+	images.GET("/work", work)
+	unlimited := router.Group("/cmd", TimeoutMiddleware(0))
+	unlimited.GET("/work", work)
+
+	// The short health timeout fires
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/health/work", nil))
+	assert.Equal(t, http.StatusRequestTimeout, w.Code)
+	assert.JSONEq(t, `{"error":"Request timeout","code":"TIMEOUT"}`, w.Body.String())
+	assert.Empty(t, w.Header().Get("X-Work"))
+	assert.Equal(t, int32(1), cancelled.Load())
+
+	// The same work fits in the longer image timeout and without a limit
+	for _, path := range []string{"/img/work", "/cmd/work"} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		assert.Equal(t, "done", w.Header().Get("X-Work"), path)
+		assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"), path)
+	}
+	assert.Equal(t, int32(1), cancelled.Load())
+}
+
 // TestResourceProtection_ConcurrentLimits_Requests tests concurrent request limits
 func TestResourceProtection_ConcurrentLimits_Requests(t *testing.T) {
 	gin.SetMode(gin.TestMode)
@@ -0,0 +1,55 @@
+package security
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignURL(t *testing.T) {
+	// Arrange
+	query := url.Values{"title": {"Hello world"}, "size": {"64"}}
+	signature := SignURL("secret", "photo.jpg", query)
+
+	// Act & Assert: the signature is the HMAC of the canonical form
+	assert.Len(t, signature, 64)
+	assert.Equal(t, "photo.jpg?size=64&title=Hello+world", signedMessage("photo.jpg", query))
+
+	signed := url.Values{"size": {"64"}, "title": {"Hello world"}, SignatureParam: {signature}}
+	assert.True(t, ValidURLSignature("secret", "photo.jpg", signed))
+	assert.Equal(t, signature, SignURL("secret", "photo.jpg", signed), "the signature is not signed")
+}
+
+func TestValidURLSignature_Rejects(t *testing.T) {
+	query := url.Values{"title": {"Hello"}}
+	signature := SignURL("secret", "photo.jpg", query)
+	withSignature := func(values url.Values, signature ...string) url.Values {
+		signed := url.Values{SignatureParam: signature}
+		for name, v := range values {
+			signed[name] = v
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		path   string
+		query  url.Values
+	}{
+		{"Other secret", "other", "photo.jpg", withSignature(query, signature)},
+		{"Other path", "secret", "other.jpg", withSignature(query, signature)},
+		{"Other text", "secret", "photo.jpg", withSignature(url.Values{"title": {"Hello!"}}, signature)},
+		{"Added parameter", "secret", "photo.jpg", withSignature(url.Values{"title": {"Hello"}, "size": {"200"}}, signature)},
+		{"Missing signature", "secret", "photo.jpg", query},
+		{"Malformed signature", "secret", "photo.jpg", withSignature(query, "zz")},
+		{"Two signatures", "secret", "photo.jpg", withSignature(query, signature, signature)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.False(t, ValidURLSignature(tt.secret, tt.path, tt.query))
+		})
+	}
+}
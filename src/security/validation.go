@@ -261,6 +261,11 @@ func ValidateFileType(data []byte) (string, error) {
 		return "webp", nil
 	}
 
+	// Check GIF (GIF87a or GIF89a)
+	if string(data[:6]) == "GIF87a" || string(data[:6]) == "GIF89a" {
+		return "gif", nil
+	}
+
 	return "", fmt.Errorf("%w: unrecognized file signature", ErrInvalidFileType)
 }
 
@@ -464,6 +464,12 @@ func TestInputValidation_FileTypeValidation_MagicNumbers(t *testing.T) {
 			expectValid: true,
 			expectType:  "webp",
 		},
+		{
+			name:        "valid_gif",
+			data:        []byte("GIF89a\x14\x00\x14\x00"),
+			expectValid: true,
+			expectType:  "gif",
+		},
 		{
 			name:        "invalid_magic_number",
 			data:        []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
@@ -0,0 +1,159 @@
+// Package selftest checks that image processing and the cache work before
+// the server goes live.
+package selftest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"goimgserver/cache"
+	"goimgserver/processor"
+	"goimgserver/security"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+
+	_ "golang.org/x/image/webp"
+)
+
+// sourceWidth and sourceHeight size the generated test image
+const (
+	sourceWidth  = 64
+	sourceHeight = 48
+)
+
+// cachePath is the source path the cache check stores its entry under
+const cachePath = "_selftest/probe.png"
+
+// Formats are the output formats the processing check produces
+var Formats = []processor.ImageFormat{processor.FormatJPEG, processor.FormatPNG, processor.FormatWebP}
+
+// Sizes are the output sizes the processing check produces. A zero height
+// keeps the aspect ratio.
+var Sizes = []image.Point{{X: 32, Y: 24}, {X: 16, Y: 0}}
+
+// Result is the outcome of checking one subsystem
+type Result struct {
+	Subsystem string
+	Err       error
+}
+
+// Run generates a test image, processes it into every format and size, and
+// stores and retrieves it in the cache under cacheDir. It writes a PASS or
+// FAIL line per subsystem to w and returns an error if any check failed.
+func Run(w io.Writer, cacheDir string, proc processor.ImageProcessor) error {
+	source, err := generateImage()
+	results := []Result{{Subsystem: "image generation", Err: err}}
+	if err == nil {
+		results = append(results,
+			Result{Subsystem: "processing", Err: checkProcessing(proc, source)},
+			Result{Subsystem: "cache", Err: checkCache(cacheDir, source)},
+		)
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			fmt.Fprintf(w, "FAIL  %s: %v\n", result.Subsystem, result.Err)
+		} else {
+			fmt.Fprintf(w, "PASS  %s\n", result.Subsystem)
+		}
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(w, "Self-test failed: %d of %d checks\n", failed, len(results))
+		return fmt.Errorf("self-test failed: %d of %d checks", failed, len(results))
+	}
+	fmt.Fprintln(w, "Self-test passed")
+	return nil
+}
+
+// generateImage encodes a gradient as PNG
+func generateImage() ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, sourceWidth, sourceHeight))
+	for y := 0; y < sourceHeight; y++ {
+		for x := 0; x < sourceWidth; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 4), uint8(y * 5), 128, 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// checkProcessing produces every format and size and checks each output
+// has the requested format and dimensions
+func checkProcessing(proc processor.ImageProcessor, source []byte) error {
+	if err := proc.ValidateImage(source); err != nil {
+		return fmt.Errorf("test image rejected: %w", err)
+	}
+
+	var errs []error
+	for _, format := range Formats {
+		for _, size := range Sizes {
+			opts := processor.ProcessOptions{Width: size.X, Height: size.Y, Format: format, Quality: processor.DefaultQuality}
+			if err := checkOutput(proc, source, opts); err != nil {
+				errs = append(errs, fmt.Errorf("%s %dx%d: %w", format, size.X, size.Y, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkOutput processes source with opts and verifies the result
+func checkOutput(proc processor.ImageProcessor, source []byte, opts processor.ProcessOptions) error {
+	output, err := proc.Process(source, opts)
+	if err != nil {
+		return err
+	}
+
+	format, err := security.ValidateFileType(output)
+	if err != nil {
+		return err
+	}
+	if format != string(opts.Format) {
+		return fmt.Errorf("produced %s", format)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(output))
+	if err != nil {
+		return err
+	}
+	height := opts.Height
+	if height == 0 {
+		height = opts.Width * sourceHeight / sourceWidth
+	}
+	if cfg.Width != opts.Width || cfg.Height != height {
+		return fmt.Errorf("produced %dx%d", cfg.Width, cfg.Height)
+	}
+	return nil
+}
+
+// checkCache stores data in the cache, reads it back and removes it again
+func checkCache(cacheDir string, data []byte) error {
+	manager, err := cache.NewManager(cacheDir)
+	if err != nil {
+		return err
+	}
+
+	params := cache.ProcessingParams{Width: sourceWidth, Height: sourceHeight, Format: "png", Quality: processor.DefaultQuality}
+	if err := manager.Store(cachePath, params, data); err != nil {
+		return err
+	}
+	defer manager.Clear(cachePath)
+
+	cached, found, err := manager.Retrieve(cachePath, params)
+	if err != nil {
+		return err
+	}
+	if !found || !bytes.Equal(cached, data) {
+		return errors.New("stored entry was not returned unchanged")
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package selftest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"goimgserver/processor"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProcessor encodes a blank image of the requested size and format
+type fakeProcessor struct {
+	failFormat processor.ImageFormat
+}
+
+func (f *fakeProcessor) Resize(data []byte, width, height int) ([]byte, error) {
+	return data, nil
+}
+
+func (f *fakeProcessor) ConvertFormat(data []byte, format processor.ImageFormat) ([]byte, error) {
+	return data, nil
+}
+
+func (f *fakeProcessor) AdjustQuality(data []byte, quality int) ([]byte, error) {
+	return data, nil
+}
+
+func (f *fakeProcessor) Process(data []byte, opts processor.ProcessOptions) ([]byte, error) {
+	if opts.Format == f.failFormat {
+		return nil, errors.New("encoder unavailable")
+	}
+
+	height := opts.Height
+	if height == 0 {
+		height = opts.Width * sourceHeight / sourceWidth
+	}
+	img := image.NewRGBA(image.Rect(0, 0, opts.Width, height))
+
+	var buf bytes.Buffer
+	switch opts.Format {
+	case processor.FormatJPEG:
+		err := jpeg.Encode(&buf, img, nil)
+		return buf.Bytes(), err
+	case processor.FormatPNG:
+		err := png.Encode(&buf, img)
+		return buf.Bytes(), err
+	default:
+		return webpHeader(opts.Width, height), nil
+	}
+}
+
+func (f *fakeProcessor) ValidateImage(data []byte) error {
+	return nil
+}
+
+// webpHeader builds a lossless WebP header that image.DecodeConfig accepts
+func webpHeader(width, height int) []byte {
+	bits := uint32(width-1) | uint32(height-1)<<14
+	chunk := []byte{0x2f, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(chunk[1:], bits)
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(4+8+len(chunk)+1))
+	buf.WriteString("WEBPVP8L")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(chunk)))
+	buf.Write(chunk)
+	buf.WriteByte(0)
+	return buf.Bytes()
+}
+
+func TestRun_AllChecksPass(t *testing.T) {
+	// Arrange
+	cacheDir := t.TempDir()
+	var out bytes.Buffer
+
+	// Act
+	err := Run(&out, cacheDir, &fakeProcessor{})
+
+	// Assert
+	require.NoError(t, err, out.String())
+	assert.Contains(t, out.String(), "PASS  image generation")
+	assert.Contains(t, out.String(), "PASS  processing")
+	assert.Contains(t, out.String(), "PASS  cache")
+	assert.Contains(t, out.String(), "Self-test passed")
+
+	entries, err := os.ReadDir(filepath.Join(cacheDir, "_selftest"))
+	if err == nil {
+		assert.Empty(t, entries, "self-test entry should be cleared")
+	}
+}
+
+func TestRun_ProcessingFailure(t *testing.T) {
+	// Arrange
+	var out bytes.Buffer
+
+	// Act
+	err := Run(&out, t.TempDir(), &fakeProcessor{failFormat: processor.FormatWebP})
+
+	// Assert
+	require.Error(t, err)
+	assert.Contains(t, out.String(), "FAIL  processing")
+	assert.Contains(t, out.String(), "webp 32x24: encoder unavailable")
+	assert.Contains(t, out.String(), "PASS  cache")
+	assert.Contains(t, out.String(), "Self-test failed: 1 of 3 checks")
+}
+
+func TestRun_CacheFailure(t *testing.T) {
+	// Arrange
+	blocker := filepath.Join(t.TempDir(), "cache")
+	require.NoError(t, os.WriteFile(blocker, []byte("not a directory"), 0644))
+	var out bytes.Buffer
+
+	// Act
+	err := Run(&out, blocker, &fakeProcessor{})
+
+	// Assert
+	require.Error(t, err)
+	assert.Contains(t, out.String(), "PASS  processing")
+	assert.Contains(t, out.String(), "FAIL  cache")
+}
@@ -38,28 +38,30 @@ func main() {
 		return true
 	})
 	
-	// Register routes
-	srv.Router.GET("/", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"message": "Welcome to goimgserver!",
+	// Register demo routes; production servers only serve health checks
+	if !config.Production {
+		srv.Router.GET("/", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{
+				"message": "Welcome to goimgserver!",
+			})
 		})
-	})
 	
-	srv.Router.GET("/api/status", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status": "running",
-			"features": []string{
-				"CORS enabled",
-				"Rate limiting enabled",
-				"Security headers",
-				"Request ID tracking",
-				"Structured logging",
-				"Error handling",
-				"Health checks",
-				"Graceful shutdown",
-			},
+		srv.Router.GET("/api/status", func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{
+				"status": "running",
+				"features": []string{
+					"CORS enabled",
+					"Rate limiting enabled",
+					"Security headers",
+					"Request ID tracking",
+					"Structured logging",
+					"Error handling",
+					"Health checks",
+					"Graceful shutdown",
+				},
+			})
 		})
-	})
+	}
 	
 	log.Println("Starting server with enhanced middleware...")
 	log.Println("Visit http://localhost:8080/ for home")
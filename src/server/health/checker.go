@@ -13,16 +13,18 @@ type HealthCheck func() bool
 
 // Checker manages health checks for the application
 type Checker struct {
-	checks    map[string]HealthCheck
-	startTime time.Time
-	mu        sync.RWMutex
+	checks      map[string]HealthCheck
+	nonCritical map[string]bool // Checks whose failure still serves traffic
+	startTime   time.Time
+	mu          sync.RWMutex
 }
 
 // NewChecker creates a new health checker
 func NewChecker() *Checker {
 	return &Checker{
-		checks:    make(map[string]HealthCheck),
-		startTime: time.Now(),
+		checks:      make(map[string]HealthCheck),
+		nonCritical: make(map[string]bool),
+		startTime:   time.Now(),
 	}
 }
 
@@ -31,6 +33,17 @@ func (c *Checker) AddCheck(name string, check HealthCheck) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.checks[name] = check
+	delete(c.nonCritical, name)
+}
+
+// AddNonCriticalCheck registers a check for a component the application can
+// run without. Its failure reports the status as degraded but keeps /health
+// at 200 and the application ready.
+func (c *Checker) AddNonCriticalCheck(name string, check HealthCheck) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+	c.nonCritical[name] = true
 }
 
 // HealthHandler returns a simple health check endpoint
@@ -47,12 +60,17 @@ func (c *Checker) DetailedHealthHandler(ctx *gin.Context) {
 	
 	checkResults := make(map[string]string)
 	allHealthy := true
+	degraded := false
 	
 	// Run all health checks
 	for name, check := range c.checks {
-		if check() {
+		switch {
+		case check():
 			checkResults[name] = "ok"
-		} else {
+		case c.nonCritical[name]:
+			checkResults[name] = "degraded"
+			degraded = true
+		default:
 			checkResults[name] = "failed"
 			allHealthy = false
 		}
@@ -66,6 +84,8 @@ func (c *Checker) DetailedHealthHandler(ctx *gin.Context) {
 	if !allHealthy {
 		status = "degraded"
 		statusCode = http.StatusServiceUnavailable
+	} else if degraded {
+		status = "degraded"
 	}
 	
 	response := gin.H{
@@ -86,9 +106,9 @@ func (c *Checker) ReadinessHandler(ctx *gin.Context) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	
-	// Check if all dependencies are healthy
-	for _, check := range c.checks {
-		if !check() {
+	// Check if all critical dependencies are healthy
+	for name, check := range c.checks {
+		if !c.nonCritical[name] && !check() {
 			ctx.JSON(http.StatusServiceUnavailable, gin.H{
 				"status": "not ready",
 			})
@@ -184,3 +184,37 @@ func TestHealthCheck_LivenessEndpoint(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "alive", response["status"])
 }
+
+func TestHealthCheck_NonCriticalFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	
+	checker := NewChecker()
+	checker.AddCheck("filesystem", func() bool { return true })
+	checker.AddNonCriticalCheck("cache_writes", func() bool { return false })
+	router.GET("/health", checker.DetailedHealthHandler)
+	router.GET("/ready", checker.ReadinessHandler)
+
+	// Degraded, but still serving
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	
+	var response map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "degraded", response["status"])
+	checks := response["checks"].(map[string]interface{})
+	assert.Equal(t, "degraded", checks["cache_writes"])
+	assert.Equal(t, "ok", checks["filesystem"])
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/ready", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// A critical failure still takes precedence
+	checker.AddCheck("filesystem", func() bool { return false })
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
@@ -39,8 +39,9 @@ func CORSWithOrigins(allowedOrigins []string) gin.HandlerFunc {
 			c.Header("Access-Control-Max-Age", "43200") // 12 hours
 		}
 
-		// Handle preflight requests
-		if c.Request.Method == "OPTIONS" {
+		// Handle preflight requests, unless a route answers them with the
+		// methods it allows
+		if c.Request.Method == "OPTIONS" && c.FullPath() == "" {
 			c.AbortWithStatus(http.StatusNoContent)
 			return
 		}
@@ -1,13 +1,14 @@
 package middleware
 
 import (
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// Logging returns a middleware that logs HTTP requests
+// Logging returns a middleware that logs HTTP requests with structured
+// fields. Server errors are logged at error level, client errors at warn.
 func Logging() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		start := time.Now()
@@ -17,65 +18,31 @@ func Logging() gin.HandlerFunc {
 		// Process request
 		c.Next()
 		
-		// Calculate request duration
-		duration := time.Since(start)
-		
-		// Get request ID if available
-		requestID := c.GetString("request_id")
-		
-		// Build log message
 		statusCode := c.Writer.Status()
-		method := c.Request.Method
-		clientIP := c.ClientIP()
-		
-		// Log format: [RequestID] ClientIP Method Path?Query Status Duration
-		logMsg := ""
-		if requestID != "" {
-			logMsg += "[" + requestID + "] "
+		attrs := []any{
+			"method", c.Request.Method,
+			"path", path,
+			"status", statusCode,
+			"duration", time.Since(start),
+			"client_ip", c.ClientIP(),
 		}
-		logMsg += clientIP + " " + method + " " + path
 		if query != "" {
-			logMsg += "?" + query
+			attrs = append(attrs, "query", query)
+		}
+		if requestID := c.GetString("request_id"); requestID != "" {
+			attrs = append(attrs, "request_id", requestID)
 		}
-		logMsg += " " + statusCodeString(statusCode) + " " + duration.String()
 		
-		log.Println(logMsg)
+		slog.Log(c.Request.Context(), statusLevel(statusCode), "request", attrs...)
 	}
 }
 
-func statusCodeString(code int) string {
+// statusLevel returns the log level for a response status
+func statusLevel(code int) slog.Level {
 	if code >= 500 {
-		return "ERROR:" + intToString(code)
+		return slog.LevelError
 	} else if code >= 400 {
-		return "WARN:" + intToString(code)
-	}
-	return intToString(code)
-}
-
-func intToString(i int) string {
-	switch i {
-	case 200:
-		return "200"
-	case 201:
-		return "201"
-	case 204:
-		return "204"
-	case 400:
-		return "400"
-	case 401:
-		return "401"
-	case 403:
-		return "403"
-	case 404:
-		return "404"
-	case 500:
-		return "500"
-	case 502:
-		return "502"
-	case 503:
-		return "503"
-	default:
-		// Fallback for other codes
-		return string(rune(i/100 + '0')) + string(rune((i/10)%10 + '0')) + string(rune(i%10 + '0'))
+		return slog.LevelWarn
 	}
+	return slog.LevelInfo
 }
@@ -2,7 +2,9 @@ package middleware
 
 import (
 	"bytes"
+	"encoding/json"
 	"log"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -10,6 +12,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLoggingMiddleware_RequestLogging(t *testing.T) {
@@ -167,3 +170,39 @@ func TestLoggingMiddleware_MultipleRequests(t *testing.T) {
 	lines := strings.Split(strings.TrimSpace(logStr), "\n")
 	assert.GreaterOrEqual(t, len(lines), 2)
 }
+
+func TestLoggingMiddleware_StructuredJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	
+	var logOutput bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logOutput, &slog.HandlerOptions{Level: slog.LevelWarn})))
+	defer slog.SetDefault(previous)
+	
+	router := gin.New()
+	router.Use(RequestID())
+	router.Use(Logging())
+	router.GET("/ok", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.GET("/fail", func(c *gin.Context) {
+		c.Status(http.StatusInternalServerError)
+	})
+	
+	for _, path := range []string{"/ok", "/fail?retry=1"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	
+	// Only the failed request reaches the warn level
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(logOutput.Bytes(), &entry))
+	assert.Equal(t, "ERROR", entry["level"])
+	assert.Equal(t, "request", entry["msg"])
+	assert.Equal(t, "GET", entry["method"])
+	assert.Equal(t, "/fail", entry["path"])
+	assert.Equal(t, "retry=1", entry["query"])
+	assert.Equal(t, float64(http.StatusInternalServerError), entry["status"])
+	assert.NotEmpty(t, entry["request_id"])
+	assert.Contains(t, entry, "duration")
+	assert.Contains(t, entry, "client_ip")
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Options returns a handler answering OPTIONS requests with 204 and an
+// Allow header listing the methods of the routes matching the request path.
+// Under CORS the allowed methods of the preflight response are narrowed to
+// the same list. Paths no route matches are answered 404.
+func Options(routes func() gin.RoutesInfo) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		methods := allowedMethods(routes(), c.Request.URL.Path)
+		if len(methods) == 0 {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		allow := strings.Join(append(methods, http.MethodOptions), ", ")
+
+		c.Header("Allow", allow)
+		if c.Writer.Header().Get("Access-Control-Allow-Origin") != "" {
+			c.Header("Access-Control-Allow-Methods", allow)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// allowedMethods returns the methods, other than OPTIONS, of the routes
+// whose pattern matches path, sorted
+func allowedMethods(routes gin.RoutesInfo, path string) []string {
+	seen := make(map[string]bool)
+	var methods []string
+	for _, route := range routes {
+		if route.Method == http.MethodOptions || seen[route.Method] || !matchRoute(route.Path, path) {
+			continue
+		}
+		seen[route.Method] = true
+		methods = append(methods, route.Method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// matchRoute reports whether path matches a gin route pattern, where :name
+// matches one segment and *name the rest of the path
+func matchRoute(pattern, path string) bool {
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range patternSegments {
+		if strings.HasPrefix(segment, "*") {
+			return true
+		}
+		if i >= len(pathSegments) {
+			return false
+		}
+		if !strings.HasPrefix(segment, ":") && segment != pathSegments[i] {
+			return false
+		}
+		if strings.HasPrefix(segment, ":") && pathSegments[i] == "" {
+			return false
+		}
+	}
+	return len(patternSegments) == len(pathSegments)
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptions_AllowedMethods(t *testing.T) {
+	routes := gin.RoutesInfo{
+		{Method: "GET", Path: "/img/*path"},
+		{Method: "DELETE", Path: "/img/*path"},
+		{Method: "OPTIONS", Path: "/img/*path"},
+		{Method: "POST", Path: "/cmd/clear"},
+		{Method: "GET", Path: "/cmd/info"},
+		{Method: "POST", Path: "/cmd/:name"},
+	}
+
+	tests := []struct {
+		path     string
+		expected []string
+	}{
+		{"/img/photo.jpg/800x600", []string{"DELETE", "GET"}},
+		{"/img", []string{"DELETE", "GET"}},
+		{"/cmd/clear", []string{"POST"}},
+		{"/cmd/info", []string{"GET", "POST"}},
+		{"/cmd/", nil},
+		{"/cmd/clear/all", nil},
+		{"/health", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Equal(t, tt.expected, allowedMethods(routes, tt.path))
+		})
+	}
+}
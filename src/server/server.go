@@ -2,10 +2,13 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"goimgserver/server/health"
+	"goimgserver/security"
 	"goimgserver/server/middleware"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -17,21 +20,34 @@ import (
 
 // Config holds server configuration
 type Config struct {
-	Port            int
-	ReadTimeout     time.Duration
-	WriteTimeout    time.Duration
-	ShutdownTimeout time.Duration
-	EnableCORS      bool
-	EnableRateLimit bool
-	RateLimit       int
-	RatePer         time.Duration
-	Production      bool
+	Port              int
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration // Time allowed to send request headers (0 = use ReadTimeout)
+	WriteTimeout      time.Duration
+	ShutdownTimeout   time.Duration
+	IdleTimeout       time.Duration // Keep-alive idle timeout (0 = use ReadTimeout)
+	MaxHeaderBytes    int           // Maximum request header size (0 = net/http default)
+	MaxBodyBytes      int64         // Maximum request body size (0 = unlimited)
+	EnableHTTP2       bool          // Serve HTTP/2 over cleartext (h2c) in addition to HTTP/1.1
+	BasePath          string        // Prefix for every route, e.g. "/images" behind a proxy
+	TLSCertFile       string        // PEM certificate; together with TLSKeyFile enables HTTPS
+	TLSKeyFile        string        // PEM private key for TLSCertFile
+	TLSMinVersion     uint16        // Minimum TLS version (0 = TLS 1.2)
+	RedirectPort      int           // Plain HTTP port redirecting to HTTPS when TLS is enabled (0 = off)
+	HealthTimeout     time.Duration // Request timeout for the health endpoints (0 = no limit)
+	EnableCORS        bool
+	EnableRateLimit   bool
+	RateLimit         int
+	RatePer           time.Duration
+	Production        bool          // Release mode without the /ping demo endpoint
 }
 
 // Server represents the HTTP server
 type Server struct {
 	Router       *gin.Engine
+	Routes       *gin.RouterGroup // Route group under the configured base path
 	httpServer   *http.Server
+	redirectServer *http.Server
 	config       *Config
 	healthChecker *health.Checker
 }
@@ -61,9 +77,18 @@ func New(config *Config) *Server {
 	// Setup middleware
 	srv.setupMiddleware()
 	
+	// Groups copy the middleware registered so far, so the route group is
+	// created only once all of it is in place
+	srv.Routes = router.Group(config.BasePath)
+	
 	// Setup health endpoints
 	srv.setupHealthEndpoints()
 	
+	// Demo endpoints are for development only
+	if !config.Production {
+		srv.setupDemoEndpoints()
+	}
+	
 	return srv
 }
 
@@ -86,6 +111,11 @@ func (s *Server) setupMiddleware() {
 	// Logging (after error handler to log errors too)
 	s.Router.Use(middleware.Logging())
 	
+	// Request body limit
+	if s.config.MaxBodyBytes > 0 {
+		s.Router.Use(security.RequestSizeLimiter(s.config.MaxBodyBytes))
+	}
+	
 	// Rate limiting (if enabled)
 	if s.config.EnableRateLimit {
 		s.Router.Use(middleware.RateLimit(s.config.RateLimit, s.config.RatePer))
@@ -94,9 +124,25 @@ func (s *Server) setupMiddleware() {
 
 // setupHealthEndpoints registers health check endpoints
 func (s *Server) setupHealthEndpoints() {
-	s.Router.GET("/health", s.healthChecker.DetailedHealthHandler)
-	s.Router.GET("/live", s.healthChecker.LivenessHandler)
-	s.Router.GET("/ready", s.healthChecker.ReadinessHandler)
+	group := s.Routes.Group("", security.TimeoutMiddleware(s.config.HealthTimeout))
+	group.GET("/health", s.healthChecker.DetailedHealthHandler)
+	group.GET("/live", s.healthChecker.LivenessHandler)
+	group.GET("/ready", s.healthChecker.ReadinessHandler)
+}
+
+// HandleOptions answers OPTIONS requests for relativePath under the base
+// path with the methods the routes matching the request path allow. Routes
+// registered later are included.
+func (s *Server) HandleOptions(relativePath string) {
+	s.Routes.OPTIONS(relativePath, middleware.Options(s.Router.Routes))
+}
+
+// setupDemoEndpoints registers /ping, which answers "pong" to check the
+// server by hand
+func (s *Server) setupDemoEndpoints() {
+	s.Routes.GET("/ping", security.TimeoutMiddleware(s.config.HealthTimeout), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "pong"})
+	})
 }
 
 // AddHealthCheck registers a health check function
@@ -104,26 +150,130 @@ func (s *Server) AddHealthCheck(name string, check health.HealthCheck) {
 	s.healthChecker.AddCheck(name, check)
 }
 
-// Start starts the HTTP server
+// AddNonCriticalHealthCheck registers a health check whose failure degrades
+// the reported status without taking the server out of service
+func (s *Server) AddNonCriticalHealthCheck(name string, check health.HealthCheck) {
+	s.healthChecker.AddNonCriticalCheck(name, check)
+}
+
+// Start starts the HTTP server, or the HTTPS server when TLS is configured
 func (s *Server) Start() error {
-	addr := fmt.Sprintf(":%d", s.config.Port)
+	s.httpServer = s.newHTTPServer()
+	addr := s.httpServer.Addr
 	
-	s.httpServer = &http.Server{
-		Addr:         addr,
-		Handler:      s.Router,
-		ReadTimeout:  s.config.ReadTimeout,
-		WriteTimeout: s.config.WriteTimeout,
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to start server: %w", err)
 	}
 	
-	log.Printf("Starting server on %s", addr)
+	if s.TLSEnabled() {
+		log.Printf("Starting HTTPS server on %s", addr)
+		s.startRedirect()
+	} else {
+		log.Printf("Starting server on %s", addr)
+	}
 	
-	if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	return s.serve(listener)
+}
+
+// TLSEnabled reports whether the server is configured to serve HTTPS
+func (s *Server) TLSEnabled() bool {
+	return s.config.TLSCertFile != "" && s.config.TLSKeyFile != ""
+}
+
+// serve accepts connections on listener until the server is shut down
+func (s *Server) serve(listener net.Listener) error {
+	var err error
+	if s.TLSEnabled() {
+		err = s.httpServer.ServeTLS(listener, s.config.TLSCertFile, s.config.TLSKeyFile)
+	} else {
+		err = s.httpServer.Serve(listener)
+	}
+	if err != nil && err != http.ErrServerClosed {
 		return fmt.Errorf("failed to start server: %w", err)
 	}
 	
 	return nil
 }
 
+// startRedirect starts the plain HTTP listener that redirects to HTTPS
+func (s *Server) startRedirect() {
+	if s.config.RedirectPort == 0 {
+		return
+	}
+	
+	s.redirectServer = s.newRedirectServer()
+	log.Printf("Redirecting HTTP on %s to HTTPS", s.redirectServer.Addr)
+	go func() {
+		if err := s.redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("HTTP redirect server error: %v", err)
+		}
+	}()
+}
+
+// newRedirectServer builds a server answering every request with a
+// permanent redirect to the same URL on the HTTPS port
+func (s *Server) newRedirectServer() *http.Server {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if s.config.Port != 443 {
+			host = net.JoinHostPort(host, fmt.Sprint(s.config.Port))
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+	
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%d", s.config.RedirectPort),
+		Handler:           handler,
+		ReadHeaderTimeout: s.readHeaderTimeout(),
+		IdleTimeout:       s.config.IdleTimeout,
+	}
+}
+
+// readHeaderTimeout returns the time clients have to send request headers.
+// Slow header senders are cut off so they cannot hold connections open.
+func (s *Server) readHeaderTimeout() time.Duration {
+	if s.config.ReadHeaderTimeout > 0 {
+		return s.config.ReadHeaderTimeout
+	}
+	return s.config.ReadTimeout
+}
+
+// newHTTPServer builds the underlying http.Server from the configuration
+func (s *Server) newHTTPServer() *http.Server {
+	httpServer := &http.Server{
+		Addr:           fmt.Sprintf(":%d", s.config.Port),
+		Handler:        s.Router,
+		ReadTimeout:       s.config.ReadTimeout,
+		ReadHeaderTimeout: s.readHeaderTimeout(),
+		WriteTimeout:      s.config.WriteTimeout,
+		IdleTimeout:       s.config.IdleTimeout,
+		MaxHeaderBytes:    s.config.MaxHeaderBytes,
+	}
+	
+	// Allow HTTP/2 without TLS for origins sitting behind an h2c-capable proxy
+	if s.config.EnableHTTP2 {
+		protocols := new(http.Protocols)
+		protocols.SetHTTP1(true)
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+		httpServer.Protocols = protocols
+	}
+	
+	if s.TLSEnabled() {
+		minVersion := s.config.TLSMinVersion
+		if minVersion == 0 {
+			minVersion = tls.VersionTLS12
+		}
+		httpServer.TLSConfig = &tls.Config{MinVersion: minVersion}
+	}
+	
+	return httpServer
+}
+
 // Shutdown gracefully shuts down the server
 func (s *Server) Shutdown(ctx context.Context) error {
 	if s.httpServer == nil {
@@ -132,6 +282,12 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	
 	log.Println("Shutting down server...")
 	
+	if s.redirectServer != nil {
+		if err := s.redirectServer.Shutdown(ctx); err != nil {
+			log.Printf("Warning: HTTP redirect server shutdown failed: %v", err)
+		}
+	}
+	
 	if err := s.httpServer.Shutdown(ctx); err != nil {
 		return fmt.Errorf("server shutdown failed: %w", err)
 	}
@@ -1,15 +1,30 @@
 package server
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestServer_Integration_FullStack(t *testing.T) {
@@ -202,3 +217,362 @@ func TestServer_RateLimiting(t *testing.T) {
 	assert.Equal(t, 5, successCount, "Should allow 5 requests")
 	assert.Equal(t, 5, limitedCount, "Should rate limit 5 requests")
 }
+
+func TestServer_HTTPServer_TuningOptions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	
+	config := &Config{
+		Port:            9002,
+		ReadTimeout:       7 * time.Second,
+		ReadHeaderTimeout: 3 * time.Second,
+		WriteTimeout:      8 * time.Second,
+		IdleTimeout:       90 * time.Second,
+		MaxHeaderBytes:    64 << 10,
+		ShutdownTimeout:   2 * time.Second,
+	}
+	
+	srv := New(config)
+	httpServer := srv.newHTTPServer()
+	
+	assert.Equal(t, ":9002", httpServer.Addr)
+	assert.Equal(t, 7*time.Second, httpServer.ReadTimeout)
+	assert.Equal(t, 3*time.Second, httpServer.ReadHeaderTimeout)
+	assert.Equal(t, 8*time.Second, httpServer.WriteTimeout)
+	assert.Equal(t, 90*time.Second, httpServer.IdleTimeout)
+	assert.Equal(t, 64<<10, httpServer.MaxHeaderBytes)
+	assert.Nil(t, httpServer.Protocols)
+}
+
+func TestServer_HTTPServer_EnableHTTP2(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	
+	srv := New(&Config{Port: 9003, EnableHTTP2: true})
+	httpServer := srv.newHTTPServer()
+	
+	if assert.NotNil(t, httpServer.Protocols) {
+		assert.True(t, httpServer.Protocols.HTTP1())
+		assert.True(t, httpServer.Protocols.HTTP2())
+		assert.True(t, httpServer.Protocols.UnencryptedHTTP2())
+	}
+}
+
+// TestServer_PingEndpoint tests that /ping only exists outside production
+func TestServer_PingEndpoint(t *testing.T) {
+	tests := []struct {
+		name       string
+		production bool
+		status     int
+	}{
+		{"Development", false, http.StatusOK},
+		{"Production", true, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(func() { gin.SetMode(gin.TestMode) })
+			srv := New(&Config{Port: 9005, Production: tt.production})
+
+			w := httptest.NewRecorder()
+			srv.Router.ServeHTTP(w, httptest.NewRequest("GET", "/ping", nil))
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusOK {
+				assert.JSONEq(t, `{"message":"pong"}`, w.Body.String())
+			}
+
+			// Health checks stay available in production
+			w = httptest.NewRecorder()
+			srv.Router.ServeHTTP(w, httptest.NewRequest("GET", "/live", nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+		})
+	}
+}
+
+func TestServer_BasePath(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	
+	srv := New(&Config{Port: 9004, BasePath: "/images"})
+	srv.Routes.GET("/img/*path", func(c *gin.Context) {
+		c.String(http.StatusOK, c.Param("path"))
+	})
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		body   string
+	}{
+		{"Image under base path", "/images/img/photo.jpg/800", http.StatusOK, "/photo.jpg/800"},
+		{"Health under base path", "/images/health", http.StatusOK, ""},
+		{"Ping under base path", "/images/ping", http.StatusOK, ""},
+		{"Image without base path", "/img/photo.jpg", http.StatusNotFound, ""},
+		{"Health without base path", "/health", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.Router.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.body != "" {
+				assert.Equal(t, tt.body, w.Body.String())
+			}
+		})
+	}
+}
+
+// TestServer_HandleOptions tests that OPTIONS on the image and command
+// routes lists the methods each route allows
+func TestServer_HandleOptions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	srv := New(&Config{Port: 9005, BasePath: "/images", EnableCORS: true})
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	srv.Routes.GET("/img/*path", ok)
+	srv.Routes.HEAD("/img/*path", ok)
+	srv.Routes.DELETE("/img/*path", ok)
+	cmd := srv.Routes.Group("/cmd", func(c *gin.Context) { c.AbortWithStatus(http.StatusUnauthorized) })
+	cmd.POST("/clear", ok)
+	cmd.GET("/info", ok)
+	cmd.POST("/:name", ok)
+	srv.HandleOptions("/img/*path")
+	srv.HandleOptions("/cmd/*path")
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		allow  string
+	}{
+		{"Image", "/images/img/photo.jpg/800x600/webp", http.StatusNoContent, "DELETE, GET, HEAD, OPTIONS"},
+		{"Image group", "/images/img/cats/", http.StatusNoContent, "DELETE, GET, HEAD, OPTIONS"},
+		{"Command", "/images/cmd/clear", http.StatusNoContent, "POST, OPTIONS"},
+		{"Read-only command", "/images/cmd/info", http.StatusNoContent, "GET, POST, OPTIONS"},
+		{"Custom command", "/images/cmd/purge-cdn", http.StatusNoContent, "POST, OPTIONS"},
+		{"Nested command path", "/images/cmd/clear/all", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Plain request, as for API discovery; the command's auth
+			// middleware is not run
+			w := httptest.NewRecorder()
+			srv.Router.ServeHTTP(w, httptest.NewRequest("OPTIONS", tt.path, nil))
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, tt.allow, w.Header().Get("Allow"))
+
+			// CORS preflight
+			req := httptest.NewRequest("OPTIONS", tt.path, nil)
+			req.Header.Set("Origin", "https://example.com")
+			req.Header.Set("Access-Control-Request-Method", "POST")
+			w = httptest.NewRecorder()
+			srv.Router.ServeHTTP(w, req)
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+			if tt.allow != "" {
+				assert.Equal(t, tt.allow, w.Header().Get("Access-Control-Allow-Methods"))
+			}
+		})
+	}
+}
+
+// writeSelfSignedCert writes a self-signed certificate for 127.0.0.1 and returns the file paths
+func writeSelfSignedCert(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "goimgserver test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+// startTLSServer serves srv over TLS on a random local port and returns its URL
+func startTLSServer(t *testing.T, srv *Server) string {
+	t.Helper()
+	return "https://" + startServer(t, srv)
+}
+
+// startServer serves srv on a random local port and returns its address
+func startServer(t *testing.T, srv *Server) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv.httpServer = srv.newHTTPServer()
+	done := make(chan error, 1)
+	go func() { done <- srv.serve(listener) }()
+	t.Cleanup(func() {
+		srv.Shutdown(context.Background())
+		assert.NoError(t, <-done)
+	})
+	return listener.Addr().String()
+}
+
+func TestServer_ReadHeaderTimeout_SlowClient(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	
+	srv := New(&Config{Port: 9007, ReadTimeout: 10 * time.Second, ReadHeaderTimeout: 200 * time.Millisecond})
+	addr := startServer(t, srv)
+	
+	// Send a partial request and never finish the headers
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET /live HTTP/1.1\r\nHost: localhost\r\n"))
+	require.NoError(t, err)
+	
+	start := time.Now()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = conn.Read(make([]byte, 512))
+	
+	// The server closes the connection after the header timeout
+	assert.Error(t, err)
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		assert.False(t, netErr.Timeout(), "Server kept the slow connection open")
+	}
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestServer_MaxBodyBytes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	
+	srv := New(&Config{Port: 9008, MaxBodyBytes: 1024})
+	srv.Routes.POST("/upload", func(c *gin.Context) {
+		if _, err := io.ReadAll(c.Request.Body); err != nil {
+			c.Status(http.StatusRequestEntityTooLarge)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	
+	tests := []struct {
+		name     string
+		size     int
+		chunked  bool
+		expected int
+	}{
+		{"Small body", 512, false, http.StatusOK},
+		{"Declared too large", 2048, false, http.StatusRequestEntityTooLarge},
+		{"Chunked too large", 2048, true, http.StatusRequestEntityTooLarge},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/upload", bytes.NewReader(make([]byte, tt.size)))
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			srv.Router.ServeHTTP(w, req)
+			
+			assert.Equal(t, tt.expected, w.Code)
+		})
+	}
+}
+
+func TestServer_TLS_ServesHTTPS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	
+	certFile, keyFile := writeSelfSignedCert(t)
+	srv := New(&Config{Port: 9005, TLSCertFile: certFile, TLSKeyFile: keyFile})
+	assert.True(t, srv.TLSEnabled())
+	baseURL := startTLSServer(t, srv)
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+	resp, err := client.Get(baseURL + "/live")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	if assert.NotNil(t, resp.TLS) {
+		assert.GreaterOrEqual(t, resp.TLS.Version, uint16(tls.VersionTLS12))
+	}
+}
+
+func TestServer_TLS_MinVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	
+	certFile, keyFile := writeSelfSignedCert(t)
+
+	tests := []struct {
+		name          string
+		minVersion    uint16
+		clientMax     uint16
+		expectSuccess bool
+	}{
+		{"Default rejects TLS 1.1", 0, tls.VersionTLS11, false},
+		{"Default accepts TLS 1.2", 0, tls.VersionTLS12, true},
+		{"TLS 1.3 minimum rejects TLS 1.2", tls.VersionTLS13, tls.VersionTLS12, false},
+		{"TLS 1.3 minimum accepts TLS 1.3", tls.VersionTLS13, tls.VersionTLS13, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := New(&Config{Port: 9006, TLSCertFile: certFile, TLSKeyFile: keyFile, TLSMinVersion: tt.minVersion})
+			baseURL := startTLSServer(t, srv)
+
+			client := &http.Client{Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true, MinVersion: tls.VersionTLS10, MaxVersion: tt.clientMax},
+			}}
+			resp, err := client.Get(baseURL + "/live")
+			if tt.expectSuccess {
+				require.NoError(t, err)
+				resp.Body.Close()
+				assert.Equal(t, tt.clientMax, resp.TLS.Version)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestServer_TLS_HTTPRedirect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	
+	srv := New(&Config{Port: 8443, RedirectPort: 8080})
+	redirectServer := srv.newRedirectServer()
+	assert.Equal(t, ":8080", redirectServer.Addr)
+
+	tests := []struct {
+		name     string
+		port     int
+		target   string
+		expected string
+	}{
+		{"Custom HTTPS port", 8443, "http://example.com:8080/img/photo.jpg/800?v=1", "https://example.com:8443/img/photo.jpg/800?v=1"},
+		{"Default HTTPS port", 443, "http://example.com/health", "https://example.com/health"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv.config.Port = tt.port
+			w := httptest.NewRecorder()
+			redirectServer.Handler.ServeHTTP(w, httptest.NewRequest("GET", tt.target, nil))
+
+			assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+			assert.Equal(t, tt.expected, w.Header().Get("Location"))
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OpenArchive opens a .zip or uncompressed .tar file as a read-only fs.FS.
+// Files are read from the archive on demand, nothing is unpacked; the
+// returned closer closes the archive file.
+func OpenArchive(name string) (fs.FS, io.Closer, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	var fsys fs.FS
+	switch ext := strings.ToLower(path.Ext(name)); ext {
+	case ".zip":
+		fsys, err = zip.NewReader(f, info.Size())
+	case ".tar":
+		fsys, err = NewTarFS(f)
+	default:
+		err = fmt.Errorf("unsupported archive type %q: must be .zip or .tar", ext)
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return fsys, f, nil
+}
+
+// tarEntry is a file or directory of a tar archive. It is its own
+// fs.FileInfo and fs.DirEntry.
+type tarEntry struct {
+	name     string
+	size     int64
+	offset   int64 // Start of the file data in the archive
+	mode     fs.FileMode
+	modTime  time.Time
+	children []*tarEntry
+}
+
+func (e *tarEntry) Name() string               { return e.name }
+func (e *tarEntry) Size() int64                { return e.size }
+func (e *tarEntry) Mode() fs.FileMode          { return e.mode }
+func (e *tarEntry) ModTime() time.Time         { return e.modTime }
+func (e *tarEntry) IsDir() bool                { return e.mode.IsDir() }
+func (e *tarEntry) Sys() any                   { return nil }
+func (e *tarEntry) Type() fs.FileMode          { return e.mode.Type() }
+func (e *tarEntry) Info() (fs.FileInfo, error) { return e, nil }
+
+// tarFS serves the regular files and directories of a tar archive read
+// through an io.ReaderAt. Links and other special entries are left out.
+type tarFS struct {
+	r       io.ReaderAt
+	entries map[string]*tarEntry
+}
+
+// countingReader tracks how far the tar reader has read, which after each
+// header is where that entry's data starts
+type countingReader struct {
+	r      io.Reader
+	offset int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.offset += int64(n)
+	return n, err
+}
+
+// NewTarFS indexes the tar archive read through r. Only the headers are
+// read; file data is read when a file is opened.
+func NewTarFS(r io.ReaderAt) (fs.FS, error) {
+	t := &tarFS{r: r, entries: map[string]*tarEntry{".": {name: ".", mode: fs.ModeDir | 0555}}}
+	counter := &countingReader{r: io.NewSectionReader(r, 0, 1<<63-1)}
+	tr := tar.NewReader(counter)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		if !fs.ValidPath(name) || name == "." {
+			continue
+		}
+		switch header.Typeflag {
+		case tar.TypeReg:
+			t.add(name, &tarEntry{size: header.Size, offset: counter.offset, mode: fs.FileMode(header.Mode).Perm(), modTime: header.ModTime})
+		case tar.TypeDir:
+			t.add(name, &tarEntry{mode: fs.ModeDir | fs.FileMode(header.Mode).Perm(), modTime: header.ModTime})
+		}
+	}
+	for _, entry := range t.entries {
+		sort.Slice(entry.children, func(i, j int) bool { return entry.children[i].name < entry.children[j].name })
+	}
+	return t, nil
+}
+
+// add records entry under name, creating missing parent directories. A
+// directory header for an already implied directory fills in its details.
+func (t *tarFS) add(name string, entry *tarEntry) {
+	entry.name = path.Base(name)
+	if existing, found := t.entries[name]; found {
+		if existing.IsDir() && entry.IsDir() {
+			existing.mode, existing.modTime = entry.mode, entry.modTime
+		}
+		return
+	}
+	t.entries[name] = entry
+
+	parentName := path.Dir(name)
+	parent, found := t.entries[parentName]
+	if !found {
+		parent = &tarEntry{mode: fs.ModeDir | 0555}
+		t.add(parentName, parent)
+	}
+	parent.children = append(parent.children, entry)
+}
+
+// Open opens the named file or directory
+func (t *tarFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	entry, found := t.entries[name]
+	if !found {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if entry.IsDir() {
+		return &tarDir{entry: entry}, nil
+	}
+	return &tarFile{entry: entry, SectionReader: io.NewSectionReader(t.r, entry.offset, entry.size)}, nil
+}
+
+// tarFile is an open file of a tar archive
+type tarFile struct {
+	*io.SectionReader
+	entry *tarEntry
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) { return f.entry, nil }
+
+func (f *tarFile) Close() error { return nil }
+
+// tarDir is an open directory of a tar archive
+type tarDir struct {
+	entry *tarEntry
+	read  int // Children already returned by ReadDir
+}
+
+func (d *tarDir) Stat() (fs.FileInfo, error) { return d.entry, nil }
+
+func (d *tarDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.entry.name, Err: fs.ErrInvalid}
+}
+
+func (d *tarDir) Close() error { return nil }
+
+// ReadDir returns the next n entries, or all remaining ones when n <= 0
+func (d *tarDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := d.entry.children[d.read:]
+	if n > 0 && len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < len(remaining) {
+		remaining = remaining[:n]
+	}
+	entries := make([]fs.DirEntry, len(remaining))
+	for i, child := range remaining {
+		entries[i] = child
+	}
+	d.read += len(remaining)
+	return entries, nil
+}
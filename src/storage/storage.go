@@ -0,0 +1,94 @@
+// Package storage abstracts where image sources are read from: the OS file
+// system, or an fs.FS such as an archive mounted at the images directory.
+package storage
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FS reads image sources by their OS path
+type FS interface {
+	Stat(path string) (fs.FileInfo, error)
+	Open(path string) (fs.File, error)
+	ReadDir(path string) ([]fs.DirEntry, error)
+}
+
+// OS is the operating system's file system
+var OS FS = osFS{}
+
+// osFS reads from the OS file system
+type osFS struct{}
+
+func (osFS) Stat(path string) (fs.FileInfo, error) { return os.Stat(path) }
+
+func (osFS) Open(path string) (fs.File, error) { return os.Open(path) }
+
+func (osFS) ReadDir(path string) ([]fs.DirEntry, error) { return os.ReadDir(path) }
+
+// mount serves fsys at dir and every other path from the OS file system
+type mount struct {
+	dir  string
+	fsys fs.FS
+}
+
+// Mount returns an FS that serves the files of fsys as if they were in dir.
+// Paths outside dir, such as generated placeholders in the cache directory,
+// are read from the OS file system.
+func Mount(dir string, fsys fs.FS) FS {
+	return &mount{dir: filepath.Clean(dir), fsys: fsys}
+}
+
+// resolve returns the name of path within fsys, or false when path is
+// outside the mount point
+func (m *mount) resolve(path string) (string, bool) {
+	rel, err := filepath.Rel(m.dir, filepath.Clean(path))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+func (m *mount) Stat(path string) (fs.FileInfo, error) {
+	if name, ok := m.resolve(path); ok {
+		return fs.Stat(m.fsys, name)
+	}
+	return os.Stat(path)
+}
+
+func (m *mount) Open(path string) (fs.File, error) {
+	if name, ok := m.resolve(path); ok {
+		return m.fsys.Open(name)
+	}
+	return os.Open(path)
+}
+
+func (m *mount) ReadDir(path string) ([]fs.DirEntry, error) {
+	if name, ok := m.resolve(path); ok {
+		return fs.ReadDir(m.fsys, name)
+	}
+	return os.ReadDir(path)
+}
+
+// SameFile reports whether two infos describe the same file, like
+// os.SameFile. Files of other file systems, which cannot be replaced while
+// they are read, are compared by name.
+func SameFile(a, b fs.FileInfo) bool {
+	if os.SameFile(a, a) || os.SameFile(b, b) {
+		return os.SameFile(a, b)
+	}
+	return a.Name() == b.Name()
+}
+
+// ReadFile reads the whole file at path from files
+func ReadFile(files FS, path string) ([]byte, error) {
+	f, err := files.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
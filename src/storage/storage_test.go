@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// archiveFiles are the files written to test archives
+var archiveFiles = map[string]string{
+	"default.jpg":          "system default",
+	"photo.jpg":            "photo",
+	"cats/default.jpg":     "cats default",
+	"cats/cat_white.jpg":   "white cat",
+	"cats/kittens/one.png": "kitten",
+}
+
+// writeTar writes archiveFiles as a tar archive, with a header for the cats
+// directory but not for cats/kittens
+func writeTar(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "cats/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: time.Unix(1700000000, 0)}))
+	for _, name := range []string{"default.jpg", "photo.jpg", "cats/default.jpg", "cats/cat_white.jpg", "cats/kittens/one.png"} {
+		body := archiveFiles[name]
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(body)), ModTime: time.Unix(1700000000, 0)}))
+		_, err := tw.Write([]byte(body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "link.jpg", Typeflag: tar.TypeSymlink, Linkname: "photo.jpg"}))
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+// writeZip writes archiveFiles as a zip archive without directory entries
+func writeZip(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range archiveFiles {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+// TestTarFS tests that a tar archive is served as a file system
+func TestTarFS(t *testing.T) {
+	fsys, err := NewTarFS(bytes.NewReader(writeTar(t)))
+	require.NoError(t, err)
+
+	require.NoError(t, fstest.TestFS(fsys, "default.jpg", "photo.jpg", "cats/default.jpg", "cats/cat_white.jpg", "cats/kittens/one.png"))
+	for name, body := range archiveFiles {
+		data, err := fs.ReadFile(fsys, name)
+		require.NoError(t, err, name)
+		assert.Equal(t, body, string(data), name)
+	}
+
+	// Links are left out
+	_, err = fs.Stat(fsys, "link.jpg")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+// TestOpenArchive tests opening zip and tar files by extension
+func TestOpenArchive(t *testing.T) {
+	dir := t.TempDir()
+	archives := map[string][]byte{"images.zip": writeZip(t), "images.tar": writeTar(t)}
+	for name, data := range archives {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			require.NoError(t, os.WriteFile(path, data, 0644))
+
+			fsys, closer, err := OpenArchive(path)
+			require.NoError(t, err)
+			defer closer.Close()
+
+			data, err := fs.ReadFile(fsys, "cats/cat_white.jpg")
+			require.NoError(t, err)
+			assert.Equal(t, "white cat", string(data))
+		})
+	}
+
+	unsupported := filepath.Join(dir, "images.rar")
+	require.NoError(t, os.WriteFile(unsupported, []byte("rar"), 0644))
+	_, _, err := OpenArchive(unsupported)
+	assert.Error(t, err)
+}
+
+// TestMount tests that paths below the mount point are read from the
+// mounted file system and others from the OS
+func TestMount(t *testing.T) {
+	data := writeZip(t)
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	imagesDir := filepath.Join(t.TempDir(), "images")
+	outside := filepath.Join(t.TempDir(), "placeholder.jpg")
+	require.NoError(t, os.WriteFile(outside, []byte("placeholder"), 0644))
+	files := Mount(imagesDir, zr)
+
+	data, err = ReadFile(files, filepath.Join(imagesDir, "cats", "cat_white.jpg"))
+	require.NoError(t, err)
+	assert.Equal(t, "white cat", string(data))
+
+	info, err := files.Stat(imagesDir)
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+	info, err = files.Stat(filepath.Join(imagesDir, "cats"))
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+
+	entries, err := files.ReadDir(filepath.Join(imagesDir, "cats"))
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"cat_white.jpg", "default.jpg", "kittens"}, names)
+
+	_, err = files.Stat(filepath.Join(imagesDir, "missing.jpg"))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	data, err = ReadFile(files, outside)
+	require.NoError(t, err)
+	assert.Equal(t, "placeholder", string(data))
+	_, err = files.Stat(filepath.Join(imagesDir, "..", "placeholder.jpg"))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
@@ -0,0 +1,150 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Events a notifier is told about
+const (
+	EventCacheCleared      = "cache.cleared"
+	EventGitUpdated        = "git.updated"
+	EventPreCacheCompleted = "precache.completed"
+)
+
+// DefaultTimeout bounds each delivery attempt when no timeout is given
+const DefaultTimeout = 5 * time.Second
+
+// defaultBackoff is the wait before the first retry, doubled for each
+// further retry
+const defaultBackoff = 500 * time.Millisecond
+
+// Payload is the JSON body POSTed to every webhook URL
+type Payload struct {
+	Event string         `json:"event"`
+	Time  time.Time      `json:"time"`
+	Node  string         `json:"node,omitempty"` // Host name of the sending server
+	Data  map[string]any `json:"data,omitempty"`
+}
+
+// Notifier POSTs events to webhook URLs in the background, so peers can
+// react to them, e.g. clear their own caches. Each URL is tried once and
+// retried with exponential backoff until it answers with a 2xx status;
+// deliveries that still fail are logged and dropped, never reported to the
+// caller. A nil Notifier sends nothing.
+type Notifier struct {
+	urls    []string
+	client  *http.Client
+	retries int
+	backoff time.Duration
+	node    string
+	wg      sync.WaitGroup
+}
+
+// New creates a notifier for urls, bounding each attempt by timeout
+// (0 = DefaultTimeout) and retrying a failed delivery up to retries times.
+// It returns nil when urls is empty.
+func New(urls []string, timeout time.Duration, retries int) *Notifier {
+	if len(urls) == 0 {
+		return nil
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	node, _ := os.Hostname()
+	return &Notifier{
+		urls:    urls,
+		client:  &http.Client{Timeout: timeout},
+		retries: retries,
+		backoff: defaultBackoff,
+		node:    node,
+	}
+}
+
+// Notify sends event with data to every URL without waiting for them
+func (n *Notifier) Notify(event string, data map[string]any) {
+	if n == nil {
+		return
+	}
+	body, err := json.Marshal(Payload{Event: event, Time: time.Now().UTC(), Node: n.node, Data: data})
+	if err != nil {
+		log.Printf("Warning: webhook %s not sent: %v", event, err)
+		return
+	}
+	for _, url := range n.urls {
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+			if err := n.deliver(url, body); err != nil {
+				log.Printf("Warning: webhook %s to %s failed: %v", event, url, err)
+			}
+		}()
+	}
+}
+
+// Wait blocks until the deliveries in progress succeeded or gave up
+func (n *Notifier) Wait() {
+	if n != nil {
+		n.wg.Wait()
+	}
+}
+
+// WaitContext is Wait that gives up when ctx ends, returning the context's
+// error and leaving the remaining deliveries to run on
+func (n *Notifier) WaitContext(ctx context.Context) error {
+	if n == nil {
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// deliver POSTs body to url, retrying with backoff, and returns the error
+// of the last attempt
+func (n *Notifier) deliver(url string, body []byte) error {
+	var err error
+	for attempt := 0; attempt <= n.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(n.backoff << (attempt - 1))
+		}
+		if err = n.post(url, body); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w (after %d attempts)", err, n.retries+1)
+}
+
+// post makes one delivery attempt
+func (n *Notifier) post(url string, body []byte) error {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "goimgserver-webhook")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
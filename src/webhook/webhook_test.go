@@ -0,0 +1,142 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNotifier_Notify tests that every URL receives the event as JSON
+func TestNotifier_Notify(t *testing.T) {
+	// Arrange
+	var mu sync.Mutex
+	var received []Payload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var payload Payload
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		mu.Lock()
+		received = append(received, payload)
+		mu.Unlock()
+	}))
+	defer server.Close()
+	notifier := New([]string{server.URL + "/a", server.URL + "/b"}, time.Second, 0)
+
+	// Act
+	notifier.Notify(EventCacheCleared, map[string]any{"cleared_files": 3})
+	notifier.Wait()
+
+	// Assert
+	require.Len(t, received, 2)
+	for _, payload := range received {
+		assert.Equal(t, EventCacheCleared, payload.Event)
+		assert.Equal(t, float64(3), payload.Data["cleared_files"])
+		assert.WithinDuration(t, time.Now(), payload.Time, time.Minute)
+	}
+}
+
+// TestNotifier_Retry tests that failed deliveries are retried with backoff
+// until one succeeds or the retries run out
+func TestNotifier_Retry(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int32
+		retries  int
+		attempts int32
+	}{
+		{"Succeeds first time", 0, 3, 1},
+		{"Succeeds on retry", 2, 3, 3},
+		{"Gives up", 10, 2, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.Copy(io.Discard, r.Body)
+				if attempts.Add(1) <= tt.failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer server.Close()
+			notifier := New([]string{server.URL}, time.Second, tt.retries)
+			notifier.backoff = time.Millisecond
+
+			// Act
+			notifier.Notify(EventGitUpdated, nil)
+			notifier.Wait()
+
+			// Assert
+			assert.Equal(t, tt.attempts, attempts.Load())
+		})
+	}
+}
+
+// TestNotifier_Timeout tests that a hanging URL is abandoned after the
+// timeout without holding up Notify
+func TestNotifier_Timeout(t *testing.T) {
+	// Arrange
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	notifier := New([]string{server.URL}, 50*time.Millisecond, 1)
+	notifier.backoff = time.Millisecond
+
+	// Act
+	start := time.Now()
+	notifier.Notify(EventPreCacheCompleted, nil)
+	returned := time.Since(start)
+	notifier.Wait()
+
+	// Assert
+	assert.Less(t, returned, 50*time.Millisecond, "Notify waited for the delivery")
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+// TestNotifier_WaitContext tests that waiting for a hanging delivery gives
+// up when the context ends
+func TestNotifier_WaitContext(t *testing.T) {
+	// Arrange
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	notifier := New([]string{server.URL}, time.Minute, 0)
+	notifier.Notify(EventCacheCleared, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// Act
+	start := time.Now()
+	err := notifier.WaitContext(ctx)
+
+	// Assert
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+// TestNotifier_Nil tests that a notifier without URLs sends nothing
+func TestNotifier_Nil(t *testing.T) {
+	notifier := New(nil, 0, 3)
+
+	assert.Nil(t, notifier)
+	notifier.Notify(EventCacheCleared, nil)
+	notifier.Wait()
+	assert.NoError(t, notifier.WaitContext(context.Background()))
+}